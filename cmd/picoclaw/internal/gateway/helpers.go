@@ -21,8 +21,10 @@ import (
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/storage"
 	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/voice"
 	"github.com/sipeed/picoclaw/pkg/webui"
@@ -38,6 +40,9 @@ func gatewayCmd(debug bool) error {
 	if err != nil {
 		return fmt.Errorf("error loading config: %w", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
 
 	provider, modelID, err := providers.CreateProvider(cfg)
 	if err != nil {
@@ -50,6 +55,13 @@ func gatewayCmd(debug bool) error {
 	}
 
 	msgBus := bus.NewMessageBus()
+	if cfg.Gateway.PersistInbound {
+		inboundLog, err := bus.OpenInboundLog(filepath.Join(cfg.WorkspacePath(), "state", "inbound.json"))
+		if err != nil {
+			return fmt.Errorf("error opening inbound log: %w", err)
+		}
+		msgBus.SetInboundLog(inboundLog)
+	}
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
 
 	// Print agent startup info
@@ -150,6 +162,16 @@ func gatewayCmd(debug bool) error {
 		}
 	}
 
+	if voiceReply := cfg.Channels.Telegram.VoiceReply; voiceReply.Enabled {
+		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
+			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
+				tc.SetSynthesizer(voice.NewHTTPSynthesizer(
+					voiceReply.APIBase, voiceReply.APIKey, voiceReply.Model, voiceReply.Voice))
+				logger.InfoC("voice", "Voice replies enabled for Telegram channel")
+			}
+		}
+	}
+
 	enabledChannels := channelManager.GetEnabledChannels()
 	if len(enabledChannels) > 0 {
 		fmt.Printf("✓ Channels enabled: %s\n", enabledChannels)
@@ -190,12 +212,24 @@ func gatewayCmd(debug bool) error {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	healthAddr := fmt.Sprintf("%s:%d", cfg.Gateway.Host, cfg.Gateway.Port)
+	if cfg.Gateway.HealthAddr != "" {
+		healthServer = health.NewServerAddr(cfg.Gateway.HealthAddr)
+		healthAddr = cfg.Gateway.HealthAddr
+	}
+	addHealthChecks(healthServer, cfg, channelManager)
+	if cfg.Gateway.Metrics {
+		healthServer.Handle("/metrics", metrics.Handler())
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.ErrorCF("health", "Health server error", map[string]any{"error": err.Error()})
 		}
 	}()
-	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	fmt.Printf("✓ Health endpoints available at http://%s/healthz and /readyz\n", healthAddr)
+	if cfg.Gateway.Metrics {
+		fmt.Printf("✓ Metrics available at http://%s/metrics\n", healthAddr)
+	}
 
 	// Start WebUI server if enabled
 	var webuiServer *webui.Server
@@ -260,9 +294,37 @@ func setupCronTool(
 
 	// Set the onJob handler
 	cronService.SetOnJob(func(job *cron.CronJob) (string, error) {
-		result := cronTool.ExecuteJob(context.Background(), job)
-		return result, nil
+		return cronTool.ExecuteJob(context.Background(), job)
 	})
 
 	return cronService
 }
+
+// addHealthChecks makes readiness depend on every enabled channel running
+// and, when long-term memory is enabled, on Qdrant being reachable.
+func addHealthChecks(server *health.Server, cfg *config.Config, channelManager *channels.Manager) {
+	for _, name := range channelManager.GetEnabledChannels() {
+		channel, ok := channelManager.GetChannel(name)
+		if !ok {
+			continue
+		}
+		server.AddCheck("channel:"+name, func() (bool, string) {
+			if channel.IsRunning() {
+				return true, "running"
+			}
+			return false, "not running"
+		})
+	}
+
+	if cfg.Storage.Qdrant.Enabled {
+		qdrant := storage.NewQdrantClient(cfg.Storage.Qdrant)
+		server.AddCheck("qdrant", func() (bool, string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if _, err := qdrant.CollectionExists(ctx); err != nil {
+				return false, err.Error()
+			}
+			return true, "reachable"
+		})
+	}
+}
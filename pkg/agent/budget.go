@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// dailyBudget enforces the per-user or per-session daily message and token
+// limits. Counters reset at the configured time of day in the configured
+// time zone and are saved with their period, so a restart does not reset
+// them.
+type dailyBudget struct {
+	cfg       config.DailyBudgetConfig
+	resetHour int
+	resetMin  int
+	location  *time.Location
+	path      string // file the counters are saved to; empty keeps them in memory
+	now       func() time.Time
+
+	mu     sync.Mutex
+	period time.Time // start of the current budget period
+	used   map[string]*budgetUsage
+}
+
+type budgetUsage struct {
+	Messages int `json:"messages"`
+	Tokens   int `json:"tokens"`
+}
+
+// budgetState is the saved form of the counters.
+type budgetState struct {
+	Period time.Time               `json:"period"`
+	Used   map[string]*budgetUsage `json:"used"`
+}
+
+// newDailyBudget returns nil when no limit is configured. Reset times are
+// read in location; counters are loaded from and saved to path.
+func newDailyBudget(cfg config.DailyBudgetConfig, location *time.Location, path string) *dailyBudget {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if location == nil {
+		location = time.Local
+	}
+	b := &dailyBudget{
+		cfg:      cfg,
+		location: location,
+		path:     path,
+		now:      time.Now,
+		used:     make(map[string]*budgetUsage),
+	}
+	if t, err := time.Parse("15:04", cfg.ResetTime); err == nil {
+		b.resetHour, b.resetMin = t.Hour(), t.Minute()
+	}
+	if err := b.load(); err != nil {
+		logger.WarnCF("agent", "Failed to load daily budget counters",
+			map[string]any{"path": path, "error": err.Error()})
+	}
+	return b
+}
+
+// budgetLocation returns the time zone budgets reset in: the configured
+// one, or nil for local time.
+func budgetLocation(cfg *config.Config) *time.Location {
+	if tz := cfg.Agents.Defaults.Timezone; tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return nil
+}
+
+// load restores the counters saved by a previous run. Counters of an
+// earlier period are dropped on first use.
+func (b *dailyBudget) load() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state budgetState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.Used != nil {
+		b.period, b.used = state.Period, state.Used
+	}
+	return nil
+}
+
+// save writes the counters to b.path through a temp file, so a crash never
+// leaves a partial file. b.mu must be held.
+func (b *dailyBudget) save() {
+	if b.path == "" {
+		return
+	}
+	data, err := json.Marshal(budgetState{Period: b.period, Used: b.used})
+	if err == nil {
+		err = utils.WriteFileAtomic(b.path, data, 0o644)
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Failed to save daily budget counters",
+			map[string]any{"path": b.path, "error": err.Error()})
+	}
+}
+
+// key returns the counter a message is charged to.
+func (b *dailyBudget) key(msg bus.InboundMessage, sessionKey string) string {
+	if b.cfg.Scope == "session" || msg.SenderID == "" {
+		return "session:" + sessionKey
+	}
+	return "user:" + msg.Channel + ":" + msg.SenderID
+}
+
+// allow reports whether key may send another message and, if so, counts it.
+// It is checked before any provider call, so a turn that started under the
+// token limit may finish above it.
+func (b *dailyBudget) allow(key string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	u := b.usage(key)
+	if b.cfg.MaxMessages > 0 && u.Messages >= b.cfg.MaxMessages {
+		return false
+	}
+	if b.cfg.MaxTokens > 0 && u.Tokens >= b.cfg.MaxTokens {
+		return false
+	}
+	u.Messages++
+	b.save()
+	return true
+}
+
+// addTokens charges the tokens of an LLM call to key. Calls made by tools
+// and subagents reach it through tools.ReportUsage.
+func (b *dailyBudget) addTokens(key string, usage *providers.UsageInfo) {
+	if b == nil || key == "" || usage == nil {
+		return
+	}
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usage(key).Tokens += total
+	b.save()
+}
+
+// usage returns the counter of key in the current period, starting a new
+// period when the reset time has passed. b.mu must be held.
+func (b *dailyBudget) usage(key string) *budgetUsage {
+	if period := b.periodStart(b.now()); !period.Equal(b.period) {
+		b.period = period
+		b.used = make(map[string]*budgetUsage)
+	}
+	u, ok := b.used[key]
+	if !ok {
+		u = &budgetUsage{}
+		b.used[key] = u
+	}
+	return u
+}
+
+// periodStart returns the most recent reset time at or before now, in the
+// budget's time zone.
+func (b *dailyBudget) periodStart(now time.Time) time.Time {
+	now = now.In(b.location)
+	start := time.Date(now.Year(), now.Month(), now.Day(), b.resetHour, b.resetMin, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// limitMessage is the reply sent once the budget is used up.
+func (b *dailyBudget) limitMessage() string {
+	if b.cfg.Message != "" {
+		return b.cfg.Message
+	}
+	return fmt.Sprintf("You've reached your daily usage limit. It resets at %02d:%02d.", b.resetHour, b.resetMin)
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestDailyBudget_PersistsCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "daily_budget.json")
+	cfg := config.DailyBudgetConfig{MaxMessages: 2}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	b := newDailyBudget(cfg, time.UTC, path)
+	b.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if !b.allow("user:telegram:alice") {
+			t.Fatalf("message %d denied within the budget", i+1)
+		}
+	}
+
+	// A restart keeps the day's counters
+	restarted := newDailyBudget(cfg, time.UTC, path)
+	restarted.now = func() time.Time { return now }
+	if restarted.allow("user:telegram:alice") {
+		t.Error("restart reset the daily budget")
+	}
+
+	// Counters of an earlier day do not carry over
+	now = now.AddDate(0, 0, 1)
+	if !restarted.allow("user:telegram:alice") {
+		t.Error("budget was not reset on the next day")
+	}
+}
+
+func TestDailyBudget_ResetsInConfiguredTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	b := newDailyBudget(config.DailyBudgetConfig{MaxMessages: 1, ResetTime: "04:00"}, tokyo, "")
+
+	// 20:00 UTC is 05:00 the next day in Tokyo, after that day's reset
+	got := b.periodStart(time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC))
+	want := time.Date(2026, 3, 2, 4, 0, 0, 0, tokyo)
+	if !got.Equal(want) {
+		t.Errorf("period start = %v, want %v", got, want)
+	}
+}
+
+// usageReportingTool stands in for a subagent: it reports the tokens of an
+// LLM call made on behalf of the turn.
+type usageReportingTool struct {
+	name   string
+	tokens int
+}
+
+func (t *usageReportingTool) Name() string               { return t.name }
+func (t *usageReportingTool) Description() string        { return "reports LLM usage" }
+func (t *usageReportingTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (t *usageReportingTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	tools.ReportUsage(ctx, &providers.UsageInfo{TotalTokens: t.tokens})
+	return tools.SilentResult("ok")
+}
+
+func TestAgentLoop_DailyBudgetChargesToolCalls(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000, // keep summarization off
+				MaxToolIterations: 5,
+				DailyBudget:       config.DailyBudgetConfig{MaxTokens: 10000},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	agent := al.registry.GetDefaultAgent()
+	// The mock provider calls "nonexistent_tool" once per message
+	agent.Tools.Register(&usageReportingTool{name: "nonexistent_tool", tokens: 1000})
+
+	_, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel:  "telegram",
+		SenderID: "alice",
+		ChatID:   "chat-1",
+		Content:  "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+
+	al.budget.mu.Lock()
+	defer al.budget.mu.Unlock()
+	// Two LLM calls of 120 tokens by the agent, 1000 by the tool
+	if got := al.budget.usage("user:telegram:alice").Tokens; got != 1240 {
+		t.Errorf("charged %d tokens, want 1240", got)
+	}
+}
@@ -0,0 +1,27 @@
+package agent
+
+import "github.com/sipeed/picoclaw/pkg/logger"
+
+// CancelRequest aborts the requests in progress for a chat, one per session,
+// along with the subagents spawned from that chat. It reports whether
+// anything was cancelled.
+func (al *AgentLoop) CancelRequest(channel, chatID string) bool {
+	ok := al.requests.cancel(requestKey(channel, chatID))
+
+	subagents := 0
+	for _, agentID := range al.registry.ListAgentIDs() {
+		if agent, found := al.registry.GetAgent(agentID); found && agent.SubagentManager != nil {
+			subagents += agent.SubagentManager.CancelTasks(channel, chatID)
+		}
+	}
+
+	if ok || subagents > 0 {
+		logger.InfoCF("agent", "Request cancelled by user", map[string]any{
+			"channel":   channel,
+			"chat_id":   chatID,
+			"request":   ok,
+			"subagents": subagents,
+		})
+	}
+	return ok || subagents > 0
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// blockingProvider blocks its first call until the request is cancelled and
+// answers later calls right away.
+type blockingProvider struct {
+	started  chan struct{}
+	canceled chan error
+	calls    int
+}
+
+func (p *blockingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.calls > 1 {
+		return &providers.LLMResponse{Content: "next reply"}, nil
+	}
+	close(p.started)
+	<-ctx.Done()
+	p.canceled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (p *blockingProvider) GetDefaultModel() string {
+	return "blocking-model"
+}
+
+func TestAgentLoop_CancelRequest(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &blockingProvider{started: make(chan struct{}), canceled: make(chan error, 1)}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	if al.CancelRequest("telegram", "42") {
+		t.Error("CancelRequest reported a cancellation with nothing in progress")
+	}
+
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "u1", ChatID: "42", Content: "long task"})
+	select {
+	case <-provider.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not reach the provider")
+	}
+
+	if al.CancelRequest("telegram", "7") {
+		t.Error("CancelRequest cancelled the request of another chat")
+	}
+	if !al.CancelRequest("telegram", "42") {
+		t.Fatal("CancelRequest found no request in progress")
+	}
+	select {
+	case err := <-provider.canceled:
+		if err != context.Canceled {
+			t.Errorf("provider context error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context was not cancelled")
+	}
+
+	// The cancelled request sends no error; the next one is answered
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "u1", ChatID: "42", Content: "hello"})
+	outCtx, outCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer outCancel()
+	out, ok := msgBus.SubscribeOutbound(outCtx)
+	if !ok || out.Content != "next reply" {
+		t.Fatalf("outbound = %+v (ok=%v), want only the next reply", out, ok)
+	}
+
+	if al.CancelRequest("telegram", "42") {
+		t.Error("CancelRequest reported a cancellation after the request finished")
+	}
+}
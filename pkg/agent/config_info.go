@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// configInfo collects the non-secret settings reported by the config_info
+// tool. Only plain values are copied; keys, tokens and endpoints never are.
+func configInfo(cfg *config.Config, agent *AgentInstance) tools.ConfigInfo {
+	defaults := cfg.Agents.Defaults
+	info := tools.ConfigInfo{
+		AgentID:             agent.ID,
+		Model:               agent.Model,
+		Provider:            defaults.Provider,
+		Fallbacks:           append([]string(nil), agent.Fallbacks...),
+		MaxTokens:           agent.MaxTokens,
+		ContextWindow:       agent.ContextWindow,
+		MaxIterations:       agent.MaxIterations,
+		Temperature:         agent.Temperature,
+		RestrictToWorkspace: defaults.RestrictToWorkspace,
+		Timezone:            defaults.Timezone,
+		Channels:            enabledChannels(cfg.Channels),
+		WebSearch:           enabledWebSearch(cfg.Tools.Web),
+		DailyMessages:       defaults.DailyBudget.MaxMessages,
+		DailyTokens:         defaults.DailyBudget.MaxTokens,
+	}
+	if mc, err := cfg.GetModelConfig(agent.Model); err == nil {
+		info.ModelID = mc.Model
+	}
+
+	// Memory counts as enabled only if the store came up at startup
+	if _, ok := agent.Tools.Get("qdrant_search_memory"); ok {
+		info.MemoryEnabled = true
+		info.MemoryCollection = cfg.Storage.Qdrant.Collection
+		info.VectorSize = cfg.Storage.Qdrant.VectorSize
+		info.EmbeddingModel = cfg.Storage.Embedding.Model
+		for _, mc := range cfg.ModelList {
+			if mc.ModelName == "mistral-embed" {
+				info.EmbeddingModel = "mistral-embed"
+				break
+			}
+		}
+	}
+	return info
+}
+
+func enabledChannels(ch config.ChannelsConfig) []string {
+	var names []string
+	for _, c := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"whatsapp", ch.WhatsApp.Enabled},
+		{"telegram", ch.Telegram.Enabled},
+		{"feishu", ch.Feishu.Enabled},
+		{"discord", ch.Discord.Enabled},
+		{"maixcam", ch.MaixCam.Enabled},
+		{"qq", ch.QQ.Enabled},
+		{"dingtalk", ch.DingTalk.Enabled},
+		{"slack", ch.Slack.Enabled},
+		{"line", ch.LINE.Enabled},
+		{"onebot", ch.OneBot.Enabled},
+		{"wecom", ch.WeCom.Enabled},
+		{"wecom_app", ch.WeComApp.Enabled},
+	} {
+		if c.enabled {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func enabledWebSearch(web config.WebToolsConfig) []string {
+	var names []string
+	if web.Brave.Enabled {
+		names = append(names, "brave")
+	}
+	if web.Tavily.Enabled {
+		names = append(names, "tavily")
+	}
+	if web.DuckDuckGo.Enabled {
+		names = append(names, "duckduckgo")
+	}
+	if web.Perplexity.Enabled {
+		names = append(names, "perplexity")
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestConfigInfoTool_RedactsSecrets(t *testing.T) {
+	secrets := []string{"sk-model-secret", "tg-bot-secret", "brave-secret", "qdrant-secret", "embed-secret"}
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "smart",
+				MaxTokens:         4096,
+				ContextWindow:     128000,
+				MaxToolIterations: 7,
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "smart", Model: "openai/gpt-4o", APIKey: secrets[0], APIBase: "https://api.example.com/v1"},
+		},
+		Channels: config.ChannelsConfig{
+			Telegram: config.TelegramConfig{Enabled: true, Token: secrets[1]},
+		},
+		Tools: config.ToolsConfig{
+			Web: config.WebToolsConfig{
+				Brave: config.BraveConfig{Enabled: true, APIKey: secrets[2], MaxResults: 5},
+			},
+		},
+		Storage: config.StorageConfig{
+			Qdrant:    config.QdrantConfig{APIKey: secrets[3]},
+			Embedding: config.EmbeddingConfig{APIKey: secrets[4]},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	agent := al.registry.GetDefaultAgent()
+
+	tool, ok := agent.Tools.Get("config_info")
+	if !ok {
+		t.Fatal("config_info tool not registered")
+	}
+	result := tool.Execute(context.Background(), map[string]any{})
+	if result.IsError {
+		t.Fatalf("config_info failed: %s", result.ForLLM)
+	}
+
+	out := result.ForLLM
+	for _, secret := range secrets {
+		if strings.Contains(out, secret) {
+			t.Errorf("output contains secret %q:\n%s", secret, out)
+		}
+	}
+	if strings.Contains(out, "api.example.com") {
+		t.Errorf("output contains the API endpoint:\n%s", out)
+	}
+	for _, want := range []string{
+		"Model: smart (openai/gpt-4o)",
+		"Max tool iterations: 7",
+		"Channels: telegram",
+		"Web search: brave",
+		"Long-term memory: disabled",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// A model switch at runtime is reported
+	agent.Model = "other"
+	if out := tool.Execute(context.Background(), map[string]any{}).ForLLM; !strings.Contains(out, "Model: other\n") {
+		t.Errorf("switched model not reported:\n%s", out)
+	}
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// newConfirmationGate wraps the configured destructive tools of every agent
+// so they wait for the user's approval. With confirmation disabled only
+// tools.AlwaysConfirmedTools are gated.
+func newConfirmationGate(cfg *config.Config, msgBus *bus.MessageBus, registry *AgentRegistry) *tools.ConfirmationGate {
+	confirmCfg := cfg.Tools.Confirmation
+
+	gate := tools.NewConfirmationGate(
+		time.Duration(confirmCfg.TimeoutSeconds)*time.Second,
+		func(action *tools.PendingAction) {
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel:  action.Channel,
+				ChatID:   action.ChatID,
+				ThreadID: action.ThreadID,
+				Content:  formatConfirmationPrompt(action),
+				Buttons: []bus.OutboundButton{
+					{Text: "Approve", Data: "/approve " + action.ID},
+					{Text: "Deny", Data: "/deny " + action.ID},
+				},
+			})
+		},
+	)
+
+	var names []string
+	if confirmCfg.Enabled {
+		names = confirmCfg.Tools
+		if len(names) == 0 {
+			names = tools.DefaultConfirmationTools
+		}
+	}
+	for _, name := range tools.AlwaysConfirmedTools {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if tool, ok := agent.Tools.Get(name); ok {
+				agent.Tools.Register(gate.Wrap(tool))
+			}
+		}
+	}
+
+	if confirmCfg.Enabled {
+		logger.InfoCF("agent", "Tool confirmation enabled", map[string]any{"tools": names})
+	}
+	return gate
+}
+
+// formatConfirmationPrompt describes a pending action to the user.
+func formatConfirmationPrompt(action *tools.PendingAction) string {
+	argsJSON, _ := json.Marshal(action.Args)
+	return fmt.Sprintf("The agent wants to run %s:\n%s\n\nReply /approve %s to run it or /deny %s to cancel.",
+		action.ToolName, utils.Truncate(string(argsJSON), 500), action.ID, action.ID)
+}
+
+// handleConfirmation resolves "/approve <id>" and "/deny <id>". When the
+// action was found, the returned content replaces the user message so the
+// agent learns the outcome and can continue; otherwise reply is sent back
+// directly. handled is false for any other message.
+func (al *AgentLoop) handleConfirmation(ctx context.Context, msg bus.InboundMessage) (content, reply string, handled bool) {
+	parts := strings.Fields(msg.Content)
+	if len(parts) == 0 || (parts[0] != "/approve" && parts[0] != "/deny") {
+		return "", "", false
+	}
+	if len(parts) != 2 {
+		return "", fmt.Sprintf("Usage: %s <confirmation id>", parts[0]), true
+	}
+
+	approve := parts[0] == "/approve"
+	action, result, err := al.confirmations.Resolve(ctx, parts[1], msg.Channel, msg.ChatID, msg.SenderID, approve)
+	if errors.Is(err, tools.ErrConfirmationNotFound) {
+		return "", fmt.Sprintf("No pending action %s", parts[1]), true
+	}
+	if errors.Is(err, tools.ErrConfirmationForbidden) {
+		return "", fmt.Sprintf("Only the user who asked for %s can approve or deny it", parts[1]), true
+	}
+	if errors.Is(err, tools.ErrConfirmationExpired) {
+		return "", fmt.Sprintf("Pending action %s has expired; ask again if it is still needed", parts[1]), true
+	}
+
+	logger.InfoCF("agent", "Tool confirmation resolved", map[string]any{
+		"id":       action.ID,
+		"tool":     action.ToolName,
+		"approved": approve,
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+	})
+
+	if !approve {
+		return fmt.Sprintf("[Confirmation] The user denied %s (%s). It was not run; do not try it again unless asked.",
+			action.ToolName, action.ID), "", true
+	}
+	return fmt.Sprintf("[Confirmation] The user approved %s (%s). Result:\n%s",
+		action.ToolName, action.ID, result.ContentForLLM(action.ToolName)), "", true
+}
@@ -1,18 +1,23 @@
 package agent
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
@@ -22,6 +27,11 @@ type ContextBuilder struct {
 	workspace    string
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
+	skillsFilter []string         // skills listed in the prompt; empty lists all
+	location     *time.Location   // time zone of the current time; nil is local time
+	now          func() time.Time // clock for the current time, replaceable in tests
+
+	channelPrompts map[string]config.ChannelPromptConfig // per-channel prompt changes, by channel name
 
 	// Cache for system prompt to avoid rebuilding on every call.
 	// This fixes issue #607: repeated reprocessing of the entire context.
@@ -35,6 +45,11 @@ type ContextBuilder struct {
 	// created (didn't exist at cache time, now exist) or deleted (existed at
 	// cache time, now gone) — both of which should trigger a cache rebuild.
 	existedAtCache map[string]bool
+
+	// cachedKey is the promptCacheKey the cached prompt was built for, so
+	// changing the skills filter or building for a channel with its own
+	// prompt invalidates the cache.
+	cachedKey string
 }
 
 func getGlobalConfigDir() string {
@@ -59,6 +74,52 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 	}
 }
 
+// SetSkillsFilter limits the skills listed in the system prompt to names.
+// An empty list lists every skill.
+func (cb *ContextBuilder) SetSkillsFilter(names []string) {
+	cb.systemPromptMutex.Lock()
+	defer cb.systemPromptMutex.Unlock()
+	cb.skillsFilter = slices.Clone(names)
+}
+
+// SetChannelPrompts sets the prompt overrides and additions applied when
+// building the system prompt for a channel.
+func (cb *ContextBuilder) SetChannelPrompts(prompts map[string]config.ChannelPromptConfig) {
+	cb.systemPromptMutex.Lock()
+	defer cb.systemPromptMutex.Unlock()
+	cb.channelPrompts = maps.Clone(prompts)
+}
+
+// SetTimezone sets the time zone the current time is given in. Nil uses the
+// system time zone.
+func (cb *ContextBuilder) SetTimezone(loc *time.Location) {
+	cb.systemPromptMutex.Lock()
+	defer cb.systemPromptMutex.Unlock()
+	cb.location = loc
+}
+
+// currentTime describes the current time for the dynamic context, e.g.
+// "2026-03-01 14:05 (Sunday), Europe/Berlin (UTC+01:00)".
+func (cb *ContextBuilder) currentTime() string {
+	cb.systemPromptMutex.RLock()
+	loc, clock := cb.location, cb.now
+	cb.systemPromptMutex.RUnlock()
+
+	if clock == nil {
+		clock = time.Now
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	now := clock().In(loc)
+
+	zone := loc.String()
+	if loc == time.Local {
+		zone, _ = now.Zone()
+	}
+	return fmt.Sprintf("%s, %s (UTC%s)", now.Format("2006-01-02 15:04 (Monday)"), zone, now.Format("-07:00"))
+}
+
 func (cb *ContextBuilder) getIdentity() string {
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 
@@ -84,11 +145,21 @@ Your workspace is at: %s
 		workspacePath, workspacePath, workspacePath, workspacePath, workspacePath)
 }
 
+// BuildSystemPrompt builds the system prompt without channel-specific changes.
 func (cb *ContextBuilder) BuildSystemPrompt() string {
+	return cb.buildSystemPrompt("")
+}
+
+func (cb *ContextBuilder) buildSystemPrompt(channel string) string {
 	parts := []string{}
+	channelPrompt := cb.channelPrompts[channel]
 
-	// Core identity section
-	parts = append(parts, cb.getIdentity())
+	// Core identity section, unless the channel replaces it
+	if channelPrompt.Override != "" {
+		parts = append(parts, channelPrompt.Override)
+	} else {
+		parts = append(parts, cb.getIdentity())
+	}
 
 	// Bootstrap files
 	bootstrapContent := cb.LoadBootstrapFiles()
@@ -97,32 +168,49 @@ func (cb *ContextBuilder) BuildSystemPrompt() string {
 	}
 
 	// Skills - show summary, AI can read full content with read_file tool
-	skillsSummary := cb.skillsLoader.BuildSkillsSummary()
+	skillsSummary := cb.skillsLoader.BuildSkillsSummaryFor(cb.skillsFilter)
 	if skillsSummary != "" {
 		parts = append(parts, fmt.Sprintf(`# Skills
 
-The following skills extend your capabilities. To use a skill, read its SKILL.md file using the read_file tool.
+The following skills extend your capabilities. To use a skill, read the file at its location using the read_file tool.
 
 %s`, skillsSummary))
 	}
 
+	// Skills marked "always" are included in full
+	if activeSkills := cb.skillsLoader.BuildAlwaysSkillsFor(cb.skillsFilter); activeSkills != "" {
+		parts = append(parts, "# Active Skills\n\n"+activeSkills)
+	}
+
 	// Memory context
 	memoryContext := cb.memory.GetMemoryContext()
 	if memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
 
+	if channelPrompt.Append != "" {
+		parts = append(parts, "# Channel Instructions\n\n"+channelPrompt.Append)
+	}
+
 	// Join with "---" separator
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
 // BuildSystemPromptWithCache returns the cached system prompt if available
-// and source files haven't changed, otherwise builds and caches it.
-// Source file changes are detected via mtime checks (cheap stat calls).
+// and neither source files nor the skills filter have changed, otherwise
+// builds and caches it. Source file changes are detected via mtime checks
+// (cheap stat calls); skills filter changes via promptCacheKey.
 func (cb *ContextBuilder) BuildSystemPromptWithCache() string {
+	return cb.SystemPromptForChannel("")
+}
+
+// SystemPromptForChannel is BuildSystemPromptWithCache with the prompt
+// changes configured for channel applied.
+func (cb *ContextBuilder) SystemPromptForChannel(channel string) string {
 	// Try read lock first — fast path when cache is valid
 	cb.systemPromptMutex.RLock()
-	if cb.cachedSystemPrompt != "" && !cb.sourceFilesChangedLocked() {
+	key := cb.promptCacheKey(channel)
+	if cb.cachedSystemPrompt != "" && cb.cachedKey == key && !cb.sourceFilesChangedLocked() {
 		result := cb.cachedSystemPrompt
 		cb.systemPromptMutex.RUnlock()
 		return result
@@ -134,7 +222,8 @@ func (cb *ContextBuilder) BuildSystemPromptWithCache() string {
 	defer cb.systemPromptMutex.Unlock()
 
 	// Double-check: another goroutine may have rebuilt while we waited
-	if cb.cachedSystemPrompt != "" && !cb.sourceFilesChangedLocked() {
+	key = cb.promptCacheKey(channel)
+	if cb.cachedSystemPrompt != "" && cb.cachedKey == key && !cb.sourceFilesChangedLocked() {
 		return cb.cachedSystemPrompt
 	}
 
@@ -145,10 +234,11 @@ func (cb *ContextBuilder) BuildSystemPromptWithCache() string {
 	// rebuild. The alternative (baseline after build) risks caching stale
 	// content with a too-new baseline, making the staleness invisible.
 	baseline := cb.buildCacheBaseline()
-	prompt := cb.BuildSystemPrompt()
+	prompt := cb.buildSystemPrompt(channel)
 	cb.cachedSystemPrompt = prompt
 	cb.cachedAt = baseline.maxMtime
 	cb.existedAtCache = baseline.existed
+	cb.cachedKey = key
 
 	logger.DebugCF("agent", "System prompt cached",
 		map[string]any{
@@ -168,10 +258,32 @@ func (cb *ContextBuilder) InvalidateCache() {
 	cb.cachedSystemPrompt = ""
 	cb.cachedAt = time.Time{}
 	cb.existedAtCache = nil
+	cb.cachedKey = ""
 
 	logger.DebugCF("agent", "System prompt cache invalidated", nil)
 }
 
+// promptCacheKey hashes the prompt inputs that are held in memory rather than
+// read from files: the skills filter and the prompt of channel. Channels without a prompt of their own share a key. Caller must
+// hold systemPromptMutex (read or write).
+func (cb *ContextBuilder) promptCacheKey(channel string) string {
+	h := sha256.New()
+	filter := slices.Clone(cb.skillsFilter)
+	slices.Sort(filter)
+	for _, name := range filter {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	if p, ok := cb.channelPrompts[channel]; ok {
+		h.Write([]byte{2})
+		for _, part := range []string{channel, p.Override, p.Append} {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // sourcePaths returns the workspace source file paths tracked for cache
 // invalidation (bootstrap files + memory). The skills directory is handled
 // separately in sourceFilesChangedLocked because it requires both directory-
@@ -364,7 +476,7 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 // See: https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching
 // See: https://platform.openai.com/docs/guides/prompt-caching
 func (cb *ContextBuilder) buildDynamicContext(channel, chatID string) string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
+	now := cb.currentTime()
 	rt := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
 	var sb strings.Builder
@@ -380,6 +492,7 @@ func (cb *ContextBuilder) buildDynamicContext(channel, chatID string) string {
 func (cb *ContextBuilder) BuildMessages(
 	history []providers.Message,
 	summary string,
+	pinned []string,
 	currentMessage string,
 	media []string,
 	channel, chatID string,
@@ -395,7 +508,7 @@ func (cb *ContextBuilder) BuildMessages(
 	//   contiguous system block makes this extraction straightforward.
 	// - Codex maps only the first system message to its instructions field.
 	// - OpenAI-compat passes messages through as-is.
-	staticPrompt := cb.BuildSystemPromptWithCache()
+	staticPrompt := cb.SystemPromptForChannel(channel)
 
 	// Build short dynamic context (time, runtime, session) — changes per request
 	dynamicCtx := cb.buildDynamicContext(channel, chatID)
@@ -425,6 +538,13 @@ func (cb *ContextBuilder) BuildMessages(
 		contentBlocks = append(contentBlocks, providers.ContentBlock{Type: "text", Text: summaryText})
 	}
 
+	if len(pinned) > 0 {
+		pinnedText := "PINNED: The user asked you to keep the following in mind for the rest of this conversation:\n\n- " +
+			strings.Join(pinned, "\n- ")
+		stringParts = append(stringParts, pinnedText)
+		contentBlocks = append(contentBlocks, providers.ContentBlock{Type: "text", Text: pinnedText})
+	}
+
 	fullSystemPrompt := strings.Join(stringParts, "\n\n---\n\n")
 
 	// Log system prompt summary for debugging (debug mode only).
@@ -440,6 +560,7 @@ func (cb *ContextBuilder) BuildMessages(
 			"dynamic_chars": len(dynamicCtx),
 			"total_chars":   len(fullSystemPrompt),
 			"has_summary":   summary != "",
+			"pinned":        len(pinned),
 			"cached":        isCached,
 		})
 
@@ -549,6 +670,33 @@ func loadImageAsContent(filePath string) *providers.ImageContent {
 	}
 }
 
+// attachAudio adds the audio files at paths to a user message, for models
+// that accept audio input. Files that cannot be read are skipped.
+func attachAudio(msg *providers.Message, paths []string) {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.WarnCF("agent", "Failed to read audio file", map[string]any{"path": path, "error": err.Error()})
+			continue
+		}
+
+		mimeType := http.DetectContentType(data)
+		if mimeType == "application/ogg" {
+			mimeType = "audio/ogg"
+		}
+		if !strings.HasPrefix(mimeType, "audio/") {
+			logger.DebugCF("agent", "Skipping non-audio file", map[string]any{"path": path, "type": mimeType})
+			continue
+		}
+
+		msg.MultiContent = append(msg.MultiContent, providers.ImageContent{
+			Type:       "audio",
+			Base64Data: base64.StdEncoding.EncodeToString(data),
+			MIMEType:   mimeType,
+		})
+	}
+}
+
 func sanitizeHistoryForProvider(history []providers.Message) []providers.Message {
 	if len(history) == 0 {
 		return history
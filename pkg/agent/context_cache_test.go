@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
@@ -47,6 +48,7 @@ func TestSingleSystemMessage(t *testing.T) {
 		name    string
 		history []providers.Message
 		summary string
+		pinned  []string
 		message string
 	}{
 		{
@@ -78,11 +80,17 @@ func TestSingleSystemMessage(t *testing.T) {
 			summary: "",
 			message: "new message",
 		},
+		{
+			name:    "pinned entries",
+			summary: "Previous conversation discussed X",
+			pinned:  []string{"My address is 1 Main St"},
+			message: "where do I live?",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msgs := cb.BuildMessages(tt.history, tt.summary, tt.message, nil, "test", "chat1")
+			msgs := cb.BuildMessages(tt.history, tt.summary, tt.pinned, tt.message, nil, "test", "chat1")
 
 			systemCount := 0
 			for _, m := range msgs {
@@ -122,6 +130,13 @@ func TestSingleSystemMessage(t *testing.T) {
 					t.Error("CONTEXT_SUMMARY should not appear without summary")
 				}
 			}
+
+			// Pinned entries are part of the system message
+			for _, p := range tt.pinned {
+				if !strings.Contains(sys, "PINNED:") || !strings.Contains(sys, p) {
+					t.Errorf("pinned entry %q not found in system message", p)
+				}
+			}
 		})
 	}
 }
@@ -268,6 +283,41 @@ func TestCacheStability(t *testing.T) {
 	}
 }
 
+// TestCurrentTimeNotCached verifies that the current time is rendered in the
+// configured time zone on every request, even while the static prompt is
+// served from the cache.
+func TestCurrentTimeNotCached(t *testing.T) {
+	tmpDir := setupWorkspace(t, map[string]string{
+		"IDENTITY.md": "# Identity\nContent",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	loc := time.FixedZone("Test/Zone", 2*60*60)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cb := NewContextBuilder(tmpDir)
+	cb.SetTimezone(loc)
+	cb.now = func() time.Time { return now }
+
+	systemPrompt := func() string {
+		msgs := cb.BuildMessages(nil, "", nil, "hello", nil, "test", "chat1")
+		return msgs[0].Content
+	}
+
+	first := systemPrompt()
+	if want := "2026-03-01 14:00 (Sunday), Test/Zone (UTC+02:00)"; !strings.Contains(first, want) {
+		t.Fatalf("system prompt missing current time %q:\n%s", want, first)
+	}
+
+	now = now.Add(26 * time.Hour)
+	second := systemPrompt()
+	if want := "2026-03-02 16:00 (Monday)"; !strings.Contains(second, want) {
+		t.Errorf("current time was not refreshed, want %q:\n%s", want, second)
+	}
+	if strings.Contains(second, "2026-03-01 14:00") {
+		t.Error("system prompt still contains the stale time")
+	}
+}
+
 // TestNewFileCreationInvalidatesCache verifies that creating a source file that
 // did not exist when the cache was built triggers a cache rebuild.
 // This catches the "from nothing to something" edge case that the old
@@ -420,7 +470,7 @@ func TestConcurrentBuildSystemPromptWithCache(t *testing.T) {
 				}
 
 				// Also exercise BuildMessages concurrently
-				msgs := cb.BuildMessages(nil, "", "hello", nil, "test", "chat")
+				msgs := cb.BuildMessages(nil, "", nil, "hello", nil, "test", "chat")
 				if len(msgs) < 2 {
 					errs <- "BuildMessages returned fewer than 2 messages"
 					return
@@ -508,6 +558,98 @@ func BenchmarkBuildMessagesWithCache(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = cb.BuildMessages(history, "summary", "new message", nil, "cli", "test")
+		_ = cb.BuildMessages(history, "summary", nil, "new message", nil, "cli", "test")
+	}
+}
+
+// TestSkillsFilterChangeInvalidatesCache verifies that the skills filter is
+// part of the cache key and is applied to the skills summary: an unchanged
+// filter reuses the cached prompt, while a new one rebuilds it.
+func TestSkillsFilterChangeInvalidatesCache(t *testing.T) {
+	tmpDir := setupWorkspace(t, map[string]string{
+		"skills/alpha/SKILL.md": "---\nname: alpha\ndescription: Alpha skill\n---\n# Alpha",
+		"skills/beta/SKILL.md":  "---\nname: beta\ndescription: Beta skill\n---\n# Beta",
+	})
+	defer os.RemoveAll(tmpDir)
+
+	cb := NewContextBuilder(tmpDir)
+	sp1 := cb.BuildSystemPromptWithCache()
+	if !strings.Contains(sp1, "<name>alpha</name>") || !strings.Contains(sp1, "<name>beta</name>") {
+		t.Fatalf("unfiltered prompt should list both skills, got:\n%s", sp1)
+	}
+
+	// Mark the cached entry so a cache hit is observable
+	cb.systemPromptMutex.Lock()
+	cb.cachedSystemPrompt = "cached"
+	cb.systemPromptMutex.Unlock()
+
+	if got := cb.BuildSystemPromptWithCache(); got != "cached" {
+		t.Error("unchanged skills filter should hit the cache")
+	}
+
+	cb.SetSkillsFilter([]string{"beta"})
+	sp2 := cb.BuildSystemPromptWithCache()
+	if strings.Contains(sp2, "<name>alpha</name>") || !strings.Contains(sp2, "<name>beta</name>") {
+		t.Errorf("filtered prompt should list only beta, got:\n%s", sp2)
+	}
+}
+
+// TestAlwaysSkillsInPrompt verifies that skills marked "always" are included
+// in full, subject to the skills filter.
+func TestAlwaysSkillsInPrompt(t *testing.T) {
+	tmpDir := setupWorkspace(t, map[string]string{
+		"skills/style/SKILL.md":    "---\nname: style\ndescription: House style\nalways: true\n---\nWrite short sentences.",
+		"skills/safety/skill.json": `{"name": "safety", "description": "Safety rules", "always": true, "instructions": "Never push to main."}`,
+	})
+	defer os.RemoveAll(tmpDir)
+
+	cb := NewContextBuilder(tmpDir)
+	cb.SetSkillsFilter([]string{"safety"})
+
+	sp := cb.BuildSystemPromptWithCache()
+	if !strings.Contains(sp, "# Active Skills") || !strings.Contains(sp, "Never push to main.") {
+		t.Errorf("prompt should include the always-on safety skill, got:\n%s", sp)
+	}
+	if strings.Contains(sp, "Write short sentences.") {
+		t.Error("skills outside the filter should not be included")
+	}
+}
+
+// TestChannelPrompts verifies that a channel's prompt changes apply only to
+// requests from that channel and that the cache tells channels apart.
+func TestChannelPrompts(t *testing.T) {
+	tmpDir := setupWorkspace(t, nil)
+	defer os.RemoveAll(tmpDir)
+
+	cb := NewContextBuilder(tmpDir)
+	cb.SetChannelPrompts(map[string]config.ChannelPromptConfig{
+		"telegram": {Append: "Keep replies under three sentences."},
+		"slack":    {Override: "You are the team's release assistant."},
+	})
+
+	systemFor := func(channel string) string {
+		return cb.BuildMessages(nil, "", nil, "hi", nil, channel, "chat1")[0].Content
+	}
+
+	telegram := systemFor("telegram")
+	if !strings.Contains(telegram, "# Channel Instructions\n\nKeep replies under three sentences.") {
+		t.Errorf("telegram prompt should include its addition, got:\n%s", telegram)
+	}
+	if !strings.Contains(telegram, "You are picoclaw") {
+		t.Error("an addition should keep the built-in identity")
+	}
+
+	cli := systemFor("cli")
+	if strings.Contains(cli, "Keep replies under three sentences.") {
+		t.Error("the telegram addition should not leak into the cached prompt of other channels")
+	}
+
+	slack := systemFor("slack")
+	if !strings.Contains(slack, "You are the team's release assistant.") || strings.Contains(slack, "You are picoclaw") {
+		t.Errorf("slack prompt should replace the identity, got:\n%s", slack)
+	}
+
+	if again := systemFor("telegram"); !strings.Contains(again, "Keep replies under three sentences.") {
+		t.Error("switching back to telegram should rebuild its prompt")
 	}
 }
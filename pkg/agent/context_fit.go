@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fitContextWindow drops the oldest messages of a request until its estimated
+// size leaves room for maxTokens of output in contextWindow. The system prompt
+// and the current turn, from the last user message on, are always kept, so a
+// request that is too large even without history is returned as it is and
+// left to the provider's context error handling. Tool results whose call was
+// dropped are dropped with it. It returns the messages to send and how many
+// were dropped; the session history itself is not changed.
+func (al *AgentLoop) fitContextWindow(
+	messages []providers.Message,
+	contextWindow, maxTokens int,
+) ([]providers.Message, int) {
+	if contextWindow <= 0 || len(messages) == 0 {
+		return messages, 0
+	}
+	limit := contextWindow - maxTokens
+	if limit <= 0 {
+		limit = contextWindow
+	}
+
+	tokens := al.estimateTokens(messages)
+	if tokens <= limit {
+		return messages, 0
+	}
+
+	// Droppable history lies between the system prompt and the current turn
+	start := 0
+	if messages[0].Role == "system" {
+		start = 1
+	}
+	end := len(messages) - 1
+	for i := len(messages) - 1; i >= start; i-- {
+		if messages[i].Role == "user" {
+			end = i
+			break
+		}
+	}
+
+	drop := start
+	for drop < end && tokens > limit {
+		tokens -= al.estimateTokens(messages[drop : drop+1])
+		drop++
+	}
+	// Tool results must follow the assistant message that called them
+	for drop < end && messages[drop].Role == "tool" {
+		tokens -= al.estimateTokens(messages[drop : drop+1])
+		drop++
+	}
+	if drop == start {
+		return messages, 0
+	}
+
+	fitted := make([]providers.Message, 0, len(messages)-(drop-start))
+	fitted = append(fitted, messages[:start]...)
+	fitted = append(fitted, messages[drop:]...)
+	logger.WarnCF("agent", "Dropped oldest messages to fit the context window", map[string]any{
+		"dropped":          drop - start,
+		"estimated_tokens": tokens,
+		"limit":            limit,
+	})
+	return fitted, drop - start
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestFitContextWindow(t *testing.T) {
+	al := &AgentLoop{}
+	long := strings.Repeat("x", 1000) // 400 tokens
+
+	messages := []providers.Message{
+		{Role: "system", Content: "system prompt"},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long, ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "read_file"}}},
+		{Role: "tool", Content: "file contents", ToolCallID: "call_1"},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "current question"},
+	}
+
+	t.Run("fits already", func(t *testing.T) {
+		got, dropped := al.fitContextWindow(messages, 10000, 1000)
+		if dropped != 0 || len(got) != len(messages) {
+			t.Errorf("dropped %d of a request that fits", dropped)
+		}
+	})
+
+	t.Run("drops oldest", func(t *testing.T) {
+		got, dropped := al.fitContextWindow(messages, 1500, 500)
+		if tokens := al.estimateTokens(got); tokens > 1000 {
+			t.Errorf("fitted request has ~%d tokens, want at most 1000", tokens)
+		}
+		if got[0].Role != "system" || got[len(got)-1].Content != "current question" {
+			t.Errorf("system prompt or current turn dropped: %+v", got)
+		}
+		if dropped != len(messages)-len(got) {
+			t.Errorf("dropped = %d, but %d messages are missing", dropped, len(messages)-len(got))
+		}
+		if got[1].Role == "tool" {
+			t.Error("kept a tool result without its call")
+		}
+	})
+
+	t.Run("tool results go with their call", func(t *testing.T) {
+		// Dropping the first user message and the tool call is enough, but
+		// would leave the tool result first
+		got, dropped := al.fitContextWindow(messages, 1300, 0)
+		if dropped != 3 {
+			t.Errorf("dropped = %d, want the tool result dropped with its call", dropped)
+		}
+		if got[1].Role == "tool" {
+			t.Errorf("kept a tool result without its call: %+v", got[1])
+		}
+	})
+
+	t.Run("current turn is kept even if too large", func(t *testing.T) {
+		huge := []providers.Message{
+			{Role: "system", Content: "system prompt"},
+			{Role: "user", Content: strings.Repeat("y", 10000)},
+		}
+		got, dropped := al.fitContextWindow(huge, 1000, 100)
+		if dropped != 0 || len(got) != 2 {
+			t.Errorf("fitContextWindow() dropped %d, kept %d messages", dropped, len(got))
+		}
+	})
+}
+
+// capturingProvider records the messages of the first request.
+type capturingProvider struct {
+	mu    sync.Mutex
+	first []providers.Message
+}
+
+func (p *capturingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.first == nil {
+		p.first = append([]providers.Message(nil), messages...)
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *capturingProvider) GetDefaultModel() string {
+	return "capturing-model"
+}
+
+func TestAgentLoop_TrimsHistoryToContextWindow(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1000,
+				ContextWindow:     16000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	provider := &capturingProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	agent := al.registry.GetDefaultAgent()
+
+	// About 40000 tokens of history
+	sessionKey := "agent:main:overflow"
+	var history []providers.Message
+	for i := 0; i < 50; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history = append(history, providers.Message{Role: role, Content: strings.Repeat("h", 2000)})
+	}
+	agent.Sessions.GetOrCreate(sessionKey)
+	agent.Sessions.SetHistory(sessionKey, history)
+
+	if _, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:  sessionKey,
+		Channel:     "cli",
+		ChatID:      "direct",
+		UserMessage: "what now?",
+	}); err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+
+	provider.mu.Lock()
+	sent := provider.first
+	provider.mu.Unlock()
+	if tokens := al.estimateTokens(sent); tokens > 15000 {
+		t.Errorf("request has ~%d tokens, want it to fit 16000 - 1000", tokens)
+	}
+	if len(sent) >= len(history)+2 {
+		t.Errorf("request has %d messages, want old history dropped", len(sent))
+	}
+	if sent[0].Role != "system" || sent[len(sent)-1].Content != "what now?" {
+		t.Error("system prompt or user message missing from the request")
+	}
+}
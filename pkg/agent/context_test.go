@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -207,3 +209,26 @@ func assertRoles(t *testing.T, msgs []providers.Message, expected ...string) {
 		}
 	}
 }
+
+func TestAttachAudio(t *testing.T) {
+	dir := t.TempDir()
+	voice := filepath.Join(dir, "voice.ogg")
+	if err := os.WriteFile(voice, []byte("OggS\x00\x02voice-data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("plain text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := msg("user", "listen")
+	attachAudio(&m, []string{voice, notes, filepath.Join(dir, "missing.ogg")})
+
+	if len(m.MultiContent) != 1 {
+		t.Fatalf("got %d parts, want 1: %+v", len(m.MultiContent), m.MultiContent)
+	}
+	part := m.MultiContent[0]
+	if part.Type != "audio" || part.MIMEType != "audio/ogg" || part.Base64Data == "" {
+		t.Errorf("unexpected audio part: %+v", part)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/moderation"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
@@ -14,25 +17,36 @@ import (
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
+// defaultMaxIterationsMessage is used when agents.defaults.max_iterations_message is not set.
+const defaultMaxIterationsMessage = "I hit my step limit; here's what I have so far."
+
 // AgentInstance represents a fully configured agent with its own workspace,
 // session manager, context builder, and tool registry.
 type AgentInstance struct {
-	ID             string
-	Name           string
-	Model          string
-	Fallbacks      []string
-	Workspace      string
-	MaxIterations  int
-	MaxTokens      int
-	Temperature    float64
-	ContextWindow  int
-	Provider       providers.LLMProvider
-	Sessions       *session.SessionManager
-	ContextBuilder *ContextBuilder
-	Tools          *tools.ToolRegistry
-	Subagents      *config.SubagentsConfig
-	SkillsFilter   []string
-	Candidates     []providers.FallbackCandidate
+	ID                   string
+	Name                 string
+	Model                string
+	Fallbacks            []string
+	Workspace            string
+	MaxIterations        int
+	MaxIterationsMessage string
+	MaxContinuations     int
+	TrimImpersonation    bool // cut made-up user turns from replies
+	EmptyResponseMessage string
+	SuppressEmptyReply   bool
+	MaxTokens            int
+	Temperature          float64
+	ToolTemperature      *float64
+	ContextWindow        int
+	Provider             providers.LLMProvider
+	Sessions             *session.SessionManager
+	ContextBuilder       *ContextBuilder
+	Tools                *tools.ToolRegistry
+	Subagents            *config.SubagentsConfig
+	SubagentModel        string
+	SubagentManager      *tools.SubagentManager // set when shared tools are registered
+	SkillsFilter         []string
+	Candidates           []providers.FallbackCandidate
 }
 
 // NewAgentInstance creates an agent instance from config.
@@ -50,20 +64,46 @@ func NewAgentInstance(
 
 	restrict := defaults.RestrictToWorkspace
 	toolsRegistry := tools.NewToolRegistry()
+	if agentCfg != nil && agentCfg.ChatOnly {
+		// Anything registered later, shared tools included, is dropped too
+		toolsRegistry.Restrict(agentCfg.ChatTools)
+	}
 	toolsRegistry.Register(tools.NewReadFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewWriteFileTool(workspace, restrict))
+	toolsRegistry.Register(tools.NewWriteFilesTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewListDirTool(workspace, restrict))
+	toolsRegistry.Register(tools.NewFindFilesTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewExecToolWithConfig(workspace, restrict, cfg))
 	toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict))
+	toolsRegistry.Register(tools.NewApplyPatchTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict))
 
 	sessionsDir := filepath.Join(workspace, "sessions")
 	sessionsManager := session.NewSessionManagerWithConfig(sessionsDir, cfg.Storage)
+	sessionsManager.SetCompactJSON(cfg.Session.CompactJSON)
+	sessionsManager.SetCompress(cfg.Session.Compress)
+	sessionsManager.SetSaveEvery(cfg.Session.SaveEvery)
+	if filter, err := moderation.New(cfg.Moderation); err != nil {
+		logger.WarnCF("agent", "Moderation disabled for stored messages", map[string]any{"error": err.Error()})
+	} else {
+		sessionsManager.SetModeration(filter)
+	}
 
 	// Note: sessionTool registration is deferred until after contextWindow is calculated
 	// It needs the contextWindow value for percentage calculation
 
 	contextBuilder := NewContextBuilder(workspace)
+	contextBuilder.SetChannelPrompts(defaults.ChannelPrompts)
+	if defaults.Timezone != "" {
+		if loc, err := time.LoadLocation(defaults.Timezone); err == nil {
+			contextBuilder.SetTimezone(loc)
+		} else {
+			logger.WarnCF("agent", "Unknown timezone, using system time", map[string]any{
+				"timezone": defaults.Timezone,
+				"error":    err.Error(),
+			})
+		}
+	}
 
 	agentID := routing.DefaultAgentID
 	agentName := ""
@@ -76,12 +116,18 @@ func NewAgentInstance(
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
 	}
+	contextBuilder.SetSkillsFilter(skillsFilter)
 
 	maxIter := defaults.MaxToolIterations
 	if maxIter == 0 {
 		maxIter = 20
 	}
 
+	maxIterMessage := defaults.MaxIterationsMessage
+	if maxIterMessage == "" {
+		maxIterMessage = defaultMaxIterationsMessage
+	}
+
 	maxTokens := defaults.MaxTokens
 	if maxTokens == 0 {
 		maxTokens = 8192
@@ -104,6 +150,9 @@ func NewAgentInstance(
 	sessionTool.SetContextWindow(contextWindow)
 	toolsRegistry.Register(sessionTool)
 
+	// On-demand session summaries, separate from automatic compaction
+	toolsRegistry.Register(tools.NewSummarizeSessionTool(provider, model, sessionsManager))
+
 	// Register Qdrant search tool if storage is enabled
 	if cfg.Storage.Qdrant.Enabled {
 		// Find Mistral API key from model_list for embeddings
@@ -137,7 +186,12 @@ func NewAgentInstance(
 			}
 			qdrantTool := tools.NewQdrantSearchTool(messageStore)
 			qdrantTool.SetSessionKey("") // Will be set per-request
+			if turns := cfg.Storage.Qdrant.QueryExpansionTurns; turns > 0 {
+				qdrantTool.SetQueryExpansion(sessionsManager, turns, cfg.Storage.Qdrant.QueryExpansionMaxChars)
+			}
 			toolsRegistry.Register(qdrantTool)
+			toolsRegistry.Register(tools.NewMemoryStatsTool(messageStore, cfg.Storage.Qdrant.VectorSize))
+			toolsRegistry.Register(tools.NewImportHistoryTool(sessionsManager))
 		}
 	}
 
@@ -149,23 +203,55 @@ func NewAgentInstance(
 	candidates := providers.ResolveCandidates(modelCfg, defaults.Provider)
 
 	return &AgentInstance{
-		ID:             agentID,
-		Name:           agentName,
-		Model:          model,
-		Fallbacks:      fallbacks,
-		Workspace:      workspace,
-		MaxIterations:  maxIter,
-		MaxTokens:      maxTokens,
-		Temperature:    temperature,
-		ContextWindow:  contextWindow,
-		Provider:       provider,
-		Sessions:       sessionsManager,
-		ContextBuilder: contextBuilder,
-		Tools:          toolsRegistry,
-		Subagents:      subagents,
-		SkillsFilter:   skillsFilter,
-		Candidates:     candidates,
+		ID:                   agentID,
+		Name:                 agentName,
+		Model:                model,
+		Fallbacks:            fallbacks,
+		Workspace:            workspace,
+		MaxIterations:        maxIter,
+		MaxIterationsMessage: maxIterMessage,
+		MaxContinuations:     defaults.MaxContinuations,
+		TrimImpersonation:    defaults.TrimImpersonatedTurns,
+		EmptyResponseMessage: defaults.EmptyResponseMessage,
+		SuppressEmptyReply:   defaults.SuppressEmptyResponse,
+		MaxTokens:            maxTokens,
+		Temperature:          temperature,
+		ToolTemperature:      defaults.ToolTemperature,
+		ContextWindow:        contextWindow,
+		Provider:             provider,
+		Sessions:             sessionsManager,
+		ContextBuilder:       contextBuilder,
+		Tools:                toolsRegistry,
+		Subagents:            subagents,
+		SubagentModel:        resolveSubagentModel(subagents, defaults),
+		SkillsFilter:         skillsFilter,
+		Candidates:           candidates,
+	}
+}
+
+// resolveSubagentModel returns the default model for subagents spawned by the
+// agent: its own subagents.model takes priority over agents.defaults.subagent_model.
+func resolveSubagentModel(subagents *config.SubagentsConfig, defaults *config.AgentDefaults) string {
+	if subagents != nil && subagents.Model != nil && strings.TrimSpace(subagents.Model.Primary) != "" {
+		return strings.TrimSpace(subagents.Model.Primary)
+	}
+	return strings.TrimSpace(defaults.SubagentModel)
+}
+
+// resolveStopSequences returns the stop sequences configured in model_list
+// for model, as named in agent config or, with provider set, as a fallback
+// candidate whose provider prefix was split off.
+func resolveStopSequences(cfg *config.Config, provider, model string) []string {
+	if cfg == nil {
+		return nil
+	}
+	for _, modelCfg := range cfg.ModelList {
+		if modelCfg.ModelName == model || modelCfg.Model == model ||
+			provider != "" && modelCfg.Model == provider+"/"+model {
+			return modelCfg.StopSequences
+		}
 	}
+	return nil
 }
 
 // resolveAgentWorkspace determines the workspace directory for an agent.
@@ -2,9 +2,12 @@ package agent
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
 func TestNewAgentInstance_UsesDefaultsTemperatureAndMaxTokens(t *testing.T) {
@@ -93,3 +96,43 @@ func TestNewAgentInstance_DefaultsTemperatureWhenUnset(t *testing.T) {
 		t.Fatalf("Temperature = %f, want %f", agent.Temperature, 0.7)
 	}
 }
+
+func TestNewAgentLoop_ChatOnlyAgent(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace: dir,
+				Model:     "test-model",
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true},
+				{ID: "persona", Workspace: dir + "/persona", ChatOnly: true, ChatTools: []string{"message"}},
+				{ID: "silent", Workspace: dir + "/silent", ChatOnly: true},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	main, _ := al.registry.GetAgent("main")
+	if _, ok := main.Tools.Get("exec"); !ok {
+		t.Fatal("regular agent is missing the exec tool")
+	}
+
+	persona, _ := al.registry.GetAgent("persona")
+	if got := persona.Tools.List(); !reflect.DeepEqual(got, []string{"message"}) {
+		t.Errorf("chat-only agent tools = %v, want [message]", got)
+	}
+
+	// Tools registered after start-up are dropped as well
+	al.RegisterTool(tools.NewReadFileTool(dir, true))
+	silent, _ := al.registry.GetAgent("silent")
+	if n := silent.Tools.Count(); n != 0 {
+		t.Errorf("chat-only agent without chat_tools has %d tools: %v", n, silent.Tools.List())
+	}
+	for _, name := range []string{"read_file", "write_file", "edit_file", "append_file", "list_dir", "exec"} {
+		if _, ok := persona.Tools.Get(name); ok {
+			t.Errorf("chat-only agent has the %s tool", name)
+		}
+	}
+}
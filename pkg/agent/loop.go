@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -21,6 +22,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
@@ -44,6 +46,12 @@ type AgentLoop struct {
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
 	channelManager *channels.Manager
+	confirmations  *tools.ConfirmationGate
+	audit          *tools.AuditLog // nil unless tools.audit is enabled
+	usage          *providers.UsageTracker
+	budget         *dailyBudget
+	started        time.Time
+	requests       *requestRegistry // request in progress per session, for /cancel
 }
 
 // processOptions configures how a message is processed
@@ -52,9 +60,11 @@ type processOptions struct {
 	Channel                    string   // Target channel for tool execution
 	ChatID                     string   // Target chat ID for tool execution
 	ThreadID                   string   // Target thread ID (for Telegram topics)
+	SenderID                   string   // Sender of the message; tool approvals are bound to it
 	UserMessage                string   // User message content (may include prefix)
 	Media                      []string // Media file paths (images for vision)
 	Files                      []string // File paths (for read_file tool)
+	Audio                      []string // Audio file paths (for models with audio input)
 	DefaultResponse            string   // Response when LLM returns empty
 	EnableSummary              bool     // Whether to trigger summarization
 	SendResponse               bool     // Whether to send response via bus
@@ -63,13 +73,35 @@ type processOptions struct {
 	IsSubagentResult           bool     // If true, this is a subagent result (save as "tool" role, not "user")
 	MessageRole                string   // Role to use when saving message to session (default: "user")
 	SuppressIntermediateOutput bool     // If true, don't send intermediate tool results (for cron deliver=false)
+	BudgetKey                  string   // Daily budget counter charged for LLM tokens (empty = not budgeted)
 }
 
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
 	registry := NewAgentRegistry(cfg, provider)
 
+	// Record tool executions, if configured
+	audit := newAuditLog(cfg, registry)
+
 	// Register shared tools to all agents
-	registerSharedTools(cfg, msgBus, registry, provider)
+	registerSharedTools(cfg, msgBus, registry, provider, audit)
+
+	// Account token usage per session and agent (before tools get wrapped)
+	usage := providers.NewUsageTracker()
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			if tool, ok := agent.Tools.Get("session"); ok {
+				if st, ok := tool.(*tools.SessionTool); ok {
+					st.SetUsageSource(usage)
+				}
+			}
+		}
+	}
+
+	// Serve repeated read-only calls from a cache, if configured
+	wrapCacheableTools(cfg, registry)
+
+	// Gate destructive tools behind user approval, if configured
+	confirmations := newConfirmationGate(cfg, msgBus, registry)
 
 	// Set up shared fallback chain
 	cooldown := providers.NewCooldownTracker()
@@ -78,18 +110,57 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Create state manager using default agent's workspace for channel recording
 	defaultAgent := registry.GetDefaultAgent()
 	var stateManager *state.Manager
+	var budgetPath string
 	if defaultAgent != nil {
 		stateManager = state.NewManager(defaultAgent.Workspace)
+		budgetPath = filepath.Join(defaultAgent.Workspace, "state", "daily_budget.json")
 	}
 
 	return &AgentLoop{
-		bus:         msgBus,
-		cfg:         cfg,
-		registry:    registry,
-		state:       stateManager,
-		summarizing: sync.Map{},
-		fallback:    fallbackChain,
+		bus:           msgBus,
+		cfg:           cfg,
+		registry:      registry,
+		state:         stateManager,
+		summarizing:   sync.Map{},
+		fallback:      fallbackChain,
+		confirmations: confirmations,
+		audit:         audit,
+		usage:         usage,
+		budget:        newDailyBudget(cfg.Agents.Defaults.DailyBudget, budgetLocation(cfg), budgetPath),
+		started:       time.Now(),
+		requests:      newRequestRegistry(),
+	}
+}
+
+// SessionUsage returns the tokens used by LLM calls for sessionKey since
+// startup.
+func (al *AgentLoop) SessionUsage(sessionKey string) providers.TokenUsage {
+	return al.usage.SessionUsage(sessionKey)
+}
+
+// AgentUsage returns the tokens used by LLM calls of agentID since startup,
+// including background summarization.
+func (al *AgentLoop) AgentUsage(agentID string) providers.TokenUsage {
+	return al.usage.AgentUsage(agentID)
+}
+
+// newAuditLog creates the tool audit log, or returns nil when auditing is
+// disabled. A relative path is resolved against the default agent's workspace.
+func newAuditLog(cfg *config.Config, registry *AgentRegistry) *tools.AuditLog {
+	auditCfg := cfg.Tools.Audit
+	if !auditCfg.Enabled {
+		return nil
 	}
+
+	path := auditCfg.Path
+	if path != "" && !filepath.IsAbs(path) {
+		if defaultAgent := registry.GetDefaultAgent(); defaultAgent != nil {
+			path = filepath.Join(defaultAgent.Workspace, path)
+		}
+	}
+
+	logger.InfoCF("agent", "Tool audit log enabled", map[string]any{"path": path})
+	return tools.NewAuditLog(path)
 }
 
 // registerSharedTools registers tools that are shared across all agents (web, message, spawn).
@@ -98,6 +169,7 @@ func registerSharedTools(
 	msgBus *bus.MessageBus,
 	registry *AgentRegistry,
 	provider providers.LLMProvider,
+	audit *tools.AuditLog,
 ) {
 	for _, agentID := range registry.ListAgentIDs() {
 		agent, ok := registry.GetAgent(agentID)
@@ -128,6 +200,11 @@ func registerSharedTools(
 		// Vision tool for image analysis
 		agent.Tools.Register(tools.NewReadImageTool(agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace, provider, agent.Model))
 
+		// Sanitized view of the effective config, for troubleshooting
+		agent.Tools.Register(tools.NewConfigInfoTool(func() tools.ConfigInfo {
+			return configInfo(cfg, agent)
+		}))
+
 		// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 		agent.Tools.Register(tools.NewI2CTool())
 		agent.Tools.Register(tools.NewSPITool())
@@ -145,6 +222,23 @@ func registerSharedTools(
 		})
 		agent.Tools.Register(messageTool)
 
+		// Stream partial exec output to the chat, if configured
+		if cfg.Tools.Exec.StreamOutput {
+			if tool, ok := agent.Tools.Get("exec"); ok {
+				if execTool, ok := tool.(*tools.ExecTool); ok {
+					execTool.SetStreamCallback(func(channel, chatID, content, threadID string) error {
+						msgBus.PublishOutbound(bus.OutboundMessage{
+							Channel:  channel,
+							ChatID:   chatID,
+							ThreadID: threadID,
+							Content:  content,
+						})
+						return nil
+					})
+				}
+			}
+		}
+
 		// WebUI file sending tool
 		webuiFileTool := tools.NewWebUISendFileTool(agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace)
 		webuiFileTool.SetMessageBus(msgBus)
@@ -167,19 +261,48 @@ func registerSharedTools(
 		subagentRegistry := newSubagentRegistry(registry)
 		subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace, msgBus, subagentRegistry)
 		subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
+		subagentManager.SetDefaultSubagentModel(agent.SubagentModel)
+		subagentManager.SetStopSequences(func(model string) []string {
+			return resolveStopSequences(cfg, "", model)
+		})
+		subagentManager.SetTrimImpersonatedTurns(agent.TrimImpersonation)
+		subagentManager.SetAuditLog(audit)
+		subagentManager.SetMaxConcurrent(cfg.Agents.Defaults.MaxConcurrentSubagents)
+		subagentManager.SetAnnounceTemplate(cfg.Agents.Defaults.SubagentAnnounceTemplate)
 		// Share the main agent's tools with the subagent manager
 		subagentManager.SetTools(agent.Tools)
+		// Persist task records so they survive restarts
+		tasksPath := filepath.Join(agent.Workspace, "state", "subagent_tasks.json")
+		if err := subagentManager.SetStoragePath(tasksPath); err != nil {
+			logger.WarnCF("agent", "Failed to load subagent tasks",
+				map[string]any{"agent_id": agentID, "error": err.Error()})
+		}
+		agent.SubagentManager = subagentManager
 		spawnTool := tools.NewSpawnTool(subagentManager)
 		currentAgentID := agentID
 		spawnTool.SetAllowlistChecker(func(targetAgentID string) bool {
 			return registry.CanSpawnSubagent(currentAgentID, targetAgentID)
 		})
 		agent.Tools.Register(spawnTool)
+		agent.Tools.Register(tools.NewParallelSubagentsTool(subagentManager))
 	}
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	al.startSessionSweepers(ctx)
+
+	// Messages left unhandled by a crash are processed first
+	if n := al.bus.ReplayInbound(); n > 0 {
+		logger.InfoCF("agent", "Replaying unhandled inbound messages", map[string]any{"count": n})
+	}
+
+	// Messages of one session are handled one at a time, in order; different
+	// sessions, also of the same agent, run in parallel
+	workersCfg := al.cfg.Agents.Defaults.MessageWorkers
+	pool := newMessagePool(workersCfg.Count, workersCfg.QueueSize)
+	pool.start(ctx, al.handleInbound)
+	defer pool.close()
 
 	for al.running.Load() {
 		select {
@@ -191,42 +314,125 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			if pool.busy() && workersCfg.BusyMessage != "" && !constants.IsInternalChannel(msg.Channel) {
+				al.bus.PublishOutbound(bus.OutboundMessage{
+					Channel:  msg.Channel,
+					ChatID:   msg.ChatID,
+					ThreadID: msg.ThreadID,
+					Content:  workersCfg.BusyMessage,
+				})
 			}
+			pool.submit(ctx, al.sessionKeyOf(msg), msg)
+		}
+	}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				// Use default agent's tools to check (message tool is shared).
-				alreadySent := false
-				defaultAgent := al.registry.GetDefaultAgent()
-				if defaultAgent != nil {
-					if tool, ok := defaultAgent.Tools.Get("message"); ok {
-						if mt, ok := tool.(*tools.MessageTool); ok {
-							alreadySent = mt.HasSentInRound()
-						}
-					}
-				}
+	return nil
+}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel:  msg.Channel,
-						ChatID:   msg.ChatID,
-						ThreadID: msg.ThreadID,
-						Content:  response,
-					})
+// handleInbound processes msg, queued under sessionKey, and publishes the
+// reply.
+func (al *AgentLoop) handleInbound(ctx context.Context, sessionKey string, msg bus.InboundMessage) {
+	stopPresence := al.startPresence(ctx, msg)
+	reqCtx, done := al.requests.start(ctx, sessionKey, requestKey(msg.Channel, msg.ChatID))
+	response, err := al.processMessage(reqCtx, msg)
+	canceled := reqCtx.Err() != nil && ctx.Err() == nil
+	done()
+	stopPresence()
+	replyTo := msg.Metadata["message_id"]
+	if canceled {
+		// The user cancelled; the cancel command already replied
+		response = ""
+	} else if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+		replyTo = ""
+	}
+
+	if response != "" {
+		// Check if the message tool already sent a response during this round.
+		// If so, skip publishing to avoid duplicate messages to the user.
+		alreadySent := false
+		if agent, ok := al.registry.GetAgent(al.routeAgentID(msg)); ok {
+			if tool, ok := agent.Tools.Get("message"); ok {
+				if mt, ok := tool.(*tools.MessageTool); ok {
+					alreadySent = mt.HasSentInRound(sessionKey)
 				}
 			}
 		}
+
+		if !alreadySent {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel:  msg.Channel,
+				ChatID:   msg.ChatID,
+				ThreadID: msg.ThreadID,
+				Content:  response,
+				ReplyTo:  replyTo,
+			})
+		}
 	}
 
-	return nil
+	// Handled, including errors already reported to the user
+	al.bus.AckInbound(msg)
+}
+
+// startPresence shows that the agent is working on msg, on channels with a
+// typing indicator, and returns a function that hides it again.
+func (al *AgentLoop) startPresence(ctx context.Context, msg bus.InboundMessage) func() {
+	noop := func() {}
+	if al.channelManager == nil || constants.IsInternalChannel(msg.Channel) {
+		return noop
+	}
+	ch, ok := al.channelManager.GetChannel(msg.Channel)
+	if !ok {
+		return noop
+	}
+	presence, ok := ch.(channels.ChannelPresence)
+	if !ok {
+		return noop
+	}
+
+	if err := presence.StartTyping(ctx, msg.ChatID, msg.ThreadID); err != nil {
+		logger.DebugCF("agent", "Failed to start typing indicator",
+			map[string]any{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		return noop
+	}
+	return func() { presence.StopTyping(msg.ChatID) }
+}
+
+// startSessionSweepers unloads idle sessions of every agent until ctx is
+// cancelled, if session.idle_ttl_hours is set.
+func (al *AgentLoop) startSessionSweepers(ctx context.Context) {
+	if al.cfg.Session.IdleTTLHours <= 0 {
+		return
+	}
+	maxIdle := time.Duration(al.cfg.Session.IdleTTLHours) * time.Hour
+	for _, agentID := range al.registry.ListAgentIDs() {
+		if agent, ok := al.registry.GetAgent(agentID); ok {
+			go agent.Sessions.RunEvictionSweeper(ctx, maxIdle, al.cfg.Session.ForgetMemoryOnEvict)
+		}
+	}
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+
+	// Abort vector store writes so shutdown does not wait on embeddings,
+	// and stop subagents, which outlive the requests that spawned them
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		if agent.Sessions != nil {
+			agent.Sessions.Close()
+		}
+		if agent.SubagentManager != nil {
+			agent.SubagentManager.CancelTasks("", "")
+		}
+	}
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -243,6 +449,10 @@ func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	// Register Telegram-specific tools if channel is available
 	if cm != nil {
 		if ch, ok := cm.GetChannel("telegram"); ok && ch != nil {
+			if tc, ok := ch.(*channels.TelegramChannel); ok {
+				tc.SetStatsSource(al.botStats)
+				tc.SetRequestCanceler(al.CancelRequest)
+			}
 			for _, agentID := range al.registry.ListAgentIDs() {
 				if agent, ok := al.registry.GetAgent(agentID); ok {
 					workspace := agent.Workspace
@@ -338,26 +548,28 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			"thread_id":   msg.ThreadID,
 		})
 
+	metrics.MessagesProcessed.Inc(msg.Channel)
+
 	// Route system messages to processSystemMessage
 	if msg.Channel == "system" {
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Resolve tool confirmations; the outcome continues as the user's turn
+	if content, reply, handled := al.handleConfirmation(ctx, msg); handled {
+		if content == "" {
+			return reply, nil
+		}
+		msg.Content = content
+	}
+
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
 	}
 
 	// Route to determine agent and session key
-	route := al.registry.ResolveRoute(routing.RouteInput{
-		Channel:    msg.Channel,
-		AccountID:  msg.Metadata["account_id"],
-		Peer:       extractPeer(msg),
-		ParentPeer: extractParentPeer(msg),
-		GuildID:    msg.Metadata["guild_id"],
-		TeamID:     msg.Metadata["team_id"],
-		ThreadID:   msg.ThreadID,
-	})
+	route := al.resolveRoute(msg)
 
 	agent, ok := al.registry.GetAgent(route.AgentID)
 	if !ok {
@@ -377,20 +589,80 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			"matched_by":  route.MatchedBy,
 		})
 
+	// Enforce the daily budget before anything reaches the provider
+	var budgetKey string
+	if al.budget != nil {
+		budgetKey = al.budget.key(msg, sessionKey)
+		if !al.budget.allow(budgetKey) {
+			logger.InfoCF("agent", "Daily budget exhausted",
+				map[string]any{
+					"budget_key":  budgetKey,
+					"session_key": sessionKey,
+				})
+			return al.budget.limitMessage(), nil
+		}
+	}
+
 	return al.runAgentLoop(ctx, agent, processOptions{
 		SessionKey:      sessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
 		ThreadID:        msg.ThreadID,
+		SenderID:        msg.SenderID,
 		UserMessage:     msg.Content,
 		Media:           msg.Media,
+		Audio:           msg.Audio,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    msg.Channel == "webui", // Send response immediately for WebUI
 		MessageRole:     "user", // Default role for regular messages
+		BudgetKey:       budgetKey,
+	})
+}
+
+// resolveRoute determines the agent and session msg belongs to.
+func (al *AgentLoop) resolveRoute(msg bus.InboundMessage) routing.ResolvedRoute {
+	return al.registry.ResolveRoute(routing.RouteInput{
+		Channel:    msg.Channel,
+		AccountID:  msg.Metadata["account_id"],
+		Peer:       extractPeer(msg),
+		ParentPeer: extractParentPeer(msg),
+		GuildID:    msg.Metadata["guild_id"],
+		TeamID:     msg.Metadata["team_id"],
+		ThreadID:   msg.ThreadID,
+		SenderID:   msg.SenderID,
 	})
 }
 
+// routeAgentID returns the ID of the agent that will process msg. System
+// messages are processed by the default agent.
+func (al *AgentLoop) routeAgentID(msg bus.InboundMessage) string {
+	if msg.Channel != "system" {
+		if agent, ok := al.registry.GetAgent(al.resolveRoute(msg).AgentID); ok {
+			return agent.ID
+		}
+	}
+	if agent := al.registry.GetDefaultAgent(); agent != nil {
+		return agent.ID
+	}
+	return ""
+}
+
+// sessionKeyOf returns the session msg will be processed in, as
+// processMessage and processSystemMessage pick it.
+func (al *AgentLoop) sessionKeyOf(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		if agent := al.registry.GetDefaultAgent(); agent != nil {
+			return routing.BuildAgentMainSessionKey(agent.ID)
+		}
+		return ""
+	}
+	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
+		return msg.SessionKey
+	}
+	return al.resolveRoute(msg).SessionKey
+}
+
 // processMessageWithRole is like processMessage but allows specifying a custom message role.
 // This is used for cron jobs and other system-initiated messages that should not be saved as "user".
 func (al *AgentLoop) processMessageWithRole(ctx context.Context, msg bus.InboundMessage, role string, suppressIntermediateOutput bool) (string, error) {
@@ -416,6 +688,14 @@ func (al *AgentLoop) processMessageWithRole(ctx context.Context, msg bus.Inbound
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Resolve tool confirmations; the outcome continues as the user's turn
+	if content, reply, handled := al.handleConfirmation(ctx, msg); handled {
+		if content == "" {
+			return reply, nil
+		}
+		msg.Content = content
+	}
+
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
@@ -430,6 +710,7 @@ func (al *AgentLoop) processMessageWithRole(ctx context.Context, msg bus.Inbound
 		GuildID:    msg.Metadata["guild_id"],
 		TeamID:     msg.Metadata["team_id"],
 		ThreadID:   msg.ThreadID,
+		SenderID:   msg.SenderID,
 	})
 
 	agent, ok := al.registry.GetAgent(route.AgentID)
@@ -455,9 +736,11 @@ func (al *AgentLoop) processMessageWithRole(ctx context.Context, msg bus.Inbound
 		Channel:                    msg.Channel,
 		ChatID:                     msg.ChatID,
 		ThreadID:                   msg.ThreadID,
+		SenderID:                   msg.SenderID,
 		UserMessage:                msg.Content,
 		Media:                      msg.Media,
 		Files:                      msg.Files,
+		Audio:                      msg.Audio,
 		DefaultResponse:            "I've completed processing but have no response to give.",
 		EnableSummary:              true,
 		SendResponse:               true, // Send response for cron-triggered messages
@@ -488,7 +771,7 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 	}
 
 	// Extract subagent result from message content
-	// Format: "Task 'label' completed.\n\nResult:\n<actual content>"
+	// Format: "Task 'label' <status> in <duration>.\n\nResult:\n<actual content>"
 	content := msg.Content
 	if idx := strings.Index(content, "Result:\n"); idx >= 0 {
 		content = content[idx+8:] // Extract just the result part
@@ -536,16 +819,29 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		}
 	}
 
-	// 1. Update tool contexts
-	al.updateToolContexts(agent, opts.Channel, opts.ChatID, opts.ThreadID)
-	al.updateSessionContexts(agent, opts.SessionKey)
+	// Account every LLM call of the turn, including those of tools,
+	// subagents and summaries, to the session, the agent and the daily budget
+	ctx = tools.WithUsageReporter(ctx, func(usage *providers.UsageInfo) {
+		al.usage.Record(agent.ID, opts.SessionKey, usage)
+		al.budget.addTokens(opts.BudgetKey, usage)
+	})
+
+	// 1. Start a new round for the message tool; the other tools get the chat
+	// and session with each call
+	if tool, ok := agent.Tools.Get("message"); ok {
+		if mt, ok := tool.(*tools.MessageTool); ok {
+			mt.ResetRound(opts.SessionKey)
+		}
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
 	var summary string
+	var pinned []string
 	if !opts.NoHistory {
 		history = agent.Sessions.GetHistory(opts.SessionKey)
 		summary = agent.Sessions.GetSummary(opts.SessionKey)
+		pinned = agent.Sessions.GetPinned(opts.SessionKey)
 	}
 	
 	// Add file information to user message
@@ -561,11 +857,15 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	messages := agent.ContextBuilder.BuildMessages(
 		history,
 		summary,
+		pinned,
 		userMessage,
 		opts.Media,
 		opts.Channel,
 		opts.ChatID,
 	)
+	if len(opts.Audio) > 0 && len(messages) > 0 {
+		attachAudio(&messages[len(messages)-1], opts.Audio)
+	}
 
 	// 3. Save message to session
 	// For subagent results, save as "tool" role instead of "user"
@@ -591,17 +891,38 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	}
 
 	// 4. Run LLM iteration loop
-	finalContent, sentContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
+	finalContent, sentContent, iteration, reason, err := al.runLLMIteration(ctx, agent, messages, opts)
 	if err != nil {
 		return "", err
 	}
 
+	// Tell the user the loop was cut short instead of returning an empty or
+	// half-finished answer without explanation.
+	if reason == tools.TerminationMaxIterations {
+		logger.WarnCF("agent", "Max iterations reached",
+			map[string]any{
+				"agent_id":    agent.ID,
+				"session_key": opts.SessionKey,
+				"iterations":  iteration,
+				"max":         agent.MaxIterations,
+			})
+		finalContent = withMaxIterationsNotice(agent.MaxIterationsMessage, finalContent)
+	}
+
 	// If last tool had ForUser content and we already sent it, we might not need to send final response
 	// This is controlled by the tool's Silent flag and ForUser content
 
-	// 5. Handle empty response
-	if finalContent == "" {
-		finalContent = opts.DefaultResponse
+	// 5. Handle empty response. Some models return only whitespace on
+	// tool-only turns; channels such as Telegram reject empty messages.
+	if strings.TrimSpace(finalContent) == "" {
+		finalContent = emptyResponseReplacement(agent, opts)
+		logger.WarnCF("agent", "LLM returned an empty final response",
+			map[string]any{
+				"agent_id":    agent.ID,
+				"session_key": opts.SessionKey,
+				"iterations":  iteration,
+				"suppressed":  finalContent == "",
+			})
 	}
 
 	// 6. Save final assistant message to session
@@ -611,16 +932,19 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	if sessionContent == "" {
 		sessionContent = finalContent
 	}
-	agent.Sessions.AddMessage(opts.SessionKey, "assistant", sessionContent)
+	if sessionContent != "" {
+		agent.Sessions.AddMessage(opts.SessionKey, "assistant", sessionContent)
+	}
 	agent.Sessions.Save(opts.SessionKey)
+	agent.Sessions.FlushMessages(opts.SessionKey)
 
 	// 7. Optional: summarization
 	if opts.EnableSummary {
-		al.maybeSummarize(agent, opts.SessionKey, opts.Channel, opts.ChatID, opts.ThreadID)
+		al.maybeSummarize(ctx, agent, opts.SessionKey, opts.Channel, opts.ChatID, opts.ThreadID)
 	}
 
 	// 8. Optional: send response via bus
-	if opts.SendResponse {
+	if opts.SendResponse && finalContent != "" {
 		logger.DebugCF("agent", "Publishing outbound message",
 			map[string]any{
 				"channel":   opts.Channel,
@@ -649,6 +973,30 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	return finalContent, nil
 }
 
+// continuePrompt asks the model to carry on with a reply cut off by
+// max_tokens.
+const continuePrompt = "Your reply was cut off. Continue exactly where it stopped, " +
+	"without repeating anything or adding a preamble."
+
+// timedChat calls the provider, recording the request's latency and failure
+// in the provider metrics.
+func timedChat(
+	ctx context.Context,
+	provider providers.LLMProvider,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	start := time.Now()
+	resp, err := provider.Chat(ctx, messages, tools, model, options)
+	metrics.ProviderRequestDuration.Observe(time.Since(start).Seconds(), model)
+	if err != nil {
+		metrics.ProviderErrors.Inc(model)
+	}
+	return resp, err
+}
+
 // runLLMIteration executes the LLM call loop with tool handling.
 // Returns: finalContent, sentContent (via message tool), iteration count, error
 func (al *AgentLoop) runLLMIteration(
@@ -656,10 +1004,14 @@ func (al *AgentLoop) runLLMIteration(
 	agent *AgentInstance,
 	messages []providers.Message,
 	opts processOptions,
-) (string, string, int, error) {
+) (string, string, int, tools.TerminationReason, error) {
 	iteration := 0
 	var finalContent string
 	var sentContent string
+	var lastContent string
+	var truncated string // earlier parts of a reply cut off by max_tokens
+	continuations := 0
+	reason := tools.TerminationMaxIterations
 
 	for iteration < agent.MaxIterations {
 		iteration++
@@ -674,6 +1026,22 @@ func (al *AgentLoop) runLLMIteration(
 		// Build tool definitions
 		providerToolDefs := agent.Tools.ToProviderDefs()
 
+		// Resolve per-call options. Once a tool has run in this turn the
+		// optional tool temperature takes over.
+		loopConfig := tools.ToolLoopConfig{
+			MaxTokens:     agent.MaxTokens,
+			Temperature:   &agent.Temperature,
+			StopSequences: resolveStopSequences(al.cfg, "", agent.Model),
+			LLMOptions:    map[string]any{"prompt_cache_key": agent.ID},
+		}
+		if iteration > 1 && agent.ToolTemperature != nil {
+			loopConfig.Temperature = agent.ToolTemperature
+		}
+		llmOpts := loopConfig.CallOptions()
+
+		// Drop the oldest history rather than overflow the context window
+		messages, _ = al.fitContextWindow(messages, agent.ContextWindow, agent.MaxTokens)
+
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]any{
@@ -682,8 +1050,8 @@ func (al *AgentLoop) runLLMIteration(
 				"model":             agent.Model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
-				"max_tokens":        agent.MaxTokens,
-				"temperature":       agent.Temperature,
+				"max_tokens":        llmOpts["max_tokens"],
+				"temperature":       llmOpts["temperature"],
 				"system_prompt_len": len(messages[0].Content),
 			})
 
@@ -703,11 +1071,11 @@ func (al *AgentLoop) runLLMIteration(
 			if len(agent.Candidates) > 1 && al.fallback != nil {
 				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
 					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
-						return agent.Provider.Chat(ctx, messages, providerToolDefs, model, map[string]any{
-							"max_tokens":       agent.MaxTokens,
-							"temperature":      agent.Temperature,
-							"prompt_cache_key": agent.ID,
-						})
+						// Each candidate gets the stop sequences of its own model
+						candidateConfig := loopConfig
+						candidateConfig.StopSequences = resolveStopSequences(al.cfg, provider, model)
+						candidateOpts := candidateConfig.CallOptions()
+						return timedChat(ctx, agent.Provider, messages, providerToolDefs, model, candidateOpts)
 					},
 				)
 				if fbErr != nil {
@@ -720,18 +1088,15 @@ func (al *AgentLoop) runLLMIteration(
 				}
 				return fbResult.Response, nil
 			}
-			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]any{
-				"max_tokens":       agent.MaxTokens,
-				"temperature":      agent.Temperature,
-				"prompt_cache_key": agent.ID,
-			})
+			return timedChat(ctx, agent.Provider, messages, providerToolDefs, agent.Model, llmOpts)
 		}
 
 		// Retry loop for context/token errors
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
 			response, err = callLLM()
-			if err == nil {
+			if err == nil || ctx.Err() != nil {
+				// A cancelled request is not a context window error
 				break
 			}
 
@@ -760,7 +1125,7 @@ func (al *AgentLoop) runLLMIteration(
 				newHistory := agent.Sessions.GetHistory(opts.SessionKey)
 				newSummary := agent.Sessions.GetSummary(opts.SessionKey)
 				messages = agent.ContextBuilder.BuildMessages(
-					newHistory, newSummary, "",
+					newHistory, newSummary, agent.Sessions.GetPinned(opts.SessionKey), "",
 					nil, opts.Channel, opts.ChatID,
 				)
 				continue
@@ -775,12 +1140,39 @@ func (al *AgentLoop) runLLMIteration(
 					"iteration": iteration,
 					"error":     err.Error(),
 				})
-			return "", "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
+			return "", "", iteration, "", fmt.Errorf("LLM call failed after retries: %w", err)
+		}
+		tools.ReportUsage(ctx, response.Usage)
+
+		// Drop any user turns the model made up before storing or sending the reply
+		if agent.TrimImpersonation {
+			response.Content = providers.TrimImpersonatedTurns(response.Content)
+		}
+
+		// Ask for the rest of a reply cut off by max_tokens. Continuations
+		// don't use up tool iterations.
+		if len(response.ToolCalls) == 0 && response.FinishReason == "length" &&
+			continuations < agent.MaxContinuations {
+			continuations++
+			iteration--
+			truncated += response.Content
+			messages = append(messages,
+				providers.Message{Role: "assistant", Content: response.Content},
+				providers.Message{Role: "user", Content: continuePrompt},
+			)
+			logger.InfoCF("agent", "Reply cut off by max_tokens, continuing",
+				map[string]any{
+					"agent_id":      agent.ID,
+					"continuation":  continuations,
+					"content_chars": len(truncated),
+				})
+			continue
 		}
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
-			finalContent = response.Content
+			finalContent = truncated + response.Content
+			reason = tools.TerminationCompleted
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]any{
 					"agent_id":      agent.ID,
@@ -808,6 +1200,10 @@ func (al *AgentLoop) runLLMIteration(
 				"iteration": iteration,
 			})
 
+		if response.Content != "" {
+			lastContent = response.Content
+		}
+
 		// Build assistant message with tool calls
 		assistantMsg := providers.Message{
 			Role:             "assistant",
@@ -868,8 +1264,15 @@ func (al *AgentLoop) runLLMIteration(
 				}
 			}
 
+			toolStart := time.Now()
 			toolResult := agent.Tools.ExecuteWithContext(
-				ctx,
+				tools.WithCallContext(ctx, tools.CallContext{
+					Channel:    opts.Channel,
+					ChatID:     opts.ChatID,
+					ThreadID:   opts.ThreadID,
+					SessionKey: opts.SessionKey,
+					SenderID:   opts.SenderID,
+				}),
 				tc.Name,
 				tc.Arguments,
 				opts.Channel,
@@ -877,6 +1280,7 @@ func (al *AgentLoop) runLLMIteration(
 				opts.ThreadID,
 				asyncCallback,
 			)
+			al.audit.Record(opts.SessionKey, opts.Channel, opts.ChatID, tc.Name, tc.Arguments, toolResult, time.Since(toolStart))
 
 			// Track content sent via message tool for session storage
 			if tc.Name == "message" && toolResult.Err == nil {
@@ -911,10 +1315,7 @@ func (al *AgentLoop) runLLMIteration(
 			}
 
 			// Determine content for LLM based on tool result
-			contentForLLM := toolResult.ForLLM
-			if contentForLLM == "" && toolResult.Err != nil {
-				contentForLLM = toolResult.Err.Error()
-			}
+			contentForLLM := toolResult.ContentForLLM(tc.Name)
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -928,59 +1329,41 @@ func (al *AgentLoop) runLLMIteration(
 		}
 	}
 
-	return finalContent, sentContent, iteration, nil
+	if reason == tools.TerminationMaxIterations {
+		finalContent = truncated + lastContent
+	}
+
+	return finalContent, sentContent, iteration, reason, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID, threadID string) {
-	// Update ContextualTool implementations
-	if tool, ok := agent.Tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID, threadID)
-		}
+// withMaxIterationsNotice prepends the step-limit notice to whatever partial
+// content the LLM produced before the loop was cut off.
+func withMaxIterationsNotice(notice, partial string) string {
+	if notice == "" {
+		return partial
 	}
-	if tool, ok := agent.Tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID, threadID)
-		}
-	}
-	if tool, ok := agent.Tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID, threadID)
-		}
-	}
-	if tool, ok := agent.Tools.Get("cron"); ok {
-		if ct, ok := tool.(tools.ContextualTool); ok {
-			ct.SetContext(channel, chatID, threadID)
-		}
-	}
-	// Update WebUI file tool
-	if tool, ok := agent.Tools.Get("webui_send_file"); ok {
-		if wt, ok := tool.(*tools.WebUISendFileTool); ok {
-			wt.SetContext(channel, chatID, threadID)
-		}
+	if partial == "" {
+		return notice
 	}
+	return notice + "\n\n" + partial
 }
 
-// updateSessionContexts updates the session key for tools that need it.
-func (al *AgentLoop) updateSessionContexts(agent *AgentInstance, sessionKey string) {
-	// Update SessionAwareTool implementations
-	if tool, ok := agent.Tools.Get("session"); ok {
-		if st, ok := tool.(tools.SessionAwareTool); ok {
-			st.SetSessionKey(sessionKey)
-		}
+// emptyResponseReplacement returns what to send in place of an empty final
+// response: nothing if the agent suppresses them, otherwise a placeholder.
+func emptyResponseReplacement(agent *AgentInstance, opts processOptions) string {
+	if agent.SuppressEmptyReply {
+		return ""
 	}
-	// Update ContextWindowAwareTool implementations
-	if tool, ok := agent.Tools.Get("session"); ok {
-		if ct, ok := tool.(tools.ContextWindowAwareTool); ok {
-			ct.SetContextWindow(agent.ContextWindow)
-		}
+	if agent.EmptyResponseMessage != "" {
+		return agent.EmptyResponseMessage
 	}
+	return opts.DefaultResponse
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 // Uses token-oriented approach instead of message count to better handle large context windows.
-func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, chatID, threadID string) {
+// The summary is written in the background, with the values of ctx but not its cancellation.
+func (al *AgentLoop) maybeSummarize(ctx context.Context, agent *AgentInstance, sessionKey, channel, chatID, threadID string) {
 	newHistory := agent.Sessions.GetHistory(sessionKey)
 	tokenEstimate := al.estimateTokens(newHistory)
 
@@ -1013,7 +1396,7 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, c
 					})
 				}
 				logger.Debug("Memory threshold reached. Optimizing conversation history...")
-				al.summarizeSessionWithTokenLimit(agent, sessionKey, keepRecentTokens)
+				al.summarizeSessionWithTokenLimit(context.WithoutCancel(ctx), agent, sessionKey, keepRecentTokens)
 			}()
 		}
 	}
@@ -1267,13 +1650,19 @@ func (al *AgentLoop) summarizeBatch(
 	if err != nil {
 		return "", err
 	}
+	tools.ReportUsage(ctx, response.Usage)
 	return response.Content, nil
 }
 
 // summarizeSessionWithTokenLimit summarizes conversation history using a token-oriented approach.
 // Keeps the last keepRecentTokens tokens instead of a fixed number of messages.
-func (al *AgentLoop) summarizeSessionWithTokenLimit(agent *AgentInstance, sessionKey string, keepRecentTokens int) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+func (al *AgentLoop) summarizeSessionWithTokenLimit(
+	ctx context.Context,
+	agent *AgentInstance,
+	sessionKey string,
+	keepRecentTokens int,
+) {
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
 	history := agent.Sessions.GetHistory(sessionKey)
@@ -1350,6 +1739,7 @@ func (al *AgentLoop) summarizeSessionWithTokenLimit(agent *AgentInstance, sessio
 			},
 		)
 		if err == nil {
+			tools.ReportUsage(ctx, resp.Usage)
 			finalSummary = resp.Content
 		} else {
 			finalSummary = s1 + " " + s2
@@ -2,14 +2,20 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
@@ -479,6 +485,39 @@ func TestToolResult_SilentToolDoesNotSendUserMessage(t *testing.T) {
 	}
 }
 
+func TestAgentLoop_RecordsMetrics(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "metrics-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "hi"})
+
+	// Metrics are global, so compare against the counts before the message
+	processed := metrics.MessagesProcessed.Value("metrics-test")
+	requests := metrics.ProviderRequestDuration.Count("metrics-model")
+
+	testHelper{al: al}.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+		Channel:    "metrics-test",
+		SenderID:   "user1",
+		ChatID:     "chat1",
+		Content:    "hello",
+		SessionKey: "test-session",
+	})
+
+	if got := metrics.MessagesProcessed.Value("metrics-test") - processed; got != 1 {
+		t.Errorf("messages processed increased by %v, want 1", got)
+	}
+	if got := metrics.ProviderRequestDuration.Count("metrics-model") - requests; got != 1 {
+		t.Errorf("provider requests increased by %d, want 1", got)
+	}
+}
+
 // TestToolResult_UserFacingToolDoesSendMessage verifies user-facing tools trigger outbound
 func TestToolResult_UserFacingToolDoesSendMessage(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "agent-test-*")
@@ -633,3 +672,998 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// alwaysToolCallMockProvider never produces a final answer, so the loop can
+// only stop by exhausting its iterations. If truncated is set, the first reply
+// is that text cut off by max_tokens.
+type alwaysToolCallMockProvider struct {
+	calls     int
+	truncated string
+}
+
+func (m *alwaysToolCallMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 && m.truncated != "" {
+		return &providers.LLMResponse{Content: m.truncated, FinishReason: "length"}, nil
+	}
+	return &providers.LLMResponse{
+		Content: fmt.Sprintf("Still working (step %d)", m.calls),
+		ToolCalls: []providers.ToolCall{
+			{
+				ID:        fmt.Sprintf("call_%d", m.calls),
+				Type:      "function",
+				Name:      "nonexistent_tool",
+				Arguments: map[string]any{},
+			},
+		},
+	}, nil
+}
+
+func (m *alwaysToolCallMockProvider) GetDefaultModel() string {
+	return "mock-loop-model"
+}
+
+// TestAgentLoop_MaxIterationsNotice verifies that exhausting the tool loop
+// produces the configured notice together with the partial content.
+func TestAgentLoop_MaxIterationsNotice(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:            tmpDir,
+				Model:                "test-model",
+				MaxTokens:            4096,
+				MaxToolIterations:    3,
+				MaxIterationsMessage: "Step limit reached.",
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &alwaysToolCallMockProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	response, err := al.ProcessDirectWithChannel(
+		context.Background(),
+		"do something long",
+		"test-session-max-iter",
+		"test",
+		"test-chat",
+		"user",
+		true,
+	)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+
+	if provider.calls != 3 {
+		t.Errorf("Expected 3 LLM calls, got %d", provider.calls)
+	}
+	want := "Step limit reached.\n\nStill working (step 3)"
+	if response != want {
+		t.Errorf("Expected %q, got %q", want, response)
+	}
+}
+
+// TestAgentLoop_MaxIterationsKeepsTruncatedReply verifies that a reply cut
+// off by max_tokens is kept when the loop then runs out of iterations.
+func TestAgentLoop_MaxIterationsKeepsTruncatedReply(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:            t.TempDir(),
+				Model:                "test-model",
+				MaxTokens:            4096,
+				MaxToolIterations:    2,
+				MaxContinuations:     1,
+				MaxIterationsMessage: "Step limit reached.",
+			},
+		},
+	}
+	provider := &alwaysToolCallMockProvider{truncated: "Here is the plan. "}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	response, err := al.ProcessDirectWithChannel(
+		context.Background(),
+		"do something long",
+		"test-session-max-iter-truncated",
+		"test",
+		"test-chat",
+		"user",
+		true,
+	)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+
+	if provider.calls != 3 {
+		t.Errorf("Expected 3 LLM calls, got %d", provider.calls)
+	}
+	want := "Step limit reached.\n\nHere is the plan. Still working (step 3)"
+	if response != want {
+		t.Errorf("Expected %q, got %q", want, response)
+	}
+}
+
+// capturingMockProvider records the options of every call. The first call
+// requests a tool, later calls answer directly.
+type capturingMockProvider struct {
+	options []map[string]any
+}
+
+func (m *capturingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.options = append(m.options, opts)
+	if len(m.options) == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{
+				{ID: "call_1", Type: "function", Name: "nonexistent_tool", Arguments: map[string]any{}},
+			},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (m *capturingMockProvider) GetDefaultModel() string {
+	return "mock-capture-model"
+}
+
+// truncatingMockProvider cuts its first reply off at max_tokens and finishes
+// it on the next call, recording the messages of every call.
+type truncatingMockProvider struct {
+	calls [][]providers.Message
+}
+
+func (m *truncatingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls = append(m.calls, append([]providers.Message(nil), messages...))
+	if len(m.calls) == 1 {
+		return &providers.LLMResponse{Content: "The first half of the answer, ", FinishReason: "length"}, nil
+	}
+	return &providers.LLMResponse{Content: "and the second half.", FinishReason: "stop"}, nil
+}
+
+func (m *truncatingMockProvider) GetDefaultModel() string {
+	return "mock-truncating-model"
+}
+
+func TestAgentLoop_ContinuesTruncatedReply(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		continuations int
+		want          string
+		wantCalls     int
+	}{
+		{name: "continued", continuations: 2, want: "The first half of the answer, and the second half.", wantCalls: 2},
+		{name: "disabled", continuations: 0, want: "The first half of the answer, ", wantCalls: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 1,
+						MaxContinuations:  tt.continuations,
+					},
+				},
+			}
+			provider := &truncatingMockProvider{}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+			response := testHelper{al: al}.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+				Channel:    "test",
+				SenderID:   "user1",
+				ChatID:     "chat1",
+				Content:    "explain",
+				SessionKey: "test-session",
+			})
+
+			if response != tt.want {
+				t.Errorf("response = %q, want %q", response, tt.want)
+			}
+			if len(provider.calls) != tt.wantCalls {
+				t.Fatalf("provider called %d times, want %d", len(provider.calls), tt.wantCalls)
+			}
+			if tt.wantCalls > 1 {
+				// The continuation request carries the cut-off part and asks for the rest
+				msgs := provider.calls[1]
+				partial, prompt := msgs[len(msgs)-2], msgs[len(msgs)-1]
+				if partial.Role != "assistant" || partial.Content != "The first half of the answer, " {
+					t.Errorf("partial reply message = %+v", partial)
+				}
+				if prompt.Role != "user" || prompt.Content != continuePrompt {
+					t.Errorf("continue message = %+v", prompt)
+				}
+			}
+		})
+	}
+}
+
+// TestAgentLoop_ToolTemperatureOverride verifies that the tool temperature is
+// used for calls that follow a tool call, and only for those.
+func TestAgentLoop_ToolTemperatureOverride(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	temperature := 0.9
+	toolTemperature := 0.0
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Temperature:       &temperature,
+				ToolTemperature:   &toolTemperature,
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &capturingMockProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	response, err := al.ProcessDirectWithChannel(
+		context.Background(),
+		"use a tool",
+		"test-session-tool-temp",
+		"test",
+		"test-chat",
+		"user",
+		true,
+	)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+	if response != "done" {
+		t.Errorf("Expected 'done', got %q", response)
+	}
+
+	if len(provider.options) != 2 {
+		t.Fatalf("Expected 2 LLM calls, got %d", len(provider.options))
+	}
+	if got := provider.options[0]["temperature"]; got != 0.9 {
+		t.Errorf("first call temperature = %v, want 0.9", got)
+	}
+	if got := provider.options[1]["temperature"]; got != 0.0 {
+		t.Errorf("second call temperature = %v, want 0.0", got)
+	}
+	if got := provider.options[1]["max_tokens"]; got != 4096 {
+		t.Errorf("second call max_tokens = %v, want 4096", got)
+	}
+}
+
+// unavailableModelMockProvider fails every call to the model named down and
+// records the model and stop option of each call.
+type unavailableModelMockProvider struct {
+	down  string
+	calls []string
+	stops [][]string
+}
+
+func (m *unavailableModelMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	stop, _ := opts["stop"].([]string)
+	m.calls = append(m.calls, model)
+	m.stops = append(m.stops, stop)
+	if model == m.down {
+		return nil, errors.New("rate limit exceeded")
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (m *unavailableModelMockProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestAgentLoop_FallbackUsesCandidateStopSequences(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "primary",
+				ModelFallbacks:    []string{"openai/backup"},
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "primary", Model: "openai/primary", StopSequences: []string{"\nUser:"}},
+			{ModelName: "backup-alias", Model: "openai/backup", StopSequences: []string{"\nHuman:"}},
+		},
+	}
+
+	provider := &unavailableModelMockProvider{down: "primary"}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	response, err := al.ProcessDirectWithChannel(context.Background(), "hi", "test-session-stops", "test", "test-chat", "user", true)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+	if response != "done" {
+		t.Errorf("response = %q, want done", response)
+	}
+
+	if len(provider.calls) != 2 || provider.calls[0] != "primary" || provider.calls[1] != "backup" {
+		t.Fatalf("calls = %v, want [primary backup]", provider.calls)
+	}
+	if !slices.Equal(provider.stops[0], []string{"\nUser:"}) {
+		t.Errorf("primary stop = %q, want its own stop sequences", provider.stops[0])
+	}
+	if !slices.Equal(provider.stops[1], []string{"\nHuman:"}) {
+		t.Errorf("fallback stop = %q, want its own stop sequences", provider.stops[1])
+	}
+}
+
+// failingResultTool returns a fixed error result.
+type failingResultTool struct {
+	result *tools.ToolResult
+}
+
+func (m *failingResultTool) Name() string {
+	return "failing_tool"
+}
+
+func (m *failingResultTool) Description() string {
+	return "Tool that always fails"
+}
+
+func (m *failingResultTool) Parameters() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+}
+
+func (m *failingResultTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	return m.result
+}
+
+// toolMessageMockProvider calls failing_tool once and records the tool
+// message it receives back.
+type toolMessageMockProvider struct {
+	toolMessage string
+	calls       int
+}
+
+func (m *toolMessageMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{
+				{ID: "call_1", Type: "function", Name: "failing_tool", Arguments: map[string]any{}},
+			},
+		}, nil
+	}
+	for _, msg := range messages {
+		if msg.Role == "tool" && msg.ToolCallID == "call_1" {
+			m.toolMessage = msg.Content
+		}
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (m *toolMessageMockProvider) GetDefaultModel() string {
+	return "mock-tool-message-model"
+}
+
+// TestAgentLoop_ToolErrorKindRendering verifies how each error kind is
+// rendered into the tool message the LLM sees.
+func TestAgentLoop_ToolErrorKindRendering(t *testing.T) {
+	tests := []struct {
+		name         string
+		result       *tools.ToolResult
+		wantContains string
+		wantHidden   string
+	}{
+		{
+			name:         "validation",
+			result:       tools.ValidationError("path is required"),
+			wantContains: "path is required",
+		},
+		{
+			name:         "permission",
+			result:       tools.PermissionError("path outside workspace"),
+			wantContains: "Permission denied: path outside workspace",
+		},
+		{
+			name:         "external",
+			result:       tools.ExternalError("search failed: 503"),
+			wantContains: "External service error: search failed: 503",
+		},
+		{
+			name:         "internal",
+			result:       tools.InternalError("open /srv/secrets/db.key: permission denied"),
+			wantContains: "internal error",
+			wantHidden:   "/srv/secrets/db.key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 5,
+					},
+				},
+			}
+
+			provider := &toolMessageMockProvider{}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			al.RegisterTool(&failingResultTool{result: tt.result})
+
+			if _, err := al.ProcessDirectWithChannel(
+				context.Background(), "try it", "test-session-"+tt.name, "test", "test-chat", "user", true,
+			); err != nil {
+				t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+			}
+
+			if !strings.Contains(provider.toolMessage, tt.wantContains) {
+				t.Errorf("tool message = %q, want it to contain %q", provider.toolMessage, tt.wantContains)
+			}
+			if tt.wantHidden != "" && strings.Contains(provider.toolMessage, tt.wantHidden) {
+				t.Errorf("tool message = %q, must not expose %q", provider.toolMessage, tt.wantHidden)
+			}
+		})
+	}
+}
+
+// writeFileMockProvider asks for write_file once and records the last user
+// message of every later call.
+type writeFileMockProvider struct {
+	path        string
+	calls       int
+	lastUserMsg string
+}
+
+func (m *writeFileMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call_1",
+				Type:      "function",
+				Name:      "write_file",
+				Arguments: map[string]any{"path": m.path, "content": "hello"},
+			}},
+		}, nil
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			m.lastUserMsg = messages[i].Content
+			break
+		}
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (m *writeFileMockProvider) GetDefaultModel() string {
+	return "mock-write-model"
+}
+
+// TestAgentLoop_ToolConfirmation covers the pending, approved and denied
+// paths of a gated tool.
+func TestAgentLoop_ToolConfirmation(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		wantFile    bool
+		wantUserMsg string
+	}{
+		{name: "approved", command: "/approve confirm-1", wantFile: true, wantUserMsg: "The user approved write_file (confirm-1)"},
+		{name: "denied", command: "/deny confirm-1", wantFile: false, wantUserMsg: "The user denied write_file (confirm-1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         tmpDir,
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 5,
+					},
+				},
+			}
+			cfg.Tools.Confirmation.Enabled = true
+
+			target := filepath.Join(tmpDir, "out.txt")
+			provider := &writeFileMockProvider{path: target}
+			msgBus := bus.NewMessageBus()
+			al := NewAgentLoop(cfg, msgBus, provider)
+
+			process := func(content string) string {
+				t.Helper()
+				response, err := al.ProcessDirectWithChannel(
+					context.Background(), content, "test-session-confirm", "test", "test-chat", "user", true,
+				)
+				if err != nil {
+					t.Fatalf("ProcessDirectWithChannel(%q) failed: %v", content, err)
+				}
+				return response
+			}
+
+			// Pending: nothing is written, the user is asked with buttons
+			process("write the file")
+			if _, err := os.Stat(target); !os.IsNotExist(err) {
+				t.Fatal("file was written before approval")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			prompt, ok := msgBus.SubscribeOutbound(ctx)
+			if !ok {
+				t.Fatal("no confirmation prompt was published")
+			}
+			if prompt.ChatID != "test-chat" || len(prompt.Buttons) != 2 || prompt.Buttons[0].Data != "/approve confirm-1" {
+				t.Errorf("confirmation prompt = %+v", prompt)
+			}
+
+			process(tt.command)
+
+			_, err := os.Stat(target)
+			if gotFile := err == nil; gotFile != tt.wantFile {
+				t.Errorf("file written = %v, want %v", gotFile, tt.wantFile)
+			}
+			if !strings.Contains(provider.lastUserMsg, tt.wantUserMsg) {
+				t.Errorf("agent saw %q, want it to contain %q", provider.lastUserMsg, tt.wantUserMsg)
+			}
+
+			// The action is gone once resolved
+			if response := process(tt.command); response != "No pending action confirm-1" {
+				t.Errorf("second %s response = %q", tt.command, response)
+			}
+		})
+	}
+}
+
+// TestAgentLoop_ConfirmationDisabled verifies that forget_all still waits for
+// approval when tool confirmation is disabled.
+func TestAgentLoop_ConfirmationDisabled(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "hi"})
+
+	response, err := al.ProcessDirectWithChannel(
+		context.Background(), "/approve confirm-1", "test-session-no-confirm", "test", "test-chat", "user", true,
+	)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+	if response != "No pending action confirm-1" {
+		t.Errorf("response = %q", response)
+	}
+
+	agent := al.registry.GetDefaultAgent()
+	result := agent.Tools.ExecuteWithContext(context.Background(), "session",
+		map[string]any{"action": "forget_all"}, "test", "test-chat", "", nil)
+	if !strings.Contains(result.ForLLM, "needs the user's approval") {
+		t.Errorf("forget_all result = %q, want it held for approval", result.ForLLM)
+	}
+	for _, name := range []string{"exec", "write_file"} {
+		if tool, _ := agent.Tools.Get(name); strings.Contains(fmt.Sprintf("%T", tool), "confirming") {
+			t.Errorf("%s is gated with confirmation disabled", name)
+		}
+	}
+}
+
+// TestAgentLoop_ConfirmationDefaultTools verifies that every tool that writes
+// files is gated by the default list.
+func TestAgentLoop_ConfirmationDefaultTools(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	cfg.Tools.Confirmation.Enabled = true
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "hi"})
+
+	agent := al.registry.GetDefaultAgent()
+	for _, name := range []string{"exec", "write_file", "edit_file", "append_file", "write_files", "apply_patch"} {
+		tool, ok := agent.Tools.Get(name)
+		if !ok {
+			t.Errorf("%s is not registered", name)
+			continue
+		}
+		if !strings.Contains(fmt.Sprintf("%T", tool), "confirming") {
+			t.Errorf("%s is not gated by default", name)
+		}
+	}
+}
+
+// TestAgentLoop_EmptyResponse verifies that a whitespace-only final reply is
+// never sent as is: it is replaced by the placeholder or dropped.
+func TestAgentLoop_EmptyResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		suppress bool
+		want     string
+	}{
+		{name: "default placeholder", want: "I've completed processing but have no response to give."},
+		{name: "configured placeholder", message: "(no reply)", want: "(no reply)"},
+		{name: "suppressed", suppress: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:             t.TempDir(),
+						Model:                 "test-model",
+						MaxTokens:             4096,
+						ContextWindow:         128000, // keep summarization notices off the bus
+						MaxToolIterations:     5,
+						EmptyResponseMessage:  tt.message,
+						SuppressEmptyResponse: tt.suppress,
+					},
+				},
+			}
+			msgBus := bus.NewMessageBus()
+			al := NewAgentLoop(cfg, msgBus, &simpleMockProvider{response: " \n\t "})
+
+			response, err := al.ProcessDirectWithChannel(
+				context.Background(), "hello", "test-session-empty", "test", "test-chat", "user", true,
+			)
+			if err != nil {
+				t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+			}
+			if response != tt.want {
+				t.Errorf("response = %q, want %q", response, tt.want)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			out, ok := msgBus.SubscribeOutbound(ctx)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("published %q for a suppressed empty response", out.Content)
+				}
+				return
+			}
+			if !ok || out.Content != tt.want {
+				t.Errorf("published %q (ok=%v), want %q", out.Content, ok, tt.want)
+			}
+		})
+	}
+}
+
+// presenceRecorder records typing indicator calls and LLM calls in order.
+type presenceRecorder struct {
+	*channels.BaseChannel
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *presenceRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *presenceRecorder) Start(ctx context.Context) error { return nil }
+func (r *presenceRecorder) Stop(ctx context.Context) error  { return nil }
+
+func (r *presenceRecorder) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+func (r *presenceRecorder) StartTyping(ctx context.Context, chatID, threadID string) error {
+	r.record("start:" + chatID + ":" + threadID)
+	return nil
+}
+
+func (r *presenceRecorder) StopTyping(chatID string) {
+	r.record("stop:" + chatID)
+}
+
+func (r *presenceRecorder) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	r.record("llm")
+	return &providers.LLMResponse{Content: "hi"}, nil
+}
+
+func (r *presenceRecorder) GetDefaultModel() string {
+	return "mock-model"
+}
+
+// TestAgentLoop_PresenceAroundProcessing verifies that the loop shows the
+// channel's typing indicator while a message is processed.
+func TestAgentLoop_PresenceAroundProcessing(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	recorder := &presenceRecorder{BaseChannel: channels.NewBaseChannel("test", nil, msgBus, nil)}
+	al := NewAgentLoop(cfg, msgBus, recorder)
+
+	cm, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	cm.RegisterChannel("test", recorder)
+	al.SetChannelManager(cm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "test", SenderID: "u1", ChatID: "c1", ThreadID: "t1", Content: "hello",
+		Metadata: map[string]string{"message_id": "17"},
+	})
+
+	outCtx, outCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer outCancel()
+	out, ok := msgBus.SubscribeOutbound(outCtx)
+	if !ok || out.Content != "hi" {
+		t.Fatalf("outbound = %+v (ok=%v), want the reply", out, ok)
+	}
+	if out.ReplyTo != "17" {
+		t.Errorf("outbound ReplyTo = %q, want the inbound message ID", out.ReplyTo)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	want := []string{"start:c1:t1", "llm", "stop:c1"}
+	if strings.Join(recorder.events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", recorder.events, want)
+	}
+}
+
+// usageMockProvider requests a tool on every odd call and answers on every
+// even one, reporting the same usage each time.
+type usageMockProvider struct {
+	calls int
+}
+
+func (m *usageMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	resp := &providers.LLMResponse{
+		Content: "done",
+		Usage:   &providers.UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+	}
+	if m.calls%2 == 1 {
+		resp.ToolCalls = []providers.ToolCall{{
+			ID: fmt.Sprintf("call_%d", m.calls), Type: "function", Name: "nonexistent_tool", Arguments: map[string]any{},
+		}}
+	}
+	return resp, nil
+}
+
+func (m *usageMockProvider) GetDefaultModel() string {
+	return "mock-usage-model"
+}
+
+func TestAgentLoop_TokenUsage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000, // keep summarization off
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+
+	for _, session := range []string{"agent:main:usage-a", "agent:main:usage-a", "agent:main:usage-b"} {
+		if _, err := al.ProcessDirectWithChannel(
+			context.Background(), "hello", session, "test", "test-chat", "user", true,
+		); err != nil {
+			t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+		}
+	}
+
+	// Each message takes a tool call and a final answer
+	want := providers.TokenUsage{Calls: 4, PromptTokens: 400, CompletionTokens: 80, TotalTokens: 480}
+	if got := al.SessionUsage("agent:main:usage-a"); got != want {
+		t.Errorf("SessionUsage(usage-a) = %+v, want %+v", got, want)
+	}
+	if got := al.SessionUsage("agent:main:usage-b"); got.Calls != 2 || got.TotalTokens != 240 {
+		t.Errorf("SessionUsage(usage-b) = %+v, want 2 calls and 240 tokens", got)
+	}
+	if got := al.AgentUsage("main"); got.Calls != 6 || got.TotalTokens != 720 {
+		t.Errorf("AgentUsage(main) = %+v, want 6 calls and 720 tokens", got)
+	}
+
+	agent := al.registry.GetDefaultAgent()
+	tool, _ := agent.Tools.Get("session")
+	st := tool.(tools.SessionAwareTool) // gated for forget_all, so wrapped
+	st.SetSessionKey("agent:main:usage-a")
+	result := st.Execute(context.Background(), map[string]any{"action": "stats"})
+	if !strings.Contains(result.ForLLM, "Usage: 400 prompt + 80 completion = 480 tokens over 4 LLM calls") {
+		t.Errorf("stats do not report usage:\n%s", result.ForLLM)
+	}
+}
+
+func TestAgentLoop_TokenUsageIncludesToolCalls(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000, // keep summarization off
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	agent := al.registry.GetDefaultAgent()
+	// Stands in for a subagent run by the tool the mock provider calls
+	agent.Tools.Register(&usageReportingTool{name: "nonexistent_tool", tokens: 1000})
+
+	if _, err := al.ProcessDirectWithChannel(
+		context.Background(), "hello", "agent:main:usage-a", "test", "test-chat", "user", true,
+	); err != nil {
+		t.Fatalf("ProcessDirectWithChannel failed: %v", err)
+	}
+
+	// Two calls of the agent and one made by the tool
+	if got := al.SessionUsage("agent:main:usage-a"); got.Calls != 3 || got.TotalTokens != 1240 {
+		t.Errorf("SessionUsage = %+v, want 3 calls and 1240 tokens", got)
+	}
+	if got := al.AgentUsage("main"); got.Calls != 3 || got.TotalTokens != 1240 {
+		t.Errorf("AgentUsage(main) = %+v, want 3 calls and 1240 tokens", got)
+	}
+}
+
+func TestAgentLoop_DailyBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget config.DailyBudgetConfig
+	}{
+		// Each message takes two LLM calls of 120 tokens
+		{name: "messages", budget: config.DailyBudgetConfig{MaxMessages: 2, ResetTime: "04:00"}},
+		{name: "tokens", budget: config.DailyBudgetConfig{MaxTokens: 400, ResetTime: "04:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						ContextWindow:     128000, // keep summarization off
+						MaxToolIterations: 5,
+						Timezone:          "UTC",
+						DailyBudget:       tt.budget,
+					},
+				},
+			}
+			provider := &usageMockProvider{}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			al.budget.now = func() time.Time { return now }
+
+			send := func(sender string) string {
+				t.Helper()
+				response, err := al.processMessage(context.Background(), bus.InboundMessage{
+					Channel:  "telegram",
+					SenderID: sender,
+					ChatID:   "chat-1",
+					Content:  "hello",
+				})
+				if err != nil {
+					t.Fatalf("processMessage failed: %v", err)
+				}
+				return response
+			}
+
+			for i := 0; i < 2; i++ {
+				if got := send("alice"); got != "done" {
+					t.Fatalf("message %d = %q, want an answer within the budget", i+1, got)
+				}
+			}
+			calls := provider.calls
+			if got := send("alice"); !strings.Contains(got, "daily usage limit") {
+				t.Errorf("response over budget = %q, want the limit message", got)
+			}
+			if provider.calls != calls {
+				t.Errorf("provider was called %d times over budget", provider.calls-calls)
+			}
+			if got := send("bob"); got != "done" {
+				t.Errorf("other user's response = %q, want an answer", got)
+			}
+
+			// Before the reset time the budget still applies, after it it is restored
+			now = time.Date(2026, 3, 2, 3, 59, 0, 0, time.UTC)
+			if got := send("alice"); !strings.Contains(got, "resets at 04:00") {
+				t.Errorf("response before reset = %q, want the limit message", got)
+			}
+			now = time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC)
+			if got := send("alice"); got != "done" {
+				t.Errorf("response after reset = %q, want an answer", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// messageToolProvider sends its reply through the message tool.
+type messageToolProvider struct {
+	calls int
+}
+
+func (p *messageToolProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call_1",
+				Type:      "function",
+				Name:      "message",
+				Arguments: map[string]any{"content": "from the tool"},
+			}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *messageToolProvider) GetDefaultModel() string {
+	return "message-model"
+}
+
+func TestAgentLoop_ThreadFromInboundMetadata(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &messageToolProvider{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	// The thread is only reported in metadata, as some channels do
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel:  "slack",
+		SenderID: "u1",
+		ChatID:   "C1",
+		Content:  "reply in the thread",
+		Metadata: map[string]string{"thread_id": "171.5", "peer_kind": "group", "peer_id": "C1"},
+	})
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	out, ok := msgBus.SubscribeOutbound(waitCtx)
+	if !ok {
+		t.Fatal("no outbound message")
+	}
+	if out.Content != "from the tool" {
+		t.Fatalf("Content = %q, want the message tool's message", out.Content)
+	}
+	if out.ChatID != "C1" || out.ThreadID != "171.5" {
+		t.Errorf("sent to %s thread %q, want C1 thread 171.5", out.ChatID, out.ThreadID)
+	}
+}
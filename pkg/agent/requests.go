@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// requestRegistry tracks the cancel function of the request in progress
+// for each session, so a request can be aborted from outside the goroutine
+// processing it. Sessions of one chat, e.g. per-user sessions in a group,
+// run at once and are registered side by side.
+type requestRegistry struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[string]activeRequest // session key -> request
+}
+
+type activeRequest struct {
+	id     uint64
+	chat   string // requestKey of the chat the request came from
+	cancel context.CancelFunc
+}
+
+func newRequestRegistry() *requestRegistry {
+	return &requestRegistry{active: make(map[string]activeRequest)}
+}
+
+// requestKey identifies the chat a request belongs to.
+func requestKey(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+// start registers a request of sessionKey, from chat, and returns its
+// context, derived from ctx, and a function to call when the request is
+// done. done unregisters the request, unless a newer request of the session
+// replaced it, and releases the context.
+func (r *requestRegistry) start(ctx context.Context, sessionKey, chat string) (context.Context, func()) {
+	reqCtx, cancel := context.WithCancel(ctx)
+
+	r.mu.Lock()
+	r.nextID++
+	id := r.nextID
+	r.active[sessionKey] = activeRequest{id: id, chat: chat, cancel: cancel}
+	r.mu.Unlock()
+
+	return reqCtx, func() {
+		r.mu.Lock()
+		if req, ok := r.active[sessionKey]; ok && req.id == id {
+			delete(r.active, sessionKey)
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel aborts every request in progress from chat and reports whether
+// there was one. The requests stay registered until they are done.
+func (r *requestRegistry) cancel(chat string) bool {
+	var cancels []context.CancelFunc
+	r.mu.Lock()
+	for _, req := range r.active {
+		if req.chat == chat {
+			cancels = append(cancels, req.cancel)
+		}
+	}
+	r.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels) > 0
+}
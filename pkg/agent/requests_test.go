@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRequestRegistry_Lifecycle(t *testing.T) {
+	r := newRequestRegistry()
+	key := requestKey("telegram", "42")
+	session := "agent:main:telegram:42"
+
+	if r.cancel(key) {
+		t.Error("cancel reported a request before any started")
+	}
+
+	ctx, done := r.start(context.Background(), session, key)
+	if !r.cancel(key) {
+		t.Fatal("cancel found no request in progress")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("request context error = %v, want context.Canceled", ctx.Err())
+	}
+
+	done()
+	if r.cancel(key) {
+		t.Error("cancel reported a request after it was done")
+	}
+
+	// A finished request does not unregister the newer one of the same session
+	_, doneOld := r.start(context.Background(), session, key)
+	newCtx, doneNew := r.start(context.Background(), session, key)
+	doneOld()
+	if !r.cancel(key) || newCtx.Err() == nil {
+		t.Error("newer request was unregistered when the older one finished")
+	}
+	doneNew()
+
+	// done releases the context even if nobody cancelled it
+	ctx, done = r.start(context.Background(), session, key)
+	done()
+	if ctx.Err() == nil {
+		t.Error("request context still live after done")
+	}
+}
+
+func TestRequestRegistry_SessionsOfOneChat(t *testing.T) {
+	r := newRequestRegistry()
+	group := requestKey("telegram", "-100")
+
+	// Two users of a group chat, each in a session of their own, and
+	// another chat
+	aliceCtx, doneAlice := r.start(context.Background(), "agent:main:alice", group)
+	bobCtx, doneBob := r.start(context.Background(), "agent:main:bob", group)
+	otherCtx, doneOther := r.start(context.Background(), "agent:main:carol", requestKey("telegram", "7"))
+	defer doneOther()
+
+	// Bob's request finishing leaves alice's registered
+	doneBob()
+	if bobCtx.Err() == nil {
+		t.Error("bob's request context still live after done")
+	}
+	if !r.cancel(group) || aliceCtx.Err() == nil {
+		t.Error("alice's request was unregistered when bob's finished")
+	}
+	doneAlice()
+
+	// Cancelling the chat aborts every request in it, and only those
+	aliceCtx, doneAlice = r.start(context.Background(), "agent:main:alice", group)
+	defer doneAlice()
+	bobCtx, doneBob = r.start(context.Background(), "agent:main:bob", group)
+	defer doneBob()
+	if !r.cancel(group) {
+		t.Fatal("cancel found no request in progress")
+	}
+	if aliceCtx.Err() == nil || bobCtx.Err() == nil {
+		t.Errorf("requests of the chat not cancelled: alice %v, bob %v", aliceCtx.Err(), bobCtx.Err())
+	}
+	if otherCtx.Err() != nil {
+		t.Error("request of another chat was cancelled")
+	}
+}
+
+func TestRequestRegistry_Concurrent(t *testing.T) {
+	r := newRequestRegistry()
+	const chats = 8
+	const requestsPerChat = 50
+
+	var wg sync.WaitGroup
+	for chat := 0; chat < chats; chat++ {
+		key := requestKey("test", fmt.Sprintf("%d", chat))
+		finished := make(chan struct{})
+
+		// Each chat processes its requests one after another, as the loop
+		// does; every other request runs until it is cancelled
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(finished)
+			for i := 0; i < requestsPerChat; i++ {
+				ctx, done := r.start(context.Background(), key, key)
+				if i%2 == 0 {
+					<-ctx.Done()
+				}
+				done()
+			}
+		}()
+
+		// Meanwhile another goroutine keeps cancelling the chat's requests
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-finished:
+					return
+				default:
+					r.cancel(key)
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.active) != 0 {
+		t.Errorf("%d requests still registered after all finished: %v", len(r.active), r.active)
+	}
+}
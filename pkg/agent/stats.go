@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// botStats collects the metrics reported by the Telegram /stats command,
+// summed over all agents. Memory stats come from the default agent.
+func (al *AgentLoop) botStats(ctx context.Context) channels.BotStats {
+	stats := channels.BotStats{
+		Uptime:        time.Since(al.started),
+		SubagentTasks: make(map[string]int),
+	}
+
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		stats.ActiveSessions += agent.Sessions.ActiveSessionCount()
+		if agent.SubagentManager != nil {
+			for status, n := range agent.SubagentManager.TaskCounts() {
+				stats.SubagentTasks[status] += n
+			}
+		}
+	}
+
+	if agent := al.registry.GetDefaultAgent(); agent != nil {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		info, err := agent.Sessions.MemoryStats(ctx)
+		switch {
+		case err != nil:
+			stats.MemoryEnabled = true
+			stats.MemoryStatus = "unavailable: " + err.Error()
+			logger.WarnCF("agent", "Failed to get memory stats", map[string]any{"error": err.Error()})
+		case info != nil:
+			stats.MemoryEnabled = true
+			stats.MemoryMessages = info.PointsCount
+			stats.MemoryStatus = info.Status
+		}
+	}
+	return stats
+}
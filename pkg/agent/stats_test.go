@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAgentLoop_BotStats(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				ContextWindow:     128000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &usageMockProvider{})
+	agent := al.registry.GetDefaultAgent()
+	agent.Sessions.AddMessage("agent:main:a", "user", "hello")
+	agent.Sessions.AddMessage("agent:main:b", "user", "hi")
+
+	stats := al.botStats(context.Background())
+	if stats.ActiveSessions != 2 {
+		t.Errorf("ActiveSessions = %d, want 2", stats.ActiveSessions)
+	}
+	if stats.Uptime <= 0 {
+		t.Errorf("Uptime = %v, want positive", stats.Uptime)
+	}
+	if stats.MemoryEnabled {
+		t.Error("MemoryEnabled = true without Qdrant configured")
+	}
+	if len(stats.SubagentTasks) != 0 {
+		t.Errorf("SubagentTasks = %v, want none", stats.SubagentTasks)
+	}
+	if agent.SubagentManager == nil {
+		t.Error("subagent manager not recorded on the agent")
+	}
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"slices"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// wrapCacheableTools wraps the cacheable tools of every agent so repeated
+// calls with identical arguments are answered from one shared cache, if
+// tools.cache is enabled.
+func wrapCacheableTools(cfg *config.Config, registry *AgentRegistry) {
+	cacheCfg := cfg.Tools.Cache
+	if !cacheCfg.Enabled {
+		return
+	}
+
+	cache := tools.NewToolResultCache(time.Duration(cacheCfg.TTLSeconds)*time.Second, cacheCfg.MaxEntries)
+	var cached []string
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		for _, name := range agent.Tools.List() {
+			tool, ok := agent.Tools.Get(name)
+			if !ok || !tools.IsCacheable(tool) {
+				continue
+			}
+			agent.Tools.Register(cache.Wrap(tool))
+			if !slices.Contains(cached, name) {
+				cached = append(cached, name)
+			}
+		}
+	}
+
+	logger.InfoCF("agent", "Tool result cache enabled", map[string]any{"tools": cached})
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Defaults for config.MessageWorkersConfig
+const (
+	defaultMessageWorkers   = 1
+	defaultMessageQueueSize = 100
+)
+
+// messagePool processes inbound messages on a fixed number of workers.
+// Messages submitted with the same key are handled one at a time, in the
+// order they were submitted. Each key has its own queue and a worker only
+// takes a key that is not being handled, so a busy key never holds a worker
+// that could serve another.
+type messagePool struct {
+	workers   int
+	queueSize int
+	pending   atomic.Int32 // messages queued or being handled
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	work    *sync.Cond // signalled when a key becomes ready or the pool stops
+	space   *sync.Cond // signalled when a queued message is taken
+	queues  map[string][]bus.InboundMessage
+	ready   []string // keys with queued messages and no worker, oldest first
+	queued  int      // messages in queues
+	closed  bool     // no more submits; workers drain the queues
+	stopped bool     // the workers' ctx is cancelled; queued messages are dropped
+}
+
+// newMessagePool creates a pool; zero or negative sizes use the defaults.
+func newMessagePool(workers, queueSize int) *messagePool {
+	if workers <= 0 {
+		workers = defaultMessageWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultMessageQueueSize
+	}
+	p := &messagePool{
+		workers:   workers,
+		queueSize: queueSize,
+		queues:    make(map[string][]bus.InboundMessage),
+	}
+	p.work = sync.NewCond(&p.mu)
+	p.space = sync.NewCond(&p.mu)
+	return p
+}
+
+// start runs the workers, which call handle for each message until ctx is
+// cancelled or the pool is closed. Messages still queued when ctx is
+// cancelled are dropped unhandled.
+func (p *messagePool) start(ctx context.Context, handle func(ctx context.Context, key string, msg bus.InboundMessage)) {
+	context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+		p.work.Broadcast()
+		p.space.Broadcast()
+	})
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				key, msg, ok := p.next()
+				if !ok {
+					return
+				}
+				handle(ctx, key, msg)
+				p.done(key)
+			}
+		}()
+	}
+}
+
+// next waits for a ready key and takes its oldest message. It returns false
+// once the pool is stopped, or closed with nothing left to handle.
+func (p *messagePool) next() (string, bus.InboundMessage, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ready) == 0 && !p.stopped && !p.closed {
+		p.work.Wait()
+	}
+	if p.stopped || len(p.ready) == 0 {
+		return "", bus.InboundMessage{}, false
+	}
+
+	key := p.ready[0]
+	p.ready = p.ready[1:]
+	msg := p.queues[key][0]
+	p.queues[key] = p.queues[key][1:]
+	p.queued--
+	p.space.Signal()
+	return key, msg, true
+}
+
+// done finishes the message being handled for key: the key is ready again
+// if more of its messages are queued.
+func (p *messagePool) done(key string) {
+	p.mu.Lock()
+	if len(p.queues[key]) > 0 {
+		p.ready = append(p.ready, key)
+		p.work.Signal()
+	} else {
+		delete(p.queues, key)
+	}
+	p.mu.Unlock()
+	p.pending.Add(-1)
+}
+
+// busy reports whether a message submitted now would wait because every
+// worker is occupied.
+func (p *messagePool) busy() bool {
+	return int(p.pending.Load()) >= p.workers
+}
+
+// submit queues msg, blocking while the queue is full. It returns false if
+// ctx is cancelled or the pool stops first.
+func (p *messagePool) submit(ctx context.Context, key string, msg bus.InboundMessage) bool {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.mu.Unlock()
+		p.space.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.queued >= p.queueSize && !p.stopped && ctx.Err() == nil {
+		p.space.Wait()
+	}
+	if p.stopped || ctx.Err() != nil {
+		return false
+	}
+
+	// A key with a map entry is queued or being handled; its worker makes
+	// it ready again when done
+	queue, active := p.queues[key]
+	p.queues[key] = append(queue, msg)
+	p.queued++
+	p.pending.Add(1)
+	if !active {
+		p.ready = append(p.ready, key)
+		p.work.Signal()
+	}
+	return true
+}
+
+// close stops accepting messages and waits for the workers to finish the
+// queued ones. It must not be called concurrently with submit.
+func (p *messagePool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.work.Broadcast()
+	p.wg.Wait()
+}
@@ -0,0 +1,272 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// concurrencyProbe records how many handlers run at once.
+type concurrencyProbe struct {
+	active  atomic.Int32
+	maxSeen atomic.Int32
+	handled sync.WaitGroup
+}
+
+func (p *concurrencyProbe) handle(ctx context.Context, key string, msg bus.InboundMessage) {
+	defer p.handled.Done()
+	n := p.active.Add(1)
+	for {
+		seen := p.maxSeen.Load()
+		if n <= seen || p.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	p.active.Add(-1)
+}
+
+func TestMessagePool_LimitsConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probe := &concurrencyProbe{}
+	pool := newMessagePool(3, 2)
+	pool.start(ctx, probe.handle)
+
+	probe.handled.Add(12)
+	for i := 0; i < 12; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		if !pool.submit(ctx, key, bus.InboundMessage{ChatID: key}) {
+			t.Fatalf("submit %d failed", i)
+		}
+	}
+	probe.handled.Wait()
+	pool.close()
+
+	if got := probe.maxSeen.Load(); got != 3 {
+		t.Errorf("at most %d messages ran at once, want 3", got)
+	}
+}
+
+func TestMessagePool_SameKeyInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var order []string
+	probe := &concurrencyProbe{}
+	pool := newMessagePool(4, 0)
+	pool.start(ctx, func(ctx context.Context, key string, msg bus.InboundMessage) {
+		mu.Lock()
+		order = append(order, msg.Content)
+		mu.Unlock()
+		probe.handle(ctx, key, msg)
+	})
+
+	probe.handled.Add(5)
+	for i := 0; i < 5; i++ {
+		pool.submit(ctx, "main", bus.InboundMessage{Content: fmt.Sprint(i)})
+	}
+	probe.handled.Wait()
+	pool.close()
+
+	if got := probe.maxSeen.Load(); got != 1 {
+		t.Errorf("%d messages of one session ran at once, want 1", got)
+	}
+	if fmt.Sprint(order) != "[0 1 2 3 4]" {
+		t.Errorf("handled in order %v, want submission order", order)
+	}
+}
+
+func TestMessagePool_SlowKeyDoesNotBlockOthers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	pool := newMessagePool(2, 0)
+	pool.start(ctx, func(ctx context.Context, key string, msg bus.InboundMessage) {
+		if key == "slow" {
+			<-release
+		}
+		handled <- key + ":" + msg.Content
+	})
+
+	// Two messages of the slow session queue behind each other, taking one
+	// worker; the other keeps serving the fast sessions
+	pool.submit(ctx, "slow", bus.InboundMessage{Content: "0"})
+	pool.submit(ctx, "slow", bus.InboundMessage{Content: "1"})
+	for i := 0; i < 3; i++ {
+		pool.submit(ctx, fmt.Sprintf("fast-%d", i), bus.InboundMessage{Content: "0"})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case got := <-handled:
+			if got[:4] != "fast" {
+				t.Fatalf("handled %s before the slow session was released", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast sessions waited for the slow one; %d handled", i)
+		}
+	}
+
+	close(release)
+	if got := <-handled; got != "slow:0" {
+		t.Errorf("handled %s, want slow:0", got)
+	}
+	if got := <-handled; got != "slow:1" {
+		t.Errorf("handled %s, want slow:1", got)
+	}
+	pool.close()
+}
+
+// gatedProvider answers every call once release is closed.
+type gatedProvider struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (p *gatedProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.once.Do(func() { close(p.started) })
+	<-p.release
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *gatedProvider) GetDefaultModel() string {
+	return "gated-model"
+}
+
+func TestAgentLoop_BusyMessage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+				MessageWorkers:    config.MessageWorkersConfig{Count: 1, BusyMessage: "High load, please wait."},
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &gatedProvider{started: make(chan struct{}), release: make(chan struct{})}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "u1", ChatID: "1", Content: "first"})
+	select {
+	case <-provider.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first message did not reach the provider")
+	}
+
+	// The only worker is busy, so the second user is told to wait
+	msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: "u2", ChatID: "2", Content: "second"})
+	outCtx, outCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer outCancel()
+	out, ok := msgBus.SubscribeOutbound(outCtx)
+	if !ok || out.ChatID != "2" || out.Content != "High load, please wait." {
+		t.Fatalf("outbound = %+v (ok=%v), want the busy message for chat 2", out, ok)
+	}
+
+	close(provider.release)
+	replies := map[string]bool{}
+	for len(replies) < 2 {
+		out, ok := msgBus.SubscribeOutbound(outCtx)
+		if !ok {
+			t.Fatalf("got replies for %v, want both chats answered", replies)
+		}
+		if out.Content == "done" {
+			replies[out.ChatID] = true
+		}
+	}
+}
+
+// rendezvousProvider answers only once n calls are in progress at the same
+// time.
+type rendezvousProvider struct {
+	arrived sync.WaitGroup
+}
+
+func (p *rendezvousProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.arrived.Done()
+	p.arrived.Wait()
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *rendezvousProvider) GetDefaultModel() string {
+	return "rendezvous-model"
+}
+
+func TestAgentLoop_SessionsOfOneAgentRunConcurrently(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+				MessageWorkers:    config.MessageWorkersConfig{Count: 2},
+			},
+		},
+		Session: config.SessionConfig{DMScope: "per-peer"},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &rendezvousProvider{}
+	provider.arrived.Add(2)
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	// Both chats go to the default agent, each in its own session; neither
+	// reply comes unless both are processed at once
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "telegram", SenderID: "u1", ChatID: "1", Content: "first",
+		Metadata: map[string]string{"peer_kind": "direct"},
+	})
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "telegram", SenderID: "u2", ChatID: "2", Content: "second",
+		Metadata: map[string]string{"peer_kind": "direct"},
+	})
+
+	outCtx, outCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer outCancel()
+	replies := map[string]bool{}
+	for len(replies) < 2 {
+		out, ok := msgBus.SubscribeOutbound(outCtx)
+		if !ok {
+			t.Fatalf("got replies for %v, want both chats answered at once", replies)
+		}
+		if out.Content == "done" {
+			replies[out.ChatID] = true
+		}
+	}
+}
@@ -3,14 +3,25 @@ package bus
 import (
 	"context"
 	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
+// dedupeWindow is how long a DedupeKey is remembered.
+const dedupeWindow = 10 * time.Minute
+
 type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
 	handlers map[string]MessageHandler
 	closed   bool
 	mu       sync.RWMutex
+
+	dedupeMu sync.Mutex
+	seenKeys map[string]time.Time
+
+	inboundLog *InboundLog // nil unless inbound persistence is enabled
 }
 
 func NewMessageBus() *MessageBus {
@@ -18,6 +29,7 @@ func NewMessageBus() *MessageBus {
 		inbound:  make(chan InboundMessage, 100),
 		outbound: make(chan OutboundMessage, 100),
 		handlers: make(map[string]MessageHandler),
+		seenKeys: make(map[string]time.Time),
 	}
 }
 
@@ -27,9 +39,135 @@ func (mb *MessageBus) PublishInbound(msg InboundMessage) {
 	if mb.closed {
 		return
 	}
+	if msg.DedupeKey != "" && mb.isDuplicate(msg.DedupeKey) {
+		return
+	}
+	// A thread reported only in metadata is carried as the message's thread,
+	// so replies and the message tool default to it
+	if msg.ThreadID == "" && msg.Metadata["thread_id"] != "" {
+		msg.ThreadID = msg.Metadata["thread_id"]
+	}
+	if mb.inboundLog != nil {
+		id, err := mb.inboundLog.Append(msg)
+		if err != nil {
+			logger.WarnCF("bus", "Failed to log inbound message", map[string]any{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		}
+		msg.LogID = id
+	}
 	mb.inbound <- msg
 }
 
+// SetInboundLog makes the bus record every inbound message in log until it
+// is acknowledged with AckInbound.
+func (mb *MessageBus) SetInboundLog(log *InboundLog) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.inboundLog = log
+}
+
+// LogInbound records msg in the inbound log without queueing it, for a
+// message a channel holds back before publishing it. It returns the log ID
+// to acknowledge the entry with, or "" if no log is set or writing failed.
+func (mb *MessageBus) LogInbound(msg InboundMessage) string {
+	mb.mu.RLock()
+	log := mb.inboundLog
+	mb.mu.RUnlock()
+	if log == nil {
+		return ""
+	}
+	id, err := log.Append(msg)
+	if err != nil {
+		logger.WarnCF("bus", "Failed to log inbound message", map[string]any{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"error":   err.Error(),
+		})
+	}
+	return id
+}
+
+// AckInbound removes a handled message from the inbound log.
+func (mb *MessageBus) AckInbound(msg InboundMessage) {
+	mb.mu.RLock()
+	log := mb.inboundLog
+	mb.mu.RUnlock()
+	if log == nil || msg.LogID == "" {
+		return
+	}
+	if err := log.Ack(msg.LogID); err != nil {
+		logger.WarnCF("bus", "Failed to acknowledge inbound message", map[string]any{
+			"log_id": msg.LogID,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// ReplayInbound queues the messages a previous run left unacknowledged in
+// the inbound log and returns how many there are.
+func (mb *MessageBus) ReplayInbound() int {
+	mb.mu.RLock()
+	log := mb.inboundLog
+	mb.mu.RUnlock()
+	if log == nil {
+		return 0
+	}
+
+	replay, dropped, err := log.Pending()
+	if err != nil {
+		logger.WarnCF("bus", "Failed to update inbound log", map[string]any{"error": err.Error()})
+	}
+	for _, msg := range dropped {
+		logger.WarnCF("bus", "Dropping inbound message replayed too many times", map[string]any{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"log_id":  msg.LogID,
+		})
+	}
+	for _, msg := range replay {
+		// Drop the same message if the channel delivers it again
+		if msg.DedupeKey != "" {
+			mb.isDuplicate(msg.DedupeKey)
+		}
+	}
+
+	// The inbound buffer may be smaller than the backlog and nothing is
+	// consuming yet, so queue in the background.
+	go func() {
+		for _, msg := range replay {
+			mb.mu.RLock()
+			if !mb.closed {
+				mb.inbound <- msg
+			}
+			mb.mu.RUnlock()
+		}
+	}()
+	return len(replay)
+}
+
+// isDuplicate records key and reports whether it was already seen within
+// dedupeWindow. Expired keys are pruned on the way.
+func (mb *MessageBus) isDuplicate(key string) bool {
+	mb.dedupeMu.Lock()
+	defer mb.dedupeMu.Unlock()
+
+	now := time.Now()
+	for k, seen := range mb.seenKeys {
+		if now.Sub(seen) > dedupeWindow {
+			delete(mb.seenKeys, k)
+		}
+	}
+
+	if _, ok := mb.seenKeys[key]; ok {
+		return true
+	}
+	mb.seenKeys[key] = now
+	return false
+}
+
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
 	select {
 	case msg := <-mb.inbound:
@@ -0,0 +1,175 @@
+package bus
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func consumeAll(mb *MessageBus) []InboundMessage {
+	var msgs []InboundMessage
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		msg, ok := mb.ConsumeInbound(ctx)
+		cancel()
+		if !ok {
+			return msgs
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestPublishInbound_DedupeKey(t *testing.T) {
+	mb := NewMessageBus()
+
+	mb.PublishInbound(InboundMessage{Channel: "system", Content: "first", DedupeKey: "task-1"})
+	mb.PublishInbound(InboundMessage{Channel: "system", Content: "again", DedupeKey: "task-1"})
+	mb.PublishInbound(InboundMessage{Channel: "system", Content: "other", DedupeKey: "task-2"})
+
+	msgs := consumeAll(mb)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	if msgs[0].Content != "first" || msgs[1].Content != "other" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+}
+
+func TestPublishInbound_NoDedupeKey(t *testing.T) {
+	mb := NewMessageBus()
+
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "hi"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "hi"})
+
+	if msgs := consumeAll(mb); len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+}
+
+// newLoggedBus returns a bus backed by the inbound log at path, as after a
+// (re)start of the gateway.
+func newLoggedBus(t *testing.T, path string) *MessageBus {
+	t.Helper()
+	log, err := OpenInboundLog(path)
+	if err != nil {
+		t.Fatalf("OpenInboundLog failed: %v", err)
+	}
+	mb := NewMessageBus()
+	mb.SetInboundLog(log)
+	return mb
+}
+
+func TestInboundLog_ReplaysUnackedAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "inbound.json")
+
+	mb := newLoggedBus(t, path)
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "42", Content: "handled"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "42", Content: "in flight", DedupeKey: "telegram:42:7"})
+
+	msgs := consumeAll(mb)
+	if len(msgs) != 2 || msgs[0].LogID == "" {
+		t.Fatalf("got %+v, want 2 logged messages", msgs)
+	}
+	mb.AckInbound(msgs[0])
+	// Crash: the second message is never acknowledged
+
+	restarted := newLoggedBus(t, path)
+	if n := restarted.ReplayInbound(); n != 1 {
+		t.Fatalf("ReplayInbound() = %d, want 1", n)
+	}
+	replayed := consumeAll(restarted)
+	if len(replayed) != 1 || replayed[0].Content != "in flight" || replayed[0].LogID != msgs[1].LogID {
+		t.Fatalf("replayed %+v, want the unacknowledged message", replayed)
+	}
+
+	// Telegram delivering the same update again is dropped
+	restarted.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "42", Content: "in flight", DedupeKey: "telegram:42:7"})
+	if dup := consumeAll(restarted); len(dup) != 0 {
+		t.Errorf("redelivered message was not dropped: %+v", dup)
+	}
+
+	restarted.AckInbound(replayed[0])
+	if n := newLoggedBus(t, path).ReplayInbound(); n != 0 {
+		t.Errorf("ReplayInbound() after ack = %d, want 0", n)
+	}
+}
+
+func TestLogInbound_RecordsWithoutQueueing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbound.json")
+
+	mb := newLoggedBus(t, path)
+	id := mb.LogInbound(InboundMessage{Channel: "telegram", ChatID: "42", Content: "album item"})
+	if id == "" {
+		t.Fatal("LogInbound() returned no log ID")
+	}
+	if msgs := consumeAll(mb); len(msgs) != 0 {
+		t.Fatalf("LogInbound queued %+v, want nothing", msgs)
+	}
+
+	// A crash before the item is published replays it
+	restarted := newLoggedBus(t, path)
+	if n := restarted.ReplayInbound(); n != 1 {
+		t.Fatalf("ReplayInbound() = %d, want 1", n)
+	}
+	if replayed := consumeAll(restarted); len(replayed) != 1 || replayed[0].Content != "album item" {
+		t.Fatalf("replayed %+v, want the logged item", replayed)
+	}
+
+	restarted.AckInbound(InboundMessage{LogID: id})
+	if n := newLoggedBus(t, path).ReplayInbound(); n != 0 {
+		t.Errorf("ReplayInbound() after ack = %d, want 0", n)
+	}
+
+	if id := NewMessageBus().LogInbound(InboundMessage{Content: "x"}); id != "" {
+		t.Errorf("LogInbound() without a log = %q, want empty", id)
+	}
+}
+
+func TestInboundLog_DropsAfterMaxReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbound.json")
+
+	mb := newLoggedBus(t, path)
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "42", Content: "crashes every time"})
+
+	for i := 0; i < maxInboundReplays; i++ {
+		mb = newLoggedBus(t, path)
+		if n := mb.ReplayInbound(); n != 1 {
+			t.Fatalf("replay %d: ReplayInbound() = %d, want 1", i+1, n)
+		}
+		consumeAll(mb)
+	}
+
+	log, err := OpenInboundLog(path)
+	if err != nil {
+		t.Fatalf("OpenInboundLog failed: %v", err)
+	}
+	replay, dropped, err := log.Pending()
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if len(replay) != 0 || len(dropped) != 1 {
+		t.Errorf("Pending() = %d replayed, %d dropped; want 0 and 1", len(replay), len(dropped))
+	}
+	if log.Len() != 0 {
+		t.Errorf("log still holds %d messages", log.Len())
+	}
+}
+
+func TestPublishInbound_ThreadFromMetadata(t *testing.T) {
+	mb := NewMessageBus()
+
+	mb.PublishInbound(InboundMessage{Channel: "slack", Content: "a", Metadata: map[string]string{"thread_id": "171.5"}})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "b", ThreadID: "7", Metadata: map[string]string{"thread_id": "9"}})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "c"})
+
+	msgs := consumeAll(mb)
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(msgs))
+	}
+	for i, want := range []string{"171.5", "7", ""} {
+		if msgs[i].ThreadID != want {
+			t.Errorf("message %q: ThreadID = %q, want %q", msgs[i].Content, msgs[i].ThreadID, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxInboundReplays is how many times a logged message is replayed before it
+// is dropped, so a message that crashes the process does not crash it again
+// on every restart.
+const maxInboundReplays = 3
+
+// InboundLog is a write-ahead log of inbound messages. Messages are written
+// to disk when published and removed once the agent has handled them, so
+// messages still in flight when the process dies can be replayed on restart.
+type InboundLog struct {
+	path    string
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]*inboundLogEntry
+}
+
+type inboundLogEntry struct {
+	ID      string         `json:"id"`
+	Seq     int            `json:"seq"`
+	Replays int            `json:"replays"`
+	Message InboundMessage `json:"message"`
+}
+
+// OpenInboundLog opens the log at path, loading any messages that were not
+// acknowledged before the last shutdown.
+func OpenInboundLog(path string) (*InboundLog, error) {
+	l := &InboundLog{
+		path:    path,
+		pending: make(map[string]*inboundLogEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inbound log: %w", err)
+	}
+
+	var entries []*inboundLogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse inbound log: %w", err)
+	}
+	for _, e := range entries {
+		l.pending[e.ID] = e
+		if e.Seq >= l.nextID {
+			l.nextID = e.Seq + 1
+		}
+	}
+	return l, nil
+}
+
+// Append records msg and returns the ID to acknowledge it with.
+func (l *InboundLog) Append(msg InboundMessage) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq := l.nextID
+	l.nextID++
+	id := strconv.Itoa(seq)
+	msg.LogID = id
+	l.pending[id] = &inboundLogEntry{ID: id, Seq: seq, Message: msg}
+
+	if err := l.save(); err != nil {
+		delete(l.pending, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Ack removes the message with the given ID from the log.
+func (l *InboundLog) Ack(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.pending[id]; !ok {
+		return nil
+	}
+	delete(l.pending, id)
+	return l.save()
+}
+
+// Pending returns the unacknowledged messages in the order they were
+// received and counts a replay for each. Messages that were already replayed
+// maxInboundReplays times are removed and returned as dropped.
+func (l *InboundLog) Pending() (replay []InboundMessage, dropped []InboundMessage, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.sortedEntries() {
+		if e.Replays >= maxInboundReplays {
+			delete(l.pending, e.ID)
+			dropped = append(dropped, e.Message)
+			continue
+		}
+		e.Replays++
+		replay = append(replay, e.Message)
+	}
+	if len(replay) == 0 && len(dropped) == 0 {
+		return nil, nil, nil
+	}
+	return replay, dropped, l.save()
+}
+
+// Len returns the number of unacknowledged messages.
+func (l *InboundLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending)
+}
+
+func (l *InboundLog) sortedEntries() []*inboundLogEntry {
+	entries := make([]*inboundLogEntry, 0, len(l.pending))
+	for _, e := range l.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries
+}
+
+// save writes the pending messages to a temp file, syncs it and renames it
+// over the log, so a crash leaves either the old or the new log.
+//
+// Must be called with the lock held.
+func (l *InboundLog) save() error {
+	data, err := json.Marshal(l.sortedEntries())
+	if err != nil {
+		return fmt.Errorf("failed to marshal inbound log: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(l.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write inbound log: %w", err)
+	}
+	return nil
+}
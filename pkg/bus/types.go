@@ -8,8 +8,16 @@ type InboundMessage struct {
 	Content    string            `json:"content"`
 	Media      []string          `json:"media,omitempty"`      // Image paths for vision
 	Files      []string          `json:"files,omitempty"`      // File paths for read_file tool
+	// Audio lists audio files to pass to models that accept audio input
+	Audio      []string          `json:"audio,omitempty"`
 	SessionKey string            `json:"session_key"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	// DedupeKey, when set, makes the bus drop later messages with the same key
+	// (see dedupeWindow). Used for announcements that must be delivered once.
+	DedupeKey string `json:"dedupe_key,omitempty"`
+	// LogID identifies the message in the inbound log, if one is set on the
+	// bus. Pass the message to AckInbound once it has been handled.
+	LogID string `json:"log_id,omitempty"`
 }
 
 type OutboundMessage struct {
@@ -18,6 +26,19 @@ type OutboundMessage struct {
 	ThreadID string `json:"thread_id,omitempty"`
 	Content  string `json:"content"`
 	Files    []string `json:"files,omitempty"`    // File paths for download
+	// Buttons are shown as an inline keyboard by channels that support it
+	// (Telegram). Pressing a button sends its Data back as a user message.
+	Buttons []OutboundButton `json:"buttons,omitempty"`
+	// ReplyTo is the "message_id" metadata of the inbound message this
+	// answers. It is empty for messages not answering one, such as
+	// announcements, message tool sends and error reports.
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// OutboundButton is a button attached to an outbound message.
+type OutboundButton struct {
+	Text string `json:"text"`
+	Data string `json:"data"`
 }
 
 type MessageHandler func(InboundMessage) error
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 )
 
 type Channel interface {
@@ -14,6 +15,19 @@ type Channel interface {
 	Send(ctx context.Context, msg bus.OutboundMessage) error
 	IsRunning() bool
 	IsAllowed(senderID string) bool
+	// MaxMessageLength returns the longest message the platform accepts, in
+	// bytes, or 0 if there is no limit. Longer messages are split on send.
+	MaxMessageLength() int
+}
+
+// ChannelPresence is implemented by channels that can show the user that the
+// agent is working on a reply, such as Telegram's "typing..." indicator.
+// BaseChannel provides no-op methods for channels without one.
+type ChannelPresence interface {
+	// StartTyping shows the indicator in chatID (and threadID, if the
+	// platform has threads) until StopTyping is called.
+	StartTyping(ctx context.Context, chatID, threadID string) error
+	StopTyping(chatID string)
 }
 
 type BaseChannel struct {
@@ -38,6 +52,19 @@ func (c *BaseChannel) Name() string {
 	return c.name
 }
 
+// MaxMessageLength returns 0 (no limit); channels with a limit override it.
+func (c *BaseChannel) MaxMessageLength() int {
+	return 0
+}
+
+// StartTyping does nothing; channels with a typing indicator override it.
+func (c *BaseChannel) StartTyping(ctx context.Context, chatID, threadID string) error {
+	return nil
+}
+
+// StopTyping does nothing; channels with a typing indicator override it.
+func (c *BaseChannel) StopTyping(chatID string) {}
+
 func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
@@ -82,17 +109,21 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 }
 
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string, threadID ...string) {
-	if !c.IsAllowed(senderID) {
-		return
-	}
+	c.HandleMessageOnce("", senderID, chatID, content, media, metadata, threadID...)
+}
 
+// HandleMessageOnce is like HandleMessage, but the bus drops the message if
+// one with the same dedupeKey was published recently, e.g. when the
+// platform delivers an update again that was already replayed from the
+// inbound log after a restart.
+func (c *BaseChannel) HandleMessageOnce(dedupeKey, senderID, chatID, content string, media []string, metadata map[string]string, threadID ...string) {
 	msg := bus.InboundMessage{
-		Channel:  c.name,
-		SenderID: senderID,
-		ChatID:   chatID,
-		Content:  content,
-		Media:    media,
-		Metadata: metadata,
+		SenderID:  senderID,
+		ChatID:    chatID,
+		Content:   content,
+		Media:     media,
+		Metadata:  metadata,
+		DedupeKey: dedupeKey,
 	}
 
 	// Add thread ID if provided
@@ -100,9 +131,31 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 		msg.ThreadID = threadID[0]
 	}
 
+	c.HandleInbound(msg)
+}
+
+// HandleInbound publishes msg as a message received on this channel if its
+// sender is allowed. It is for messages that need fields HandleMessage does
+// not take, such as Audio.
+func (c *BaseChannel) HandleInbound(msg bus.InboundMessage) {
+	if !c.IsAllowed(msg.SenderID) {
+		return
+	}
+	msg.Channel = c.name
+	metrics.MessagesReceived.Inc(c.name)
 	c.bus.PublishInbound(msg)
 }
 
+// LogInbound records msg in the bus's inbound log without publishing it,
+// for a message the channel holds back, such as an album item waiting for
+// the rest of the album. Should the process stop first, the message is
+// replayed on restart. It returns the ID to acknowledge the entry with once
+// the message is published some other way.
+func (c *BaseChannel) LogInbound(msg bus.InboundMessage) string {
+	msg.Channel = c.name
+	return c.bus.LogInbound(msg)
+}
+
 func (c *BaseChannel) setRunning(running bool) {
 	c.running = running
 }
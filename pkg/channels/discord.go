@@ -126,7 +126,7 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return nil
 	}
 
-	chunks := utils.SplitMessage(msg.Content, 2000) // Split messages into chunks, Discord length limit: 2000 chars
+	chunks := utils.SplitMessage(msg.Content, c.MaxMessageLength())
 
 	for _, chunk := range chunks {
 		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
@@ -137,6 +137,14 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	return nil
 }
 
+// discordMaxMessageLength is Discord's message length limit (2000 chars).
+const discordMaxMessageLength = 2000
+
+// MaxMessageLength returns Discord's message length limit.
+func (c *DiscordChannel) MaxMessageLength() int {
+	return discordMaxMessageLength
+}
+
 func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
 	// Use the passed ctx for timeout control
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
@@ -236,7 +244,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 				var transcribedText string
 				if c.transcriber != nil && c.transcriber.IsAvailable() {
 					ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
-					result, err := c.transcriber.Transcribe(ctx, localPath)
+					result, err := c.transcriber.Transcribe(ctx, localPath, "")
 					cancel() // Release context resources immediately to avoid leaks in for loop
 
 					if err != nil {
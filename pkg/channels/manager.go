@@ -15,6 +15,8 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
+	"github.com/sipeed/picoclaw/pkg/moderation"
 )
 
 type Manager struct {
@@ -22,6 +24,7 @@ type Manager struct {
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	moderation   *moderation.Filter // nil unless moderation is enabled
 	mu           sync.RWMutex
 }
 
@@ -30,10 +33,16 @@ type asyncTask struct {
 }
 
 func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error) {
+	filter, err := moderation.New(cfg.Moderation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up moderation: %w", err)
+	}
+
 	m := &Manager{
-		channels: make(map[string]Channel),
-		bus:      messageBus,
-		config:   cfg,
+		channels:   make(map[string]Channel),
+		bus:        messageBus,
+		config:     cfg,
+		moderation: filter,
 	}
 
 	if err := m.initChannels(); err != nil {
@@ -298,7 +307,10 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
+			msg.Content = m.moderation.Outbound(ctx, msg.Channel, msg.ChatID, msg.Content)
+			err := channel.Send(ctx, msg)
+			metrics.MessagesSent.Inc(msg.Channel, metrics.Status(err))
+			if err != nil {
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]any{
 					"channel": msg.Channel,
 					"error":   err.Error(),
@@ -364,7 +376,7 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 	msg := bus.OutboundMessage{
 		Channel: channelName,
 		ChatID:  chatID,
-		Content: content,
+		Content: m.moderation.Outbound(ctx, channelName, chatID, content),
 	}
 
 	return channel.Send(ctx, msg)
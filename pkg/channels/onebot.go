@@ -662,7 +662,7 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 						localFiles = append(localFiles, localPath)
 						if c.transcriber != nil && c.transcriber.IsAvailable() {
 							tctx, tcancel := context.WithTimeout(c.ctx, 30*time.Second)
-							result, err := c.transcriber.Transcribe(tctx, localPath)
+							result, err := c.transcriber.Transcribe(tctx, localPath, "")
 							tcancel()
 							if err != nil {
 								logger.WarnCF("onebot", "Voice transcription failed", map[string]any{
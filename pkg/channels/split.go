@@ -0,0 +1,61 @@
+package channels
+
+import "strings"
+
+// splitLongMessage splits a long message into parts of at most maxLen bytes,
+// for channels whose MaxMessageLength is smaller than the message.
+// Tries to split at reasonable break points (double newline or period + space).
+// A maxLen of 0 or less means no limit.
+func splitLongMessage(content string, maxLen int) []string {
+	if maxLen <= 0 || len(content) <= maxLen {
+		return []string{content}
+	}
+
+	var parts []string
+	remaining := content
+
+	for len(remaining) > 0 {
+		var part string
+		if len(remaining) > maxLen {
+			// Try to find a good break point in the last part of the message
+			lookahead := remaining[:maxLen]
+
+			// Priority 1: Double newline (paragraph break) - look backwards from the end
+			lastDoubleNewline := strings.LastIndex(lookahead, "\n\n")
+			if lastDoubleNewline > 0 {
+				part = remaining[:lastDoubleNewline]
+				remaining = remaining[lastDoubleNewline:]
+			} else {
+				// Priority 2: Last sentence ending (period + space)
+				lastSentenceEnd := strings.LastIndex(lookahead, ". ")
+				if lastSentenceEnd > 0 {
+					part = remaining[:lastSentenceEnd+1]
+					remaining = remaining[lastSentenceEnd+1:]
+				} else {
+					// Priority 3: Last sentence ending (period)
+					lastPeriod := strings.LastIndex(lookahead, ".")
+					if lastPeriod > 0 {
+						part = remaining[:lastPeriod]
+						remaining = remaining[lastPeriod:]
+					} else {
+						// Fallback: Hard split at limit
+						part = remaining[:maxLen]
+						remaining = remaining[maxLen:]
+					}
+				}
+			}
+		} else {
+			// Remaining content fits in one message
+			part = remaining
+			remaining = ""
+		}
+
+		// Trim whitespace from part and add if non-empty
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,64 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitLongMessage_CustomLimit(t *testing.T) {
+	paragraph := strings.TrimSpace(strings.Repeat("word ", 15)) // 74 bytes
+	content := paragraph + "\n\n" + paragraph + "\n\n" + paragraph
+
+	parts := splitLongMessage(content, 100)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3: %q", len(parts), parts)
+	}
+	for i, part := range parts {
+		if len(part) > 100 {
+			t.Errorf("part %d is %d bytes, over the limit", i, len(part))
+		}
+		if part != paragraph {
+			t.Errorf("part %d = %q, want the paragraph", i, part)
+		}
+	}
+}
+
+func TestSplitLongMessage_SentenceAndHardSplit(t *testing.T) {
+	sentences := "First sentence here. Second sentence here. Third one."
+	parts := splitLongMessage(sentences, 30)
+	if len(parts) < 2 || parts[0] != "First sentence here." {
+		t.Errorf("parts = %q, want a split after the first sentence", parts)
+	}
+
+	noBreaks := strings.Repeat("x", 250)
+	parts = splitLongMessage(noBreaks, 100)
+	if len(parts) != 3 || len(parts[0]) != 100 || len(parts[2]) != 50 {
+		t.Errorf("hard split gave %d parts, want 100+100+50 bytes", len(parts))
+	}
+	if strings.Join(parts, "") != noBreaks {
+		t.Error("hard split lost content")
+	}
+}
+
+func TestSplitLongMessage_NoLimit(t *testing.T) {
+	content := strings.Repeat("a", 10000)
+	if parts := splitLongMessage(content, 0); len(parts) != 1 || parts[0] != content {
+		t.Errorf("got %d parts with no limit, want 1", len(parts))
+	}
+}
+
+func TestChannel_MaxMessageLength(t *testing.T) {
+	tests := []struct {
+		channel Channel
+		want    int
+	}{
+		{&TelegramChannel{BaseChannel: &BaseChannel{}}, 4096},
+		{&DiscordChannel{BaseChannel: &BaseChannel{}}, 2000},
+		{&SlackChannel{BaseChannel: &BaseChannel{}}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.channel.MaxMessageLength(); got != tt.want {
+			t.Errorf("%T.MaxMessageLength() = %d, want %d", tt.channel, got, tt.want)
+		}
+	}
+}
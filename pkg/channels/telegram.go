@@ -3,17 +3,22 @@ package channels
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
 	"github.com/mymmrac/telego/telegohandler"
 	th "github.com/mymmrac/telego/telegohandler"
 	tu "github.com/mymmrac/telego/telegoutil"
@@ -31,9 +36,15 @@ type TelegramChannel struct {
 	commands     TelegramCommander
 	config       *config.Config
 	chatIDs      map[string]int64
-	transcriber  *voice.GroqTranscriber
+	transcriber  voice.Transcriber
+	synthesizer  voice.Synthesizer
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	voiceNotes   sync.Map // voiceNoteKey -> time.Time received, voice notes awaiting their reply
+	mediaGroups  mediaGroupBuffer
+	// businessConnections maps chatID to the business connection the chat's
+	// last message came through; replies must be sent through it
+	businessConnections sync.Map
 }
 
 type thinkingCancel struct {
@@ -47,9 +58,45 @@ func (c *thinkingCancel) Cancel() {
 }
 
 func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChannel, error) {
-	var opts []telego.BotOption
 	telegramCfg := cfg.Channels.Telegram
 
+	opts, err := telegramBotOptions(telegramCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	bot, err := telego.NewBot(telegramCfg.Token, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
+	}
+
+	base := NewBaseChannel("telegram", telegramCfg, bus, telegramCfg.AllowFrom)
+
+	return &TelegramChannel{
+		BaseChannel:  base,
+		commands:     NewTelegramCommands(bot, cfg),
+		bot:          bot,
+		config:       cfg,
+		chatIDs:      make(map[string]int64),
+		transcriber:  nil,
+		placeholders: sync.Map{},
+		stopThinking: sync.Map{},
+	}, nil
+}
+
+// telegramBotOptions builds the telego options for the configured proxy and
+// Bot API server.
+func telegramBotOptions(telegramCfg config.TelegramConfig) ([]telego.BotOption, error) {
+	var opts []telego.BotOption
+
+	if apiServer := strings.TrimRight(strings.TrimSpace(telegramCfg.APIServer), "/"); apiServer != "" {
+		serverURL, parseErr := url.Parse(apiServer)
+		if parseErr != nil || serverURL.Scheme == "" || serverURL.Host == "" {
+			return nil, fmt.Errorf("invalid API server URL %q", telegramCfg.APIServer)
+		}
+		opts = append(opts, telego.WithAPIServer(apiServer))
+	}
+
 	if telegramCfg.Proxy != "" {
 		proxyURL, parseErr := url.Parse(telegramCfg.Proxy)
 		if parseErr != nil {
@@ -69,29 +116,33 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 		}))
 	}
 
-	bot, err := telego.NewBot(telegramCfg.Token, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
-	}
+	return opts, nil
+}
 
-	base := NewBaseChannel("telegram", telegramCfg, bus, telegramCfg.AllowFrom)
+// SetStatsSource provides the metrics reported by the /stats command.
+func (c *TelegramChannel) SetStatsSource(source StatsSource) {
+	if commands, ok := c.commands.(*cmd); ok {
+		commands.stats = source
+	}
+}
 
-	return &TelegramChannel{
-		BaseChannel:  base,
-		commands:     NewTelegramCommands(bot, cfg),
-		bot:          bot,
-		config:       cfg,
-		chatIDs:      make(map[string]int64),
-		transcriber:  nil,
-		placeholders: sync.Map{},
-		stopThinking: sync.Map{},
-	}, nil
+// SetRequestCanceler provides what the /cancel command uses to abort a
+// chat's request in progress.
+func (c *TelegramChannel) SetRequestCanceler(canceler RequestCanceler) {
+	if commands, ok := c.commands.(*cmd); ok {
+		commands.cancel = canceler
+	}
 }
 
-func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+func (c *TelegramChannel) SetTranscriber(transcriber voice.Transcriber) {
 	c.transcriber = transcriber
 }
 
+// SetSynthesizer enables spoken replies according to channels.telegram.voice_reply.
+func (c *TelegramChannel) SetSynthesizer(synthesizer voice.Synthesizer) {
+	c.synthesizer = synthesizer
+}
+
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
@@ -123,10 +174,31 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.commands.List(ctx, message)
 	}, th.CommandEqual("list"))
 
+	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
+		return c.commands.Stats(ctx, message)
+	}, th.CommandEqual("stats"))
+
+	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
+		// Only allowed users may stop someone's request
+		if message.From == nil || !c.IsAllowed(telegramSenderID(message.From)) {
+			return nil
+		}
+		return c.commands.Cancel(ctx, message)
+	}, th.CommandEqual("cancel"))
+
 	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	// Messages to a business account the bot is connected to
+	bh.HandleBusinessMessage(func(ctx *th.Context, message telego.Message) error {
+		return c.handleMessage(ctx, &message)
+	}, th.AnyBusinessMessage())
+
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, &query)
+	}, th.AnyCallbackQueryWithMessage())
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]any{
 		"username": c.bot.Username(),
@@ -145,99 +217,124 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
 	c.setRunning(false)
+	// Publish albums still waiting for more items rather than drop them
+	c.mediaGroups.flushAll()
 	return nil
 }
 
-// splitLongMessage splits a long message into multiple parts
-// Tries to split at reasonable break points (double newline or period + space)
-const MAX_TELEGRAM_MESSAGE_LENGTH = 4096
+// typingRefreshInterval is how often the typing indicator is re-sent;
+// Telegram clears it after about 5 seconds.
+const typingRefreshInterval = 4 * time.Second
 
-func splitLongMessage(content string) []string {
-	if len(content) <= MAX_TELEGRAM_MESSAGE_LENGTH {
-		return []string{content}
+// maxTypingDuration bounds how long the indicator is kept up if StopTyping
+// is never called.
+const maxTypingDuration = 5 * time.Minute
+
+// StartTyping shows "typing..." in the chat, in the given forum topic if
+// threadID is set, until StopTyping is called or a reply is sent.
+func (c *TelegramChannel) StartTyping(ctx context.Context, chatID, threadID string) error {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	params := &telego.SendChatActionParams{
+		ChatID: tu.ID(id),
+		Action: telego.ChatActionTyping,
+	}
+	params.BusinessConnectionID = c.businessConnectionID(chatID)
+	if threadID != "" {
+		if params.MessageThreadID, err = strconv.Atoi(threadID); err != nil {
+			return fmt.Errorf("invalid thread ID: %w", err)
+		}
 	}
 
-	var parts []string
-	remaining := content
+	if err := c.bot.SendChatAction(ctx, params); err != nil {
+		return fmt.Errorf("failed to send chat action: %w", err)
+	}
 
-	for len(remaining) > 0 {
-		var part string
-		if len(remaining) > MAX_TELEGRAM_MESSAGE_LENGTH {
-			// Try to find a good break point in the last part of the message
-			lookahead := remaining[:MAX_TELEGRAM_MESSAGE_LENGTH]
+	typingCtx, cancel := context.WithTimeout(context.Background(), maxTypingDuration)
+	if prev, loaded := c.stopThinking.Swap(chatID, &thinkingCancel{fn: cancel}); loaded {
+		if cf, ok := prev.(*thinkingCancel); ok {
+			cf.Cancel()
+		}
+	}
 
-			// Priority 1: Double newline (paragraph break) - look backwards from the end
-			lastDoubleNewline := strings.LastIndex(lookahead, "\n\n")
-			if lastDoubleNewline > 0 {
-				part = remaining[:lastDoubleNewline]
-				remaining = remaining[lastDoubleNewline:]
-			} else {
-				// Priority 2: Last sentence ending (period + space)
-				lastSentenceEnd := strings.LastIndex(lookahead, ". ")
-				if lastSentenceEnd > 0 {
-					part = remaining[:lastSentenceEnd+1]
-					remaining = remaining[lastSentenceEnd+1:]
-				} else {
-					// Priority 3: Last sentence ending (period)
-					lastPeriod := strings.LastIndex(lookahead, ".")
-					if lastPeriod > 0 {
-						part = remaining[:lastPeriod]
-						remaining = remaining[lastPeriod:]
-					} else {
-						// Fallback: Hard split at limit
-						part = remaining[:MAX_TELEGRAM_MESSAGE_LENGTH]
-						remaining = remaining[MAX_TELEGRAM_MESSAGE_LENGTH:]
-					}
+	go func() {
+		ticker := time.NewTicker(typingRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-typingCtx.Done():
+				return
+			case <-ticker.C:
+				if err := c.bot.SendChatAction(typingCtx, params); err != nil && typingCtx.Err() == nil {
+					logger.DebugCF("telegram", "Failed to refresh typing indicator", map[string]any{
+						"chat_id": chatID,
+						"error":   err.Error(),
+					})
 				}
 			}
-		} else {
-			// Remaining content fits in one message
-			part = remaining
-			remaining = ""
 		}
+	}()
+	return nil
+}
+
+// businessConnectionID returns the business connection replies to chatID
+// must be sent through, or "" for a regular chat.
+func (c *TelegramChannel) businessConnectionID(chatID string) string {
+	if id, ok := c.businessConnections.Load(chatID); ok {
+		return id.(string)
+	}
+	return ""
+}
 
-		// Trim whitespace from part and add if non-empty
-		part = strings.TrimSpace(part)
-		if part != "" {
-			parts = append(parts, part)
+// StopTyping stops the typing indicator started by StartTyping.
+func (c *TelegramChannel) StopTyping(chatID string) {
+	if stop, ok := c.stopThinking.LoadAndDelete(chatID); ok {
+		if cf, ok := stop.(*thinkingCancel); ok {
+			cf.Cancel()
 		}
 	}
+}
 
-	return parts
+// MAX_TELEGRAM_MESSAGE_LENGTH is the longest text Telegram accepts in one message.
+const MAX_TELEGRAM_MESSAGE_LENGTH = 4096
+
+// MaxMessageLength returns Telegram's message length limit.
+func (c *TelegramChannel) MaxMessageLength() int {
+	return MAX_TELEGRAM_MESSAGE_LENGTH
 }
 
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	_, err := c.SendWithResult(ctx, msg)
+	return err
+}
+
+// SendWithResult sends msg like Send and returns the Telegram message IDs of
+// the delivered parts, in order. Long messages are split into several parts;
+// parts that fail to send are logged and omitted from the result. When the
+// reply replaces the "Thinking..." placeholder, the placeholder's ID is returned.
+func (c *TelegramChannel) SendWithResult(ctx context.Context, msg bus.OutboundMessage) ([]int, error) {
 	if !c.IsRunning() {
-		return fmt.Errorf("telegram bot not running")
+		return nil, fmt.Errorf("telegram bot not running")
 	}
 
 	chatID, err := parseChatID(msg.ChatID)
 	if err != nil {
-		return fmt.Errorf("invalid chat ID: %w", err)
+		return nil, fmt.Errorf("invalid chat ID: %w", err)
 	}
 
-	// Stop thinking animation
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-		c.stopThinking.Delete(msg.ChatID)
-	}
+	c.StopTyping(msg.ChatID)
+	businessConnectionID := c.businessConnectionID(msg.ChatID)
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
-
-	// Split message if exceeds Telegram limit (4096 characters)
-	var messageParts []string
-	if len(htmlContent) > MAX_TELEGRAM_MESSAGE_LENGTH {
-		messageParts = splitLongMessage(htmlContent)
+	messageParts := c.renderMessageParts(msg.Content)
+	if len(messageParts) > 1 {
 		logger.WarnCF("telegram", "Long message split into parts",
 			map[string]any{
-				"original_len": len(htmlContent),
+				"original_len": len(msg.Content),
 				"parts_count":  len(messageParts),
 				"chat_id":      msg.ChatID,
 			})
-	} else {
-		messageParts = []string{htmlContent}
 	}
 
 	// If thread_id is specified, skip placeholder editing and send directly to thread
@@ -246,11 +343,17 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		// Try to edit placeholder (only for messages without thread_id and single part)
 		if pID, ok := c.placeholders.Load(msg.ChatID); ok {
 			c.placeholders.Delete(msg.ChatID)
-			editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), messageParts[0])
-			editMsg.ParseMode = telego.ModeHTML
+			editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), messageParts[0].Text)
+			if messageParts[0].UseEntities {
+				editMsg.Entities = messageParts[0].Entities
+			} else {
+				editMsg.ParseMode = telego.ModeHTML
+			}
+			editMsg.ReplyMarkup = inlineKeyboard(msg.Buttons)
+			editMsg.BusinessConnectionID = businessConnectionID
 
 			if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
-				return nil
+				return []int{pID.(int)}, nil
 			}
 			// Fallback to new message if edit fails
 		}
@@ -265,22 +368,60 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		fmt.Sscanf(msg.ThreadID, "%d", &threadIDInt)
 	}
 
+	messageIDs := make([]int, 0, len(messageParts))
 	for i, part := range messageParts {
-		tgMsg := tu.Message(tu.ID(chatID), part)
-		tgMsg.ParseMode = telego.ModeHTML
+		tgMsg := tu.Message(tu.ID(chatID), part.Text)
+		tgMsg.BusinessConnectionID = businessConnectionID
+		if part.UseEntities {
+			tgMsg.Entities = part.Entities
+		} else {
+			tgMsg.ParseMode = telego.ModeHTML
+		}
 
 		// Add thread ID if specified
 		if threadIDInt != 0 {
 			tgMsg.MessageThreadID = threadIDInt
 		}
 
-		if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+		// Chain parts into a thread, each replying to the one before
+		if len(messageIDs) > 0 && c.threadSplitReplies() {
+			tgMsg.ReplyParameters = &telego.ReplyParameters{
+				MessageID:                messageIDs[len(messageIDs)-1],
+				AllowSendingWithoutReply: true,
+			}
+		}
+
+		// Buttons go below the last part
+		if i == len(messageParts)-1 {
+			if keyboard := inlineKeyboard(msg.Buttons); keyboard != nil {
+				tgMsg.ReplyMarkup = keyboard
+			}
+		}
+
+		sent, err := c.bot.SendMessage(ctx, tgMsg)
+		if err != nil && isParseEntitiesError(err) {
+			// Rather than lose the reply to broken formatting, send it unformatted
+			logger.WarnCF("telegram", "Telegram rejected formatting, resending as plain text",
+				map[string]any{
+					"part":  i + 1,
+					"error": err.Error(),
+				})
+			if !part.UseEntities {
+				tgMsg.Text = htmlToPlainText(part.Text)
+			}
+			tgMsg.ParseMode = ""
+			tgMsg.Entities = nil
+			sent, err = c.bot.SendMessage(ctx, tgMsg)
+		}
+		if err != nil {
 			logger.ErrorCF("telegram", "Failed to send message part",
 				map[string]any{
 					"part":       i + 1,
 					"total_parts": len(messageParts),
 					"error":      err.Error(),
 				})
+		} else {
+			messageIDs = append(messageIDs, sent.MessageID)
 		}
 
 		// Delay between parts (except last)
@@ -289,9 +430,264 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		}
 	}
 
+	if c.shouldReplyWithVoice(msg) {
+		if err := c.sendVoiceReply(ctx, chatID, threadIDInt, msg.Content); err != nil {
+			logger.ErrorCF("telegram", "Failed to send voice reply", map[string]any{
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	return messageIDs, nil
+}
+
+// threadSplitReplies reports whether parts of a split reply are chained as
+// replies to each other.
+func (c *TelegramChannel) threadSplitReplies() bool {
+	return c.config != nil && c.config.Channels.Telegram.ThreadSplitReplies
+}
+
+// DeleteMessage deletes a previously sent message, e.g. a transient status
+// message returned by SendWithResult. A message that is already gone or can
+// no longer be deleted (Telegram limits deletion to 48 hours) is not an error.
+func (c *TelegramChannel) DeleteMessage(ctx context.Context, chatID string, messageID int) error {
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	err = c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(id), messageID))
+	if err != nil && isIgnorableDeleteError(err) {
+		logger.DebugCF("telegram", "Message already deleted or not deletable", map[string]any{
+			"chat_id":    chatID,
+			"message_id": messageID,
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	return err
+}
+
+// isIgnorableDeleteError reports whether a deleteMessage failure means there
+// is nothing left to delete.
+func isIgnorableDeleteError(err error) bool {
+	var apiErr *telegoapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	description := strings.ToLower(apiErr.Description)
+	return strings.Contains(description, "message to delete not found") ||
+		strings.Contains(description, "message can't be deleted")
+}
+
+// isParseEntitiesError reports whether Telegram rejected a message because
+// its HTML or entities could not be parsed.
+func isParseEntitiesError(err error) bool {
+	var apiErr *telegoapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Description), "can't parse entities")
+}
+
+// inlineKeyboard renders buttons as a single inline keyboard row, or nil if
+// there are none.
+func inlineKeyboard(buttons []bus.OutboundButton) *telego.InlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+	row := make([]telego.InlineKeyboardButton, 0, len(buttons))
+	for _, b := range buttons {
+		row = append(row, tu.InlineKeyboardButton(b.Text).WithCallbackData(b.Data))
+	}
+	return tu.InlineKeyboard(row)
+}
+
+// handleCallbackQuery turns an inline keyboard button press into a user
+// message carrying the button's data, so a "/approve <id>" button behaves
+// exactly like the typed command. The keyboard is removed so the same
+// button cannot be pressed twice.
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query *telego.CallbackQuery) error {
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.WarnCF("telegram", "Failed to answer callback query", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	if query.Message == nil || query.Data == "" {
+		return nil
+	}
+
+	chat := query.Message.GetChat()
+	if _, err := c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:    tu.ID(chat.ID),
+		MessageID: query.Message.GetMessageID(),
+	}); err != nil {
+		logger.DebugCF("telegram", "Failed to remove inline keyboard", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	user := query.From
+	peerKind := "direct"
+	peerID := fmt.Sprintf("%d", user.ID)
+	if chat.Type != "private" {
+		peerKind = "group"
+		peerID = fmt.Sprintf("%d", chat.ID)
+	}
+
+	metadata := map[string]string{
+		"callback_query_id": query.ID,
+		"user_id":           fmt.Sprintf("%d", user.ID),
+		"username":          user.Username,
+		"first_name":        user.FirstName,
+		"is_group":          fmt.Sprintf("%t", chat.Type != "private"),
+		"peer_kind":         peerKind,
+		"peer_id":           peerID,
+	}
+
+	var threadID string
+	if message := query.Message.Message(); message != nil && message.MessageThreadID != 0 {
+		threadID = fmt.Sprintf("%d", message.MessageThreadID)
+		metadata["thread_id"] = threadID
+	}
+
+	logger.DebugCF("telegram", "Received callback query", map[string]any{
+		"sender_id": user.ID,
+		"chat_id":   chat.ID,
+		"data":      query.Data,
+	})
+
+	// The sender ID is built like that of typed messages, so an approval
+	// bound to the requesting user accepts the button
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chat.ID), query.Data, nil, metadata, threadID)
+	return nil
+}
+
+// shouldReplyWithVoice reports whether a voice note should follow the text
+// of msg. Only replies to a user's message are spoken; with the "voice"
+// trigger, only replies to a voice note.
+func (c *TelegramChannel) shouldReplyWithVoice(msg bus.OutboundMessage) bool {
+	if msg.ReplyTo == "" {
+		return false
+	}
+	_, voiceNote := c.voiceNotes.LoadAndDelete(voiceNoteKey(msg.ChatID, msg.ReplyTo))
+	if c.synthesizer == nil || c.config == nil || !c.config.Channels.Telegram.VoiceReply.Enabled {
+		return false
+	}
+	return voiceNote || c.config.Channels.Telegram.VoiceReply.Trigger == "always"
+}
+
+// voiceNoteTTL is how long a voice note waits for its reply; notes whose
+// handling failed are never answered and are forgotten after it.
+const voiceNoteTTL = time.Hour
+
+// voiceNoteKey identifies an inbound voice note in voiceNotes.
+func voiceNoteKey(chatID, messageID string) string {
+	return chatID + "/" + messageID
+}
+
+// rememberVoiceNote records an inbound voice note so its reply is spoken,
+// dropping notes older than voiceNoteTTL.
+func (c *TelegramChannel) rememberVoiceNote(chatID, messageID string) {
+	now := time.Now()
+	c.voiceNotes.Range(func(key, received any) bool {
+		if now.Sub(received.(time.Time)) > voiceNoteTTL {
+			c.voiceNotes.Delete(key)
+		}
+		return true
+	})
+	c.voiceNotes.Store(voiceNoteKey(chatID, messageID), now)
+}
+
+// sendVoiceReply synthesizes content and sends it as a voice note.
+// The synthesized temp file is removed once it has been sent.
+func (c *TelegramChannel) sendVoiceReply(ctx context.Context, chatID int64, threadID int, content string) error {
+	// Speak the rendered text, not the markdown markers
+	text, _ := markdownToTelegramEntities(content)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	audioPath, err := c.synthesizer.Synthesize(ctx, text)
+	if err != nil {
+		return fmt.Errorf("speech synthesis failed: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(audioPath); err != nil {
+			logger.DebugCF("telegram", "Failed to cleanup temp file", map[string]any{
+				"file":  audioPath,
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	audioFile, err := os.Open(audioPath)
+	if err != nil {
+		return fmt.Errorf("failed to open synthesized audio: %w", err)
+	}
+	defer audioFile.Close()
+
+	params := tu.Voice(tu.ID(chatID), tu.File(audioFile))
+	params.BusinessConnectionID = c.businessConnectionID(fmt.Sprintf("%d", chatID))
+	if threadID != 0 {
+		params.MessageThreadID = threadID
+	}
+	if _, err := c.bot.SendVoice(ctx, params); err != nil {
+		return fmt.Errorf("failed to send voice: %w", err)
+	}
 	return nil
 }
 
+// telegramMessagePart is a single outgoing Telegram message, either HTML
+// (sent with parse_mode=HTML) or plain text with explicit entities.
+type telegramMessagePart struct {
+	Text        string
+	Entities    []telego.MessageEntity
+	UseEntities bool
+}
+
+// renderMessageParts converts markdown content into one or more Telegram
+// message parts according to the configured format mode.
+func (c *TelegramChannel) renderMessageParts(content string) []telegramMessagePart {
+	formatMode := TelegramFormatHTML
+	if c.config != nil && c.config.Channels.Telegram.FormatMode != "" {
+		formatMode = c.config.Channels.Telegram.FormatMode
+	}
+
+	if formatMode == TelegramFormatEntities {
+		// Split the markdown source first so entity offsets stay local to each part
+		chunks := []string{content}
+		if len(content) > c.MaxMessageLength() {
+			chunks = splitLongMessage(content, c.MaxMessageLength())
+		}
+		parts := make([]telegramMessagePart, 0, len(chunks))
+		for _, chunk := range chunks {
+			text, entities := markdownToTelegramEntities(chunk)
+			parts = append(parts, telegramMessagePart{
+				Text:        text,
+				Entities:    entities,
+				UseEntities: true,
+			})
+		}
+		return parts
+	}
+
+	htmlContent := markdownToTelegramHTML(content)
+
+	// Split message if exceeds Telegram limit (4096 characters)
+	chunks := []string{htmlContent}
+	if len(htmlContent) > c.MaxMessageLength() {
+		chunks = splitLongMessage(htmlContent, c.MaxMessageLength())
+	}
+	parts := make([]telegramMessagePart, 0, len(chunks))
+	for _, chunk := range chunks {
+		parts = append(parts, telegramMessagePart{Text: chunk})
+	}
+	return parts
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -302,10 +698,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		return fmt.Errorf("message sender (user) is nil")
 	}
 
-	senderID := fmt.Sprintf("%d", user.ID)
-	if user.Username != "" {
-		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
-	}
+	senderID := telegramSenderID(user)
 
 	// check allowlist to avoid downloading attachments for rejected users
 	if !c.IsAllowed(senderID) {
@@ -315,13 +708,22 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		return nil
 	}
 
+	if c.ignoredForMentionOnly(message) {
+		logger.DebugCF("telegram", "Group message ignored - bot not mentioned", map[string]any{
+			"user_id": senderID,
+			"chat_id": message.Chat.ID,
+		})
+		return nil
+	}
+
 	chatID := message.Chat.ID
 	c.chatIDs[senderID] = chatID
 
 	content := ""
 	mediaPaths := []string{}
-	localFiles := []string{} // track local files that need cleanup
+	localFiles := []string{}          // track local files that need cleanup
 	workspaceMediaPaths := []string{} // media files copied to workspace (persistent)
+	var audioPaths []string           // voice notes forwarded as audio input
 
 	// ensure temp files are cleaned up when function returns
 	defer func() {
@@ -365,6 +767,24 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		}
 	}
 
+	// Replies to a business account's chat go through its connection; the
+	// same chat may also talk to the bot directly, so a plain message resets it
+	if message.BusinessConnectionID != "" {
+		c.businessConnections.Store(fmt.Sprintf("%d", chatID), message.BusinessConnectionID)
+	} else {
+		c.businessConnections.Delete(fmt.Sprintf("%d", chatID))
+	}
+
+	// Remember that the user spoke so the reply to this message is spoken too
+	if message.Voice != nil {
+		c.rememberVoiceNote(fmt.Sprintf("%d", chatID), fmt.Sprintf("%d", message.MessageID))
+	}
+
+	transcriberAvailable := c.transcriber != nil && c.transcriber.IsAvailable()
+	if message.Voice != nil && !transcriberAvailable && c.voiceFallback() == VoiceFallbackReply {
+		return c.replyVoiceUnavailable(ctx, message)
+	}
+
 	if message.Voice != nil {
 		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
 		if voicePath != "" {
@@ -372,11 +792,11 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 			mediaPaths = append(mediaPaths, voicePath)
 
 			var transcribedText string
-			if c.transcriber != nil && c.transcriber.IsAvailable() {
+			if transcriberAvailable {
 				transcriberCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 				defer cancel()
 
-				result, err := c.transcriber.Transcribe(transcriberCtx, voicePath)
+				result, err := c.transcriber.Transcribe(transcriberCtx, voicePath, transcriptionLanguage(user))
 				if err != nil {
 					logger.ErrorCF("telegram", "Voice transcription failed", map[string]any{
 						"error": err.Error(),
@@ -384,12 +804,17 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 					})
 					transcribedText = fmt.Sprintf("[voice (transcription failed)] [file_id: %s]", message.Voice.FileID)
 				} else {
-					transcribedText = fmt.Sprintf("[voice transcription: %s] [file_id: %s]", result.Text, message.Voice.FileID)
+					transcribedText = c.formatTranscription(result.Text, message.Voice.FileID)
 					logger.InfoCF("telegram", "Voice transcribed successfully", map[string]any{
 						"text": result.Text,
 					})
 				}
 			} else {
+				if c.voiceFallback() == VoiceFallbackForward {
+					if audioPath := c.copyMediaToWorkspace(voicePath, "voice", ".ogg"); audioPath != "" {
+						audioPaths = append(audioPaths, audioPath)
+					}
+				}
 				transcribedText = fmt.Sprintf("[voice] [file_id: %s]", message.Voice.FileID)
 			}
 
@@ -441,7 +866,19 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		}
 	}
 
-	if content == "" {
+	if strings.TrimSpace(content) == "" {
+		// Album items are combined later, so only lone messages are dropped
+		if mode := c.emptyMessages(); mode != EmptyMessagesPlaceholder && message.MediaGroupID == "" {
+			logger.DebugCF("telegram", "Dropping empty message", map[string]any{
+				"sender_id": senderID,
+				"chat_id":   fmt.Sprintf("%d", chatID),
+				"mode":      mode,
+			})
+			if mode == EmptyMessagesReply {
+				return c.replyEmptyMessage(ctx, message)
+			}
+			return nil
+		}
 		content = "[empty message]"
 	}
 
@@ -451,65 +888,46 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		"preview":   utils.Truncate(content, 50),
 	})
 
-	// Extract thread ID early
-	threadID := ""
-	threadIDInt := 0
-	if message.MessageThreadID != 0 {
-		threadID = fmt.Sprintf("%d", message.MessageThreadID)
-		threadIDInt = message.MessageThreadID
-	}
-
-	// Send typing indicator
-	// For threads (thread_id > 1): use SendChatActionParams with MessageThreadID
-	// For main chat of forum groups (thread_id=1): use SendChatActionParams with MessageThreadID=1
-	// For DM: use simple SendChatAction
-	if threadIDInt != 0 {
-		// For threads, use SendChatActionParams with MessageThreadID
-		params := &telego.SendChatActionParams{
-			ChatID:          tu.ID(chatID),
-			Action:          telego.ChatActionTyping,
-			MessageThreadID: threadIDInt,
-		}
-		if err := c.bot.SendChatAction(ctx, params); err != nil {
-			logger.ErrorCF("telegram", "Failed to send chat action (thread mode)", map[string]any{
-				"error": err.Error(),
-			})
-		}
-	} else if message.Chat.Type != "private" {
-		// For main chat of forum groups, try with MessageThreadID=1
-		params := &telego.SendChatActionParams{
-			ChatID:          tu.ID(chatID),
-			Action:          telego.ChatActionTyping,
-			MessageThreadID: 1, // Special ID for main chat in forum groups
-		}
-		if err := c.bot.SendChatAction(ctx, params); err != nil {
-			logger.ErrorCF("telegram", "Failed to send chat action (forum main chat)", map[string]any{
-				"error": err.Error(),
-			})
-		}
-	} else {
-		// For DM, use simple SendChatAction
-		err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
-		if err != nil {
-			logger.ErrorCF("telegram", "Failed to send chat action (DM)", map[string]any{
-				"error": err.Error(),
-			})
-		}
+	// Albums arrive as one message per item; wait for the rest of the album
+	if message.MediaGroupID != "" {
+		key := fmt.Sprintf("%d:%s", chatID, message.MediaGroupID)
+		part := mediaGroupPart{message: message, content: content, media: workspaceMediaPaths}
+		// Log the item until the album is published, so a crash within the
+		// window replays it rather than losing it
+		part.logID = c.LogInbound(c.inboundMessage(message, content, workspaceMediaPaths, nil))
+		c.mediaGroups.add(key, part, c.publishMediaGroup)
+		return nil
 	}
 
-	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
-	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
-		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
+	c.publishMessage(message, content, workspaceMediaPaths, audioPaths)
+	return nil
+}
+
+// publishMediaGroup publishes the items of an album as a single message.
+func (c *TelegramChannel) publishMediaGroup(parts []mediaGroupPart) {
+	content, media := combineMediaGroup(parts)
+	c.publishMessage(parts[0].message, content, media, nil)
+	// The album is in the inbound log now; its items no longer need to be
+	for _, part := range parts {
+		c.bus.AckInbound(bus.InboundMessage{LogID: part.logID})
 	}
+}
 
-	// Create cancel function for thinking state
-	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
-	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
+// publishMessage publishes the inbound message built from message.
+func (c *TelegramChannel) publishMessage(message *telego.Message, content string, workspaceMediaPaths, audioPaths []string) {
+	c.HandleInbound(c.inboundMessage(message, content, workspaceMediaPaths, audioPaths))
+}
+
+// inboundMessage builds the bus message for a Telegram message.
+func (c *TelegramChannel) inboundMessage(message *telego.Message, content string, workspaceMediaPaths, audioPaths []string) bus.InboundMessage {
+	user := message.From
+	chatID := message.Chat.ID
+
+	threadID := ""
+	if message.MessageThreadID != 0 {
+		threadID = fmt.Sprintf("%d", message.MessageThreadID)
+	}
 
-	// Note: We don't send "Thinking..." placeholder anymore - native typing indicator is sufficient
 
 	peerKind := "direct"
 	peerID := fmt.Sprintf("%d", user.ID)
@@ -532,11 +950,126 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	if threadID != "" {
 		metadata["thread_id"] = threadID
 	}
+	if message.MediaGroupID != "" {
+		metadata["media_group_id"] = message.MediaGroupID
+	}
+	if message.BusinessConnectionID != "" {
+		metadata["business_connection_id"] = message.BusinessConnectionID
+	}
+
+	// Telegram confirms updates on the next poll, so a crash can bring the
+	// same message back after it was already replayed from the inbound log
+	dedupeKey := fmt.Sprintf("telegram:%d:%d", chatID, message.MessageID)
+	return bus.InboundMessage{
+		SenderID:  fmt.Sprintf("%d", user.ID),
+		ChatID:    fmt.Sprintf("%d", chatID),
+		ThreadID:  threadID,
+		Content:   content,
+		Media:     workspaceMediaPaths,
+		Audio:     audioPaths,
+		Metadata:  metadata,
+		DedupeKey: dedupeKey,
+	}
+}
+
+// Voice fallback modes, see config.TelegramConfig.VoiceFallback
+const (
+	VoiceFallbackPlaceholder = "placeholder"
+	VoiceFallbackReply       = "reply"
+	VoiceFallbackForward     = "forward"
+
+	defaultVoiceFallbackMessage = "I can't listen to voice messages right now. Please type your message instead."
+)
+
+// voiceFallback returns how voice messages are handled without a transcriber.
+func (c *TelegramChannel) voiceFallback() string {
+	if c.config != nil && c.config.Channels.Telegram.VoiceFallback != "" {
+		return c.config.Channels.Telegram.VoiceFallback
+	}
+	return VoiceFallbackPlaceholder
+}
 
-	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, workspaceMediaPaths, metadata, threadID)
+// replyVoiceUnavailable asks the sender of a voice message to type instead.
+// The voice message itself is not passed on.
+func (c *TelegramChannel) replyVoiceUnavailable(ctx context.Context, message *telego.Message) error {
+	text := defaultVoiceFallbackMessage
+	if c.config != nil && c.config.Channels.Telegram.VoiceFallbackMessage != "" {
+		text = c.config.Channels.Telegram.VoiceFallbackMessage
+	}
+	if err := c.replyTo(ctx, message, text); err != nil {
+		return fmt.Errorf("failed to send voice fallback message: %w", err)
+	}
 	return nil
 }
 
+// Empty message modes, see config.TelegramConfig.EmptyMessages
+const (
+	EmptyMessagesPlaceholder = "placeholder"
+	EmptyMessagesIgnore      = "ignore"
+	EmptyMessagesReply       = "reply"
+
+	defaultEmptyMessageReply = "I can only read text, photos, voice messages and files. What would you like to ask?"
+)
+
+// emptyMessages returns how messages without usable content are handled.
+func (c *TelegramChannel) emptyMessages() string {
+	if c.config != nil && c.config.Channels.Telegram.EmptyMessages != "" {
+		return c.config.Channels.Telegram.EmptyMessages
+	}
+	return EmptyMessagesPlaceholder
+}
+
+// replyEmptyMessage asks the sender of an empty message what they need. The
+// message itself is not passed on.
+func (c *TelegramChannel) replyEmptyMessage(ctx context.Context, message *telego.Message) error {
+	text := defaultEmptyMessageReply
+	if c.config != nil && c.config.Channels.Telegram.EmptyMessageReply != "" {
+		text = c.config.Channels.Telegram.EmptyMessageReply
+	}
+	if err := c.replyTo(ctx, message, text); err != nil {
+		return fmt.Errorf("failed to send empty message reply: %w", err)
+	}
+	return nil
+}
+
+// replyTo answers message with text, in its thread and business connection.
+func (c *TelegramChannel) replyTo(ctx context.Context, message *telego.Message, text string) error {
+	params := tu.Message(tu.ID(message.Chat.ID), text)
+	params.MessageThreadID = message.MessageThreadID
+	params.BusinessConnectionID = message.BusinessConnectionID
+	params.ReplyParameters = &telego.ReplyParameters{MessageID: message.MessageID}
+	_, err := c.bot.SendMessage(ctx, params)
+	return err
+}
+
+const (
+	TranscriptionFormatRaw     = "raw"
+	defaultTranscriptionFormat = "[voice transcription: {text}] [file_id: {file_id}]"
+)
+
+// formatTranscription renders transcribed voice text according to
+// channels.telegram.transcription_format.
+func (c *TelegramChannel) formatTranscription(text, fileID string) string {
+	format := defaultTranscriptionFormat
+	if c.config != nil && c.config.Channels.Telegram.TranscriptionFormat != "" {
+		format = c.config.Channels.Telegram.TranscriptionFormat
+	}
+	if format == TranscriptionFormatRaw {
+		return text
+	}
+	return strings.NewReplacer("{text}", text, "{file_id}", fileID).Replace(format)
+}
+
+// transcriptionLanguage derives an ISO-639-1 hint from the user's Telegram
+// language_code (e.g. "pt-br" -> "pt"). Empty means let the transcriber detect it.
+func transcriptionLanguage(user *telego.User) string {
+	if user == nil || user.LanguageCode == "" {
+		return ""
+	}
+	lang, _, _ := strings.Cut(user.LanguageCode, "-")
+	return strings.ToLower(lang)
+}
+
 func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) string {
 	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
 	if err != nil {
@@ -559,9 +1092,48 @@ func (c *TelegramChannel) downloadFileWithInfo(file *telego.File, ext string) st
 
 	// Use FilePath as filename for better identification
 	filename := file.FilePath + ext
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
-		LoggerPrefix: "telegram",
+	result, err := utils.DownloadFileWithResult(url, filename, utils.DownloadOptions{
+		LoggerPrefix:  "telegram",
+		Resume:        true,
+		Progress:      logDownloadProgress(file.FilePath),
+		ExpectedSize:  file.FileSize,
+		ComputeSHA256: true,
+	})
+	if err != nil {
+		logger.ErrorCF("telegram", "Failed to download file", map[string]any{
+			"file_path": file.FilePath,
+			"error":     err.Error(),
+		})
+		return ""
+	}
+
+	logger.DebugCF("telegram", "File downloaded", map[string]any{
+		"file_path": file.FilePath,
+		"size":      result.Size,
+		"sha256":    result.SHA256,
 	})
+	return result.Path
+}
+
+// logDownloadProgress returns a progress callback that logs every 25% of a
+// download whose size is known.
+func logDownloadProgress(filePath string) func(downloaded, total int64) {
+	lastQuarter := int64(-1)
+	return func(downloaded, total int64) {
+		if total <= 0 {
+			return
+		}
+		quarter := downloaded * 4 / total
+		if quarter == lastQuarter {
+			return
+		}
+		lastQuarter = quarter
+		logger.DebugCF("telegram", "File download progress", map[string]any{
+			"file_path":  filePath,
+			"downloaded": downloaded,
+			"total":      total,
+		})
+	}
 }
 
 func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string) string {
@@ -654,6 +1226,15 @@ func generateRandomString(length int) string {
 	return string(result)
 }
 
+// telegramSenderID is the sender ID checked against allow_from: the user ID,
+// followed by "|username" if the user has one.
+func telegramSenderID(user *telego.User) string {
+	if user.Username != "" {
+		return fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	return fmt.Sprintf("%d", user.ID)
+}
+
 func parseChatID(chatIDStr string) (int64, error) {
 	var id int64
 	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
@@ -665,12 +1246,16 @@ func markdownToTelegramHTML(text string) string {
 		return ""
 	}
 
+	text = formatLists(renderMarkdownTables(text))
+
 	codeBlocks := extractCodeBlocks(text)
 	text = codeBlocks.text
 
 	inlineCodes := extractInlineCodes(text)
 	text = inlineCodes.text
 
+	text = markExpandableQuotes(text)
+
 	text = regexp.MustCompile(`^#{1,6}\s+(.+)$`).ReplaceAllString(text, "$1")
 
 	text = regexp.MustCompile(`^>\s*(.*)$`).ReplaceAllString(text, "$1")
@@ -681,15 +1266,18 @@ func markdownToTelegramHTML(text string) string {
 
 	text = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(text, "<b>$1</b>")
 
-	text = regexp.MustCompile(`__(.+?)__`).ReplaceAllString(text, "<b>$1</b>")
-
-	// Italic: manually process to avoid matching identifiers like file_id
-	// Only match _word_ where word is alphabetic and surrounded by whitespace/punctuation
-	text = processItalics(text)
+	// Underscores only count at word edges, so identifiers like file_id stay intact
+	text = replaceUnderscoreSpans(text, "__", "b")
+	text = replaceUnderscoreSpans(text, "_", "i")
 
 	text = regexp.MustCompile(`~~(.+?)~~`).ReplaceAllString(text, "<s>$1</s>")
 
-	text = regexp.MustCompile(`^[-*]\s+`).ReplaceAllString(text, "• ")
+	text = regexp.MustCompile(`\|\|(.+?)\|\|`).ReplaceAllString(text, "<tg-spoiler>$1</tg-spoiler>")
+
+	text = strings.NewReplacer(
+		quoteStartMarker, "<blockquote expandable>",
+		quoteEndMarker, "</blockquote>",
+	).Replace(text)
 
 	for i, code := range inlineCodes.codes {
 		escaped := escapeHTML(code)
@@ -708,59 +1296,107 @@ func markdownToTelegramHTML(text string) string {
 	return text
 }
 
-// processItalics converts _word_ to <i>word</i> but avoids identifiers like file_id
-func processItalics(text string) string {
-	var result strings.Builder
+// Placeholders for the tags of an expandable block quote, so its content
+// goes through the same formatting as the rest of the message.
+const (
+	quoteStartMarker = "\x00EQS\x00"
+	quoteEndMarker   = "\x00EQE\x00"
+)
+
+// markExpandableQuotes replaces expandable block quotes (see
+// parseExpandableQuote) with their lines wrapped in quote markers.
+func markExpandableQuotes(text string) string {
+	if !strings.Contains(text, "**>") {
+		return text
+	}
+
+	var sb strings.Builder
 	i := 0
 	for i < len(text) {
-		// Look for underscore
-		if text[i] == '_' {
-			// Check if preceded by whitespace, start, or certain punctuation
-			canStart := i == 0 || isItalicBoundary(text[i-1])
-			if canStart {
-				// Find closing underscore
-				j := i + 1
-				for j < len(text) && text[j] != '_' && text[j] != ' ' && text[j] != '\n' {
-					j++
-				}
-				// Check if we found a closing underscore and it's followed by boundary
-				if j < len(text) && text[j] == '_' {
-					content := text[i+1 : j]
-					// Only process if content is alphabetic (no underscores/numbers)
-					if len(content) > 0 && isAllAlpha(content) {
-						// Check if followed by boundary
-						nextIdx := j + 1
-						if nextIdx >= len(text) || isItalicBoundary(text[nextIdx]) {
-							result.WriteString("<i>")
-							result.WriteString(content)
-							result.WriteString("</i>")
-							i = nextIdx
-							continue
-						}
-					}
-				}
+		if i == 0 || text[i-1] == '\n' {
+			if lines, n, ok := parseExpandableQuote(text[i:]); ok {
+				sb.WriteString(quoteStartMarker)
+				sb.WriteString(strings.Join(lines, "\n"))
+				sb.WriteString(quoteEndMarker)
+				i += n
+				continue
 			}
 		}
-		result.WriteByte(text[i])
+		sb.WriteByte(text[i])
 		i++
 	}
-	return result.String()
+	return sb.String()
 }
 
-// isItalicBoundary checks if a character is a valid boundary for italic markers
-func isItalicBoundary(c byte) bool {
-	return c == ' ' || c == '\n' || c == '\t' || c == '<' || c == '>' || c == '.' || c == ',' || c == '!' || c == '?' || c == ';' || c == ':'
+// replaceUnderscoreSpans wraps spans delimited by marker ("_" or "__") in
+// tag. As in CommonMark, underscores only delimit emphasis at word edges, so
+// identifiers such as my_var_name or paths like logs/app_error_log stay
+// literal.
+func replaceUnderscoreSpans(text, marker, tag string) string {
+	if !strings.Contains(text, marker) {
+		return text
+	}
+
+	var sb strings.Builder
+	i := 0
+	for i < len(text) {
+		if end, ok := underscoreSpan(text, i, marker); ok {
+			sb.WriteString("<" + tag + ">")
+			sb.WriteString(text[i+len(marker) : end])
+			sb.WriteString("</" + tag + ">")
+			i = end + len(marker)
+			continue
+		}
+		sb.WriteByte(text[i])
+		i++
+	}
+	return sb.String()
 }
 
-// isAllAlpha checks if a string contains only alphabetic characters
-func isAllAlpha(s string) bool {
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
-			return false
+// underscoreSpan reports whether an emphasis span delimited by marker opens
+// at text[i] and returns the index of its closing marker. The span must not
+// be empty or cross a line.
+func underscoreSpan(text string, i int, marker string) (int, bool) {
+	if !strings.HasPrefix(text[i:], marker) || !opensEmphasis(text, i, len(marker)) {
+		return 0, false
+	}
+	for j := i + len(marker) + 1; j+len(marker) <= len(text); j++ {
+		if text[j] == '\n' {
+			return 0, false
+		}
+		if strings.HasPrefix(text[j:], marker) && closesEmphasis(text, j, len(marker)) {
+			return j, true
 		}
 	}
-	return true
+	return 0, false
+}
+
+// opensEmphasis reports whether the n-byte marker at text[i] can open
+// emphasis: it follows a word edge and precedes a non-space character.
+func opensEmphasis(text string, i, n int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i+n:])
+	return (i == 0 || isEmphasisBoundary(before)) &&
+		i+n < len(text) && after != '_' && !unicode.IsSpace(after)
+}
+
+// closesEmphasis reports whether the n-byte marker at text[j] can close
+// emphasis: it follows a non-space character and precedes a word edge.
+func closesEmphasis(text string, j, n int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:j])
+	after, _ := utf8.DecodeRuneInString(text[j+n:])
+	return before != '_' && !unicode.IsSpace(before) &&
+		(j+n == len(text) || isEmphasisBoundary(after))
+}
+
+// isEmphasisBoundary reports whether r separates words for underscore
+// emphasis. Path separators are not boundaries, so dir/_name_ stays literal.
+func isEmphasisBoundary(r rune) bool {
+	switch r {
+	case '_', '/', '\\':
+		return false
+	}
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
 }
 
 type codeBlockMatch struct {
@@ -818,6 +1454,19 @@ func escapeHTML(text string) string {
 	return text
 }
 
+// htmlTagRe matches the tags emitted by markdownToTelegramHTML.
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// htmlToPlainText undoes markdownToTelegramHTML's markup, leaving the text a
+// user would read.
+func htmlToPlainText(text string) string {
+	text = htmlTagRe.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "&lt;", "<")
+	text = strings.ReplaceAll(text, "&gt;", ">")
+	text = strings.ReplaceAll(text, "&amp;", "&")
+	return text
+}
+
 // GetBot returns the Telegram bot instance (for tools to use)
 func (c *TelegramChannel) GetBot() *telego.Bot {
 	return c.bot
@@ -3,7 +3,9 @@ package channels
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/mymmrac/telego"
 
@@ -15,11 +17,35 @@ type TelegramCommander interface {
 	Start(ctx context.Context, message telego.Message) error
 	Show(ctx context.Context, message telego.Message) error
 	List(ctx context.Context, message telego.Message) error
+	Stats(ctx context.Context, message telego.Message) error
+	Cancel(ctx context.Context, message telego.Message) error
 }
 
+// BotStats is a snapshot of the operational metrics reported by /stats.
+type BotStats struct {
+	Uptime         time.Duration
+	ActiveSessions int
+	// SubagentTasks counts subagent tasks by status
+	SubagentTasks map[string]int
+	// MemoryEnabled reports whether long-term memory is configured; the
+	// other Memory fields are only meaningful if it is
+	MemoryEnabled  bool
+	MemoryMessages int64
+	MemoryStatus   string // collection status, or the error getting it
+}
+
+// StatsSource collects the metrics for /stats.
+type StatsSource func(ctx context.Context) BotStats
+
+// RequestCanceler aborts the request in progress for a chat and reports
+// whether there was one.
+type RequestCanceler func(channel, chatID string) bool
+
 type cmd struct {
 	bot    *telego.Bot
 	config *config.Config
+	stats  StatsSource
+	cancel RequestCanceler
 }
 
 func NewTelegramCommands(bot *telego.Bot, cfg *config.Config) TelegramCommander {
@@ -29,12 +55,9 @@ func NewTelegramCommands(bot *telego.Bot, cfg *config.Config) TelegramCommander
 	}
 }
 
-func commandArgs(text string) string {
-	parts := strings.SplitN(text, " ", 2)
-	if len(parts) < 2 {
-		return ""
-	}
-	return strings.TrimSpace(parts[1])
+// commandArgs returns the argument string of a command message.
+func commandArgs(message telego.Message) string {
+	return parseTelegramCommand(&message).Args
 }
 
 func (c *cmd) Help(ctx context.Context, message telego.Message) error {
@@ -42,6 +65,8 @@ func (c *cmd) Help(ctx context.Context, message telego.Message) error {
 /help - Show this help message
 /show [model|channel] - Show current configuration
 /list [models|channels] - List available options
+/stats - Show uptime, sessions, subagents and memory
+/cancel - Stop the current request and its subagents
 	`
 	_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
 		ChatID: telego.ChatID{ID: message.Chat.ID},
@@ -65,7 +90,7 @@ func (c *cmd) Start(ctx context.Context, message telego.Message) error {
 }
 
 func (c *cmd) Show(ctx context.Context, message telego.Message) error {
-	args := commandArgs(message.Text)
+	args := commandArgs(message)
 	if args == "" {
 		_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
 			ChatID: telego.ChatID{ID: message.Chat.ID},
@@ -100,7 +125,7 @@ func (c *cmd) Show(ctx context.Context, message telego.Message) error {
 }
 
 func (c *cmd) List(ctx context.Context, message telego.Message) error {
-	args := commandArgs(message.Text)
+	args := commandArgs(message)
 	if args == "" {
 		_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
 			ChatID: telego.ChatID{ID: message.Chat.ID},
@@ -154,3 +179,71 @@ func (c *cmd) List(ctx context.Context, message telego.Message) error {
 	})
 	return err
 }
+
+func (c *cmd) Stats(ctx context.Context, message telego.Message) error {
+	if c.stats == nil {
+		_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
+			ChatID: telego.ChatID{ID: message.Chat.ID},
+			Text:   "Stats are not available.",
+			ReplyParameters: &telego.ReplyParameters{
+				MessageID: message.MessageID,
+			},
+		})
+		return err
+	}
+
+	_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
+		ChatID:    telego.ChatID{ID: message.Chat.ID},
+		Text:      markdownToTelegramHTML(formatBotStats(c.stats(ctx))),
+		ParseMode: telego.ModeHTML,
+		ReplyParameters: &telego.ReplyParameters{
+			MessageID: message.MessageID,
+		},
+	})
+	return err
+}
+
+// formatBotStats renders stats as Markdown, one metric per line.
+func formatBotStats(stats BotStats) string {
+	var sb strings.Builder
+	sb.WriteString("**Bot stats**\n")
+	fmt.Fprintf(&sb, "**Uptime:** %s\n", stats.Uptime.Round(time.Second))
+	fmt.Fprintf(&sb, "**Active sessions:** %d\n", stats.ActiveSessions)
+
+	statuses := make([]string, 0, len(stats.SubagentTasks))
+	for status := range stats.SubagentTasks {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	counts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		counts = append(counts, fmt.Sprintf("%d %s", stats.SubagentTasks[status], status))
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "none")
+	}
+	fmt.Fprintf(&sb, "**Subagent tasks:** %s\n", strings.Join(counts, ", "))
+
+	if stats.MemoryEnabled {
+		fmt.Fprintf(&sb, "**Memory:** %d messages (%s)\n", stats.MemoryMessages, stats.MemoryStatus)
+	} else {
+		sb.WriteString("**Memory:** disabled\n")
+	}
+	return sb.String()
+}
+
+func (c *cmd) Cancel(ctx context.Context, message telego.Message) error {
+	response := "Nothing to cancel."
+	if c.cancel != nil && c.cancel("telegram", fmt.Sprintf("%d", message.Chat.ID)) {
+		response = "Canceled."
+	}
+
+	_, err := c.bot.SendMessage(ctx, &telego.SendMessageParams{
+		ChatID: telego.ChatID{ID: message.Chat.ID},
+		Text:   response,
+		ReplyParameters: &telego.ReplyParameters{
+			MessageID: message.MessageID,
+		},
+	})
+	return err
+}
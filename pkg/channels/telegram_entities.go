@@ -0,0 +1,313 @@
+package channels
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/mymmrac/telego"
+)
+
+const (
+	TelegramFormatHTML     = "html"
+	TelegramFormatEntities = "entities"
+)
+
+// markdownToTelegramEntities renders markdown into plain text plus Telegram
+// MessageEntity spans. Unlike markdownToTelegramHTML nothing needs escaping,
+// so content such as code containing '<' and '>' is sent verbatim.
+// Entity offsets and lengths are measured in UTF-16 code units as required
+// by the Bot API.
+func markdownToTelegramEntities(text string) (string, []telego.MessageEntity) {
+	if text == "" {
+		return "", nil
+	}
+
+	b := &entityBuilder{}
+	b.parse(formatLists(renderMarkdownTables(text)), true)
+
+	// Nested spans are appended when they close, so inner spans come first.
+	// Sort by offset for a stable, predictable order.
+	sort.SliceStable(b.entities, func(i, j int) bool {
+		return b.entities[i].Offset < b.entities[j].Offset
+	})
+
+	return b.sb.String(), b.entities
+}
+
+// entityBuilder accumulates plain text and tracks the current UTF-16 offset.
+type entityBuilder struct {
+	sb       strings.Builder
+	offset   int
+	entities []telego.MessageEntity
+}
+
+func (b *entityBuilder) write(s string) {
+	b.sb.WriteString(s)
+	b.offset += utf16Len(s)
+}
+
+func (b *entityBuilder) addEntity(entityType string, start int, url, language string) {
+	length := b.offset - start
+	if length <= 0 {
+		return
+	}
+	b.entities = append(b.entities, telego.MessageEntity{
+		Type:     entityType,
+		Offset:   start,
+		Length:   length,
+		URL:      url,
+		Language: language,
+	})
+}
+
+// parse walks the markdown text and emits plain text and entities.
+// topLevel enables line-prefix handling (headings, quotes, bullets),
+// which is not applied inside inline spans.
+func (b *entityBuilder) parse(text string, topLevel bool) {
+	i := 0
+	for i < len(text) {
+		if topLevel && (i == 0 || text[i-1] == '\n') {
+			if n, ok := b.expandableQuote(text[i:]); ok {
+				i += n
+				continue
+			}
+			i = skipLinePrefix(text, i)
+			if i >= len(text) {
+				break
+			}
+		}
+
+		rest := text[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "```"):
+			if n, ok := b.codeBlock(rest); ok {
+				i += n
+				continue
+			}
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				start := b.offset
+				b.write(rest[1 : end+1])
+				b.addEntity(telego.EntityTypeCode, start, "", "")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[':
+			if n, ok := b.link(rest); ok {
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if n, ok := b.span(rest, "**", telego.EntityTypeBold); ok {
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "__"):
+			if n, ok := b.underscoreSpan(text, i, "__", telego.EntityTypeBold); ok {
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "~~"):
+			if n, ok := b.span(rest, "~~", telego.EntityTypeStrikethrough); ok {
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "||"):
+			if n, ok := b.span(rest, "||", telego.EntityTypeSpoiler); ok {
+				i += n
+				continue
+			}
+		case rest[0] == '_':
+			if n, ok := b.underscoreSpan(text, i, "_", telego.EntityTypeItalic); ok {
+				i += n
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		b.write(rest[:size])
+		i += size
+	}
+}
+
+// skipLinePrefix strips markdown line prefixes the same way the HTML renderer
+// does: headings and quotes lose their marker. Lists are already rewritten
+// by formatLists.
+func skipLinePrefix(text string, i int) int {
+	line := text[i:]
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+
+	if hashes := len(line) - len(strings.TrimLeft(line, "#")); hashes >= 1 && hashes <= 6 {
+		if trimmed := strings.TrimLeft(line[hashes:], " \t"); len(trimmed) < len(line[hashes:]) && trimmed != "" {
+			return i + len(line) - len(trimmed)
+		}
+	}
+	if strings.HasPrefix(line, ">") {
+		return i + len(line) - len(strings.TrimLeft(line[1:], " \t"))
+	}
+	return i
+}
+
+// expandableQuote handles an expandable block quote starting at a line.
+// Returns bytes consumed.
+func (b *entityBuilder) expandableQuote(rest string) (int, bool) {
+	lines, n, ok := parseExpandableQuote(rest)
+	if !ok {
+		return 0, false
+	}
+
+	start := b.offset
+	for i, line := range lines {
+		if i > 0 {
+			b.write("\n")
+		}
+		b.parse(line, false)
+	}
+	b.addEntity(telego.EntityTypeExpandableBlockquote, start, "", "")
+	return n, true
+}
+
+// parseExpandableQuote parses Telegram's MarkdownV2 expandable block quote
+// at the start of text: a first line starting with "**>", further lines
+// starting with ">", and "||" ending the last line. It returns the quoted
+// lines and the bytes consumed, excluding the final newline.
+func parseExpandableQuote(text string) ([]string, int, bool) {
+	if !strings.HasPrefix(text, "**>") {
+		return nil, 0, false
+	}
+
+	var lines []string
+	pos := 0
+	for pos < len(text) {
+		line := text[pos:]
+		if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+			line = line[:idx]
+		}
+
+		var content string
+		if pos == 0 {
+			content = line[len("**>"):]
+		} else if strings.HasPrefix(line, ">") {
+			content = line[1:]
+		} else {
+			return nil, 0, false
+		}
+		content = strings.TrimPrefix(content, " ")
+
+		if strings.HasSuffix(content, "||") {
+			lines = append(lines, strings.TrimSuffix(content, "||"))
+			return lines, pos + len(line), true
+		}
+		lines = append(lines, content)
+		pos += len(line) + 1
+	}
+	return nil, 0, false
+}
+
+// codeBlock handles ```lang\n...``` fences. Returns bytes consumed.
+func (b *entityBuilder) codeBlock(rest string) (int, bool) {
+	end := strings.Index(rest[3:], "```")
+	if end < 0 {
+		return 0, false
+	}
+	body := rest[3 : 3+end]
+
+	language := ""
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+		header := body[:nl]
+		if isWordString(header) {
+			language = header
+			body = body[nl+1:]
+		}
+	} else if isWordString(body) {
+		// "```go```" has no content; keep it literal
+		return 0, false
+	}
+
+	start := b.offset
+	b.write(body)
+	b.addEntity(telego.EntityTypePre, start, "", language)
+	return 3 + end + 3, true
+}
+
+// link handles [label](url). Returns bytes consumed.
+func (b *entityBuilder) link(rest string) (int, bool) {
+	closeLabel := strings.IndexByte(rest, ']')
+	if closeLabel <= 1 || closeLabel+1 >= len(rest) || rest[closeLabel+1] != '(' {
+		return 0, false
+	}
+	if strings.IndexByte(rest[1:closeLabel], '\n') >= 0 {
+		return 0, false
+	}
+	closeURL := strings.IndexByte(rest[closeLabel+2:], ')')
+	if closeURL <= 0 {
+		return 0, false
+	}
+	label := rest[1:closeLabel]
+	url := rest[closeLabel+2 : closeLabel+2+closeURL]
+
+	start := b.offset
+	b.parse(label, false)
+	b.addEntity(telego.EntityTypeTextLink, start, url, "")
+	return closeLabel + 2 + closeURL + 1, true
+}
+
+// span handles symmetric markers such as **bold** or ~~strike~~.
+func (b *entityBuilder) span(rest, marker, entityType string) (int, bool) {
+	end := strings.Index(rest[len(marker):], marker)
+	if end <= 0 {
+		return 0, false
+	}
+	inner := rest[len(marker) : len(marker)+end]
+	if strings.IndexByte(inner, '\n') >= 0 {
+		return 0, false
+	}
+
+	start := b.offset
+	b.parse(inner, false)
+	b.addEntity(entityType, start, "", "")
+	return len(marker) + end + len(marker), true
+}
+
+// underscoreSpan handles _italic_ and __bold__ with the same word-edge rules
+// as replaceUnderscoreSpans. Returns bytes consumed from text[i].
+func (b *entityBuilder) underscoreSpan(text string, i int, marker, entityType string) (int, bool) {
+	end, ok := underscoreSpan(text, i, marker)
+	if !ok {
+		return 0, false
+	}
+
+	start := b.offset
+	b.parse(text[i+len(marker):end], false)
+	b.addEntity(entityType, start, "", "")
+	return end + len(marker) - i, true
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// isWordString reports whether s is a non-empty run of [A-Za-z0-9_+-].
+func isWordString(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '_' || c == '+' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/mymmrac/telego"
+)
+
+func TestMarkdownToTelegramEntities(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantText     string
+		wantEntities []telego.MessageEntity
+	}{
+		{
+			name:     "bold span",
+			input:    "Hello **world**!",
+			wantText: "Hello world!",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeBold, Offset: 6, Length: 5},
+			},
+		},
+		{
+			name:     "inline code keeps angle brackets",
+			input:    "Use `a < b && c > d` here",
+			wantText: "Use a < b && c > d here",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeCode, Offset: 4, Length: 14},
+			},
+		},
+		{
+			name:     "bold and code",
+			input:    "**Note:** run `go test`",
+			wantText: "Note: run go test",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeBold, Offset: 0, Length: 5},
+				{Type: telego.EntityTypeCode, Offset: 10, Length: 7},
+			},
+		},
+		{
+			name:     "code block with language",
+			input:    "Example:\n```go\nif a < b {}\n```",
+			wantText: "Example:\nif a < b {}\n",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypePre, Offset: 9, Length: 12, Language: "go"},
+			},
+		},
+		{
+			name:     "offsets count UTF-16 units",
+			input:    "😀 **hi**",
+			wantText: "😀 hi",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeBold, Offset: 3, Length: 2},
+			},
+		},
+		{
+			name:     "link",
+			input:    "See [docs](https://example.com)",
+			wantText: "See docs",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeTextLink, Offset: 4, Length: 4, URL: "https://example.com"},
+			},
+		},
+		{
+			name:         "identifiers are not italic",
+			input:        "file_id and snake_case_name",
+			wantText:     "file_id and snake_case_name",
+			wantEntities: nil,
+		},
+		{
+			name:         "paths and intra-word underscores are not italic",
+			input:        "open logs/_tmp_/app_error_log and a__b__c",
+			wantText:     "open logs/_tmp_/app_error_log and a__b__c",
+			wantEntities: nil,
+		},
+		{
+			name:     "italic phrase containing an identifier",
+			input:    "(_use my_var here_)",
+			wantText: "(use my_var here)",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeItalic, Offset: 1, Length: 15},
+			},
+		},
+		{
+			name:     "underscore bold",
+			input:    "__Note:__ done",
+			wantText: "Note: done",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeBold, Offset: 0, Length: 5},
+			},
+		},
+		{
+			name:         "unclosed marker is literal",
+			input:        "2 ** 3",
+			wantText:     "2 ** 3",
+			wantEntities: nil,
+		},
+		{
+			name:     "spoiler",
+			input:    "The answer is ||42||.",
+			wantText: "The answer is 42.",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeSpoiler, Offset: 14, Length: 2},
+			},
+		},
+		{
+			name:     "expandable quote",
+			input:    "Log:\n**>line one\n>line **two**||\nDone",
+			wantText: "Log:\nline one\nline two\nDone",
+			wantEntities: []telego.MessageEntity{
+				{Type: telego.EntityTypeExpandableBlockquote, Offset: 5, Length: 17},
+				{Type: telego.EntityTypeBold, Offset: 19, Length: 3},
+			},
+		},
+		{
+			name:         "unterminated expandable quote is literal",
+			input:        "**>line one\nline two",
+			wantText:     "**>line one\nline two",
+			wantEntities: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := markdownToTelegramEntities(tt.input)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if len(entities) != len(tt.wantEntities) {
+				t.Fatalf("entities = %+v, want %+v", entities, tt.wantEntities)
+			}
+			for i, want := range tt.wantEntities {
+				got := entities[i]
+				if got.Type != want.Type || got.Offset != want.Offset || got.Length != want.Length ||
+					got.URL != want.URL || got.Language != want.Language {
+					t.Errorf("entity[%d] = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
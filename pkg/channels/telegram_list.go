@@ -0,0 +1,86 @@
+package channels
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// bulletItemRe matches "- item", "* item" or "+ item", possibly indented.
+	bulletItemRe = regexp.MustCompile(`^([ \t]*)[-*+][ \t]+(.*)$`)
+	// orderedItemRe matches "1. item" or "1) item", possibly indented.
+	orderedItemRe = regexp.MustCompile(`^([ \t]*)(\d{1,9}[.)])[ \t]+(.*)$`)
+)
+
+// listBullets are used for unordered items by nesting depth; deeper levels
+// reuse the last one.
+var listBullets = []string{"•", "◦", "▪"}
+
+// listIndent is the visual indentation per nesting level.
+const listIndent = "    "
+
+// formatLists rewrites markdown lists for Telegram, which has no list
+// markup. Bullets become "•" (or "◦", "▪" when nested), ordered items keep
+// their numbers, nested items are indented by depth and indented lines
+// continuing an item are aligned under its text. Code blocks are left alone.
+func formatLists(text string) string {
+	lines := strings.Split(text, "\n")
+	inFence := false
+	var indents []int // indentation of the open nesting levels
+	contentCol := -1  // where the current item's text starts; -1 outside lists
+	prevBlank := false
+
+	for i, line := range lines {
+		afterBlank := prevBlank
+		prevBlank = strings.TrimSpace(line) == ""
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			contentCol = -1
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		var indent, marker, content string
+		if m := bulletItemRe.FindStringSubmatch(line); m != nil {
+			indent, content = m[1], m[2]
+		} else if m := orderedItemRe.FindStringSubmatch(line); m != nil {
+			indent, marker, content = m[1], m[2], m[3]
+		} else {
+			trimmed := strings.TrimLeft(line, " \t")
+			switch {
+			case trimmed == "":
+				// Items may be separated by blank lines
+			case contentCol >= 0 && len(trimmed) < len(line):
+				lines[i] = strings.Repeat(" ", contentCol) + trimmed
+			case afterBlank:
+				// A paragraph after a blank line ends the list
+				indents, contentCol = nil, -1
+			}
+			continue
+		}
+
+		width := indentWidth(indent)
+		for len(indents) > 0 && indents[len(indents)-1] > width {
+			indents = indents[:len(indents)-1]
+		}
+		if len(indents) == 0 || indents[len(indents)-1] < width {
+			indents = append(indents, width)
+		}
+		depth := len(indents) - 1
+
+		if marker == "" {
+			marker = listBullets[min(depth, len(listBullets)-1)]
+		}
+		prefix := strings.Repeat(listIndent, depth) + marker + " "
+		lines[i] = prefix + content
+		contentCol = len([]rune(prefix))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentWidth measures leading whitespace, counting a tab as four spaces.
+func indentWidth(indent string) int {
+	return len(indent) + 3*strings.Count(indent, "\t")
+}
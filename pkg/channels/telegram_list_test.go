@@ -0,0 +1,67 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatLists(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			name:  "ordered list keeps numbers",
+			input: []string{"Steps:", "1. Install", "2) Configure", "10. Run"},
+			want:  []string{"Steps:", "1. Install", "2) Configure", "10. Run"},
+		},
+		{
+			name:  "nested bullets",
+			input: []string{"- fruit", "  - apple", "    * green", "  - pear", "- vegetables"},
+			want:  []string{"• fruit", "    ◦ apple", "        ▪ green", "    ◦ pear", "• vegetables"},
+		},
+		{
+			name:  "mixed lists",
+			input: []string{"1. Prepare", "   - wash", "   - cut", "2. Cook", "\t+ stir"},
+			want:  []string{"1. Prepare", "    ◦ wash", "    ◦ cut", "2. Cook", "    ◦ stir"},
+		},
+		{
+			name:  "continuation lines stay with their item",
+			input: []string{"1. First item that", "wraps", "  and continues", "", "2. Second", "Paragraph after."},
+			want:  []string{"1. First item that", "wraps", "   and continues", "", "2. Second", "Paragraph after."},
+		},
+		{
+			name:  "code blocks untouched",
+			input: []string{"```", "- not a list", "1. nor this", "```"},
+			want:  []string{"```", "- not a list", "1. nor this", "```"},
+		},
+		{
+			name:  "bold and rules are not bullets",
+			input: []string{"**Note** this", "---", "-5 degrees"},
+			want:  []string{"**Note** this", "---", "-5 degrees"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatLists(strings.Join(tt.input, "\n"))
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("formatLists() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToTelegramHTML_Lists(t *testing.T) {
+	input := "Plan:\n1. **Build** it\n   - with `make`\n2. Ship it"
+	want := "Plan:\n1. <b>Build</b> it\n    ◦ with <code>make</code>\n2. Ship it"
+	if got := markdownToTelegramHTML(input); got != want {
+		t.Errorf("markdownToTelegramHTML() = %q, want %q", got, want)
+	}
+
+	text, _ := markdownToTelegramEntities(input)
+	if want := "Plan:\n1. Build it\n    ◦ with make\n2. Ship it"; text != want {
+		t.Errorf("markdownToTelegramEntities() text = %q, want %q", text, want)
+	}
+}
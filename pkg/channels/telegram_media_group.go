@@ -0,0 +1,121 @@
+package channels
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mymmrac/telego"
+)
+
+// mediaGroupWindow is how long to wait for more items of an album after the
+// last one arrived.
+const mediaGroupWindow = 1500 * time.Millisecond
+
+// mediaGroupPart is one item of an album, with its attachments already
+// downloaded.
+type mediaGroupPart struct {
+	message *telego.Message
+	content string
+	media   []string
+	logID   string // inbound log entry of the item; "" if not logged
+}
+
+// mediaGroupBuffer collects the items of Telegram albums, which are delivered
+// as separate messages sharing a media_group_id, so they can be handled as
+// one message. The zero value is ready to use.
+type mediaGroupBuffer struct {
+	window time.Duration // 0 uses mediaGroupWindow
+	mu     sync.Mutex
+	groups map[string]*pendingMediaGroup
+}
+
+type pendingMediaGroup struct {
+	parts []mediaGroupPart
+	timer *time.Timer
+	flush func([]mediaGroupPart)
+}
+
+// add buffers part under key. flush is called with all parts of the group
+// once no new part has arrived for the window.
+func (b *mediaGroupBuffer) add(key string, part mediaGroupPart, flush func([]mediaGroupPart)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	window := b.window
+	if window == 0 {
+		window = mediaGroupWindow
+	}
+	if b.groups == nil {
+		b.groups = make(map[string]*pendingMediaGroup)
+	}
+
+	group, ok := b.groups[key]
+	if !ok {
+		group = &pendingMediaGroup{flush: flush}
+		b.groups[key] = group
+		group.timer = time.AfterFunc(window, func() {
+			if parts := b.take(key); len(parts) > 0 {
+				flush(parts)
+			}
+		})
+	} else {
+		group.timer.Reset(window)
+	}
+	group.parts = append(group.parts, part)
+}
+
+// flushAll flushes every pending group right away, e.g. on shutdown.
+func (b *mediaGroupBuffer) flushAll() {
+	b.mu.Lock()
+	pending := make(map[string]func([]mediaGroupPart), len(b.groups))
+	for key, group := range b.groups {
+		group.timer.Stop()
+		pending[key] = group.flush
+	}
+	b.mu.Unlock()
+
+	for key, flush := range pending {
+		if parts := b.take(key); len(parts) > 0 {
+			flush(parts)
+		}
+	}
+}
+
+// take removes the group under key and returns its parts in the order the
+// user sent them. Items are downloaded concurrently, so they may have
+// arrived in a different order.
+func (b *mediaGroupBuffer) take(key string) []mediaGroupPart {
+	b.mu.Lock()
+	group, ok := b.groups[key]
+	delete(b.groups, key)
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	sort.Slice(group.parts, func(i, j int) bool {
+		return group.parts[i].message.MessageID < group.parts[j].message.MessageID
+	})
+	return group.parts
+}
+
+// combineMediaGroup merges the contents and attachments of an album. The
+// caption usually comes with the first item only; since parts are in send
+// order it ends up at the start.
+func combineMediaGroup(parts []mediaGroupPart) (string, []string) {
+	contents := make([]string, 0, len(parts))
+	var media []string
+	for _, part := range parts {
+		if part.content != "" && part.content != "[empty message]" {
+			contents = append(contents, part.content)
+		}
+		media = append(media, part.media...)
+	}
+	content := strings.Join(contents, "\n")
+	if content == "" {
+		content = "[empty message]"
+	}
+	return content, media
+}
@@ -0,0 +1,145 @@
+package channels
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestTelegramChannel_CoalescesMediaGroup(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.mediaGroups.window = 50 * time.Millisecond
+
+	photo := func(id int, fileID, caption string) *telego.Message {
+		return &telego.Message{
+			MessageID:    id,
+			From:         &telego.User{ID: 7},
+			Chat:         telego.Chat{ID: 42, Type: "private"},
+			MediaGroupID: "album-1",
+			Photo:        []telego.PhotoSize{{FileID: fileID}},
+			Caption:      caption,
+		}
+	}
+
+	// The captioned first item finishes downloading last
+	if err := c.handleMessage(context.Background(), photo(11, "photo-b", "")); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+	if err := c.handleMessage(context.Background(), photo(10, "photo-a", "Our trip")); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message was published")
+	}
+
+	want := "Our trip\n[image: photo] [file_id: photo-a]\n[image: photo] [file_id: photo-b]"
+	if msg.Content != want {
+		t.Errorf("content = %q, want %q", msg.Content, want)
+	}
+	if len(msg.Media) != 2 {
+		t.Errorf("media = %v, want 2 attachments", msg.Media)
+	}
+	if msg.Metadata["message_id"] != "10" || msg.Metadata["media_group_id"] != "album-1" {
+		t.Errorf("metadata = %v, want the first item's message_id and the media group", msg.Metadata)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if extra, ok := c.bus.ConsumeInbound(ctx); ok {
+		t.Errorf("album produced a second message: %q", extra.Content)
+	}
+}
+
+// albumPhoto returns item id of album album-1 in chat 42.
+func albumPhoto(id int, fileID, caption string) *telego.Message {
+	return &telego.Message{
+		MessageID:    id,
+		From:         &telego.User{ID: 7},
+		Chat:         telego.Chat{ID: 42, Type: "private"},
+		MediaGroupID: "album-1",
+		Photo:        []telego.PhotoSize{{FileID: fileID}},
+		Caption:      caption,
+	}
+}
+
+func TestTelegramChannel_MediaGroupItemsLoggedUntilPublished(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+	c.mediaGroups.window = 50 * time.Millisecond
+	log, err := bus.OpenInboundLog(filepath.Join(t.TempDir(), "inbound.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.bus.SetInboundLog(log)
+
+	for _, item := range []*telego.Message{albumPhoto(10, "photo-a", "Our trip"), albumPhoto(11, "photo-b", "")} {
+		if err := c.handleMessage(context.Background(), item); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+	}
+	if n := log.Len(); n != 2 {
+		t.Fatalf("inbound log holds %d entries while the album is buffered, want 2", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message was published")
+	}
+	// Only the combined album is left to acknowledge
+	if n := log.Len(); n != 1 || msg.LogID == "" {
+		t.Fatalf("inbound log holds %d entries after publishing (LogID %q), want only the album", n, msg.LogID)
+	}
+	c.bus.AckInbound(msg)
+	if n := log.Len(); n != 0 {
+		t.Errorf("inbound log holds %d entries after the album was handled, want 0", n)
+	}
+}
+
+func TestTelegramChannel_StopFlushesMediaGroups(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+	c.mediaGroups.window = time.Hour
+
+	if err := c.handleMessage(context.Background(), albumPhoto(10, "photo-a", "Our trip")); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	msg, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("album buffered at shutdown was not published")
+	}
+	if !strings.HasPrefix(msg.Content, "Our trip") {
+		t.Errorf("content = %q, want the album", msg.Content)
+	}
+}
+
+func TestCombineMediaGroup_WithoutCaption(t *testing.T) {
+	parts := []mediaGroupPart{
+		{content: "[image: photo] [file_id: a]", media: []string{"a.jpg"}},
+		{content: "[empty message]"},
+	}
+	content, media := combineMediaGroup(parts)
+	if !strings.HasPrefix(content, "[image: photo]") || strings.Contains(content, "[empty message]") {
+		t.Errorf("content = %q", content)
+	}
+	if len(media) != 1 {
+		t.Errorf("media = %v, want 1 attachment", media)
+	}
+}
@@ -0,0 +1,119 @@
+package channels
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/mymmrac/telego"
+)
+
+// telegramEntityText returns the part of text an entity covers. Entity
+// offsets and lengths count UTF-16 code units.
+func telegramEntityText(text string, e telego.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
+
+// addressedToBot reports whether a group message is meant for the bot: it
+// replies to one of the bot's messages, @-mentions the bot, or is a command
+// suffixed with the bot's username ("/help@my_bot").
+func addressedToBot(message *telego.Message, botID int64, botUsername string) bool {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == botID {
+		return true
+	}
+
+	mention := "@" + strings.ToLower(botUsername)
+	check := func(text string, entities []telego.MessageEntity) bool {
+		for _, e := range entities {
+			switch e.Type {
+			case telego.EntityTypeTextMention:
+				if e.User != nil && e.User.ID == botID {
+					return true
+				}
+			case telego.EntityTypeMention:
+				if botUsername != "" && strings.ToLower(telegramEntityText(text, e)) == mention {
+					return true
+				}
+			case telego.EntityTypeBotCommand:
+				if botUsername != "" && strings.HasSuffix(strings.ToLower(telegramEntityText(text, e)), mention) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return check(message.Text, message.Entities) || check(message.Caption, message.CaptionEntities)
+}
+
+// ignoredForMentionOnly reports whether mention_only mode drops message:
+// a group message not addressed to the bot. Direct messages always pass.
+func (c *TelegramChannel) ignoredForMentionOnly(message *telego.Message) bool {
+	if c.config == nil || !c.config.Channels.Telegram.MentionOnly || message.Chat.Type == "private" {
+		return false
+	}
+	return !addressedToBot(message, c.bot.ID(), c.bot.Username())
+}
+
+// telegramCommand is a command message split into its parts.
+type telegramCommand struct {
+	Name     string   // command without "/" or bot suffix, lowercased; empty if none
+	Bot      string   // username in a "/cmd@bot" suffix, if any
+	Args     string   // text after the command, trimmed
+	Mentions []string // @-mentioned usernames, without "@", in order
+}
+
+// parseTelegramCommand extracts the leading command, its argument string and
+// the mentioned usernames of message using its entities. Messages without
+// entities, e.g. from clients that omit them, fall back to splitting the
+// text at the first whitespace.
+func parseTelegramCommand(message *telego.Message) telegramCommand {
+	var cmd telegramCommand
+	text := message.Text
+	commandEnd := -1
+
+	for _, e := range message.Entities {
+		switch e.Type {
+		case telego.EntityTypeBotCommand:
+			if command := telegramEntityText(text, e); e.Offset == 0 && commandEnd < 0 && command != "" {
+				cmd.Name, cmd.Bot = splitCommand(command)
+				commandEnd = e.Length
+			}
+		case telego.EntityTypeMention:
+			if name := strings.TrimPrefix(telegramEntityText(text, e), "@"); name != "" {
+				cmd.Mentions = append(cmd.Mentions, name)
+			}
+		case telego.EntityTypeTextMention:
+			if e.User != nil && e.User.Username != "" {
+				cmd.Mentions = append(cmd.Mentions, e.User.Username)
+			}
+		}
+	}
+
+	if commandEnd >= 0 {
+		units := utf16.Encode([]rune(text))
+		cmd.Args = strings.TrimSpace(string(utf16.Decode(units[commandEnd:])))
+		return cmd
+	}
+
+	// No command entity: take a leading "/word" from the text itself
+	if len(message.Entities) == 0 && strings.HasPrefix(text, "/") {
+		head, rest := text, ""
+		if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+			head, rest = text[:i], text[i:]
+		}
+		cmd.Name, cmd.Bot = splitCommand(head)
+		cmd.Args = strings.TrimSpace(rest)
+	}
+	return cmd
+}
+
+// splitCommand splits "/cmd@bot" into "cmd" and "bot".
+func splitCommand(s string) (name, bot string) {
+	s = strings.TrimPrefix(s, "/")
+	name, bot, _ = strings.Cut(s, "@")
+	return strings.ToLower(name), bot
+}
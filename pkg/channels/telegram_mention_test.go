@@ -0,0 +1,182 @@
+package channels
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAddressedToBot(t *testing.T) {
+	bot := &telego.User{ID: fakeBotID, IsBot: true, Username: fakeBotUsername}
+	other := &telego.User{ID: 5, Username: "alice"}
+	mention := func(offset, length int) []telego.MessageEntity {
+		return []telego.MessageEntity{{Type: telego.EntityTypeMention, Offset: offset, Length: length}}
+	}
+
+	tests := []struct {
+		name    string
+		message telego.Message
+		want    bool
+	}{
+		{"plain text", telego.Message{Text: "hello everyone"}, false},
+		{"mention", telego.Message{Text: "@pico_bot what time is it", Entities: mention(0, 9)}, true},
+		{"mention any case", telego.Message{Text: "hey @Pico_Bot", Entities: mention(4, 9)}, true},
+		{"mention after emoji", telego.Message{Text: "👋 @pico_bot", Entities: mention(3, 9)}, true},
+		{"other mention", telego.Message{Text: "@alice look", Entities: mention(0, 6)}, false},
+		{"username without entity", telego.Message{Text: "@pico_bot"}, false},
+		{"text mention", telego.Message{Text: "Pico help", Entities: []telego.MessageEntity{
+			{Type: telego.EntityTypeTextMention, Offset: 0, Length: 4, User: bot},
+		}}, true},
+		{"caption mention", telego.Message{Caption: "@pico_bot what is this", CaptionEntities: mention(0, 9)}, true},
+		{"command for the bot", telego.Message{Text: "/help@pico_bot", Entities: []telego.MessageEntity{
+			{Type: telego.EntityTypeBotCommand, Offset: 0, Length: 14},
+		}}, true},
+		{"command for another bot", telego.Message{Text: "/help@other_bot", Entities: []telego.MessageEntity{
+			{Type: telego.EntityTypeBotCommand, Offset: 0, Length: 15},
+		}}, false},
+		{"reply to bot", telego.Message{Text: "thanks", ReplyToMessage: &telego.Message{From: bot}}, true},
+		{"reply to someone else", telego.Message{Text: "agreed", ReplyToMessage: &telego.Message{From: other}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addressedToBot(&tt.message, fakeBotID, fakeBotUsername); got != tt.want {
+				t.Errorf("addressedToBot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_MentionOnly(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+	c.config.Channels.Telegram.MentionOnly = true
+
+	group := telego.Chat{ID: -100, Type: "supergroup"}
+	messages := []*telego.Message{
+		{MessageID: 1, From: &telego.User{ID: 7}, Chat: group, Text: "just chatting"},
+		{MessageID: 2, From: &telego.User{ID: 7}, Chat: group, Text: "@pico_bot summarize",
+			Entities: []telego.MessageEntity{{Type: telego.EntityTypeMention, Offset: 0, Length: 9}}},
+		{MessageID: 3, From: &telego.User{ID: 7}, Chat: group, Text: "and shorter",
+			ReplyToMessage: &telego.Message{MessageID: 9, From: &telego.User{ID: fakeBotID, IsBot: true}}},
+		{MessageID: 4, From: &telego.User{ID: 7}, Chat: telego.Chat{ID: 7, Type: "private"}, Text: "hi in private"},
+	}
+	for _, m := range messages {
+		if err := c.handleMessage(context.Background(), m); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+	}
+
+	var got []string
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		msg, ok := c.bus.ConsumeInbound(ctx)
+		cancel()
+		if !ok {
+			break
+		}
+		got = append(got, msg.Content)
+	}
+	want := []string{"@pico_bot summarize", "and shorter", "hi in private"}
+	if len(got) != len(want) {
+		t.Fatalf("published %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseTelegramCommand(t *testing.T) {
+	command := func(length int) telego.MessageEntity {
+		return telego.MessageEntity{Type: telego.EntityTypeBotCommand, Offset: 0, Length: length}
+	}
+
+	tests := []struct {
+		name    string
+		message telego.Message
+		want    telegramCommand
+	}{
+		{
+			name:    "command with argument",
+			message: telego.Message{Text: "/show agent1", Entities: []telego.MessageEntity{command(5)}},
+			want:    telegramCommand{Name: "show", Args: "agent1"},
+		},
+		{
+			name:    "bot suffix",
+			message: telego.Message{Text: "/show@pico_bot model", Entities: []telego.MessageEntity{command(14)}},
+			want:    telegramCommand{Name: "show", Bot: "pico_bot", Args: "model"},
+		},
+		{
+			name:    "argument on the next line",
+			message: telego.Message{Text: "/List\n  models  ", Entities: []telego.MessageEntity{command(5)}},
+			want:    telegramCommand{Name: "list", Args: "models"},
+		},
+		{
+			name: "mentions in the arguments",
+			message: telego.Message{Text: "/show 👀 @alice and @bob", Entities: []telego.MessageEntity{
+				command(5),
+				{Type: telego.EntityTypeMention, Offset: 9, Length: 6},
+				{Type: telego.EntityTypeMention, Offset: 20, Length: 4},
+			}},
+			want: telegramCommand{Name: "show", Args: "👀 @alice and @bob", Mentions: []string{"alice", "bob"}},
+		},
+		{
+			name: "mentions without a command",
+			message: telego.Message{Text: "ask @alice", Entities: []telego.MessageEntity{
+				{Type: telego.EntityTypeMention, Offset: 4, Length: 6},
+				{Type: telego.EntityTypeTextMention, Offset: 0, Length: 3, User: &telego.User{ID: 3, Username: "carol"}},
+			}},
+			want: telegramCommand{Mentions: []string{"alice", "carol"}},
+		},
+		{
+			name: "command not at the start",
+			message: telego.Message{Text: "try /help", Entities: []telego.MessageEntity{
+				{Type: telego.EntityTypeBotCommand, Offset: 4, Length: 5},
+			}},
+			want: telegramCommand{},
+		},
+		{
+			name:    "no entities",
+			message: telego.Message{Text: "/show\tmodel"},
+			want:    telegramCommand{Name: "show", Args: "model"},
+		},
+		{
+			name:    "plain text",
+			message: telego.Message{Text: "show model"},
+			want:    telegramCommand{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTelegramCommand(&tt.message)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTelegramCommand() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramCommands_ShowWithBotSuffix(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	commands := &cmd{bot: c.bot, config: c.config}
+
+	message := telego.Message{
+		MessageID: 5,
+		Chat:      telego.Chat{ID: 42},
+		Text:      "/show@pico_bot channel",
+		Entities:  []telego.MessageEntity{{Type: telego.EntityTypeBotCommand, Offset: 0, Length: 14}},
+	}
+	if err := commands.Show(context.Background(), message); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+	if len(api.bodies) != 1 || !strings.Contains(api.bodies[0], "Current Channel: telegram") {
+		t.Errorf("reply bodies = %v, want the current channel", api.bodies)
+	}
+}
@@ -0,0 +1,164 @@
+package channels
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// tableDelimiterRe matches the row under a markdown table header, e.g.
+// "|---|:---:|--:|".
+var tableDelimiterRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// Column alignments taken from the delimiter row
+const (
+	alignLeft = iota
+	alignCenter
+	alignRight
+)
+
+// renderMarkdownTables replaces markdown tables with code blocks holding the
+// table as aligned plain text, since Telegram cannot display tables. Tables
+// inside code blocks are left alone.
+func renderMarkdownTables(text string) string {
+	if !strings.Contains(text, "|") {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if inFence || !isTableRow(line) || i+1 >= len(lines) || !tableDelimiterRe.MatchString(lines[i+1]) {
+			out = append(out, line)
+			continue
+		}
+
+		rows := [][]string{splitTableRow(line)}
+		aligns := tableAlignments(lines[i+1])
+		j := i + 2
+		for j < len(lines) && isTableRow(lines[j]) {
+			rows = append(rows, splitTableRow(lines[j]))
+			j++
+		}
+		out = append(out, "```")
+		out = append(out, formatTable(rows, aligns)...)
+		out = append(out, "```")
+		i = j - 1
+	}
+	return strings.Join(out, "\n")
+}
+
+// isTableRow reports whether line can be a table row.
+func isTableRow(line string) bool {
+	return strings.Contains(line, "|") && strings.TrimSpace(line) != ""
+}
+
+// splitTableRow splits a table row into trimmed cells. "\|" is a literal
+// pipe; bold and code markers are dropped since the table is shown verbatim.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	cells = append(cells, cell.String())
+
+	cleanup := strings.NewReplacer("**", "", "`", "")
+	for i, c := range cells {
+		cells[i] = cleanup.Replace(strings.TrimSpace(c))
+	}
+	return cells
+}
+
+// tableAlignments reads the column alignments from a delimiter row.
+func tableAlignments(delimiter string) []int {
+	cells := splitTableRow(delimiter)
+	aligns := make([]int, len(cells))
+	for i, c := range cells {
+		left, right := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":")
+		switch {
+		case left && right:
+			aligns[i] = alignCenter
+		case right:
+			aligns[i] = alignRight
+		}
+	}
+	return aligns
+}
+
+// formatTable lays out rows in aligned columns with a rule under the header.
+// Rows with fewer cells than the widest row are padded with empty cells.
+func formatTable(rows [][]string, aligns []int) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	lines := make([]string, 0, len(rows)+1)
+	for r, row := range rows {
+		cells := make([]string, len(widths))
+		for i, width := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			align := alignLeft
+			if i < len(aligns) {
+				align = aligns[i]
+			}
+			cells[i] = padCell(cell, width, align)
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, " | "), " "))
+
+		if r == 0 {
+			rule := make([]string, len(widths))
+			for i, width := range widths {
+				rule[i] = strings.Repeat("-", width)
+			}
+			lines = append(lines, strings.Join(rule, "-+-"))
+		}
+	}
+	return lines
+}
+
+// padCell pads cell with spaces to width runes according to align.
+func padCell(cell string, width, align int) string {
+	pad := width - utf8.RuneCountInString(cell)
+	if pad <= 0 {
+		return cell
+	}
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", pad) + cell
+	case alignCenter:
+		left := pad / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", pad-left)
+	default:
+		return cell + strings.Repeat(" ", pad)
+	}
+}
@@ -0,0 +1,77 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownTables(t *testing.T) {
+	input := strings.Join([]string{
+		"Results:",
+		"",
+		"| Name | Score | City |",
+		"|:-----|------:|:----:|",
+		"| Alice | 9 | Berlin |",
+		"| Bob | 10 | Rome |",
+		"| **Carol** | 100 | Lisbon |",
+		"",
+		"Done.",
+	}, "\n")
+	want := strings.Join([]string{
+		"Results:",
+		"",
+		"```",
+		"Name  | Score |  City",
+		"------+-------+-------",
+		"Alice |     9 | Berlin",
+		"Bob   |    10 |  Rome",
+		"Carol |   100 | Lisbon",
+		"```",
+		"",
+		"Done.",
+	}, "\n")
+
+	if got := renderMarkdownTables(input); got != want {
+		t.Errorf("renderMarkdownTables() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderMarkdownTables_RaggedRows(t *testing.T) {
+	input := "a | b\n--- | ---\n| 1 |\n2 | 3 | extra \\| pipe"
+	want := strings.Join([]string{
+		"```",
+		"a | b |",
+		"--+---+-------------",
+		"1 |   |",
+		"2 | 3 | extra | pipe",
+		"```",
+	}, "\n")
+
+	if got := renderMarkdownTables(input); got != want {
+		t.Errorf("renderMarkdownTables() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderMarkdownTables_LeavesOtherText(t *testing.T) {
+	for _, input := range []string{
+		"a | b without a delimiter row",
+		"```\n| a | b |\n|---|---|\n| 1 | 2 |\n```",
+		"x || y",
+	} {
+		if got := renderMarkdownTables(input); got != input {
+			t.Errorf("renderMarkdownTables(%q) = %q, want it unchanged", input, got)
+		}
+	}
+}
+
+func TestMarkdownToTelegramHTML_Table(t *testing.T) {
+	input := "| Item | Qty | Note |\n|---|---:|---|\n| <b> tag | 2 | a_b |\n| apples | 12 | ok |"
+	want := "<pre><code>Item    | Qty | Note\n" +
+		"--------+-----+-----\n" +
+		"&lt;b&gt; tag |   2 | a_b\n" +
+		"apples  |  12 | ok\n</code></pre>"
+
+	if got := markdownToTelegramHTML(input); got != want {
+		t.Errorf("markdownToTelegramHTML() =\n%q\nwant\n%q", got, want)
+	}
+}
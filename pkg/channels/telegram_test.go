@@ -0,0 +1,721 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func TestTelegramChannel_SendWithResult(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+
+	ids, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: "hello"})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("message IDs = %v, want [1]", ids)
+	}
+}
+
+func TestTelegramChannel_SendWithResult_MultipleParts(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+
+	paragraph := strings.Repeat("word ", 600)
+	content := paragraph + "\n\n" + paragraph
+
+	ids, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: content})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+
+	wantParts := len(c.renderMessageParts(content))
+	if wantParts < 2 {
+		t.Fatalf("test content rendered into %d parts, want at least 2", wantParts)
+	}
+	if len(api.methods) != wantParts {
+		t.Fatalf("API methods = %v, want %d sendMessage calls", api.methods, wantParts)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("message IDs = %v, want [1 2]", ids)
+	}
+}
+
+func TestTelegramChannel_SendWithResult_ThreadsSplitParts(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.config.Channels.Telegram.ThreadSplitReplies = true
+	c.setRunning(true)
+
+	paragraph := strings.Repeat("word ", 600)
+	content := paragraph + "\n\n" + paragraph
+
+	ids, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: content})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if len(ids) < 2 || len(api.bodies) != len(ids) {
+		t.Fatalf("message IDs = %v, bodies = %d, want one sendMessage per part", ids, len(api.bodies))
+	}
+
+	for i, body := range api.bodies {
+		var req struct {
+			ReplyParameters *telego.ReplyParameters `json:"reply_parameters"`
+		}
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("part %d: decode body: %v", i+1, err)
+		}
+		if i == 0 {
+			if req.ReplyParameters != nil {
+				t.Errorf("first part replies to %d, want a top-level message", req.ReplyParameters.MessageID)
+			}
+			continue
+		}
+		if req.ReplyParameters == nil || req.ReplyParameters.MessageID != ids[i-1] {
+			t.Errorf("part %d reply_parameters = %+v, want a reply to message %d", i+1, req.ReplyParameters, ids[i-1])
+		}
+	}
+}
+
+func TestTelegramChannel_SendWithResult_EditsPlaceholder(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+	c.placeholders.Store("42", 7)
+
+	ids, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: "done"})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if len(api.methods) != 1 || api.methods[0] != "editMessageText" {
+		t.Fatalf("API methods = %v, want [editMessageText]", api.methods)
+	}
+	if !reflect.DeepEqual(ids, []int{7}) {
+		t.Errorf("message IDs = %v, want placeholder ID [7]", ids)
+	}
+}
+
+func TestTelegramChannel_SendWithResult_NotRunning(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+
+	if _, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: "hi"}); err == nil {
+		t.Fatal("expected error when the bot is not running")
+	}
+}
+
+// htmlRejectingAPI fails every sendMessage that uses parse_mode with
+// Telegram's parse error and passes the rest to fakeTelegramAPI.
+type htmlRejectingAPI struct {
+	fakeTelegramAPI
+	rejected int
+}
+
+func (f *htmlRejectingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	if strings.Contains(string(data), `"parse_mode"`) {
+		f.rejected++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":          false,
+			"error_code":  400,
+			"description": "Bad Request: can't parse entities: Unexpected end tag at byte offset 12",
+		})
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(data)))
+	f.fakeTelegramAPI.ServeHTTP(w, r)
+}
+
+func TestTelegramChannel_SendWithResult_PlainTextFallback(t *testing.T) {
+	api := &htmlRejectingAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+
+	ids, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "42", Content: "**Total**: 3 < 5 & `x`"})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if api.rejected != 1 || len(api.bodies) != 1 {
+		t.Fatalf("rejected = %d, retries = %d; want one HTML attempt and one plain retry", api.rejected, len(api.bodies))
+	}
+	if !reflect.DeepEqual(ids, []int{1}) {
+		t.Errorf("message IDs = %v, want [1]", ids)
+	}
+
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(api.bodies[0]), &req); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if want := "Total: 3 < 5 & x"; req.Text != want {
+		t.Errorf("plain text = %q, want %q", req.Text, want)
+	}
+}
+
+// deleteMessageAPI answers deleteMessage with a fixed Telegram error description,
+// or success when description is empty.
+type deleteMessageAPI struct {
+	description string
+	calls       int
+}
+
+func (f *deleteMessageAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls++
+	w.Header().Set("Content-Type", "application/json")
+	if f.description == "" {
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": true})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 400, "description": f.description})
+}
+
+func TestTelegramChannel_DeleteMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantErr     bool
+	}{
+		{name: "deleted", description: ""},
+		{name: "not found", description: "Bad Request: message to delete not found"},
+		{name: "not deletable", description: "Bad Request: message can't be deleted"},
+		{name: "other error", description: "Bad Request: chat not found", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &deleteMessageAPI{description: tt.description}
+			c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+
+			err := c.DeleteMessage(context.Background(), "42", 7)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if api.calls != 1 {
+				t.Errorf("deleteMessage calls = %d, want 1", api.calls)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_DeleteMessage_InvalidChatID(t *testing.T) {
+	api := &deleteMessageAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+
+	if err := c.DeleteMessage(context.Background(), "not-a-chat", 7); err == nil {
+		t.Fatal("expected error for invalid chat ID")
+	}
+	if api.calls != 0 {
+		t.Errorf("deleteMessage calls = %d, want 0", api.calls)
+	}
+}
+
+func TestNewTelegramChannel_APIServer(t *testing.T) {
+	api := &deleteMessageAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Channels.Telegram.Token = "123456:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	cfg.Channels.Telegram.APIServer = server.URL + "/"
+
+	c, err := NewTelegramChannel(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewTelegramChannel() error = %v", err)
+	}
+
+	if got, want := c.bot.FileDownloadURL("voice/file_1.oga"), server.URL+"/file/bot"+cfg.Channels.Telegram.Token+"/voice/file_1.oga"; got != want {
+		t.Errorf("FileDownloadURL() = %q, want %q", got, want)
+	}
+	if err := c.DeleteMessage(context.Background(), "42", 7); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if api.calls != 1 {
+		t.Errorf("configured API server received %d calls, want 1", api.calls)
+	}
+}
+
+func TestNewTelegramChannel_InvalidAPIServer(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Channels.Telegram.Token = "123456:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	cfg.Channels.Telegram.APIServer = "localhost:8081"
+
+	if _, err := NewTelegramChannel(cfg, bus.NewMessageBus()); err == nil {
+		t.Fatal("expected error for API server URL without scheme")
+	}
+}
+
+func TestTelegramChannel_SendWithButtons(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+
+	_, err := c.SendWithResult(context.Background(), bus.OutboundMessage{
+		ChatID:  "42",
+		Content: "Run exec?",
+		Buttons: []bus.OutboundButton{
+			{Text: "Approve", Data: "/approve confirm-1"},
+			{Text: "Deny", Data: "/deny confirm-1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+
+	if len(api.bodies) != 1 {
+		t.Fatalf("API calls = %v, want one sendMessage", api.methods)
+	}
+	var req struct {
+		ReplyMarkup struct {
+			InlineKeyboard [][]struct {
+				Text         string `json:"text"`
+				CallbackData string `json:"callback_data"`
+			} `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+	if err := json.Unmarshal([]byte(api.bodies[0]), &req); err != nil {
+		t.Fatalf("failed to parse sendMessage body %q: %v", api.bodies[0], err)
+	}
+	rows := req.ReplyMarkup.InlineKeyboard
+	if len(rows) != 1 || len(rows[0]) != 2 || rows[0][0].CallbackData != "/approve confirm-1" || rows[0][1].Text != "Deny" {
+		t.Errorf("inline keyboard = %+v", rows)
+	}
+}
+
+func TestTelegramChannel_HandleCallbackQuery(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+
+	query := &telego.CallbackQuery{
+		ID:   "q1",
+		From: telego.User{ID: 7, Username: "alice"},
+		Message: &telego.Message{
+			MessageID: 5,
+			Chat:      telego.Chat{ID: 42, Type: "private"},
+		},
+		Data: "/approve confirm-1",
+	}
+	if err := c.handleCallbackQuery(context.Background(), query); err != nil {
+		t.Fatalf("handleCallbackQuery() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message was published")
+	}
+	if msg.Content != "/approve confirm-1" || msg.ChatID != "42" || msg.SenderID != "7" {
+		t.Errorf("inbound message = %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "7" {
+		t.Errorf("metadata = %v, want direct peer 7", msg.Metadata)
+	}
+
+	wantMethods := []string{"answerCallbackQuery", "editMessageReplyMarkup"}
+	if !reflect.DeepEqual(api.methods, wantMethods) {
+		t.Errorf("API methods = %v, want %v", api.methods, wantMethods)
+	}
+}
+
+// TestTelegramChannel_CallbackQueryFromRequester verifies that a button
+// press carries the same sender ID as the typed message that led to the
+// pending action, since only that sender may approve or deny it.
+func TestTelegramChannel_CallbackQueryFromRequester(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+	alice := telego.User{ID: 7, Username: "alice"}
+	consume := func() bus.InboundMessage {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		msg, ok := c.bus.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatal("no inbound message was published")
+		}
+		return msg
+	}
+
+	typed := &telego.Message{
+		MessageID: 4,
+		From:      &alice,
+		Chat:      telego.Chat{ID: 42, Type: "group"},
+		Text:      "delete the old logs",
+	}
+	if err := c.handleMessage(context.Background(), typed); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+	request := consume()
+
+	query := &telego.CallbackQuery{
+		ID:   "q1",
+		From: alice,
+		Message: &telego.Message{
+			MessageID: 5,
+			Chat:      telego.Chat{ID: 42, Type: "group"},
+		},
+		Data: "/approve confirm-1",
+	}
+	if err := c.handleCallbackQuery(context.Background(), query); err != nil {
+		t.Fatalf("handleCallbackQuery() error = %v", err)
+	}
+	approval := consume()
+
+	if approval.Content != "/approve confirm-1" || approval.ChatID != request.ChatID {
+		t.Errorf("approval = %+v, want /approve in chat %s", approval, request.ChatID)
+	}
+	if approval.SenderID != request.SenderID {
+		t.Errorf("approval sender = %q, want the requester %q", approval.SenderID, request.SenderID)
+	}
+}
+
+func TestTelegramChannel_StartStopTyping(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+
+	if err := c.StartTyping(context.Background(), "-100123", "5"); err != nil {
+		t.Fatalf("StartTyping() error = %v", err)
+	}
+	if _, ok := c.stopThinking.Load("-100123"); !ok {
+		t.Error("typing indicator is not tracked for the chat")
+	}
+	c.StopTyping("-100123")
+	if _, ok := c.stopThinking.Load("-100123"); ok {
+		t.Error("typing indicator still tracked after StopTyping")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.methods) != 1 || api.methods[0] != "sendChatAction" {
+		t.Fatalf("API methods = %v, want one sendChatAction", api.methods)
+	}
+	if !strings.Contains(api.bodies[0], `"message_thread_id":5`) || !strings.Contains(api.bodies[0], `"action":"typing"`) {
+		t.Errorf("sendChatAction body = %s", api.bodies[0])
+	}
+
+	if err := c.StartTyping(context.Background(), "not-a-chat", ""); err == nil {
+		t.Error("StartTyping() with an invalid chat ID succeeded")
+	}
+}
+
+func TestTelegramCommands_Stats(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	commands := &cmd{bot: c.bot, config: c.config}
+	commands.stats = func(ctx context.Context) BotStats {
+		return BotStats{
+			Uptime:         90*time.Minute + 400*time.Millisecond,
+			ActiveSessions: 3,
+			SubagentTasks:  map[string]int{"running": 1, "completed": 4},
+			MemoryEnabled:  true,
+			MemoryMessages: 1234,
+			MemoryStatus:   "green",
+		}
+	}
+
+	message := telego.Message{MessageID: 5, Chat: telego.Chat{ID: 42}, Text: "/stats"}
+	if err := commands.Stats(context.Background(), message); err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if len(api.methods) != 1 || api.methods[0] != "sendMessage" {
+		t.Fatalf("API methods = %v, want [sendMessage]", api.methods)
+	}
+
+	var params struct {
+		Text      string `json:"text"`
+		ParseMode string `json:"parse_mode"`
+	}
+	if err := json.Unmarshal([]byte(api.bodies[0]), &params); err != nil {
+		t.Fatalf("decode sendMessage body: %v", err)
+	}
+	if params.ParseMode != telego.ModeHTML {
+		t.Errorf("parse_mode = %q, want HTML", params.ParseMode)
+	}
+	for _, want := range []string{
+		"<b>Uptime:</b> 1h30m0s",
+		"<b>Active sessions:</b> 3",
+		"<b>Subagent tasks:</b> 4 completed, 1 running",
+		"<b>Memory:</b> 1234 messages (green)",
+	} {
+		if !strings.Contains(params.Text, want) {
+			t.Errorf("stats message missing %q:\n%s", want, params.Text)
+		}
+	}
+}
+
+func TestTelegramCommands_Cancel(t *testing.T) {
+	tests := []struct {
+		name     string
+		active   bool
+		wantText string
+	}{
+		{name: "request in progress", active: true, wantText: "Canceled."},
+		{name: "nothing running", active: false, wantText: "Nothing to cancel."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeTelegramAPI{}
+			c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+			var gotChannel, gotChatID string
+			commands := &cmd{bot: c.bot, config: c.config}
+			commands.cancel = func(channel, chatID string) bool {
+				gotChannel, gotChatID = channel, chatID
+				return tt.active
+			}
+
+			message := telego.Message{MessageID: 5, Chat: telego.Chat{ID: 42}, Text: "/cancel"}
+			if err := commands.Cancel(context.Background(), message); err != nil {
+				t.Fatalf("Cancel() error = %v", err)
+			}
+			if gotChannel != "telegram" || gotChatID != "42" {
+				t.Errorf("cancelled %s:%s, want telegram:42", gotChannel, gotChatID)
+			}
+			if len(api.bodies) != 1 || !strings.Contains(api.bodies[0], tt.wantText) {
+				t.Errorf("reply bodies = %v, want %q", api.bodies, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_BusinessConnection(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+	c.setRunning(true)
+
+	business := &telego.Message{
+		MessageID:            5,
+		From:                 &telego.User{ID: 7},
+		Chat:                 telego.Chat{ID: 7, Type: "private"},
+		Text:                 "do you deliver on sundays?",
+		BusinessConnectionID: "biz-1",
+	}
+	if err := c.handleMessage(context.Background(), business); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message published")
+	}
+	if got := msg.Metadata["business_connection_id"]; got != "biz-1" {
+		t.Errorf("metadata business_connection_id = %q, want biz-1", got)
+	}
+
+	if _, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "7", Content: "yes"}); err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if len(api.bodies) != 1 || !strings.Contains(api.bodies[0], `"business_connection_id":"biz-1"`) {
+		t.Fatalf("reply not sent through the business connection: %v", api.bodies)
+	}
+
+	// The same user writing to the bot directly gets a regular reply
+	direct := &telego.Message{MessageID: 6, From: &telego.User{ID: 7}, Chat: telego.Chat{ID: 7, Type: "private"}, Text: "hi bot"}
+	if err := c.handleMessage(context.Background(), direct); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+	if msg, ok := c.bus.ConsumeInbound(ctx); !ok || msg.Metadata["business_connection_id"] != "" {
+		t.Fatalf("direct message: ok = %v, metadata = %v", ok, msg.Metadata)
+	}
+	if _, err := c.SendWithResult(context.Background(), bus.OutboundMessage{ChatID: "7", Content: "hello"}); err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if last := api.bodies[len(api.bodies)-1]; strings.Contains(last, "business_connection_id") {
+		t.Errorf("direct reply sent through a business connection: %s", last)
+	}
+}
+
+func TestTelegramChannel_EmptyMessages(t *testing.T) {
+	sticker := &telego.Message{
+		MessageID: 9,
+		From:      &telego.User{ID: 7},
+		Chat:      telego.Chat{ID: 7, Type: "private"},
+		Sticker:   &telego.Sticker{FileID: "sticker-file"},
+	}
+	consume := func(c *TelegramChannel) (bus.InboundMessage, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		return c.bus.ConsumeInbound(ctx)
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		reply       string
+		wantContent string // inbound content; empty if dropped
+		wantReply   string // text sent back; empty if none
+	}{
+		{name: "placeholder by default", wantContent: "[empty message]"},
+		{name: "ignore drops the message", mode: EmptyMessagesIgnore},
+		{name: "reply answers instead", mode: EmptyMessagesReply, reply: "Send me some text!", wantReply: "Send me some text!"},
+		{name: "reply uses the built-in message", mode: EmptyMessagesReply, wantReply: "What would you like to ask?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeTelegramAPI{}
+			c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+			c.config.Channels.Telegram.EmptyMessages = tt.mode
+			c.config.Channels.Telegram.EmptyMessageReply = tt.reply
+
+			if err := c.handleMessage(context.Background(), sticker); err != nil {
+				t.Fatalf("handleMessage() error = %v", err)
+			}
+
+			msg, ok := consume(c)
+			if tt.wantContent == "" && ok {
+				t.Errorf("empty message was passed on: %+v", msg)
+			}
+			if tt.wantContent != "" && (!ok || msg.Content != tt.wantContent) {
+				t.Errorf("inbound = %+v (ok=%v), want content %q", msg, ok, tt.wantContent)
+			}
+
+			if tt.wantReply == "" {
+				if len(api.bodies) != 0 {
+					t.Errorf("unexpected reply: %v", api.bodies)
+				}
+				return
+			}
+			if len(api.bodies) != 1 || !strings.Contains(api.bodies[0], tt.wantReply) || !strings.Contains(api.bodies[0], `"message_id":9`) {
+				t.Errorf("reply = %v, want %q in reply to the message", api.bodies, tt.wantReply)
+			}
+		})
+	}
+
+	// Whitespace counts as empty, but a message with text is unaffected
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+	c.config.Channels.Telegram.EmptyMessages = EmptyMessagesIgnore
+	for _, text := range []string{"  \n ", "hi"} {
+		msg := &telego.Message{MessageID: 10, From: &telego.User{ID: 7}, Chat: telego.Chat{ID: 7, Type: "private"}, Text: text}
+		if err := c.handleMessage(context.Background(), msg); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+	}
+	if msg, ok := consume(c); !ok || msg.Content != "hi" {
+		t.Errorf("inbound = %+v (ok=%v), want only the text message", msg, ok)
+	}
+	if msg, ok := consume(c); ok {
+		t.Errorf("unexpected second inbound message: %+v", msg)
+	}
+}
+
+// wellFormedHTML reports whether Telegram HTML nests its tags properly.
+func wellFormedHTML(html string) error {
+	dec := xml.NewDecoder(strings.NewReader("<root>" + html + "</root>"))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func TestMarkdownToTelegramHTML_SubagentResult(t *testing.T) {
+	// Typical model output cut short by the subagent summary limit
+	result := "**Findings** for the ~~old **API~~ docs**:\n" +
+		"- `config.go` reads __env__ vars\n" +
+		"```go\nif a < b && c > d {\n\treturn **p"
+
+	if err := wellFormedHTML(markdownToTelegramHTML(result)); err == nil {
+		t.Fatal("raw result unexpectedly rendered to well-formed HTML; the test no longer covers the repair")
+	}
+
+	html := markdownToTelegramHTML(utils.SanitizeMarkdown(result))
+	if err := wellFormedHTML(html); err != nil {
+		t.Errorf("sanitized result rendered to malformed HTML: %v\n%s", err, html)
+	}
+	if !strings.Contains(html, "<pre><code>") || !strings.Contains(html, "return **p") {
+		t.Errorf("code block was not rendered verbatim:\n%s", html)
+	}
+}
+
+func TestMarkdownToTelegramHTML_SpoilerAndExpandableQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "spoiler",
+			input: "The answer is ||42 <exactly>||.",
+			want:  "The answer is <tg-spoiler>42 &lt;exactly&gt;</tg-spoiler>.",
+		},
+		{
+			name:  "spoiler inside inline code is literal",
+			input: "Use `a || b` here",
+			want:  "Use <code>a || b</code> here",
+		},
+		{
+			name:  "expandable quote",
+			input: "Output:\n**>first line\n> second **bold** line\n>last||\nDone",
+			want:  "Output:\n<blockquote expandable>first line\nsecond <b>bold</b> line\nlast</blockquote>\nDone",
+		},
+		{
+			name:  "single-line expandable quote with spoiler",
+			input: "**>secret: ||hunter2||||",
+			want:  "<blockquote expandable>secret: <tg-spoiler>hunter2</tg-spoiler></blockquote>",
+		},
+		{
+			name:  "unterminated expandable quote is bold text",
+			input: "**>not a quote**",
+			want:  "<b>&gt;not a quote</b>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToTelegramHTML(tt.input); got != tt.want {
+				t.Errorf("markdownToTelegramHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToTelegramHTML_Underscores(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"snake_case identifier", "set my_var_name to 1", "set my_var_name to 1"},
+		{"two identifiers", "copy src_dir_path to dst_dir_path", "copy src_dir_path to dst_dir_path"},
+		{"unpaired leading underscore", "call _private() first", "call _private() first"},
+		{"file path", "see /var/log/my_app/_cache_/error_log.txt", "see /var/log/my_app/_cache_/error_log.txt"},
+		{"windows path", `C:\_tmp_\x`, `C:\_tmp_\x`},
+		{"double underscores inside words", "a__b__c", "a__b__c"},
+		{"italic word", "this is _important_.", "this is <i>important</i>."},
+		{"italic phrase", "_read this first_ please", "<i>read this first</i> please"},
+		{"italic with identifier inside", "_use my_var here_", "<i>use my_var here</i>"},
+		{"italic in parentheses", "(_see below_)", "(<i>see below</i>)"},
+		{"non-ASCII italic", "_привет_ мир", "<i>привет</i> мир"},
+		{"bold with underscores", "__Note:__ done", "<b>Note:</b> done"},
+		{"spaces around underscores", "a _ b _ c", "a _ b _ c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToTelegramHTML(tt.input); got != tt.want {
+				t.Errorf("markdownToTelegramHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
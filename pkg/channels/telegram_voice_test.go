@@ -0,0 +1,412 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// stubSynthesizer writes fixed audio bytes to a temp file and records the text.
+type stubSynthesizer struct {
+	dir   string
+	text  string
+	path  string
+	calls int
+}
+
+func (s *stubSynthesizer) Synthesize(ctx context.Context, text string) (string, error) {
+	s.calls++
+	s.text = text
+	s.path = filepath.Join(s.dir, "reply.ogg")
+	return s.path, os.WriteFile(s.path, []byte("OggS-fake-audio"), 0o644)
+}
+
+// fakeTelegramAPI records the methods called, their JSON bodies and the
+// uploaded voice payload. Each sent message gets the next message ID, starting at 1.
+// Identity the fake API reports for getMe
+const (
+	fakeBotID       = 999
+	fakeBotUsername = "pico_bot"
+)
+
+type fakeTelegramAPI struct {
+	mu        sync.Mutex
+	methods   []string
+	bodies    []string
+	voice     string
+	chatID    string
+	messageID int
+}
+
+func (f *fakeTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// File downloads: /file/bot<token>/<file_path>
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		w.Write([]byte("OggS-incoming-audio"))
+		return
+	}
+
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if method == "getMe" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":     true,
+			"result": map[string]any{"id": fakeBotID, "is_bot": true, "first_name": "Pico", "username": fakeBotUsername},
+		})
+		return
+	}
+	if method == "getFile" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":     true,
+			"result": map[string]any{"file_id": "voice-file", "file_unique_id": "u1", "file_path": "voice/file_1.oga"},
+		})
+		return
+	}
+
+	f.mu.Lock()
+	f.methods = append(f.methods, method)
+	body := ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}
+	f.bodies = append(f.bodies, body)
+	if method == "sendVoice" {
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			f.chatID = r.FormValue("chat_id")
+			if file, _, err := r.FormFile("voice"); err == nil {
+				data, _ := io.ReadAll(file)
+				f.voice = string(data)
+				file.Close()
+			}
+		}
+	}
+	f.messageID++
+	messageID := f.messageID
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":     true,
+		"result": map[string]any{"message_id": messageID, "date": 0, "chat": map[string]any{"id": 42, "type": "private"}},
+	})
+}
+
+func newTestTelegramChannel(t *testing.T, api http.Handler, voiceReply config.TelegramVoiceReplyConfig) *TelegramChannel {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	bot, err := telego.NewBot("123456:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		telego.WithAPIServer(server.URL), telego.WithDiscardLogger())
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Telegram.VoiceReply = voiceReply
+	return &TelegramChannel{
+		BaseChannel: NewBaseChannel("telegram", cfg.Channels.Telegram, bus.NewMessageBus(), nil),
+		bot:         bot,
+		config:      cfg,
+		chatIDs:     make(map[string]int64),
+	}
+}
+
+func TestTelegramChannel_SendVoiceReply(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{Enabled: true})
+	synth := &stubSynthesizer{dir: t.TempDir()}
+	c.SetSynthesizer(synth)
+
+	if err := c.sendVoiceReply(context.Background(), 42, 0, "**Hello** there"); err != nil {
+		t.Fatalf("sendVoiceReply() error = %v", err)
+	}
+
+	if synth.text != "Hello there" {
+		t.Errorf("synthesized text = %q, want markdown stripped", synth.text)
+	}
+	if len(api.methods) != 1 || api.methods[0] != "sendVoice" {
+		t.Fatalf("API methods = %v, want [sendVoice]", api.methods)
+	}
+	if api.voice != "OggS-fake-audio" || api.chatID != "42" {
+		t.Errorf("sendVoice got voice=%q chat_id=%q", api.voice, api.chatID)
+	}
+	if _, err := os.Stat(synth.path); !os.IsNotExist(err) {
+		t.Errorf("synthesized file %s was not cleaned up", synth.path)
+	}
+}
+
+func TestTelegramChannel_ShouldReplyWithVoice(t *testing.T) {
+	enabled := config.TelegramVoiceReplyConfig{Enabled: true}
+	always := config.TelegramVoiceReplyConfig{Enabled: true, Trigger: "always"}
+	tests := []struct {
+		name       string
+		voiceReply config.TelegramVoiceReplyConfig
+		synth      bool
+		voiceNote  bool
+		replyTo    string
+		want       bool
+	}{
+		{name: "disabled", voiceReply: config.TelegramVoiceReplyConfig{}, synth: true, voiceNote: true, replyTo: "7", want: false},
+		{name: "no synthesizer", voiceReply: enabled, voiceNote: true, replyTo: "7", want: false},
+		{name: "voice trigger reply to voice note", voiceReply: enabled, synth: true, voiceNote: true, replyTo: "7", want: true},
+		{name: "voice trigger reply to text", voiceReply: enabled, synth: true, replyTo: "7", want: false},
+		{name: "voice trigger reply to another message", voiceReply: enabled, synth: true, voiceNote: true, replyTo: "8", want: false},
+		{name: "voice trigger unprompted send after voice note", voiceReply: enabled, synth: true, voiceNote: true, want: false},
+		{name: "always trigger reply", voiceReply: always, synth: true, replyTo: "7", want: true},
+		{name: "always trigger unprompted send", voiceReply: always, synth: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestTelegramChannel(t, &fakeTelegramAPI{}, tt.voiceReply)
+			if tt.synth {
+				c.SetSynthesizer(&stubSynthesizer{dir: t.TempDir()})
+			}
+			if tt.voiceNote {
+				c.rememberVoiceNote("42", "7")
+			}
+			msg := bus.OutboundMessage{Channel: "telegram", ChatID: "42", ReplyTo: tt.replyTo}
+			if got := c.shouldReplyWithVoice(msg); got != tt.want {
+				t.Errorf("shouldReplyWithVoice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_VoiceReplyOnlyOnce(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{Enabled: true})
+	c.SetSynthesizer(&stubSynthesizer{dir: t.TempDir()})
+	c.rememberVoiceNote("42", "7")
+
+	msg := bus.OutboundMessage{Channel: "telegram", ChatID: "42", ReplyTo: "7"}
+	if !c.shouldReplyWithVoice(msg) {
+		t.Fatal("first reply to the voice note is not spoken")
+	}
+	if c.shouldReplyWithVoice(msg) {
+		t.Error("second reply to the voice note is spoken too")
+	}
+}
+
+func TestTelegramChannel_RememberVoiceNoteDropsStaleNotes(t *testing.T) {
+	c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{Enabled: true})
+	c.voiceNotes.Store(voiceNoteKey("42", "1"), time.Now().Add(-2*voiceNoteTTL))
+	c.rememberVoiceNote("42", "2")
+
+	if _, ok := c.voiceNotes.Load(voiceNoteKey("42", "1")); ok {
+		t.Error("stale voice note was kept")
+	}
+	if _, ok := c.voiceNotes.Load(voiceNoteKey("42", "2")); !ok {
+		t.Error("new voice note was not recorded")
+	}
+}
+
+// stubTranscriber returns a fixed transcription and records the language hint.
+type stubTranscriber struct {
+	text     string
+	language string
+	calls    int
+}
+
+func (s *stubTranscriber) Transcribe(ctx context.Context, audioFilePath, language string) (*voice.TranscriptionResponse, error) {
+	s.calls++
+	s.language = language
+	return &voice.TranscriptionResponse{Text: s.text}, nil
+}
+
+func (s *stubTranscriber) IsAvailable() bool {
+	return true
+}
+
+// handleVoiceMessage runs a voice note from a user with languageCode through
+// handleMessage and returns the published inbound content.
+func handleVoiceMessage(t *testing.T, c *TelegramChannel, languageCode string) string {
+	t.Helper()
+
+	msg := &telego.Message{
+		MessageID: 7,
+		Chat:      telego.Chat{ID: 42, Type: "private"},
+		From:      &telego.User{ID: 1001, FirstName: "Ana", LanguageCode: languageCode},
+		Voice:     &telego.Voice{FileID: "voice-file", FileUniqueID: "u1", Duration: 2},
+	}
+	if err := c.handleMessage(context.Background(), msg); err != nil {
+		t.Fatalf("handleMessage() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	inbound, ok := c.bus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	return inbound.Content
+}
+
+func TestTelegramChannel_TranscriptionLanguageHint(t *testing.T) {
+	tests := []struct {
+		name         string
+		languageCode string
+		want         string
+	}{
+		{name: "language code forwarded", languageCode: "de", want: "de"},
+		{name: "region suffix dropped", languageCode: "pt-br", want: "pt"},
+		{name: "absent means auto-detect", languageCode: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+			transcriber := &stubTranscriber{text: "hallo"}
+			c.SetTranscriber(transcriber)
+
+			content := handleVoiceMessage(t, c, tt.languageCode)
+
+			if transcriber.calls != 1 {
+				t.Fatalf("transcriber called %d times, want 1", transcriber.calls)
+			}
+			if transcriber.language != tt.want {
+				t.Errorf("language = %q, want %q", transcriber.language, tt.want)
+			}
+			if !strings.Contains(content, "hallo") {
+				t.Errorf("content %q does not contain transcription", content)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_TranscriptionFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{name: "default", format: "", want: "[voice transcription: turn on the lights] [file_id: voice-file]"},
+		{name: "raw", format: "raw", want: "turn on the lights"},
+		{name: "template", format: "🎤 {text}", want: "🎤 turn on the lights"},
+		{name: "template with file id", format: "{text} (voice {file_id})", want: "turn on the lights (voice voice-file)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+			c.config.Channels.Telegram.TranscriptionFormat = tt.format
+			c.SetTranscriber(&stubTranscriber{text: "turn on the lights"})
+
+			if got := handleVoiceMessage(t, c, "en"); got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramChannel_VoiceFallback(t *testing.T) {
+	voiceMessage := &telego.Message{
+		MessageID: 7,
+		Chat:      telego.Chat{ID: 42, Type: "private"},
+		From:      &telego.User{ID: 1001, FirstName: "Ana"},
+		Voice:     &telego.Voice{FileID: "voice-file", FileUniqueID: "u1", Duration: 2},
+	}
+	consume := func(c *TelegramChannel) (bus.InboundMessage, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		return c.bus.ConsumeInbound(ctx)
+	}
+
+	t.Run("reply asks the user to type", func(t *testing.T) {
+		api := &fakeTelegramAPI{}
+		c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+		c.config.Channels.Telegram.VoiceFallback = VoiceFallbackReply
+		c.config.Channels.Telegram.VoiceFallbackMessage = "Please type, I can't hear you."
+
+		if err := c.handleMessage(context.Background(), voiceMessage); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+		if msg, ok := consume(c); ok {
+			t.Fatalf("voice message was passed on: %+v", msg)
+		}
+		if len(api.methods) != 1 || api.methods[0] != "sendMessage" {
+			t.Fatalf("API methods = %v, want [sendMessage]", api.methods)
+		}
+		if !strings.Contains(api.bodies[0], "Please type, I can't hear you.") || !strings.Contains(api.bodies[0], `"message_id":7`) {
+			t.Errorf("fallback reply = %s", api.bodies[0])
+		}
+	})
+
+	t.Run("reply uses the built-in message", func(t *testing.T) {
+		api := &fakeTelegramAPI{}
+		c := newTestTelegramChannel(t, api, config.TelegramVoiceReplyConfig{})
+		c.config.Channels.Telegram.VoiceFallback = VoiceFallbackReply
+
+		if err := c.handleMessage(context.Background(), voiceMessage); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+		if len(api.bodies) != 1 || !strings.Contains(api.bodies[0], "Please type your message instead.") {
+			t.Errorf("fallback reply = %v", api.bodies)
+		}
+	})
+
+	t.Run("reply is skipped while transcription works", func(t *testing.T) {
+		c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+		c.config.Channels.Telegram.VoiceFallback = VoiceFallbackReply
+		c.SetTranscriber(&stubTranscriber{text: "hello"})
+
+		if content := handleVoiceMessage(t, c, ""); !strings.Contains(content, "hello") {
+			t.Errorf("content = %q, want the transcription", content)
+		}
+	})
+
+	t.Run("forward attaches the audio", func(t *testing.T) {
+		c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+		c.config.Channels.Telegram.VoiceFallback = VoiceFallbackForward
+
+		if err := c.handleMessage(context.Background(), voiceMessage); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+		msg, ok := consume(c)
+		if !ok {
+			t.Fatal("expected inbound message")
+		}
+		if len(msg.Audio) != 1 {
+			t.Fatalf("Audio = %v, want the voice note", msg.Audio)
+		}
+		data, err := os.ReadFile(msg.Audio[0])
+		if err != nil || string(data) != "OggS-incoming-audio" {
+			t.Errorf("forwarded audio = %q, %v", data, err)
+		}
+		if !strings.Contains(msg.Content, "[voice]") {
+			t.Errorf("content = %q", msg.Content)
+		}
+	})
+
+	t.Run("placeholder by default", func(t *testing.T) {
+		c := newTestTelegramChannel(t, &fakeTelegramAPI{}, config.TelegramVoiceReplyConfig{})
+
+		if err := c.handleMessage(context.Background(), voiceMessage); err != nil {
+			t.Fatalf("handleMessage() error = %v", err)
+		}
+		msg, ok := consume(c)
+		if !ok {
+			t.Fatal("expected inbound message")
+		}
+		if msg.Content != "[voice] [file_id: voice-file]" || len(msg.Audio) != 0 {
+			t.Errorf("got content %q, audio %v", msg.Content, msg.Audio)
+		}
+	})
+}
@@ -59,6 +59,9 @@ type Config struct {
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
 	Devices   DevicesConfig   `json:"devices"`
 	Storage   StorageConfig   `json:"storage,omitempty"`
+	// Moderation checks replies before they are sent and messages before
+	// they are stored in long-term memory.
+	Moderation ModerationConfig `json:"moderation,omitempty"`
 }
 
 // MarshalJSON implements custom JSON marshaling for Config
@@ -79,7 +82,9 @@ func (c Config) MarshalJSON() ([]byte, error) {
 	}
 
 	// Only include session if not empty
-	if c.Session.DMScope != "" || len(c.Session.IdentityLinks) > 0 {
+	if c.Session.DMScope != "" || c.Session.GroupScope != "" || len(c.Session.IdentityLinks) > 0 ||
+		c.Session.IdleTTLHours != 0 || c.Session.ForgetMemoryOnEvict || c.Session.CompactJSON ||
+		c.Session.Compress {
 		aux.Session = &c.Session
 	}
 
@@ -138,8 +143,17 @@ type AgentConfig struct {
 	Model     *AgentModelConfig `json:"model,omitempty"`
 	Skills    []string          `json:"skills,omitempty"`
 	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+	// ChatOnly makes the agent pure chat: no file, exec, web or other tools
+	// are registered, except the conversation tools listed in ChatTools
+	// ("message", "session", "summarize_session").
+	ChatOnly  bool     `json:"chat_only,omitempty"`
+	ChatTools []string `json:"chat_tools,omitempty"`
 }
 
+// ChatOnlyTools are the tools a chat-only agent may keep. None of them
+// touch the filesystem or run commands.
+var ChatOnlyTools = []string{"message", "session", "summarize_session"}
+
 type SubagentsConfig struct {
 	AllowAgents []string          `json:"allow_agents,omitempty"`
 	Model       *AgentModelConfig `json:"model,omitempty"`
@@ -171,25 +185,137 @@ type SessionConfig struct {
 	// - "per-account-channel-peer": Per-account+channel+user DM sessions
 	// Default: "per-channel-peer"
 	DMScope       string              `json:"dm_scope,omitempty"`
+	// GroupScope controls group chat session isolation granularity:
+	// - "per-chat": One session per group chat, shared by all members and threads
+	// - "per-thread": One session per thread (forum topic) of a group chat
+	// - "per-user": One session per member of a group chat (...:user:<user_id>)
+	// - "per-thread-user": One session per member of each thread
+	// Default: "per-thread"
+	GroupScope    string              `json:"group_scope,omitempty"`
 	// IdentityLinks maps canonical user names to their platform-specific IDs
 	// Used to collapse multiple identities (e.g., Telegram + Discord) into one session
 	IdentityLinks map[string][]string `json:"identity_links,omitempty"`
+	// IdleTTLHours unloads sessions from memory after this many hours without
+	// activity; their files stay on disk and are reloaded on the next message.
+	// 0 keeps sessions in memory once loaded.
+	IdleTTLHours int `json:"idle_ttl_hours,omitempty" env:"PICOCLAW_SESSION_IDLE_TTL_HOURS"`
+	// ForgetMemoryOnEvict also deletes an evicted session's messages from
+	// the Qdrant message store.
+	ForgetMemoryOnEvict bool `json:"forget_memory_on_evict,omitempty" env:"PICOCLAW_SESSION_FORGET_MEMORY_ON_EVICT"`
+	// CompactJSON writes session files without indentation, which keeps long
+	// histories smaller and faster to load. Indented files are easier to read
+	// when debugging.
+	CompactJSON bool `json:"compact_json,omitempty" env:"PICOCLAW_SESSION_COMPACT_JSON"`
+	// Compress gzips session files (<key>.json.gz). Existing .json files are
+	// still loaded and converted on their next save.
+	Compress bool `json:"compress,omitempty" env:"PICOCLAW_SESSION_COMPRESS"`
+	// SaveEvery saves a session to disk after this many new messages, so a
+	// crash in a long turn loses at most that many. Sessions are still saved
+	// at the end of every turn. 0 disables it.
+	SaveEvery int `json:"save_every,omitempty" env:"PICOCLAW_SESSION_SAVE_EVERY"`
 }
 
 type AgentDefaults struct {
-	Workspace           string         `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool           `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string         `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	ModelName           string         `json:"model_name,omitempty"            env:"PICOCLAW_AGENTS_DEFAULTS_MODEL_NAME"`
-	Model               string         `json:"model,omitempty"                 env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"` // Deprecated: use model_name instead
-	ModelFallbacks      []string       `json:"model_fallbacks,omitempty"`
-	ImageModel          string         `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
-	ImageModelFallbacks []string       `json:"image_model_fallbacks,omitempty"`
-	MaxTokens           int            `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	ContextWindow       int            `json:"context_window,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"`
-	Temperature         *float64       `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int            `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
-	Compaction          CompactionConfig `json:"compaction,omitempty"`
+	Workspace           string   `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace bool     `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider            string   `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	ModelName           string   `json:"model_name,omitempty"            env:"PICOCLAW_AGENTS_DEFAULTS_MODEL_NAME"`
+	Model               string   `json:"model,omitempty"                 env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"` // Deprecated: use model_name instead
+	ModelFallbacks      []string `json:"model_fallbacks,omitempty"`
+	ImageModel          string   `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
+	ImageModelFallbacks []string `json:"image_model_fallbacks,omitempty"`
+	// SubagentModel is used by spawned subagents that have no agent-specific
+	// model, e.g. a cheaper or faster one. Unset uses the agent's own model.
+	SubagentModel string `json:"subagent_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUBAGENT_MODEL"`
+	// MaxConcurrentSubagents limits how many synchronous subagents (the
+	// subagent and parallel_subagents tools) run at once. 0 is unlimited.
+	MaxConcurrentSubagents int `json:"max_concurrent_subagents,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_CONCURRENT_SUBAGENTS"`
+	// SubagentAnnounceTemplate formats the message a finished spawned subagent
+	// sends to the main agent. Placeholders: {label}, {status}, {result},
+	// {iterations}, {duration} and {files}. Unset uses
+	// "Task '{label}' {status} in {duration}.\n\nResult:\n{result}{files}".
+	SubagentAnnounceTemplate string   `json:"subagent_announce_template,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUBAGENT_ANNOUNCE_TEMPLATE"`
+	MaxTokens                int      `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	ContextWindow            int      `json:"context_window,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"`
+	Temperature              *float64 `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	// ToolTemperature overrides Temperature for LLM calls that follow a tool
+	// call within the same turn (e.g. 0 for deterministic tool use). Unset keeps Temperature.
+	ToolTemperature   *float64 `json:"tool_temperature,omitempty"      env:"PICOCLAW_AGENTS_DEFAULTS_TOOL_TEMPERATURE"`
+	MaxToolIterations int      `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	// MaxIterationsMessage is prepended to the reply when the agent runs out of
+	// tool iterations before producing a final answer.
+	MaxIterationsMessage string `json:"max_iterations_message,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_ITERATIONS_MESSAGE"`
+	// MaxContinuations is how often a reply cut off by max_tokens is
+	// continued automatically; the parts are joined into one reply. 0
+	// sends the cut-off reply as is.
+	MaxContinuations int `json:"max_continuations,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_CONTINUATIONS"`
+	// TrimImpersonatedTurns cuts a reply at the first line, outside code
+	// blocks, where the model starts writing the user's next turn ("User:",
+	// "Human:"). Off by default, as ordinary replies can contain such lines;
+	// prefer stop_sequences in model_list where the model supports them.
+	TrimImpersonatedTurns bool `json:"trim_impersonated_turns,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TRIM_IMPERSONATED_TURNS"`
+	// EmptyResponseMessage replaces a final reply that is empty or only
+	// whitespace. Unset uses a built-in placeholder.
+	EmptyResponseMessage string `json:"empty_response_message,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_EMPTY_RESPONSE_MESSAGE"`
+	// SuppressEmptyResponse sends nothing instead of a placeholder when the
+	// final reply is empty.
+	SuppressEmptyResponse bool             `json:"suppress_empty_response,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUPPRESS_EMPTY_RESPONSE"`
+	Compaction            CompactionConfig `json:"compaction,omitempty"`
+	// Timezone is the IANA name (e.g. "Europe/Berlin") of the time zone the
+	// agent is told the current time in. Unset uses the system time zone.
+	Timezone string `json:"timezone,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TIMEZONE"`
+	// DailyBudget limits how much each user may use the bot per day.
+	DailyBudget DailyBudgetConfig `json:"daily_budget,omitempty"`
+	// MessageWorkers limits how many inbound messages are processed at once.
+	MessageWorkers MessageWorkersConfig `json:"message_workers,omitempty"`
+	// ChannelPrompts changes the system prompt for requests from a channel,
+	// keyed by channel name (e.g. "telegram").
+	ChannelPrompts map[string]ChannelPromptConfig `json:"channel_prompts,omitempty"`
+}
+
+// ChannelPromptConfig changes the system prompt for one channel.
+type ChannelPromptConfig struct {
+	// Override replaces the built-in identity and rules section. Workspace
+	// files, tools, skills and memory are still included.
+	Override string `json:"override,omitempty"`
+	// Append is added at the end of the system prompt, e.g. "Keep replies short."
+	Append string `json:"append,omitempty"`
+}
+
+// MessageWorkersConfig sizes the pool that processes inbound messages. A
+// session handles one message at a time, so workers beyond the first help
+// when several conversations are active.
+type MessageWorkersConfig struct {
+	// Count is how many messages are processed at once. Default: 1
+	Count int `json:"count,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MESSAGE_WORKERS_COUNT"`
+	// QueueSize is how many messages may wait for a worker; beyond that new
+	// messages stay on the message bus. Default: 100
+	QueueSize int `json:"queue_size,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MESSAGE_WORKERS_QUEUE_SIZE"`
+	// BusyMessage is sent to a user whose message has to wait because all
+	// workers are busy. Unset sends nothing.
+	BusyMessage string `json:"busy_message,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MESSAGE_WORKERS_BUSY_MESSAGE"`
+}
+
+// DailyBudgetConfig caps the messages and provider tokens per user or
+// session per day. Zero limits are unlimited.
+type DailyBudgetConfig struct {
+	// Scope is "user" (default) to count per sender across chats, or
+	// "session" to count per conversation.
+	Scope       string `json:"scope,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_BUDGET_SCOPE"`
+	MaxMessages int    `json:"max_messages,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_BUDGET_MAX_MESSAGES"`
+	MaxTokens   int    `json:"max_tokens,omitempty"   env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_BUDGET_MAX_TOKENS"`
+	// ResetTime is the time of day ("HH:MM") at which budgets reset, in
+	// agents.defaults.timezone or else the system time zone. Unset resets at
+	// midnight.
+	ResetTime   string `json:"reset_time,omitempty"   env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_BUDGET_RESET_TIME"`
+	// Message is sent instead of a reply once the budget is used up. Unset
+	// uses a built-in message that mentions the reset time.
+	Message     string `json:"message,omitempty"      env:"PICOCLAW_AGENTS_DEFAULTS_DAILY_BUDGET_MESSAGE"`
+}
+
+// Enabled reports whether any limit is set.
+func (c DailyBudgetConfig) Enabled() bool {
+	return c.MaxMessages > 0 || c.MaxTokens > 0
 }
 
 type CompactionConfig struct {
@@ -233,6 +359,57 @@ type TelegramConfig struct {
 	Token     string              `json:"token"      env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	Proxy     string              `json:"proxy"      env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	// APIServer is the Bot API server base URL, for self-hosted telegram-bot-api
+	// servers (e.g. "http://localhost:8081"). Empty uses https://api.telegram.org.
+	APIServer string `json:"api_server,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_API_SERVER"`
+	// FormatMode selects how markdown is rendered for outgoing messages:
+	// - "html": convert to HTML and send with parse_mode=HTML (default)
+	// - "entities": send plain text with MessageEntity offsets (no escaping issues)
+	FormatMode string `json:"format_mode,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_FORMAT_MODE"`
+	// TranscriptionFormat controls how a voice transcription becomes message content:
+	// - "" (default): "[voice transcription: {text}] [file_id: {file_id}]"
+	// - "raw": the transcribed text only
+	// - any other value is a template with {text} and {file_id} placeholders
+	TranscriptionFormat string `json:"transcription_format,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_TRANSCRIPTION_FORMAT"`
+	// VoiceFallback controls voice messages while no transcriber is available:
+	// - "placeholder" (default): pass "[voice]" and the file ID to the agent
+	// - "reply": answer with VoiceFallbackMessage and drop the voice message
+	// - "forward": attach the audio to the message for models that accept audio input
+	VoiceFallback string `json:"voice_fallback,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_FALLBACK"`
+	// VoiceFallbackMessage is the answer in "reply" mode. Unset uses a
+	// built-in message asking the user to type.
+	VoiceFallbackMessage string `json:"voice_fallback_message,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_FALLBACK_MESSAGE"`
+	// EmptyMessages controls messages without text, caption or supported
+	// media, e.g. a lone sticker or location:
+	// - "placeholder" (default): pass "[empty message]" to the agent
+	// - "ignore": drop the message without answering
+	// - "reply": answer with EmptyMessageReply and drop the message
+	EmptyMessages string `json:"empty_messages,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_EMPTY_MESSAGES"`
+	// EmptyMessageReply is the answer in "reply" mode. Unset uses a built-in
+	// message asking the user to write something.
+	EmptyMessageReply string `json:"empty_message_reply,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_EMPTY_MESSAGE_REPLY"`
+	// VoiceReply sends synthesized voice notes alongside text replies.
+	VoiceReply TelegramVoiceReplyConfig `json:"voice_reply,omitempty"`
+	// MentionOnly makes the bot answer group messages only when it is
+	// @-mentioned or replied to. Direct messages are always answered.
+	MentionOnly bool `json:"mention_only,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_MENTION_ONLY"`
+	// ThreadSplitReplies sends parts 2..N of a long reply as replies to the
+	// previous part, so the reply reads as one thread.
+	ThreadSplitReplies bool `json:"thread_split_replies,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_THREAD_SPLIT_REPLIES"`
+}
+
+// TelegramVoiceReplyConfig configures spoken replies via an OpenAI-compatible TTS API.
+type TelegramVoiceReplyConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_ENABLED"`
+	// Trigger controls when a voice reply is sent:
+	// - "voice": only in reply to a voice note (default)
+	// - "always": in reply to every user message
+	// Announcements, message tool sends and error reports are never spoken.
+	Trigger string `json:"trigger,omitempty"  env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_TRIGGER"`
+	APIBase string `json:"api_base,omitempty" env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_API_BASE"`
+	APIKey  string `json:"api_key,omitempty"  env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_API_KEY"`
+	Model   string `json:"model,omitempty"    env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_MODEL"`
+	Voice   string `json:"voice,omitempty"    env:"PICOCLAW_CHANNELS_TELEGRAM_VOICE_REPLY_VOICE"`
 }
 
 type FeishuConfig struct {
@@ -350,6 +527,78 @@ type QdrantConfig struct {
 	Collection    string `json:"collection" env:"PICOCLAW_STORAGE_QDRANT_COLLECTION"`
 	VectorSize    int    `json:"vector_size" env:"PICOCLAW_STORAGE_QDRANT_VECTOR_SIZE"` // Dimension of embedding vectors
 	Secure        bool   `json:"secure" env:"PICOCLAW_STORAGE_QDRANT_SECURE"`          // Use HTTPS
+	// StoreToolResults also stores tool results (role "tool") and tool calls
+	// (role "tool_call") so earlier tool output can be recalled
+	StoreToolResults bool `json:"store_tool_results,omitempty" env:"PICOCLAW_STORAGE_QDRANT_STORE_TOOL_RESULTS"`
+	// BatchPerTurn buffers the messages of a turn and stores them in one
+	// batch in the background when the turn ends, instead of embedding each
+	// message while the turn runs. Buffered messages are stored on shutdown.
+	BatchPerTurn bool `json:"batch_per_turn,omitempty" env:"PICOCLAW_STORAGE_QDRANT_BATCH_PER_TURN"`
+	// QueryExpansionTurns prepends this many recent messages of the current
+	// conversation to memory search queries, improving recall for short
+	// follow-up questions. 0 disables expansion.
+	QueryExpansionTurns int `json:"query_expansion_turns,omitempty" env:"PICOCLAW_STORAGE_QDRANT_QUERY_EXPANSION_TURNS"`
+	// QueryExpansionMaxChars caps the prepended context. Default: 500
+	QueryExpansionMaxChars int `json:"query_expansion_max_chars,omitempty" env:"PICOCLAW_STORAGE_QDRANT_QUERY_EXPANSION_MAX_CHARS"`
+	// SearchRetries is how often a memory search is retried after a
+	// transient failure (network error, timeout, 429 or 5xx). Default: 2
+	SearchRetries int `json:"search_retries" env:"PICOCLAW_STORAGE_QDRANT_SEARCH_RETRIES"`
+	// MemorySearchOptional answers with no memories instead of failing the
+	// request when memory search keeps failing. Default: true
+	MemorySearchOptional bool `json:"memory_search_optional" env:"PICOCLAW_STORAGE_QDRANT_MEMORY_SEARCH_OPTIONAL"`
+	// HNSW tunes the collection's vector index. Like Quantization it only
+	// applies when the collection is created; unset values keep Qdrant's
+	// defaults.
+	HNSW QdrantHNSWConfig `json:"hnsw,omitempty"`
+	// Quantization stores vectors as int8 to save memory on large stores.
+	Quantization QdrantQuantizationConfig `json:"quantization,omitempty"`
+}
+
+// QdrantHNSWConfig sets the HNSW index parameters of a new collection. Zero
+// values are left to Qdrant (m 16, ef_construct 100).
+type QdrantHNSWConfig struct {
+	// M is the number of edges per node; lower values use less memory at
+	// the cost of recall
+	M           int `json:"m,omitempty"            env:"PICOCLAW_STORAGE_QDRANT_HNSW_M"`
+	// EfConstruct is the number of neighbours considered while building
+	// the index; higher values build a more accurate index more slowly
+	EfConstruct int `json:"ef_construct,omitempty" env:"PICOCLAW_STORAGE_QDRANT_HNSW_EF_CONSTRUCT"`
+}
+
+// QdrantQuantizationConfig enables scalar (int8) quantization of a new
+// collection, which cuts vector memory about four times.
+type QdrantQuantizationConfig struct {
+	Enabled   bool    `json:"enabled"              env:"PICOCLAW_STORAGE_QDRANT_QUANTIZATION_ENABLED"`
+	// Quantile excludes outlying values when computing the int8 range,
+	// between 0.5 and 1. Unset uses Qdrant's default of 0.99.
+	Quantile  float64 `json:"quantile,omitempty"   env:"PICOCLAW_STORAGE_QDRANT_QUANTIZATION_QUANTILE"`
+	// AlwaysRAM keeps the quantized vectors in memory even when the
+	// original vectors are on disk
+	AlwaysRAM bool    `json:"always_ram,omitempty" env:"PICOCLAW_STORAGE_QDRANT_QUANTIZATION_ALWAYS_RAM"`
+}
+
+// ModerationConfig configures the content filter. Flagged replies are
+// blocked or sent with a warning logged; flagged messages are never stored
+// in long-term memory.
+type ModerationConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_MODERATION_ENABLED"`
+	// Provider is "rules" (default) to match Rules locally, or "api" to call
+	// an OpenAI-compatible /moderations endpoint.
+	Provider string `json:"provider,omitempty" env:"PICOCLAW_MODERATION_PROVIDER"`
+	// Rules are phrases that flag content, matched ignoring case.
+	Rules []string `json:"rules,omitempty" env:"PICOCLAW_MODERATION_RULES"`
+	// APIBase defaults to https://api.openai.com/v1.
+	APIBase string `json:"api_base,omitempty" env:"PICOCLAW_MODERATION_API_BASE"`
+	APIKey  string `json:"api_key,omitempty" env:"PICOCLAW_MODERATION_API_KEY"`
+	Model   string `json:"model,omitempty" env:"PICOCLAW_MODERATION_MODEL"`
+	// OutboundAction is "block" (default) to replace a flagged reply with
+	// BlockedMessage, or "warn" to send it and log a warning.
+	OutboundAction string `json:"outbound_action,omitempty" env:"PICOCLAW_MODERATION_OUTBOUND_ACTION"`
+	// BlockedMessage replaces blocked replies. Unset uses a built-in text.
+	BlockedMessage string `json:"blocked_message,omitempty" env:"PICOCLAW_MODERATION_BLOCKED_MESSAGE"`
+	// FailClosed treats content as flagged when the check fails, e.g. the
+	// API is down. By default such content is allowed.
+	FailClosed bool `json:"fail_closed,omitempty" env:"PICOCLAW_MODERATION_FAIL_CLOSED"`
 }
 
 // EmbeddingConfig configures embedding model for vector generation
@@ -358,6 +607,13 @@ type EmbeddingConfig struct {
 	Model   string `json:"model" env:"PICOCLAW_EMBEDDING_MODEL"` // e.g., "mistral/mistral-embed"
 	APIBase string `json:"api_base" env:"PICOCLAW_EMBEDDING_API_BASE"`
 	APIKey  string `json:"api_key" env:"PICOCLAW_EMBEDDING_API_KEY"`
+	// MaxConcurrency limits parallel embedding requests when storing messages
+	// in bulk, to stay within the API's rate limits. Default: 1
+	MaxConcurrency int `json:"max_concurrency,omitempty" env:"PICOCLAW_EMBEDDING_MAX_CONCURRENCY"`
+	// Dimensions asks models that support it for shorter vectors and
+	// truncates longer ones, trading a little accuracy for smaller storage.
+	// Must match storage.qdrant.vector_size. 0 keeps the model's full size.
+	Dimensions int `json:"dimensions,omitempty" env:"PICOCLAW_EMBEDDING_DIMENSIONS"`
 }
 
 type ProvidersConfig struct {
@@ -450,6 +706,10 @@ type ModelConfig struct {
 	// Optional optimizations
 	RPM            int    `json:"rpm,omitempty"`              // Requests per minute limit
 	MaxTokensField string `json:"max_tokens_field,omitempty"` // Field name for max tokens (e.g., "max_completion_tokens")
+
+	// StopSequences are sent with every request to this model, e.g. ["\nUser:"]
+	// to stop models that start writing the user's next turn.
+	StopSequences []string `json:"stop_sequences,omitempty"`
 }
 
 // Validate checks if the ModelConfig has all required fields.
@@ -466,6 +726,15 @@ func (c *ModelConfig) Validate() error {
 type GatewayConfig struct {
 	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
 	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	// PersistInbound keeps inbound messages in workspace/state/inbound.json
+	// until they are handled, so messages in flight during a crash are
+	// processed after the restart.
+	PersistInbound bool `json:"persist_inbound,omitempty" env:"PICOCLAW_GATEWAY_PERSIST_INBOUND"`
+	// HealthAddr is the listen address of the health endpoints (/healthz,
+	// /readyz), e.g. ":8080". Unset serves them on host:port.
+	HealthAddr string `json:"health_addr,omitempty" env:"PICOCLAW_GATEWAY_HEALTH_ADDR"`
+	// Metrics serves Prometheus metrics at /metrics on the health address
+	Metrics bool `json:"metrics,omitempty" env:"PICOCLAW_GATEWAY_METRICS"`
 }
 
 type WebUIConfig struct {
@@ -515,13 +784,67 @@ type CronToolsConfig struct {
 type ExecConfig struct {
 	EnableDenyPatterns bool     `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
 	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	// DeniedCommands lists binaries that may never be run (e.g. "sudo", "curl").
+	// Unset uses a built-in list of privilege, power and disk commands; an empty
+	// list disables it. The check is best effort: commands built at run time
+	// are not seen.
+	DeniedCommands []string `json:"denied_commands,omitempty" env:"PICOCLAW_TOOLS_EXEC_DENIED_COMMANDS"`
+	// AllowedCommands, if non-empty, is the only set of binaries that may be run.
+	AllowedCommands []string `json:"allowed_commands,omitempty" env:"PICOCLAW_TOOLS_EXEC_ALLOWED_COMMANDS"`
+	// TimeoutSeconds kills a command and its child processes after this long
+	// (default 60). Calls may ask for a shorter timeout.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" env:"PICOCLAW_TOOLS_EXEC_TIMEOUT_SECONDS"`
+	// MaxOutputBytes caps the captured stdout and stderr, each (default 10000).
+	MaxOutputBytes int `json:"max_output_bytes,omitempty" env:"PICOCLAW_TOOLS_EXEC_MAX_OUTPUT_BYTES"`
+	// StreamOutput sends partial output of long-running commands to the chat
+	// every StreamIntervalSeconds (default 10).
+	StreamOutput          bool `json:"stream_output,omitempty" env:"PICOCLAW_TOOLS_EXEC_STREAM_OUTPUT"`
+	StreamIntervalSeconds int  `json:"stream_interval_seconds,omitempty" env:"PICOCLAW_TOOLS_EXEC_STREAM_INTERVAL_SECONDS"`
 }
 
 type ToolsConfig struct {
-	Web    WebToolsConfig    `json:"web"`
-	Cron   CronToolsConfig   `json:"cron"`
-	Exec   ExecConfig        `json:"exec"`
-	Skills SkillsToolsConfig `json:"skills"`
+	Web          WebToolsConfig     `json:"web"`
+	Cron         CronToolsConfig    `json:"cron"`
+	Exec         ExecConfig         `json:"exec"`
+	Skills       SkillsToolsConfig  `json:"skills"`
+	Confirmation ConfirmationConfig `json:"confirmation,omitempty"`
+	Audit        AuditConfig        `json:"audit,omitempty"`
+	Cache        ToolCacheConfig    `json:"cache,omitempty"`
+}
+
+// ConfirmationConfig makes destructive tools wait for the user's approval.
+// The user approves with a button (Telegram) or by replying "/approve <id>",
+// and denies with "/deny <id>".
+type ConfirmationConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_CONFIRMATION_ENABLED"`
+	// Tools lists the gated tools; empty means exec, write_file, edit_file,
+	// append_file, write_files, apply_patch and session. The session tool's
+	// forget_all action, which deletes long-term memory, is gated even when
+	// disabled or not listed.
+	Tools []string `json:"tools,omitempty" env:"PICOCLAW_TOOLS_CONFIRMATION_TOOLS"`
+	// TimeoutSeconds is how long a request waits for an answer (default 600).
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" env:"PICOCLAW_TOOLS_CONFIRMATION_TIMEOUT_SECONDS"`
+}
+
+// AuditConfig records every tool execution with its session, redacted
+// arguments, status and duration.
+type AuditConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_AUDIT_ENABLED"`
+	// Path of the append-only JSON-lines audit file; relative paths are
+	// resolved against the default agent's workspace. Empty writes entries
+	// to the log instead.
+	Path string `json:"path,omitempty" env:"PICOCLAW_TOOLS_AUDIT_PATH"`
+}
+
+// ToolCacheConfig serves repeated calls of read-only tools such as
+// web_fetch and web_search with identical arguments from memory. exec and
+// the file-writing tools are never cached.
+type ToolCacheConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_CACHE_ENABLED"`
+	// TTLSeconds is how long a result is reused (default 300).
+	TTLSeconds int `json:"ttl_seconds,omitempty" env:"PICOCLAW_TOOLS_CACHE_TTL_SECONDS"`
+	// MaxEntries bounds the cached results (default 100).
+	MaxEntries int `json:"max_entries,omitempty" env:"PICOCLAW_TOOLS_CACHE_MAX_ENTRIES"`
 }
 
 type SkillsToolsConfig struct {
@@ -10,13 +10,15 @@ func DefaultConfig() *Config {
 	return &Config{
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:           "~/.picoclaw/workspace",
-				RestrictToWorkspace: true,
-				Provider:            "",
-				Model:               "glm-4.7",
-				MaxTokens:           8192,
-				Temperature:         nil, // nil means use provider default
-				MaxToolIterations:   20,
+				Workspace:              "~/.picoclaw/workspace",
+				RestrictToWorkspace:    true,
+				Provider:               "",
+				Model:                  "glm-4.7",
+				MaxTokens:              8192,
+				Temperature:            nil, // nil means use provider default
+				MaxToolIterations:      20,
+				MaxContinuations:       2,
+				MaxConcurrentSubagents: 3,
 			},
 		},
 		Bindings: []AgentBinding{},
@@ -337,6 +339,9 @@ func DefaultConfig() *Config {
 				Collection: "picoclaw_messages",
 				VectorSize: 1024, // mistral-embed dimension
 				Secure:     false,
+
+				SearchRetries:        2,
+				MemorySearchOptional: true,
 			},
 			Embedding: EmbeddingConfig{
 				Enabled: false,
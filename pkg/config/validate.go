@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found by Config.Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks settings that only make sense together, such as an enabled
+// channel without credentials, so misconfigurations fail at startup instead
+// of surfacing later as runtime errors. It returns a *ValidationError listing
+// every problem, or nil.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	for i := range c.ModelList {
+		if err := c.ModelList[i].Validate(); err != nil {
+			v.addf("model_list[%d]: %v", i, err)
+		}
+	}
+
+	c.validateChannels(v)
+	c.validateStorage(v)
+
+	switch c.Session.GroupScope {
+	case "", "per-chat", "per-thread", "per-user", "per-thread-user":
+	default:
+		v.addf("session.group_scope %q is not one of \"per-chat\", \"per-thread\", \"per-user\" or \"per-thread-user\"",
+			c.Session.GroupScope)
+	}
+
+	if c.Session.IdleTTLHours < 0 {
+		v.addf("session.idle_ttl_hours must not be negative")
+	}
+	if c.Session.SaveEvery < 0 {
+		v.addf("session.save_every must not be negative")
+	}
+
+	c.validateBudget(v)
+	c.validateMessageWorkers(v)
+	c.validateModeration(v)
+
+	for i, agent := range c.Agents.List {
+		if len(agent.ChatTools) > 0 && !agent.ChatOnly {
+			v.addf("agents.list[%d].chat_tools requires chat_only", i)
+		}
+		for _, name := range agent.ChatTools {
+			if !slices.Contains(ChatOnlyTools, name) {
+				v.addf("agents.list[%d].chat_tools: %q is not one of %q", i, name, ChatOnlyTools)
+			}
+		}
+	}
+
+	if c.Agents.Defaults.MaxConcurrentSubagents < 0 {
+		v.addf("agents.defaults.max_concurrent_subagents must not be negative")
+	}
+
+	if c.Tools.Cache.TTLSeconds < 0 {
+		v.addf("tools.cache.ttl_seconds must not be negative")
+	}
+	if c.Tools.Cache.MaxEntries < 0 {
+		v.addf("tools.cache.max_entries must not be negative")
+	}
+
+	if tz := c.Agents.Defaults.Timezone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			v.addf("agents.defaults.timezone %q is not a known time zone", tz)
+		}
+	}
+
+	if c.Gateway.Port < 0 || c.Gateway.Port > 65535 {
+		v.addf("gateway.port %d is not a valid port", c.Gateway.Port)
+	}
+	if c.WebUI.Enabled && (c.WebUI.Port <= 0 || c.WebUI.Port > 65535) {
+		v.addf("webui.port %d is not a valid port", c.WebUI.Port)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func (c *Config) validateChannels(v *validator) {
+	ch := c.Channels
+
+	if ch.Telegram.Enabled {
+		v.required("channels.telegram.token", ch.Telegram.Token, "telegram")
+		switch ch.Telegram.FormatMode {
+		case "", "html", "entities":
+		default:
+			v.addf("channels.telegram.format_mode %q is not one of \"html\" or \"entities\"", ch.Telegram.FormatMode)
+		}
+		if ch.Telegram.APIServer != "" {
+			if u, err := url.Parse(ch.Telegram.APIServer); err != nil ||
+				(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.addf("channels.telegram.api_server %q must be an http or https URL", ch.Telegram.APIServer)
+			}
+		}
+		switch ch.Telegram.VoiceFallback {
+		case "", "placeholder", "reply", "forward":
+		default:
+			v.addf("channels.telegram.voice_fallback %q is not one of \"placeholder\", \"reply\" or \"forward\"",
+				ch.Telegram.VoiceFallback)
+		}
+		switch ch.Telegram.EmptyMessages {
+		case "", "placeholder", "ignore", "reply":
+		default:
+			v.addf("channels.telegram.empty_messages %q is not one of \"placeholder\", \"ignore\" or \"reply\"",
+				ch.Telegram.EmptyMessages)
+		}
+		if ch.Telegram.VoiceReply.Enabled {
+			switch ch.Telegram.VoiceReply.Trigger {
+			case "", "voice", "always":
+			default:
+				v.addf("channels.telegram.voice_reply.trigger %q is not one of \"voice\" or \"always\"",
+					ch.Telegram.VoiceReply.Trigger)
+			}
+		}
+	}
+	if ch.Discord.Enabled {
+		v.required("channels.discord.token", ch.Discord.Token, "discord")
+	}
+	if ch.Slack.Enabled {
+		v.required("channels.slack.bot_token", ch.Slack.BotToken, "slack")
+		v.required("channels.slack.app_token", ch.Slack.AppToken, "slack")
+	}
+	if ch.Feishu.Enabled {
+		v.required("channels.feishu.app_id", ch.Feishu.AppID, "feishu")
+		v.required("channels.feishu.app_secret", ch.Feishu.AppSecret, "feishu")
+	}
+	if ch.QQ.Enabled {
+		v.required("channels.qq.app_id", ch.QQ.AppID, "qq")
+		v.required("channels.qq.app_secret", ch.QQ.AppSecret, "qq")
+	}
+	if ch.DingTalk.Enabled {
+		v.required("channels.dingtalk.client_id", ch.DingTalk.ClientID, "dingtalk")
+		v.required("channels.dingtalk.client_secret", ch.DingTalk.ClientSecret, "dingtalk")
+	}
+	if ch.LINE.Enabled {
+		v.required("channels.line.channel_secret", ch.LINE.ChannelSecret, "line")
+		v.required("channels.line.channel_access_token", ch.LINE.ChannelAccessToken, "line")
+	}
+	if ch.OneBot.Enabled {
+		v.required("channels.onebot.ws_url", ch.OneBot.WSUrl, "onebot")
+	}
+	if ch.WhatsApp.Enabled {
+		v.required("channels.whatsapp.bridge_url", ch.WhatsApp.BridgeURL, "whatsapp")
+	}
+	if ch.WeCom.Enabled {
+		v.required("channels.wecom.token", ch.WeCom.Token, "wecom")
+	}
+	if ch.WeComApp.Enabled {
+		v.required("channels.wecom_app.corp_id", ch.WeComApp.CorpID, "wecom_app")
+		v.required("channels.wecom_app.corp_secret", ch.WeComApp.CorpSecret, "wecom_app")
+	}
+}
+
+func (c *Config) validateStorage(v *validator) {
+	qdrant := c.Storage.Qdrant
+	if qdrant.Enabled {
+		v.required("storage.qdrant.host", qdrant.Host, "qdrant")
+		v.required("storage.qdrant.collection", qdrant.Collection, "qdrant")
+		if qdrant.VectorSize <= 0 {
+			v.addf("storage.qdrant.vector_size must be positive when qdrant is enabled")
+		}
+		if qdrant.SearchRetries < 0 {
+			v.addf("storage.qdrant.search_retries must not be negative")
+		}
+		if qdrant.HNSW.M < 0 {
+			v.addf("storage.qdrant.hnsw.m must not be negative")
+		}
+		if qdrant.HNSW.EfConstruct < 0 {
+			v.addf("storage.qdrant.hnsw.ef_construct must not be negative")
+		}
+		if q := qdrant.Quantization.Quantile; q != 0 && (q < 0.5 || q > 1) {
+			v.addf("storage.qdrant.quantization.quantile %g must be between 0.5 and 1", q)
+		}
+	}
+
+	if dims := c.Storage.Embedding.Dimensions; dims < 0 {
+		v.addf("storage.embedding.dimensions must not be negative")
+	} else if dims > 0 && qdrant.Enabled && dims != qdrant.VectorSize {
+		v.addf("storage.embedding.dimensions (%d) must match storage.qdrant.vector_size (%d)", dims, qdrant.VectorSize)
+	}
+
+	// The embedding key may also come from a mistral-embed entry in model_list
+	if c.Storage.Embedding.Enabled && c.Storage.Embedding.APIKey == "" && !c.hasEmbeddingModelKey() {
+		v.addf("storage.embedding.api_key is required when embedding is enabled " +
+			"(or add a mistral-embed entry with an api_key to model_list)")
+	}
+}
+
+func (c *Config) validateModeration(v *validator) {
+	mod := c.Moderation
+	if !mod.Enabled {
+		return
+	}
+	switch mod.Provider {
+	case "", "rules":
+		if len(mod.Rules) == 0 {
+			v.addf("moderation.rules must not be empty when the rules provider is used")
+		}
+	case "api":
+		if strings.TrimSpace(mod.APIKey) == "" {
+			v.addf("moderation.api_key is required when moderation.provider is \"api\"")
+		}
+	default:
+		v.addf("moderation.provider %q is not one of \"rules\" or \"api\"", mod.Provider)
+	}
+	switch mod.OutboundAction {
+	case "", "block", "warn":
+	default:
+		v.addf("moderation.outbound_action %q is not one of \"block\" or \"warn\"", mod.OutboundAction)
+	}
+}
+
+func (c *Config) validateBudget(v *validator) {
+	budget := c.Agents.Defaults.DailyBudget
+	switch budget.Scope {
+	case "", "user", "session":
+	default:
+		v.addf("agents.defaults.daily_budget.scope %q is not one of \"user\" or \"session\"", budget.Scope)
+	}
+	if budget.MaxMessages < 0 {
+		v.addf("agents.defaults.daily_budget.max_messages must not be negative")
+	}
+	if budget.MaxTokens < 0 {
+		v.addf("agents.defaults.daily_budget.max_tokens must not be negative")
+	}
+	if budget.ResetTime != "" {
+		if _, err := time.Parse("15:04", budget.ResetTime); err != nil {
+			v.addf("agents.defaults.daily_budget.reset_time %q is not a time of day like \"04:00\"", budget.ResetTime)
+		}
+	}
+}
+
+func (c *Config) validateMessageWorkers(v *validator) {
+	if c.Agents.Defaults.MaxContinuations < 0 {
+		v.addf("agents.defaults.max_continuations must not be negative")
+	}
+	workers := c.Agents.Defaults.MessageWorkers
+	if workers.Count < 0 {
+		v.addf("agents.defaults.message_workers.count must not be negative")
+	}
+	if workers.QueueSize < 0 {
+		v.addf("agents.defaults.message_workers.queue_size must not be negative")
+	}
+}
+
+func (c *Config) hasEmbeddingModelKey() bool {
+	for _, m := range c.ModelList {
+		if (m.ModelName == "mistral-embed" || strings.Contains(m.Model, "mistral-embed")) && m.APIKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validator collects validation problems.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// required reports field when value is blank.
+func (v *validator) required(field, value, feature string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required when %s is enabled", field, feature)
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate_DefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config should be valid, got: %v", err)
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.Telegram.Token = "  "
+	cfg.Storage.Qdrant.Enabled = true
+	cfg.Storage.Qdrant.Host = ""
+	cfg.Storage.Embedding.Enabled = true
+
+	err := cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %T: %v", err, err)
+	}
+
+	want := []string{
+		"channels.telegram.token is required when telegram is enabled",
+		"storage.qdrant.host is required when qdrant is enabled",
+		"storage.embedding.api_key is required when embedding is enabled",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %q", len(verr.Problems), len(want), verr.Problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(verr.Problems[i], w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, verr.Problems[i], w)
+		}
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("Error() is missing %q:\n%s", w, err.Error())
+		}
+	}
+}
+
+func TestValidate_InvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   string
+	}{
+		{
+			name: "slack without app token",
+			modify: func(cfg *Config) {
+				cfg.Channels.Slack.Enabled = true
+				cfg.Channels.Slack.BotToken = "xoxb-1"
+			},
+			want: "channels.slack.app_token is required when slack is enabled",
+		},
+		{
+			name: "unknown telegram format mode",
+			modify: func(cfg *Config) {
+				cfg.Channels.Telegram.Enabled = true
+				cfg.Channels.Telegram.Token = "123:abc"
+				cfg.Channels.Telegram.FormatMode = "markdown"
+			},
+			want: `channels.telegram.format_mode "markdown" is not one of "html" or "entities"`,
+		},
+		{
+			name: "telegram api server without scheme",
+			modify: func(cfg *Config) {
+				cfg.Channels.Telegram.Enabled = true
+				cfg.Channels.Telegram.Token = "123:abc"
+				cfg.Channels.Telegram.APIServer = "localhost:8081"
+			},
+			want: `channels.telegram.api_server "localhost:8081" must be an http or https URL`,
+		},
+		{
+			name: "negative tool cache ttl",
+			modify: func(cfg *Config) {
+				cfg.Tools.Cache.Enabled = true
+				cfg.Tools.Cache.TTLSeconds = -1
+			},
+			want: "tools.cache.ttl_seconds must not be negative",
+		},
+		{
+			name: "qdrant quantile out of range",
+			modify: func(cfg *Config) {
+				cfg.Storage.Qdrant.Enabled = true
+				cfg.Storage.Qdrant.Quantization.Enabled = true
+				cfg.Storage.Qdrant.Quantization.Quantile = 0.3
+			},
+			want: "storage.qdrant.quantization.quantile 0.3 must be between 0.5 and 1",
+		},
+		{
+			name: "embedding dimensions differ from vector size",
+			modify: func(cfg *Config) {
+				cfg.Storage.Qdrant.Enabled = true
+				cfg.Storage.Embedding.Dimensions = 256
+			},
+			want: "storage.embedding.dimensions (256) must match storage.qdrant.vector_size (1024)",
+		},
+		{
+			name: "negative message workers",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.MessageWorkers.Count = -1
+			},
+			want: "agents.defaults.message_workers.count must not be negative",
+		},
+		{
+			name: "negative max continuations",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.MaxContinuations = -1
+			},
+			want: "agents.defaults.max_continuations must not be negative",
+		},
+		{
+			name: "unknown telegram empty message mode",
+			modify: func(cfg *Config) {
+				cfg.Channels.Telegram.Enabled = true
+				cfg.Channels.Telegram.Token = "123:abc"
+				cfg.Channels.Telegram.EmptyMessages = "drop"
+			},
+			want: `channels.telegram.empty_messages "drop" is not one of "placeholder", "ignore" or "reply"`,
+		},
+		{
+			name: "unknown telegram voice fallback",
+			modify: func(cfg *Config) {
+				cfg.Channels.Telegram.Enabled = true
+				cfg.Channels.Telegram.Token = "123:abc"
+				cfg.Channels.Telegram.VoiceFallback = "ignore"
+			},
+			want: `channels.telegram.voice_fallback "ignore" is not one of "placeholder", "reply" or "forward"`,
+		},
+		{
+			name: "model list entry without model",
+			modify: func(cfg *Config) {
+				cfg.ModelList = []ModelConfig{{ModelName: "fast"}}
+			},
+			want: "model_list[0]: model is required",
+		},
+		{
+			name: "unknown session group scope",
+			modify: func(cfg *Config) {
+				cfg.Session.GroupScope = "per-member"
+			},
+			want: `session.group_scope "per-member" is not one of`,
+		},
+		{
+			name: "negative session idle ttl",
+			modify: func(cfg *Config) {
+				cfg.Session.IdleTTLHours = -1
+			},
+			want: "session.idle_ttl_hours must not be negative",
+		},
+		{
+			name: "negative session save interval",
+			modify: func(cfg *Config) {
+				cfg.Session.SaveEvery = -1
+			},
+			want: "session.save_every must not be negative",
+		},
+		{
+			name: "negative subagent concurrency",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.MaxConcurrentSubagents = -1
+			},
+			want: "agents.defaults.max_concurrent_subagents must not be negative",
+		},
+		{
+			name: "unknown timezone",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.Timezone = "Mars/Olympus"
+			},
+			want: `agents.defaults.timezone "Mars/Olympus" is not a known time zone`,
+		},
+		{
+			name: "unknown daily budget scope",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.DailyBudget.Scope = "chat"
+			},
+			want: `agents.defaults.daily_budget.scope "chat" is not one of`,
+		},
+		{
+			name: "invalid daily budget reset time",
+			modify: func(cfg *Config) {
+				cfg.Agents.Defaults.DailyBudget.ResetTime = "25:00"
+			},
+			want: `agents.defaults.daily_budget.reset_time "25:00" is not a time of day`,
+		},
+		{
+			name: "moderation rules provider without rules",
+			modify: func(cfg *Config) {
+				cfg.Moderation.Enabled = true
+			},
+			want: "moderation.rules must not be empty when the rules provider is used",
+		},
+		{
+			name: "unknown moderation action",
+			modify: func(cfg *Config) {
+				cfg.Moderation.Enabled = true
+				cfg.Moderation.Rules = []string{"secret plan"}
+				cfg.Moderation.OutboundAction = "drop"
+			},
+			want: `moderation.outbound_action "drop" is not one of "block" or "warn"`,
+		},
+		{
+			name: "unknown chat-only tool",
+			modify: func(cfg *Config) {
+				cfg.Agents.List = []AgentConfig{{ID: "persona", ChatOnly: true, ChatTools: []string{"exec"}}}
+			},
+			want: `agents.list[0].chat_tools: "exec" is not one of`,
+		},
+		{
+			name: "chat tools without chat-only",
+			modify: func(cfg *Config) {
+				cfg.Agents.List = []AgentConfig{{ID: "persona", ChatTools: []string{"message"}}}
+			},
+			want: "agents.list[0].chat_tools requires chat_only",
+		},
+		{
+			name: "webui port out of range",
+			modify: func(cfg *Config) {
+				cfg.WebUI.Port = 70000
+			},
+			want: "webui.port 70000 is not a valid port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_EmbeddingKeyFromModelList(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage.Embedding.Enabled = true
+	cfg.ModelList = append(cfg.ModelList, ModelConfig{
+		ModelName: "mistral-embed",
+		Model:     "mistral/mistral-embed",
+		APIKey:    "key",
+	})
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected model_list key to satisfy embedding, got: %v", err)
+	}
+}
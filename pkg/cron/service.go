@@ -14,6 +14,13 @@ import (
 	"github.com/adhocore/gronx"
 )
 
+// A one-time job whose handler fails is retried after oneShotRetryDelayMS,
+// up to oneShotMaxAttempts runs, so a failed send does not lose it.
+const (
+	oneShotRetryDelayMS = 60_000
+	oneShotMaxAttempts  = 5
+)
+
 type CronSchedule struct {
 	Kind    string `json:"kind"`
 	AtMS    *int64 `json:"atMs,omitempty"`
@@ -37,6 +44,8 @@ type CronJobState struct {
 	LastRunAtMS *int64 `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"`
 	LastError   string `json:"lastError,omitempty"`
+	// Attempts counts the failed runs of a one-time job
+	Attempts int `json:"attempts,omitempty"`
 }
 
 type CronJob struct {
@@ -66,6 +75,7 @@ type CronService struct {
 	running   bool
 	stopChan  chan struct{}
 	gronx     *gronx.Gronx
+	inFlight  map[string]bool // jobs whose handler is running
 }
 
 func NewCronService(storePath string, onJob JobHandler) *CronService {
@@ -73,6 +83,7 @@ func NewCronService(storePath string, onJob JobHandler) *CronService {
 		storePath: storePath,
 		onJob:     onJob,
 		gronx:     gronx.New(),
+		inFlight:  make(map[string]bool),
 	}
 	// Initialize and load store on creation
 	cs.loadStore()
@@ -143,29 +154,17 @@ func (cs *CronService) checkJobs() {
 	now := time.Now().UnixMilli()
 	var dueJobIDs []string
 
-	// Collect jobs that are due (we need to copy them to execute outside lock)
+	// Collect jobs that are due (we need to copy them to execute outside lock).
+	// A job keeps its next run until its handler returns, so a one-time job
+	// interrupted by a crash runs again after a restart instead of being lost.
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
-		if job.Enabled && job.State.NextRunAtMS != nil && *job.State.NextRunAtMS <= now {
+		if job.Enabled && job.State.NextRunAtMS != nil && *job.State.NextRunAtMS <= now && !cs.inFlight[job.ID] {
 			dueJobIDs = append(dueJobIDs, job.ID)
+			cs.inFlight[job.ID] = true
 		}
 	}
 
-	// Reset next run for due jobs before unlocking to avoid duplicate execution.
-	dueMap := make(map[string]bool, len(dueJobIDs))
-	for _, jobID := range dueJobIDs {
-		dueMap[jobID] = true
-	}
-	for i := range cs.store.Jobs {
-		if dueMap[cs.store.Jobs[i].ID] {
-			cs.store.Jobs[i].State.NextRunAtMS = nil
-		}
-	}
-
-	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
-	}
-
 	cs.mu.Unlock()
 
 	// Execute jobs outside lock.
@@ -190,6 +189,9 @@ func (cs *CronService) executeJobByID(jobID string) {
 	cs.mu.RUnlock()
 
 	if callbackJob == nil {
+		cs.mu.Lock()
+		delete(cs.inFlight, jobID)
+		cs.mu.Unlock()
 		return
 	}
 
@@ -201,6 +203,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 	// Now acquire lock to update state
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	delete(cs.inFlight, jobID)
 
 	var job *CronJob
 	for i := range cs.store.Jobs {
@@ -227,7 +230,11 @@ func (cs *CronService) executeJobByID(jobID string) {
 
 	// Compute next run time
 	if job.Schedule.Kind == "at" {
-		if job.DeleteAfterRun {
+		if err != nil && job.State.Attempts+1 < oneShotMaxAttempts {
+			job.State.Attempts++
+			retryAt := time.Now().UnixMilli() + oneShotRetryDelayMS
+			job.State.NextRunAtMS = &retryAt
+		} else if job.DeleteAfterRun && err == nil {
 			cs.removeJobUnsafe(job.ID)
 		} else {
 			job.Enabled = false
@@ -264,8 +271,15 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
+		// Use gronx to calculate next run time, in the job's time zone
 		now := time.UnixMilli(nowMS)
+		if schedule.TZ != "" {
+			if loc, err := time.LoadLocation(schedule.TZ); err == nil {
+				now = now.In(loc)
+			} else {
+				log.Printf("[cron] unknown time zone '%s', using local time: %v", schedule.TZ, err)
+			}
+		}
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
 			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
@@ -283,9 +297,15 @@ func (cs *CronService) recomputeNextRuns() {
 	now := time.Now().UnixMilli()
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
-		if job.Enabled {
-			job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
+		if !job.Enabled {
+			continue
+		}
+		// A one-time job that came due while stopped, or awaits a retry,
+		// keeps its time and runs now
+		if job.Schedule.Kind == "at" && job.State.NextRunAtMS != nil {
+			continue
 		}
+		job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
 	}
 }
 
@@ -1,10 +1,12 @@
 package cron
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestSaveStore_FilePermissions(t *testing.T) {
@@ -36,3 +38,102 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+func TestExecuteJob_RetriesFailedOneShot(t *testing.T) {
+	fail := true
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), func(job *CronJob) (string, error) {
+		if fail {
+			return "", errors.New("send failed")
+		}
+		return "ok", nil
+	})
+
+	atMS := time.Now().UnixMilli() - 1000
+	job, err := cs.AddJob("remind", CronSchedule{Kind: "at", AtMS: &atMS}, "stretch", true, "telegram", "42", "")
+	if err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	cs.store.Jobs[0].State.NextRunAtMS = &atMS
+
+	cs.executeJobByID(job.ID)
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 {
+		t.Fatalf("failed one-shot was removed; jobs = %v", jobs)
+	}
+	state := jobs[0].State
+	if !jobs[0].Enabled || state.Attempts != 1 || state.NextRunAtMS == nil || *state.NextRunAtMS <= time.Now().UnixMilli() {
+		t.Fatalf("failed one-shot not rescheduled: enabled=%v state=%+v", jobs[0].Enabled, state)
+	}
+
+	fail = false
+	cs.executeJobByID(job.ID)
+	if jobs := cs.ListJobs(true); len(jobs) != 0 {
+		t.Errorf("delivered one-shot was kept: %v", jobs)
+	}
+}
+
+func TestExecuteJob_DisablesOneShotAfterMaxAttempts(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), func(job *CronJob) (string, error) {
+		return "", errors.New("send failed")
+	})
+
+	atMS := time.Now().UnixMilli() + 60_000
+	job, err := cs.AddJob("remind", CronSchedule{Kind: "at", AtMS: &atMS}, "stretch", true, "telegram", "42", "")
+	if err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	for i := 0; i < oneShotMaxAttempts; i++ {
+		cs.executeJobByID(job.ID)
+	}
+
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Enabled || jobs[0].State.LastStatus != "error" {
+		t.Errorf("one-shot after %d failures = %+v, want it kept disabled with the error", oneShotMaxAttempts, jobs)
+	}
+}
+
+func TestStart_KeepsOverdueOneShot(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "jobs.json")
+	cs := NewCronService(storePath, nil)
+	atMS := time.Now().UnixMilli() + 60_000
+	if _, err := cs.AddJob("remind", CronSchedule{Kind: "at", AtMS: &atMS}, "stretch", true, "telegram", "42", ""); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	// The reminder came due while the process was stopped
+	overdue := time.Now().UnixMilli() - 60_000
+	cs.store.Jobs[0].Schedule.AtMS = &overdue
+	cs.store.Jobs[0].State.NextRunAtMS = &overdue
+	if err := cs.saveStoreUnsafe(); err != nil {
+		t.Fatalf("saveStoreUnsafe failed: %v", err)
+	}
+
+	restarted := NewCronService(storePath, nil)
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	restarted.Stop()
+
+	jobs := restarted.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].State.NextRunAtMS == nil || *jobs[0].State.NextRunAtMS != overdue {
+		t.Errorf("overdue one-shot not kept for delivery after restart: %+v", jobs)
+	}
+}
+
+func TestComputeNextRun_UsesTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC) // 21:00 in Tokyo
+	next := cs.computeNextRun(&CronSchedule{Kind: "cron", Expr: "0 9 * * *", TZ: "Asia/Tokyo"}, now.UnixMilli())
+	if next == nil {
+		t.Fatal("computeNextRun returned nil")
+	}
+
+	want := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC) // 09:00 in Tokyo
+	if got := time.UnixMilli(*next).UTC(); !got.Equal(want) {
+		t.Errorf("next run = %v, want %v", got, want)
+	}
+}
@@ -11,9 +11,11 @@ import (
 
 type Server struct {
 	server    *http.Server
+	mux       *http.ServeMux
 	mu        sync.RWMutex
 	ready     bool
 	checks    map[string]Check
+	probes    map[string]func() (bool, string)
 	startTime time.Time
 }
 
@@ -31,17 +33,26 @@ type StatusResponse struct {
 }
 
 func NewServer(host string, port int) *Server {
+	return NewServerAddr(fmt.Sprintf("%s:%d", host, port))
+}
+
+// NewServerAddr creates a server listening on addr, e.g. ":8080". Liveness
+// is served at /health and /healthz, readiness at /ready and /readyz.
+func NewServerAddr(addr string) *Server {
 	mux := http.NewServeMux()
 	s := &Server{
 		ready:     false,
 		checks:    make(map[string]Check),
+		probes:    make(map[string]func() (bool, string)),
+		mux:       mux,
 		startTime: time.Now(),
 	}
 
 	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("/healthz", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
+	mux.HandleFunc("/readyz", s.readyHandler)
 
-	addr := fmt.Sprintf("%s:%d", host, port)
 	s.server = &http.Server{
 		Addr:         addr,
 		Handler:      mux,
@@ -103,6 +114,20 @@ func (s *Server) RegisterCheck(name string, checkFn func() (bool, string)) {
 	}
 }
 
+// Handle serves handler at pattern next to the health endpoints, e.g.
+// metrics for the same scraper.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// AddCheck registers a readiness check that runs on every readiness request,
+// unlike RegisterCheck, which records a single result.
+func (s *Server) AddCheck(name string, checkFn func() (bool, string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes[name] = checkFn
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -125,8 +150,23 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	for k, v := range s.checks {
 		checks[k] = v
 	}
+	probes := make(map[string]func() (bool, string), len(s.probes))
+	for k, fn := range s.probes {
+		probes[k] = fn
+	}
 	s.mu.RUnlock()
 
+	// Run the checks without the lock; they may call out over the network
+	for name, fn := range probes {
+		ok, msg := fn()
+		checks[name] = Check{
+			Name:      name,
+			Status:    statusString(ok),
+			Message:   msg,
+			Timestamp: time.Now(),
+		}
+	}
+
 	if !ready {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(StatusResponse{
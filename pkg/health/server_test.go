@@ -0,0 +1,72 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// get requests path from s and decodes the response.
+func get(t *testing.T, s *Server, path string) (int, StatusResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var resp StatusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("GET %s: decode response: %v", path, err)
+	}
+	return rec.Code, resp
+}
+
+func TestServer_Healthz(t *testing.T) {
+	s := NewServerAddr(":0")
+	s.AddCheck("channel:telegram", func() (bool, string) { return false, "not running" })
+
+	// Liveness ignores readiness and failing checks
+	for _, path := range []string{"/health", "/healthz"} {
+		if code, resp := get(t, s, path); code != http.StatusOK || resp.Status != "ok" {
+			t.Errorf("GET %s = %d %q, want 200 ok", path, code, resp.Status)
+		}
+	}
+}
+
+func TestServer_Readyz(t *testing.T) {
+	s := NewServerAddr(":0")
+	telegramRunning, qdrantUp := true, true
+	s.AddCheck("channel:telegram", func() (bool, string) { return telegramRunning, "" })
+	s.AddCheck("qdrant", func() (bool, string) {
+		if qdrantUp {
+			return true, "reachable"
+		}
+		return false, "connection refused"
+	})
+
+	if code, resp := get(t, s, "/readyz"); code != http.StatusServiceUnavailable || resp.Status != "not ready" {
+		t.Errorf("before start = %d %q, want 503 not ready", code, resp.Status)
+	}
+
+	s.SetReady(true)
+	code, resp := get(t, s, "/readyz")
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("healthy = %d %q, want 200 ready", code, resp.Status)
+	}
+	if len(resp.Checks) != 2 || resp.Checks["qdrant"].Status != "ok" {
+		t.Errorf("healthy checks = %+v", resp.Checks)
+	}
+
+	// Checks run on every request, so a failure shows up immediately
+	qdrantUp = false
+	code, resp = get(t, s, "/readyz")
+	if code != http.StatusServiceUnavailable || resp.Status != "not ready" {
+		t.Errorf("qdrant down = %d %q, want 503 not ready", code, resp.Status)
+	}
+	if check := resp.Checks["qdrant"]; check.Status != "fail" || check.Message != "connection refused" {
+		t.Errorf("qdrant check = %+v, want a failure with the error", check)
+	}
+
+	qdrantUp, telegramRunning = true, false
+	if code, resp := get(t, s, "/ready"); code != http.StatusServiceUnavailable || resp.Checks["channel:telegram"].Status != "fail" {
+		t.Errorf("telegram stopped = %d %+v, want 503 with the channel failing", code, resp.Checks)
+	}
+}
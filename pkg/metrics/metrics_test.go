@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A test counter.", "channel", "status")
+	c.Inc("telegram", StatusOK)
+	c.Inc("telegram", StatusOK)
+	c.Add(3, "slack", Status(errors.New("boom")))
+	c.Inc(`we"ird`, StatusOK)
+
+	if got := c.Value("telegram", StatusOK); got != 2 {
+		t.Errorf("Value() = %v, want 2", got)
+	}
+
+	var sb strings.Builder
+	c.write(&sb)
+	want := "# HELP test_counter_total A test counter.\n" +
+		"# TYPE test_counter_total counter\n" +
+		`test_counter_total{channel="slack",status="error"} 3` + "\n" +
+		`test_counter_total{channel="telegram",status="ok"} 2` + "\n" +
+		`test_counter_total{channel="we\"ird",status="ok"} 1` + "\n"
+	if sb.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", sb.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A test histogram.", []float64{1, 5}, "model")
+	h.Observe(0.5, "gpt")
+	h.Observe(2, "gpt")
+	h.Observe(10, "gpt")
+
+	if got := h.Count("gpt"); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+
+	var sb strings.Builder
+	h.write(&sb)
+	want := "# HELP test_duration_seconds A test histogram.\n" +
+		"# TYPE test_duration_seconds histogram\n" +
+		`test_duration_seconds_bucket{model="gpt",le="1"} 1` + "\n" +
+		`test_duration_seconds_bucket{model="gpt",le="5"} 2` + "\n" +
+		`test_duration_seconds_bucket{model="gpt",le="+Inf"} 3` + "\n" +
+		`test_duration_seconds_sum{model="gpt"} 12.5` + "\n" +
+		`test_duration_seconds_count{model="gpt"} 3` + "\n"
+	if sb.String() != want {
+		t.Errorf("output =\n%s\nwant\n%s", sb.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	MessagesProcessed.Inc("handler-test")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE picoclaw_messages_processed_total counter\n",
+		`picoclaw_messages_processed_total{channel="handler-test"} 1` + "\n",
+		"# TYPE picoclaw_provider_request_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+}
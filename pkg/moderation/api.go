@@ -0,0 +1,106 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultModerationAPIBase is used when no API base is configured.
+const defaultModerationAPIBase = "https://api.openai.com/v1"
+
+// APIModerator checks text with an OpenAI-compatible /moderations endpoint.
+type APIModerator struct {
+	apiBase    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewAPIModerator creates a moderator calling apiBase + "/moderations". An
+// empty model lets the service choose.
+func NewAPIModerator(apiBase, apiKey, model string) *APIModerator {
+	if apiBase == "" {
+		apiBase = defaultModerationAPIBase
+	}
+	return &APIModerator{
+		apiBase: strings.TrimRight(apiBase, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type moderationRequest struct {
+	Model string `json:"model,omitempty"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// Check sends text to the moderation API. The reason lists the flagged
+// categories.
+func (m *APIModerator) Check(ctx context.Context, text string) (Verdict, error) {
+	body, err := json.Marshal(moderationRequest{Model: m.model, Input: text})
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to marshal moderation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.apiBase+"/moderations", bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return Verdict{}, fmt.Errorf("moderation request failed: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+
+	var result moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+	if len(result.Results) == 0 {
+		return Verdict{}, fmt.Errorf("moderation response has no results")
+	}
+
+	var verdict Verdict
+	var categories []string
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		verdict.Flagged = true
+		for name, hit := range r.Categories {
+			if hit {
+				categories = append(categories, name)
+			}
+		}
+	}
+	sort.Strings(categories)
+	verdict.Reason = strings.Join(categories, ", ")
+	return verdict, nil
+}
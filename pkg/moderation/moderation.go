@@ -0,0 +1,145 @@
+// Package moderation checks outbound and stored content against a local
+// rule set or an external moderation API.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Outbound actions for flagged replies
+const (
+	ActionBlock = "block"
+	ActionWarn  = "warn"
+)
+
+// Providers of moderation checks
+const (
+	ProviderRules = "rules"
+	ProviderAPI   = "api"
+)
+
+// defaultBlockedMessage replaces a blocked reply when none is configured.
+const defaultBlockedMessage = "This reply was withheld by the content filter."
+
+// checkTimeout bounds a single moderation check.
+const checkTimeout = 10 * time.Second
+
+// Verdict is the outcome of a moderation check.
+type Verdict struct {
+	Flagged bool
+	// Reason names what was flagged, e.g. a rule or API categories
+	Reason string
+}
+
+// Moderator checks a piece of text.
+type Moderator interface {
+	Check(ctx context.Context, text string) (Verdict, error)
+}
+
+// Filter applies a Moderator to outbound messages and stored content. A nil
+// *Filter allows everything.
+type Filter struct {
+	moderator      Moderator
+	action         string
+	failClosed     bool
+	blockedMessage string
+}
+
+// NewFilter creates a filter around moderator. action is ActionBlock
+// (default) or ActionWarn. With failClosed, content whose check fails is
+// treated as flagged; otherwise it is allowed.
+func NewFilter(moderator Moderator, action string, failClosed bool, blockedMessage string) *Filter {
+	if action == "" {
+		action = ActionBlock
+	}
+	if blockedMessage == "" {
+		blockedMessage = defaultBlockedMessage
+	}
+	return &Filter{
+		moderator:      moderator,
+		action:         action,
+		failClosed:     failClosed,
+		blockedMessage: blockedMessage,
+	}
+}
+
+// New creates the filter configured by cfg, or nil if moderation is
+// disabled.
+func New(cfg config.ModerationConfig) (*Filter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var moderator Moderator
+	switch cfg.Provider {
+	case "", ProviderRules:
+		moderator = NewRuleModerator(cfg.Rules)
+	case ProviderAPI:
+		moderator = NewAPIModerator(cfg.APIBase, cfg.APIKey, cfg.Model)
+	default:
+		return nil, fmt.Errorf("unknown moderation provider %q", cfg.Provider)
+	}
+	return NewFilter(moderator, cfg.OutboundAction, cfg.FailClosed, cfg.BlockedMessage), nil
+}
+
+// flagged checks text, applying the fail-open or fail-closed policy when
+// the check itself fails.
+func (f *Filter) flagged(ctx context.Context, text string) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	verdict, err := f.moderator.Check(ctx, text)
+	if err != nil {
+		logger.WarnCF("moderation", "Moderation check failed", map[string]any{
+			"error":       err.Error(),
+			"fail_closed": f.failClosed,
+		})
+		return f.failClosed, "moderation check failed"
+	}
+	return verdict.Flagged, verdict.Reason
+}
+
+// Outbound returns the content to send instead of text. Flagged text is
+// replaced by the blocked message, or sent unchanged with a warning logged
+// when the action is ActionWarn.
+func (f *Filter) Outbound(ctx context.Context, channel, chatID, text string) string {
+	if f == nil || strings.TrimSpace(text) == "" {
+		return text
+	}
+	flagged, reason := f.flagged(ctx, text)
+	if !flagged {
+		return text
+	}
+
+	fields := map[string]any{
+		"channel": channel,
+		"chat_id": chatID,
+		"reason":  reason,
+		"action":  f.action,
+	}
+	if f.action == ActionWarn {
+		logger.WarnCF("moderation", "Sending flagged reply", fields)
+		return text
+	}
+	logger.WarnCF("moderation", "Blocked flagged reply", fields)
+	return f.blockedMessage
+}
+
+// AllowStore reports whether text may be kept in long-term memory. Flagged
+// content is never stored, whatever the outbound action.
+func (f *Filter) AllowStore(ctx context.Context, text string) bool {
+	if f == nil || strings.TrimSpace(text) == "" {
+		return true
+	}
+	flagged, reason := f.flagged(ctx, text)
+	if flagged {
+		logger.WarnCF("moderation", "Not storing flagged message", map[string]any{"reason": reason})
+	}
+	return !flagged
+}
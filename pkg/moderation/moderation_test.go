@@ -0,0 +1,144 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// failingModerator returns an error for every check.
+type failingModerator struct{}
+
+func (failingModerator) Check(ctx context.Context, text string) (Verdict, error) {
+	return Verdict{}, errors.New("unavailable")
+}
+
+func TestFilter_Outbound(t *testing.T) {
+	rules := NewRuleModerator([]string{"secret plan", " "})
+	ctx := context.Background()
+
+	block := NewFilter(rules, ActionBlock, false, "")
+	if got := block.Outbound(ctx, "telegram", "1", "Here is the SECRET PLAN"); got != defaultBlockedMessage {
+		t.Errorf("block = %q, want the blocked message", got)
+	}
+	if got := block.Outbound(ctx, "telegram", "1", "hello"); got != "hello" {
+		t.Errorf("clean reply = %q, want it unchanged", got)
+	}
+
+	custom := NewFilter(rules, ActionBlock, false, "Withheld.")
+	if got := custom.Outbound(ctx, "telegram", "1", "secret plan"); got != "Withheld." {
+		t.Errorf("custom blocked message = %q", got)
+	}
+
+	warn := NewFilter(rules, ActionWarn, false, "")
+	if got := warn.Outbound(ctx, "telegram", "1", "secret plan"); got != "secret plan" {
+		t.Errorf("warn = %q, want the reply sent unchanged", got)
+	}
+
+	var disabled *Filter
+	if got := disabled.Outbound(ctx, "telegram", "1", "secret plan"); got != "secret plan" {
+		t.Errorf("nil filter = %q, want the reply unchanged", got)
+	}
+}
+
+func TestFilter_AllowStore(t *testing.T) {
+	ctx := context.Background()
+
+	// Flagged content is never stored, even when replies only warn
+	warn := NewFilter(NewRuleModerator([]string{"secret plan"}), ActionWarn, false, "")
+	if warn.AllowStore(ctx, "the secret plan") {
+		t.Error("flagged content should not be stored")
+	}
+	if !warn.AllowStore(ctx, "hello") {
+		t.Error("clean content should be stored")
+	}
+
+	var disabled *Filter
+	if !disabled.AllowStore(ctx, "the secret plan") {
+		t.Error("nil filter should store everything")
+	}
+}
+
+func TestFilter_CheckFailure(t *testing.T) {
+	ctx := context.Background()
+
+	open := NewFilter(failingModerator{}, ActionBlock, false, "")
+	if got := open.Outbound(ctx, "slack", "1", "hello"); got != "hello" {
+		t.Errorf("fail open = %q, want the reply sent", got)
+	}
+	if !open.AllowStore(ctx, "hello") {
+		t.Error("fail open should store the message")
+	}
+
+	closed := NewFilter(failingModerator{}, ActionBlock, true, "")
+	if got := closed.Outbound(ctx, "slack", "1", "hello"); got != defaultBlockedMessage {
+		t.Errorf("fail closed = %q, want the blocked message", got)
+	}
+	if closed.AllowStore(ctx, "hello") {
+		t.Error("fail closed should not store the message")
+	}
+}
+
+func TestNew(t *testing.T) {
+	filter, err := New(config.ModerationConfig{})
+	if err != nil || filter != nil {
+		t.Fatalf("disabled config = %v, %v; want nil, nil", filter, err)
+	}
+
+	filter, err = New(config.ModerationConfig{Enabled: true, Rules: []string{"x"}})
+	if err != nil || filter == nil {
+		t.Fatalf("rules config = %v, %v; want a filter", filter, err)
+	}
+	if filter.action != ActionBlock {
+		t.Errorf("default action = %q, want %q", filter.action, ActionBlock)
+	}
+
+	if _, err := New(config.ModerationConfig{Enabled: true, Provider: "unknown"}); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
+
+func TestAPIModerator_Check(t *testing.T) {
+	var got moderationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/moderations" {
+			t.Errorf("path = %q, want /moderations", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Write([]byte(`{"results":[{"flagged":true,"categories":{"violence":true,"hate":true,"sexual":false}}]}`))
+	}))
+	defer server.Close()
+
+	m := NewAPIModerator(server.URL+"/", "key", "omni-moderation-latest")
+	verdict, err := m.Check(context.Background(), "some text")
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if got.Input != "some text" || got.Model != "omni-moderation-latest" {
+		t.Errorf("request = %+v", got)
+	}
+	if !verdict.Flagged || verdict.Reason != "hate, violence" {
+		t.Errorf("verdict = %+v, want flagged for hate, violence", verdict)
+	}
+}
+
+func TestAPIModerator_CheckError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	if _, err := NewAPIModerator(server.URL, "", "").Check(context.Background(), "x"); err == nil {
+		t.Error("expected an error for a non-200 response")
+	}
+}
@@ -0,0 +1,35 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+)
+
+// RuleModerator flags text containing any of a list of phrases, ignoring
+// case.
+type RuleModerator struct {
+	phrases []string
+}
+
+// NewRuleModerator creates a moderator for phrases. Blank phrases are
+// ignored.
+func NewRuleModerator(phrases []string) *RuleModerator {
+	m := &RuleModerator{}
+	for _, p := range phrases {
+		if p = strings.TrimSpace(p); p != "" {
+			m.phrases = append(m.phrases, p)
+		}
+	}
+	return m
+}
+
+// Check flags text containing a phrase; the reason is the first match.
+func (m *RuleModerator) Check(ctx context.Context, text string) (Verdict, error) {
+	lower := strings.ToLower(text)
+	for _, p := range m.phrases {
+		if strings.Contains(lower, strings.ToLower(p)) {
+			return Verdict{Flagged: true, Reason: "rule: " + p}, nil
+		}
+	}
+	return Verdict{}, nil
+}
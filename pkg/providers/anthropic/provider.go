@@ -207,13 +207,36 @@ func buildParams(
 		params.Temperature = anthropic.Float(temp)
 	}
 
+	if stop, ok := options["stop"].([]string); ok && len(stop) > 0 {
+		params.StopSequences = stop
+	}
+
 	if len(tools) > 0 {
 		params.Tools = translateTools(tools)
+		if choice, ok := options["tool_choice"].(string); ok {
+			params.ToolChoice = translateToolChoice(choice)
+		}
 	}
 
 	return params, nil
 }
 
+// translateToolChoice maps the "tool_choice" option to Anthropic's tool
+// choice; "required" becomes "any" and other names force that tool.
+func translateToolChoice(choice string) anthropic.ToolChoiceUnionParam {
+	switch choice {
+	case "", "auto":
+		return anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}
+	case "none":
+		none := anthropic.NewToolChoiceNoneParam()
+		return anthropic.ToolChoiceUnionParam{OfNone: &none}
+	case "required":
+		return anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+	default:
+		return anthropic.ToolChoiceParamOfTool(choice)
+	}
+}
+
 func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -269,3 +269,30 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestBuildParams_ToolChoice(t *testing.T) {
+	tools := []ToolDefinition{{
+		Type:     "function",
+		Function: ToolFunctionDefinition{Name: "message", Parameters: map[string]any{"type": "object"}},
+	}}
+	tests := []struct {
+		choice string
+		check  func(anthropic.ToolChoiceUnionParam) bool
+	}{
+		{"auto", func(c anthropic.ToolChoiceUnionParam) bool { return c.OfAuto != nil }},
+		{"none", func(c anthropic.ToolChoiceUnionParam) bool { return c.OfNone != nil }},
+		{"required", func(c anthropic.ToolChoiceUnionParam) bool { return c.OfAny != nil }},
+		{"message", func(c anthropic.ToolChoiceUnionParam) bool { return c.OfTool != nil && c.OfTool.Name == "message" }},
+	}
+
+	for _, tt := range tests {
+		params, err := buildParams([]Message{{Role: "user", Content: "Hi"}}, tools, "claude-sonnet-4.6",
+			map[string]any{"tool_choice": tt.choice})
+		if err != nil {
+			t.Fatalf("buildParams() error: %v", err)
+		}
+		if !tt.check(params.ToolChoice) {
+			t.Errorf("tool_choice %q gave %+v", tt.choice, params.ToolChoice)
+		}
+	}
+}
@@ -78,6 +78,43 @@ var (
 		substr("invalid request format"),
 	}
 
+	contextLengthPatterns = []errorPattern{
+		substr("context_length_exceeded"),
+		rxp(`context (length|window)`),
+		rxp(`maximum context`),
+		rxp(`too many (input )?tokens`),
+		rxp(`prompt is too long`),
+		rxp(`payload too large`),
+		rxp(`request entity too large`),
+	}
+
+	contentPolicyPatterns = []errorPattern{
+		substr("content_policy_violation"),
+		substr("content policy"),
+		substr("content management policy"),
+		substr("content_filter"),
+		substr("responsibleaipolicyviolation"),
+		rxp(`blocked.*safety`),
+	}
+
+	modelUnavailablePatterns = []errorPattern{
+		substr("model_not_found"),
+		substr("model not found"),
+		rxp(`model .*does not exist`),
+		substr("no such model"),
+		substr("unknown model"),
+		substr("is not a valid model"),
+		rxp(`model .*(is )?(currently )?(not available|unavailable)`),
+	}
+
+	networkPatterns = []errorPattern{
+		substr("connection refused"),
+		substr("connection reset"),
+		substr("no such host"),
+		substr("unexpected eof"),
+		substr("server misbehaving"),
+	}
+
 	imageDimensionPatterns = []errorPattern{
 		rxp(`image dimensions exceed max`),
 	}
@@ -88,7 +125,7 @@ var (
 
 	// Transient HTTP status codes that map to timeout (server-side failures).
 	transientStatusCodes = map[int]bool{
-		500: true, 502: true, 503: true,
+		500: true, 502: true, 503: true, 504: true,
 		521: true, 522: true, 523: true, 524: true,
 		529: true,
 	}
@@ -128,6 +165,28 @@ func ClassifyError(err error, provider, model string) *FailoverError {
 		}
 	}
 
+	// Content policy refusals come as 400s but deserve their own reason.
+	if matchesAny(msg, contentPolicyPatterns) {
+		return &FailoverError{
+			Reason:   FailoverContentPolicy,
+			Provider: provider,
+			Model:    model,
+			Status:   extractHTTPStatus(msg),
+			Wrapped:  err,
+		}
+	}
+
+	// Oversized requests come as 400, 413 or 422 but may fit another model.
+	if matchesAny(msg, contextLengthPatterns) {
+		return &FailoverError{
+			Reason:   FailoverContextLength,
+			Provider: provider,
+			Model:    model,
+			Status:   extractHTTPStatus(msg),
+			Wrapped:  err,
+		}
+	}
+
 	// Try HTTP status code extraction first.
 	if status := extractHTTPStatus(msg); status > 0 {
 		if reason := classifyByStatus(status); reason != "" {
@@ -161,11 +220,15 @@ func classifyByStatus(status int) FailoverReason {
 		return FailoverAuth
 	case status == 402:
 		return FailoverBilling
+	case status == 404:
+		return FailoverModelUnavailable
 	case status == 408:
 		return FailoverTimeout
 	case status == 429:
 		return FailoverRateLimit
-	case status == 400:
+	case status == 413:
+		return FailoverContextLength
+	case status == 400 || status == 422:
 		return FailoverFormat
 	case transientStatusCodes[status]:
 		return FailoverTimeout
@@ -185,9 +248,12 @@ func classifyByMessage(msg string) FailoverReason {
 	if matchesAny(msg, billingPatterns) {
 		return FailoverBilling
 	}
-	if matchesAny(msg, timeoutPatterns) {
+	if matchesAny(msg, timeoutPatterns) || matchesAny(msg, networkPatterns) {
 		return FailoverTimeout
 	}
+	if matchesAny(msg, modelUnavailablePatterns) {
+		return FailoverModelUnavailable
+	}
 	if matchesAny(msg, authPatterns) {
 		return FailoverAuth
 	}
@@ -202,8 +268,8 @@ func classifyByMessage(msg string) FailoverReason {
 func extractHTTPStatus(msg string) int {
 	// Common patterns in Go HTTP error messages
 	patterns := []*regexp.Regexp{
-		regexp.MustCompile(`status[:\s]+(\d{3})`),
-		regexp.MustCompile(`HTTP[/\s]+\d*\.?\d*\s+(\d{3})`),
+		regexp.MustCompile(`(?i)status[:\s]+(\d{3})`),
+		regexp.MustCompile(`(?i)HTTP(?:/\d(?:\.\d)?)?\s+(\d{3})`),
 	}
 
 	for _, p := range patterns {
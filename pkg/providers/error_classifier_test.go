@@ -42,9 +42,13 @@ func TestClassifyError_StatusCodes(t *testing.T) {
 		{408, FailoverTimeout},
 		{429, FailoverRateLimit},
 		{400, FailoverFormat},
+		{404, FailoverModelUnavailable},
+		{413, FailoverContextLength},
+		{422, FailoverFormat},
 		{500, FailoverTimeout},
 		{502, FailoverTimeout},
 		{503, FailoverTimeout},
+		{504, FailoverTimeout},
 		{521, FailoverTimeout},
 		{522, FailoverTimeout},
 		{523, FailoverTimeout},
@@ -232,6 +236,77 @@ func TestClassifyError_ImageSizeError(t *testing.T) {
 	}
 }
 
+func TestClassifyError_ContentPolicy(t *testing.T) {
+	patterns := []string{
+		`status: 400 {"error":{"code":"content_policy_violation"}}`,
+		"Your request was rejected as a result of our safety system: content policy",
+		`{"error":{"code":"content_filter","message":"The response was filtered"}}`,
+	}
+
+	for _, msg := range patterns {
+		result := ClassifyError(errors.New(msg), "openai", "gpt-4")
+		if result == nil || result.Reason != FailoverContentPolicy {
+			t.Errorf("%q: got %+v, want content_policy", msg, result)
+			continue
+		}
+		if result.IsRetriable() {
+			t.Errorf("%q: content policy errors should not be retriable", msg)
+		}
+	}
+}
+
+func TestClassifyError_ContextLength(t *testing.T) {
+	patterns := []string{
+		"status: 413 payload too large",
+		`status: 400 {"error":{"code":"context_length_exceeded"}}`,
+		"status: 422 This model's maximum context length is 8192 tokens",
+		"prompt is too long: 210000 tokens > 200000 maximum",
+	}
+
+	for _, msg := range patterns {
+		result := ClassifyError(errors.New(msg), "openai", "gpt-4")
+		if result == nil || result.Reason != FailoverContextLength {
+			t.Errorf("%q: got %+v, want context_length", msg, result)
+			continue
+		}
+		if !result.IsRetriable() {
+			t.Errorf("%q: context length errors should fail over", msg)
+		}
+	}
+}
+
+func TestClassifyError_ModelUnavailable(t *testing.T) {
+	patterns := []string{
+		`{"error":{"code":"model_not_found"}}`,
+		"The model `gpt-5` does not exist or you do not have access to it",
+		"unknown model: llama-9",
+		"model is currently unavailable, try again later",
+	}
+
+	for _, msg := range patterns {
+		result := ClassifyError(errors.New(msg), "openai", "gpt-5")
+		if result == nil || result.Reason != FailoverModelUnavailable {
+			t.Errorf("%q: got %+v, want model_unavailable", msg, result)
+		}
+	}
+}
+
+func TestClassifyError_NetworkErrors(t *testing.T) {
+	patterns := []string{
+		"dial tcp 127.0.0.1:11434: connect: connection refused",
+		"dial tcp: lookup api.example.com: no such host",
+		"read tcp: connection reset by peer",
+		"Post \"https://api.example.com\": unexpected EOF",
+	}
+
+	for _, msg := range patterns {
+		result := ClassifyError(errors.New(msg), "ollama", "llama")
+		if result == nil || result.Reason != FailoverTimeout {
+			t.Errorf("%q: got %+v, want timeout", msg, result)
+		}
+	}
+}
+
 func TestClassifyError_UnknownError(t *testing.T) {
 	err := errors.New("some completely random error")
 	result := ClassifyError(err, "openai", "gpt-4")
@@ -266,6 +341,9 @@ func TestFailoverError_IsRetriable(t *testing.T) {
 		{FailoverOverloaded, true},
 		{FailoverFormat, false},
 		{FailoverUnknown, true},
+		{FailoverModelUnavailable, true},
+		{FailoverContentPolicy, false},
+		{FailoverContextLength, true},
 	}
 
 	for _, tt := range tests {
@@ -306,6 +384,8 @@ func TestExtractHTTPStatus(t *testing.T) {
 		{"status: 429 rate limited", 429},
 		{"status 401 unauthorized", 401},
 		{"HTTP/1.1 502 Bad Gateway", 502},
+		{"antigravity API error (HTTP 503): unavailable", 503},
+		{"API request failed:\n  Status: 404\n  Body: {}", 404},
 		{"no status code here", 0},
 		{"random number 12345", 0},
 	}
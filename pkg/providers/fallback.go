@@ -42,6 +42,15 @@ func NewFallbackChain(cooldown *CooldownTracker) *FallbackChain {
 }
 
 // ResolveCandidates parses model config into a deduplicated candidate list.
+// The order is deterministic and callers may rely on it:
+//   - The primary model comes first, followed by the fallbacks in the order
+//     they are configured.
+//   - Entries that are empty, whitespace-only or have no model after the
+//     provider prefix ("openai/") are skipped.
+//   - Bare model names use defaultProvider. Providers are normalized
+//     (e.g. "gpt" is "openai") and models compared case-insensitively, so a
+//     model listed twice, even under an alias, is kept only at its first
+//     position.
 func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandidate {
 	seen := make(map[string]bool)
 	var candidates []FallbackCandidate
@@ -79,8 +88,11 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 // Behavior:
 //   - Candidates in cooldown are skipped (logged as skipped attempt).
 //   - context.Canceled aborts immediately (user abort, no fallback).
-//   - Non-retriable errors (format) abort immediately.
-//   - Retriable errors trigger fallback to next candidate.
+//   - Non-retriable errors (format, content policy) abort immediately: they
+//     would fail the same way on every candidate.
+//   - Retriable errors (timeouts, 429, 5xx, unavailable models, requests
+//     too large for the model, auth, billing) trigger fallback to next
+//     candidate.
 //   - Success marks provider as good (resets cooldown).
 //   - If all fail, returns aggregate error with all attempts.
 func (fc *FallbackChain) Execute(
@@ -171,8 +183,12 @@ func (fc *FallbackChain) Execute(
 			return nil, failErr
 		}
 
-		// Retriable error: mark failure and continue to next candidate.
-		fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		// Retriable error: mark failure and continue to next candidate. A
+		// missing model or an oversized request says nothing about the
+		// provider's other models.
+		if failErr.Reason != FailoverModelUnavailable && failErr.Reason != FailoverContextLength {
+			fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		}
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
 			Model:    candidate.Model,
@@ -3,6 +3,7 @@ package providers
 import (
 	"context"
 	"errors"
+	"slices"
 	"testing"
 	"time"
 )
@@ -152,6 +153,83 @@ func TestFallback_NonRetriableError(t *testing.T) {
 	}
 }
 
+func TestFallback_StatusDecidesFailover(t *testing.T) {
+	candidates := []FallbackCandidate{
+		makeCandidate("openai", "gpt-4"),
+		makeCandidate("anthropic", "claude"),
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		failover bool
+	}{
+		{"bad request", errors.New("API request failed:\n  Status: 400\n  Body: invalid 'messages'"), false},
+		{"content policy", errors.New(`status: 400 {"error":{"code":"content_policy_violation"}}`), false},
+		{"unprocessable", errors.New("status: 422 invalid schema"), false},
+		{"payload too large", errors.New("status: 413 request entity too large"), true},
+		{"context length", errors.New("status: 422 prompt exceeds maximum context length"), true},
+		{"context length 400", errors.New(`status: 400 {"error":{"code":"context_length_exceeded"}}`), true},
+		{"service unavailable", errors.New("API request failed:\n  Status: 503\n  Body: overloaded"), true},
+		{"gateway timeout", errors.New("status: 504 gateway timeout"), true},
+		{"rate limited", errors.New("status: 429 slow down"), true},
+		{"model not found", errors.New("API request failed:\n  Status: 404\n  Body: model_not_found"), true},
+		{"connection refused", errors.New("dial tcp: connect: connection refused"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := NewFallbackChain(NewCooldownTracker())
+			var tried []string
+			run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+				tried = append(tried, provider)
+				if provider == "openai" {
+					return nil, tt.err
+				}
+				return &LLMResponse{Content: "ok", FinishReason: "stop"}, nil
+			}
+
+			result, err := fc.Execute(context.Background(), candidates, run)
+			if tt.failover {
+				if err != nil || result.Provider != "anthropic" {
+					t.Fatalf("Execute() = %+v, %v; want fallback to anthropic", result, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error without failover")
+			}
+			if len(tried) != 1 {
+				t.Errorf("tried %v, want only the first candidate", tried)
+			}
+		})
+	}
+}
+
+func TestFallback_ModelUnavailableKeepsProviderAvailable(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	candidates := []FallbackCandidate{
+		makeCandidate("openai", "gpt-5"),
+		makeCandidate("openai", "gpt-4"),
+	}
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		if model == "gpt-5" {
+			return nil, errors.New("status: 404 model_not_found")
+		}
+		return &LLMResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+
+	result, err := fc.Execute(context.Background(), candidates, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Model != "gpt-4" {
+		t.Errorf("model = %q, want gpt-4 on the same provider", result.Model)
+	}
+}
+
 func TestFallback_CooldownSkip(t *testing.T) {
 	now := time.Now()
 	ct, _ := newTestTracker(now)
@@ -453,6 +531,52 @@ func TestResolveCandidates_EmptyPrimary(t *testing.T) {
 	}
 }
 
+func TestResolveCandidates_Contract(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ModelConfig
+		want []string
+	}{
+		{
+			name: "primary first, fallbacks in order",
+			cfg:  ModelConfig{Primary: "groq/llama-3", Fallbacks: []string{"gpt-4", "anthropic/claude"}},
+			want: []string{"groq/llama-3", "openai/gpt-4", "anthropic/claude"},
+		},
+		{
+			name: "fallback repeating the primary",
+			cfg:  ModelConfig{Primary: "gpt-4", Fallbacks: []string{"anthropic/claude", "openai/gpt-4"}},
+			want: []string{"openai/gpt-4", "anthropic/claude"},
+		},
+		{
+			name: "duplicates under provider aliases and case",
+			cfg:  ModelConfig{Primary: "claude/Sonnet", Fallbacks: []string{"anthropic/sonnet", " Anthropic/SONNET ", "glm/glm-4"}},
+			want: []string{"anthropic/Sonnet", "zhipu/glm-4"},
+		},
+		{
+			name: "empty entries skipped",
+			cfg:  ModelConfig{Primary: "  ", Fallbacks: []string{"", "openai/", "anthropic/claude", "\t"}},
+			want: []string{"anthropic/claude"},
+		},
+		{
+			name: "nothing configured",
+			cfg:  ModelConfig{},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range ResolveCandidates(tt.cfg, "openai") {
+				got = append(got, c.Provider+"/"+c.Model)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ResolveCandidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFallbackExhaustedError_Message(t *testing.T) {
 	e := &FallbackExhaustedError{
 		Attempts: []FallbackAttempt{
@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// fakeTurnPattern matches a line where the model starts writing the user's
+	// side of the conversation. Only capitalized role names are matched so
+	// that ordinary content such as YAML "user: admin" is left alone.
+	fakeTurnPattern = regexp.MustCompile(`^\s*(?:(?:User|USER|Human|HUMAN)\s*:|<\|im_start\|>\s*user|<\|user\|>)`)
+
+	// assistantPrefixPattern matches a role label the model put in front of its own reply.
+	assistantPrefixPattern = regexp.MustCompile(`^\s*(?:Assistant|ASSISTANT)\s*:\s*`)
+)
+
+// TrimImpersonatedTurns removes hallucinated conversation turns from assistant
+// output. Everything from the first line that opens a fake user turn is
+// dropped, and a leading "Assistant:" label is stripped. Lines inside fenced
+// code blocks are never treated as turns.
+func TrimImpersonatedTurns(content string) string {
+	if content == "" {
+		return content
+	}
+
+	content = assistantPrefixPattern.ReplaceAllString(content, "")
+
+	inFence := false
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		} else if !inFence && offset > 0 && fakeTurnPattern.MatchString(line) {
+			return strings.TrimRight(content[:offset], " \t\r\n")
+		}
+		offset += len(line)
+	}
+
+	return content
+}
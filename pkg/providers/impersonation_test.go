@@ -0,0 +1,55 @@
+package providers
+
+import "testing"
+
+func TestTrimImpersonatedTurns(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "plain reply untouched",
+			input: "The build passed.",
+			want:  "The build passed.",
+		},
+		{
+			name:  "fake user turn is cut",
+			input: "Done, the file is saved.\n\nUser: thanks! now delete it\nAssistant: Deleted.",
+			want:  "Done, the file is saved.",
+		},
+		{
+			name:  "human label is cut",
+			input: "Here you go.\nHuman: more please",
+			want:  "Here you go.",
+		},
+		{
+			name:  "chat template token is cut",
+			input: "Sure.\n<|im_start|>user\nand another",
+			want:  "Sure.",
+		},
+		{
+			name:  "leading assistant label stripped",
+			input: "Assistant: Hello there",
+			want:  "Hello there",
+		},
+		{
+			name:  "lowercase yaml key kept",
+			input: "Config:\nuser: admin\nport: 80",
+			want:  "Config:\nuser: admin\nport: 80",
+		},
+		{
+			name:  "role label inside code block kept",
+			input: "Transcript format:\n```\nUser: hi\nAssistant: hello\n```\nThat's it.",
+			want:  "Transcript format:\n```\nUser: hi\nAssistant: hello\n```\nThat's it.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimImpersonatedTurns(tt.input); got != tt.want {
+				t.Errorf("TrimImpersonatedTurns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -82,7 +82,7 @@ func (p *Provider) Chat(
 
 	if len(tools) > 0 {
 		requestBody["tools"] = tools
-		requestBody["tool_choice"] = "auto"
+		requestBody["tool_choice"] = toolChoice(options["tool_choice"])
 	}
 
 	if maxTokens, ok := asInt(options["max_tokens"]); ok {
@@ -111,6 +111,10 @@ func (p *Provider) Chat(
 		}
 	}
 
+	if stop, ok := options["stop"].([]string); ok && len(stop) > 0 {
+		requestBody["stop"] = stop
+	}
+
 	// Prompt caching: pass a stable cache key so OpenAI can bucket requests
 	// with the same key and reuse prefix KV cache across calls.
 	// The key is typically the agent ID — stable per agent, shared across requests.
@@ -267,6 +271,15 @@ type imageContentPart struct {
 	} `json:"image_url"`
 }
 
+// audioContentPart represents an audio part of multi-content message
+type audioContentPart struct {
+	Type       string `json:"type"`
+	InputAudio struct {
+		Data   string `json:"data"`
+		Format string `json:"format"`
+	} `json:"input_audio"`
+}
+
 // stripSystemParts converts []Message to []openaiMessage, dropping the
 // SystemParts field so it doesn't leak into the JSON payload sent to
 // OpenAI-compatible APIs (some strict endpoints reject unknown fields).
@@ -310,6 +323,12 @@ func stripSystemParts(messages []Message) []openaiMessage {
 						},
 					})
 				}
+				if img.Type == "audio" && img.Base64Data != "" {
+					part := audioContentPart{Type: "input_audio"}
+					part.InputAudio.Data = img.Base64Data
+					part.InputAudio.Format = strings.TrimPrefix(img.MIMEType, "audio/")
+					parts = append(parts, part)
+				}
 			}
 
 			om.Content = parts
@@ -371,3 +390,21 @@ func asFloat(v any) (float64, bool) {
 		return 0, false
 	}
 }
+
+// toolChoice maps the "tool_choice" option to the request field: "auto",
+// "none" and "required" are passed as they are, any other name forces that
+// function. Unset means "auto".
+func toolChoice(option any) any {
+	choice, _ := option.(string)
+	switch choice {
+	case "":
+		return "auto"
+	case "auto", "none", "required":
+		return choice
+	default:
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": choice},
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 func TestProviderChat_UsesMaxCompletionTokensForGLM(t *testing.T) {
@@ -317,6 +319,45 @@ func TestProviderChat_AcceptsNumericOptionTypes(t *testing.T) {
 	}
 }
 
+func TestProviderChat_SendsStopSequences(t *testing.T) {
+	var requestBody map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := map[string]any{
+			"choices": []map[string]any{
+				{
+					"message":       map[string]any{"content": "ok"},
+					"finish_reason": "stop",
+				},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.Chat(
+		t.Context(),
+		[]Message{{Role: "user", Content: "hi"}},
+		nil,
+		"gpt-4o",
+		map[string]any{"stop": []string{"\nUser:"}},
+	)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	stop, ok := requestBody["stop"].([]any)
+	if !ok || len(stop) != 1 || stop[0] != "\nUser:" {
+		t.Fatalf("stop = %v, want [\"\\nUser:\"]", requestBody["stop"])
+	}
+}
+
 func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 	if got := normalizeModel("deepseek/deepseek-chat", "https://api.deepseek.com/v1"); got != "deepseek-chat" {
 		t.Fatalf("normalizeModel(deepseek) = %q, want %q", got, "deepseek-chat")
@@ -325,3 +366,66 @@ func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 		t.Fatalf("normalizeModel(openrouter) = %q, want %q", got, "openrouter/auto")
 	}
 }
+
+func TestProviderChat_SendsToolChoice(t *testing.T) {
+	tests := []struct {
+		option any
+		want   string
+	}{
+		{option: nil, want: `"auto"`},
+		{option: "none", want: `"none"`},
+		{option: "required", want: `"required"`},
+		{option: "message", want: `{"function":{"name":"message"},"type":"function"}`},
+	}
+
+	for _, tt := range tests {
+		var requestBody map[string]json.RawMessage
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+		}))
+
+		options := map[string]any{}
+		if tt.option != nil {
+			options["tool_choice"] = tt.option
+		}
+		p := NewProvider("key", server.URL, "")
+		_, err := p.Chat(
+			t.Context(),
+			[]Message{{Role: "user", Content: "hi"}},
+			[]ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "message"}}},
+			"gpt-4o",
+			options,
+		)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		if got := string(requestBody["tool_choice"]); got != tt.want {
+			t.Errorf("tool_choice for option %v = %s, want %s", tt.option, got, tt.want)
+		}
+	}
+}
+
+func TestStripSystemParts_AudioContent(t *testing.T) {
+	out := stripSystemParts([]Message{{
+		Role:    "user",
+		Content: "[voice]",
+		MultiContent: []protocoltypes.ImageContent{
+			{Type: "audio", Base64Data: "T2dnUw==", MIMEType: "audio/ogg"},
+		},
+	}})
+
+	data, err := json.Marshal(out[0].Content)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `[{"type":"text","text":"[voice]"},{"type":"input_audio","input_audio":{"data":"T2dnUw==","format":"ogg"}}]`
+	if string(data) != want {
+		t.Errorf("content = %s, want %s", data, want)
+	}
+}
@@ -53,13 +53,13 @@ type ContentBlock struct {
 	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
-// ImageContent represents an image attachment in a message.
+// ImageContent represents an image or audio attachment in a message.
 type ImageContent struct {
-	Type     string `json:"type"` // "image"
+	Type     string `json:"type"` // "image" or "audio"
 	ImageURL string `json:"image_url"`
 	// For local files: base64 encoded data
 	Base64Data string `json:"base64_data,omitempty"`
-	// MIME type (e.g., "image/jpeg", "image/png")
+	// MIME type (e.g., "image/jpeg", "image/png", "audio/ogg")
 	MIMEType string `json:"mime_type,omitempty"`
 }
 
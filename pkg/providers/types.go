@@ -49,6 +49,15 @@ const (
 	FailoverFormat     FailoverReason = "format"
 	FailoverOverloaded FailoverReason = "overloaded"
 	FailoverUnknown    FailoverReason = "unknown"
+	// FailoverModelUnavailable means the model does not exist or is not
+	// served right now; other models may still work.
+	FailoverModelUnavailable FailoverReason = "model_unavailable"
+	// FailoverContentPolicy means the request was refused by a content
+	// filter; every other model would refuse it too.
+	FailoverContentPolicy FailoverReason = "content_policy"
+	// FailoverContextLength means the request is too large for the model;
+	// a model with a larger context window may still take it.
+	FailoverContextLength FailoverReason = "context_length"
 )
 
 // FailoverError wraps an LLM provider error with classification metadata.
@@ -70,9 +79,11 @@ func (e *FailoverError) Unwrap() error {
 }
 
 // IsRetriable returns true if this error should trigger fallback to next candidate.
-// Non-retriable: Format errors (bad request structure, image dimension/size).
+// Non-retriable: errors that would fail identically on every model, i.e.
+// format errors (bad request structure, image dimension/size) and content
+// policy refusals.
 func (e *FailoverError) IsRetriable() bool {
-	return e.Reason != FailoverFormat
+	return e.Reason != FailoverFormat && e.Reason != FailoverContentPolicy
 }
 
 // ModelConfig holds primary model and fallback list.
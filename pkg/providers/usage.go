@@ -0,0 +1,87 @@
+package providers
+
+import "sync"
+
+// TokenUsage is the token usage accumulated over a number of LLM calls.
+type TokenUsage struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *TokenUsage) add(info *UsageInfo) {
+	u.Calls++
+	u.PromptTokens += info.PromptTokens
+	u.CompletionTokens += info.CompletionTokens
+	total := info.TotalTokens
+	if total == 0 {
+		total = info.PromptTokens + info.CompletionTokens
+	}
+	u.TotalTokens += total
+}
+
+// UsageTracker accumulates the token usage reported by providers per session
+// and per agent, for budgeting. Counters live in memory and start from zero
+// when the process restarts.
+type UsageTracker struct {
+	mu       sync.Mutex
+	sessions map[string]*TokenUsage
+	agents   map[string]*TokenUsage
+}
+
+// NewUsageTracker creates an empty tracker.
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{
+		sessions: make(map[string]*TokenUsage),
+		agents:   make(map[string]*TokenUsage),
+	}
+}
+
+// Record adds usage to the counters of agentID and sessionKey. An empty
+// sessionKey only counts towards the agent, e.g. for background summaries.
+// Responses without usage information are ignored.
+func (t *UsageTracker) Record(agentID, sessionKey string, usage *UsageInfo) {
+	if t == nil || usage == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counter(t.agents, agentID).add(usage)
+	if sessionKey != "" {
+		counter(t.sessions, sessionKey).add(usage)
+	}
+}
+
+// SessionUsage returns the usage recorded for sessionKey.
+func (t *UsageTracker) SessionUsage(sessionKey string) TokenUsage {
+	return t.get(t.sessions, sessionKey)
+}
+
+// AgentUsage returns the usage recorded for agentID across all its sessions.
+func (t *UsageTracker) AgentUsage(agentID string) TokenUsage {
+	return t.get(t.agents, agentID)
+}
+
+func (t *UsageTracker) get(counters map[string]*TokenUsage, key string) TokenUsage {
+	if t == nil {
+		return TokenUsage{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := counters[key]; ok {
+		return *u
+	}
+	return TokenUsage{}
+}
+
+func counter(counters map[string]*TokenUsage, key string) *TokenUsage {
+	u, ok := counters[key]
+	if !ok {
+		u = &TokenUsage{}
+		counters[key] = u
+	}
+	return u
+}
@@ -0,0 +1,27 @@
+package providers
+
+import "testing"
+
+func TestUsageTracker(t *testing.T) {
+	tracker := NewUsageTracker()
+	tracker.Record("main", "telegram:1", &UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120})
+	tracker.Record("main", "telegram:1", &UsageInfo{PromptTokens: 50, CompletionTokens: 10})
+	tracker.Record("main", "telegram:2", &UsageInfo{PromptTokens: 30, CompletionTokens: 5, TotalTokens: 35})
+	tracker.Record("main", "", &UsageInfo{PromptTokens: 200, CompletionTokens: 40, TotalTokens: 240})
+	tracker.Record("coder", "telegram:1", nil)
+
+	want := TokenUsage{Calls: 2, PromptTokens: 150, CompletionTokens: 30, TotalTokens: 180}
+	if got := tracker.SessionUsage("telegram:1"); got != want {
+		t.Errorf("SessionUsage(telegram:1) = %+v, want %+v", got, want)
+	}
+	want = TokenUsage{Calls: 4, PromptTokens: 380, CompletionTokens: 75, TotalTokens: 455}
+	if got := tracker.AgentUsage("main"); got != want {
+		t.Errorf("AgentUsage(main) = %+v, want %+v", got, want)
+	}
+	if got := tracker.AgentUsage("coder"); got != (TokenUsage{}) {
+		t.Errorf("AgentUsage(coder) = %+v, want nothing recorded without usage", got)
+	}
+	if got := tracker.SessionUsage(""); got != (TokenUsage{}) {
+		t.Errorf("SessionUsage(\"\") = %+v, want agent-only usage excluded", got)
+	}
+}
@@ -15,6 +15,7 @@ type RouteInput struct {
 	GuildID    string
 	TeamID     string
 	ThreadID   string
+	SenderID   string
 }
 
 // ResolvedRoute is the result of agent routing.
@@ -49,6 +50,7 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 	if dmScope == "" {
 		dmScope = DMScopeMain
 	}
+	groupScope := GroupScope(r.cfg.Session.GroupScope)
 	identityLinks := r.cfg.Session.IdentityLinks
 
 	bindings := r.filterBindings(channel, accountID)
@@ -61,6 +63,8 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 			AccountID:     accountID,
 			Peer:          peer,
 			DMScope:       dmScope,
+			GroupScope:    groupScope,
+			SenderID:      input.SenderID,
 			IdentityLinks: identityLinks,
 		}, input.ThreadID))
 		mainSessionKey := strings.ToLower(BuildAgentMainSessionKey(resolvedAgentID))
@@ -295,3 +295,21 @@ func TestResolveRoute_NoDefaultUsesFirst(t *testing.T) {
 		t.Errorf("AgentID = %q, want 'alpha' (first in list)", route.AgentID)
 	}
 }
+
+func TestResolveRoute_GroupScopePerThreadUser(t *testing.T) {
+	cfg := testConfig(nil, nil)
+	cfg.Session.GroupScope = "per-thread-user"
+	r := NewRouteResolver(cfg)
+
+	route := r.ResolveRoute(RouteInput{
+		Channel:  "telegram",
+		Peer:     &RoutePeer{Kind: "group", ID: "-100123"},
+		ThreadID: "7",
+		SenderID: "42",
+	})
+
+	want := "agent:main:telegram:group:-100123:thread:7:user:42"
+	if route.SessionKey != want {
+		t.Errorf("SessionKey = %q, want %q", route.SessionKey, want)
+	}
+}
@@ -15,6 +15,16 @@ const (
 	DMScopePerAccountChannelPeer DMScope = "per-account-channel-peer"
 )
 
+// GroupScope controls group session isolation granularity.
+type GroupScope string
+
+const (
+	GroupScopePerChat       GroupScope = "per-chat"
+	GroupScopePerThread     GroupScope = "per-thread"
+	GroupScopePerUser       GroupScope = "per-user"
+	GroupScopePerThreadUser GroupScope = "per-thread-user"
+)
+
 // RoutePeer represents a chat peer with kind and ID.
 type RoutePeer struct {
 	Kind string // "direct", "group", "channel"
@@ -28,6 +38,8 @@ type SessionKeyParams struct {
 	AccountID     string
 	Peer          *RoutePeer
 	DMScope       DMScope
+	GroupScope    GroupScope
+	SenderID      string
 	IdentityLinks map[string][]string
 }
 
@@ -96,14 +108,26 @@ func BuildAgentPeerSessionKey(params SessionKeyParams, threadID string) string {
 	if peerID == "" {
 		peerID = "unknown"
 	}
-	baseKey := fmt.Sprintf("agent:%s:%s:%s:%s", agentID, channel, peerKind, peerID)
+	key := fmt.Sprintf("agent:%s:%s:%s:%s", agentID, channel, peerKind, peerID)
+
+	groupScope := params.GroupScope
+	if groupScope == "" {
+		groupScope = GroupScopePerThread
+	}
 
 	// Add thread ID for group threads (Telegram forum topics)
-	if threadID != "" && peerKind == "group" {
-		return fmt.Sprintf("%s:thread:%s", baseKey, threadID)
+	if threadID != "" && peerKind == "group" &&
+		(groupScope == GroupScopePerThread || groupScope == GroupScopePerThreadUser) {
+		key = fmt.Sprintf("%s:thread:%s", key, threadID)
+	}
+
+	// Add the sender so each member of the chat gets their own session
+	senderID := strings.ToLower(strings.TrimSpace(params.SenderID))
+	if senderID != "" && (groupScope == GroupScopePerUser || groupScope == GroupScopePerThreadUser) {
+		key = fmt.Sprintf("%s:user:%s", key, senderID)
 	}
 
-	return baseKey
+	return key
 }
 
 // ParseAgentSessionKey extracts agentId and rest from "agent:<agentId>:<rest>".
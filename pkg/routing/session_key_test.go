@@ -84,6 +84,51 @@ func TestBuildAgentPeerSessionKey_GroupPeer(t *testing.T) {
 	}
 }
 
+func TestBuildAgentPeerSessionKey_GroupScopes(t *testing.T) {
+	tests := []struct {
+		scope    GroupScope
+		threadID string
+		want     string
+	}{
+		{"", "", "agent:main:telegram:group:chat456"},
+		{"", "42", "agent:main:telegram:group:chat456:thread:42"},
+		{GroupScopePerChat, "42", "agent:main:telegram:group:chat456"},
+		{GroupScopePerThread, "", "agent:main:telegram:group:chat456"},
+		{GroupScopePerThread, "42", "agent:main:telegram:group:chat456:thread:42"},
+		{GroupScopePerUser, "", "agent:main:telegram:group:chat456:user:user123"},
+		{GroupScopePerUser, "42", "agent:main:telegram:group:chat456:user:user123"},
+		{GroupScopePerThreadUser, "", "agent:main:telegram:group:chat456:user:user123"},
+		{GroupScopePerThreadUser, "42", "agent:main:telegram:group:chat456:thread:42:user:user123"},
+	}
+	for _, tt := range tests {
+		got := BuildAgentPeerSessionKey(SessionKeyParams{
+			AgentID:    "main",
+			Channel:    "telegram",
+			Peer:       &RoutePeer{Kind: "group", ID: "chat456"},
+			GroupScope: tt.scope,
+			SenderID:   "User123",
+		}, tt.threadID)
+		if got != tt.want {
+			t.Errorf("GroupScope %q, thread %q = %q, want %q", tt.scope, tt.threadID, got, tt.want)
+		}
+	}
+}
+
+func TestBuildAgentPeerSessionKey_GroupScopeIgnoredForDirect(t *testing.T) {
+	got := BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:    "main",
+		Channel:    "telegram",
+		Peer:       &RoutePeer{Kind: "direct", ID: "user123"},
+		DMScope:    DMScopePerChannelPeer,
+		GroupScope: GroupScopePerThreadUser,
+		SenderID:   "user123",
+	}, "42")
+	want := "agent:main:telegram:direct:user123"
+	if got != want {
+		t.Errorf("direct peer with GroupScopePerThreadUser = %q, want %q", got, want)
+	}
+}
+
 func TestBuildAgentPeerSessionKey_NilPeer(t *testing.T) {
 	got := BuildAgentPeerSessionKey(SessionKeyParams{
 		AgentID: "main",
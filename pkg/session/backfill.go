@@ -0,0 +1,89 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+)
+
+// ErrMemoryDisabled is returned by BackfillMemory when no message store is
+// configured.
+var ErrMemoryDisabled = errors.New("long-term memory is not enabled")
+
+// BackfillMemory stores the existing history of the session in the message
+// store, e.g. after Qdrant was enabled for a chat that already had history.
+// Messages are filtered the same way as in AddFullMessage and keep their
+// position in the history as index and the time they were added, estimated
+// for messages saved without one (see messageTimes). Messages already
+// stored for the session are replaced once the new ones are stored, so
+// running it twice does not store duplicates and a failure loses nothing.
+// It returns the number of messages stored.
+func (sm *SessionManager) BackfillMemory(ctx context.Context, key string) (int, error) {
+	if sm.messageStore == nil || !sm.messageStore.IsEnabled() {
+		return 0, ErrMemoryDisabled
+	}
+	sm.mu.Lock()
+	session, ok := sm.loaded(key)
+	if !ok {
+		sm.mu.Unlock()
+		return 0, nil
+	}
+	times := session.messageTimes()
+	var messages []storage.StoredMessage
+	for i, msg := range session.Messages {
+		msg, ok := sm.storableMessage(key, msg)
+		if !ok {
+			continue
+		}
+		messages = append(messages, storage.StoredMessage{
+			SessionKey: key,
+			Message:    msg,
+			Timestamp:  times[i],
+			Index:      i,
+		})
+	}
+	sm.mu.Unlock()
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	if err := sm.messageStore.ReplaceSessionMessages(ctx, key, messages); err != nil {
+		return 0, err
+	}
+	return len(messages), nil
+}
+
+// ForgetSession clears the history, summary and pinned entries of the
+// session and deletes the messages stored for it in long-term memory, so
+// nothing of the conversation can be recalled afterwards. Without a message
+// store only the session itself is cleared.
+func (sm *SessionManager) ForgetSession(key string) error {
+	sm.TruncateHistory(key, 0)
+	sm.SetSummary(key, "")
+	sm.mu.Lock()
+	if session, ok := sm.loaded(key); ok {
+		session.Pinned = nil
+	}
+	delete(sm.pending, key)
+	sm.mu.Unlock()
+
+	if sm.messageStore == nil || !sm.messageStore.IsEnabled() {
+		return nil
+	}
+	if err := sm.messageStore.DeleteSessionMessages(key); err != nil {
+		return fmt.Errorf("failed to delete long-term memory: %w", err)
+	}
+	return nil
+}
+
+// interpolateTime returns the time of the i-th of n events spread evenly
+// between from and to.
+func interpolateTime(from, to time.Time, i, n int) time.Time {
+	if n <= 1 || !to.After(from) {
+		return to
+	}
+	return from.Add(to.Sub(from) * time.Duration(i) / time.Duration(n-1))
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestBackfillMemory(t *testing.T) {
+	sm, fake := newStoringSessionManager(t, false)
+
+	// History that existed before memory was enabled is not stored by SetHistory
+	key := "telegram:42"
+	sm.GetOrCreate(key)
+	sm.SetHistory(key, []providers.Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Search for picoclaw"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search"}}},
+		{Role: "tool", Content: "PicoClaw is a tiny agent", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "It is a tiny agent"},
+		{Role: "user", Content: ""},
+	})
+	if len(fake.roles) != 0 {
+		t.Fatalf("messages stored before backfill: %v", fake.roles)
+	}
+
+	n, err := sm.BackfillMemory(context.Background(), key)
+	if err != nil {
+		t.Fatalf("BackfillMemory failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("BackfillMemory() = %d, want 2", n)
+	}
+	if got := strings.Join(fake.roles, ","); got != "user,assistant" {
+		t.Errorf("stored roles = %s, want user,assistant", got)
+	}
+	if !slices.Equal(fake.indices, []int{1, 4}) {
+		t.Errorf("stored indices = %v, want [1 4]", fake.indices)
+	}
+	if fake.deletes != 1 {
+		t.Errorf("%d deletes, want the session's old messages removed once", fake.deletes)
+	}
+
+	// Unknown sessions have nothing to import
+	if n, err := sm.BackfillMemory(context.Background(), "telegram:missing"); n != 0 || err != nil {
+		t.Errorf("BackfillMemory(missing) = %d, %v", n, err)
+	}
+}
+
+func TestForgetSession(t *testing.T) {
+	sm, fake := newStoringSessionManager(t, false)
+	key := "telegram:42"
+	sm.AddMessage(key, "user", "My passport number is 1234")
+	sm.AddMessage(key, "assistant", "Noted")
+	sm.SetSummary(key, "The user shared their passport number")
+	if len(fake.roles) != 2 {
+		t.Fatalf("%d messages stored in memory, want 2", len(fake.roles))
+	}
+
+	if err := sm.ForgetSession(key); err != nil {
+		t.Fatalf("ForgetSession failed: %v", err)
+	}
+	if history := sm.GetHistory(key); len(history) != 0 {
+		t.Errorf("history after forgetting = %v", history)
+	}
+	if summary := sm.GetSummary(key); summary != "" {
+		t.Errorf("summary after forgetting = %q", summary)
+	}
+	if fake.deletes != 1 {
+		t.Errorf("%d deletes, want the session's memory deleted once", fake.deletes)
+	}
+}
+
+func TestBackfillMemory_Disabled(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sm.AddMessage("telegram:42", "user", "hello")
+
+	if _, err := sm.BackfillMemory(context.Background(), "telegram:42"); !errors.Is(err, ErrMemoryDisabled) {
+		t.Errorf("BackfillMemory error = %v, want ErrMemoryDisabled", err)
+	}
+}
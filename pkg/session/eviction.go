@@ -0,0 +1,153 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// EvictIdle saves and unloads sessions that have not been updated or used
+// for maxIdle, keeping their files on disk; they are reloaded transparently
+// when used again. Sessions unchanged since they were loaded or saved are
+// not written again. With forgetMemory their messages are also deleted from the
+// message store. It returns the evicted keys. Sessions are only evicted when
+// the manager has a storage directory to reload them from.
+func (sm *SessionManager) EvictIdle(maxIdle time.Duration, forgetMemory bool) []string {
+	if sm.storage == "" || maxIdle <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-maxIdle)
+
+	sm.mu.RLock()
+	var idle []string
+	changed := make(map[string]bool)
+	for key, session := range sm.sessions {
+		if session.idleSince(cutoff) {
+			idle = append(idle, key)
+			changed[key] = session.changed()
+		}
+	}
+	sm.mu.RUnlock()
+
+	var evicted []string
+	for _, key := range idle {
+		if changed[key] {
+			if err := sm.Save(key); err != nil {
+				logger.WarnCF("session", "Failed to save idle session, keeping it in memory", map[string]any{
+					"session_key": key,
+					"error":       err.Error(),
+				})
+				continue
+			}
+		}
+
+		sm.mu.Lock()
+		session, ok := sm.sessions[key]
+		// Skip sessions that became active again while saving
+		if ok && session.idleSince(cutoff) && !session.changed() {
+			delete(sm.sessions, key)
+			summary := summarizeSession(session)
+			summary.Key = key
+			sm.evicted[key] = summary
+			evicted = append(evicted, key)
+		}
+		sm.mu.Unlock()
+	}
+
+	if forgetMemory && sm.messageStore != nil && sm.messageStore.IsEnabled() {
+		for _, key := range evicted {
+			if err := sm.messageStore.DeleteSessionMessages(key); err != nil {
+				logger.WarnCF("session", "Failed to delete memory of evicted session", map[string]any{
+					"session_key": key,
+					"error":       err.Error(),
+				})
+			}
+		}
+	}
+
+	return evicted
+}
+
+// idleSince reports whether the session was neither updated nor used since
+// cutoff.
+func (s *Session) idleSince(cutoff time.Time) bool {
+	return s.Updated.Before(cutoff) && s.used.Before(cutoff)
+}
+
+// changed reports whether the session was updated since it was last loaded
+// or saved.
+func (s *Session) changed() bool {
+	return !s.Updated.Equal(s.saved)
+}
+
+// RunEvictionSweeper calls EvictIdle periodically until ctx is cancelled.
+func (sm *SessionManager) RunEvictionSweeper(ctx context.Context, maxIdle time.Duration, forgetMemory bool) {
+	if sm.storage == "" || maxIdle <= 0 {
+		return
+	}
+
+	// Sweep often enough that sessions are evicted within about a tenth of
+	// the TTL after expiring
+	interval := min(max(maxIdle/10, time.Minute), time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if evicted := sm.EvictIdle(maxIdle, forgetMemory); len(evicted) > 0 {
+			logger.InfoCF("session", "Evicted idle sessions", map[string]any{
+				"count":    len(evicted),
+				"max_idle": maxIdle.String(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loaded returns session key, reading it from disk if it is not in memory,
+// and marks it used so EvictIdle keeps it for now. Callers must hold sm.mu
+// for writing and keep holding it while they use the session, so it cannot
+// be evicted in between.
+func (sm *SessionManager) loaded(key string) (*Session, bool) {
+	if session, ok := sm.sessions[key]; ok {
+		session.used = time.Now()
+		return session, true
+	}
+	if _, onDisk := sm.evicted[key]; !onDisk {
+		return nil, false
+	}
+	delete(sm.evicted, key)
+
+	session, err := readSession(filepath.Join(sm.storage, sanitizeFilename(key)))
+	if err != nil {
+		logger.WarnCF("session", "Failed to load session", map[string]any{
+			"session_key": key,
+			"error":       err.Error(),
+		})
+		return nil, false
+	}
+	session.used = time.Now()
+	session.saved = session.Updated
+	sm.sessions[key] = session
+	return session, true
+}
+
+// readSession reads the session file at base, compressed or not. Both may
+// exist if a save was interrupted; the newer is returned.
+func readSession(base string) (*Session, error) {
+	session, err := readSessionFile(base + gzipSessionFileExt)
+	plain, plainErr := readSessionFile(base + sessionFileExt)
+	switch {
+	case err != nil:
+		return plain, plainErr
+	case plainErr == nil && plain.Updated.After(session.Updated):
+		return plain, nil
+	}
+	return session, nil
+}
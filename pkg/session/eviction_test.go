@@ -0,0 +1,154 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeIdle backdates the last update and use of key.
+func makeIdle(sm *SessionManager, key string, idle time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.sessions[key].Updated = time.Now().Add(-idle)
+	sm.sessions[key].used = time.Now().Add(-idle)
+}
+
+func TestEvictIdle_EvictsAndReloads(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sm.AddMessage("telegram:old", "user", "hello from last month")
+	sm.AddMessage("telegram:old", "assistant", "hi")
+	sm.SetSummary("telegram:old", "greetings")
+	sm.AddMessage("telegram:new", "user", "hello today")
+	makeIdle(sm, "telegram:old", 30*24*time.Hour)
+
+	evicted := sm.EvictIdle(7*24*time.Hour, false)
+	if len(evicted) != 1 || evicted[0] != "telegram:old" {
+		t.Fatalf("EvictIdle() = %v, want [telegram:old]", evicted)
+	}
+	sm.mu.RLock()
+	_, inMemory := sm.sessions["telegram:old"]
+	_, activeInMemory := sm.sessions["telegram:new"]
+	sm.mu.RUnlock()
+	if inMemory || !activeInMemory {
+		t.Fatalf("in memory: old=%v new=%v, want only the active session", inMemory, activeInMemory)
+	}
+
+	// Evicted sessions are still listed
+	if all := sm.GetAllSessions(); len(all) != 2 {
+		t.Errorf("GetAllSessions() returned %d sessions, want 2", len(all))
+	}
+
+	// The next message continues the reloaded history
+	sm.AddMessage("telegram:old", "user", "I'm back")
+	history := sm.GetHistory("telegram:old")
+	if len(history) != 3 || history[0].Content != "hello from last month" || history[2].Content != "I'm back" {
+		t.Errorf("history after reload = %+v", history)
+	}
+	if got := sm.GetSummary("telegram:old"); got != "greetings" {
+		t.Errorf("summary after reload = %q, want greetings", got)
+	}
+}
+
+func TestEvictIdle_ReloadsCompressed(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sm.SetCompress(true)
+	sm.AddMessage("telegram:old", "user", "hello from last month")
+	makeIdle(sm, "telegram:old", 30*24*time.Hour)
+
+	if evicted := sm.EvictIdle(time.Hour, false); len(evicted) != 1 {
+		t.Fatalf("EvictIdle() = %v, want one session", evicted)
+	}
+	if history := sm.GetHistory("telegram:old"); len(history) != 1 || history[0].Content != "hello from last month" {
+		t.Errorf("history after reload = %+v", history)
+	}
+}
+
+func TestEvictIdle_WithoutStorage(t *testing.T) {
+	sm := NewSessionManager("")
+	sm.AddMessage("cli:direct", "user", "hello")
+	makeIdle(sm, "cli:direct", 30*24*time.Hour)
+
+	// Without a storage directory the session could not be reloaded
+	if evicted := sm.EvictIdle(time.Hour, false); len(evicted) != 0 {
+		t.Errorf("EvictIdle() = %v, want nothing evicted", evicted)
+	}
+	if len(sm.GetHistory("cli:direct")) != 1 {
+		t.Error("session history was lost")
+	}
+}
+
+func TestEvictIdle_ForgetMemory(t *testing.T) {
+	sm, fake := newStoringSessionManager(t, false)
+	sm.AddMessage("telegram:old", "user", "remember this")
+	makeIdle(sm, "telegram:old", 48*time.Hour)
+
+	if evicted := sm.EvictIdle(24*time.Hour, true); len(evicted) != 1 {
+		t.Fatalf("EvictIdle() = %v, want one session", evicted)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.deletes != 1 {
+		t.Errorf("message store deletes = %d, want 1", fake.deletes)
+	}
+}
+
+func TestSessionManager_LoadsSessionsLazily(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	sm.AddMessage("telegram:1", "user", "hello")
+	sm.AddMessage("telegram:2", "user", "hi")
+	for _, key := range []string{"telegram:1", "telegram:2"} {
+		if err := sm.Save(key); err != nil {
+			t.Fatalf("Save(%s): %v", key, err)
+		}
+	}
+
+	reloaded := NewSessionManager(dir)
+	if n := reloaded.ActiveSessionCount(); n != 0 {
+		t.Errorf("ActiveSessionCount() = %d after startup, want 0", n)
+	}
+	if all := reloaded.GetAllSessions(); len(all) != 2 || all[0].MessageCount != 1 {
+		t.Errorf("GetAllSessions() = %+v, want both sessions listed", all)
+	}
+	if history := reloaded.GetHistory("telegram:1"); len(history) != 1 || history[0].Content != "hello" {
+		t.Errorf("history = %+v", history)
+	}
+	if n := reloaded.ActiveSessionCount(); n != 1 {
+		t.Errorf("ActiveSessionCount() = %d after use, want 1", n)
+	}
+}
+
+func TestEvictIdle_KeepsUsedAndSkipsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	sm.AddMessage("telegram:old", "user", "hello from last month")
+	makeIdle(sm, "telegram:old", 30*24*time.Hour)
+	if err := sm.Save("telegram:old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading an old session counts as use, so it is not evicted right away
+	reloaded := NewSessionManager(dir)
+	reloaded.GetHistory("telegram:old")
+	if evicted := reloaded.EvictIdle(time.Hour, false); len(evicted) != 0 {
+		t.Fatalf("EvictIdle() = %v, want the session just used kept", evicted)
+	}
+
+	// Once idle it is evicted without rewriting the unchanged file
+	path := filepath.Join(dir, "telegram_old.json")
+	past := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.mu.Lock()
+	reloaded.sessions["telegram:old"].used = time.Now().Add(-2 * time.Hour)
+	reloaded.mu.Unlock()
+	if evicted := reloaded.EvictIdle(time.Hour, false); len(evicted) != 1 {
+		t.Fatalf("EvictIdle() = %v, want the idle session evicted", evicted)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("session file was rewritten (err=%v)", err)
+	}
+}
@@ -1,8 +1,12 @@
 package session
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,17 +15,39 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/moderation"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/storage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
+// maxStoredToolContent bounds tool calls and results stored in the message
+// store, keeping them within the embedding model's input limit.
+const maxStoredToolContent = 4000
+
+// closeFlushTimeout bounds how long Close waits for buffered messages to be
+// stored.
+const closeFlushTimeout = 10 * time.Second
+
 type Session struct {
 	Key      string              `json:"key"`
 	Messages []providers.Message `json:"messages"`
 	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	// Pinned are facts the user asked to keep. They are stored apart from
+	// Messages, so truncation and compaction never drop them.
+	Pinned  []string  `json:"pinned,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// Times holds when each message was added, by index into Messages.
+	// Messages from older files, or set with SetHistory, have none; see
+	// messageTimes.
+	Times []time.Time `json:"times,omitempty"`
+
+	// used is when the session was last accessed, and saved the Updated it
+	// had when last loaded or saved; EvictIdle goes by both
+	used  time.Time
+	saved time.Time
 }
 
 type SessionManager struct {
@@ -29,6 +55,31 @@ type SessionManager struct {
 	mu           sync.RWMutex
 	storage      string
 	messageStore *storage.MessageStore
+	// storeToolResults also stores tool calls and results in messageStore
+	storeToolResults bool
+	// compactJSON writes session files without indentation
+	compactJSON bool
+	// compress gzips session files
+	compress bool
+	// saveEvery saves a session once this many messages were added since
+	// its last save; 0 leaves saving to the caller. unsaved counts them.
+	saveEvery int
+	unsaved   map[string]int
+
+	// storeCtx is cancelled by Close to abort in-flight message store writes
+	storeCtx    context.Context
+	storeCancel context.CancelFunc
+
+	// batchStore buffers storable messages in pending until FlushMessages
+	// stores them in one batch; flushes tracks batches being stored
+	batchStore bool
+	pending    map[string][]storage.StoredMessage
+	flushes    sync.WaitGroup
+
+	// evicted holds sessions that are on disk but not in memory: unloaded
+	// by EvictIdle, or not used since startup. They are loaded from disk
+	// when next used.
+	evicted map[string]SessionSummary
 }
 
 func NewSessionManager(storagePath string) *SessionManager {
@@ -37,14 +88,23 @@ func NewSessionManager(storagePath string) *SessionManager {
 
 // NewSessionManagerWithConfig creates a new SessionManager with the given storage configuration
 func NewSessionManagerWithConfig(storagePath string, storageCfg config.StorageConfig) *SessionManager {
+	storeCtx, storeCancel := context.WithCancel(context.Background())
 	sm := &SessionManager{
-		sessions: make(map[string]*Session),
-		storage:  storagePath,
+		sessions:    make(map[string]*Session),
+		evicted:     make(map[string]SessionSummary),
+		unsaved:     make(map[string]int),
+		storage:     storagePath,
+		storeCtx:    storeCtx,
+		storeCancel: storeCancel,
+
+		storeToolResults: storageCfg.Qdrant.StoreToolResults,
+		batchStore:       storageCfg.Qdrant.BatchPerTurn,
+		pending:          make(map[string][]storage.StoredMessage),
 	}
 
 	if storagePath != "" {
 		os.MkdirAll(storagePath, 0o755)
-		sm.loadSessions()
+		sm.indexSessions()
 	}
 
 	// Initialize message store if Qdrant is configured
@@ -61,11 +121,68 @@ func NewSessionManagerWithConfig(storagePath string, storageCfg config.StorageCo
 	return sm
 }
 
+// SetModeration keeps messages flagged by filter out of the message store.
+// They stay in the session history.
+func (sm *SessionManager) SetModeration(filter *moderation.Filter) {
+	if sm.messageStore != nil {
+		sm.messageStore.SetModeration(filter)
+	}
+}
+
+// Close stores messages still buffered for a batch, waiting at most
+// closeFlushTimeout, then aborts message store writes still in flight, e.g.
+// embedding requests during shutdown. Messages added afterwards are kept in
+// the session but no longer stored in the vector database.
+func (sm *SessionManager) Close() {
+	sm.mu.RLock()
+	keys := make([]string, 0, len(sm.pending))
+	for key := range sm.pending {
+		keys = append(keys, key)
+	}
+	sm.mu.RUnlock()
+	for _, key := range keys {
+		sm.FlushMessages(key)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sm.flushes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeFlushTimeout):
+		fmt.Fprintf(os.Stderr, "[Qdrant] Gave up waiting for buffered messages to be stored\n")
+	}
+
+	sm.storeCancel()
+}
+
+// FlushMessages stores the messages buffered for the session in one batch,
+// in the background. It does nothing unless batch_per_turn is enabled.
+func (sm *SessionManager) FlushMessages(sessionKey string) {
+	sm.mu.Lock()
+	batch := sm.pending[sessionKey]
+	delete(sm.pending, sessionKey)
+	sm.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	sm.flushes.Add(1)
+	go func() {
+		defer sm.flushes.Done()
+		if err := sm.messageStore.StoreMessages(sm.storeCtx, batch); err != nil {
+			fmt.Fprintf(os.Stderr, "[Qdrant] Failed to store %d messages: %v\n", len(batch), err)
+		}
+	}()
+}
+
 func (sm *SessionManager) GetOrCreate(key string) *Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if ok {
 		return session
 	}
@@ -100,11 +217,26 @@ func (sm *SessionManager) AddToolMessage(sessionKey, content, toolCallID string)
 
 // AddFullMessage adds a complete message with tool calls and tool call ID to the session.
 // This is used to save the full conversation flow including tool calls and tool results.
+// With SetSaveEvery, the session is saved once enough messages were added.
 func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Message) {
+	if !sm.addMessage(sessionKey, msg) {
+		return
+	}
+	if err := sm.Save(sessionKey); err != nil {
+		logger.WarnCF("session", "Failed to save session", map[string]any{
+			"session_key": sessionKey,
+			"error":       err.Error(),
+		})
+	}
+}
+
+// addMessage appends msg to the session and stores it in the message store.
+// It reports whether the session is due to be saved.
+func (sm *SessionManager) addMessage(sessionKey string, msg providers.Message) (saveDue bool) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[sessionKey]
+	session, ok := sm.loaded(sessionKey)
 	if !ok {
 		session = &Session{
 			Key:      sessionKey,
@@ -116,46 +248,112 @@ func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Messag
 
 	session.Messages = append(session.Messages, msg)
 	session.Updated = time.Now()
+	for len(session.Times) < len(session.Messages)-1 {
+		session.Times = append(session.Times, time.Time{})
+	}
+	session.Times = append(session.Times, session.Updated)
+
+	if sm.saveEvery > 0 {
+		sm.unsaved[sessionKey]++
+		saveDue = sm.unsaved[sessionKey] >= sm.saveEvery
+	}
 
 	// Also store in Qdrant if enabled
 	if sm.messageStore != nil && sm.messageStore.IsEnabled() {
-		// Skip heartbeat messages
-		if sessionKey == "heartbeat" {
-			return
-		}
-
-		// Skip tool and system messages (internal agent messages)
-		if msg.Role == "tool" || msg.Role == "system" {
-			return
+		msg, ok := sm.storableMessage(sessionKey, msg)
+		if !ok {
+			return saveDue
 		}
 
-		// Skip assistant messages with tool calls (intermediate reasoning steps)
-		// Only final assistant responses (without tool calls) should be stored
-		if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
-			return
-		}
-
-		// Skip messages with empty content
-		if msg.Content == "" {
-			return
+		index := len(session.Messages) - 1
+		if sm.batchStore {
+			sm.pending[sessionKey] = append(sm.pending[sessionKey], storage.StoredMessage{
+				SessionKey: sessionKey,
+				Message:    msg,
+				Timestamp:  session.Updated,
+				Index:      index,
+			})
+			return saveDue
 		}
 
 		// Unlock before calling external store to avoid holding lock during I/O
 		sm.mu.Unlock()
 		defer sm.mu.Lock()
 
-		index := len(session.Messages) - 1
-		if err := sm.messageStore.StoreMessage(sessionKey, msg, index); err != nil {
+		if err := sm.messageStore.StoreMessage(sm.storeCtx, sessionKey, msg, index); err != nil {
 			fmt.Fprintf(os.Stderr, "[Qdrant] Failed to store message: %v\n", err)
 		}
 	}
+	return saveDue
+}
+
+// storableMessage returns msg as it is stored in the message store, or false
+// if it should not be stored.
+func (sm *SessionManager) storableMessage(sessionKey string, msg providers.Message) (providers.Message, bool) {
+	// Skip heartbeat messages
+	if sessionKey == "heartbeat" {
+		return msg, false
+	}
+
+	// Skip system messages (internal agent messages)
+	if msg.Role == "system" {
+		return msg, false
+	}
+
+	// Tool results and assistant messages with tool calls (intermediate
+	// reasoning steps) are skipped unless configured otherwise, so by
+	// default only final assistant responses are stored
+	switch {
+	case msg.Role == "tool":
+		if !sm.storeToolResults {
+			return msg, false
+		}
+		msg.Content = utils.Truncate(msg.Content, maxStoredToolContent)
+	case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+		if !sm.storeToolResults {
+			return msg, false
+		}
+		msg = toolCallMessage(msg)
+	}
+
+	// Skip messages with empty content
+	return msg, msg.Content != ""
+}
+
+// toolCallMessage converts an assistant message with tool calls into a
+// "tool_call" message describing each call, for storage.
+func toolCallMessage(msg providers.Message) providers.Message {
+	lines := make([]string, 0, len(msg.ToolCalls)+1)
+	if msg.Content != "" {
+		lines = append(lines, msg.Content)
+	}
+	for _, tc := range msg.ToolCalls {
+		name, args := tc.Name, ""
+		if tc.Function != nil {
+			if name == "" {
+				name = tc.Function.Name
+			}
+			args = tc.Function.Arguments
+		}
+		if args == "" && tc.Arguments != nil {
+			if data, err := json.Marshal(tc.Arguments); err == nil {
+				args = string(data)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s(%s)", name, args))
+	}
+
+	return providers.Message{
+		Role:    "tool_call",
+		Content: utils.Truncate(strings.Join(lines, "\n"), maxStoredToolContent),
+	}
 }
 
 func (sm *SessionManager) GetHistory(key string) []providers.Message {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if !ok {
 		return []providers.Message{}
 	}
@@ -166,10 +364,10 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 }
 
 func (sm *SessionManager) GetSummary(key string) string {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if !ok {
 		return ""
 	}
@@ -180,7 +378,7 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if ok {
 		session.Summary = summary
 		session.Updated = time.Now()
@@ -191,13 +389,14 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if !ok {
 		return
 	}
 
 	if keepLast <= 0 {
 		session.Messages = []providers.Message{}
+		session.Times = nil
 		session.Updated = time.Now()
 		return
 	}
@@ -206,6 +405,11 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 		return
 	}
 
+	if len(session.Times) == len(session.Messages) {
+		session.Times = session.Times[len(session.Times)-keepLast:]
+	} else {
+		session.Times = nil
+	}
 	session.Messages = session.Messages[len(session.Messages)-keepLast:]
 	session.Updated = time.Now()
 }
@@ -214,11 +418,99 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 // Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
 // volume separator on Windows, so filepath.Base would misinterpret the key.
 // We replace it with '_'. The original key is preserved inside the JSON file,
-// so loadSessions still maps back to the right in-memory key.
+// so indexSessions still maps back to the right in-memory key.
+const (
+	sessionFileExt     = ".json"
+	gzipSessionFileExt = ".json.gz"
+)
+
 func sanitizeFilename(key string) string {
 	return strings.ReplaceAll(key, ":", "_")
 }
 
+// SetCompactJSON selects compact (true) or indented (false, the default)
+// JSON for session files written by Save.
+func (sm *SessionManager) SetCompactJSON(compact bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.compactJSON = compact
+}
+
+// SetCompress enables gzip compression of session files written by Save.
+// Files are stored as <key>.json.gz; existing .json files are still read and
+// are replaced by the compressed file on their next save.
+func (sm *SessionManager) SetCompress(compress bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.compress = compress
+}
+
+// SetSaveEvery makes AddFullMessage save a session after every n messages
+// added since it was last saved, bounding what a crash can lose. 0 (the
+// default) saves only when Save is called.
+func (sm *SessionManager) SetSaveEvery(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.saveEvery = n
+}
+
+// encodeSession returns the file contents for session and the extension of
+// the file to write them to.
+func (sm *SessionManager) encodeSession(session *Session) ([]byte, string, error) {
+	sm.mu.RLock()
+	compact, compress := sm.compactJSON, sm.compress
+	sm.mu.RUnlock()
+
+	var data []byte
+	var err error
+	if compact {
+		data, err = json.Marshal(session)
+	} else {
+		data, err = json.MarshalIndent(session, "", "  ")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !compress {
+		return data, sessionFileExt, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), gzipSessionFileExt, nil
+}
+
+// readSessionFile loads a session file, decompressing it if its name ends
+// in .gz.
+func readSessionFile(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
 func (sm *SessionManager) Save(key string) error {
 	if sm.storage == "" {
 		return nil
@@ -234,19 +526,22 @@ func (sm *SessionManager) Save(key string) error {
 		return os.ErrInvalid
 	}
 
-	// Snapshot under read lock, then perform slow file I/O after unlock.
-	sm.mu.RLock()
+	// Snapshot under lock, then perform slow file I/O after unlock.
+	sm.mu.Lock()
 	stored, ok := sm.sessions[key]
 	if !ok {
-		sm.mu.RUnlock()
+		sm.mu.Unlock()
 		return nil
 	}
+	delete(sm.unsaved, key)
 
 	snapshot := Session{
 		Key:     stored.Key,
 		Summary: stored.Summary,
+		Pinned:  append([]string(nil), stored.Pinned...),
 		Created: stored.Created,
 		Updated: stored.Updated,
+		Times:   append([]time.Time(nil), stored.Times...),
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
@@ -254,14 +549,14 @@ func (sm *SessionManager) Save(key string) error {
 	} else {
 		snapshot.Messages = []providers.Message{}
 	}
-	sm.mu.RUnlock()
+	sm.mu.Unlock()
 
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+	data, ext, err := sm.encodeSession(&snapshot)
 	if err != nil {
 		return err
 	}
 
-	sessionPath := filepath.Join(sm.storage, filename+".json")
+	sessionPath := filepath.Join(sm.storage, filename+ext)
 	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
 	if err != nil {
 		return err
@@ -295,10 +590,26 @@ func (sm *SessionManager) Save(key string) error {
 		return err
 	}
 	cleanup = false
+
+	sm.mu.Lock()
+	if stored, ok := sm.sessions[key]; ok && stored.Updated.Equal(snapshot.Updated) {
+		stored.saved = snapshot.Updated
+	}
+	sm.mu.Unlock()
+
+	// Drop the file written in the other format so it is not loaded instead
+	// of this one
+	stale := gzipSessionFileExt
+	if ext == gzipSessionFileExt {
+		stale = sessionFileExt
+	}
+	_ = os.Remove(filepath.Join(sm.storage, filename+stale))
 	return nil
 }
 
-func (sm *SessionManager) loadSessions() error {
+// indexSessions lists the sessions stored on disk without keeping them in
+// memory; each is loaded when first used.
+func (sm *SessionManager) indexSessions() error {
 	files, err := os.ReadDir(sm.storage)
 	if err != nil {
 		return err
@@ -309,22 +620,21 @@ func (sm *SessionManager) loadSessions() error {
 			continue
 		}
 
-		if filepath.Ext(file.Name()) != ".json" {
+		name := file.Name()
+		if !strings.HasSuffix(name, sessionFileExt) && !strings.HasSuffix(name, gzipSessionFileExt) {
 			continue
 		}
 
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
+		session, err := readSessionFile(filepath.Join(sm.storage, name))
 		if err != nil {
 			continue
 		}
 
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
+		// Both formats may exist if a save was interrupted; list the newer
+		if existing, ok := sm.evicted[session.Key]; ok && existing.Updated.After(session.Updated) {
 			continue
 		}
-
-		sm.sessions[session.Key] = &session
+		sm.evicted[session.Key] = summarizeSession(session)
 	}
 
 	return nil
@@ -335,13 +645,14 @@ func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
+	session, ok := sm.loaded(key)
 	if ok {
 		// Create a deep copy to strictly isolate internal state
 		// from the caller's slice.
 		msgs := make([]providers.Message, len(history))
 		copy(msgs, history)
 		session.Messages = msgs
+		session.Times = nil
 		session.Updated = time.Now()
 	}
 }
@@ -370,24 +681,15 @@ func (sm *SessionManager) GetAllSessions() []SessionSummary {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	summaries := make([]SessionSummary, 0, len(sm.sessions))
+	summaries := make([]SessionSummary, 0, len(sm.sessions)+len(sm.evicted))
 	for key, session := range sm.sessions {
-		// Get preview (last user message, truncated)
-		preview := ""
-		for i := len(session.Messages) - 1; i >= 0; i-- {
-			if session.Messages[i].Role == "user" && session.Messages[i].Content != "" {
-				preview = utils.Truncate(session.Messages[i].Content, 100)
-				break
-			}
-		}
+		summary := summarizeSession(session)
+		summary.Key = key
+		summaries = append(summaries, summary)
+	}
 
-		summaries = append(summaries, SessionSummary{
-			Key:          key,
-			MessageCount: len(session.Messages),
-			Created:      session.Created,
-			Updated:      session.Updated,
-			Preview:      preview,
-		})
+	for _, summary := range sm.evicted {
+		summaries = append(summaries, summary)
 	}
 
 	// Sort by UpdatedAt (newest first)
@@ -397,3 +699,40 @@ func (sm *SessionManager) GetAllSessions() []SessionSummary {
 
 	return summaries
 }
+
+// ActiveSessionCount returns the number of sessions held in memory, i.e. not
+// evicted for being idle.
+func (sm *SessionManager) ActiveSessionCount() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.sessions)
+}
+
+// MemoryStats returns the long-term memory collection stats, or nil if
+// long-term memory is not enabled.
+func (sm *SessionManager) MemoryStats(ctx context.Context) (*storage.CollectionInfo, error) {
+	if sm.messageStore == nil || !sm.messageStore.IsEnabled() {
+		return nil, nil
+	}
+	return sm.messageStore.Stats(ctx)
+}
+
+// summarizeSession returns the listing entry for session.
+func summarizeSession(session *Session) SessionSummary {
+	// Get preview (last user message, truncated)
+	preview := ""
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		if session.Messages[i].Role == "user" && session.Messages[i].Content != "" {
+			preview = utils.Truncate(session.Messages[i].Content, 100)
+			break
+		}
+	}
+
+	return SessionSummary{
+		Key:          session.Key,
+		MessageCount: len(session.Messages),
+		Created:      session.Created,
+		Updated:      session.Updated,
+		Preview:      preview,
+	}
+}
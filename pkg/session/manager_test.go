@@ -1,8 +1,15 @@
 package session
 
 import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -63,6 +70,147 @@ func TestSave_WithColonInKey(t *testing.T) {
 	}
 }
 
+func TestSave_CompactJSON(t *testing.T) {
+	sizes := map[bool]int64{}
+	for _, compact := range []bool{false, true} {
+		tmpDir := t.TempDir()
+		sm := NewSessionManager(tmpDir)
+		sm.SetCompactJSON(compact)
+
+		key := "telegram:123456"
+		for i := 0; i < 20; i++ {
+			sm.AddMessage(key, "user", "message "+strconv.Itoa(i))
+		}
+		sm.SetSummary(key, "a long chat")
+		if err := sm.Save(key); err != nil {
+			t.Fatalf("Save (compact=%v) failed: %v", compact, err)
+		}
+
+		path := filepath.Join(tmpDir, "telegram_123456.json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading session file: %v", err)
+		}
+		if indented := strings.Contains(string(data), "\n  "); indented == compact {
+			t.Errorf("compact=%v wrote indented=%v", compact, indented)
+		}
+		sizes[compact] = int64(len(data))
+
+		reloaded := NewSessionManager(tmpDir)
+		history := reloaded.GetHistory(key)
+		if len(history) != 20 || history[19].Content != "message 19" {
+			t.Errorf("compact=%v: reloaded history = %v", compact, history)
+		}
+		if got := reloaded.GetSummary(key); got != "a long chat" {
+			t.Errorf("compact=%v: reloaded summary = %q", compact, got)
+		}
+	}
+
+	if sizes[true] >= sizes[false] {
+		t.Errorf("compact file is %d bytes, indented %d; want compact smaller", sizes[true], sizes[false])
+	}
+}
+
+func TestSave_Compressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	key := "telegram:123456"
+	text := strings.Repeat("the same words over and over ", 50)
+
+	// Start from an uncompressed file, as written before compression was enabled
+	plain := NewSessionManager(tmpDir)
+	plain.AddMessage(key, "user", text)
+	if err := plain.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	plainPath := filepath.Join(tmpDir, "telegram_123456.json")
+	plainInfo, err := os.Stat(plainPath)
+	if err != nil {
+		t.Fatalf("expected %s: %v", plainPath, err)
+	}
+
+	sm := NewSessionManager(tmpDir)
+	sm.SetCompress(true)
+	if history := sm.GetHistory(key); len(history) != 1 || history[0].Content != text {
+		t.Fatalf("uncompressed session not loaded: %v", history)
+	}
+	sm.AddMessage(key, "assistant", "noted")
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("compressed Save failed: %v", err)
+	}
+
+	gzPath := filepath.Join(tmpDir, "telegram_123456.json.gz")
+	gzInfo, err := os.Stat(gzPath)
+	if err != nil {
+		t.Fatalf("expected %s: %v", gzPath, err)
+	}
+	if _, err := os.Stat(plainPath); !os.IsNotExist(err) {
+		t.Errorf("uncompressed file left behind after compressed save")
+	}
+	if gzInfo.Size() >= plainInfo.Size() {
+		t.Errorf("compressed file is %d bytes, uncompressed %d", gzInfo.Size(), plainInfo.Size())
+	}
+
+	// Compressed files load regardless of the setting
+	reloaded := NewSessionManager(tmpDir)
+	history := reloaded.GetHistory(key)
+	if len(history) != 2 || history[0].Content != text || history[1].Content != "noted" {
+		t.Fatalf("reloaded history = %v", history)
+	}
+
+	// Saving without compression switches back to .json
+	if err := reloaded.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(gzPath); !os.IsNotExist(err) {
+		t.Errorf("compressed file left behind after uncompressed save")
+	}
+	if len(NewSessionManager(tmpDir).GetHistory(key)) != 2 {
+		t.Error("session lost after switching back to uncompressed")
+	}
+}
+
+func TestAddFullMessage_SaveEvery(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	sm.SetSaveEvery(3)
+
+	key := "telegram:42"
+	path := filepath.Join(tmpDir, "telegram_42.json")
+	savedMessages := func() int {
+		session, err := readSessionFile(path)
+		if err != nil {
+			return -1
+		}
+		return len(session.Messages)
+	}
+
+	sm.AddMessage(key, "user", "one")
+	sm.AddMessage(key, "assistant", "two")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("session saved before the third message")
+	}
+
+	sm.AddMessage(key, "user", "three")
+	if got := savedMessages(); got != 3 {
+		t.Fatalf("after the third message the file holds %d messages, want 3", got)
+	}
+
+	// A manual save restarts the count
+	sm.AddMessage(key, "assistant", "four")
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+	sm.AddMessage(key, "user", "five")
+	sm.AddMessage(key, "assistant", "six")
+	if got := savedMessages(); got != 4 {
+		t.Errorf("file holds %d messages two messages after a save, want 4", got)
+	}
+	sm.AddMessage(key, "user", "seven")
+	if got := savedMessages(); got != 7 {
+		t.Errorf("file holds %d messages, want 7", got)
+	}
+}
+
 func TestSave_RejectsPathTraversal(t *testing.T) {
 	tmpDir := t.TempDir()
 	sm := NewSessionManager(tmpDir)
@@ -193,3 +341,178 @@ func TestAddFullMessage_FiltersIntermediateAssistantMessages(t *testing.T) {
 		t.Errorf("Expected second stored role to be 'assistant', got '%s'", storedRoles[1])
 	}
 }
+
+// fakeVectorStore serves the Qdrant and embeddings endpoints used by the
+// message store and records the roles of upserted messages.
+type fakeVectorStore struct {
+	mu      sync.Mutex
+	roles   []string
+	texts   []string
+	indices []int
+	deletes int
+	upserts int
+}
+
+func (f *fakeVectorStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/embeddings"):
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, len(req.Input))
+		for i := range req.Input {
+			data[i] = map[string]any{"embedding": []float32{0.1, 0.2, 0.3}, "index": i}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	case strings.HasSuffix(r.URL.Path, "/points"):
+		var req struct {
+			Points []struct {
+				Payload struct {
+					Role         string `json:"role"`
+					Content      string `json:"content"`
+					MessageIndex int    `json:"message_index"`
+				} `json:"payload"`
+			} `json:"points"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.upserts++
+		for _, p := range req.Points {
+			f.roles = append(f.roles, p.Payload.Role)
+			f.texts = append(f.texts, p.Payload.Content)
+			f.indices = append(f.indices, p.Payload.MessageIndex)
+		}
+		f.mu.Unlock()
+		w.Write([]byte(`{"result":{}}`))
+	case strings.HasSuffix(r.URL.Path, "/points/delete"):
+		f.mu.Lock()
+		f.deletes++
+		f.mu.Unlock()
+		w.Write([]byte(`{"result":{}}`))
+	default:
+		// Collection exists
+		w.Write([]byte(`{"result":{}}`))
+	}
+}
+
+func newStoringSessionManager(t *testing.T, storeToolResults bool) (*SessionManager, *fakeVectorStore) {
+	t.Helper()
+	return newStoringSessionManagerWithConfig(t, config.QdrantConfig{StoreToolResults: storeToolResults})
+}
+
+// newStoringSessionManagerWithConfig creates a session manager storing
+// messages in a fake Qdrant; qdrant supplies the settings besides the
+// connection.
+func newStoringSessionManagerWithConfig(t *testing.T, qdrant config.QdrantConfig) (*SessionManager, *fakeVectorStore) {
+	t.Helper()
+	fake := &fakeVectorStore{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	qdrant.Enabled = true
+	qdrant.Host = host
+	qdrant.Port = port
+	qdrant.Collection = "test"
+	qdrant.VectorSize = 3
+	sm := NewSessionManagerWithConfig(t.TempDir(), config.StorageConfig{
+		Qdrant:    qdrant,
+		Embedding: config.EmbeddingConfig{APIBase: server.URL, APIKey: "test-key"},
+	})
+	if sm.messageStore == nil || !sm.messageStore.IsEnabled() {
+		t.Fatal("message store not enabled")
+	}
+	return sm, fake
+}
+
+func addToolExchange(sm *SessionManager, key string) {
+	sm.AddFullMessage(key, providers.Message{Role: "user", Content: "Search for picoclaw"})
+	sm.AddFullMessage(key, providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{{
+			ID:        "call_1",
+			Name:      "web_search",
+			Arguments: map[string]any{"query": "picoclaw"},
+		}},
+	})
+	sm.AddFullMessage(key, providers.Message{Role: "tool", Content: "PicoClaw is a tiny agent", ToolCallID: "call_1"})
+	sm.AddFullMessage(key, providers.Message{Role: "assistant", Content: "It is a tiny agent"})
+}
+
+func TestAddFullMessage_SkipsToolResultsByDefault(t *testing.T) {
+	sm, fake := newStoringSessionManager(t, false)
+	addToolExchange(sm, "test:session")
+
+	if got := strings.Join(fake.roles, ","); got != "user,assistant" {
+		t.Errorf("stored roles = %s, want user,assistant", got)
+	}
+}
+
+func TestAddFullMessage_StoresToolResultsWhenEnabled(t *testing.T) {
+	sm, fake := newStoringSessionManager(t, true)
+	addToolExchange(sm, "test:session")
+
+	if got := strings.Join(fake.roles, ","); got != "user,tool_call,tool,assistant" {
+		t.Fatalf("stored roles = %s, want user,tool_call,tool,assistant", got)
+	}
+	if fake.texts[1] != `web_search({"query":"picoclaw"})` {
+		t.Errorf("tool call stored as %q", fake.texts[1])
+	}
+	if fake.texts[2] != "PicoClaw is a tiny agent" {
+		t.Errorf("tool result stored as %q", fake.texts[2])
+	}
+
+	// The session history keeps the original messages
+	history := sm.GetHistory("test:session")
+	if len(history) != 4 || history[1].Role != "assistant" || history[2].Role != "tool" {
+		t.Errorf("history changed: %+v", history)
+	}
+}
+
+func TestAddFullMessage_BatchPerTurn(t *testing.T) {
+	sm, fake := newStoringSessionManagerWithConfig(t, config.QdrantConfig{BatchPerTurn: true})
+	key := "test:session"
+
+	sm.AddMessage(key, "user", "What is the capital of Portugal?")
+	sm.AddMessage(key, "system", "internal note")
+	sm.AddMessage(key, "assistant", "Lisbon")
+	if fake.upserts != 0 {
+		t.Fatalf("%d upserts before the turn ended, want none", fake.upserts)
+	}
+
+	// The turn's messages are stored in one batch
+	sm.FlushMessages(key)
+	sm.flushes.Wait()
+	if fake.upserts != 1 {
+		t.Errorf("turn stored in %d upserts, want 1", fake.upserts)
+	}
+	if got := strings.Join(fake.roles, ","); got != "user,assistant" {
+		t.Errorf("stored roles = %s, want user,assistant", got)
+	}
+	if len(fake.indices) != 2 || fake.indices[0] != 0 || fake.indices[1] != 2 {
+		t.Errorf("stored indices = %v, want [0 2]", fake.indices)
+	}
+
+	// Nothing is left to flush
+	sm.FlushMessages(key)
+	sm.flushes.Wait()
+	if fake.upserts != 1 {
+		t.Errorf("a second flush stored again (%d upserts)", fake.upserts)
+	}
+}
+
+func TestClose_FlushesBufferedMessages(t *testing.T) {
+	sm, fake := newStoringSessionManagerWithConfig(t, config.QdrantConfig{BatchPerTurn: true})
+	sm.AddMessage("test:a", "user", "remember the milk")
+	sm.AddMessage("test:b", "user", "remember the eggs")
+
+	sm.Close()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.upserts != 2 || len(fake.texts) != 2 {
+		t.Errorf("Close stored %d messages in %d upserts, want both sessions' messages", len(fake.texts), fake.upserts)
+	}
+}
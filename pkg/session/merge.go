@@ -0,0 +1,176 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// messageTimes returns when each message of the session was added. Messages
+// without a recorded time are spread evenly between the session's creation
+// and last update. Callers must hold the manager's lock.
+func (s *Session) messageTimes() []time.Time {
+	times := make([]time.Time, len(s.Messages))
+	for i := range s.Messages {
+		if i < len(s.Times) && !s.Times[i].IsZero() {
+			times[i] = s.Times[i]
+		} else {
+			times[i] = interpolateTime(s.Created, s.Updated, i, len(s.Messages))
+		}
+	}
+	return times
+}
+
+// MergeSessions adds the messages of session src to session dst, e.g. when
+// a user continues a conversation from another chat. Turns of both are
+// ordered by the time they were added; within each session their order is
+// kept. Turns of src whose messages dst already holds are skipped. Pinned entries are combined and src's summary is
+// appended to dst's. With deleteSrc, src is removed from memory and disk;
+// its messages in long-term memory are kept. dst is saved and the number of
+// messages added is returned.
+func (sm *SessionManager) MergeSessions(dst, src string, deleteSrc bool) (int, error) {
+	if dst == src {
+		return 0, fmt.Errorf("cannot merge session %s into itself", src)
+	}
+	sm.mu.Lock()
+	from, ok := sm.loaded(src)
+	if !ok {
+		sm.mu.Unlock()
+		return 0, fmt.Errorf("session %s not found", src)
+	}
+	into, ok := sm.loaded(dst)
+	if !ok {
+		into = &Session{Key: dst, Messages: []providers.Message{}, Created: from.Created}
+		sm.sessions[dst] = into
+	}
+
+	added := mergeInto(into, from)
+
+	for _, pin := range from.Pinned {
+		if !slices.Contains(into.Pinned, pin) {
+			into.Pinned = append(into.Pinned, pin)
+		}
+	}
+	if from.Summary != "" {
+		if into.Summary == "" {
+			into.Summary = from.Summary
+		} else {
+			into.Summary += "\n\n" + from.Summary
+		}
+	}
+	if from.Created.Before(into.Created) {
+		into.Created = from.Created
+	}
+	into.Updated = time.Now()
+
+	if deleteSrc {
+		delete(sm.sessions, src)
+		delete(sm.evicted, src)
+		delete(sm.pending, src)
+		delete(sm.unsaved, src)
+	}
+	sm.mu.Unlock()
+
+	if err := sm.Save(dst); err != nil {
+		return added, fmt.Errorf("failed to save merged session: %w", err)
+	}
+	if deleteSrc && sm.storage != "" {
+		base := filepath.Join(sm.storage, sanitizeFilename(src))
+		for _, ext := range []string{sessionFileExt, gzipSessionFileExt} {
+			if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+				return added, fmt.Errorf("failed to delete session %s: %w", src, err)
+			}
+		}
+	}
+	return added, nil
+}
+
+// mergeInto merges the messages of from into into by time and returns how
+// many were added. Whole turns, a user message and the assistant and tool
+// messages answering it, are merged, so tool calls stay next to their results
+// and the two conversations do not interleave within a turn. A turn of from
+// whose messages into already holds is skipped. Caller must hold sm.mu.
+func mergeInto(into, from *Session) int {
+	intoTurns := splitTurns(into.Messages, into.messageTimes())
+	fromTurns := splitTurns(from.Messages, from.messageTimes())
+
+	seen := make(map[string]bool, len(into.Messages))
+	for _, msg := range into.Messages {
+		seen[messageKey(msg)] = true
+	}
+
+	messages := make([]providers.Message, 0, len(into.Messages)+len(from.Messages))
+	times := make([]time.Time, 0, cap(messages))
+	i, j, added := 0, 0, 0
+	for i < len(intoTurns) || j < len(fromTurns) {
+		if j == len(fromTurns) || i < len(intoTurns) && !intoTurns[i].start().After(fromTurns[j].start()) {
+			messages = append(messages, intoTurns[i].messages...)
+			times = append(times, intoTurns[i].times...)
+			i++
+			continue
+		}
+		if t := fromTurns[j]; !t.within(seen) {
+			for _, msg := range t.messages {
+				seen[messageKey(msg)] = true
+			}
+			messages = append(messages, t.messages...)
+			times = append(times, t.times...)
+			added += len(t.messages)
+		}
+		j++
+	}
+
+	into.Messages = messages
+	into.Times = times
+	return added
+}
+
+// turn is a user message with the messages that follow it up to the next
+// user message. Messages before the first user message form a turn too.
+type turn struct {
+	messages []providers.Message
+	times    []time.Time
+}
+
+func (t turn) start() time.Time {
+	return t.times[0]
+}
+
+// within reports whether every message of the turn is in seen.
+func (t turn) within(seen map[string]bool) bool {
+	for _, msg := range t.messages {
+		if !seen[messageKey(msg)] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTurns splits messages, added at times, into turns.
+func splitTurns(messages []providers.Message, times []time.Time) []turn {
+	var turns []turn
+	for i, msg := range messages {
+		if len(turns) == 0 || msg.Role == "user" {
+			turns = append(turns, turn{})
+		}
+		t := &turns[len(turns)-1]
+		t.messages = append(t.messages, msg)
+		t.times = append(t.times, times[i])
+	}
+	return turns
+}
+
+// messageKey identifies a message for de-duplication. The time is left out:
+// copies of a session made at different times hold the same message.
+func messageKey(msg providers.Message) string {
+	ids := make([]string, len(msg.ToolCalls))
+	for i, tc := range msg.ToolCalls {
+		ids[i] = tc.ID
+	}
+	return strings.Join([]string{msg.Role, msg.Content, msg.ToolCallID, strings.Join(ids, ",")}, "\x00")
+}
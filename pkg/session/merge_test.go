@@ -0,0 +1,139 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// setMessages replaces the history of key with messages added at times.
+func setMessages(sm *SessionManager, key string, contents []string, times []time.Time) {
+	session := sm.GetOrCreate(key)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Messages = nil
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		session.Messages = append(session.Messages, providers.Message{Role: role, Content: content})
+	}
+	session.Times = times
+	session.Created, session.Updated = times[0], times[len(times)-1]
+}
+
+func TestMergeSessions(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	setMessages(sm, "telegram:1", []string{"hi from phone", "hello", "still there?", "yes"},
+		[]time.Time{at(0), at(1), at(10), at(11)})
+	// The laptop chat repeats the first turn, e.g. after an earlier copy of
+	// the session, and adds a turn in between
+	setMessages(sm, "webui:1", []string{"hi from phone", "hello", "from laptop", "noted"},
+		[]time.Time{at(0).Add(time.Second), at(1).Add(time.Second), at(5), at(6)})
+	sm.Pin("webui:1", "deadline is Friday")
+	if err := sm.Save("webui:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := sm.MergeSessions("telegram:1", "webui:1", true)
+	if err != nil {
+		t.Fatalf("MergeSessions failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("added %d messages, want 2 (the duplicate turn skipped)", added)
+	}
+
+	want := "hi from phone,hello,from laptop,noted,still there?,yes"
+	var got []string
+	for _, msg := range sm.GetHistory("telegram:1") {
+		got = append(got, msg.Content)
+	}
+	if strings.Join(got, ",") != want {
+		t.Errorf("merged history = %v, want %s", got, want)
+	}
+	if pinned := sm.GetPinned("telegram:1"); len(pinned) != 1 || pinned[0] != "deadline is Friday" {
+		t.Errorf("pinned = %v, want the pin of the merged session", pinned)
+	}
+
+	// The source is gone, and the merged session and its times survive a reload
+	if _, err := os.Stat(filepath.Join(tmpDir, "webui_1.json")); !os.IsNotExist(err) {
+		t.Error("source session file should be deleted")
+	}
+	reloaded := NewSessionManager(tmpDir)
+	if len(reloaded.GetHistory("webui:1")) != 0 {
+		t.Error("source session should not be reloaded")
+	}
+	reloaded.mu.Lock()
+	session, _ := reloaded.loaded("telegram:1")
+	times := session.Times
+	reloaded.mu.Unlock()
+	if len(times) != 6 || !times[2].Equal(at(5)) {
+		t.Errorf("reloaded times = %v, want the original time of each message", times)
+	}
+}
+
+func TestMergeSessions_KeepsTurnsTogether(t *testing.T) {
+	sm := NewSessionManager("")
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	setMessages(sm, "a", []string{"first", "ok", "third", "ok"}, []time.Time{at(0), at(1), at(4), at(5)})
+	sm.GetOrCreate("b")
+	sm.mu.Lock()
+	b := sm.sessions["b"]
+	b.Messages = []providers.Message{
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "list_dir"}}},
+		{Role: "tool", Content: "a.txt", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "a.txt"},
+	}
+	// The tool ran while the other chat went on
+	b.Times = []time.Time{at(2), at(3), at(6), at(7)}
+	b.Created, b.Updated = at(2), at(7)
+	sm.mu.Unlock()
+
+	if _, err := sm.MergeSessions("a", "b", false); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range sm.GetHistory("a") {
+		got = append(got, msg.Role)
+	}
+	want := "user,assistant,user,assistant,tool,assistant,user,assistant"
+	if strings.Join(got, ",") != want {
+		t.Errorf("merged roles = %v, want %s", got, want)
+	}
+}
+
+func TestMergeSessions_KeepSource(t *testing.T) {
+	sm := NewSessionManager("")
+	sm.AddMessage("a", "user", "one")
+	sm.AddMessage("b", "user", "two")
+
+	if _, err := sm.MergeSessions("a", "b", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sm.GetHistory("b")); got != 1 {
+		t.Errorf("source has %d messages after merging, want it kept", got)
+	}
+	history := sm.GetHistory("a")
+	if len(history) != 2 || history[0].Content != "one" || history[1].Content != "two" {
+		t.Errorf("merged history = %v", history)
+	}
+
+	if _, err := sm.MergeSessions("a", "missing", false); err == nil {
+		t.Error("merging a missing session should fail")
+	}
+	if _, err := sm.MergeSessions("a", "a", false); err == nil {
+		t.Error("merging a session into itself should fail")
+	}
+}
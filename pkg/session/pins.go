@@ -0,0 +1,54 @@
+package session
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Pin keeps content in the session regardless of truncation and compaction.
+// Pinning the same content twice keeps a single copy. It reports whether the
+// content was newly pinned.
+func (sm *SessionManager) Pin(key, content string) bool {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return false
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.loaded(key)
+	if !ok || slices.Contains(session.Pinned, content) {
+		return false
+	}
+	session.Pinned = append(session.Pinned, content)
+	session.Updated = time.Now()
+	return true
+}
+
+// Unpin removes the pinned entry at index, as listed by GetPinned.
+func (sm *SessionManager) Unpin(key string, index int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.loaded(key)
+	if !ok || index < 0 || index >= len(session.Pinned) {
+		return fmt.Errorf("no pinned entry %d", index+1)
+	}
+	session.Pinned = slices.Delete(session.Pinned, index, index+1)
+	session.Updated = time.Now()
+	return nil
+}
+
+// GetPinned returns a copy of the pinned entries of the session, oldest first.
+func (sm *SessionManager) GetPinned(key string) []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.loaded(key)
+	if !ok {
+		return nil
+	}
+	return slices.Clone(session.Pinned)
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestPinnedSurviveTruncation(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	key := "telegram:42"
+	sm.AddMessage(key, "user", "Remember my address is 1 Main St")
+	sm.AddMessage(key, "assistant", "Got it")
+
+	if !sm.Pin(key, "My address is 1 Main St") {
+		t.Fatal("Pin() = false, want the entry pinned")
+	}
+	if sm.Pin(key, "  My address is 1 Main St ") {
+		t.Error("pinning the same entry twice kept a duplicate")
+	}
+	sm.Pin(key, "Call me Sam")
+
+	// Neither clearing nor compaction drops pinned entries
+	sm.TruncateHistory(key, 0)
+	sm.SetHistory(key, []providers.Message{{Role: "user", Content: "later"}})
+	want := []string{"My address is 1 Main St", "Call me Sam"}
+	if got := sm.GetPinned(key); !slices.Equal(got, want) {
+		t.Fatalf("GetPinned() after truncation = %v, want %v", got, want)
+	}
+
+	// Pins are saved with the session
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if got := NewSessionManager(dir).GetPinned(key); !slices.Equal(got, want) {
+		t.Errorf("GetPinned() after reload = %v, want %v", got, want)
+	}
+
+	if err := sm.Unpin(key, 0); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if got := sm.GetPinned(key); !slices.Equal(got, []string{"Call me Sam"}) {
+		t.Errorf("GetPinned() after unpin = %v", got)
+	}
+	if err := sm.Unpin(key, 5); err == nil {
+		t.Error("Unpin() of a missing entry succeeded")
+	}
+
+	// Forgetting the session drops its pins too
+	if err := sm.ForgetSession(key); err != nil {
+		t.Fatalf("ForgetSession failed: %v", err)
+	}
+	if got := sm.GetPinned(key); len(got) != 0 {
+		t.Errorf("GetPinned() after forgetting = %v", got)
+	}
+}
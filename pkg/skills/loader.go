@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -20,9 +21,26 @@ const (
 	MaxDescriptionLength = 1024
 )
 
+// Skill definition files, looked up in this order in each skill directory.
+// SKILL.md holds frontmatter metadata followed by the instructions;
+// skill.json is a manifest with the instructions in its "instructions" field.
+const (
+	SkillFile         = "SKILL.md"
+	SkillManifestFile = "skill.json"
+)
+
 type SkillMetadata struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Always puts the skill's full instructions into the system prompt
+	// instead of only listing it.
+	Always bool `json:"always,omitempty"`
+}
+
+// skillManifest is the content of a skill.json file.
+type skillManifest struct {
+	SkillMetadata
+	Instructions string `json:"instructions"`
 }
 
 type SkillInfo struct {
@@ -30,6 +48,7 @@ type SkillInfo struct {
 	Path        string `json:"path"`
 	Source      string `json:"source"`
 	Description string `json:"description"`
+	Always      bool   `json:"always,omitempty"`
 }
 
 func (info SkillInfo) validate() error {
@@ -85,8 +104,8 @@ func (sl *SkillsLoader) ListSkills() []SkillInfo {
 			if !d.IsDir() {
 				continue
 			}
-			skillFile := filepath.Join(dir, d.Name(), "SKILL.md")
-			if _, err := os.Stat(skillFile); err != nil {
+			skillFile := findSkillFile(filepath.Join(dir, d.Name()))
+			if skillFile == "" {
 				continue
 			}
 			info := SkillInfo{
@@ -98,6 +117,7 @@ func (sl *SkillsLoader) ListSkills() []SkillInfo {
 			if metadata != nil {
 				info.Description = metadata.Description
 				info.Name = metadata.Name
+				info.Always = metadata.Always
 			}
 			if err := info.validate(); err != nil {
 				slog.Warn("invalid skill from "+source, "name", info.Name, "error", err)
@@ -120,31 +140,48 @@ func (sl *SkillsLoader) ListSkills() []SkillInfo {
 }
 
 func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
-	// 1. load from workspace skills first (project-level)
-	if sl.workspaceSkills != "" {
-		skillFile := filepath.Join(sl.workspaceSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+	// Priority: workspace (project-level) > global (~/.picoclaw/skills) > builtin
+	for _, dir := range []string{sl.workspaceSkills, sl.globalSkills, sl.builtinSkills} {
+		if dir == "" {
+			continue
+		}
+		if content, ok := sl.readSkillContent(findSkillFile(filepath.Join(dir, name))); ok {
+			return content, true
 		}
 	}
+	return "", false
+}
 
-	// 2. then load from global skills (~/.picoclaw/skills)
-	if sl.globalSkills != "" {
-		skillFile := filepath.Join(sl.globalSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+// ListSkillsFor is ListSkills limited to the named skills. An empty list
+// returns every skill.
+func (sl *SkillsLoader) ListSkillsFor(names []string) []SkillInfo {
+	allSkills := sl.ListSkills()
+	if len(names) == 0 {
+		return allSkills
+	}
+	filtered := make([]SkillInfo, 0, len(allSkills))
+	for _, s := range allSkills {
+		if slices.Contains(names, s.Name) {
+			filtered = append(filtered, s)
 		}
 	}
+	return filtered
+}
 
-	// 3. finally load from builtin skills
-	if sl.builtinSkills != "" {
-		skillFile := filepath.Join(sl.builtinSkills, name, "SKILL.md")
-		if content, err := os.ReadFile(skillFile); err == nil {
-			return sl.stripFrontmatter(string(content)), true
+// BuildAlwaysSkillsFor returns the instructions of the skills marked
+// "always", limited to the named skills (empty means all), ready to be
+// placed in the system prompt.
+func (sl *SkillsLoader) BuildAlwaysSkillsFor(names []string) string {
+	var parts []string
+	for _, s := range sl.ListSkillsFor(names) {
+		if !s.Always {
+			continue
+		}
+		if content, ok := sl.readSkillContent(s.Path); ok {
+			parts = append(parts, fmt.Sprintf("### Skill: %s\n\n%s", s.Name, content))
 		}
 	}
-
-	return "", false
+	return strings.Join(parts, "\n\n---\n\n")
 }
 
 func (sl *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
@@ -164,7 +201,13 @@ func (sl *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
 }
 
 func (sl *SkillsLoader) BuildSkillsSummary() string {
-	allSkills := sl.ListSkills()
+	return sl.BuildSkillsSummaryFor(nil)
+}
+
+// BuildSkillsSummaryFor is BuildSkillsSummary limited to the named skills.
+// An empty list includes every skill.
+func (sl *SkillsLoader) BuildSkillsSummaryFor(names []string) string {
+	allSkills := sl.ListSkillsFor(names)
 	if len(allSkills) == 0 {
 		return ""
 	}
@@ -199,6 +242,19 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 		return nil
 	}
 
+	if filepath.Base(skillPath) == SkillManifestFile {
+		var manifest skillManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			logger.WarnCF("skills", "Failed to parse skill manifest",
+				map[string]any{
+					"skill_path": skillPath,
+					"error":      err.Error(),
+				})
+			return nil
+		}
+		return &manifest.SkillMetadata
+	}
+
 	frontmatter := sl.extractFrontmatter(string(content))
 	if frontmatter == "" {
 		return &SkillMetadata{
@@ -207,15 +263,9 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 	}
 
 	// Try JSON first (for backward compatibility)
-	var jsonMeta struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-	}
+	var jsonMeta SkillMetadata
 	if err := json.Unmarshal([]byte(frontmatter), &jsonMeta); err == nil {
-		return &SkillMetadata{
-			Name:        jsonMeta.Name,
-			Description: jsonMeta.Description,
-		}
+		return &jsonMeta
 	}
 
 	// Fall back to simple YAML parsing
@@ -223,7 +273,40 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 	return &SkillMetadata{
 		Name:        yamlMeta["name"],
 		Description: yamlMeta["description"],
+		Always:      yamlMeta["always"] == "true",
+	}
+}
+
+// findSkillFile returns the definition file in a skill directory, or "" if
+// it has none.
+func findSkillFile(dir string) string {
+	for _, name := range []string{SkillFile, SkillManifestFile} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readSkillContent returns the instructions from a skill definition file:
+// the body of a SKILL.md or the "instructions" of a skill.json.
+func (sl *SkillsLoader) readSkillContent(skillPath string) (string, bool) {
+	if skillPath == "" {
+		return "", false
+	}
+	content, err := os.ReadFile(skillPath)
+	if err != nil {
+		return "", false
+	}
+	if filepath.Base(skillPath) == SkillManifestFile {
+		var manifest skillManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return "", false
+		}
+		return manifest.Instructions, true
 	}
+	return sl.stripFrontmatter(string(content)), true
 }
 
 // parseSimpleYAML parses simple key: value YAML format
@@ -326,3 +326,72 @@ func TestStripFrontmatter(t *testing.T) {
 		})
 	}
 }
+
+func TestListSkillsJSONManifest(t *testing.T) {
+	tmp := t.TempDir()
+	ws := filepath.Join(tmp, "workspace")
+	dir := filepath.Join(ws, "skills", "deploy")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	manifest := `{"name": "deploy", "description": "Deploy the site", "instructions": "Run make deploy."}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, SkillManifestFile), []byte(manifest), 0o644))
+	createSkillDir(t, filepath.Join(ws, "skills"), "review", "review", "Review code")
+
+	sl := NewSkillsLoader(ws, "", "")
+	skills := sl.ListSkills()
+
+	require.Len(t, skills, 2)
+	byName := map[string]SkillInfo{}
+	for _, s := range skills {
+		byName[s.Name] = s
+	}
+	assert.Equal(t, "Deploy the site", byName["deploy"].Description)
+	assert.Equal(t, filepath.Join(dir, SkillManifestFile), byName["deploy"].Path)
+
+	content, ok := sl.LoadSkill("deploy")
+	require.True(t, ok)
+	assert.Equal(t, "Run make deploy.", content)
+}
+
+func TestListSkillsForFilters(t *testing.T) {
+	tmp := t.TempDir()
+	ws := filepath.Join(tmp, "workspace")
+	createSkillDir(t, filepath.Join(ws, "skills"), "skill-a", "skill-a", "desc a")
+	createSkillDir(t, filepath.Join(ws, "skills"), "skill-b", "skill-b", "desc b")
+
+	sl := NewSkillsLoader(ws, "", "")
+
+	assert.Len(t, sl.ListSkillsFor(nil), 2)
+	filtered := sl.ListSkillsFor([]string{"skill-b", "missing"})
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "skill-b", filtered[0].Name)
+
+	summary := sl.BuildSkillsSummaryFor([]string{"skill-b"})
+	assert.Contains(t, summary, "<name>skill-b</name>")
+	assert.NotContains(t, summary, "skill-a")
+}
+
+func TestBuildAlwaysSkillsFor(t *testing.T) {
+	tmp := t.TempDir()
+	skillsDir := filepath.Join(tmp, "workspace", "skills")
+
+	writeSkill := func(dirName, file, content string) {
+		dir := filepath.Join(skillsDir, dirName)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644))
+	}
+	writeSkill("style", SkillFile, "---\nname: style\ndescription: House style\nalways: true\n---\nWrite short sentences.")
+	writeSkill("safety", SkillManifestFile,
+		`{"name": "safety", "description": "Safety rules", "always": true, "instructions": "Never push to main."}`)
+	createSkillDir(t, skillsDir, "optional", "optional", "Loaded on demand")
+
+	sl := NewSkillsLoader(filepath.Join(tmp, "workspace"), "", "")
+
+	all := sl.BuildAlwaysSkillsFor(nil)
+	assert.Contains(t, all, "### Skill: style\n\nWrite short sentences.")
+	assert.Contains(t, all, "### Skill: safety\n\nNever push to main.")
+	assert.NotContains(t, all, "optional")
+
+	filtered := sl.BuildAlwaysSkillsFor([]string{"safety", "optional"})
+	assert.Contains(t, filtered, "Never push to main.")
+	assert.NotContains(t, filtered, "Write short sentences.")
+}
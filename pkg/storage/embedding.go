@@ -11,8 +11,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/metrics"
 )
 
 // EmbeddingClient provides interface for generating embeddings
@@ -28,6 +31,7 @@ type MistralEmbeddingClient struct {
 	apiKey     string
 	apiBase    string
 	model      string
+	dimensions int
 	httpClient *http.Client
 }
 
@@ -36,6 +40,8 @@ type MistralEmbeddingRequest struct {
 	Model          string   `json:"model"`
 	Input          []string `json:"input"`
 	EncodingFormat string   `json:"encoding_format,omitempty"`
+	// OutputDimension requests shorter vectors from models that support it
+	OutputDimension int `json:"output_dimension,omitempty"`
 }
 
 // MistralEmbeddingResponse represents the response from Mistral embeddings API
@@ -73,16 +79,23 @@ func NewMistralEmbeddingClient(apiKey, apiBase, model string) *MistralEmbeddingC
 	}
 }
 
+// SetDimensions requests vectors of n dimensions, truncating longer ones the
+// model returns anyway. 0 keeps the model's full size.
+func (c *MistralEmbeddingClient) SetDimensions(n int) {
+	c.dimensions = n
+}
+
 // GenerateEmbedding generates embedding vector for the given text using Mistral API
-func (c *MistralEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+func (c *MistralEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) (embedding []float32, err error) {
 	if c.apiKey == "" {
 		return nil, fmt.Errorf("Mistral API key is not configured")
 	}
 
 	reqBody := MistralEmbeddingRequest{
-		Model:          c.model,
-		Input:          []string{text},
-		EncodingFormat: "float",
+		Model:           c.model,
+		Input:           []string{text},
+		EncodingFormat:  "float",
+		OutputDimension: c.dimensions,
 	}
 
 	body, err := json.Marshal(reqBody)
@@ -99,6 +112,7 @@ func (c *MistralEmbeddingClient) GenerateEmbedding(ctx context.Context, text str
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	defer func() { metrics.EmbeddingRequests.Inc(metrics.Status(err)) }()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embedding: %w", err)
@@ -107,7 +121,7 @@ func (c *MistralEmbeddingClient) GenerateEmbedding(ctx context.Context, text str
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to generate embedding: status=%d, body=%s", resp.StatusCode, string(respBody))
+		return nil, &statusError{op: "failed to generate embedding", code: resp.StatusCode, body: string(respBody)}
 	}
 
 	var respBody MistralEmbeddingResponse
@@ -119,11 +133,11 @@ func (c *MistralEmbeddingClient) GenerateEmbedding(ctx context.Context, text str
 		return nil, fmt.Errorf("no embeddings returned from Mistral API")
 	}
 
-	return respBody.Data[0].Embedding, nil
+	return truncateEmbedding(respBody.Data[0].Embedding, c.dimensions), nil
 }
 
 // GenerateEmbeddingsBatch generates embeddings for multiple texts in a single request
-func (c *MistralEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+func (c *MistralEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) (embeddings [][]float32, err error) {
 	if c.apiKey == "" {
 		return nil, fmt.Errorf("Mistral API key is not configured")
 	}
@@ -133,9 +147,10 @@ func (c *MistralEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, te
 	}
 
 	reqBody := MistralEmbeddingRequest{
-		Model:          c.model,
-		Input:          texts,
-		EncodingFormat: "float",
+		Model:           c.model,
+		Input:           texts,
+		EncodingFormat:  "float",
+		OutputDimension: c.dimensions,
 	}
 
 	body, err := json.Marshal(reqBody)
@@ -152,6 +167,7 @@ func (c *MistralEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, te
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	defer func() { metrics.EmbeddingRequests.Inc(metrics.Status(err)) }()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
@@ -168,10 +184,32 @@ func (c *MistralEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, te
 		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
 	}
 
-	embeddings := make([][]float32, len(respBody.Data))
+	embeddings = make([][]float32, len(respBody.Data))
 	for i, item := range respBody.Data {
-		embeddings[i] = item.Embedding
+		embeddings[i] = truncateEmbedding(item.Embedding, c.dimensions)
 	}
 
 	return embeddings, nil
 }
+
+// truncateEmbedding shortens vec to dims dimensions and rescales it to unit
+// length, as Matryoshka models expect. Vectors no longer than dims are
+// returned unchanged.
+func truncateEmbedding(vec []float32, dims int) []float32 {
+	if dims <= 0 || len(vec) <= dims {
+		return vec
+	}
+	vec = vec[:dims]
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vec {
+		vec[i] *= scale
+	}
+	return vec
+}
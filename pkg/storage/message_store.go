@@ -8,22 +8,36 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/moderation"
 	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
+// embeddingBatchSize is the number of texts sent per embedding request when
+// storing messages in batch.
+const embeddingBatchSize = 32
+
 // MessageStore provides persistent storage for chat messages with vector search
 type MessageStore struct {
-	qdrantClient      *QdrantClient
+	vectors           VectorStore
 	embeddingClient   EmbeddingClient
 	config            config.QdrantConfig
 	enabled           bool
 	mu                sync.RWMutex
 	pointCounter      int64
+	// embedConcurrency bounds parallel embedding requests in StoreMessages
+	embedConcurrency int
+	// searchBackoff overrides defaultSearchBackoff between search retries
+	searchBackoff time.Duration
+	// moderation keeps flagged messages out of the store; nil stores all
+	moderation *moderation.Filter
 }
 
 // StoredMessage represents a message ready for storage
@@ -37,16 +51,22 @@ type StoredMessage struct {
 // NewMessageStore creates a new message store with the given configuration
 func NewMessageStore(cfg config.StorageConfig) (*MessageStore, error) {
 	store := &MessageStore{
-		config:  cfg.Qdrant,
-		enabled: cfg.Qdrant.Enabled,
+		config:           cfg.Qdrant,
+		enabled:          cfg.Qdrant.Enabled,
+		embedConcurrency: cfg.Embedding.MaxConcurrency,
 	}
 
 	if !store.enabled {
 		return store, nil
 	}
 
+	// Truncated embeddings decide the collection's vector size
+	if cfg.Embedding.Dimensions > 0 {
+		store.config.VectorSize = cfg.Embedding.Dimensions
+	}
+
 	// Initialize Qdrant client
-	store.qdrantClient = NewQdrantClient(cfg.Qdrant)
+	store.vectors = NewQdrantClient(store.config)
 
 	// Initialize embedding client (Mistral)
 	// Use embedding config from storage.embedding
@@ -58,18 +78,16 @@ func NewMessageStore(cfg config.StorageConfig) (*MessageStore, error) {
 		embedCfg.Model = "mistral-embed"
 	}
 
-	store.embeddingClient = NewMistralEmbeddingClient(
+	embeddingClient := NewMistralEmbeddingClient(
 		embedCfg.APIKey,
 		embedCfg.APIBase,
 		embedCfg.Model,
 	)
+	embeddingClient.SetDimensions(embedCfg.Dimensions)
+	store.embeddingClient = embeddingClient
 
-	// Ensure collection exists
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := store.qdrantClient.CreateCollection(ctx); err != nil {
-		return nil, fmt.Errorf("failed to create Qdrant collection: %w", err)
+	if err := store.ensureCollection(); err != nil {
+		return nil, err
 	}
 
 	return store, nil
@@ -87,17 +105,67 @@ func NewMessageStoreWithClients(cfg config.QdrantConfig, embeddingClient Embeddi
 		return store, nil
 	}
 
-	store.qdrantClient = NewQdrantClient(cfg)
+	store.vectors = NewQdrantClient(cfg)
 
-	// Ensure collection exists
+	if err := store.ensureCollection(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// NewMessageStoreWithVectorStore creates an enabled message store backed by
+// vectors instead of Qdrant. cfg still supplies the search retry and
+// fallback settings.
+func NewMessageStoreWithVectorStore(cfg config.QdrantConfig, vectors VectorStore, embeddingClient EmbeddingClient) (*MessageStore, error) {
+	store := &MessageStore{
+		config:          cfg,
+		enabled:         true,
+		vectors:         vectors,
+		embeddingClient: embeddingClient,
+	}
+
+	if err := store.ensureCollection(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// ErrVectorSizeMismatch is returned when the embedding model produces vectors
+// of a different size than the existing collection stores.
+var ErrVectorSizeMismatch = errors.New("embedding vector size does not match the Qdrant collection")
+
+// ensureCollection creates the collection if needed and checks that the
+// embedding model's vectors fit it, so a model switch fails at startup
+// instead of on every upsert.
+func (s *MessageStore) ensureCollection() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := store.qdrantClient.CreateCollection(ctx); err != nil {
-		return nil, fmt.Errorf("failed to create Qdrant collection: %w", err)
+	if err := s.vectors.CreateCollection(ctx); err != nil {
+		return fmt.Errorf("failed to create vector collection: %w", err)
 	}
 
-	return store, nil
+	info, err := s.vectors.CollectionInfo(ctx)
+	if err != nil || info.VectorSize <= 0 {
+		// The check is best effort; an unknown size is caught on upsert
+		return nil
+	}
+	probe, err := s.embeddingClient.GenerateEmbedding(ctx, "vector size probe")
+	if err != nil {
+		logger.WarnCF("storage", "Could not check the embedding vector size", map[string]any{
+			"collection": s.config.Collection,
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	if len(probe) != info.VectorSize {
+		return fmt.Errorf("%w: collection %q stores %d-dimensional vectors, but the embedding model produces %d; "+
+			"use a new collection or an embedding model with %d dimensions",
+			ErrVectorSizeMismatch, s.config.Collection, info.VectorSize, len(probe), info.VectorSize)
+	}
+	return nil
 }
 
 // IsEnabled returns whether the message store is enabled
@@ -105,9 +173,10 @@ func (s *MessageStore) IsEnabled() bool {
 	return s.enabled
 }
 
-// StoreMessage stores a message in the vector database
-func (s *MessageStore) StoreMessage(sessionKey string, msg protocoltypes.Message, index int) error {
-	if !s.enabled {
+// StoreMessage stores a message in the vector database. Cancelling ctx
+// aborts the embedding request and the upsert.
+func (s *MessageStore) StoreMessage(ctx context.Context, sessionKey string, msg protocoltypes.Message, index int) error {
+	if !s.enabled || !s.moderationFilter().AllowStore(ctx, msg.Content) {
 		return nil
 	}
 
@@ -115,7 +184,7 @@ func (s *MessageStore) StoreMessage(sessionKey string, msg protocoltypes.Message
 	defer s.mu.Unlock()
 
 	// Generate embedding for message content
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	vector, err := s.embeddingClient.GenerateEmbedding(ctx, msg.Content)
@@ -145,35 +214,78 @@ func (s *MessageStore) StoreMessage(sessionKey string, msg protocoltypes.Message
 		Payload: payloadMap,
 	}
 
-	// Upsert to Qdrant
-	if err := s.qdrantClient.UpsertPoints(ctx, []Point{point}); err != nil {
-		return fmt.Errorf("failed to upsert point to Qdrant: %w", err)
+	// Upsert to the vector store
+	if err := s.vectors.UpsertPoints(ctx, []Point{point}); err != nil {
+		return fmt.Errorf("failed to upsert point to vector store: %w", err)
 	}
 
 	return nil
 }
 
-// StoreMessages stores multiple messages in batch
-func (s *MessageStore) StoreMessages(messages []StoredMessage) error {
+// StoreMessages stores multiple messages in batch. Embeddings are requested
+// in chunks of embeddingBatchSize, at most embeddingConcurrency at a time;
+// cancelling ctx aborts the batch between or during requests, and nothing is
+// stored unless every embedding succeeded.
+func (s *MessageStore) StoreMessages(ctx context.Context, messages []StoredMessage) error {
+	if !s.enabled {
+		return nil
+	}
+	return s.storeMessages(ctx, messages, "")
+}
+
+// ReplaceSessionMessages stores messages as the only ones of the session.
+// The old messages are deleted only after the new ones are stored, so a
+// failure leaves the session's memory as it was.
+func (s *MessageStore) ReplaceSessionMessages(ctx context.Context, sessionKey string, messages []StoredMessage) error {
 	if !s.enabled {
 		return nil
 	}
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := s.storeMessages(ctx, messages, generation); err != nil {
+		return err
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Generate embeddings for all messages
-	texts := make([]string, len(messages))
-	for i, msg := range messages {
-		texts[i] = msg.Message.Content
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if err := s.vectors.DeleteOtherGenerations(ctx, sessionKey, generation); err != nil {
+		return fmt.Errorf("failed to delete replaced session messages: %w", err)
 	}
+	return nil
+}
+
+// storeTimeout bounds a batch of n messages: one minute per embedding
+// request, as if they ran one at a time.
+func storeTimeout(n int) time.Duration {
+	return time.Duration(max(1, (n+embeddingBatchSize-1)/embeddingBatchSize)) * time.Minute
+}
+
+// storeMessages stores messages tagged with generation.
+func (s *MessageStore) storeMessages(ctx context.Context, messages []StoredMessage, generation string) error {
+	if filter := s.moderationFilter(); filter != nil {
+		allowed := make([]StoredMessage, 0, len(messages))
+		for _, msg := range messages {
+			if filter.AllowStore(ctx, msg.Message.Content) {
+				allowed = append(allowed, msg)
+			}
+		}
+		if messages = allowed; len(messages) == 0 {
+			return nil
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout(len(messages)))
 	defer cancel()
 
-	vectors, err := s.embeddingClient.GenerateEmbeddingsBatch(ctx, texts)
+	vectors, err := s.embedMessages(ctx, messages)
 	if err != nil {
-		return fmt.Errorf("failed to generate embeddings: %w", err)
+		return err
 	}
 
 	// Create points
@@ -187,6 +299,7 @@ func (s *MessageStore) StoreMessages(messages []StoredMessage) error {
 			Content:      msg.Message.Content,
 			Timestamp:    msg.Timestamp,
 			MessageIndex: msg.Index,
+			Generation:   generation,
 		}
 
 		payloadMap, err := structToMap(payload)
@@ -201,36 +314,124 @@ func (s *MessageStore) StoreMessages(messages []StoredMessage) error {
 		}
 	}
 
-	// Upsert to Qdrant
-	if err := s.qdrantClient.UpsertPoints(ctx, points); err != nil {
-		return fmt.Errorf("failed to upsert points to Qdrant: %w", err)
+	// Upsert to the vector store
+	if err := s.vectors.UpsertPoints(ctx, points); err != nil {
+		return fmt.Errorf("failed to upsert points to vector store: %w", err)
 	}
 
 	return nil
 }
 
-// SearchSimilarMessages finds messages similar to the query text
-func (s *MessageStore) SearchSimilarMessages(sessionKey, query string, limit int) ([]protocoltypes.Message, error) {
-	if !s.enabled {
-		return []protocoltypes.Message{}, nil
-	}
+// embedMessages generates embeddings for messages, running up to
+// embeddingConcurrency batch requests at once. The first failure cancels the
+// requests still running.
+//
+// Must be called with the lock held.
+func (s *MessageStore) embedMessages(ctx context.Context, messages []StoredMessage) ([][]float32, error) {
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		failErr  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			cancel()
+		})
+	}
+
+	vectors := make([][]float32, len(messages))
+	sem := make(chan struct{}, s.embeddingConcurrency())
+	for start := 0; start < len(messages); start += embeddingBatchSize {
+		select {
+		case sem <- struct{}{}:
+		case <-batchCtx.Done():
+		}
+		if batchCtx.Err() != nil {
+			break
+		}
+
+		end := min(start+embeddingBatchSize, len(messages))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			texts := make([]string, 0, end-start)
+			for _, msg := range messages[start:end] {
+				texts = append(texts, msg.Message.Content)
+			}
+
+			batch, err := s.embeddingClient.GenerateEmbeddingsBatch(batchCtx, texts)
+			if err != nil {
+				fail(fmt.Errorf("failed to generate embeddings: %w", err))
+				return
+			}
+			if len(batch) != len(texts) {
+				fail(fmt.Errorf("got %d embeddings for %d messages", len(batch), len(texts)))
+				return
+			}
+			copy(vectors[start:end], batch)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("storing messages aborted: %w", err)
+	}
+	if failErr != nil {
+		return nil, failErr
+	}
+	return vectors, nil
+}
+
+// SetEmbeddingConcurrency limits how many embedding requests StoreMessages
+// runs at once. Values below 1 mean one request at a time.
+func (s *MessageStore) SetEmbeddingConcurrency(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedConcurrency = n
+}
+
+// SetModeration makes the store skip messages flagged by filter. A nil
+// filter stores everything.
+func (s *MessageStore) SetModeration(filter *moderation.Filter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moderation = filter
+}
+
+func (s *MessageStore) moderationFilter() *moderation.Filter {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.moderation
+}
 
-	// Generate embedding for query
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// embeddingConcurrency returns the request limit. Must be called with the
+// lock held.
+func (s *MessageStore) embeddingConcurrency() int {
+	return max(s.embedConcurrency, 1)
+}
 
-	vector, err := s.embeddingClient.GenerateEmbedding(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+// SearchSimilarMessages finds messages similar to the query text
+func (s *MessageStore) SearchSimilarMessages(sessionKey, query string, limit int) ([]protocoltypes.Message, error) {
+	if !s.enabled {
+		return []protocoltypes.Message{}, nil
 	}
 
-	// Search in Qdrant
-	results, err := s.qdrantClient.Search(ctx, vector, sessionKey, limit)
+	results, err := s.search(SessionKeyFilter(sessionKey), query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search Qdrant: %w", err)
+		if s.config.MemorySearchOptional {
+			logger.WarnCF("storage", "Memory search failed, continuing without results", map[string]any{
+				"session_key": sessionKey,
+				"error":       err.Error(),
+			})
+			return []protocoltypes.Message{}, nil
+		}
+		return nil, err
 	}
 
 	// Convert results to messages
@@ -250,26 +451,21 @@ func (s *MessageStore) SearchSimilarMessages(sessionKey, query string, limit int
 // SearchSimilarMessagesWithPayload finds messages similar to the query text and returns full payload
 // This is used by tools that need access to all message metadata
 func (s *MessageStore) SearchSimilarMessagesWithPayload(sessionKey, query string, limit int) ([]MessagePayload, error) {
+	return s.SearchMessagesWithPayload(SessionKeyFilter(sessionKey), query, limit)
+}
+
+// SearchMessagesWithPayload is SearchSimilarMessagesWithPayload over the
+// sessions selected by filter, such as all sessions of one channel
+func (s *MessageStore) SearchMessagesWithPayload(filter SessionFilter, query string, limit int) ([]MessagePayload, error) {
 	if !s.enabled {
 		return []MessagePayload{}, nil
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Generate embedding for query
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	vector, err := s.embeddingClient.GenerateEmbedding(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
-	}
-
-	// Search in Qdrant
-	results, err := s.qdrantClient.Search(ctx, vector, sessionKey, limit)
+	// Failures are returned even when memory search is optional, so the
+	// search tool can tell the model that memory is unavailable
+	results, err := s.search(filter, query, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search Qdrant: %w", err)
+		return nil, err
 	}
 
 	// Convert results to payloads
@@ -286,6 +482,18 @@ func (s *MessageStore) SearchSimilarMessagesWithPayload(sessionKey, query string
 	return messages, nil
 }
 
+// Stats returns the point count and configuration of the message collection
+func (s *MessageStore) Stats(ctx context.Context) (*CollectionInfo, error) {
+	if !s.enabled {
+		return nil, fmt.Errorf("message store is not enabled")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return s.vectors.CollectionInfo(ctx)
+}
+
 // DeleteSessionMessages deletes all messages for a session
 func (s *MessageStore) DeleteSessionMessages(sessionKey string) error {
 	if !s.enabled {
@@ -298,7 +506,7 @@ func (s *MessageStore) DeleteSessionMessages(sessionKey string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := s.qdrantClient.DeleteBySessionKey(ctx, sessionKey); err != nil {
+	if err := s.vectors.DeleteBySessionKey(ctx, sessionKey); err != nil {
 		return fmt.Errorf("failed to delete session messages: %w", err)
 	}
 
@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -22,6 +24,7 @@ type QdrantClient struct {
 	config     config.QdrantConfig
 	httpClient *http.Client
 	baseURL    string
+	createMu   sync.Mutex // serializes CreateCollection calls
 }
 
 // Point represents a Qdrant point with vector and payload
@@ -38,6 +41,8 @@ type MessagePayload struct {
 	Content      string    `json:"content"`
 	Timestamp    time.Time `json:"timestamp"`
 	MessageIndex int       `json:"message_index"`
+	// Generation tags the messages stored by one ReplaceSessionMessages call
+	Generation string `json:"generation,omitempty"`
 }
 
 // SearchRequest represents a Qdrant search request
@@ -59,9 +64,11 @@ type FilterClause struct {
 	Match MatchCondition `json:"match"`
 }
 
-// MatchCondition represents a match condition
+// MatchCondition represents a match condition. Value matches the whole
+// field; Text matches a substring when the field has no full-text index.
 type MatchCondition struct {
-	Value string `json:"value"`
+	Value string `json:"value,omitempty"`
+	Text  string `json:"text,omitempty"`
 }
 
 // SearchResponse represents a Qdrant search response
@@ -95,8 +102,13 @@ func NewQdrantClient(cfg config.QdrantConfig) *QdrantClient {
 	}
 }
 
-// CreateCollection creates the collection if it doesn't exist
+// CreateCollection creates the collection if it doesn't exist. Another
+// agent or process may create it between the existence check and the
+// create request, so an "already exists" response counts as success.
 func (c *QdrantClient) CreateCollection(ctx context.Context) error {
+	c.createMu.Lock()
+	defer c.createMu.Unlock()
+
 	collectionName := c.config.Collection
 	vectorSize := c.config.VectorSize
 	if vectorSize <= 0 {
@@ -112,15 +124,7 @@ func (c *QdrantClient) CreateCollection(ctx context.Context) error {
 		return nil
 	}
 
-	// Create collection
-	createReq := map[string]any{
-		"vectors": map[string]any{
-			"size":     vectorSize,
-			"distance": "Cosine",
-		},
-	}
-
-	body, err := json.Marshal(createReq)
+	body, err := json.Marshal(c.createCollectionRequest(vectorSize))
 	if err != nil {
 		return fmt.Errorf("failed to marshal create collection request: %w", err)
 	}
@@ -144,12 +148,61 @@ func (c *QdrantClient) CreateCollection(ctx context.Context) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		if collectionAlreadyExists(resp.StatusCode, body) {
+			return nil
+		}
 		return fmt.Errorf("failed to create collection: status=%d, body=%s", resp.StatusCode, string(body))
 	}
 
 	return nil
 }
 
+// createCollectionRequest builds the body of a create collection request.
+// Index and quantization settings are only sent when configured, so Qdrant
+// applies its own defaults otherwise.
+func (c *QdrantClient) createCollectionRequest(vectorSize int) map[string]any {
+	createReq := map[string]any{
+		"vectors": map[string]any{
+			"size":     vectorSize,
+			"distance": "Cosine",
+		},
+	}
+
+	hnsw := map[string]any{}
+	if c.config.HNSW.M > 0 {
+		hnsw["m"] = c.config.HNSW.M
+	}
+	if c.config.HNSW.EfConstruct > 0 {
+		hnsw["ef_construct"] = c.config.HNSW.EfConstruct
+	}
+	if len(hnsw) > 0 {
+		createReq["hnsw_config"] = hnsw
+	}
+
+	if q := c.config.Quantization; q.Enabled {
+		scalar := map[string]any{"type": "int8"}
+		if q.Quantile > 0 {
+			scalar["quantile"] = q.Quantile
+		}
+		if q.AlwaysRAM {
+			scalar["always_ram"] = true
+		}
+		createReq["quantization_config"] = map[string]any{"scalar": scalar}
+	}
+
+	return createReq
+}
+
+// collectionAlreadyExists reports whether a failed create request failed only
+// because the collection exists. Qdrant answers 409 Conflict, or 400 with
+// "already exists" in the error on older versions.
+func collectionAlreadyExists(status int, body []byte) bool {
+	if status == http.StatusConflict {
+		return true
+	}
+	return status == http.StatusBadRequest && strings.Contains(strings.ToLower(string(body)), "already exists")
+}
+
 // CollectionExists checks if the collection exists
 func (c *QdrantClient) CollectionExists(ctx context.Context) (bool, error) {
 	url := fmt.Sprintf("%s/collections/%s", c.baseURL, c.config.Collection)
@@ -179,6 +232,90 @@ func (c *QdrantClient) CollectionExists(ctx context.Context) (bool, error) {
 	return false, fmt.Errorf("unexpected status checking collection: status=%d, body=%s", resp.StatusCode, string(body))
 }
 
+// CollectionInfo describes the size and configuration of a collection
+type CollectionInfo struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"` // "green", "yellow", "grey" or "red"
+	PointsCount int64  `json:"points_count"`
+	VectorSize  int    `json:"vector_size"`
+	Distance    string `json:"distance"`
+}
+
+// collectionInfoResponse is the body of GET /collections/{name}
+type collectionInfoResponse struct {
+	Result struct {
+		Status      string `json:"status"`
+		PointsCount *int64 `json:"points_count"`
+		Config      struct {
+			Params struct {
+				Vectors json.RawMessage `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	} `json:"result"`
+}
+
+// vectorParams is the configuration of a single vector
+type vectorParams struct {
+	Size     int    `json:"size"`
+	Distance string `json:"distance"`
+}
+
+// CollectionInfo returns the point count, vector configuration and status
+// of the collection
+func (c *QdrantClient) CollectionInfo(ctx context.Context) (*CollectionInfo, error) {
+	url := fmt.Sprintf("%s/collections/%s", c.baseURL, c.config.Collection)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.config.APIKey != "" {
+		req.Header.Set("api-key", c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get collection info: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+
+	var infoResp collectionInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&infoResp); err != nil {
+		return nil, fmt.Errorf("failed to decode collection info: %w", err)
+	}
+
+	info := &CollectionInfo{
+		Name:   c.config.Collection,
+		Status: infoResp.Result.Status,
+	}
+	if infoResp.Result.PointsCount != nil {
+		info.PointsCount = *infoResp.Result.PointsCount
+	}
+
+	// Vectors are either a single unnamed config or a map of named ones
+	vectors := infoResp.Result.Config.Params.Vectors
+	var single vectorParams
+	if err := json.Unmarshal(vectors, &single); err == nil && single.Size > 0 {
+		info.VectorSize = single.Size
+		info.Distance = single.Distance
+	} else {
+		var named map[string]vectorParams
+		if err := json.Unmarshal(vectors, &named); err == nil && len(named) == 1 {
+			for _, params := range named {
+				info.VectorSize = params.Size
+				info.Distance = params.Distance
+			}
+		}
+	}
+
+	return info, nil
+}
+
 // UpsertPoints inserts or updates points in the collection
 func (c *QdrantClient) UpsertPoints(ctx context.Context, points []Point) error {
 	if len(points) == 0 {
@@ -220,25 +357,12 @@ func (c *QdrantClient) UpsertPoints(ctx context.Context, points []Point) error {
 }
 
 // Search performs a vector search in the collection
-func (c *QdrantClient) Search(ctx context.Context, vector []float32, sessionKey string, limit int) ([]ScoredPoint, error) {
+func (c *QdrantClient) Search(ctx context.Context, vector []float32, filter SessionFilter, limit int) ([]ScoredPoint, error) {
 	searchReq := SearchRequest{
 		Vector:      vector,
 		Limit:       limit,
 		WithPayload: true,
-	}
-
-	// Filter by session key if provided
-	if sessionKey != "" {
-		searchReq.Filter = &FilterCondition{
-			Must: []FilterClause{
-				{
-					Key: "session_key",
-					Match: MatchCondition{
-						Value: sessionKey,
-					},
-				},
-			},
-		}
+		Filter:      sessionFilterCondition(filter),
 	}
 
 	body, err := json.Marshal(searchReq)
@@ -265,7 +389,7 @@ func (c *QdrantClient) Search(ctx context.Context, vector []float32, sessionKey
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to search: status=%d, body=%s", resp.StatusCode, string(body))
+		return nil, &statusError{op: "failed to search", code: resp.StatusCode, body: string(body)}
 	}
 
 	var searchResp SearchResponse
@@ -273,25 +397,76 @@ func (c *QdrantClient) Search(ctx context.Context, vector []float32, sessionKey
 		return nil, fmt.Errorf("failed to decode search response: %w", err)
 	}
 
-	return searchResp.Result, nil
+	if !filter.Prefix {
+		return searchResp.Result, nil
+	}
+	// The substring match may hit the prefix elsewhere in a key
+	results := searchResp.Result[:0]
+	for _, point := range searchResp.Result {
+		if key, _ := point.Payload["session_key"].(string); filter.Matches(key) {
+			results = append(results, point)
+		}
+	}
+	return results, nil
+}
+
+// sessionFilterCondition converts filter into a Qdrant filter, or nil if it
+// matches every session. Qdrant has no prefix match for keywords, so a
+// prefix is sent as a text match, which works as a substring match on the
+// unindexed session_key field.
+func sessionFilterCondition(filter SessionFilter) *FilterCondition {
+	if filter.Key == "" {
+		return nil
+	}
+	match := MatchCondition{Value: filter.Key}
+	if filter.Prefix {
+		match = MatchCondition{Text: filter.Key}
+	}
+	return &FilterCondition{
+		Must: []FilterClause{{Key: "session_key", Match: match}},
+	}
 }
 
 // DeleteBySessionKey deletes all points for a given session key
 func (c *QdrantClient) DeleteBySessionKey(ctx context.Context, sessionKey string) error {
-	deleteReq := map[string]any{
-		"filter": map[string]any{
-			"must": []map[string]any{
-				{
-					"key": "session_key",
-					"match": map[string]any{
-						"value": sessionKey,
-					},
+	return c.deletePoints(ctx, map[string]any{
+		"must": []map[string]any{
+			{
+				"key": "session_key",
+				"match": map[string]any{
+					"value": sessionKey,
 				},
 			},
 		},
-	}
+	})
+}
+
+// DeleteOtherGenerations deletes the points of a session not stored with
+// generation, including those stored without one
+func (c *QdrantClient) DeleteOtherGenerations(ctx context.Context, sessionKey, generation string) error {
+	return c.deletePoints(ctx, map[string]any{
+		"must": []map[string]any{
+			{
+				"key": "session_key",
+				"match": map[string]any{
+					"value": sessionKey,
+				},
+			},
+		},
+		"must_not": []map[string]any{
+			{
+				"key": "generation",
+				"match": map[string]any{
+					"value": generation,
+				},
+			},
+		},
+	})
+}
 
-	body, err := json.Marshal(deleteReq)
+// deletePoints deletes the points matched by a Qdrant filter
+func (c *QdrantClient) deletePoints(ctx context.Context, filter map[string]any) error {
+	body, err := json.Marshal(map[string]any{"filter": filter})
 	if err != nil {
 		return fmt.Errorf("failed to marshal delete request: %w", err)
 	}
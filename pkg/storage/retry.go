@@ -0,0 +1,90 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultSearchBackoff is the wait before the first search retry; later
+// retries wait proportionally longer.
+const defaultSearchBackoff = 500 * time.Millisecond
+
+// statusError is an unexpected HTTP status from Qdrant or the embedding API.
+type statusError struct {
+	op   string
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: status=%d, body=%s", e.op, e.code, e.body)
+}
+
+// isTransientError reports whether a failed request may succeed when retried:
+// network errors, timeouts, rate limits and server errors.
+func isTransientError(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// search embeds query and searches the vector store, retrying transient
+// failures up to the configured number of times.
+func (s *MessageStore) search(filter SessionFilter, query string, limit int) ([]ScoredPoint, error) {
+	backoff := s.searchBackoff
+	if backoff == 0 {
+		backoff = defaultSearchBackoff
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var results []ScoredPoint
+		if results, err = s.searchOnce(filter, query, limit); err == nil {
+			return results, nil
+		}
+		if attempt >= s.config.SearchRetries || !isTransientError(err) {
+			return nil, err
+		}
+		logger.WarnCF("storage", "Memory search failed, retrying", map[string]any{
+			"attempt": attempt + 1,
+			"error":   err.Error(),
+		})
+		time.Sleep(backoff * time.Duration(attempt+1))
+	}
+}
+
+func (s *MessageStore) searchOnce(filter SessionFilter, query string, limit int) ([]ScoredPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	vector, err := s.embeddingClient.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	results, err := s.vectors.Search(ctx, vector, filter, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vector store: %w", err)
+	}
+	return results, nil
+}
@@ -7,10 +7,21 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/moderation"
 	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
@@ -36,8 +47,8 @@ func TestMessageStore_NotEnabled(t *testing.T) {
 		Role:    "user",
 		Content: "test message",
 	}
-	
-	err = store.StoreMessage("test-session", msg, 0)
+
+	err = store.StoreMessage(context.Background(), "test-session", msg, 0)
 	if err != nil {
 		t.Errorf("StoreMessage should not return error when disabled: %v", err)
 	}
@@ -199,3 +210,838 @@ func (m *mockEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts
 	}
 	return result, nil
 }
+
+// blockingEmbeddingClient returns embeddings for the first batch, then blocks
+// until the request context is cancelled.
+type blockingEmbeddingClient struct {
+	calls        atomic.Int32
+	firstBatched chan struct{}
+}
+
+func (m *blockingEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+func (m *blockingEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if m.calls.Add(1) == 1 {
+		close(m.firstBatched)
+		result := make([][]float32, len(texts))
+		for i := range result {
+			result[i] = []float32{0.1, 0.2, 0.3}
+		}
+		return result, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMessageStore_StoreMessagesCancelled(t *testing.T) {
+	var upserts atomic.Int32
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			upserts.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"result":{}}`))
+	}))
+	defer qdrant.Close()
+
+	host, portStr, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	embeddings := &blockingEmbeddingClient{firstBatched: make(chan struct{})}
+	store, err := NewMessageStoreWithClients(config.QdrantConfig{
+		Enabled:    true,
+		Host:       host,
+		Port:       port,
+		Collection: "test-collection",
+		VectorSize: 3,
+	}, embeddings)
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithClients failed: %v", err)
+	}
+
+	messages := make([]StoredMessage, 3*embeddingBatchSize)
+	for i := range messages {
+		messages[i] = StoredMessage{
+			SessionKey: "test-session",
+			Message:    protocoltypes.Message{Role: "user", Content: "message " + strconv.Itoa(i)},
+			Index:      i,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-embeddings.firstBatched
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- store.StoreMessages(ctx, messages) }()
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StoreMessages did not return after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("StoreMessages error = %v, want context.Canceled", err)
+	}
+	if calls := embeddings.calls.Load(); calls > 2 {
+		t.Errorf("%d embedding batches requested after cancellation, want at most 2", calls)
+	}
+	if n := upserts.Load(); n != 0 {
+		t.Errorf("%d upserts after cancellation, want 0", n)
+	}
+}
+
+// countingEmbeddingClient tracks how many batch requests run at once. Each
+// message's vector holds its number parsed from "message N".
+type countingEmbeddingClient struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	calls       atomic.Int32
+}
+
+func (m *countingEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{0}, nil
+}
+
+func (m *countingEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	m.calls.Add(1)
+	n := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for {
+		peak := m.maxInFlight.Load()
+		if n <= peak || m.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	// Hold the request long enough for the others to overlap it
+	time.Sleep(20 * time.Millisecond)
+
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		index, _ := strconv.Atoi(strings.TrimPrefix(text, "message "))
+		result[i] = []float32{float32(index)}
+	}
+	return result, nil
+}
+
+func TestMessageStore_StoreMessagesConcurrencyLimit(t *testing.T) {
+	var upserted []Point
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/points") {
+			var req struct {
+				Points []Point `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			upserted = append(upserted, req.Points...)
+		}
+		w.Write([]byte(`{"result":{}}`))
+	}))
+	defer qdrant.Close()
+
+	host, portStr, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	embeddings := &countingEmbeddingClient{}
+	store, err := NewMessageStoreWithClients(config.QdrantConfig{
+		Enabled:    true,
+		Host:       host,
+		Port:       port,
+		Collection: "test-collection",
+		VectorSize: 1,
+	}, embeddings)
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithClients failed: %v", err)
+	}
+	store.SetEmbeddingConcurrency(3)
+
+	messages := make([]StoredMessage, 10*embeddingBatchSize)
+	for i := range messages {
+		messages[i] = StoredMessage{
+			SessionKey: "test-session",
+			Message:    protocoltypes.Message{Role: "user", Content: "message " + strconv.Itoa(i)},
+			Index:      i,
+		}
+	}
+	if err := store.StoreMessages(context.Background(), messages); err != nil {
+		t.Fatalf("StoreMessages failed: %v", err)
+	}
+
+	if calls := embeddings.calls.Load(); calls != 10 {
+		t.Errorf("%d embedding batches requested, want 10", calls)
+	}
+	if peak := embeddings.maxInFlight.Load(); peak > 3 || peak < 2 {
+		t.Errorf("peak concurrent embedding requests = %d, want 2-3", peak)
+	}
+
+	// Vectors must line up with their messages regardless of completion order
+	if len(upserted) != len(messages) {
+		t.Fatalf("%d points upserted, want %d", len(upserted), len(messages))
+	}
+	for _, p := range upserted {
+		if index := p.Payload["message_index"].(float64); p.Vector[0] != float32(index) {
+			t.Fatalf("message %v got vector %v", index, p.Vector)
+		}
+	}
+}
+
+// newCollectionInfoServer stubs GET /collections/{name} with body.
+func newCollectionInfoServer(t *testing.T, body string) config.QdrantConfig {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/collections/test-collection" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return config.QdrantConfig{
+		Enabled:    true,
+		Host:       host,
+		Port:       port,
+		Collection: "test-collection",
+		VectorSize: 1024,
+	}
+}
+
+func TestQdrantClient_CollectionInfo(t *testing.T) {
+	cfg := newCollectionInfoServer(t, `{
+		"result": {
+			"status": "green",
+			"optimizer_status": "ok",
+			"indexed_vectors_count": 0,
+			"points_count": 1234,
+			"segments_count": 2,
+			"config": {
+				"params": {
+					"vectors": {"size": 1024, "distance": "Cosine"},
+					"shard_number": 1
+				}
+			}
+		},
+		"status": "ok",
+		"time": 0.0001
+	}`)
+
+	store, err := NewMessageStoreWithClients(cfg, &fixedSizeEmbeddingClient{size: 1024})
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithClients failed: %v", err)
+	}
+	info, err := store.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	want := CollectionInfo{
+		Name:        "test-collection",
+		Status:      "green",
+		PointsCount: 1234,
+		VectorSize:  1024,
+		Distance:    "Cosine",
+	}
+	if *info != want {
+		t.Errorf("Stats() = %+v, want %+v", *info, want)
+	}
+}
+
+func TestQdrantClient_CollectionInfo_NamedVectors(t *testing.T) {
+	cfg := newCollectionInfoServer(t, `{"result": {"status": "yellow", "points_count": 7,
+		"config": {"params": {"vectors": {"text": {"size": 768, "distance": "Dot"}}}}}}`)
+
+	info, err := NewQdrantClient(cfg).CollectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("CollectionInfo failed: %v", err)
+	}
+	if info.Status != "yellow" || info.PointsCount != 7 || info.VectorSize != 768 || info.Distance != "Dot" {
+		t.Errorf("CollectionInfo() = %+v", *info)
+	}
+}
+
+// fixedSizeEmbeddingClient returns zero vectors of the given size.
+type fixedSizeEmbeddingClient struct {
+	size int
+}
+
+func (m *fixedSizeEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return make([]float32, m.size), nil
+}
+
+func (m *fixedSizeEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i := range result {
+		result[i] = make([]float32, m.size)
+	}
+	return result, nil
+}
+
+func TestMessageStore_VectorSizeMismatch(t *testing.T) {
+	cfg := newCollectionInfoServer(t, `{"result": {"status": "green", "points_count": 10,
+		"config": {"params": {"vectors": {"size": 768, "distance": "Cosine"}}}}}`)
+
+	_, err := NewMessageStoreWithClients(cfg, &fixedSizeEmbeddingClient{size: 1024})
+	if !errors.Is(err, ErrVectorSizeMismatch) {
+		t.Fatalf("NewMessageStoreWithClients error = %v, want ErrVectorSizeMismatch", err)
+	}
+	for _, want := range []string{`"test-collection"`, "768-dimensional", "produces 1024"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err.Error(), want)
+		}
+	}
+
+	// A matching model is accepted
+	if _, err := NewMessageStoreWithClients(cfg, &fixedSizeEmbeddingClient{size: 768}); err != nil {
+		t.Errorf("NewMessageStoreWithClients with matching size failed: %v", err)
+	}
+}
+
+func TestQdrantClient_CreateCollectionConcurrent(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int // response to every create after the first
+		body      string
+		wantError bool
+	}{
+		{name: "conflict", status: http.StatusConflict, body: `{"status":{"error":"Collection exists"}}`},
+		{
+			name:   "already exists",
+			status: http.StatusBadRequest,
+			body:   `{"status":{"error":"Wrong input: Collection ` + "`test-collection`" + ` already exists!"}}`,
+		},
+		{name: "server error", status: http.StatusInternalServerError, body: "boom", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var creates atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					// Every caller sees the collection as missing
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if creates.Add(1) > 1 {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+					return
+				}
+				w.Write([]byte(`{"result":true,"status":"ok"}`))
+			}))
+			defer server.Close()
+
+			host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+			port, _ := strconv.Atoi(portStr)
+			cfg := config.QdrantConfig{Enabled: true, Host: host, Port: port, Collection: "test-collection"}
+
+			// Several agents with their own clients, plus calls sharing one
+			shared := NewQdrantClient(cfg)
+			clients := []*QdrantClient{shared, shared, shared}
+			for range 5 {
+				clients = append(clients, NewQdrantClient(cfg))
+			}
+
+			errs := make([]error, len(clients))
+			var wg sync.WaitGroup
+			for i, client := range clients {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = client.CreateCollection(context.Background())
+				}()
+			}
+			wg.Wait()
+
+			failed := 0
+			for _, err := range errs {
+				if err != nil {
+					failed++
+				}
+			}
+			if tt.wantError {
+				if failed == 0 {
+					t.Error("expected server errors to surface")
+				}
+				return
+			}
+			if failed > 0 {
+				t.Errorf("%d of %d CreateCollection calls failed: %v", failed, len(clients), errs)
+			}
+			if creates.Load() < 2 {
+				t.Errorf("stub saw %d create requests, want the race to be exercised", creates.Load())
+			}
+		})
+	}
+}
+
+func TestQdrantClient_CreateCollectionIndexConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cfg *config.QdrantConfig)
+		want  string // expected create body, as JSON
+	}{
+		{
+			name: "defaults",
+			want: `{"vectors":{"distance":"Cosine","size":1024}}`,
+		},
+		{
+			name: "hnsw and quantization",
+			setup: func(cfg *config.QdrantConfig) {
+				cfg.HNSW = config.QdrantHNSWConfig{M: 8, EfConstruct: 64}
+				cfg.Quantization = config.QdrantQuantizationConfig{Enabled: true, Quantile: 0.95, AlwaysRAM: true}
+			},
+			want: `{"hnsw_config":{"ef_construct":64,"m":8},` +
+				`"quantization_config":{"scalar":{"always_ram":true,"quantile":0.95,"type":"int8"}},` +
+				`"vectors":{"distance":"Cosine","size":1024}}`,
+		},
+		{
+			name: "quantization with qdrant defaults",
+			setup: func(cfg *config.QdrantConfig) {
+				cfg.Quantization.Enabled = true
+			},
+			want: `{"quantization_config":{"scalar":{"type":"int8"}},"vectors":{"distance":"Cosine","size":1024}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decode create body: %v", err)
+				}
+				// Re-encode so map keys come out sorted
+				data, _ := json.Marshal(body)
+				got = string(data)
+				w.Write([]byte(`{"result":true,"status":"ok"}`))
+			}))
+			defer server.Close()
+
+			host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+			port, _ := strconv.Atoi(portStr)
+			cfg := config.QdrantConfig{Enabled: true, Host: host, Port: port, Collection: "test-collection"}
+			if tt.setup != nil {
+				tt.setup(&cfg)
+			}
+
+			if err := NewQdrantClient(cfg).CreateCollection(context.Background()); err != nil {
+				t.Fatalf("CreateCollection: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("create body = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageStore_EmbeddingDimensions(t *testing.T) {
+	var created struct {
+		Vectors struct {
+			Size int `json:"size"`
+		} `json:"vectors"`
+	}
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Errorf("decode create body: %v", err)
+		}
+		w.Write([]byte(`{"result":true,"status":"ok"}`))
+	}))
+	defer qdrant.Close()
+
+	var requested MistralEmbeddingRequest
+	embeddings := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requested); err != nil {
+			t.Errorf("decode embedding request: %v", err)
+		}
+		// A model ignoring the requested size returns its full vector
+		w.Write([]byte(`{"data":[{"embedding":[3,4,0,5],"index":0}]}`))
+	}))
+	defer embeddings.Close()
+
+	host, portStr, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	store, err := NewMessageStore(config.StorageConfig{
+		Qdrant: config.QdrantConfig{Enabled: true, Host: host, Port: port, Collection: "test-collection"},
+		Embedding: config.EmbeddingConfig{
+			Enabled:    true,
+			APIKey:     "key",
+			APIBase:    embeddings.URL,
+			Model:      "codestral-embed",
+			Dimensions: 2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMessageStore failed: %v", err)
+	}
+	if created.Vectors.Size != 2 {
+		t.Errorf("collection vector size = %d, want 2", created.Vectors.Size)
+	}
+
+	vec, err := store.embeddingClient.GenerateEmbedding(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	if requested.OutputDimension != 2 {
+		t.Errorf("requested output_dimension = %d, want 2", requested.OutputDimension)
+	}
+	if len(vec) != 2 || math.Abs(float64(vec[0])-0.6) > 1e-6 || math.Abs(float64(vec[1])-0.8) > 1e-6 {
+		t.Errorf("embedding = %v, want the first 2 dimensions normalized to [0.6 0.8]", vec)
+	}
+}
+
+func TestMessageStore_StatsNotEnabled(t *testing.T) {
+	store, err := NewMessageStore(config.StorageConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create message store: %v", err)
+	}
+	if _, err := store.Stats(context.Background()); err == nil {
+		t.Error("Stats should fail when the store is disabled")
+	}
+}
+
+// newFlakySearchStore returns a store whose Qdrant search fails with status
+// for the first failures requests and then finds one message.
+func newFlakySearchStore(t *testing.T, cfg config.QdrantConfig, status, failures int) (*MessageStore, *atomic.Int32) {
+	t.Helper()
+	var searches atomic.Int32
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/points/search") {
+			w.Write([]byte(`{"result":{}}`))
+			return
+		}
+		if int(searches.Add(1)) <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"status":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"result":[{"id":1,"score":0.9,"payload":{"role":"user","content":"my cat is Tom"}}]}`))
+	}))
+	t.Cleanup(qdrant.Close)
+
+	host, portStr, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	cfg.Enabled = true
+	cfg.Host = host
+	cfg.Port, _ = strconv.Atoi(portStr)
+	cfg.Collection = "test-collection"
+	cfg.VectorSize = 3
+	store, err := NewMessageStoreWithClients(cfg, &mockEmbeddingClient{})
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithClients failed: %v", err)
+	}
+	store.searchBackoff = time.Millisecond
+	return store, &searches
+}
+
+func TestMessageStore_SearchRetriesTransientErrors(t *testing.T) {
+	store, searches := newFlakySearchStore(t, config.QdrantConfig{SearchRetries: 2}, http.StatusServiceUnavailable, 2)
+
+	messages, err := store.SearchSimilarMessages("test-session", "cat", 5)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessages failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != "my cat is Tom" {
+		t.Errorf("messages = %+v, want the stored message", messages)
+	}
+	if n := searches.Load(); n != 3 {
+		t.Errorf("%d searches, want 2 retries", n)
+	}
+}
+
+func TestMessageStore_SearchDoesNotRetryClientErrors(t *testing.T) {
+	store, searches := newFlakySearchStore(t, config.QdrantConfig{SearchRetries: 2}, http.StatusBadRequest, 1)
+
+	if _, err := store.SearchSimilarMessagesWithPayload("test-session", "cat", 5); err == nil {
+		t.Error("SearchSimilarMessagesWithPayload succeeded after a bad request")
+	}
+	if n := searches.Load(); n != 1 {
+		t.Errorf("%d searches, want no retry of a bad request", n)
+	}
+}
+
+func TestMessageStore_SearchFailure(t *testing.T) {
+	t.Run("optional", func(t *testing.T) {
+		cfg := config.QdrantConfig{SearchRetries: 1, MemorySearchOptional: true}
+		store, searches := newFlakySearchStore(t, cfg, http.StatusBadGateway, 10)
+
+		messages, err := store.SearchSimilarMessages("test-session", "cat", 5)
+		if err != nil || messages == nil || len(messages) != 0 {
+			t.Errorf("SearchSimilarMessages() = %v, %v, want an empty result", messages, err)
+		}
+		if n := searches.Load(); n != 2 {
+			t.Errorf("%d searches, want 1 retry", n)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		cfg := config.QdrantConfig{SearchRetries: 1}
+		store, _ := newFlakySearchStore(t, cfg, http.StatusBadGateway, 10)
+
+		if _, err := store.SearchSimilarMessages("test-session", "cat", 5); err == nil || !strings.Contains(err.Error(), "status=502") {
+			t.Errorf("SearchSimilarMessages error = %v, want the search failure", err)
+		}
+	})
+}
+
+func TestMessageStore_MemoryVectorStore(t *testing.T) {
+	embedder := &mockEmbeddingClient{embeddings: map[string][]float32{
+		"It will rain tomorrow":     {1, 0.1, 0},
+		"My cat is called Tom":      {0, 1, 0.1},
+		"Buy milk on the way home":  {0.1, 0, 1},
+		"Sunny all week in Lisbon":  {0.9, 0, 0.2},
+		"what is the weather like?": {1, 0, 0},
+		"what was my pet's name?":   {0, 1, 0},
+	}}
+	vectors := NewMemoryVectorStore("memory")
+	store, err := NewMessageStoreWithVectorStore(config.QdrantConfig{}, vectors, embedder)
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithVectorStore failed: %v", err)
+	}
+	if !store.IsEnabled() {
+		t.Fatal("store backed by a vector store should be enabled")
+	}
+
+	ctx := context.Background()
+	msg := func(content string) protocoltypes.Message {
+		return protocoltypes.Message{Role: "user", Content: content}
+	}
+	if err := store.StoreMessage(ctx, "agent:a", msg("It will rain tomorrow"), 0); err != nil {
+		t.Fatalf("StoreMessage failed: %v", err)
+	}
+	err = store.StoreMessages(ctx, []StoredMessage{
+		{SessionKey: "agent:a", Message: msg("My cat is called Tom"), Index: 1},
+		{SessionKey: "agent:a", Message: msg("Buy milk on the way home"), Index: 2},
+		{SessionKey: "agent:b", Message: msg("Sunny all week in Lisbon"), Index: 0},
+	})
+	if err != nil {
+		t.Fatalf("StoreMessages failed: %v", err)
+	}
+
+	info, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if info.PointsCount != 4 || info.VectorSize != 3 {
+		t.Errorf("Stats() = %+v, want 4 points of size 3", *info)
+	}
+
+	// Search is ranked by similarity and restricted to the session
+	got, err := store.SearchSimilarMessages("agent:a", "what is the weather like?", 2)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessages failed: %v", err)
+	}
+	if len(got) != 2 || got[0].Content != "It will rain tomorrow" {
+		t.Errorf("weather search = %+v, want the rain message first", got)
+	}
+	for _, m := range got {
+		if m.Content == "Sunny all week in Lisbon" {
+			t.Error("search returned a message from another session")
+		}
+	}
+
+	payloads, err := store.SearchSimilarMessagesWithPayload("agent:a", "what was my pet's name?", 1)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessagesWithPayload failed: %v", err)
+	}
+	if len(payloads) != 1 || payloads[0].Content != "My cat is called Tom" ||
+		payloads[0].SessionKey != "agent:a" || payloads[0].MessageIndex != 1 {
+		t.Errorf("pet search = %+v, want the cat message with its metadata", payloads)
+	}
+
+	// Searching without a session key covers all sessions
+	all, err := store.SearchSimilarMessages("", "what is the weather like?", 10)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessages failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("unfiltered search returned %d messages, want 4", len(all))
+	}
+
+	if err := store.DeleteSessionMessages("agent:a"); err != nil {
+		t.Fatalf("DeleteSessionMessages failed: %v", err)
+	}
+	got, err = store.SearchSimilarMessages("agent:a", "what is the weather like?", 10)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessages failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("deleted session still returned %+v", got)
+	}
+	if info, _ := store.Stats(ctx); info.PointsCount != 1 {
+		t.Errorf("after delete PointsCount = %d, want 1", info.PointsCount)
+	}
+}
+
+// failingEmbeddingClient fails every request while fail is set
+type failingEmbeddingClient struct {
+	mockEmbeddingClient
+	fail bool
+}
+
+func (m *failingEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if m.fail {
+		return nil, errors.New("embedding service down")
+	}
+	return m.mockEmbeddingClient.GenerateEmbeddingsBatch(ctx, texts)
+}
+
+func TestMessageStore_ReplaceSessionMessages(t *testing.T) {
+	embedder := &failingEmbeddingClient{}
+	vectors := NewMemoryVectorStore("memory")
+	store, err := NewMessageStoreWithVectorStore(config.QdrantConfig{}, vectors, embedder)
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithVectorStore failed: %v", err)
+	}
+
+	ctx := context.Background()
+	stored := func(contents ...string) []StoredMessage {
+		var messages []StoredMessage
+		for i, content := range contents {
+			messages = append(messages, StoredMessage{
+				SessionKey: "agent:a",
+				Message:    protocoltypes.Message{Role: "user", Content: content},
+				Index:      i,
+			})
+		}
+		return messages
+	}
+	if err := store.StoreMessage(ctx, "agent:b", protocoltypes.Message{Role: "user", Content: "other"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreMessages(ctx, stored("old one", "old two")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed replacement keeps the old messages
+	embedder.fail = true
+	if err := store.ReplaceSessionMessages(ctx, "agent:a", stored("new")); err == nil {
+		t.Fatal("ReplaceSessionMessages should fail when embeddings fail")
+	}
+	if info, _ := store.Stats(ctx); info.PointsCount != 3 {
+		t.Errorf("after failed replace PointsCount = %d, want the 3 old points", info.PointsCount)
+	}
+
+	embedder.fail = false
+	if err := store.ReplaceSessionMessages(ctx, "agent:a", stored("new")); err != nil {
+		t.Fatalf("ReplaceSessionMessages failed: %v", err)
+	}
+	got, err := store.SearchSimilarMessages("agent:a", "anything", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Content != "new" {
+		t.Errorf("session messages = %+v, want only the replacement", got)
+	}
+	if info, _ := store.Stats(ctx); info.PointsCount != 2 {
+		t.Errorf("PointsCount = %d, want other sessions untouched", info.PointsCount)
+	}
+}
+
+func TestSessionFilter_Matches(t *testing.T) {
+	tests := []struct {
+		filter SessionFilter
+		key    string
+		want   bool
+	}{
+		{SessionFilter{}, "agent:main:telegram:group:1", true},
+		{SessionKeyFilter("agent:main:main"), "agent:main:main", true},
+		{SessionKeyFilter("agent:main:main"), "agent:main:main:x", false},
+		{SessionFilter{Key: "agent:main:telegram:", Prefix: true}, "agent:main:telegram:group:1", true},
+		{SessionFilter{Key: "agent:main:telegram:", Prefix: true}, "agent:main:discord:group:1", false},
+		{SessionFilter{Key: "telegram:", Prefix: true}, "agent:main:telegram:group:1", false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(tt.key); got != tt.want {
+			t.Errorf("%+v.Matches(%q) = %v, want %v", tt.filter, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestQdrantClient_SearchPrefixFilter(t *testing.T) {
+	var filter string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		data, _ := json.Marshal(req["filter"])
+		filter = string(data)
+		// The substring match also hits a key with the prefix in its middle
+		w.Write([]byte(`{"result":[
+			{"id":1,"score":0.9,"payload":{"session_key":"agent:main:telegram:group:1"}},
+			{"id":2,"score":0.8,"payload":{"session_key":"legacy:agent:main:telegram:7"}}
+		]}`))
+	}))
+	defer server.Close()
+
+	host, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	client := NewQdrantClient(config.QdrantConfig{Host: host, Port: port, Collection: "test"})
+
+	results, err := client.Search(context.Background(), []float32{1}, SessionFilter{Key: "agent:main:telegram:", Prefix: true}, 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if want := `{"must":[{"key":"session_key","match":{"text":"agent:main:telegram:"}}]}`; filter != want {
+		t.Errorf("prefix filter = %s, want %s", filter, want)
+	}
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("results = %+v, want only the key starting with the prefix", results)
+	}
+
+	if _, err := client.Search(context.Background(), []float32{1}, SessionKeyFilter("agent:main:main"), 5); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if want := `{"must":[{"key":"session_key","match":{"value":"agent:main:main"}}]}`; filter != want {
+		t.Errorf("session filter = %s, want %s", filter, want)
+	}
+
+	if _, err := client.Search(context.Background(), []float32{1}, SessionFilter{}, 5); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if filter != "null" {
+		t.Errorf("unfiltered search sent filter %s", filter)
+	}
+}
+
+func TestMessageStore_SkipsModeratedMessages(t *testing.T) {
+	vectors := NewMemoryVectorStore("memory")
+	store, err := NewMessageStoreWithVectorStore(config.QdrantConfig{}, vectors, &mockEmbeddingClient{})
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithVectorStore failed: %v", err)
+	}
+	store.SetModeration(moderation.NewFilter(moderation.NewRuleModerator([]string{"password"}), moderation.ActionWarn, false, ""))
+
+	ctx := context.Background()
+	msg := func(content string) protocoltypes.Message {
+		return protocoltypes.Message{Role: "user", Content: content}
+	}
+	if err := store.StoreMessage(ctx, "agent:a", msg("my password is hunter2"), 0); err != nil {
+		t.Fatalf("StoreMessage failed: %v", err)
+	}
+	err = store.StoreMessages(ctx, []StoredMessage{
+		{SessionKey: "agent:a", Message: msg("hello"), Index: 1},
+		{SessionKey: "agent:a", Message: msg("the Password is swordfish"), Index: 2},
+	})
+	if err != nil {
+		t.Fatalf("StoreMessages failed: %v", err)
+	}
+
+	got, err := store.SearchSimilarMessages("agent:a", "anything", 10)
+	if err != nil {
+		t.Fatalf("SearchSimilarMessages failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Content != "hello" {
+		t.Errorf("stored messages = %+v, want only the unflagged one", got)
+	}
+}
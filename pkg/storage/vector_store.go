@@ -0,0 +1,190 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VectorStore is the vector database behind a MessageStore. QdrantClient is
+// the default implementation; MemoryVectorStore keeps points in process.
+type VectorStore interface {
+	// CreateCollection prepares the store; it succeeds if already prepared
+	CreateCollection(ctx context.Context) error
+	// CollectionInfo reports the point count and vector configuration
+	CollectionInfo(ctx context.Context) (*CollectionInfo, error)
+	// UpsertPoints inserts points, replacing those with the same ID
+	UpsertPoints(ctx context.Context, points []Point) error
+	// Search returns the limit points most similar to vector among the
+	// sessions matched by filter
+	Search(ctx context.Context, vector []float32, filter SessionFilter, limit int) ([]ScoredPoint, error)
+	// DeleteBySessionKey removes all points of a session
+	DeleteBySessionKey(ctx context.Context, sessionKey string) error
+	// DeleteOtherGenerations removes the points of a session whose payload
+	// generation differs from generation
+	DeleteOtherGenerations(ctx context.Context, sessionKey, generation string) error
+}
+
+var (
+	_ VectorStore = (*QdrantClient)(nil)
+	_ VectorStore = (*MemoryVectorStore)(nil)
+)
+
+// SessionFilter selects the sessions a search covers. The zero value
+// matches every session.
+type SessionFilter struct {
+	// Key is a session key, or a key prefix if Prefix is set
+	Key    string
+	Prefix bool
+}
+
+// SessionKeyFilter matches the single session sessionKey, or every session
+// if it is empty.
+func SessionKeyFilter(sessionKey string) SessionFilter {
+	return SessionFilter{Key: sessionKey}
+}
+
+// Matches reports whether sessionKey is selected by the filter
+func (f SessionFilter) Matches(sessionKey string) bool {
+	if f.Key == "" {
+		return true
+	}
+	if f.Prefix {
+		return strings.HasPrefix(sessionKey, f.Key)
+	}
+	return sessionKey == f.Key
+}
+
+// MemoryVectorStore is a VectorStore that keeps points in memory and searches
+// them by cosine similarity. It suits tests and small deployments; nothing
+// survives a restart.
+type MemoryVectorStore struct {
+	name   string
+	mu     sync.RWMutex
+	points map[int64]Point
+}
+
+// NewMemoryVectorStore creates an empty in-memory store. name is reported
+// as the collection name.
+func NewMemoryVectorStore(name string) *MemoryVectorStore {
+	return &MemoryVectorStore{
+		name:   name,
+		points: make(map[int64]Point),
+	}
+}
+
+// CreateCollection is a no-op; the store is ready once created
+func (m *MemoryVectorStore) CreateCollection(ctx context.Context) error {
+	return nil
+}
+
+// CollectionInfo reports the number of stored points. The vector size is
+// that of the stored vectors, or 0 while the store is empty.
+func (m *MemoryVectorStore) CollectionInfo(ctx context.Context) (*CollectionInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info := &CollectionInfo{
+		Name:        m.name,
+		Status:      "green",
+		PointsCount: int64(len(m.points)),
+		Distance:    "Cosine",
+	}
+	for _, p := range m.points {
+		info.VectorSize = len(p.Vector)
+		break
+	}
+	return info, nil
+}
+
+// UpsertPoints stores points, replacing those with the same ID
+func (m *MemoryVectorStore) UpsertPoints(ctx context.Context, points []Point) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range points {
+		m.points[p.ID] = p
+	}
+	return nil
+}
+
+// Search returns the points most similar to vector, best first
+func (m *MemoryVectorStore) Search(ctx context.Context, vector []float32, filter SessionFilter, limit int) ([]ScoredPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]ScoredPoint, 0, len(m.points))
+	for _, p := range m.points {
+		if key, _ := p.Payload["session_key"].(string); !filter.Matches(key) {
+			continue
+		}
+		results = append(results, ScoredPoint{
+			ID:      p.ID,
+			Score:   cosineSimilarity(vector, p.Vector),
+			Payload: p.Payload,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// DeleteBySessionKey removes all points of a session
+func (m *MemoryVectorStore) DeleteBySessionKey(ctx context.Context, sessionKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, p := range m.points {
+		if p.Payload["session_key"] == sessionKey {
+			delete(m.points, id)
+		}
+	}
+	return nil
+}
+
+// DeleteOtherGenerations removes the points of a session not stored with
+// generation
+func (m *MemoryVectorStore) DeleteOtherGenerations(ctx context.Context, sessionKey, generation string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, p := range m.points {
+		if p.Payload["session_key"] == sessionKey && p.Payload["generation"] != generation {
+			delete(m.points, id)
+		}
+	}
+	return nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// their sizes differ or either is zero.
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
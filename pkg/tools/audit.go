@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxAuditArgsLen bounds the argument preview stored per audit entry.
+const maxAuditArgsLen = 500
+
+// redactedValue replaces the value of sensitive arguments in audit entries.
+const redactedValue = "[REDACTED]"
+
+// sensitiveArgKeys are substrings of argument names whose values are redacted.
+// Names ending in "token" are redacted too, but not e.g. "max_tokens".
+var sensitiveArgKeys = []string{
+	"password", "passwd", "secret", "api_key", "apikey",
+	"authorization", "credential", "private_key", "cookie",
+}
+
+// AuditEntry records a single tool execution.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Session    string    `json:"session,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	Tool       string    `json:"tool"`
+	Args       string    `json:"args"`
+	Status     string    `json:"status"` // "ok", "error" or "async"
+	ErrorKind  ErrorKind `json:"error_kind,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// AuditLog records tool executions, either as JSON lines appended to a file
+// or, when no path is set, through the structured logger. A nil *AuditLog is
+// valid and records nothing.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewAuditLog creates an audit log writing to path, or to the structured
+// logger if path is empty.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Record writes an audit entry for a finished tool execution. Sensitive
+// arguments are redacted and the argument preview is truncated.
+func (a *AuditLog) Record(
+	session, channel, chatID, toolName string,
+	args map[string]any,
+	result *ToolResult,
+	duration time.Duration,
+) {
+	if a == nil {
+		return
+	}
+
+	argsJSON, _ := json.Marshal(RedactArgs(args))
+	entry := AuditEntry{
+		Time:       time.Now().UTC(),
+		Session:    session,
+		Channel:    channel,
+		ChatID:     chatID,
+		Tool:       toolName,
+		Args:       utils.Truncate(string(argsJSON), maxAuditArgsLen),
+		Status:     "ok",
+		DurationMS: duration.Milliseconds(),
+	}
+	switch {
+	case result == nil || result.IsError:
+		entry.Status = "error"
+		if result != nil {
+			entry.ErrorKind = result.ErrorKind
+		}
+	case result.Async:
+		entry.Status = "async"
+	}
+
+	if a.path == "" {
+		logger.InfoCF("audit", "Tool executed", map[string]any{
+			"session":     entry.Session,
+			"channel":     entry.Channel,
+			"chat_id":     entry.ChatID,
+			"tool":        entry.Tool,
+			"args":        entry.Args,
+			"status":      entry.Status,
+			"error_kind":  string(entry.ErrorKind),
+			"duration_ms": entry.DurationMS,
+		})
+		return
+	}
+
+	if err := a.append(entry); err != nil {
+		logger.ErrorCF("audit", "Failed to write audit entry", map[string]any{
+			"path":  a.path,
+			"tool":  toolName,
+			"error": err.Error(),
+		})
+	}
+}
+
+// append writes entry as one JSON line at the end of the audit file.
+func (a *AuditLog) append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RedactArgs returns a copy of args with the values of sensitive keys, at any
+// nesting depth, replaced by a placeholder.
+func RedactArgs(args map[string]any) map[string]any {
+	if args == nil {
+		return nil
+	}
+	redacted := make(map[string]any, len(args))
+	for k, v := range args {
+		if isSensitiveArgKey(k) {
+			redacted[k] = redactedValue
+			continue
+		}
+		redacted[k] = redactValue(v)
+	}
+	return redacted
+}
+
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		return RedactArgs(val)
+	case []any:
+		items := make([]any, len(val))
+		for i, item := range val {
+			items[i] = redactValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
+
+func isSensitiveArgKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "token") {
+		return true
+	}
+	for _, s := range sensitiveArgKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// oneToolCallLLMProvider requests a single tool call, then finishes.
+type oneToolCallLLMProvider struct {
+	call  providers.ToolCall
+	calls int
+}
+
+func (m *oneToolCallLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{m.call}}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (m *oneToolCallLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func readAuditEntries(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRunToolLoop_RecordsAuditEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+
+	registry := NewToolRegistry()
+	registry.Register(newMockTool("fetch", "fetches things"))
+
+	provider := &oneToolCallLLMProvider{call: providers.ToolCall{
+		ID:   "call_1",
+		Name: "fetch",
+		Arguments: map[string]any{
+			"url":     "https://example.com",
+			"api_key": "sk-secret",
+		},
+	}}
+	_, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      provider,
+		Model:         "test-model",
+		Tools:         registry,
+		MaxIterations: 3,
+		Audit:         NewAuditLog(path),
+		SessionKey:    "subagent:subagent-1",
+	}, []providers.Message{{Role: "user", Content: "go"}}, "telegram", "42", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+
+	entries := readAuditEntries(t, path)
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Tool != "fetch" || entry.Session != "subagent:subagent-1" ||
+		entry.Channel != "telegram" || entry.ChatID != "42" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.Status != "ok" {
+		t.Errorf("Status = %q, want ok", entry.Status)
+	}
+	if entry.Time.IsZero() {
+		t.Error("Time not set")
+	}
+	if strings.Contains(entry.Args, "sk-secret") {
+		t.Errorf("api_key leaked into audit args: %s", entry.Args)
+	}
+	if !strings.Contains(entry.Args, "https://example.com") || !strings.Contains(entry.Args, redactedValue) {
+		t.Errorf("Args = %s, want url kept and api_key redacted", entry.Args)
+	}
+}
+
+func TestAuditLog_RecordsErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := NewAuditLog(path)
+
+	audit.Record("s", "cli", "direct", "exec", nil, PermissionError("blocked"), 0)
+	audit.Record("s", "cli", "direct", "spawn", nil, AsyncResult("started"), 0)
+
+	entries := readAuditEntries(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	if entries[0].Status != "error" || entries[0].ErrorKind != ErrorKindPermission {
+		t.Errorf("entry 0 = %+v, want permission error", entries[0])
+	}
+	if entries[1].Status != "async" {
+		t.Errorf("entry 1 status = %q, want async", entries[1].Status)
+	}
+}
+
+func TestAuditLog_NilIsNoop(t *testing.T) {
+	var audit *AuditLog
+	audit.Record("s", "cli", "direct", "exec", nil, NewToolResult("ok"), 0)
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := map[string]any{
+		"command":    "ls",
+		"max_tokens": 10,
+		"headers": map[string]any{
+			"Authorization": "Bearer abc",
+			"Accept":        "text/plain",
+		},
+		"items":    []any{map[string]any{"password": "hunter2"}},
+		"BotToken": "123:xyz",
+	}
+
+	got := RedactArgs(args)
+
+	if got["command"] != "ls" || got["max_tokens"] != 10 {
+		t.Errorf("non-sensitive args changed: %v", got)
+	}
+	if got["BotToken"] != redactedValue {
+		t.Errorf("BotToken = %v, want redacted", got["BotToken"])
+	}
+	headers := got["headers"].(map[string]any)
+	if headers["Authorization"] != redactedValue || headers["Accept"] != "text/plain" {
+		t.Errorf("headers = %v", headers)
+	}
+	item := got["items"].([]any)[0].(map[string]any)
+	if item["password"] != redactedValue {
+		t.Errorf("nested password = %v, want redacted", item["password"])
+	}
+	if args["headers"].(map[string]any)["Authorization"] != "Bearer abc" {
+		t.Error("RedactArgs modified its input")
+	}
+}
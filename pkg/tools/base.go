@@ -1,6 +1,10 @@
 package tools
 
-import "context"
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
 
 // Tool is the interface that all tools must implement.
 type Tool interface {
@@ -24,6 +28,79 @@ type SessionAwareTool interface {
 	SetSessionKey(sessionKey string)
 }
 
+// CallContext identifies where a tool call comes from. Unlike SetContext and
+// SetSessionKey, which store it on the shared tool, it travels with the
+// call's context, so concurrent chats cannot see each other's.
+type CallContext struct {
+	Channel    string
+	ChatID     string
+	ThreadID   string
+	SessionKey string
+	SenderID   string // user whose message led to the call; empty if unknown
+}
+
+type callContextKey struct{}
+
+// WithCallContext returns ctx carrying call.
+func WithCallContext(ctx context.Context, call CallContext) context.Context {
+	return context.WithValue(ctx, callContextKey{}, call)
+}
+
+// CallContextFrom returns the call context carried by ctx, if any.
+func CallContextFrom(ctx context.Context) (CallContext, bool) {
+	call, ok := ctx.Value(callContextKey{}).(CallContext)
+	return call, ok
+}
+
+// callChat returns the chat a call comes from: the one carried by ctx, or
+// else channel, chatID and threadID as last set with SetContext.
+func callChat(ctx context.Context, channel, chatID, threadID string) (string, string, string) {
+	if call, ok := CallContextFrom(ctx); ok && call.Channel != "" && call.ChatID != "" {
+		return call.Channel, call.ChatID, call.ThreadID
+	}
+	return channel, chatID, threadID
+}
+
+// callSessionKey returns the session a call belongs to: the one carried by
+// ctx, or else sessionKey as last set with SetSessionKey.
+func callSessionKey(ctx context.Context, sessionKey string) string {
+	if call, ok := CallContextFrom(ctx); ok && call.SessionKey != "" {
+		return call.SessionKey
+	}
+	return sessionKey
+}
+
+type usageReporterKey struct{}
+
+// WithUsageReporter returns ctx carrying report, which is called with the
+// token usage of every LLM call made on the context's behalf, including the
+// calls of tools and subagents.
+func WithUsageReporter(ctx context.Context, report func(*providers.UsageInfo)) context.Context {
+	return context.WithValue(ctx, usageReporterKey{}, report)
+}
+
+// ReportUsage passes the usage of an LLM call to the reporter carried by
+// ctx, if any.
+func ReportUsage(ctx context.Context, usage *providers.UsageInfo) {
+	if report, ok := ctx.Value(usageReporterKey{}).(func(*providers.UsageInfo)); ok && usage != nil {
+		report(usage)
+	}
+}
+
+// ReadOnlyTool is an optional interface that tools implement to declare
+// whether they change state. Tools that don't implement it are treated as
+// mutating, so only tools that opt in are cached or exempt from checks.
+type ReadOnlyTool interface {
+	Tool
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether tool declares that it never changes state.
+func IsReadOnly(tool Tool) bool {
+	rt, ok := tool.(ReadOnlyTool)
+	return ok && rt.ReadOnly()
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
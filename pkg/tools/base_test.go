@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsReadOnly_BuiltinTools(t *testing.T) {
+	readOnly := []Tool{
+		NewReadFileTool("", false),
+		NewListDirTool("", false),
+		&WebSearchTool{},
+		NewWebFetchTool(0),
+		&ReadImageTool{},
+		NewQdrantSearchTool(nil),
+		&MemoryStatsTool{},
+		&ConfigInfoTool{},
+		&FindSkillsTool{},
+	}
+	mutating := []Tool{
+		NewExecTool("", false),
+		NewWriteFileTool("", false),
+		NewEditFileTool("", false),
+		NewAppendFileTool("", false),
+		NewMessageTool(),
+		NewSessionTool(),
+		&CronTool{},
+		&SpawnTool{},
+		&SubagentTool{},
+		&ParallelSubagentsTool{},
+		&InstallSkillTool{},
+		&ImportHistoryTool{},
+		&SummarizeSessionTool{},
+		&TelegramFileTool{},
+		&TelegramGetFileTool{},
+		&WebUISendFileTool{},
+		NewI2CTool(),
+		NewSPITool(),
+	}
+
+	for _, tool := range readOnly {
+		if !IsReadOnly(tool) {
+			t.Errorf("%s should be read-only", tool.Name())
+		}
+	}
+	for _, tool := range mutating {
+		if IsReadOnly(tool) {
+			t.Errorf("%s should be mutating", tool.Name())
+		}
+	}
+
+	// Wrappers keep the classification of the wrapped tool
+	gate := NewConfirmationGate(0, nil)
+	if !IsReadOnly(gate.Wrap(NewReadFileTool("", false))) || IsReadOnly(gate.Wrap(NewExecTool("", false))) {
+		t.Error("confirmation wrapper changed the classification")
+	}
+	if !IsReadOnly(NewToolResultCache(time.Minute, 0).Wrap(NewWebFetchTool(0))) {
+		t.Error("cache wrapper changed the classification")
+	}
+}
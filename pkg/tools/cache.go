@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheTTL is how long a cached result is served.
+	defaultCacheTTL = 5 * time.Minute
+	// defaultCacheMaxEntries bounds the results kept in memory.
+	defaultCacheMaxEntries = 100
+)
+
+// neverCachedTools run commands or change files, so their results must
+// always be fresh, whatever the tool claims.
+var neverCachedTools = map[string]bool{
+	"exec":        true,
+	"write_file":  true,
+	"edit_file":   true,
+	"append_file": true,
+}
+
+// CacheableTool is implemented by tools whose results depend only on their
+// arguments for a while, such as fetching a URL. Their results may be
+// served from a ToolResultCache instead of running the tool again.
+type CacheableTool interface {
+	Tool
+	Cacheable() bool
+}
+
+// IsCacheable reports whether results of tool may be cached. Only read-only
+// tools qualify, since skipping a call must not skip a change.
+func IsCacheable(tool Tool) bool {
+	if neverCachedTools[tool.Name()] || !IsReadOnly(tool) {
+		return false
+	}
+	ct, ok := tool.(CacheableTool)
+	return ok && ct.Cacheable()
+}
+
+// cacheEntry is a cached tool result.
+type cacheEntry struct {
+	result  ToolResult
+	created time.Time
+}
+
+// ToolResultCache serves repeated calls of cacheable tools with identical
+// arguments from memory. Entries expire after the TTL; errors and async
+// results are never cached.
+type ToolResultCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+}
+
+// NewToolResultCache creates a cache. Zero values use the defaults of five
+// minutes and 100 entries.
+func NewToolResultCache(ttl time.Duration, maxEntries int) *ToolResultCache {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	return &ToolResultCache{
+		entries:    make(map[string]*cacheEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Wrap returns a tool that answers from the cache when it can. Tools that
+// are not cacheable are returned unchanged.
+func (c *ToolResultCache) Wrap(tool Tool) Tool {
+	if !IsCacheable(tool) {
+		return tool
+	}
+	return &cachingTool{cache: c, tool: tool}
+}
+
+// cacheKey identifies a call by tool name and a hash of its arguments.
+// Map keys are marshaled in sorted order, so equal arguments hash equally.
+func cacheKey(name string, args map[string]any) (string, bool) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return name + ":" + hex.EncodeToString(sum[:]), true
+}
+
+func (c *ToolResultCache) get(key string) (*ToolResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(entry.created) > c.ttl {
+		delete(c.entries, key)
+		return nil, false
+	}
+	result := entry.result
+	return &result, true
+}
+
+func (c *ToolResultCache) put(key string, result *ToolResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		// Drop expired entries, then the oldest if still full
+		var oldestKey string
+		var oldest time.Time
+		for k, entry := range c.entries {
+			if now.Sub(entry.created) > c.ttl {
+				delete(c.entries, k)
+				continue
+			}
+			if oldestKey == "" || entry.created.Before(oldest) {
+				oldestKey, oldest = k, entry.created
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = &cacheEntry{result: *result, created: now}
+}
+
+// cachingTool answers repeated calls of the wrapped tool from the cache.
+type cachingTool struct {
+	cache *ToolResultCache
+	tool  Tool
+}
+
+func (t *cachingTool) Name() string {
+	return t.tool.Name()
+}
+
+func (t *cachingTool) Description() string {
+	return t.tool.Description()
+}
+
+func (t *cachingTool) Parameters() map[string]any {
+	return t.tool.Parameters()
+}
+
+func (t *cachingTool) Cacheable() bool {
+	return true
+}
+
+func (t *cachingTool) ReadOnly() bool {
+	return true
+}
+
+func (t *cachingTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	key, ok := cacheKey(t.tool.Name(), args)
+	if !ok {
+		return t.tool.Execute(ctx, args)
+	}
+	if result, ok := t.cache.get(key); ok {
+		return result
+	}
+
+	result := t.tool.Execute(ctx, args)
+	if result != nil && !result.IsError && !result.Async {
+		t.cache.put(key, result)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingTool is a read-only tool that counts its executions.
+type countingTool struct {
+	name      string
+	cacheable bool
+	mutating  bool
+	fail      bool
+	calls     int
+}
+
+func (t *countingTool) Name() string               { return t.name }
+func (t *countingTool) Description() string        { return "counts calls" }
+func (t *countingTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *countingTool) Cacheable() bool            { return t.cacheable }
+func (t *countingTool) ReadOnly() bool             { return !t.mutating }
+
+func (t *countingTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	t.calls++
+	if t.fail {
+		return ExternalError("unavailable")
+	}
+	return NewToolResult(fmt.Sprintf("call %d for %v", t.calls, args["url"]))
+}
+
+func TestToolResultCache_ServesIdenticalCalls(t *testing.T) {
+	cache := NewToolResultCache(time.Minute, 0)
+	inner := &countingTool{name: "web_fetch", cacheable: true}
+	tool := cache.Wrap(inner)
+	ctx := context.Background()
+
+	first := tool.Execute(ctx, map[string]any{"url": "https://example.com", "max_chars": 100.0})
+	second := tool.Execute(ctx, map[string]any{"max_chars": 100.0, "url": "https://example.com"})
+	if inner.calls != 1 {
+		t.Fatalf("tool ran %d times, want the second call served from cache", inner.calls)
+	}
+	if second.ForLLM != first.ForLLM {
+		t.Errorf("cached result = %q, want %q", second.ForLLM, first.ForLLM)
+	}
+
+	// Other arguments run the tool again
+	if got := tool.Execute(ctx, map[string]any{"url": "https://example.org"}); got.ForLLM != "call 2 for https://example.org" {
+		t.Errorf("different args = %q", got.ForLLM)
+	}
+
+	// Entries expire after the TTL
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	tool.Execute(ctx, map[string]any{"url": "https://example.com", "max_chars": 100.0})
+	if inner.calls != 3 {
+		t.Errorf("tool ran %d times, want an expired entry to run it again", inner.calls)
+	}
+}
+
+func TestToolResultCache_DoesNotCacheErrors(t *testing.T) {
+	cache := NewToolResultCache(time.Minute, 0)
+	inner := &countingTool{name: "web_fetch", cacheable: true, fail: true}
+	tool := cache.Wrap(inner)
+
+	for range 2 {
+		if result := tool.Execute(context.Background(), map[string]any{"url": "x"}); !result.IsError {
+			t.Fatalf("expected an error result, got %q", result.ForLLM)
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("tool ran %d times, want errors to be retried", inner.calls)
+	}
+}
+
+func TestToolResultCache_Wrap(t *testing.T) {
+	cache := NewToolResultCache(0, 0)
+	for _, tt := range []struct {
+		tool *countingTool
+		want bool
+	}{
+		{&countingTool{name: "web_fetch", cacheable: true}, true},
+		{&countingTool{name: "read_image", cacheable: false}, false},
+		{&countingTool{name: "send_report", cacheable: true, mutating: true}, false},
+		// Commands and writes are never cached, whatever they declare
+		{&countingTool{name: "exec", cacheable: true}, false},
+		{&countingTool{name: "write_file", cacheable: true}, false},
+	} {
+		_, wrapped := cache.Wrap(tt.tool).(*cachingTool)
+		if wrapped != tt.want {
+			t.Errorf("Wrap(%s) wrapped = %v, want %v", tt.tool.name, wrapped, tt.want)
+		}
+	}
+
+	if !IsCacheable(NewWebFetchTool(0)) {
+		t.Error("web_fetch should be cacheable")
+	}
+	if IsCacheable(&ExecTool{}) {
+		t.Error("exec must not be cacheable")
+	}
+}
+
+func TestToolResultCache_EvictsOldest(t *testing.T) {
+	cache := NewToolResultCache(time.Hour, 2)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	inner := &countingTool{name: "web_fetch", cacheable: true}
+	tool := cache.Wrap(inner)
+	ctx := context.Background()
+
+	for _, url := range []string{"a", "b", "c"} {
+		now = now.Add(time.Second)
+		tool.Execute(ctx, map[string]any{"url": url})
+	}
+	if len(cache.entries) != 2 {
+		t.Fatalf("cache holds %d entries, want 2", len(cache.entries))
+	}
+
+	// "a" was evicted, "c" is still cached
+	tool.Execute(ctx, map[string]any{"url": "c"})
+	tool.Execute(ctx, map[string]any{"url": "a"})
+	if inner.calls != 4 {
+		t.Errorf("tool ran %d times, want only the evicted entry to run again", inner.calls)
+	}
+}
@@ -0,0 +1,134 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ConfigInfo is the part of the effective configuration the agent may see.
+// It deliberately has no fields for API keys, tokens or endpoints, so
+// whatever fills it cannot leak a secret through the config_info tool.
+type ConfigInfo struct {
+	AgentID             string
+	Model               string // model name as configured
+	ModelID             string // protocol/model identifier from model_list
+	Provider            string
+	Fallbacks           []string
+	MaxTokens           int
+	ContextWindow       int
+	MaxIterations       int
+	Temperature         float64
+	RestrictToWorkspace bool
+	Timezone            string
+	Channels            []string // enabled channels
+	WebSearch           []string // enabled web search providers
+	MemoryEnabled       bool
+	MemoryCollection    string
+	VectorSize          int
+	EmbeddingModel      string
+	DailyMessages       int // daily message budget, 0 = unlimited
+	DailyTokens         int // daily token budget, 0 = unlimited
+}
+
+// ConfigInfoTool lets the agent report its own effective configuration, for
+// questions like "which model are you using" or "is memory enabled".
+type ConfigInfoTool struct {
+	source func() ConfigInfo
+}
+
+// NewConfigInfoTool creates a config info tool. source is called on every
+// execution so runtime changes such as a model switch are reported.
+func NewConfigInfoTool(source func() ConfigInfo) *ConfigInfoTool {
+	return &ConfigInfoTool{source: source}
+}
+
+// Name returns the tool name
+func (t *ConfigInfoTool) Name() string {
+	return "config_info"
+}
+
+// Description returns the tool description
+func (t *ConfigInfoTool) Description() string {
+	return "Show the bot's effective configuration: the model and fallbacks, token and iteration limits, enabled channels, web search and long-term memory settings. Secrets are never included. Use it when the user asks how the bot is set up."
+}
+
+// Parameters returns the JSON schema for tool parameters
+func (t *ConfigInfoTool) Parameters() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+}
+
+// ReadOnly reports that the tool never changes state
+func (t *ConfigInfoTool) ReadOnly() bool {
+	return true
+}
+
+// Execute reports the current configuration
+func (t *ConfigInfoTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if t.source == nil {
+		return InternalError("configuration is not available")
+	}
+	return NewToolResult(formatConfigInfo(t.source()))
+}
+
+func formatConfigInfo(info ConfigInfo) string {
+	var sb strings.Builder
+	if info.AgentID != "" {
+		fmt.Fprintf(&sb, "Agent: %s\n", info.AgentID)
+	}
+	fmt.Fprintf(&sb, "Model: %s", info.Model)
+	if info.ModelID != "" && info.ModelID != info.Model {
+		fmt.Fprintf(&sb, " (%s)", info.ModelID)
+	}
+	sb.WriteString("\n")
+	if info.Provider != "" {
+		fmt.Fprintf(&sb, "Provider: %s\n", info.Provider)
+	}
+	fmt.Fprintf(&sb, "Fallbacks: %s\n", listOrNone(info.Fallbacks))
+	fmt.Fprintf(&sb, "Max tokens: %d\n", info.MaxTokens)
+	fmt.Fprintf(&sb, "Context window: %d\n", info.ContextWindow)
+	fmt.Fprintf(&sb, "Max tool iterations: %d\n", info.MaxIterations)
+	fmt.Fprintf(&sb, "Temperature: %g\n", info.Temperature)
+	fmt.Fprintf(&sb, "Restricted to workspace: %t\n", info.RestrictToWorkspace)
+	if info.Timezone != "" {
+		fmt.Fprintf(&sb, "Timezone: %s\n", info.Timezone)
+	}
+	fmt.Fprintf(&sb, "Channels: %s\n", listOrNone(info.Channels))
+	fmt.Fprintf(&sb, "Web search: %s\n", listOrNone(info.WebSearch))
+	if info.MemoryEnabled {
+		fmt.Fprintf(&sb, "Long-term memory: enabled (collection %s, vector size %d", info.MemoryCollection, info.VectorSize)
+		if info.EmbeddingModel != "" {
+			fmt.Fprintf(&sb, ", embeddings %s", info.EmbeddingModel)
+		}
+		sb.WriteString(")\n")
+	} else {
+		sb.WriteString("Long-term memory: disabled\n")
+	}
+	if info.DailyMessages > 0 || info.DailyTokens > 0 {
+		fmt.Fprintf(&sb, "Daily budget: %s messages, %s tokens\n",
+			limitOrUnlimited(info.DailyMessages), limitOrUnlimited(info.DailyTokens))
+	}
+	return sb.String()
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+func limitOrUnlimited(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", n)
+}
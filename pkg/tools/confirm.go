@@ -0,0 +1,227 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultConfirmationTools are the tools gated when no explicit list is configured.
+// The session tool only needs approval for the actions that delete memory.
+var DefaultConfirmationTools = []string{"exec", "write_file", "edit_file", "append_file", "write_files", "apply_patch", "session"}
+
+// AlwaysConfirmedTools are gated even when confirmation is disabled or an
+// explicit list leaves them out: the session tool's forget_all deletes
+// long-term memory for good.
+var AlwaysConfirmedTools = []string{"session"}
+
+// defaultConfirmationTTL is how long a pending action waits for approval.
+const defaultConfirmationTTL = 10 * time.Minute
+
+var (
+	ErrConfirmationNotFound  = errors.New("no pending action with that ID in this chat")
+	ErrConfirmationExpired   = errors.New("pending action has expired")
+	ErrConfirmationForbidden = errors.New("pending action was requested by another user")
+)
+
+// ConfirmationPolicy is implemented by tools that only need approval for
+// some calls, e.g. a destructive action of an otherwise harmless tool.
+type ConfirmationPolicy interface {
+	NeedsConfirmation(args map[string]any) bool
+}
+
+// PendingAction is a gated tool call waiting for the user's approval.
+type PendingAction struct {
+	ID         string
+	ToolName   string
+	Args       map[string]any
+	Channel    string
+	ChatID     string
+	ThreadID   string
+	SessionKey string
+	SenderID   string // only this user may resolve the action; empty allows anyone in the chat
+	Created    time.Time
+
+	tool Tool
+}
+
+// ConfirmationGate holds back calls to destructive tools until the user
+// approves them. Wrapped tools register a PendingAction and return at once;
+// the action runs only when Resolve is called with approve=true from the
+// chat it was requested in, by the user whose message led to it.
+type ConfirmationGate struct {
+	mu      sync.Mutex
+	pending map[string]*PendingAction
+	nextID  int
+	ttl     time.Duration
+	notify  func(action *PendingAction)
+}
+
+// NewConfirmationGate creates a gate. notify is called for every new pending
+// action so the caller can ask the user (e.g. with approve/deny buttons).
+// A zero ttl uses the default of 10 minutes.
+func NewConfirmationGate(ttl time.Duration, notify func(action *PendingAction)) *ConfirmationGate {
+	if ttl <= 0 {
+		ttl = defaultConfirmationTTL
+	}
+	return &ConfirmationGate{
+		pending: make(map[string]*PendingAction),
+		nextID:  1,
+		ttl:     ttl,
+		notify:  notify,
+	}
+}
+
+// Wrap returns a tool with the same name, description and parameters whose
+// calls must be approved before they reach tool.
+func (g *ConfirmationGate) Wrap(tool Tool) Tool {
+	return &confirmingTool{gate: g, tool: tool}
+}
+
+// Resolve approves or denies the pending action id requested from channel and
+// chatID, on behalf of senderID. On approval the tool is executed and its
+// result returned; on denial the action is discarded and the result is nil.
+// An answer from another user than the requester leaves the action pending.
+func (g *ConfirmationGate) Resolve(
+	ctx context.Context,
+	id, channel, chatID, senderID string,
+	approve bool,
+) (*PendingAction, *ToolResult, error) {
+	g.mu.Lock()
+	action, ok := g.pending[id]
+	if ok && (action.Channel != channel || action.ChatID != chatID) {
+		ok = false
+	}
+	if ok && action.SenderID != "" && action.SenderID != senderID {
+		g.mu.Unlock()
+		return action, nil, ErrConfirmationForbidden
+	}
+	if ok {
+		delete(g.pending, id)
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		return nil, nil, ErrConfirmationNotFound
+	}
+	if time.Since(action.Created) > g.ttl {
+		return action, nil, ErrConfirmationExpired
+	}
+	if !approve {
+		return action, nil, nil
+	}
+
+	call := CallContext{
+		Channel:    action.Channel,
+		ChatID:     action.ChatID,
+		ThreadID:   action.ThreadID,
+		SessionKey: action.SessionKey,
+		SenderID:   action.SenderID,
+	}
+	return action, execute(ctx, action.tool, action.Args, call), nil
+}
+
+// execute runs tool with the context of the chat and session it was called from.
+func execute(ctx context.Context, tool Tool, args map[string]any, call CallContext) *ToolResult {
+	if contextualTool, ok := tool.(ContextualTool); ok {
+		contextualTool.SetContext(call.Channel, call.ChatID, call.ThreadID)
+	}
+	if sessionTool, ok := tool.(SessionAwareTool); ok && call.SessionKey != "" {
+		sessionTool.SetSessionKey(call.SessionKey)
+	}
+	return tool.Execute(WithCallContext(ctx, call), args)
+}
+
+// add registers a new pending action and returns it.
+func (g *ConfirmationGate) add(tool Tool, args map[string]any, call CallContext) *PendingAction {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Drop actions nobody answered
+	now := time.Now()
+	for id, action := range g.pending {
+		if now.Sub(action.Created) > g.ttl {
+			delete(g.pending, id)
+		}
+	}
+
+	action := &PendingAction{
+		ID:         fmt.Sprintf("confirm-%d", g.nextID),
+		ToolName:   tool.Name(),
+		Args:       args,
+		Channel:    call.Channel,
+		ChatID:     call.ChatID,
+		ThreadID:   call.ThreadID,
+		SessionKey: call.SessionKey,
+		SenderID:   call.SenderID,
+		Created:    now,
+		tool:       tool,
+	}
+	g.nextID++
+	g.pending[action.ID] = action
+	return action
+}
+
+// confirmingTool defers execution of the wrapped tool to the gate. The chat,
+// session and sender of a call come from its context (see CallContext), so
+// concurrent chats never get each other's pending actions.
+type confirmingTool struct {
+	gate *ConfirmationGate
+	tool Tool
+}
+
+func (t *confirmingTool) Name() string {
+	return t.tool.Name()
+}
+
+func (t *confirmingTool) Description() string {
+	return t.tool.Description()
+}
+
+func (t *confirmingTool) Parameters() map[string]any {
+	return t.tool.Parameters()
+}
+
+func (t *confirmingTool) ReadOnly() bool {
+	return IsReadOnly(t.tool)
+}
+
+// SetContext passes the context on to the wrapped tool, for calls that need
+// no approval.
+func (t *confirmingTool) SetContext(channel, chatID, threadID string) {
+	if contextualTool, ok := t.tool.(ContextualTool); ok {
+		contextualTool.SetContext(channel, chatID, threadID)
+	}
+}
+
+// SetSessionKey passes the session key on to the wrapped tool, for calls that
+// need no approval.
+func (t *confirmingTool) SetSessionKey(sessionKey string) {
+	if sessionTool, ok := t.tool.(SessionAwareTool); ok {
+		sessionTool.SetSessionKey(sessionKey)
+	}
+}
+
+func (t *confirmingTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if policy, ok := t.tool.(ConfirmationPolicy); ok && !policy.NeedsConfirmation(args) {
+		return t.tool.Execute(ctx, args)
+	}
+
+	call, _ := CallContextFrom(ctx)
+	if call.Channel == "" || call.ChatID == "" {
+		return PermissionError(fmt.Sprintf("%s requires user confirmation, but there is no chat to ask", t.tool.Name()))
+	}
+
+	action := t.gate.add(t.tool, args, call)
+	if t.gate.notify != nil {
+		t.gate.notify(action)
+	}
+
+	return SilentResult(fmt.Sprintf(
+		"%s needs the user's approval and has NOT run yet (confirmation ID %s). "+
+			"Tell the user what you want to do and that they can reply \"/approve %s\" to run it or \"/deny %s\" to cancel. "+
+			"Do not call the tool again for this action.",
+		t.tool.Name(), action.ID, action.ID, action.ID))
+}
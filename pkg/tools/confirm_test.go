@@ -0,0 +1,198 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTool counts executions and remembers the last arguments.
+type recordingTool struct {
+	mockCtxTool
+	calls    int
+	lastArgs map[string]any
+}
+
+func (m *recordingTool) Execute(_ context.Context, args map[string]any) *ToolResult {
+	m.calls++
+	m.lastArgs = args
+	return SilentResult("ran " + m.name)
+}
+
+func newRecordingTool(name string) *recordingTool {
+	return &recordingTool{mockCtxTool: mockCtxTool{mockRegistryTool: *newMockTool(name, "destructive")}}
+}
+
+// chatContext returns a context carrying a call from the given chat and sender.
+func chatContext(channel, chatID, threadID, senderID string) context.Context {
+	return WithCallContext(context.Background(), CallContext{
+		Channel:  channel,
+		ChatID:   chatID,
+		ThreadID: threadID,
+		SenderID: senderID,
+	})
+}
+
+func TestConfirmationGate_Pending(t *testing.T) {
+	var notified *PendingAction
+	gate := NewConfirmationGate(0, func(action *PendingAction) { notified = action })
+	inner := newRecordingTool("exec")
+	tool := gate.Wrap(inner)
+
+	if tool.Name() != "exec" || tool.Description() != "destructive" {
+		t.Errorf("wrapped tool = %s/%s, want the inner tool's name and description", tool.Name(), tool.Description())
+	}
+
+	result := tool.Execute(chatContext("telegram", "42", "7", "alice"), map[string]any{"command": "rm -rf build"})
+
+	if inner.calls != 0 {
+		t.Fatalf("inner tool ran %d times before approval", inner.calls)
+	}
+	if result.IsError || !strings.Contains(result.ForLLM, "/approve confirm-1") {
+		t.Errorf("pending result = %+v, want approval instructions", result)
+	}
+	if notified == nil {
+		t.Fatal("notify was not called")
+	}
+	if notified.ID != "confirm-1" || notified.ToolName != "exec" || notified.ChatID != "42" || notified.ThreadID != "7" ||
+		notified.SenderID != "alice" {
+		t.Errorf("pending action = %+v", notified)
+	}
+}
+
+func TestConfirmationGate_Approved(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	inner := newRecordingTool("write_file")
+	tool := gate.Wrap(inner)
+	tool.Execute(chatContext("telegram", "42", "", "alice"), map[string]any{"path": "a.txt"})
+
+	action, result, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "42", "alice", true)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if action.ToolName != "write_file" {
+		t.Errorf("ToolName = %q, want write_file", action.ToolName)
+	}
+	if inner.calls != 1 || inner.lastArgs["path"] != "a.txt" {
+		t.Errorf("inner tool calls = %d, args = %v", inner.calls, inner.lastArgs)
+	}
+	if inner.channel != "telegram" || inner.chatID != "42" {
+		t.Errorf("inner tool context = %s/%s, want telegram/42", inner.channel, inner.chatID)
+	}
+	if result == nil || result.ForLLM != "ran write_file" {
+		t.Errorf("result = %+v", result)
+	}
+
+	// An action can only be resolved once
+	if _, _, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "42", "alice", true); !errors.Is(err, ErrConfirmationNotFound) {
+		t.Errorf("second Resolve() error = %v, want ErrConfirmationNotFound", err)
+	}
+}
+
+func TestConfirmationGate_Denied(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	inner := newRecordingTool("exec")
+	tool := gate.Wrap(inner)
+	tool.Execute(chatContext("cli", "direct", "", ""), map[string]any{"command": "reboot"})
+
+	action, result, err := gate.Resolve(context.Background(), "confirm-1", "cli", "direct", "", false)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if action == nil || result != nil {
+		t.Errorf("Resolve() = %+v, %+v, want the action and no result", action, result)
+	}
+	if inner.calls != 0 {
+		t.Errorf("inner tool ran %d times after denial", inner.calls)
+	}
+}
+
+func TestConfirmationGate_OtherChatCannotResolve(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	inner := newRecordingTool("exec")
+	tool := gate.Wrap(inner)
+	tool.Execute(chatContext("telegram", "42", "", "alice"), map[string]any{})
+
+	if _, _, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "99", "alice", true); !errors.Is(err, ErrConfirmationNotFound) {
+		t.Errorf("Resolve() from another chat error = %v, want ErrConfirmationNotFound", err)
+	}
+	if inner.calls != 0 {
+		t.Errorf("inner tool ran %d times", inner.calls)
+	}
+}
+
+func TestConfirmationGate_OtherSenderCannotResolve(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	inner := newRecordingTool("exec")
+	gate.Wrap(inner).Execute(chatContext("telegram", "-100", "", "alice"), map[string]any{})
+
+	// Another member of the group cannot approve, and the action stays pending
+	if _, _, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "-100", "mallory", true); !errors.Is(err, ErrConfirmationForbidden) {
+		t.Errorf("Resolve() by another sender error = %v, want ErrConfirmationForbidden", err)
+	}
+	if inner.calls != 0 {
+		t.Errorf("inner tool ran %d times", inner.calls)
+	}
+	if _, _, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "-100", "alice", true); err != nil || inner.calls != 1 {
+		t.Errorf("Resolve() by the requester error = %v, calls = %d", err, inner.calls)
+	}
+}
+
+// TestConfirmationGate_ConcurrentChats verifies that calls from two chats
+// through the same wrapped tool each keep their own chat.
+func TestConfirmationGate_ConcurrentChats(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	tool := gate.Wrap(newRecordingTool("exec"))
+
+	var wg sync.WaitGroup
+	for _, chatID := range []string{"1", "2", "3", "4"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tool.Execute(chatContext("telegram", chatID, "", "user"+chatID), map[string]any{})
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i <= 4; i++ {
+		id := fmt.Sprintf("confirm-%d", i)
+		gate.mu.Lock()
+		action := gate.pending[id]
+		gate.mu.Unlock()
+		if action == nil || action.SenderID != "user"+action.ChatID {
+			t.Errorf("%s = %+v, want the sender of its own chat", id, action)
+		}
+	}
+}
+
+func TestConfirmationGate_Expired(t *testing.T) {
+	gate := NewConfirmationGate(time.Millisecond, nil)
+	inner := newRecordingTool("exec")
+	tool := gate.Wrap(inner)
+	tool.Execute(chatContext("telegram", "42", "", "alice"), map[string]any{})
+
+	time.Sleep(5 * time.Millisecond)
+	if _, _, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "42", "alice", true); !errors.Is(err, ErrConfirmationExpired) {
+		t.Errorf("Resolve() error = %v, want ErrConfirmationExpired", err)
+	}
+	if inner.calls != 0 {
+		t.Errorf("inner tool ran %d times", inner.calls)
+	}
+}
+
+func TestConfirmationGate_NoChatContext(t *testing.T) {
+	gate := NewConfirmationGate(0, nil)
+	inner := newRecordingTool("exec")
+
+	result := gate.Wrap(inner).Execute(context.Background(), map[string]any{})
+	if !result.IsError || result.ErrorKind != ErrorKindPermission {
+		t.Errorf("result = %+v, want a permission error", result)
+	}
+	if inner.calls != 0 {
+		t.Errorf("inner tool ran %d times", inner.calls)
+	}
+}
@@ -23,6 +23,8 @@ type CronTool struct {
 	executor    JobExecutor
 	msgBus      *bus.MessageBus
 	execTool    *ExecTool
+	timezone    string         // configured IANA time zone, empty for local time
+	location    *time.Location // where 'at' times and cron expressions are read
 	channel     string
 	chatID      string
 	threadID    string
@@ -37,12 +39,20 @@ func NewCronTool(
 ) *CronTool {
 	execTool := NewExecToolWithConfig(workspace, restrict, config)
 	execTool.SetTimeout(execTimeout)
-	return &CronTool{
+	t := &CronTool{
 		cronService: cronService,
 		executor:    executor,
 		msgBus:      msgBus,
 		execTool:    execTool,
+		location:    time.Local,
 	}
+	if config != nil && config.Agents.Defaults.Timezone != "" {
+		if loc, err := time.LoadLocation(config.Agents.Defaults.Timezone); err == nil {
+			t.timezone = config.Agents.Defaults.Timezone
+			t.location = loc
+		}
+	}
+	return t
 }
 
 // Name returns the tool name
@@ -52,7 +62,7 @@ func (t *CronTool) Name() string {
 
 // Description returns the tool description
 func (t *CronTool) Description() string {
-	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
+	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600) or 'at' for a fixed time (e.g., 'remind me tomorrow at 9' → at='2026-01-02 09:00'). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
 }
 
 // Parameters returns the tool parameters schema
@@ -77,13 +87,17 @@ func (t *CronTool) Parameters() map[string]any {
 				"type":        "integer",
 				"description": "One-time reminder: seconds from now when to trigger (e.g., 600 for 10 minutes later). Use this for one-time reminders like 'remind me in 10 minutes'.",
 			},
+			"at": map[string]any{
+				"type":        "string",
+				"description": "One-time reminder at a fixed time, as 'YYYY-MM-DD HH:MM' in the user's time zone or RFC 3339 (e.g., '2026-01-02T09:00:00+01:00').",
+			},
 			"every_seconds": map[string]any{
 				"type":        "integer",
 				"description": "Recurring interval in seconds (e.g., 3600 for every hour). Use this ONLY for recurring tasks like 'every 2 hours' or 'daily reminder'.",
 			},
 			"cron_expr": map[string]any{
 				"type":        "string",
-				"description": "Cron expression for complex recurring schedules (e.g., '0 9 * * *' for daily at 9am). Use this for complex recurring schedules.",
+				"description": "Cron expression for complex recurring schedules (e.g., '0 9 * * *' for daily at 9am), in the user's time zone. Use this for complex recurring schedules.",
 			},
 			"job_id": map[string]any{
 				"type":        "string",
@@ -116,7 +130,7 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 
 	switch action {
 	case "add":
-		return t.addJob(args)
+		return t.addJob(ctx, args)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -130,10 +144,9 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 }
 
-func (t *CronTool) addJob(args map[string]any) *ToolResult {
+func (t *CronTool) addJob(ctx context.Context, args map[string]any) *ToolResult {
 	t.mu.RLock()
-	channel := t.channel
-	chatID := t.chatID
+	channel, chatID, threadID := callChat(ctx, t.channel, t.chatID, t.threadID)
 	t.mu.RUnlock()
 
 	if channel == "" || chatID == "" {
@@ -147,18 +160,32 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 
 	var schedule cron.CronSchedule
 
-	// Check for at_seconds (one-time), every_seconds (recurring), or cron_expr
+	// Check for at_seconds or at (one-time), every_seconds (recurring), or cron_expr
 	atSeconds, hasAt := args["at_seconds"].(float64)
+	atTime, _ := args["at"].(string)
 	everySeconds, hasEvery := args["every_seconds"].(float64)
 	cronExpr, hasCron := args["cron_expr"].(string)
 
-	// Priority: at_seconds > every_seconds > cron_expr
+	// Priority: at_seconds > at > every_seconds > cron_expr
 	if hasAt {
 		atMS := time.Now().UnixMilli() + int64(atSeconds)*1000
 		schedule = cron.CronSchedule{
 			Kind: "at",
 			AtMS: &atMS,
 		}
+	} else if atTime != "" {
+		when, err := parseCronTime(atTime, t.location)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if !when.After(time.Now()) {
+			return ErrorResult(fmt.Sprintf("%s is in the past", atTime))
+		}
+		atMS := when.UnixMilli()
+		schedule = cron.CronSchedule{
+			Kind: "at",
+			AtMS: &atMS,
+		}
 	} else if hasEvery {
 		everyMS := int64(everySeconds) * 1000
 		schedule = cron.CronSchedule{
@@ -169,9 +196,10 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		schedule = cron.CronSchedule{
 			Kind: "cron",
 			Expr: cronExpr,
+			TZ:   t.timezone,
 		}
 	} else {
-		return ErrorResult("one of at_seconds, every_seconds, or cron_expr is required")
+		return ErrorResult("one of at_seconds, at, every_seconds, or cron_expr is required")
 	}
 
 	// Read deliver parameter, default to true
@@ -199,7 +227,7 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		deliver,
 		channel,
 		chatID,
-		t.threadID,
+		threadID,
 	)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Error adding job: %v", err))
@@ -211,7 +239,26 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		t.cronService.UpdateJob(job)
 	}
 
-	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s)", job.Name, job.ID))
+	if job.State.NextRunAtMS == nil {
+		return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s)", job.Name, job.ID))
+	}
+	next := time.UnixMilli(*job.State.NextRunAtMS).In(t.location)
+	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s), next run at %s",
+		job.Name, job.ID, next.Format("2006-01-02 15:04 MST")))
+}
+
+// parseCronTime parses an absolute time given as RFC 3339 or as
+// "YYYY-MM-DD HH:MM[:SS]" in loc.
+func parseCronTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q; use 'YYYY-MM-DD HH:MM' or RFC 3339", s)
 }
 
 func (t *CronTool) listJobs() *ToolResult {
@@ -269,8 +316,10 @@ func (t *CronTool) enableJob(args map[string]any, enable bool) *ToolResult {
 	return SilentResult(fmt.Sprintf("Cron job '%s' %s", job.Name, status))
 }
 
-// ExecuteJob executes a cron job through the agent
-func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
+// ExecuteJob executes a cron job through the agent. It returns an error if
+// the job's message could not be processed, so the service retries one-time
+// jobs.
+func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
 	// Get channel/chatID/threadID from job payload
 	channel := job.Payload.Channel
 	chatID := job.Payload.To
@@ -320,11 +369,11 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 				false, // Don't suppress - this is the final output
 			)
 			if err != nil {
-				return fmt.Sprintf("Error: %v", err)
+				return "", err
 			}
 			_ = response
 		}
-		return "ok"
+		return "ok", nil
 	}
 
 	// If deliver=true, send message directly without agent processing
@@ -335,7 +384,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 			ThreadID: threadID,
 			Content:  job.Payload.Message,
 		})
-		return "ok"
+		return "ok", nil
 	}
 
 	// For deliver=false, process through agent (for complex tasks)
@@ -353,10 +402,10 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		true,   // Suppress intermediate output (only send final response)
 	)
 	if err != nil {
-		return fmt.Sprintf("Error: %v", err)
+		return "", err
 	}
 
 	// Response is automatically sent via MessageBus by AgentLoop
 	_ = response // Will be sent by AgentLoop
-	return "ok"
+	return "ok", nil
 }
@@ -73,6 +73,7 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 	if err := editFile(t.fs, path, oldText, newText); err != nil {
 		return ErrorResult(err.Error())
 	}
+	recordFileWrites(ctx, t.fs, path)
 	return SilentResult(fmt.Sprintf("File edited: %s", path))
 }
 
@@ -129,6 +130,7 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]any) *Tool
 	if err := appendFile(t.fs, path, content); err != nil {
 		return ErrorResult(err.Error())
 	}
+	recordFileWrites(ctx, t.fs, path)
 	return SilentResult(fmt.Sprintf("Appended to %s", path))
 }
 
@@ -100,7 +100,7 @@ func (t *ReadFileTool) Name() string {
 }
 
 func (t *ReadFileTool) Description() string {
-	return "Read the contents of a file"
+	return "Read the contents of a file. For large files, pass start_line and end_line to read only a section."
 }
 
 func (t *ReadFileTool) Parameters() map[string]any {
@@ -111,11 +111,24 @@ func (t *ReadFileTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Path to the file to read",
 			},
+			"start_line": map[string]any{
+				"type":        "integer",
+				"description": "First line to read, counting from 1 (default: 1)",
+			},
+			"end_line": map[string]any{
+				"type":        "integer",
+				"description": "Last line to read, inclusive (default: end of file)",
+			},
 		},
 		"required": []string{"path"},
 	}
 }
 
+// ReadOnly reports that the tool never changes state
+func (t *ReadFileTool) ReadOnly() bool {
+	return true
+}
+
 func (t *ReadFileTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	path, ok := args["path"].(string)
 	if !ok {
@@ -126,7 +139,48 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
-	return NewToolResult(string(content))
+
+	start, hasStart := args["start_line"].(float64)
+	end, hasEnd := args["end_line"].(float64)
+	if !hasStart && !hasEnd {
+		return NewToolResult(string(content))
+	}
+	if !hasStart {
+		start = 1
+	}
+	section, err := readLines(string(content), int(start), int(end), hasEnd)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return NewToolResult(section)
+}
+
+// readLines returns lines start to end (1-based, inclusive) of content,
+// preceded by a header giving the range and the total line count so the
+// caller can read on. Without hasEnd, or with end past the last line, it
+// reads to the end of the file.
+func readLines(content string, start, end int, hasEnd bool) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	total := len(lines)
+
+	if start < 1 {
+		return "", fmt.Errorf("start_line must be at least 1")
+	}
+	if start > total {
+		return "", fmt.Errorf("start_line %d is past the end of the file (%d lines)", start, total)
+	}
+	if !hasEnd || end > total {
+		end = total
+	}
+	if end < start {
+		return "", fmt.Errorf("end_line %d is before start_line %d", end, start)
+	}
+
+	header := fmt.Sprintf("[Lines %d-%d of %d]\n", start, end, total)
+	return header + strings.Join(lines[start-1:end], ""), nil
 }
 
 type WriteFileTool struct {
@@ -182,6 +236,7 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]any) *ToolR
 	if err := t.fs.WriteFile(path, []byte(content)); err != nil {
 		return ErrorResult(err.Error())
 	}
+	recordFileWrites(ctx, t.fs, path)
 
 	return SilentResult(fmt.Sprintf("File written: %s", path))
 }
@@ -221,6 +276,11 @@ func (t *ListDirTool) Parameters() map[string]any {
 	}
 }
 
+// ReadOnly reports that the tool never changes state
+func (t *ListDirTool) ReadOnly() bool {
+	return true
+}
+
 func (t *ListDirTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	path, ok := args["path"].(string)
 	if !ok {
@@ -252,6 +312,9 @@ type fileSystem interface {
 	ReadFile(path string) ([]byte, error)
 	WriteFile(path string, data []byte) error
 	ReadDir(path string) ([]os.DirEntry, error)
+	Rename(oldpath, newpath string) error
+	Link(oldpath, newpath string) error
+	Remove(path string) error
 }
 
 // hostFs is an unrestricted fileReadWriter that operates directly on the host filesystem.
@@ -275,6 +338,18 @@ func (h *hostFs) ReadDir(path string) ([]os.DirEntry, error) {
 	return os.ReadDir(path)
 }
 
+func (h *hostFs) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (h *hostFs) Link(oldpath, newpath string) error {
+	return os.Link(oldpath, newpath)
+}
+
+func (h *hostFs) Remove(path string) error {
+	return os.Remove(path)
+}
+
 func (h *hostFs) WriteFile(path string, data []byte) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -382,6 +457,32 @@ func (r *sandboxFs) ReadDir(path string) ([]os.DirEntry, error) {
 	return entries, err
 }
 
+func (r *sandboxFs) Rename(oldpath, newpath string) error {
+	return r.execute(oldpath, func(root *os.Root, relOld string) error {
+		relNew, err := getSafeRelPath(r.workspace, newpath)
+		if err != nil {
+			return err
+		}
+		return root.Rename(relOld, relNew)
+	})
+}
+
+func (r *sandboxFs) Link(oldpath, newpath string) error {
+	return r.execute(oldpath, func(root *os.Root, relOld string) error {
+		relNew, err := getSafeRelPath(r.workspace, newpath)
+		if err != nil {
+			return err
+		}
+		return root.Link(relOld, relNew)
+	})
+}
+
+func (r *sandboxFs) Remove(path string) error {
+	return r.execute(path, func(root *os.Root, relPath string) error {
+		return root.Remove(relPath)
+	})
+}
+
 // Helper to get a safe relative path for os.Root usage
 func getSafeRelPath(workspace, path string) (string, error) {
 	if workspace == "" {
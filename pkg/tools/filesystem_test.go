@@ -82,6 +82,78 @@ func TestFilesystemTool_ReadFile_MissingPath(t *testing.T) {
 	}
 }
 
+// TestFilesystemTool_ReadFile_LineRange verifies reading a section of a file
+func TestFilesystemTool_ReadFile_LineRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "big.txt"), []byte("one\ntwo\nthree\nfour\nfive\n"), 0o644)
+	tool := NewReadFileTool(tmpDir, true)
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{
+			name: "middle",
+			args: map[string]any{"path": "big.txt", "start_line": float64(2), "end_line": float64(3)},
+			want: "[Lines 2-3 of 5]\ntwo\nthree\n",
+		},
+		{
+			name: "start only",
+			args: map[string]any{"path": "big.txt", "start_line": float64(4)},
+			want: "[Lines 4-5 of 5]\nfour\nfive\n",
+		},
+		{
+			name: "end only",
+			args: map[string]any{"path": "big.txt", "end_line": float64(1)},
+			want: "[Lines 1-1 of 5]\none\n",
+		},
+		{
+			name: "end past the last line",
+			args: map[string]any{"path": "big.txt", "start_line": float64(5), "end_line": float64(100)},
+			want: "[Lines 5-5 of 5]\nfive\n",
+		},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if result.IsError || result.ForLLM != tt.want {
+			t.Errorf("%s: got %q (error %v), want %q", tt.name, result.ForLLM, result.IsError, tt.want)
+		}
+	}
+}
+
+// TestFilesystemTool_ReadFile_LineRangeOutOfRange verifies errors for ranges
+// outside the file
+func TestFilesystemTool_ReadFile_LineRangeOutOfRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "small.txt"), []byte("one\ntwo"), 0o644)
+	tool := NewReadFileTool(tmpDir, true)
+
+	tests := []struct {
+		args map[string]any
+		want string
+	}{
+		{
+			args: map[string]any{"path": "small.txt", "start_line": float64(3)},
+			want: "start_line 3 is past the end of the file (2 lines)",
+		},
+		{
+			args: map[string]any{"path": "small.txt", "start_line": float64(0)},
+			want: "start_line must be at least 1",
+		},
+		{
+			args: map[string]any{"path": "small.txt", "start_line": float64(2), "end_line": float64(1)},
+			want: "end_line 1 is before start_line 2",
+		},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if !result.IsError || result.ForLLM != tt.want {
+			t.Errorf("args %v: got %q (error %v), want error %q", tt.args, result.ForLLM, result.IsError, tt.want)
+		}
+	}
+}
+
 // TestFilesystemTool_WriteFile_Success verifies successful file writing
 func TestFilesystemTool_WriteFile_Success(t *testing.T) {
 	tmpDir := t.TempDir()
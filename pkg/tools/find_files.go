@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	defaultFindResults = 50
+	maxFindResults     = 200
+	// Files larger than this are skipped by content search
+	maxFindFileSize = 1 << 20
+	// Matching lines longer than this are cut in the result
+	maxFindLineLength = 200
+)
+
+// FindFilesTool finds files by glob pattern and, optionally, by content.
+type FindFilesTool struct {
+	workspace string
+	restrict  bool
+}
+
+// NewFindFilesTool creates a FindFilesTool. With restrict set, the search
+// cannot leave the workspace.
+func NewFindFilesTool(workspace string, restrict bool) *FindFilesTool {
+	return &FindFilesTool{workspace: workspace, restrict: restrict}
+}
+
+func (t *FindFilesTool) Name() string {
+	return "find_files"
+}
+
+func (t *FindFilesTool) Description() string {
+	return "Find files by name pattern, optionally only those whose content matches a regular expression. " +
+		"Returns matching paths, or matching lines as path:line: text when content is given."
+}
+
+func (t *FindFilesTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"pattern": map[string]any{
+				"type": "string",
+				"description": "Glob pattern, e.g. \"*.md\" to match file names anywhere, or \"notes/**/*.txt\" " +
+					"to match paths relative to the search directory (** matches any number of directories)",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Directory to search (default: the workspace)",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "Optional regular expression that file content must match, e.g. \"(?i)todo\"",
+			},
+			"max_results": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of results (default %d, max %d)", defaultFindResults, maxFindResults),
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+// ReadOnly reports that the tool never changes state
+func (t *FindFilesTool) ReadOnly() bool {
+	return true
+}
+
+func (t *FindFilesTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	pattern, _ := args["pattern"].(string)
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return ErrorResult("pattern is required")
+	}
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+	}
+
+	var contentRe *regexp.Regexp
+	if content, _ := args["content"].(string); content != "" {
+		re, err := regexp.Compile(content)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid content expression: %v", err))
+		}
+		contentRe = re
+	}
+
+	limit := defaultFindResults
+	if n, ok := args["max_results"].(float64); ok && n > 0 {
+		limit = min(int(n), maxFindResults)
+	}
+
+	dir, _ := args["path"].(string)
+	fsys, start, display, closeFS, err := t.open(dir)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	defer closeFS()
+
+	var results []string
+	err = fs.WalkDir(fsys, start, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == start {
+				return err
+			}
+			return nil // unreadable entries are skipped
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && p != start {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !matchGlob(pattern, relTo(start, p)) {
+			return nil
+		}
+
+		if contentRe == nil {
+			results = append(results, display(p))
+		} else {
+			for _, line := range grepFile(fsys, d, p, contentRe) {
+				results = append(results, display(p)+":"+line)
+			}
+		}
+		// One result past the limit tells that there are more
+		if len(results) > limit {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to search files: %v", err))
+	}
+
+	if len(results) == 0 {
+		return NewToolResult("No matching files found")
+	}
+	truncated := len(results) > limit
+	if truncated {
+		results = results[:limit]
+	}
+	out := strings.Join(results, "\n")
+	if truncated {
+		out += fmt.Sprintf("\n(showing the first %d results; narrow the pattern to see more)", limit)
+	}
+	return NewToolResult(out)
+}
+
+// open returns the filesystem to walk, the directory to start at, how to
+// print a walked path, and a function releasing the filesystem. Restricted
+// searches go through os.Root, so symlinks cannot lead out of the workspace.
+func (t *FindFilesTool) open(dir string) (fs.FS, string, func(string) string, func(), error) {
+	if t.restrict {
+		if dir == "" {
+			dir = "."
+		}
+		rel, err := getSafeRelPath(t.workspace, dir)
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+		root, err := os.OpenRoot(t.workspace)
+		if err != nil {
+			return nil, "", nil, nil, fmt.Errorf("failed to open workspace: %w", err)
+		}
+		// Paths relative to the workspace work with the other file tools
+		display := func(p string) string { return filepath.FromSlash(p) }
+		return root.FS(), filepath.ToSlash(rel), display, func() { root.Close() }, nil
+	}
+
+	if dir == "" {
+		dir = t.workspace
+	}
+	if dir == "" {
+		dir = "."
+	}
+	display := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+	return os.DirFS(dir), ".", display, func() {}, nil
+}
+
+// relTo returns walked path p relative to the search directory start.
+func relTo(start, p string) string {
+	if start == "." {
+		return p
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, start), "/")
+}
+
+// matchGlob reports whether the slash-separated path name matches pattern.
+// A pattern without a slash matches the base name in any directory; "**"
+// matches zero or more directories.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// grepFile returns the lines of file p that match re, as "N: text". Large
+// and binary files are skipped.
+func grepFile(fsys fs.FS, d fs.DirEntry, p string, re *regexp.Regexp) []string {
+	info, err := d.Info()
+	if err != nil || info.Size() > maxFindFileSize {
+		return nil
+	}
+	data, err := fs.ReadFile(fsys, p)
+	if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil
+	}
+
+	var matches []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !re.MatchString(line) {
+			continue
+		}
+		matches = append(matches, fmt.Sprintf("%d: %s", i+1, utils.Truncate(line, maxFindLineLength)))
+	}
+	return matches
+}
@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// findFilesWorkspace creates a workspace with a few nested files.
+func findFilesWorkspace(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md":              "# Project\nTODO: write docs\n",
+		"notes/today.md":         "buy milk\ntodo: call Bob\n",
+		"notes/archive/2025.txt": "old notes\n",
+		"src/main.go":            "package main\n\n// TODO: handle errors\nfunc main() {}\n",
+		".git/HEAD.md":           "TODO: ignored\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFindFilesTool_Glob(t *testing.T) {
+	dir := findFilesWorkspace(t)
+	tool := NewFindFilesTool(dir, true)
+
+	tests := []struct {
+		pattern string
+		path    string
+		want    []string
+	}{
+		{pattern: "*.md", want: []string{"README.md", filepath.Join("notes", "today.md")}},
+		{pattern: "notes/**/*.txt", want: []string{filepath.Join("notes", "archive", "2025.txt")}},
+		{pattern: "**/*.go", want: []string{filepath.Join("src", "main.go")}},
+		{pattern: "*.md", path: "notes", want: []string{filepath.Join("notes", "today.md")}},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), map[string]any{"pattern": tt.pattern, "path": tt.path})
+		if result.IsError {
+			t.Fatalf("pattern %q: %s", tt.pattern, result.ForLLM)
+		}
+		if got := strings.Split(result.ForLLM, "\n"); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("pattern %q in %q = %q, want %q", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindFilesTool_Content(t *testing.T) {
+	dir := findFilesWorkspace(t)
+	tool := NewFindFilesTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": "*", "content": "(?i)todo"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	want := "README.md:2: TODO: write docs\n" +
+		filepath.Join("notes", "today.md") + ":2: todo: call Bob\n" +
+		filepath.Join("src", "main.go") + ":3: // TODO: handle errors"
+	if result.ForLLM != want {
+		t.Errorf("result =\n%s\nwant\n%s", result.ForLLM, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"pattern": "*", "content": "nothing like this"})
+	if result.ForLLM != "No matching files found" {
+		t.Errorf("no match result = %q", result.ForLLM)
+	}
+}
+
+func TestFindFilesTool_MaxResults(t *testing.T) {
+	dir := findFilesWorkspace(t)
+	tool := NewFindFilesTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": "*", "max_results": float64(2)})
+	lines := strings.Split(result.ForLLM, "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "showing the first 2 results") {
+		t.Errorf("result = %q, want 2 paths and a truncation note", result.ForLLM)
+	}
+}
+
+func TestFindFilesTool_RestrictToWorkspace(t *testing.T) {
+	dir := findFilesWorkspace(t)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.md"), []byte("TODO"), 0o644)
+
+	tool := NewFindFilesTool(dir, true)
+	for _, path := range []string{outside, "../"} {
+		result := tool.Execute(context.Background(), map[string]any{"pattern": "*.md", "path": path})
+		if !result.IsError {
+			t.Errorf("search in %q should be denied, got %q", path, result.ForLLM)
+		}
+	}
+
+	// A symlink out of the workspace is not followed
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err == nil {
+		result := tool.Execute(context.Background(), map[string]any{"pattern": "secret.md"})
+		if result.ForLLM != "No matching files found" {
+			t.Errorf("symlinked search = %q, want no matches", result.ForLLM)
+		}
+	}
+
+	unrestricted := NewFindFilesTool(dir, false)
+	result := unrestricted.Execute(context.Background(), map[string]any{"pattern": "*.md", "path": outside})
+	if result.ForLLM != filepath.Join(outside, "secret.md") {
+		t.Errorf("unrestricted search = %q", result.ForLLM)
+	}
+}
+
+func TestFindFilesTool_InvalidArgs(t *testing.T) {
+	tool := NewFindFilesTool(t.TempDir(), true)
+	for _, args := range []map[string]any{
+		{},
+		{"pattern": "[a-"},
+		{"pattern": "*", "content": "(unclosed"},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("args %v should fail, got %q", args, result.ForLLM)
+		}
+	}
+}
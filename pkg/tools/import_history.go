@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryBackfiller stores a session's existing history in long-term memory.
+type MemoryBackfiller interface {
+	BackfillMemory(ctx context.Context, key string) (int, error)
+}
+
+// ImportHistoryTool stores the current session's earlier messages in
+// long-term memory, for chats that had history before memory was enabled.
+type ImportHistoryTool struct {
+	sessions   MemoryBackfiller
+	sessionKey string
+	mu         sync.RWMutex
+}
+
+// NewImportHistoryTool creates a tool that backfills memory from sessions.
+func NewImportHistoryTool(sessions MemoryBackfiller) *ImportHistoryTool {
+	return &ImportHistoryTool{sessions: sessions}
+}
+
+func (t *ImportHistoryTool) Name() string {
+	return "import_history"
+}
+
+func (t *ImportHistoryTool) Description() string {
+	return "Store the earlier messages of this conversation in long-term memory so they can be found with qdrant_search_memory. " +
+		"Use it when the user asks to remember the existing history, e.g. after enabling memory. " +
+		"Running it again replaces the stored copy instead of duplicating it."
+}
+
+func (t *ImportHistoryTool) Parameters() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+}
+
+// SetSessionKey sets the session to import.
+func (t *ImportHistoryTool) SetSessionKey(sessionKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionKey = sessionKey
+}
+
+func (t *ImportHistoryTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	t.mu.RLock()
+	sessionKey := callSessionKey(ctx, t.sessionKey)
+	t.mu.RUnlock()
+
+	if t.sessions == nil {
+		return InternalError("long-term memory is not available")
+	}
+	if sessionKey == "" {
+		return ErrorResult("No current session")
+	}
+
+	n, err := t.sessions.BackfillMemory(ctx, sessionKey)
+	if err != nil {
+		return ExternalError(fmt.Sprintf("failed to import history: %v", err)).WithError(err)
+	}
+	if n == 0 {
+		return NewToolResult("There are no earlier messages to import.")
+	}
+	return NewToolResult(fmt.Sprintf("Imported %d messages from this conversation into long-term memory.", n))
+}
@@ -3,20 +3,22 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 type SendCallback func(channel, chatID, content, threadID string) error
 
 type MessageTool struct {
-	sendCallback   SendCallback
-	defaultChannel string
-	defaultChatID  string
+	sendCallback    SendCallback
+	mu              sync.Mutex
+	defaultChannel  string
+	defaultChatID   string
 	defaultThreadID string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sentInRound     map[string]bool // sessions the tool sent from in their current processing round
 }
 
 func NewMessageTool() *MessageTool {
-	return &MessageTool{}
+	return &MessageTool{sentInRound: make(map[string]bool)}
 }
 
 func (t *MessageTool) Name() string {
@@ -35,6 +37,11 @@ func (t *MessageTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "The message content to send",
 			},
+			"more_content": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Optional: further messages to send after content, each as a separate message, in order (e.g. one option per message)",
+			},
 			"channel": map[string]any{
 				"type":        "string",
 				"description": "Optional: target channel (telegram, whatsapp, etc.)",
@@ -53,15 +60,45 @@ func (t *MessageTool) Parameters() map[string]any {
 }
 
 func (t *MessageTool) SetContext(channel, chatID, threadID string) {
+	t.mu.Lock()
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
 	t.defaultThreadID = threadID
-	t.sentInRound = false // Reset send tracking for new processing round
+	t.mu.Unlock()
+	t.ResetRound(roundKey(channel, chatID)) // Reset send tracking for new processing round
+}
+
+// roundKey identifies the round of calls that carry no session: that of
+// their chat.
+func roundKey(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+// ResetRound starts a new processing round for the session: messages sent
+// before no longer count for HasSentInRound. Sessions of one chat, e.g.
+// per-user sessions in a group, have rounds of their own.
+func (t *MessageTool) ResetRound(sessionKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sentInRound, sessionKey)
+}
+
+// HasSentInRound returns true if the message tool sent a message during the
+// current round of the session, from a call made for that session.
+func (t *MessageTool) HasSentInRound(sessionKey string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sentInRound[sessionKey]
 }
 
-// HasSentInRound returns true if message tool sent a message during current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+// markSent records that a call for the session sent a message.
+func (t *MessageTool) markSent(sessionKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sentInRound == nil {
+		t.sentInRound = make(map[string]bool)
+	}
+	t.sentInRound[sessionKey] = true
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
@@ -78,14 +115,20 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 	chatID, _ := args["chat_id"].(string)
 	threadID, _ := args["thread_id"].(string)
 
+	t.mu.Lock()
+	originChannel, originChatID, originThreadID := callChat(ctx, t.defaultChannel, t.defaultChatID, t.defaultThreadID)
+	t.mu.Unlock()
+	round := callSessionKey(ctx, roundKey(originChannel, originChatID))
+
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = originChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = originChatID
 	}
-	if threadID == "" {
-		threadID = t.defaultThreadID
+	// The current thread only applies to the current chat
+	if threadID == "" && channel == originChannel && chatID == originChatID {
+		threadID = originThreadID
 	}
 
 	if channel == "" || chatID == "" {
@@ -96,16 +139,41 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content, threadID); err != nil {
-		return &ToolResult{
-			ForLLM: fmt.Sprintf("sending message: %v", err),
-			IsError: true,
-			Err:     err,
+	messages := []string{content}
+	if more, ok := args["more_content"].([]any); ok {
+		for _, m := range more {
+			if text, ok := m.(string); ok && text != "" {
+				messages = append(messages, text)
+			}
+		}
+	}
+
+	for i, message := range messages {
+		if err := t.sendCallback(channel, chatID, message, threadID); err != nil {
+			if i > 0 {
+				t.markSent(round)
+				return &ToolResult{
+					ForLLM:  fmt.Sprintf("sending message %d of %d (%d already sent): %v", i+1, len(messages), i, err),
+					IsError: true,
+					Err:     err,
+				}
+			}
+			return &ToolResult{
+				ForLLM: fmt.Sprintf("sending message: %v", err),
+				IsError: true,
+				Err:     err,
+			}
 		}
 	}
 
-	t.sentInRound = true
+	t.markSent(round)
 	// Silent: user already received message directly
+	if len(messages) > 1 {
+		return &ToolResult{
+			ForLLM: fmt.Sprintf("%d messages sent to %s:%s (thread: %s)", len(messages), channel, chatID, threadID),
+			Silent: true,
+		}
+	}
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s (thread: %s)", channel, chatID, threadID),
 		Silent: true,
@@ -94,6 +94,37 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	}
 }
 
+func TestMessageTool_Execute_DefaultThread(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42", "7")
+
+	var sentThreadID string
+	tool.SetSendCallback(func(channel, chatID, content, threadID string) error {
+		sentThreadID = threadID
+		return nil
+	})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{"current chat", map[string]any{"content": "hi"}, "7"},
+		{"current chat named", map[string]any{"content": "hi", "channel": "telegram", "chat_id": "42"}, "7"},
+		{"explicit thread", map[string]any{"content": "hi", "thread_id": "9"}, "9"},
+		{"other chat", map[string]any{"content": "hi", "chat_id": "43"}, ""},
+	}
+	for _, tt := range tests {
+		sentThreadID = "unset"
+		if result := tool.Execute(context.Background(), tt.args); result.IsError {
+			t.Fatalf("%s: %s", tt.name, result.ForLLM)
+		}
+		if sentThreadID != tt.want {
+			t.Errorf("%s: thread = %q, want %q", tt.name, sentThreadID, tt.want)
+		}
+	}
+}
+
 func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool := NewMessageTool()
 	tool.SetContext("test-channel", "test-chat-id", "")
@@ -257,3 +288,125 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_MultipleMessages(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42", "7")
+
+	var sent []string
+	tool.SetSendCallback(func(channel, chatID, content, threadID string) error {
+		sent = append(sent, channel+"/"+chatID+"/"+threadID+": "+content)
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"content":      "Pick one:",
+		"more_content": []any{"Option A", "", "Option B"},
+	})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+
+	want := []string{"telegram/42/7: Pick one:", "telegram/42/7: Option A", "telegram/42/7: Option B"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %d messages, want %d: %v", len(sent), len(want), sent)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, sent[i], want[i])
+		}
+	}
+	if !result.Silent || result.ForLLM != "3 messages sent to telegram:42 (thread: 7)" {
+		t.Errorf("result = %+v", result)
+	}
+	if !tool.HasSentInRound(roundKey("telegram", "42")) {
+		t.Error("HasSentInRound() = false after sending")
+	}
+}
+
+func TestMessageTool_Execute_MultipleMessagesPartialFailure(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42", "")
+
+	calls := 0
+	tool.SetSendCallback(func(channel, chatID, content, threadID string) error {
+		calls++
+		if calls == 2 {
+			return errors.New("rate limited")
+		}
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"content":      "first",
+		"more_content": []any{"second", "third"},
+	})
+	if !result.IsError || calls != 2 {
+		t.Fatalf("result = %+v after %d calls, want an error after the second", result, calls)
+	}
+	if result.ForLLM != "sending message 2 of 3 (1 already sent): rate limited" {
+		t.Errorf("ForLLM = %q", result.ForLLM)
+	}
+	// The first message reached the user, so the final reply must not repeat it
+	if !tool.HasSentInRound(roundKey("telegram", "42")) {
+		t.Error("HasSentInRound() = false after a partial send")
+	}
+}
+
+func TestMessageTool_Execute_CallContext(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42", "7")
+
+	var sent []string
+	tool.SetSendCallback(func(channel, chatID, content, threadID string) error {
+		sent = append(sent, channel+"/"+chatID+"/"+threadID+": "+content)
+		return nil
+	})
+
+	ctx := WithCallContext(context.Background(), CallContext{Channel: "discord", ChatID: "9"})
+	result := tool.Execute(ctx, map[string]any{"content": "hi"})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+
+	// The chat of the call wins over the one last set with SetContext
+	if len(sent) != 1 || sent[0] != "discord/9/: hi" {
+		t.Errorf("sent = %v, want the message in discord/9", sent)
+	}
+	if !tool.HasSentInRound(roundKey("discord", "9")) {
+		t.Error("HasSentInRound(discord, 9) = false after sending")
+	}
+	if tool.HasSentInRound(roundKey("telegram", "42")) {
+		t.Error("HasSentInRound(telegram, 42) = true, but nothing was sent for that chat")
+	}
+	tool.ResetRound(roundKey("discord", "9"))
+	if tool.HasSentInRound(roundKey("discord", "9")) {
+		t.Error("HasSentInRound() = true after ResetRound")
+	}
+}
+
+func TestMessageTool_Execute_SessionsOfOneChat(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content, threadID string) error { return nil })
+
+	// Two users of a group chat, each in a session of their own
+	alice := WithCallContext(context.Background(), CallContext{Channel: "telegram", ChatID: "-100", SessionKey: "agent:main:alice"})
+	tool.ResetRound("agent:main:alice")
+	tool.ResetRound("agent:main:bob")
+	if result := tool.Execute(alice, map[string]any{"content": "hi"}); result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+
+	if !tool.HasSentInRound("agent:main:alice") {
+		t.Error("HasSentInRound(alice) = false after sending")
+	}
+	if tool.HasSentInRound("agent:main:bob") {
+		t.Error("HasSentInRound(bob) = true, but only alice's session sent")
+	}
+
+	// A new round of bob's session does not reset alice's
+	tool.ResetRound("agent:main:bob")
+	if !tool.HasSentInRound("agent:main:alice") {
+		t.Error("HasSentInRound(alice) = false after bob's session started a round")
+	}
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxParallelSubagentTasks caps the tasks of one parallel_subagents call.
+const maxParallelSubagentTasks = 10
+
+// ParallelSubagentsTool runs several subagents concurrently, waits for all of
+// them and returns their results together. Runs share the manager's
+// concurrency limit, so tasks beyond it wait for a free slot.
+type ParallelSubagentsTool struct {
+	manager       *SubagentManager
+	originChannel string
+	originChatID  string
+}
+
+func NewParallelSubagentsTool(manager *SubagentManager) *ParallelSubagentsTool {
+	return &ParallelSubagentsTool{
+		manager:       manager,
+		originChannel: "cli",
+		originChatID:  "direct",
+	}
+}
+
+func (t *ParallelSubagentsTool) Name() string {
+	return "parallel_subagents"
+}
+
+func (t *ParallelSubagentsTool) Description() string {
+	return "Run several independent tasks at once, each in its own subagent, and wait for all of them. Returns every task's result; a failed task does not stop the others. Use this to split work that has no dependencies between the parts."
+}
+
+func (t *ParallelSubagentsTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"tasks": map[string]any{
+				"type":        "array",
+				"description": fmt.Sprintf("Task descriptions, one per subagent (at most %d)", maxParallelSubagentTasks),
+				"items": map[string]any{
+					"type": "string",
+				},
+			},
+		},
+		"required": []string{"tasks"},
+	}
+}
+
+func (t *ParallelSubagentsTool) SetContext(channel, chatID, threadID string) {
+	t.originChannel = channel
+	t.originChatID = chatID
+}
+
+// parallelTaskResult is the outcome of one task of a parallel run.
+type parallelTaskResult struct {
+	status     string
+	iterations int
+	content    string
+	err        error
+}
+
+func (r parallelTaskResult) succeeded() bool {
+	return r.err == nil && (r.status == "completed" || r.status == "truncated")
+}
+
+func (t *ParallelSubagentsTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if t.manager == nil {
+		return InternalError("Subagent manager not configured")
+	}
+
+	tasks, err := parseParallelTasks(args["tasks"])
+	if err != nil {
+		return ValidationError(err.Error())
+	}
+
+	channel, chatID, _ := callChat(ctx, t.originChannel, t.originChatID, "")
+	results := make([]parallelTaskResult, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task string) {
+			defer wg.Done()
+			loopResult, err := t.manager.runSync(ctx, task, channel, chatID, nil)
+			if err != nil {
+				results[i] = parallelTaskResult{status: "failed", err: err}
+				return
+			}
+			results[i] = parallelTaskResult{
+				status:     subagentStatus(loopResult.TerminationReason),
+				iterations: loopResult.Iterations,
+				content:    loopResult.Content,
+			}
+		}(i, task)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, r := range results {
+		if r.succeeded() {
+			succeeded++
+		}
+	}
+	summary := fmt.Sprintf("%d of %d subagent tasks succeeded", succeeded, len(tasks))
+
+	var sb strings.Builder
+	sb.WriteString(summary + ".\n")
+	for i, r := range results {
+		fmt.Fprintf(&sb, "\n### Task %d: %s\nStatus: %s\n", i+1, tasks[i], r.status)
+		if r.err != nil {
+			fmt.Fprintf(&sb, "Error: %v\n", r.err)
+			continue
+		}
+		fmt.Fprintf(&sb, "Iterations: %d\nResult: %s\n", r.iterations, r.content)
+	}
+
+	if succeeded == 0 {
+		return ExternalError(sb.String())
+	}
+	return &ToolResult{
+		ForLLM:  sb.String(),
+		ForUser: summary,
+	}
+}
+
+// parseParallelTasks validates the tasks argument.
+func parseParallelTasks(raw any) ([]string, error) {
+	var items []any
+	switch v := raw.(type) {
+	case []any:
+		items = v
+	case []string:
+		for _, s := range v {
+			items = append(items, s)
+		}
+	default:
+		return nil, fmt.Errorf("tasks is required and must be an array of strings")
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("tasks must not be empty")
+	}
+	if len(items) > maxParallelSubagentTasks {
+		return nil, fmt.Errorf("at most %d tasks can run in parallel, got %d", maxParallelSubagentTasks, len(items))
+	}
+
+	tasks := make([]string, 0, len(items))
+	for i, item := range items {
+		task, ok := item.(string)
+		if !ok || strings.TrimSpace(task) == "" {
+			return nil, fmt.Errorf("tasks[%d] must be a non-empty string", i)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
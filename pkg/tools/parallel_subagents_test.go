@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// parallelLLMProvider answers each task with its text, fails tasks that
+// mention "fail", and records how many calls overlap.
+type parallelLLMProvider struct {
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (p *parallelLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.maxSeen {
+		p.maxSeen = p.active
+	}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active--
+		p.mu.Unlock()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	task := messages[len(messages)-1].Content
+	if strings.Contains(task, "fail") {
+		return nil, errors.New("status 401: invalid api key")
+	}
+	return &providers.LLMResponse{Content: "done: " + task}, nil
+}
+
+func (p *parallelLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestParallelSubagentsTool_PartialFailure(t *testing.T) {
+	provider := &parallelLLMProvider{}
+	manager := NewSubagentManager(provider, "test-model", "/tmp/test", nil, nil)
+	manager.SetMaxConcurrent(2)
+	tool := NewParallelSubagentsTool(manager)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"tasks": []any{"alpha", "beta", "please fail", "gamma"},
+	})
+	if result.IsError {
+		t.Fatalf("partial failure should not be an error: %s", result.ForLLM)
+	}
+	for _, want := range []string{
+		"3 of 4 subagent tasks succeeded",
+		"### Task 1: alpha\nStatus: completed",
+		"Result: done: beta",
+		"### Task 3: please fail\nStatus: failed\nError:",
+		"Result: done: gamma",
+	} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("result missing %q:\n%s", want, result.ForLLM)
+		}
+	}
+	if result.ForUser != "3 of 4 subagent tasks succeeded" {
+		t.Errorf("ForUser = %q", result.ForUser)
+	}
+	if provider.maxSeen > 2 {
+		t.Errorf("%d subagents ran at once, limit is 2", provider.maxSeen)
+	}
+	if provider.maxSeen < 2 {
+		t.Errorf("subagents did not run concurrently (max %d at once)", provider.maxSeen)
+	}
+}
+
+func TestParallelSubagentsTool_AllFail(t *testing.T) {
+	tool := NewParallelSubagentsTool(NewSubagentManager(&parallelLLMProvider{}, "test-model", "/tmp/test", nil, nil))
+
+	result := tool.Execute(context.Background(), map[string]any{"tasks": []any{"fail one", "fail two"}})
+	if !result.IsError {
+		t.Fatalf("expected an error when every task fails: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "0 of 2 subagent tasks succeeded") {
+		t.Errorf("unexpected result:\n%s", result.ForLLM)
+	}
+}
+
+func TestParallelSubagentsTool_InvalidTasks(t *testing.T) {
+	tool := NewParallelSubagentsTool(NewSubagentManager(&MockLLMProvider{}, "test-model", "/tmp/test", nil, nil))
+
+	many := make([]any, maxParallelSubagentTasks+1)
+	for i := range many {
+		many[i] = "task"
+	}
+	for name, args := range map[string]map[string]any{
+		"missing":   {},
+		"empty":     {"tasks": []any{}},
+		"not text":  {"tasks": []any{"ok", 3}},
+		"blank":     {"tasks": []any{"ok", "  "}},
+		"too many":  {"tasks": many},
+		"not array": {"tasks": "one task"},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("%s: expected a validation error, got %s", name, result.ForLLM)
+		}
+	}
+}
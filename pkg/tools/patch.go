@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ApplyPatchTool edits a file by applying a unified diff. Unlike edit_file it
+// changes several places in one call, and every hunk is checked against the
+// file before anything is written.
+type ApplyPatchTool struct {
+	fs fileSystem
+}
+
+// NewApplyPatchTool creates a new ApplyPatchTool with optional directory restriction.
+func NewApplyPatchTool(workspace string, restrict bool) *ApplyPatchTool {
+	var fs fileSystem
+	if restrict {
+		fs = &sandboxFs{workspace: workspace}
+	} else {
+		fs = &hostFs{}
+	}
+	return &ApplyPatchTool{fs: fs}
+}
+
+func (t *ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t *ApplyPatchTool) Description() string {
+	return "Apply a unified diff (as produced by diff -u or git diff) to a file. " +
+		"Use it for edits in several places; each hunk needs a few lines of unchanged context. " +
+		"Nothing is written unless every hunk matches."
+}
+
+func (t *ApplyPatchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "The file to patch; file names in the diff headers are ignored",
+			},
+			"patch": map[string]any{
+				"type":        "string",
+				"description": "Unified diff with one or more @@ hunks for this file",
+			},
+		},
+		"required": []string{"path", "patch"},
+	}
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	path, ok := args["path"].(string)
+	if !ok {
+		return ErrorResult("path is required")
+	}
+
+	patch, ok := args["patch"].(string)
+	if !ok {
+		return ErrorResult("patch is required")
+	}
+
+	hunks, err := applyPatchFile(t.fs, path, patch)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	recordFileWrites(ctx, t.fs, path)
+	return SilentResult(fmt.Sprintf("Patched %s (%d hunks)", path, hunks))
+}
+
+// applyPatchFile applies patch to the file at path and returns the number
+// of hunks applied. A missing file is patched as empty, so a diff against
+// /dev/null creates it.
+func applyPatchFile(sysFs fileSystem, path, patch string) (int, error) {
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := sysFs.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+
+	patched, err := applyHunks(string(content), hunks)
+	if err != nil {
+		return 0, err
+	}
+	return len(hunks), sysFs.WriteFile(path, []byte(patched))
+}
+
+// diffHunk is one @@ section of a unified diff.
+type diffHunk struct {
+	header   string
+	oldStart int      // 1-based line the hunk starts at in the original file
+	oldLines []string // context and removed lines
+	newLines []string // context and added lines
+	// noEOL records "\ No newline at end of file" markers for either side
+	oldNoEOL, newNoEOL bool
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseUnifiedDiff splits patch into hunks. File headers and git metadata
+// before the first hunk are skipped. Line counts in hunk headers are not
+// trusted; a hunk runs until the next header or the end of the patch.
+func parseUnifiedDiff(patch string) ([]diffHunk, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	// A trailing newline is not an empty context line
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var hunks []diffHunk
+	var cur *diffHunk
+	last := byte(0) // kind of the previous hunk line, for "\ No newline" markers
+	for i, line := range lines {
+		if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, diffHunk{header: m[0], oldStart: start})
+			cur = &hunks[len(hunks)-1]
+			continue
+		}
+		if cur == nil {
+			continue // headers before the first hunk
+		}
+		if strings.HasPrefix(line, "diff ") ||
+			strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("patch changes more than one file; send one patch per file")
+		}
+
+		kind, text := byte(' '), ""
+		if line != "" {
+			// Some writers drop the space of empty context lines
+			kind, text = line[0], line[1:]
+		}
+		switch kind {
+		case ' ':
+			cur.oldLines = append(cur.oldLines, text)
+			cur.newLines = append(cur.newLines, text)
+		case '-':
+			cur.oldLines = append(cur.oldLines, text)
+		case '+':
+			cur.newLines = append(cur.newLines, text)
+		case '\\':
+			if last != '+' {
+				cur.oldNoEOL = true
+			}
+			if last != '-' {
+				cur.newNoEOL = true
+			}
+		default:
+			return nil, fmt.Errorf("%s: line %q does not start with ' ', '-' or '+'", cur.header, line)
+		}
+		last = kind
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no @@ hunks")
+	}
+	return hunks, nil
+}
+
+// applyHunks applies hunks in order to content. Each hunk is looked for at
+// the line its header names, shifted by the lines earlier hunks added or
+// removed; if it is not there, the closest match after the previous hunk is
+// used, so slightly wrong line numbers still apply.
+func applyHunks(content string, hunks []diffHunk) (string, error) {
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	var out []string
+	next := 0   // first line of lines not yet copied to out
+	offset := 0 // lines added minus lines removed so far
+	for i, h := range hunks {
+		want := h.oldStart - 1 + offset
+		if len(h.oldLines) == 0 {
+			want = h.oldStart + offset // pure insertions name the line before
+		}
+		pos := findHunk(lines, h.oldLines, next, want)
+		if pos < 0 {
+			return "", hunkMismatch(i+1, h, lines, max(want, next))
+		}
+
+		out = append(out, lines[next:pos]...)
+		out = append(out, h.newLines...)
+		next = pos + len(h.oldLines)
+		offset += len(h.newLines) - len(h.oldLines)
+
+		if next == len(lines) {
+			if h.newNoEOL {
+				trailingNewline = false
+			} else if h.oldNoEOL {
+				trailingNewline = true
+			}
+		}
+	}
+	out = append(out, lines[next:]...)
+
+	result := strings.Join(out, "\n")
+	if trailingNewline && len(out) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findHunk returns the position at or after from where old matches lines,
+// choosing the one closest to want, or -1 if there is none.
+func findHunk(lines, old []string, from, want int) int {
+	best := -1
+	for pos := from; pos+len(old) <= len(lines); pos++ {
+		if !linesMatch(lines[pos:pos+len(old)], old) {
+			continue
+		}
+		if best < 0 || absInt(pos-want) < absInt(best-want) {
+			best = pos
+		}
+	}
+	return best
+}
+
+func linesMatch(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// hunkMismatch describes where hunk n stopped matching the file when placed
+// at pos, so the caller can re-read the file and fix the patch.
+func hunkMismatch(n int, h diffHunk, lines []string, pos int) error {
+	for i, want := range h.oldLines {
+		line := pos + i
+		if line >= len(lines) {
+			return fmt.Errorf("hunk %d (%s) does not match the file: expected line %d to be %q, found end of file (%d lines)",
+				n, h.header, line+1, want, len(lines))
+		}
+		if lines[line] != want {
+			return fmt.Errorf("hunk %d (%s) does not match the file: expected line %d to be %q, found %q",
+				n, h.header, line+1, want, lines[line])
+		}
+	}
+	return fmt.Errorf("hunk %d (%s) overlaps an earlier hunk", n, h.header)
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const patchOriginal = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+
+func helper() int {
+	return 1
+}
+`
+
+func TestApplyPatchTool_MultipleHunks(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte(patchOriginal), 0o644)
+	tool := NewApplyPatchTool(tmpDir, true)
+
+	// The second hunk's line number is off by one; it still applies
+	patch := `--- a/main.go
++++ b/main.go
+@@ -1,6 +1,7 @@
+ package main
+ 
+-import "fmt"
++import (
++	"fmt"
++)
+ 
+ func main() {
+ 	fmt.Println("hello")
+@@ -10,3 +11,3 @@
+ func helper() int {
+-	return 1
++	return 2
+ }
+`
+	result := tool.Execute(context.Background(), map[string]any{"path": "main.go", "patch": patch})
+	if result.IsError {
+		t.Fatalf("apply failed: %s", result.ForLLM)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(tmpDir, "main.go"))
+	want := strings.NewReplacer(`import "fmt"`, "import (\n\t\"fmt\"\n)", "return 1", "return 2").Replace(patchOriginal)
+	if string(got) != want {
+		t.Errorf("patched file =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestApplyPatchTool_HunkMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "main.go")
+	os.WriteFile(path, []byte(patchOriginal), 0o644)
+	tool := NewApplyPatchTool(tmpDir, true)
+
+	patch := `@@ -1,3 +1,3 @@
+ package main
+ 
+-import "fmt"
++import "log"
+@@ -9,3 +9,3 @@
+ func helper() int {
+-	return 42
++	return 2
+ }
+`
+	result := tool.Execute(context.Background(), map[string]any{"path": "main.go", "patch": patch})
+	if !result.IsError {
+		t.Fatal("expected a non-matching hunk to fail")
+	}
+	want := `hunk 2 (@@ -9,3 +9,3 @@) does not match the file: expected line 10 to be "\treturn 42", found "\treturn 1"`
+	if result.ForLLM != want {
+		t.Errorf("error = %q, want %q", result.ForLLM, want)
+	}
+
+	// The first hunk matched, but nothing is written unless all do
+	if got, _ := os.ReadFile(path); string(got) != patchOriginal {
+		t.Errorf("file changed despite the failed patch:\n%s", got)
+	}
+}
+
+func TestApplyPatchTool_NewFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	tool := NewApplyPatchTool(tmpDir, true)
+
+	patch := "--- /dev/null\n+++ b/notes.txt\n@@ -0,0 +1,2 @@\n+first\n+second\n\\ No newline at end of file\n"
+	result := tool.Execute(context.Background(), map[string]any{"path": "notes.txt", "patch": patch})
+	if result.IsError {
+		t.Fatalf("apply failed: %s", result.ForLLM)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "notes.txt")); string(got) != "first\nsecond" {
+		t.Errorf("new file = %q", got)
+	}
+}
+
+func TestApplyPatchTool_InvalidPatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a\n"), 0o644)
+	tool := NewApplyPatchTool(tmpDir, true)
+
+	tests := []struct {
+		args map[string]any
+		want string
+	}{
+		{args: map[string]any{"patch": "@@ -1 +1 @@\n-a\n+b\n"}, want: "path is required"},
+		{args: map[string]any{"path": "a.txt", "patch": "just replace a with b"}, want: "patch contains no @@ hunks"},
+		{
+			args: map[string]any{"path": "a.txt", "patch": "@@ -1 +1 @@\n-a\n+b\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-x\n+y\n"},
+			want: "patch changes more than one file; send one patch per file",
+		},
+		{args: map[string]any{"path": "../a.txt", "patch": "@@ -1 +1 @@\n-a\n+b\n"}, want: "path escapes workspace"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if !result.IsError || !strings.Contains(result.ForLLM, tt.want) {
+			t.Errorf("args %v: got %q, want error containing %q", tt.args, result.ForLLM, tt.want)
+		}
+	}
+}
@@ -8,18 +8,39 @@ package tools
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/storage"
 )
 
+// defaultQueryExpansionMaxChars caps the recent context prepended to search
+// queries when no cap is configured.
+const defaultQueryExpansionMaxChars = 500
+
+// Search scopes of qdrant_search_memory
+const (
+	memoryScopeSession = "session" // the current (or filtered) session only
+	memoryScopeChannel = "channel" // every session on the session's channel
+	memoryScopeAll     = "all"     // every session
+)
+
 // QdrantSearchTool provides semantic search through stored messages in Qdrant
 type QdrantSearchTool struct {
 	messageStore *storage.MessageStore
 	sessionKey   string
 	callback     AsyncCallback
+
+	// Query expansion: the last expansionTurns messages of the current
+	// conversation are prepended to the query before it is embedded
+	history         SessionManager
+	expansionTurns  int
+	expansionMax    int
+	mu              sync.RWMutex
+	conversationKey string
 }
 
 // NewQdrantSearchTool creates a new Qdrant search tool
@@ -38,7 +59,8 @@ func (t *QdrantSearchTool) Name() string {
 func (t *QdrantSearchTool) Description() string {
 	return `Search for relevant messages in long-term memory using semantic search. 
 Use this tool when you need to find past conversations or information stored in memory.
-Supports filtering by role (user/assistant), session key, and time range.`
+Supports filtering by role (user/assistant, or tool/tool_call when tool results are stored), session key, and time range.
+Use scope "channel" or "all" to recall what the user said in other chats, e.g. "what did I tell you last week".`
 }
 
 // Parameters returns the JSON schema for tool parameters
@@ -50,6 +72,11 @@ func (t *QdrantSearchTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "The search query - describe what you're looking for in natural language",
 			},
+			"scope": map[string]any{
+				"type":        "string",
+				"description": "Which conversations to search: 'session' (this conversation), 'channel' (all conversations on this channel) or 'all'. Default: the session_key filter if given, otherwise all",
+				"enum":        []string{memoryScopeSession, memoryScopeChannel, memoryScopeAll},
+			},
 			"limit": map[string]any{
 				"type":        "integer",
 				"description": "Maximum number of results to return (default: 5, max: 20)",
@@ -61,8 +88,8 @@ func (t *QdrantSearchTool) Parameters() map[string]any {
 				"properties": map[string]any{
 					"role": map[string]any{
 						"type":        "string",
-						"description": "Filter by message role: 'user', 'assistant', or 'system'",
-						"enum":        []string{"user", "assistant", "system"},
+						"description": "Filter by message role: 'user', 'assistant', 'system', 'tool' (tool results) or 'tool_call'",
+						"enum":        []string{"user", "assistant", "system", "tool", "tool_call"},
 					},
 					"session_key": map[string]any{
 						"type":        "string",
@@ -88,11 +115,77 @@ func (t *QdrantSearchTool) SetSessionKey(sessionKey string) {
 	t.sessionKey = sessionKey
 }
 
+// SetQueryExpansion prepends up to turns recent user and assistant messages
+// of the current conversation, at most maxChars characters, to search queries
+// so short follow-ups like "what about that?" find relevant memories. A
+// maxChars of 0 uses the default cap.
+func (t *QdrantSearchTool) SetQueryExpansion(history SessionManager, turns, maxChars int) {
+	if maxChars <= 0 {
+		maxChars = defaultQueryExpansionMaxChars
+	}
+	t.history = history
+	t.expansionTurns = turns
+	t.expansionMax = maxChars
+}
+
+// SetConversationKey sets the session whose recent messages expand queries.
+// Unlike SetSessionKey it does not restrict which sessions are searched.
+func (t *QdrantSearchTool) SetConversationKey(sessionKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conversationKey = sessionKey
+}
+
+// conversation returns the session of the call, or the one last set with
+// SetConversationKey.
+func (t *QdrantSearchTool) conversation(ctx context.Context) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return callSessionKey(ctx, t.conversationKey)
+}
+
+// expandQuery prepends recent context of conversation key to query, keeping
+// the most recent text when it exceeds the cap.
+func (t *QdrantSearchTool) expandQuery(query, key string) string {
+	if t.history == nil || t.expansionTurns <= 0 || key == "" {
+		return query
+	}
+
+	var recent []string
+	history := t.history.GetHistory(key)
+	for i := len(history) - 1; i >= 0 && len(recent) < t.expansionTurns; i-- {
+		m := history[i]
+		if (m.Role != "user" && m.Role != "assistant") || m.Content == "" || len(m.ToolCalls) > 0 {
+			continue
+		}
+		recent = append(recent, m.Content)
+	}
+	// The current question is usually already the last user message
+	if len(recent) > 0 && recent[0] == query {
+		recent = recent[1:]
+	}
+	if len(recent) == 0 {
+		return query
+	}
+
+	slices.Reverse(recent)
+	prefix := []rune(strings.Join(recent, "\n"))
+	if len(prefix) > t.expansionMax {
+		prefix = prefix[len(prefix)-t.expansionMax:]
+	}
+	return string(prefix) + "\n" + query
+}
+
 // SetCallback sets the callback for async operations (not used for this sync tool)
 func (t *QdrantSearchTool) SetCallback(cb AsyncCallback) {
 	t.callback = cb
 }
 
+// ReadOnly reports that the tool never changes state
+func (t *QdrantSearchTool) ReadOnly() bool {
+	return true
+}
+
 // Execute performs the search query
 func (t *QdrantSearchTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	if t.messageStore == nil || !t.messageStore.IsEnabled() {
@@ -148,8 +241,18 @@ func (t *QdrantSearchTool) Execute(ctx context.Context, args map[string]any) *To
 		}
 	}
 
+	scope, _ := args["scope"].(string)
+	conversation := t.conversation(ctx)
+	sessionFilter, err := t.scopeFilter(scope, searchSessionKey, conversation)
+	if err != nil {
+		return &ToolResult{
+			ForLLM:  fmt.Sprintf("Error: %v", err),
+			IsError: true,
+		}
+	}
+
 	// Perform search
-	messages, err := t.messageStore.SearchSimilarMessagesWithPayload(searchSessionKey, queryText, limit)
+	messages, err := t.messageStore.SearchMessagesWithPayload(sessionFilter, t.expandQuery(queryText, conversation), limit)
 	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("Error searching memory: %v", err),
@@ -173,6 +276,52 @@ func (t *QdrantSearchTool) Execute(ctx context.Context, args map[string]any) *To
 	}
 }
 
+// scopeFilter selects the sessions searched for scope. sessionKey is the
+// session the search is about; when empty, conversation is used. Without a
+// scope only sessionKey is searched, or every session if it is empty.
+func (t *QdrantSearchTool) scopeFilter(scope, sessionKey, conversation string) (storage.SessionFilter, error) {
+	switch scope {
+	case "":
+		return storage.SessionKeyFilter(sessionKey), nil
+	case memoryScopeAll:
+		return storage.SessionFilter{}, nil
+	case memoryScopeSession, memoryScopeChannel:
+	default:
+		return storage.SessionFilter{}, fmt.Errorf("scope %q is not one of %q, %q or %q",
+			scope, memoryScopeSession, memoryScopeChannel, memoryScopeAll)
+	}
+
+	if sessionKey == "" {
+		sessionKey = conversation
+	}
+	if sessionKey == "" {
+		return storage.SessionFilter{}, fmt.Errorf("scope %q needs a current session; pass filters.session_key", scope)
+	}
+	if scope == memoryScopeSession {
+		return storage.SessionKeyFilter(sessionKey), nil
+	}
+	return channelSessionFilter(sessionKey), nil
+}
+
+// channelSessionFilter matches every session on the channel of sessionKey.
+// Keys look like "agent:<id>:<channel>:<peer kind>:<peer>" or, in older
+// stores, "<channel>:<chat>". Sessions not tied to a channel, such as an
+// agent's main session that collects direct messages from all channels,
+// match only themselves.
+func channelSessionFilter(sessionKey string) storage.SessionFilter {
+	parts := strings.Split(sessionKey, ":")
+	if parts[0] == "agent" {
+		if len(parts) >= 4 && parts[2] != "direct" {
+			return storage.SessionFilter{Key: strings.Join(parts[:3], ":") + ":", Prefix: true}
+		}
+		return storage.SessionKeyFilter(sessionKey)
+	}
+	if len(parts) >= 2 {
+		return storage.SessionFilter{Key: parts[0] + ":", Prefix: true}
+	}
+	return storage.SessionKeyFilter(sessionKey)
+}
+
 // applyFilters applies role and timestamp filters to search results
 func (t *QdrantSearchTool) applyFilters(messages []storage.MessagePayload, filters map[string]any) []storage.MessagePayload {
 	if filters == nil || len(filters) == 0 {
@@ -7,10 +7,16 @@ package tools
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/storage"
 )
 
@@ -152,6 +158,195 @@ func TestQdrantSearchTool_SetSessionKey(t *testing.T) {
 	}
 }
 
+// recordingEmbeddingClient records the texts it is asked to embed.
+type recordingEmbeddingClient struct {
+	texts []string
+}
+
+func (c *recordingEmbeddingClient) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	c.texts = append(c.texts, text)
+	return []float32{0.1, 0.2, 0.3}, nil
+}
+
+func (c *recordingEmbeddingClient) GenerateEmbeddingsBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	for i, text := range texts {
+		result[i], _ = c.GenerateEmbedding(ctx, text)
+	}
+	return result, nil
+}
+
+// historyOnly is a SessionManager that serves a fixed history.
+type historyOnly map[string][]providers.Message
+
+func (h historyOnly) GetHistory(key string) []providers.Message { return h[key] }
+func (h historyOnly) TruncateHistory(key string, keepLast int)  {}
+func (h historyOnly) GetSummary(key string) string              { return "" }
+
+func TestQdrantSearchTool_QueryExpansion(t *testing.T) {
+	qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":[]}`))
+	}))
+	defer qdrant.Close()
+	host, portStr, _ := net.SplitHostPort(qdrant.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	embeddings := &recordingEmbeddingClient{}
+	store, err := storage.NewMessageStoreWithClients(config.QdrantConfig{
+		Enabled: true, Host: host, Port: port, Collection: "test", VectorSize: 3,
+	}, embeddings)
+	if err != nil {
+		t.Fatalf("NewMessageStoreWithClients failed: %v", err)
+	}
+
+	history := historyOnly{"telegram:42": {
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Let's plan the trip to Lisbon"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search"}}},
+		{Role: "tool", Content: "flight prices...", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "Flights are cheapest in May"},
+		{Role: "user", Content: "what about hotels?"},
+	}}
+	tool := NewQdrantSearchTool(store)
+	search := func(query string) string {
+		t.Helper()
+		embeddings.texts = nil
+		if result := tool.Execute(context.Background(), map[string]any{"query_text": query}); result.IsError {
+			t.Fatalf("Execute failed: %s", result.ForLLM)
+		}
+		if len(embeddings.texts) != 1 {
+			t.Fatalf("embedded %d texts, want 1", len(embeddings.texts))
+		}
+		return embeddings.texts[0]
+	}
+
+	// Without expansion only the query is embedded
+	tool.SetConversationKey("telegram:42")
+	if got := search("what about hotels?"); got != "what about hotels?" {
+		t.Errorf("embedded %q without expansion", got)
+	}
+
+	tool.SetQueryExpansion(history, 3, 0)
+	want := "Let's plan the trip to Lisbon\nFlights are cheapest in May\nwhat about hotels?"
+	if got := search("what about hotels?"); got != want {
+		t.Errorf("embedded %q, want %q", got, want)
+	}
+
+	// The prepended context keeps its most recent characters
+	tool.SetQueryExpansion(history, 3, 12)
+	if got := search("hotels in May"); got != "bout hotels?\nhotels in May" {
+		t.Errorf("embedded %q with a 12-character cap", got)
+	}
+}
+
+// filterRecordingStore is a vector store that records search filters.
+type filterRecordingStore struct {
+	*storage.MemoryVectorStore
+	filters []storage.SessionFilter
+}
+
+func (s *filterRecordingStore) Search(ctx context.Context, vector []float32, filter storage.SessionFilter, limit int) ([]storage.ScoredPoint, error) {
+	s.filters = append(s.filters, filter)
+	return s.MemoryVectorStore.Search(ctx, vector, filter, limit)
+}
+
+func TestQdrantSearchTool_Scope(t *testing.T) {
+	tests := []struct {
+		name         string
+		conversation string
+		args         map[string]any
+		want         storage.SessionFilter
+		wantErr      string
+	}{
+		{
+			name:         "no scope searches all sessions",
+			conversation: "agent:main:telegram:group:-100",
+			want:         storage.SessionFilter{},
+		},
+		{
+			name:         "session",
+			conversation: "agent:main:telegram:group:-100",
+			args:         map[string]any{"scope": "session"},
+			want:         storage.SessionFilter{Key: "agent:main:telegram:group:-100"},
+		},
+		{
+			name:         "channel",
+			conversation: "agent:main:telegram:group:-100",
+			args:         map[string]any{"scope": "channel"},
+			want:         storage.SessionFilter{Key: "agent:main:telegram:", Prefix: true},
+		},
+		{
+			name:         "channel of the main session",
+			conversation: "agent:main:main",
+			args:         map[string]any{"scope": "channel"},
+			want:         storage.SessionFilter{Key: "agent:main:main"},
+		},
+		{
+			name:         "channel of a filtered legacy session",
+			conversation: "agent:main:telegram:group:-100",
+			args: map[string]any{
+				"scope":   "channel",
+				"filters": map[string]any{"session_key": "discord:42"},
+			},
+			want: storage.SessionFilter{Key: "discord:", Prefix: true},
+		},
+		{
+			name:         "all",
+			conversation: "agent:main:telegram:group:-100",
+			args: map[string]any{
+				"scope":   "all",
+				"filters": map[string]any{"session_key": "discord:42"},
+			},
+			want: storage.SessionFilter{},
+		},
+		{
+			name:    "session without a current session",
+			args:    map[string]any{"scope": "session"},
+			wantErr: `scope "session" needs a current session`,
+		},
+		{
+			name:         "unknown scope",
+			conversation: "agent:main:main",
+			args:         map[string]any{"scope": "everywhere"},
+			wantErr:      `scope "everywhere" is not one of`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vectors := &filterRecordingStore{MemoryVectorStore: storage.NewMemoryVectorStore("test")}
+			store, err := storage.NewMessageStoreWithVectorStore(config.QdrantConfig{}, vectors, &recordingEmbeddingClient{})
+			if err != nil {
+				t.Fatalf("NewMessageStoreWithVectorStore failed: %v", err)
+			}
+			tool := NewQdrantSearchTool(store)
+			tool.SetConversationKey(tt.conversation)
+
+			args := map[string]any{"query_text": "what did I say last week?"}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			result := tool.Execute(context.Background(), args)
+
+			if tt.wantErr != "" {
+				if !result.IsError || !strings.Contains(result.ForLLM, tt.wantErr) {
+					t.Errorf("result = %q, want error containing %q", result.ForLLM, tt.wantErr)
+				}
+				if len(vectors.filters) != 0 {
+					t.Errorf("searched with %+v despite the error", vectors.filters)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("Execute failed: %s", result.ForLLM)
+			}
+			if len(vectors.filters) != 1 || vectors.filters[0] != tt.want {
+				t.Errorf("search filters = %+v, want [%+v]", vectors.filters, tt.want)
+			}
+		})
+	}
+}
+
 func TestQdrantSearchTool_MatchesFilters(t *testing.T) {
 	store, _ := storage.NewMessageStore(config.StorageConfig{})
 	tool := NewQdrantSearchTool(store)
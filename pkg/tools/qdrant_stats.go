@@ -0,0 +1,81 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+)
+
+// MemoryStatsTool reports how much is stored in long-term memory and how
+// the Qdrant collection is configured
+type MemoryStatsTool struct {
+	messageStore *storage.MessageStore
+	vectorSize   int // configured vector size, to flag a mismatch
+}
+
+// NewMemoryStatsTool creates a new memory stats tool. vectorSize is the
+// configured embedding dimension, or 0 to skip the consistency check.
+func NewMemoryStatsTool(messageStore *storage.MessageStore, vectorSize int) *MemoryStatsTool {
+	return &MemoryStatsTool{
+		messageStore: messageStore,
+		vectorSize:   vectorSize,
+	}
+}
+
+// Name returns the tool name
+func (t *MemoryStatsTool) Name() string {
+	return "memory_stats"
+}
+
+// Description returns the tool description
+func (t *MemoryStatsTool) Description() string {
+	return "Show long-term memory usage: the number of stored messages, the vector size and distance of the Qdrant collection, and its status. Use it when the user asks how much is remembered or to check the memory setup."
+}
+
+// Parameters returns the JSON schema for tool parameters
+func (t *MemoryStatsTool) Parameters() map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+}
+
+// ReadOnly reports that the tool never changes state
+func (t *MemoryStatsTool) ReadOnly() bool {
+	return true
+}
+
+// Execute fetches the collection stats
+func (t *MemoryStatsTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if t.messageStore == nil || !t.messageStore.IsEnabled() {
+		return ErrorResult("Qdrant memory is not configured. Enable it in config to store long-term memory.")
+	}
+
+	info, err := t.messageStore.Stats(ctx)
+	if err != nil {
+		return ExternalError(fmt.Sprintf("failed to get memory stats: %v", err)).WithError(err)
+	}
+
+	return NewToolResult(formatMemoryStats(info, t.vectorSize))
+}
+
+func formatMemoryStats(info *storage.CollectionInfo, vectorSize int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Memory collection: %s\n", info.Name)
+	fmt.Fprintf(&sb, "Status: %s\n", info.Status)
+	fmt.Fprintf(&sb, "Stored messages: %d\n", info.PointsCount)
+	fmt.Fprintf(&sb, "Vector size: %d\n", info.VectorSize)
+	fmt.Fprintf(&sb, "Distance: %s\n", info.Distance)
+	if vectorSize > 0 && info.VectorSize > 0 && info.VectorSize != vectorSize {
+		fmt.Fprintf(&sb, "Warning: the collection uses %d dimensions but storage.qdrant.vector_size is %d; "+
+			"embeddings will fail to store until they match.\n", info.VectorSize, vectorSize)
+	}
+	return sb.String()
+}
@@ -0,0 +1,45 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/storage"
+)
+
+func TestMemoryStatsTool_NotConfigured(t *testing.T) {
+	tool := NewMemoryStatsTool(nil, 1024)
+	if result := tool.Execute(context.Background(), nil); !result.IsError {
+		t.Error("expected error when the message store is nil")
+	}
+}
+
+func TestFormatMemoryStats(t *testing.T) {
+	info := &storage.CollectionInfo{
+		Name:        "picoclaw_messages",
+		Status:      "green",
+		PointsCount: 42,
+		VectorSize:  768,
+		Distance:    "Cosine",
+	}
+
+	out := formatMemoryStats(info, 768)
+	for _, want := range []string{"picoclaw_messages", "Status: green", "Stored messages: 42", "Vector size: 768", "Cosine"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Warning") {
+		t.Errorf("unexpected warning for matching vector size:\n%s", out)
+	}
+
+	if out := formatMemoryStats(info, 1024); !strings.Contains(out, "Warning") {
+		t.Errorf("expected a vector size mismatch warning:\n%s", out)
+	}
+}
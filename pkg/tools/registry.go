@@ -8,12 +8,15 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 type ToolRegistry struct {
 	tools map[string]Tool
-	mu    sync.RWMutex
+	// allowed limits which tools may be registered; nil allows all
+	allowed map[string]bool
+	mu      sync.RWMutex
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -25,9 +28,28 @@ func NewToolRegistry() *ToolRegistry {
 func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.allowed != nil && !r.allowed[tool.Name()] {
+		return
+	}
 	r.tools[tool.Name()] = tool
 }
 
+// Restrict limits the registry to the named tools. Other tools already
+// registered are removed, and later registrations of them are ignored.
+func (r *ToolRegistry) Restrict(names []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		r.allowed[name] = true
+	}
+	for name := range r.tools {
+		if !r.allowed[name] {
+			delete(r.tools, name)
+		}
+	}
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -61,12 +83,19 @@ func (r *ToolRegistry) ExecuteWithContext(
 			map[string]any{
 				"tool": name,
 			})
-		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
+		metrics.ToolExecutions.Inc(name, "not_found")
+		return ValidationError(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID, threadID)
+	// The chat travels with the call, so calls from several chats can run at
+	// once. If the caller did not put it in ctx, it is also set on
+	// ContextualTools as before.
+	if call, _ := CallContextFrom(ctx); call.ChatID == "" && channel != "" && chatID != "" {
+		if contextualTool, ok := tool.(ContextualTool); ok {
+			contextualTool.SetContext(channel, chatID, threadID)
+		}
+		call.Channel, call.ChatID, call.ThreadID = channel, chatID, threadID
+		ctx = WithCallContext(ctx, call)
 	}
 
 	// If tool implements AsyncTool and callback is provided, set callback
@@ -83,12 +112,21 @@ func (r *ToolRegistry) ExecuteWithContext(
 	duration := time.Since(start)
 
 	// Log based on result type
+	switch {
+	case result.IsError:
+		metrics.ToolExecutions.Inc(name, metrics.StatusError)
+	case result.Async:
+		metrics.ToolExecutions.Inc(name, "async")
+	default:
+		metrics.ToolExecutions.Inc(name, metrics.StatusOK)
+	}
 	if result.IsError {
 		logger.ErrorCF("tool", "Tool execution failed",
 			map[string]any{
 				"tool":     name,
 				"duration": duration.Milliseconds(),
 				"error":    result.ForLLM,
+				"kind":     string(result.ErrorKind),
 			})
 	} else if result.Async {
 		logger.InfoCF("tool", "Tool started (async)",
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -353,3 +354,17 @@ func TestToolRegistry_ConcurrentAccess(t *testing.T) {
 		t.Error("expected tools to be registered after concurrent access")
 	}
 }
+
+func TestToolRegistry_Restrict(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(newMockTool("message", "send"))
+	r.Register(newMockTool("exec", "run"))
+
+	r.Restrict([]string{"message", "session"})
+	r.Register(newMockTool("read_file", "read"))
+	r.Register(newMockTool("session", "inspect"))
+
+	if got := r.List(); !reflect.DeepEqual(got, []string{"message", "session"}) {
+		t.Errorf("List() = %v, want [message session]", got)
+	}
+}
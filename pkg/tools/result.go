@@ -1,6 +1,26 @@
 package tools
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ErrorKind categorizes a failed tool result so the agent loop can decide how
+// much of the error to pass on.
+type ErrorKind string
+
+const (
+	// ErrorKindValidation means the arguments were invalid; the message is
+	// meant for the model and the user, who can correct the request.
+	ErrorKindValidation ErrorKind = "validation"
+	// ErrorKindPermission means the action was refused by policy or access rules.
+	ErrorKindPermission ErrorKind = "permission"
+	// ErrorKindExternal means a remote service or device failed; retrying later may help.
+	ErrorKindExternal ErrorKind = "external"
+	// ErrorKindInternal means the tool itself failed. Details are logged but
+	// not passed on, since they may expose paths or other internals.
+	ErrorKindInternal ErrorKind = "internal"
+)
 
 // ToolResult represents the structured return value from tool execution.
 // It provides clear semantics for different types of results and supports
@@ -30,6 +50,10 @@ type ToolResult struct {
 	// Err is the underlying error (not JSON serialized).
 	// Used for internal error handling and logging.
 	Err error `json:"-"`
+
+	// ErrorKind categorizes an error result. Empty means uncategorized,
+	// in which case the error message is passed on unchanged.
+	ErrorKind ErrorKind `json:"error_kind,omitempty"`
 }
 
 // NewToolResult creates a basic ToolResult with content for the LLM.
@@ -141,3 +165,59 @@ func (tr *ToolResult) WithError(err error) *ToolResult {
 	tr.Err = err
 	return tr
 }
+
+// WithErrorKind sets the error category and returns the result for chaining.
+//
+// Example:
+//
+//	result := ErrorResult("path is required").WithErrorKind(ErrorKindValidation)
+func (tr *ToolResult) WithErrorKind(kind ErrorKind) *ToolResult {
+	tr.ErrorKind = kind
+	return tr
+}
+
+// ValidationError creates an error result for invalid tool arguments.
+func ValidationError(message string) *ToolResult {
+	return ErrorResult(message).WithErrorKind(ErrorKindValidation)
+}
+
+// PermissionError creates an error result for an action refused by policy.
+func PermissionError(message string) *ToolResult {
+	return ErrorResult(message).WithErrorKind(ErrorKindPermission)
+}
+
+// ExternalError creates an error result for a failing remote service or device.
+func ExternalError(message string) *ToolResult {
+	return ErrorResult(message).WithErrorKind(ErrorKindExternal)
+}
+
+// InternalError creates an error result for a failure inside the tool itself.
+func InternalError(message string) *ToolResult {
+	return ErrorResult(message).WithErrorKind(ErrorKindInternal)
+}
+
+// ContentForLLM renders the result as the content of the tool message sent
+// back to the LLM. Error results are rendered according to their ErrorKind:
+// internal errors are replaced by a generic message so their details never
+// reach the conversation, while validation errors are passed on verbatim.
+func (tr *ToolResult) ContentForLLM(toolName string) string {
+	content := tr.ForLLM
+	if content == "" && tr.Err != nil {
+		content = tr.Err.Error()
+	}
+	if !tr.IsError {
+		return content
+	}
+
+	switch tr.ErrorKind {
+	case ErrorKindPermission:
+		return "Permission denied: " + content
+	case ErrorKindExternal:
+		return "External service error: " + content + "\nThe failure is outside your control; retrying later may succeed."
+	case ErrorKindInternal:
+		return fmt.Sprintf("The %s tool failed with an internal error. "+
+			"The details have been logged; tell the user the action could not be completed.", toolName)
+	default:
+		return content
+	}
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -227,3 +228,55 @@ func TestToolResultJSONStructure(t *testing.T) {
 		t.Errorf("Expected silent false, got %v", parsed["silent"])
 	}
 }
+
+func TestToolResultContentForLLM(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *ToolResult
+		want   string
+	}{
+		{name: "success", result: NewToolResult("ok"), want: "ok"},
+		{name: "uncategorized", result: ErrorResult("boom"), want: "boom"},
+		{name: "validation", result: ValidationError("path is required"), want: "path is required"},
+		{name: "permission", result: PermissionError("outside workspace"), want: "Permission denied: outside workspace"},
+		{
+			name:   "external",
+			result: ExternalError("search failed: 503"),
+			want:   "External service error: search failed: 503\nThe failure is outside your control; retrying later may succeed.",
+		},
+		{
+			name:   "internal",
+			result: InternalError("open /var/lib/secret: permission denied"),
+			want: "The demo tool failed with an internal error. " +
+				"The details have been logged; tell the user the action could not be completed.",
+		},
+		{
+			name:   "uncategorized falls back to Err",
+			result: (&ToolResult{IsError: true}).WithError(errors.New("underlying error")),
+			want:   "underlying error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.ContentForLLM("demo"); got != tt.want {
+				t.Errorf("ContentForLLM() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolResultErrorKindJSON(t *testing.T) {
+	data, err := json.Marshal(PermissionError("denied"))
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"error_kind":"permission"`) {
+		t.Errorf("JSON = %s, want error_kind permission", data)
+	}
+
+	data, _ = json.Marshal(ErrorResult("plain"))
+	if strings.Contains(string(data), "error_kind") {
+		t.Errorf("JSON = %s, want error_kind omitted when unset", data)
+	}
+}
@@ -3,15 +3,18 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type SessionTool struct {
 	sessionManager SessionManager
-	sessionKey     string // Current session key, set by context
-	contextWindow  int    // Context window size for percentage calculation
+	sessionKey     string      // Current session key, set by context
+	contextWindow  int         // Context window size for percentage calculation
+	usage          UsageSource // Token usage reported by the provider, optional
 }
 
 // SessionManager defines the interface for session management.
@@ -22,6 +25,23 @@ type SessionManager interface {
 	GetSummary(key string) string
 }
 
+// SessionForgetter deletes a session together with its long-term memory.
+type SessionForgetter interface {
+	ForgetSession(key string) error
+}
+
+// SessionPinner keeps entries in a session regardless of truncation.
+type SessionPinner interface {
+	Pin(key, content string) bool
+	Unpin(key string, index int) error
+	GetPinned(key string) []string
+}
+
+// UsageSource reports the token usage recorded for a session.
+type UsageSource interface {
+	SessionUsage(sessionKey string) providers.TokenUsage
+}
+
 func NewSessionTool() *SessionTool {
 	return &SessionTool{}
 }
@@ -31,7 +51,10 @@ func (t *SessionTool) Name() string {
 }
 
 func (t *SessionTool) Description() string {
-	return "Manage the current conversation session: clear history or get session stats. Use /clear to start a new session or /stats to see current session info."
+	return "Manage the current conversation session: clear history or get session stats. Use /clear to start a new session or /stats to see current session info. " +
+		"'clear' keeps long-term memory, so earlier messages can still be recalled. " +
+		"Use 'pin' when the user asks you to always remember something (e.g. their address); pinned entries survive clearing and compaction. " +
+		"Only use 'forget_all' when the user explicitly asks to erase everything about this conversation, including long-term memory; it needs the user's approval."
 }
 
 func (t *SessionTool) Parameters() map[string]any {
@@ -40,8 +63,16 @@ func (t *SessionTool) Parameters() map[string]any {
 		"properties": map[string]any{
 			"action": map[string]any{
 				"type":        "string",
-				"enum":        []string{"clear", "stats"},
-				"description": "Action to perform: 'clear' to clear the current session history, 'stats' to show session information",
+				"enum":        []string{"clear", "forget_all", "pin", "unpin", "stats"},
+				"description": "Action to perform: 'clear' to clear the current session history, 'forget_all' to also delete its long-term memory, 'pin' to keep something for the whole conversation, 'unpin' to remove a pinned entry, 'stats' to show session information and pinned entries",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "For 'pin': the text to pin, written as a self-contained fact. Defaults to the user's latest message.",
+			},
+			"index": map[string]any{
+				"type":        "integer",
+				"description": "For 'unpin': the number of the pinned entry as listed by 'stats'",
 			},
 		},
 		"required": []string{"action"},
@@ -60,6 +91,11 @@ func (t *SessionTool) SetSessionKey(sessionKey string) {
 	t.sessionKey = sessionKey
 }
 
+// SetUsageSource sets where the stats action reads actual token usage from.
+func (t *SessionTool) SetUsageSource(usage UsageSource) {
+	t.usage = usage
+}
+
 // SetContextWindow sets the context window size for percentage calculation.
 // This should be called after the agent instance is created.
 func (t *SessionTool) SetContextWindow(contextWindow int) {
@@ -69,35 +105,103 @@ func (t *SessionTool) SetContextWindow(contextWindow int) {
 func (t *SessionTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	action, ok := args["action"].(string)
 	if !ok {
-		return &ToolResult{ForLLM: "action is required (clear or stats)", IsError: true}
+		return &ToolResult{ForLLM: "action is required (clear, forget_all, pin, unpin or stats)", IsError: true}
 	}
 
 	if t.sessionManager == nil {
 		return &ToolResult{ForLLM: "Session manager not available", IsError: true}
 	}
 
-	if t.sessionKey == "" {
+	key := callSessionKey(ctx, t.sessionKey)
+	if key == "" {
 		return &ToolResult{ForLLM: "No current session", IsError: true}
 	}
 
 	switch action {
 	case "clear":
-		return t.clearSession()
+		return t.clearSession(key)
+	case "forget_all":
+		return t.forgetSession(key)
+	case "pin":
+		content, _ := args["content"].(string)
+		return t.pin(key, content)
+	case "unpin":
+		index, ok := args["index"].(float64)
+		if !ok {
+			return ErrorResult("index is required for unpin")
+		}
+		return t.unpin(key, int(index))
 	case "stats":
-		return t.sessionStats()
+		return t.sessionStats(key)
 	default:
-		return &ToolResult{ForLLM: fmt.Sprintf("Unknown action: %s. Use 'clear' or 'stats'", action), IsError: true}
+		return &ToolResult{
+			ForLLM:  fmt.Sprintf("Unknown action: %s. Use 'clear', 'forget_all', 'pin', 'unpin' or 'stats'", action),
+			IsError: true,
+		}
 	}
 }
 
-func (t *SessionTool) clearSession() *ToolResult {
+// NeedsConfirmation gates only forget_all, which cannot be undone.
+func (t *SessionTool) NeedsConfirmation(args map[string]any) bool {
+	action, _ := args["action"].(string)
+	return action == "forget_all"
+}
+
+func (t *SessionTool) clearSession(key string) *ToolResult {
 	// Clear the session history
-	t.sessionManager.TruncateHistory(t.sessionKey, 0)
+	t.sessionManager.TruncateHistory(key, 0)
 	return &ToolResult{
 		ForLLM: "✅ Session cleared successfully. Starting a new conversation!",
 	}
 }
 
+func (t *SessionTool) forgetSession(key string) *ToolResult {
+	forgetter, ok := t.sessionManager.(SessionForgetter)
+	if !ok {
+		return InternalError("forgetting long-term memory is not supported")
+	}
+	if err := forgetter.ForgetSession(key); err != nil {
+		return ExternalError(fmt.Sprintf("failed to forget session: %v", err)).WithError(err)
+	}
+	return &ToolResult{
+		ForLLM: "✅ Session history and long-term memory of this conversation deleted. Starting over!",
+	}
+}
+
+func (t *SessionTool) pin(key, content string) *ToolResult {
+	pinner, ok := t.sessionManager.(SessionPinner)
+	if !ok {
+		return InternalError("pinning is not supported")
+	}
+	if strings.TrimSpace(content) == "" {
+		history := t.sessionManager.GetHistory(key)
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Role == "user" && strings.TrimSpace(history[i].Content) != "" {
+				content = history[i].Content
+				break
+			}
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		return ErrorResult("content is required for pin")
+	}
+	if !pinner.Pin(key, content) {
+		return NewToolResult("📌 Already pinned.")
+	}
+	return NewToolResult(fmt.Sprintf("📌 Pinned: %s", utils.Truncate(strings.TrimSpace(content), 200)))
+}
+
+func (t *SessionTool) unpin(key string, index int) *ToolResult {
+	pinner, ok := t.sessionManager.(SessionPinner)
+	if !ok {
+		return InternalError("pinning is not supported")
+	}
+	if err := pinner.Unpin(key, index-1); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return NewToolResult(fmt.Sprintf("Unpinned entry %d.", index))
+}
+
 // estimateTokens estimates the number of tokens in a message list.
 // Uses a safe heuristic of 2.5 characters per token to account for CJK and other overheads.
 func estimateTokens(messages []providers.Message) int {
@@ -109,9 +213,9 @@ func estimateTokens(messages []providers.Message) int {
 	return totalChars * 2 / 5
 }
 
-func (t *SessionTool) sessionStats() *ToolResult {
+func (t *SessionTool) sessionStats(key string) *ToolResult {
 	// Get session history
-	history := t.sessionManager.GetHistory(t.sessionKey)
+	history := t.sessionManager.GetHistory(key)
 
 	// Calculate stats
 	messageCount := len(history)
@@ -139,6 +243,21 @@ func (t *SessionTool) sessionStats() *ToolResult {
 			stats += fmt.Sprintf("\nContext: %.1f%%%s", contextPercent, contextMax)
 		}
 	}
+	if t.usage != nil {
+		if u := t.usage.SessionUsage(key); u.Calls > 0 {
+			stats += fmt.Sprintf("\nUsage: %d prompt + %d completion = %d tokens over %d LLM calls",
+				u.PromptTokens, u.CompletionTokens, u.TotalTokens, u.Calls)
+		}
+	}
+
+	if pinner, ok := t.sessionManager.(SessionPinner); ok {
+		if pinned := pinner.GetPinned(key); len(pinned) > 0 {
+			stats += "\n\n📌 Pinned:"
+			for i, p := range pinned {
+				stats += fmt.Sprintf("\n%d. %s", i+1, utils.Truncate(p, 200))
+			}
+		}
+	}
 
 	return &ToolResult{
 		ForLLM: stats,
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fakeSessionManager keeps one history per key and records forgotten keys.
+type fakeSessionManager struct {
+	histories map[string][]providers.Message
+	pinned    []string
+	forgotten []string
+}
+
+func (m *fakeSessionManager) GetHistory(key string) []providers.Message {
+	return m.histories[key]
+}
+
+func (m *fakeSessionManager) TruncateHistory(key string, keepLast int) {
+	if keepLast <= 0 {
+		m.histories[key] = nil
+	}
+}
+
+func (m *fakeSessionManager) GetSummary(key string) string {
+	return ""
+}
+
+func (m *fakeSessionManager) ForgetSession(key string) error {
+	m.histories[key] = nil
+	m.forgotten = append(m.forgotten, key)
+	return nil
+}
+
+func (m *fakeSessionManager) Pin(key, content string) bool {
+	m.pinned = append(m.pinned, content)
+	return true
+}
+
+func (m *fakeSessionManager) Unpin(key string, index int) error {
+	if index < 0 || index >= len(m.pinned) {
+		return errors.New("no such entry")
+	}
+	m.pinned = append(m.pinned[:index], m.pinned[index+1:]...)
+	return nil
+}
+
+func (m *fakeSessionManager) GetPinned(key string) []string {
+	return m.pinned
+}
+
+func TestSessionTool_Pin(t *testing.T) {
+	sm := &fakeSessionManager{histories: map[string][]providers.Message{
+		"telegram:42": {
+			{Role: "user", Content: "Remember my address is 1 Main St"},
+			{Role: "assistant", Content: "Sure"},
+		},
+	}}
+	tool := NewSessionTool()
+	tool.SetSessionManager(sm)
+	tool.SetSessionKey("telegram:42")
+	ctx := context.Background()
+
+	// Without content the user's latest message is pinned
+	if result := tool.Execute(ctx, map[string]any{"action": "pin"}); result.IsError {
+		t.Fatalf("pin failed: %s", result.ForLLM)
+	}
+	tool.Execute(ctx, map[string]any{"action": "pin", "content": "Call me Sam"})
+	want := []string{"Remember my address is 1 Main St", "Call me Sam"}
+	if !slices.Equal(sm.pinned, want) {
+		t.Errorf("pinned = %v, want %v", sm.pinned, want)
+	}
+
+	// Clearing keeps pinned entries, which stats list
+	tool.Execute(ctx, map[string]any{"action": "clear"})
+	stats := tool.Execute(ctx, map[string]any{"action": "stats"}).ForLLM
+	if !strings.Contains(stats, "1. Remember my address is 1 Main St") || !strings.Contains(stats, "2. Call me Sam") {
+		t.Errorf("stats do not list the pinned entries:\n%s", stats)
+	}
+
+	if result := tool.Execute(ctx, map[string]any{"action": "unpin", "index": float64(1)}); result.IsError {
+		t.Fatalf("unpin failed: %s", result.ForLLM)
+	}
+	if !slices.Equal(sm.pinned, []string{"Call me Sam"}) {
+		t.Errorf("pinned after unpin = %v", sm.pinned)
+	}
+	if result := tool.Execute(ctx, map[string]any{"action": "unpin", "index": float64(3)}); !result.IsError {
+		t.Error("unpinning a missing entry succeeded")
+	}
+}
+
+func TestSessionTool_ClearKeepsMemory(t *testing.T) {
+	sm := &fakeSessionManager{histories: map[string][]providers.Message{
+		"telegram:42": {{Role: "user", Content: "hello"}},
+	}}
+	tool := NewSessionTool()
+	tool.SetSessionManager(sm)
+	tool.SetSessionKey("telegram:42")
+
+	if result := tool.Execute(context.Background(), map[string]any{"action": "clear"}); result.IsError {
+		t.Fatalf("clear failed: %s", result.ForLLM)
+	}
+	if len(sm.histories["telegram:42"]) != 0 {
+		t.Error("clear kept the history")
+	}
+	if len(sm.forgotten) != 0 {
+		t.Errorf("clear forgot long-term memory of %v", sm.forgotten)
+	}
+}
+
+func TestSessionTool_ForgetAllNeedsApproval(t *testing.T) {
+	sm := &fakeSessionManager{histories: map[string][]providers.Message{
+		"telegram:42": {{Role: "user", Content: "hello"}},
+	}}
+	inner := NewSessionTool()
+	inner.SetSessionManager(sm)
+	gate := NewConfirmationGate(0, nil)
+	tool := gate.Wrap(inner)
+	tool.(ContextualTool).SetContext("telegram", "42", "")
+	tool.(SessionAwareTool).SetSessionKey("telegram:42")
+
+	// Stats are harmless and run straight away
+	result := tool.Execute(context.Background(), map[string]any{"action": "stats"})
+	if !strings.Contains(result.ForLLM, "Messages: 1") {
+		t.Errorf("stats = %q, want them to run without approval", result.ForLLM)
+	}
+
+	call := CallContext{Channel: "telegram", ChatID: "42", SessionKey: "telegram:42"}
+	result = tool.Execute(WithCallContext(context.Background(), call), map[string]any{"action": "forget_all"})
+	if !strings.Contains(result.ForLLM, "/approve confirm-1") {
+		t.Errorf("forget_all = %q, want approval instructions", result.ForLLM)
+	}
+	if len(sm.forgotten) != 0 {
+		t.Fatal("forget_all ran before approval")
+	}
+
+	// The action keeps its session even if the tool moved on to another chat
+	tool.(SessionAwareTool).SetSessionKey("telegram:99")
+	_, result, err := gate.Resolve(context.Background(), "confirm-1", "telegram", "42", "", true)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("forget_all failed: %s", result.ForLLM)
+	}
+	if len(sm.forgotten) != 1 || sm.forgotten[0] != "telegram:42" {
+		t.Errorf("forgotten sessions = %v, want [telegram:42]", sm.forgotten)
+	}
+}
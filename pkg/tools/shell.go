@@ -1,16 +1,17 @@
 package tools
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -21,7 +22,29 @@ type ExecTool struct {
 	timeout             time.Duration
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
+	deniedCommands      map[string]bool
+	allowedCommands     map[string]bool
 	restrictToWorkspace bool
+	maxOutputBytes      int
+
+	// Streaming of partial output for long-running commands
+	streamCallback SendCallback
+	streamInterval time.Duration
+	mu             sync.Mutex
+	channel        string
+	chatID         string
+	threadID       string
+}
+
+// defaultExecTimeout limits how long a command may run.
+const defaultExecTimeout = 60 * time.Second
+
+// DefaultDeniedCommands are the binaries the exec tool refuses to run unless
+// tools.exec.denied_commands is configured.
+var DefaultDeniedCommands = []string{
+	"sudo", "su", "doas",
+	"shutdown", "reboot", "poweroff", "halt",
+	"mkfs", "fdisk", "diskpart", "format", "dd",
 }
 
 var defaultDenyPatterns = []*regexp.Regexp{
@@ -100,12 +123,38 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 		denyPatterns = append(denyPatterns, defaultDenyPatterns...)
 	}
 
+	deniedCommands := DefaultDeniedCommands
+	var allowedCommands []string
+	timeout := defaultExecTimeout
+	maxOutputBytes := defaultMaxOutputBytes
+	streamInterval := defaultStreamInterval
+	if config != nil {
+		if config.Tools.Exec.TimeoutSeconds > 0 {
+			timeout = time.Duration(config.Tools.Exec.TimeoutSeconds) * time.Second
+		}
+		if config.Tools.Exec.MaxOutputBytes > 0 {
+			maxOutputBytes = config.Tools.Exec.MaxOutputBytes
+		}
+		if config.Tools.Exec.StreamIntervalSeconds > 0 {
+			streamInterval = time.Duration(config.Tools.Exec.StreamIntervalSeconds) * time.Second
+		}
+		// An explicitly empty list disables the default denylist
+		if config.Tools.Exec.DeniedCommands != nil {
+			deniedCommands = config.Tools.Exec.DeniedCommands
+		}
+		allowedCommands = config.Tools.Exec.AllowedCommands
+	}
+
 	return &ExecTool{
 		workingDir:          workingDir,
-		timeout:             60 * time.Second,
+		timeout:             timeout,
 		denyPatterns:        denyPatterns,
 		allowPatterns:       nil,
+		deniedCommands:      commandSet(deniedCommands),
+		allowedCommands:     commandSet(allowedCommands),
 		restrictToWorkspace: restrict,
+		maxOutputBytes:      maxOutputBytes,
+		streamInterval:      streamInterval,
 	}
 }
 
@@ -129,6 +178,10 @@ func (t *ExecTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional working directory for the command",
 			},
+			"timeout_seconds": map[string]any{
+				"type":        "integer",
+				"description": "Optional timeout in seconds; the command and its child processes are killed when it expires. Cannot exceed the configured limit",
+			},
 		},
 		"required": []string{"command"},
 	}
@@ -137,7 +190,7 @@ func (t *ExecTool) Parameters() map[string]any {
 func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	command, ok := args["command"].(string)
 	if !ok {
-		return ErrorResult("command is required")
+		return ValidationError("command is required")
 	}
 
 	cwd := t.workingDir
@@ -145,7 +198,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		if t.restrictToWorkspace && t.workingDir != "" {
 			resolvedWD, err := validatePath(wd, t.workingDir, true)
 			if err != nil {
-				return ErrorResult("Command blocked by safety guard (" + err.Error() + ")")
+				return PermissionError("Command blocked by safety guard (" + err.Error() + ")")
 			}
 			cwd = resolvedWD
 		} else {
@@ -161,14 +214,16 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 
 	if guardError := t.guardCommand(command, cwd); guardError != "" {
-		return ErrorResult(guardError)
+		return PermissionError(guardError)
 	}
 
+	timeout := t.commandTimeout(args)
+
 	// timeout == 0 means no timeout
 	var cmdCtx context.Context
 	var cancel context.CancelFunc
-	if t.timeout > 0 {
-		cmdCtx, cancel = context.WithTimeout(ctx, t.timeout)
+	if timeout > 0 {
+		cmdCtx, cancel = context.WithTimeout(ctx, timeout)
 	} else {
 		cmdCtx, cancel = context.WithCancel(ctx)
 	}
@@ -185,13 +240,27 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 
 	prepareCommandForTermination(cmd)
+	// On expiry kill the whole process tree, not just the shell
+	cmd.Cancel = func() error {
+		return terminateProcessTree(cmd)
+	}
+
+	stdout := newCappedBuffer(t.maxOutputBytes)
+	stderr := newCappedBuffer(t.maxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	streamer := t.startStreamer(ctx)
+	if streamer != nil {
+		cmd.Stdout = io.MultiWriter(stdout, streamer)
+		cmd.Stderr = io.MultiWriter(stderr, streamer)
+	}
 
 	if err := cmd.Start(); err != nil {
-		return ErrorResult(fmt.Sprintf("failed to start command: %v", err))
+		if streamer != nil {
+			streamer.stop()
+		}
+		return InternalError(fmt.Sprintf("failed to start command: %v", err)).WithError(err)
 	}
 
 	done := make(chan error, 1)
@@ -213,6 +282,9 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 			err = <-done
 		}
 	}
+	if streamer != nil {
+		streamer.stop()
+	}
 
 	output := stdout.String()
 	if stderr.Len() > 0 {
@@ -221,7 +293,10 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 
 	if err != nil {
 		if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
-			msg := fmt.Sprintf("Command timed out after %v", t.timeout)
+			msg := fmt.Sprintf("Command timed out after %v and was killed along with its child processes", timeout)
+			if output != "" {
+				msg += "\nOutput before the timeout:\n" + output
+			}
 			return &ToolResult{
 				ForLLM:  msg,
 				ForUser: msg,
@@ -235,11 +310,6 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		output = "(no output)"
 	}
 
-	maxLen := 10000
-	if len(output) > maxLen {
-		output = output[:maxLen] + fmt.Sprintf("\n... (truncated, %d more chars)", len(output)-maxLen)
-	}
-
 	if err != nil {
 		return &ToolResult{
 			ForLLM:  output,
@@ -265,6 +335,15 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 		}
 	}
 
+	for _, name := range commandNames(cmd) {
+		if t.deniedCommands[name] {
+			return fmt.Sprintf("Command blocked by safety guard (%s is not allowed)", name)
+		}
+		if len(t.allowedCommands) > 0 && !t.allowedCommands[name] {
+			return fmt.Sprintf("Command blocked by safety guard (%s is not in the allowed commands)", name)
+		}
+	}
+
 	if len(t.allowPatterns) > 0 {
 		allowed := false
 		for _, pattern := range t.allowPatterns {
@@ -311,6 +390,58 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 	return ""
 }
 
+func (t *ExecTool) SetContext(channel, chatID, threadID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+	t.threadID = threadID
+}
+
+// SetStreamCallback enables sending partial output of long-running commands
+// to the current chat through callback, every stream interval.
+func (t *ExecTool) SetStreamCallback(callback SendCallback) {
+	t.streamCallback = callback
+}
+
+func (t *ExecTool) SetStreamInterval(interval time.Duration) {
+	t.streamInterval = interval
+}
+
+// SetMaxOutputBytes caps the captured stdout and stderr, each, at n bytes.
+func (t *ExecTool) SetMaxOutputBytes(n int) {
+	t.maxOutputBytes = n
+}
+
+// startStreamer starts streaming partial output to the chat of the call, or
+// returns nil if streaming is not enabled or there is no chat.
+func (t *ExecTool) startStreamer(ctx context.Context) *outputStreamer {
+	t.mu.Lock()
+	channel, chatID, threadID := callChat(ctx, t.channel, t.chatID, t.threadID)
+	t.mu.Unlock()
+
+	if t.streamCallback == nil || channel == "" || chatID == "" {
+		return nil
+	}
+	return startOutputStreamer(t.streamInterval, func(content string) {
+		_ = t.streamCallback(channel, chatID, content, threadID)
+	})
+}
+
+// commandTimeout returns the timeout for one call: the optional
+// timeout_seconds argument, capped at the tool's timeout.
+func (t *ExecTool) commandTimeout(args map[string]any) time.Duration {
+	seconds, ok := args["timeout_seconds"].(float64)
+	if !ok || seconds <= 0 {
+		return t.timeout
+	}
+	requested := time.Duration(seconds * float64(time.Second))
+	if t.timeout > 0 && requested > t.timeout {
+		return t.timeout
+	}
+	return requested
+}
+
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
@@ -319,6 +450,17 @@ func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
 
+// SetDeniedCommands replaces the binaries the tool refuses to run.
+func (t *ExecTool) SetDeniedCommands(names []string) {
+	t.deniedCommands = commandSet(names)
+}
+
+// SetAllowedCommands restricts the tool to the given binaries. An empty list
+// allows any binary that is not denied.
+func (t *ExecTool) SetAllowedCommands(names []string) {
+	t.allowedCommands = commandSet(names)
+}
+
 func (t *ExecTool) SetAllowPatterns(patterns []string) error {
 	t.allowPatterns = make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
@@ -330,3 +472,14 @@ func (t *ExecTool) SetAllowPatterns(patterns []string) error {
 	}
 	return nil
 }
+
+// commandSet normalizes binary names into a lookup set.
+func commandSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = normalizeCommandName(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
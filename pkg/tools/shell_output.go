@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultMaxOutputBytes caps the captured stdout and stderr of a command.
+const defaultMaxOutputBytes = 10000
+
+// defaultStreamInterval is how often partial output is sent while a command runs.
+const defaultStreamInterval = 10 * time.Second
+
+// maxStreamChunk bounds a single partial-output message; older output is dropped.
+const maxStreamChunk = 2000
+
+// cappedBuffer keeps the first limit bytes written to it and counts the rest,
+// so a command producing megabytes of output never holds them in memory.
+// Writes always succeed so the command is not killed by a broken pipe.
+type cappedBuffer struct {
+	buf     []byte
+	limit   int
+	dropped int64
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := min(max(b.limit-len(b.buf), 0), len(p))
+	b.buf = append(b.buf, p[:room]...)
+	b.dropped += int64(len(p) - room)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) Len() int {
+	return len(b.buf) + int(b.dropped)
+}
+
+// String returns the captured output followed by a truncation marker if
+// anything was dropped. A multi-byte character cut at the limit is removed.
+func (b *cappedBuffer) String() string {
+	if b.dropped == 0 {
+		return string(b.buf)
+	}
+	end := len(b.buf)
+	for i := end - 1; i >= 0 && i >= end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b.buf[i]) {
+			if !utf8.FullRune(b.buf[i:end]) {
+				end = i
+			}
+			break
+		}
+	}
+	dropped := b.dropped + int64(len(b.buf)-end)
+	return string(b.buf[:end]) + fmt.Sprintf("\n[output truncated, %d more bytes]", dropped)
+}
+
+// outputStreamer collects a command's output and periodically sends what is
+// new to the user, so long-running commands show progress.
+type outputStreamer struct {
+	mu        sync.Mutex
+	pending   []byte
+	truncated bool
+
+	send   func(content string)
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func startOutputStreamer(interval time.Duration, send func(content string)) *outputStreamer {
+	s := &outputStreamer{
+		send:   send,
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+func (s *outputStreamer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, p...)
+	if len(s.pending) > maxStreamChunk {
+		s.pending = s.pending[len(s.pending)-maxStreamChunk:]
+		s.truncated = true
+	}
+	return len(p), nil
+}
+
+func (s *outputStreamer) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush sends the output written since the last flush, if any.
+func (s *outputStreamer) flush() {
+	s.mu.Lock()
+	chunk := s.pending
+	truncated := s.truncated
+	s.pending = nil
+	s.truncated = false
+	s.mu.Unlock()
+
+	if len(chunk) == 0 {
+		return
+	}
+	if truncated {
+		// Older output was dropped; start at the next full character
+		for len(chunk) > 0 && !utf8.RuneStart(chunk[0]) {
+			chunk = chunk[1:]
+		}
+		s.send("...\n" + string(chunk))
+		return
+	}
+	s.send(string(chunk))
+}
+
+// stop ends streaming. Output not yet sent is left to the final result.
+func (s *outputStreamer) stop() {
+	close(s.stopCh)
+	<-s.done
+}
@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCappedBuffer_Boundary(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"under limit", []string{"abc"}, "abc"},
+		{"exactly at limit", []string{"abcde"}, "abcde"},
+		{"one over limit", []string{"abcdef"}, "abcde\n[output truncated, 1 more bytes]"},
+		{"across writes", []string{"abc", "def", "gh"}, "abcde\n[output truncated, 3 more bytes]"},
+		{"after limit reached", []string{"abcde", "fg"}, "abcde\n[output truncated, 2 more bytes]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCappedBuffer(5)
+			for _, w := range tt.writes {
+				n, err := b.Write([]byte(w))
+				if n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v; want %d, nil", w, n, err, len(w))
+				}
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer_DoesNotSplitCharacters(t *testing.T) {
+	b := newCappedBuffer(5)
+	b.Write([]byte("abcä€")) // "ä" is 2 bytes, so the limit falls inside "€"
+
+	got := b.String()
+	if got != "abcä\n[output truncated, 3 more bytes]" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestOutputStreamer_SendsNewOutput(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	s := startOutputStreamer(10*time.Millisecond, func(content string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, content)
+	})
+
+	s.Write([]byte("first\n"))
+	time.Sleep(50 * time.Millisecond)
+	s.Write([]byte(strings.Repeat("x", maxStreamChunk) + "last"))
+	time.Sleep(50 * time.Millisecond)
+	s.stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d messages, want 2: %q", len(sent), sent)
+	}
+	if sent[0] != "first\n" {
+		t.Errorf("first message = %q", sent[0])
+	}
+	if !strings.HasPrefix(sent[1], "...\n") || !strings.HasSuffix(sent[1], "last") ||
+		len(sent[1]) != len("...\n")+maxStreamChunk {
+		t.Errorf("second message should be the last %d bytes, got %d bytes", maxStreamChunk, len(sent[1]))
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 // TestShellTool_Success verifies successful command execution
@@ -272,3 +274,121 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		)
 	}
 }
+
+// TestShellTool_DeniedCommand verifies denied binaries are blocked wherever they appear
+func TestShellTool_DeniedCommand(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tools.Exec.DeniedCommands = []string{"curl"}
+	tool := NewExecToolWithConfig("", false, cfg)
+
+	for _, command := range []string{
+		"curl https://example.com",
+		"echo hi && /usr/bin/curl example.com",
+		"FOO=1 nohup curl example.com",
+		"ls | xargs -n 1 curl",
+		`bash -c "curl example.com"`,
+		"env -u HOME curl example.com",
+	} {
+		result := tool.Execute(context.Background(), map[string]any{"command": command})
+		if !result.IsError || result.ErrorKind != ErrorKindPermission {
+			t.Errorf("%q: expected permission error, got %+v", command, result)
+		}
+		if !strings.Contains(result.ForLLM, "curl is not allowed") {
+			t.Errorf("%q: unexpected message %q", command, result.ForLLM)
+		}
+	}
+
+	// Arguments naming a denied binary are fine, also after quoted separators
+	for _, command := range []string{"echo curl", `echo "a;curl"`} {
+		result := tool.Execute(context.Background(), map[string]any{"command": command})
+		if result.IsError {
+			t.Errorf("%q: expected echo to run, got %s", command, result.ForLLM)
+		}
+	}
+}
+
+// TestShellTool_DefaultDeniedCommands verifies the built-in denylist applies without config
+func TestShellTool_DefaultDeniedCommands(t *testing.T) {
+	tool := NewExecToolWithConfig("", false, &config.Config{})
+
+	result := tool.Execute(context.Background(), map[string]any{"command": "su root"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "su is not allowed") {
+		t.Errorf("expected su to be blocked, got %+v", result)
+	}
+
+	cfg := &config.Config{}
+	cfg.Tools.Exec.DeniedCommands = []string{}
+	tool = NewExecToolWithConfig("", false, cfg)
+	if guard := tool.guardCommand("su root", ""); guard != "" {
+		t.Errorf("expected empty denylist to allow su, got %q", guard)
+	}
+}
+
+// TestShellTool_AllowedCommands verifies only allowlisted binaries run
+func TestShellTool_AllowedCommands(t *testing.T) {
+	tool := NewExecTool("", false)
+	tool.SetAllowedCommands([]string{"echo", "grep"})
+
+	result := tool.Execute(context.Background(), map[string]any{"command": "echo hello 2>&1 | grep hello"})
+	if result.IsError {
+		t.Fatalf("expected allowed command to run, got %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "hello") {
+		t.Errorf("expected output, got %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"command": "echo hello; ls"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "ls is not in the allowed commands") {
+		t.Errorf("expected ls to be blocked, got %+v", result)
+	}
+}
+
+// TestShellTool_OutputLimitBoundary verifies output exactly at the limit is kept whole
+func TestShellTool_OutputLimitBoundary(t *testing.T) {
+	tool := NewExecTool("", false)
+	tool.SetMaxOutputBytes(100)
+
+	result := tool.Execute(context.Background(), map[string]any{"command": "printf '%0100d' 0"})
+	if result.ForLLM != strings.Repeat("0", 100) {
+		t.Errorf("expected 100 zeros untruncated, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"command": "printf '%0101d' 0"})
+	want := strings.Repeat("0", 100) + "\n[output truncated, 1 more bytes]"
+	if result.ForLLM != want {
+		t.Errorf("ForLLM = %q, want %q", result.ForLLM, want)
+	}
+}
+
+// TestShellTool_StreamOutput verifies partial output reaches the chat while the command runs
+func TestShellTool_StreamOutput(t *testing.T) {
+	tool := NewExecTool("", false)
+	tool.SetStreamInterval(50 * time.Millisecond)
+
+	streamed := make(chan string, 10)
+	tool.SetStreamCallback(func(channel, chatID, content, threadID string) error {
+		if channel != "telegram" || chatID != "42" {
+			t.Errorf("streamed to %s:%s, want telegram:42", channel, chatID)
+		}
+		streamed <- content
+		return nil
+	})
+	tool.SetContext("telegram", "42", "")
+
+	result := tool.Execute(context.Background(), map[string]any{"command": "echo first; sleep 0.5; echo second"})
+	if result.IsError {
+		t.Fatalf("command failed: %s", result.ForLLM)
+	}
+
+	select {
+	case content := <-streamed:
+		if content != "first\n" {
+			t.Errorf("streamed %q, want %q", content, "first\n")
+		}
+	default:
+		t.Fatal("expected partial output to be streamed")
+	}
+	if !strings.Contains(result.ForLLM, "first") || !strings.Contains(result.ForLLM, "second") {
+		t.Errorf("final result should contain all output, got %q", result.ForLLM)
+	}
+}
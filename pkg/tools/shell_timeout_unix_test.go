@@ -11,6 +11,8 @@ import (
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 func processExists(pid int) bool {
@@ -59,3 +61,47 @@ func TestShellTool_TimeoutKillsChildProcess(t *testing.T) {
 
 	t.Fatalf("child process %d is still running after timeout", childPID)
 }
+
+func TestShellTool_PerCommandTimeout(t *testing.T) {
+	tool := NewExecTool(t.TempDir(), false)
+
+	start := time.Now()
+	result := tool.Execute(context.Background(), map[string]any{
+		"command":         "echo started; sleep 9999",
+		"timeout_seconds": 0.3,
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command was not killed at its timeout, took %v", elapsed)
+	}
+	if !result.IsError {
+		t.Fatalf("expected timeout error, got success: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "timed out after 300ms and was killed") {
+		t.Errorf("expected clear timeout message, got: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "started") {
+		t.Errorf("expected output before the timeout, got: %s", result.ForLLM)
+	}
+}
+
+func TestShellTool_TimeoutCappedByConfig(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tools.Exec.TimeoutSeconds = 1
+	tool := NewExecToolWithConfig(t.TempDir(), false, cfg)
+
+	if got := tool.commandTimeout(map[string]any{"timeout_seconds": float64(3600)}); got != time.Second {
+		t.Errorf("timeout = %v, want configured limit of 1s", got)
+	}
+	if got := tool.commandTimeout(map[string]any{}); got != time.Second {
+		t.Errorf("default timeout = %v, want 1s", got)
+	}
+
+	start := time.Now()
+	result := tool.Execute(context.Background(), map[string]any{"command": "sleep 9999"})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("command was not killed at the configured timeout, took %v", elapsed)
+	}
+	if !result.IsError || !strings.Contains(result.ForLLM, "timed out after 1s") {
+		t.Errorf("expected timeout error, got: %s", result.ForLLM)
+	}
+}
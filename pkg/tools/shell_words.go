@@ -0,0 +1,370 @@
+package tools
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// The command checks below are a best-effort denylist, not a sandbox: they
+// follow quoting, command substitutions, common wrappers and "sh -c"
+// payloads, but a command assembled at run time (e.g. from variables or a
+// script file) is not seen.
+
+// maxShellNesting bounds how deep wrapper and "sh -c" payloads are followed.
+const maxShellNesting = 8
+
+// commandWrapper describes a command that runs its arguments as a command,
+// so the binary it wraps is checked too.
+type commandWrapper struct {
+	valueOpts  []string // options taking the next argument as value
+	splitOpt   string   // option whose value is a command line, e.g. env -S
+	positional int      // arguments between the options and the command
+}
+
+var commandWrappers = map[string]commandWrapper{
+	"env":     {valueOpts: []string{"-u", "--unset", "-C", "--chdir"}, splitOpt: "-S"},
+	"command": {},
+	"builtin": {},
+	"exec":    {valueOpts: []string{"-a"}},
+	"nohup":   {},
+	"setsid":  {},
+	"time":    {valueOpts: []string{"-f", "--format", "-o", "--output"}},
+	"nice":    {valueOpts: []string{"-n", "--adjustment"}},
+	"ionice":  {valueOpts: []string{"-c", "--class", "-n", "--classdata"}},
+	"timeout": {valueOpts: []string{"-s", "--signal", "-k", "--kill-after"}, positional: 1},
+	"stdbuf":  {valueOpts: []string{"-i", "-o", "-e"}},
+	"xargs": {valueOpts: []string{
+		"-a", "--arg-file", "-d", "--delimiter", "-E", "-I", "-L", "--max-lines",
+		"-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars",
+	}},
+	"sudo":    {valueOpts: []string{"-u", "--user", "-g", "--group", "-C", "-h", "--host", "-p", "--prompt", "-U"}},
+	"doas":    {valueOpts: []string{"-u", "-C"}},
+	"busybox": {},
+}
+
+// commandShells run the command line given with -c.
+var commandShells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "fish": true,
+}
+
+// commandNames returns the binaries a shell command line runs, e.g.
+// ["cd", "git"] for "cd repo && FOO=1 git status". Wrappers such as env,
+// xargs or timeout and "bash -c" payloads are followed, so both the wrapper
+// and the command it runs are returned.
+func commandNames(command string) []string {
+	var names []string
+	for _, words := range splitShellCommands(command) {
+		names = append(names, invokedCommands(words, 0)...)
+	}
+	return names
+}
+
+// invokedCommands returns the binary the simple command words runs, and
+// what that binary runs in turn if it is a wrapper or a shell.
+func invokedCommands(words []string, depth int) []string {
+	for len(words) > 0 && isAssignment(words[0]) {
+		words = words[1:] // VAR=value
+	}
+	if len(words) == 0 || depth > maxShellNesting {
+		return nil
+	}
+	name := normalizeCommandName(words[0])
+	if name == "" {
+		return nil
+	}
+	names := []string{name}
+	args := words[1:]
+
+	var inner [][]string
+	if payload, ok := shellPayload(name, args); ok {
+		inner = splitShellCommands(payload)
+	} else if wrapper, ok := commandWrappers[name]; ok {
+		inner = [][]string{wrapper.command(args)}
+	}
+	for _, words := range inner {
+		names = append(names, invokedCommands(words, depth+1)...)
+	}
+	return names
+}
+
+// command returns the words of the command the wrapper runs, given the
+// wrapper's arguments.
+func (w commandWrapper) command(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(opt, w.splitOpt); ok && w.splitOpt != "" {
+			if value == "" && len(args) > 0 {
+				value, args = args[0], args[1:]
+			}
+			if cmds := splitShellCommands(value); len(cmds) > 0 {
+				return append(cmds[0], args...)
+			}
+			continue
+		}
+		if slices.Contains(w.valueOpts, opt) && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	if len(args) < w.positional {
+		return nil
+	}
+	return args[w.positional:]
+}
+
+// shellPayload returns the command line run by "sh -c <payload>" or
+// "eval <args>".
+func shellPayload(name string, args []string) (string, bool) {
+	if name == "eval" {
+		return strings.Join(args, " "), len(args) > 0
+	}
+	if !commandShells[name] {
+		return "", false
+	}
+	hasC := false
+	for len(args) > 0 && (strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[0], "+")) {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" || opt == "-" {
+			break
+		}
+		if opt == "-o" || opt == "+o" || opt == "-O" || opt == "+O" {
+			if len(args) > 0 {
+				args = args[1:] // option name, e.g. "-o pipefail"
+			}
+			continue
+		}
+		if !strings.HasPrefix(opt, "--") && strings.ContainsRune(opt[1:], 'c') {
+			hasC = true
+		}
+		if opt == "--command" {
+			hasC = true
+		}
+	}
+	if !hasC || len(args) == 0 {
+		return "", false
+	}
+	return args[0], true
+}
+
+// isAssignment reports whether word is a variable assignment, e.g. FOO=1.
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCommandName reduces a command word to its binary name, so
+// "/usr/bin/sudo", "'sudo'" and "SUDO.exe" all become "sudo". Variants such
+// as "mkfs.ext4" match their base name.
+func normalizeCommandName(word string) string {
+	name := strings.ToLower(strings.Trim(word, `"'\`))
+	if name == "" {
+		return ""
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// splitShellCommands splits a shell command line into simple commands,
+// each a list of words with quoting removed. Separators inside quotes do not
+// split; command substitutions, $(...) and `...`, become commands of their
+// own, also inside double quotes. Redirections and comments are dropped.
+func splitShellCommands(line string) [][]string {
+	s := &shellSplitter{src: []rune(line)}
+	s.parse(0)
+	return s.commands
+}
+
+type shellSplitter struct {
+	src      []rune
+	pos      int
+	commands [][]string
+}
+
+func (s *shellSplitter) peek(offset int) rune {
+	if s.pos+offset < len(s.src) {
+		return s.src[s.pos+offset]
+	}
+	return 0
+}
+
+// parse reads commands until the end of the input or, if closing is not 0,
+// until the unquoted closing rune of a substitution, which it consumes.
+func (s *shellSplitter) parse(closing rune) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	skipWord := false // the next word is a redirection target
+	endWord := func() {
+		if inWord {
+			if !skipWord {
+				words = append(words, word.String())
+			}
+			skipWord = false
+		}
+		word.Reset()
+		inWord = false
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			s.commands = append(s.commands, words)
+		}
+		words = nil
+	}
+
+	for s.pos < len(s.src) {
+		r := s.src[s.pos]
+		s.pos++
+		switch {
+		case r == closing:
+			endCommand()
+			return
+		case r == '\\':
+			if s.pos < len(s.src) {
+				if s.src[s.pos] != '\n' {
+					word.WriteRune(s.src[s.pos])
+					inWord = true
+				}
+				s.pos++
+			}
+		case r == '\'':
+			inWord = true
+			for s.pos < len(s.src) && s.src[s.pos] != '\'' {
+				word.WriteRune(s.src[s.pos])
+				s.pos++
+			}
+			s.pos++
+		case r == '"':
+			inWord = true
+			s.doubleQuoted(&word)
+		case r == '`':
+			inWord = true
+			s.parse('`')
+		case r == '$' && s.peek(0) == '(':
+			inWord = true
+			s.pos++
+			if s.peek(0) == '(' {
+				s.skipArithmetic()
+			} else {
+				s.parse(')')
+			}
+		case r == '#' && !inWord:
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case r == '<' || r == '>':
+			// A file descriptor number before the operator belongs to it
+			if inWord && isDigits(word.String()) {
+				word.Reset()
+				inWord = false
+			} else {
+				endWord()
+			}
+			skipWord = s.redirection()
+		case strings.ContainsRune(";&|\n()", r):
+			endCommand()
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endCommand()
+}
+
+// redirection consumes the rest of a redirection operator after its first
+// '<' or '>' and reports whether a target word follows. Process
+// substitutions, <(...) and >(...), are parsed as commands.
+func (s *shellSplitter) redirection() bool {
+	for s.peek(0) == '<' || s.peek(0) == '>' || s.peek(0) == '|' {
+		s.pos++
+	}
+	switch s.peek(0) {
+	case '(':
+		s.pos++
+		s.parse(')')
+		return false
+	case '&':
+		s.pos++
+		// Duplicating a descriptor, e.g. 2>&1, has no target word
+		if s.peek(0) == '-' || unicode.IsDigit(s.peek(0)) {
+			for s.peek(0) == '-' || unicode.IsDigit(s.peek(0)) {
+				s.pos++
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// doubleQuoted reads a double-quoted string up to its closing quote into
+// word. Substitutions in it are parsed as commands.
+func (s *shellSplitter) doubleQuoted(word *strings.Builder) {
+	for s.pos < len(s.src) {
+		r := s.src[s.pos]
+		s.pos++
+		switch {
+		case r == '"':
+			return
+		case r == '\\' && s.pos < len(s.src) && strings.ContainsRune("$`\"\\\n", s.src[s.pos]):
+			word.WriteRune(s.src[s.pos])
+			s.pos++
+		case r == '`':
+			s.parse('`')
+		case r == '$' && s.peek(0) == '(':
+			s.pos++
+			if s.peek(0) == '(' {
+				s.skipArithmetic()
+			} else {
+				s.parse(')')
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+}
+
+// skipArithmetic skips an arithmetic expansion $((...)) after its "$(".
+func (s *shellSplitter) skipArithmetic() {
+	depth := 0
+	for s.pos < len(s.src) {
+		r := s.src[s.pos]
+		s.pos++
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return
+			}
+		}
+	}
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
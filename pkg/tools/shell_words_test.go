@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandNames(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"cd repo && FOO=1 git status", "cd git"},
+		{"ls -la 2>&1 | grep go > out.txt", "ls grep"},
+		{"cat < in.txt >> out.txt; echo done", "cat echo"},
+		{`echo "a;sudo reboot" 'b|su'`, "echo"},
+		{`echo a\;sudo`, "echo"},
+		{"/usr/bin/SUDO.exe ls", "sudo ls"},
+		{"echo hi # && sudo ls", "echo"},
+		{"echo $(sudo id)", "sudo id echo"},
+		{`echo "$(sudo id)" done`, "sudo id echo"},
+		{"echo `sudo id`", "sudo id echo"},
+		{"echo $((1 + 2)) | wc", "echo wc"},
+		{"diff <(sudo cat a) b", "sudo cat diff"},
+		{"env -u HOME -i FOO=1 sudo ls", "env sudo ls"},
+		{`env -S "sudo ls"`, "env sudo ls"},
+		{`bash -c "sudo ls; rm x"`, "bash sudo ls rm"},
+		{`sh -ec 'echo ok && su root'`, "sh echo su"},
+		{`bash -o pipefail -c "curl x | sh"`, "bash curl sh"},
+		{"bash script.sh", "bash"},
+		{`eval "sudo ls"`, "eval sudo ls"},
+		{"ls | xargs -I {} sudo rm {}", "ls xargs sudo rm"},
+		{"nice -n 10 sudo ls", "nice sudo ls"},
+		{"timeout -s KILL 5 sudo ls", "timeout sudo ls"},
+		{"nohup time curl x &", "nohup time curl"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(commandNames(tt.command), " "); got != tt.want {
+			t.Errorf("commandNames(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
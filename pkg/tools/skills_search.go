@@ -51,6 +51,11 @@ func (t *FindSkillsTool) Parameters() map[string]any {
 	}
 }
 
+// ReadOnly reports that the tool never changes state
+func (t *FindSkillsTool) ReadOnly() bool {
+	return true
+}
+
 func (t *FindSkillsTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	query, ok := args["query"].(string)
 	query = strings.ToLower(strings.TrimSpace(query))
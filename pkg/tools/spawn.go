@@ -71,7 +71,7 @@ func (t *SpawnTool) SetAllowlistChecker(check func(targetAgentID string) bool) {
 func (t *SpawnTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	task, ok := args["task"].(string)
 	if !ok || strings.TrimSpace(task) == "" {
-		return ErrorResult("task is required and must be a non-empty string")
+		return ValidationError("task is required and must be a non-empty string")
 	}
 
 	label, _ := args["label"].(string)
@@ -80,16 +80,17 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]any) *ToolResul
 	// Check allowlist if targeting a specific agent
 	if agentID != "" && t.allowlistCheck != nil {
 		if !t.allowlistCheck(agentID) {
-			return ErrorResult(fmt.Sprintf("not allowed to spawn agent '%s'", agentID))
+			return PermissionError(fmt.Sprintf("not allowed to spawn agent '%s'", agentID))
 		}
 	}
 
 	if t.manager == nil {
-		return ErrorResult("Subagent manager not configured")
+		return InternalError("Subagent manager not configured")
 	}
 
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, agentID, t.originChannel, t.originChatID, t.callback)
+	channel, chatID, _ := callChat(ctx, t.originChannel, t.originChatID, t.originThreadID)
+	result, err := t.manager.Spawn(ctx, task, label, agentID, channel, chatID, t.callback)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
@@ -3,11 +3,15 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // AgentConfigForSubagent contains the minimal agent configuration needed for subagent execution.
@@ -32,16 +36,45 @@ type AgentRegistryForSubagent interface {
 	GetAgent(agentID string) (*AgentConfigForSubagent, bool)
 }
 
+// subagentLLMRetries is how many times a subagent retries a transient LLM error
+// before giving up on the task.
+const subagentLLMRetries = 2
+
 type SubagentTask struct {
-	ID            string
-	Task          string
-	Label         string
-	AgentID       string
-	OriginChannel string
-	OriginChatID  string
-	Status        string
-	Result        string
-	Created       int64
+	ID            string `json:"id"`
+	Task          string `json:"task"`
+	Label         string `json:"label,omitempty"`
+	AgentID       string `json:"agent_id,omitempty"`
+	OriginChannel string `json:"origin_channel"`
+	OriginChatID  string `json:"origin_chat_id"`
+	Status        string `json:"status"`
+	Result        string `json:"result,omitempty"`
+	// OutputFiles lists workspace-relative paths created or modified during the run.
+	OutputFiles []string `json:"output_files,omitempty"`
+	Created     int64    `json:"created"`
+	// Started is when the latest run started (Unix ms).
+	Started int64 `json:"started,omitempty"`
+	// Completed is when the latest run finished (Unix ms); 0 while running.
+	Completed int64 `json:"completed,omitempty"`
+	// Attempts counts how many times the task has been run (1 + retries).
+	Attempts int `json:"attempts,omitempty"`
+	// Iterations is the number of tool loop iterations of the latest run.
+	Iterations int `json:"iterations,omitempty"`
+
+	announced bool
+}
+
+// Duration returns how long the latest run took, or 0 if it has not finished.
+func (t *SubagentTask) Duration() time.Duration {
+	started := t.Started
+	if started == 0 {
+		// Tasks saved before Started existed
+		started = t.Created
+	}
+	if t.Completed == 0 || t.Completed < started {
+		return 0
+	}
+	return time.Duration(t.Completed-started) * time.Millisecond
 }
 
 type SubagentManager struct {
@@ -59,6 +92,23 @@ type SubagentManager struct {
 	hasTemperature bool
 	nextID         int
 	registry       AgentRegistryForSubagent
+	storagePath    string // JSON file for task records; empty disables persistence
+	subagentModel  string // default model for subagents; empty means defaultModel
+	audit          *AuditLog
+	running        map[string]runningTask // task ID -> context of the current run
+	slots          chan struct{}          // limits synchronous runs; nil is unlimited
+	autoLabelWords int                    // words of an unlabeled task used as its label; 0 disables
+	announceTmpl   string                 // completion announcement; empty uses defaultAnnounceTemplate
+	// stopSequences looks up the stop sequences of a model; nil sends none
+	stopSequences func(model string) []string
+	// trimImpersonated cuts made-up user turns from subagent responses
+	trimImpersonated bool
+}
+
+// runningTask is the context a task's current run uses and its cancel.
+type runningTask struct {
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewSubagentManager(
@@ -68,15 +118,17 @@ func NewSubagentManager(
 	registry AgentRegistryForSubagent,
 ) *SubagentManager {
 	return &SubagentManager{
-		tasks:         make(map[string]*SubagentTask),
-		provider:      provider,
-		defaultModel:  defaultModel,
-		bus:           bus,
-		workspace:     workspace,
-		tools:         NewToolRegistry(),
-		maxIterations: 10,
-		nextID:        1,
-		registry:      registry,
+		tasks:          make(map[string]*SubagentTask),
+		running:        make(map[string]runningTask),
+		provider:       provider,
+		defaultModel:   defaultModel,
+		bus:            bus,
+		workspace:      workspace,
+		tools:          NewToolRegistry(),
+		maxIterations:  10,
+		nextID:         1,
+		registry:       registry,
+		autoLabelWords: defaultAutoLabelWords,
 	}
 }
 
@@ -90,6 +142,158 @@ func (sm *SubagentManager) SetLLMOptions(maxTokens int, temperature float64) {
 	sm.hasTemperature = true
 }
 
+// SetAutoLabelWords sets how many leading words of the task text make up the
+// label of a task spawned without one. n <= 0 leaves such tasks unlabeled.
+func (sm *SubagentManager) SetAutoLabelWords(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.autoLabelWords = n
+}
+
+// SetDefaultSubagentModel sets the model used by subagents that have no
+// agent-specific model, typically a cheaper or faster one than the main agent's.
+// An empty model restores the main agent's default.
+func (sm *SubagentManager) SetDefaultSubagentModel(model string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.subagentModel = model
+}
+
+// SetStopSequences sets how the stop sequences of the model a subagent runs
+// on are looked up.
+func (sm *SubagentManager) SetStopSequences(resolve func(model string) []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.stopSequences = resolve
+}
+
+// SetTrimImpersonatedTurns sets whether subagent responses are cut at the
+// first line where the model starts writing the user's next turn.
+func (sm *SubagentManager) SetTrimImpersonatedTurns(trim bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.trimImpersonated = trim
+}
+
+// defaultSubagentModelLocked returns the model for subagents without their own.
+// Caller must hold sm.mu (read or write).
+func (sm *SubagentManager) defaultSubagentModelLocked() string {
+	if sm.subagentModel != "" {
+		return sm.subagentModel
+	}
+	return sm.defaultModel
+}
+
+// SetAnnounceTemplate sets the completion message sent to the main agent.
+// The placeholders {label}, {status}, {result}, {iterations}, {duration}
+// and {files} are replaced; an empty template restores the default.
+func (sm *SubagentManager) SetAnnounceTemplate(tmpl string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.announceTmpl = tmpl
+}
+
+// SetMaxConcurrent limits how many synchronous subagents run at once.
+// Further runs wait for a free slot. n <= 0 removes the limit.
+func (sm *SubagentManager) SetMaxConcurrent(n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if n <= 0 {
+		sm.slots = nil
+		return
+	}
+	sm.slots = make(chan struct{}, n)
+}
+
+// acquireSlot waits for a free synchronous run slot. The returned func
+// releases it.
+func (sm *SubagentManager) acquireSlot(ctx context.Context) (func(), error) {
+	sm.mu.RLock()
+	slots := sm.slots
+	sm.mu.RUnlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runSync runs task to completion in the caller's goroutine, once a
+// concurrency slot is free.
+func (sm *SubagentManager) runSync(
+	ctx context.Context,
+	task, channel, chatID string,
+	onIteration func(ToolLoopProgress),
+) (*ToolLoopResult, error) {
+	release, err := sm.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	messages := []providers.Message{
+		{
+			Role:    "system",
+			Content: "You are a subagent. Complete the given task independently and provide a clear, concise result.",
+		},
+		{
+			Role:    "user",
+			Content: task,
+		},
+	}
+
+	// Use RunToolLoop to execute with tools (same as async SpawnTool)
+	sm.mu.RLock()
+	tools := sm.tools
+	maxIter := sm.maxIterations
+	maxTokens := sm.maxTokens
+	temperature := sm.temperature
+	hasMaxTokens := sm.hasMaxTokens
+	hasTemperature := sm.hasTemperature
+	model := sm.defaultSubagentModelLocked()
+	audit := sm.audit
+	resolveStops := sm.stopSequences
+	trimImpersonated := sm.trimImpersonated
+	sm.mu.RUnlock()
+
+	var stopSequences []string
+	if resolveStops != nil {
+		stopSequences = resolveStops(model)
+	}
+
+	loopConfig := ToolLoopConfig{
+		Provider:              sm.provider,
+		Model:                 model,
+		Tools:                 tools,
+		MaxIterations:         maxIter,
+		MaxRetries:            subagentLLMRetries,
+		StopSequences:         stopSequences,
+		Audit:                 audit,
+		SessionKey:            "subagent:sync",
+		OnIteration:           onIteration,
+		TrimImpersonatedTurns: trimImpersonated,
+	}
+	if hasMaxTokens {
+		loopConfig.MaxTokens = maxTokens
+	}
+	if hasTemperature {
+		loopConfig.Temperature = &temperature
+	}
+
+	return RunToolLoop(ctx, loopConfig, messages, channel, chatID, "")
+}
+
+// SetAuditLog records the tool executions of subagents in audit.
+func (sm *SubagentManager) SetAuditLog(audit *AuditLog) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.audit = audit
+}
+
 // SetTools sets the tool registry for subagent execution.
 // If not set, subagent will have access to the provided tools.
 func (sm *SubagentManager) SetTools(tools *ToolRegistry) {
@@ -128,6 +332,10 @@ func (sm *SubagentManager) Spawn(
 	taskID := fmt.Sprintf("subagent-%d", sm.nextID)
 	sm.nextID++
 
+	if strings.TrimSpace(label) == "" && sm.autoLabelWords > 0 {
+		label = generateTaskLabel(task, sm.autoLabelWords)
+	}
+
 	subagentTask := &SubagentTask{
 		ID:            taskID,
 		Task:          task,
@@ -137,11 +345,14 @@ func (sm *SubagentManager) Spawn(
 		OriginChatID:  originChatID,
 		Status:        "running",
 		Created:       time.Now().UnixMilli(),
+		Attempts:      1,
 	}
 	sm.tasks[taskID] = subagentTask
+	sm.persistLocked()
 
-	// Start task in background with context cancellation support
-	go sm.runTask(ctx, subagentTask, callback)
+	// Start task in background; it outlives the request that spawned it
+	// and is stopped through CancelTasks
+	go sm.runTask(sm.taskContextLocked(ctx, taskID), subagentTask, callback)
 
 	if label != "" {
 		return fmt.Sprintf("Spawned subagent '%s' for task: %s", label, task), nil
@@ -149,9 +360,87 @@ func (sm *SubagentManager) Spawn(
 	return fmt.Sprintf("Spawned subagent for task: %s", task), nil
 }
 
+// RetryTask re-runs a task that did not complete (failed, canceled,
+// truncated or interrupted) with its original task, label and agent. The task keeps its ID;
+// its status is reset to running and a new announcement is sent when it ends.
+func (sm *SubagentManager) RetryTask(ctx context.Context, taskID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	task, ok := sm.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("subagent task %s not found", taskID)
+	}
+	switch task.Status {
+	case "failed", "canceled", "truncated", "interrupted":
+	default:
+		return fmt.Errorf("subagent task %s is %s and cannot be retried", taskID, task.Status)
+	}
+
+	task.Status = "running"
+	task.Result = ""
+	task.OutputFiles = nil
+	task.Completed = 0
+	task.Attempts++
+	task.announced = false
+	sm.persistLocked()
+
+	go sm.runTask(sm.taskContextLocked(ctx, taskID), task, nil)
+	return nil
+}
+
+// taskContextLocked returns the context a task runs with: the values of ctx
+// without its cancellation, cancelled by CancelTasks instead. Caller must
+// hold sm.mu.
+func (sm *SubagentManager) taskContextLocked(ctx context.Context, taskID string) context.Context {
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	sm.running[taskID] = runningTask{ctx: taskCtx, cancel: cancel}
+	return taskCtx
+}
+
+// releaseTask drops a finished run of a task. A retry may already have
+// started a new run, which is left alone.
+func (sm *SubagentManager) releaseTask(ctx context.Context, taskID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if run, ok := sm.running[taskID]; ok && run.ctx == ctx {
+		run.cancel()
+		delete(sm.running, taskID)
+	}
+}
+
+// CancelTasks cancels the running tasks spawned from the given chat and
+// returns how many were cancelled. Empty channel and chatID cancel all
+// running tasks.
+func (sm *SubagentManager) CancelTasks(channel, chatID string) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	canceled := 0
+	for taskID, run := range sm.running {
+		task, ok := sm.tasks[taskID]
+		if !ok {
+			continue
+		}
+		if channel != "" && task.OriginChannel != channel {
+			continue
+		}
+		if chatID != "" && task.OriginChatID != chatID {
+			continue
+		}
+		run.cancel()
+		canceled++
+	}
+	return canceled
+}
+
 func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, callback AsyncCallback) {
+	defer sm.releaseTask(ctx, task.ID)
+
+	sm.mu.Lock()
 	task.Status = "running"
-	task.Created = time.Now().UnixMilli()
+	task.Started = time.Now().UnixMilli()
+	sm.mu.Unlock()
 
 	// Default values for subagent without specific agent config
 	var systemPrompt string
@@ -162,6 +451,15 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 	var temperature float64
 	var hasMaxTokens bool
 	var hasTemperature bool
+	var stopSequences []string
+	workspace := sm.workspace
+
+	sm.mu.RLock()
+	fallbackModel := sm.defaultSubagentModelLocked()
+	audit := sm.audit
+	resolveStops := sm.stopSequences
+	trimImpersonated := sm.trimImpersonated
+	sm.mu.RUnlock()
 
 	// Load agent configuration if agent_id is specified
 	if task.AgentID != "" && sm.registry != nil {
@@ -173,12 +471,15 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 			}
 			model = agentConfig.Model
 			if model == "" {
-				model = sm.defaultModel
+				model = fallbackModel
 			}
 			tools = agentConfig.Tools
 			if tools == nil {
 				tools = sm.tools
 			}
+			if agentConfig.Workspace != "" {
+				workspace = agentConfig.Workspace
+			}
 			maxIter = agentConfig.MaxIterations
 			if maxIter == 0 {
 				maxIter = sm.maxIterations
@@ -190,14 +491,14 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 		} else {
 			// Agent not found, use defaults
 			systemPrompt = sm.buildDefaultSubagentPrompt(task.AgentID)
-			model = sm.defaultModel
+			model = fallbackModel
 			tools = sm.tools
 			maxIter = sm.maxIterations
 		}
 	} else {
 		// No agent specified, use default subagent configuration
 		systemPrompt = sm.buildDefaultSubagentPrompt("")
-		model = sm.defaultModel
+		model = fallbackModel
 		tools = sm.tools
 		maxIter = sm.maxIterations
 	}
@@ -229,29 +530,44 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 		sm.mu.Lock()
 		task.Status = "canceled"
 		task.Result = "Task canceled before execution"
+		task.Completed = time.Now().UnixMilli()
+		metrics.SubagentTasks.Inc(task.Status)
+		sm.persistLocked()
+		sm.announce(task)
 		sm.mu.Unlock()
+		if callback != nil {
+			callback(ctx, &ToolResult{ForLLM: task.Result, IsError: true, Err: ctx.Err()})
+		}
 		return
 	default:
 	}
 
-	var llmOptions map[string]any
-	if hasMaxTokens || hasTemperature {
-		llmOptions = map[string]any{}
-		if hasMaxTokens {
-			llmOptions["max_tokens"] = maxTokens
-		}
-		if hasTemperature {
-			llmOptions["temperature"] = temperature
-		}
+	if resolveStops != nil {
+		stopSequences = resolveStops(model)
+	}
+
+	loopConfig := ToolLoopConfig{
+		Provider:              sm.provider,
+		Model:                 model,
+		Tools:                 tools,
+		MaxIterations:         maxIter,
+		MaxRetries:            subagentLLMRetries,
+		StopSequences:         stopSequences,
+		Audit:                 audit,
+		SessionKey:            "subagent:" + task.ID,
+		TrimImpersonatedTurns: trimImpersonated,
+	}
+	if hasMaxTokens {
+		loopConfig.MaxTokens = maxTokens
+	}
+	if hasTemperature {
+		loopConfig.Temperature = &temperature
 	}
 
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         model,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
-	}, messages, task.OriginChannel, task.OriginChatID, "")
+	// Record the files the subagent's tool calls write so they can be reported back
+	runCtx, written := withFileRecorder(ctx)
+	loopResult, err := RunToolLoop(runCtx, loopConfig, messages, task.OriginChannel, task.OriginChatID, "")
+	outputFiles := written.files(workspace)
 
 	sm.mu.Lock()
 	var result *ToolResult
@@ -263,12 +579,15 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 		}
 	}()
 
+	task.Status = subagentStatus(loopResult.TerminationReason)
+	task.OutputFiles = outputFiles
+	task.Iterations = loopResult.Iterations
+	task.Completed = time.Now().UnixMilli()
+	metrics.SubagentTasks.Inc(task.Status)
+
 	if err != nil {
-		task.Status = "failed"
 		task.Result = fmt.Sprintf("Error: %v", err)
-		// Check if it was canceled
-		if ctx.Err() != nil {
-			task.Status = "canceled"
+		if task.Status == "canceled" {
 			task.Result = "Task canceled during execution"
 		}
 		result = &ToolResult{
@@ -280,32 +599,90 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 			Err:     err,
 		}
 	} else {
-		task.Status = "completed"
 		task.Result = loopResult.Content
 		result = &ToolResult{
 			ForLLM: fmt.Sprintf(
-				"Subagent '%s' completed (iterations: %d): %s",
+				"Subagent '%s' %s (iterations: %d): %s%s",
 				task.Label,
+				task.Status,
 				loopResult.Iterations,
 				loopResult.Content,
+				formatOutputFiles(outputFiles),
 			),
-			ForUser: loopResult.Content,
+			ForUser: utils.SanitizeMarkdown(loopResult.Content),
 			Silent:  false,
 			IsError: false,
 			Async:   false,
 		}
 	}
 
+	sm.persistLocked()
+
 	// Send announce message back to main agent
-	if sm.bus != nil {
-		announceContent := fmt.Sprintf("Task '%s' completed.\n\nResult:\n%s", task.Label, task.Result)
-		sm.bus.PublishInbound(bus.InboundMessage{
-			Channel:  "system",
-			SenderID: fmt.Sprintf("subagent:%s", task.ID),
-			// Format: "original_channel:original_chat_id" for routing back
-			ChatID:  fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
-			Content: announceContent,
-		})
+	sm.announce(task)
+}
+
+// announce publishes the task's completion message to the main agent.
+// It is idempotent per task: a task is announced at most once, and the
+// message carries a dedupe key so the bus drops redeliveries as well.
+// Caller must hold sm.mu.
+func (sm *SubagentManager) announce(task *SubagentTask) {
+	if sm.bus == nil || task.announced {
+		return
+	}
+	task.announced = true
+
+	announceContent := formatAnnouncement(sm.announceTmpl, task)
+	sm.bus.PublishInbound(bus.InboundMessage{
+		Channel:  "system",
+		SenderID: fmt.Sprintf("subagent:%s", task.ID),
+		// Format: "original_channel:original_chat_id" for routing back
+		ChatID:    fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
+		Content:   announceContent,
+		DedupeKey: fmt.Sprintf("subagent-announce:%s:%d", task.ID, task.Attempts),
+	})
+}
+
+// defaultAnnounceTemplate is the completion message when none is configured.
+const defaultAnnounceTemplate = "Task '{label}' {status} in {duration}.\n\nResult:\n{result}{files}"
+
+// formatAnnouncement renders the completion message of task from tmpl.
+func formatAnnouncement(tmpl string, task *SubagentTask) string {
+	if tmpl == "" {
+		tmpl = defaultAnnounceTemplate
+	}
+	return strings.NewReplacer(
+		"{label}", task.Label,
+		"{status}", task.Status,
+		"{result}", task.Result,
+		"{iterations}", strconv.Itoa(task.Iterations),
+		"{duration}", formatTaskDuration(task.Duration()),
+		"{files}", formatOutputFiles(task.OutputFiles),
+	).Replace(tmpl)
+}
+
+// formatTaskDuration rounds d for display: to seconds, or to milliseconds
+// below one second.
+func formatTaskDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// subagentStatus maps a tool loop termination reason to a SubagentTask status.
+// A task that ran out of iterations is reported as "truncated" so the parent
+// agent knows the result may be incomplete.
+func subagentStatus(reason TerminationReason) string {
+	switch reason {
+	case TerminationCompleted:
+		return "completed"
+	case TerminationMaxIterations:
+		return "truncated"
+	case TerminationCanceled:
+		return "canceled"
+	default:
+		return "failed"
 	}
 }
 
@@ -327,6 +704,18 @@ func (sm *SubagentManager) ListTasks() []*SubagentTask {
 	return tasks
 }
 
+// TaskCounts returns the number of tasks in each status.
+func (sm *SubagentManager) TaskCounts() map[string]int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, task := range sm.tasks {
+		counts[task.Status]++
+	}
+	return counts
+}
+
 // SubagentTool executes a subagent task synchronously and returns the result.
 // Unlike SpawnTool which runs tasks asynchronously, SubagentTool waits for completion
 // and returns the result directly in the ToolResult.
@@ -378,6 +767,45 @@ func (t *SubagentTool) SetContext(channel, chatID, threadID string) {
 }
 
 func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	return t.run(ctx, args, nil)
+}
+
+// SubagentEvent is one item of an ExecuteStream channel: either the progress
+// of a finished iteration or, as the last event, the final result.
+type SubagentEvent struct {
+	Progress *ToolLoopProgress
+	Result   *ToolResult
+}
+
+// ExecuteStream runs the subagent like Execute but reports each iteration as
+// it finishes. The channel yields progress events, then one event carrying
+// the result, and is closed. Once ctx is canceled, events that do not fit
+// the channel's buffer are dropped, the result included, so the goroutine
+// never waits for a receiver that stopped reading.
+func (t *SubagentTool) ExecuteStream(ctx context.Context, args map[string]any) <-chan SubagentEvent {
+	events := make(chan SubagentEvent, 8)
+	go func() {
+		defer close(events)
+		send := func(ev SubagentEvent) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				// Still deliver the event if it fits the buffer
+				select {
+				case events <- ev:
+				default:
+				}
+			}
+		}
+		result := t.run(ctx, args, func(p ToolLoopProgress) {
+			send(SubagentEvent{Progress: &p})
+		})
+		send(SubagentEvent{Result: result})
+	}()
+	return events
+}
+
+func (t *SubagentTool) run(ctx context.Context, args map[string]any, onIteration func(ToolLoopProgress)) *ToolResult {
 	task, ok := args["task"].(string)
 	if !ok {
 		return ErrorResult("task is required").WithError(fmt.Errorf("task parameter is required"))
@@ -389,65 +817,24 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		return ErrorResult("Subagent manager not configured").WithError(fmt.Errorf("manager is nil"))
 	}
 
-	// Build messages for subagent
-	messages := []providers.Message{
-		{
-			Role:    "system",
-			Content: "You are a subagent. Complete the given task independently and provide a clear, concise result.",
-		},
-		{
-			Role:    "user",
-			Content: task,
-		},
-	}
-
-	// Use RunToolLoop to execute with tools (same as async SpawnTool)
-	sm := t.manager
-	sm.mu.RLock()
-	tools := sm.tools
-	maxIter := sm.maxIterations
-	maxTokens := sm.maxTokens
-	temperature := sm.temperature
-	hasMaxTokens := sm.hasMaxTokens
-	hasTemperature := sm.hasTemperature
-	sm.mu.RUnlock()
-
-	var llmOptions map[string]any
-	if hasMaxTokens || hasTemperature {
-		llmOptions = map[string]any{}
-		if hasMaxTokens {
-			llmOptions["max_tokens"] = maxTokens
-		}
-		if hasTemperature {
-			llmOptions["temperature"] = temperature
-		}
-	}
-
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         sm.defaultModel,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
-	}, messages, t.originChannel, t.originChatID, "")
+	channel, chatID, _ := callChat(ctx, t.originChannel, t.originChatID, t.originThreadID)
+	loopResult, err := t.manager.runSync(ctx, task, channel, chatID, onIteration)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
 	}
 
-	// ForUser: Brief summary for user (truncated if too long)
-	userContent := loopResult.Content
+	// ForUser: Brief summary for user (truncated if too long). Cutting the
+	// result can leave a code block or emphasis open, so repair the markdown.
 	maxUserLen := 500
-	if len(userContent) > maxUserLen {
-		userContent = userContent[:maxUserLen] + "..."
-	}
+	userContent := utils.SanitizeMarkdown(utils.Truncate(loopResult.Content, maxUserLen))
 
 	// ForLLM: Full execution details
 	labelStr := label
 	if labelStr == "" {
 		labelStr = "(unnamed)"
 	}
-	llmContent := fmt.Sprintf("Subagent task completed:\nLabel: %s\nIterations: %d\nResult: %s",
-		labelStr, loopResult.Iterations, loopResult.Content)
+	llmContent := fmt.Sprintf("Subagent task %s:\nLabel: %s\nIterations: %d\nResult: %s",
+		subagentStatus(loopResult.TerminationReason), labelStr, loopResult.Iterations, loopResult.Content)
 
 	return &ToolResult{
 		ForLLM:  llmContent,
@@ -0,0 +1,64 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// defaultAutoLabelWords is how many words of an unlabeled task make up
+	// its label by default.
+	defaultAutoLabelWords = 5
+	// maxAutoLabelRunes bounds a generated label, ellipsis included.
+	maxAutoLabelRunes = 40
+	// fallbackTaskLabel is used when the task text has no usable words.
+	fallbackTaskLabel = "task"
+)
+
+// generateTaskLabel derives a short label from the first maxWords words of
+// task. Only letters, digits and a few harmless punctuation marks are kept,
+// so the label cannot break the quoting or formatting of the messages it
+// appears in. A label cut short ends in "...".
+func generateTaskLabel(task string, maxWords int) string {
+	var words []string
+	for _, field := range strings.Fields(task) {
+		if word := sanitizeLabelWord(field); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return fallbackTaskLabel
+	}
+
+	truncated := false
+	if maxWords > 0 && len(words) > maxWords {
+		words = words[:maxWords]
+		truncated = true
+	}
+	label := []rune(strings.Join(words, " "))
+	if len(label) > maxAutoLabelRunes {
+		label = []rune(strings.TrimSpace(string(label[:maxAutoLabelRunes-3])))
+		truncated = true
+	}
+	if truncated {
+		return string(label) + "..."
+	}
+	return string(label)
+}
+
+// sanitizeLabelWord drops every rune of word that is not a letter, a digit
+// or one of - _ . / and trims dangling punctuation.
+func sanitizeLabelWord(word string) string {
+	var sb strings.Builder
+	for _, r := range word {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./", r) {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Trim(sb.String(), "-_./")
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGenerateTaskLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		task string
+		want string
+	}{
+		{"single word", "Summarize", "Summarize"},
+		{"short task", "check the weather", "check the weather"},
+		{"exact word limit", "one two three four five", "one two three four five"},
+		{"more words than limit", "search the web for the latest AI news", "search the web for the..."},
+		{"quotes and markdown", "Find 'foo' in *bar* `baz`!", "Find foo in bar baz"},
+		{"newlines and tabs", "line one\n\tline two", "line one line two"},
+		{"paths kept", "read ./docs/README.md please", "read docs/README.md please"},
+		{"unicode", "Übersetze diesen Text ins Französische", "Übersetze diesen Text ins Französische"},
+		{"only punctuation", "?!... ***", "task"},
+		{"empty", "   ", "task"},
+		{"long word", strings.Repeat("a", 100), strings.Repeat("a", 37) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateTaskLabel(tt.task, defaultAutoLabelWords)
+			if got != tt.want {
+				t.Errorf("generateTaskLabel(%q) = %q, want %q", tt.task, got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > maxAutoLabelRunes {
+				t.Errorf("label has %d runes, limit is %d", n, maxAutoLabelRunes)
+			}
+		})
+	}
+}
+
+func TestGenerateTaskLabel_LongWordsTruncatedToLimit(t *testing.T) {
+	got := generateTaskLabel("internationalization localization globalization accessibility", 5)
+	if utf8.RuneCountInString(got) > maxAutoLabelRunes || !strings.HasSuffix(got, "...") {
+		t.Errorf("label %q not truncated to %d runes", got, maxAutoLabelRunes)
+	}
+	if strings.Contains(got, " ...") {
+		t.Errorf("label %q ends in a dangling space", got)
+	}
+}
+
+func TestSubagentManager_SpawnAutoLabel(t *testing.T) {
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", "/tmp/test", nil, nil)
+
+	msg, err := manager.Spawn(context.Background(), "Check the 'status' of all servers now please", "", "", "cli", "direct", nil)
+	if err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	want := "Check the status of all..."
+	if !strings.Contains(msg, "'"+want+"'") {
+		t.Errorf("spawn message %q does not use the generated label", msg)
+	}
+	task, _ := manager.GetTask("subagent-1")
+	if task.Label != want {
+		t.Errorf("Label = %q, want %q", task.Label, want)
+	}
+
+	// An explicit label is kept
+	if _, err := manager.Spawn(context.Background(), "do it", "mine", "", "cli", "direct", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	if task, _ := manager.GetTask("subagent-2"); task.Label != "mine" {
+		t.Errorf("Label = %q, want mine", task.Label)
+	}
+
+	// Disabled generation leaves the task unlabeled
+	manager.SetAutoLabelWords(0)
+	if _, err := manager.Spawn(context.Background(), "do it", "", "", "cli", "direct", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	if task, _ := manager.GetTask("subagent-3"); task.Label != "" {
+		t.Errorf("Label = %q, want none", task.Label)
+	}
+	for _, id := range []string{"subagent-1", "subagent-2", "subagent-3"} {
+		waitForTaskStatus(t, manager, id, "completed")
+	}
+}
@@ -0,0 +1,93 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileRecorder collects the files written by file tools while a subagent
+// runs. Writes are recorded through the context of the tool call, so only
+// the subagent's own calls are attributed to it.
+type fileRecorder struct {
+	mu     sync.Mutex
+	paths  map[string]bool // absolute paths
+	parent *fileRecorder   // recorder of an enclosing run, e.g. the subagent that spawned this one
+}
+
+type fileRecorderKey struct{}
+
+// withFileRecorder returns a context whose file tool calls are recorded by
+// the returned recorder, as well as by any recorder ctx already has.
+func withFileRecorder(ctx context.Context) (context.Context, *fileRecorder) {
+	r := &fileRecorder{paths: make(map[string]bool)}
+	r.parent, _ = ctx.Value(fileRecorderKey{}).(*fileRecorder)
+	return context.WithValue(ctx, fileRecorderKey{}, r), r
+}
+
+// recordFileWrites records paths, written through sysFs, with the recorder
+// of ctx, if any.
+func recordFileWrites(ctx context.Context, sysFs fileSystem, paths ...string) {
+	r, _ := ctx.Value(fileRecorderKey{}).(*fileRecorder)
+	for _, path := range paths {
+		abs := absFilePath(sysFs, path)
+		for rec := r; rec != nil; rec = rec.parent {
+			rec.mu.Lock()
+			rec.paths[abs] = true
+			rec.mu.Unlock()
+		}
+	}
+}
+
+// absFilePath returns the absolute path sysFs writes for path: relative
+// paths are in the workspace of a sandboxFs and in the working directory
+// otherwise.
+func absFilePath(sysFs fileSystem, path string) string {
+	if sandbox, ok := sysFs.(*sandboxFs); ok && !filepath.IsAbs(path) {
+		path = filepath.Join(sandbox.workspace, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// files returns the recorded files, sorted: relative to workspace for files
+// in it and absolute for the others.
+func (r *fileRecorder) files(workspace string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	root, _ := filepath.Abs(workspace)
+	var files []string
+	for path := range r.paths {
+		if rel, err := filepath.Rel(root, path); err == nil && filepath.IsLocal(rel) {
+			path = filepath.ToSlash(rel)
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// formatOutputFiles renders a file list for the announce message.
+func formatOutputFiles(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\nFiles created or modified (relative to workspace):")
+	for _, f := range files {
+		sb.WriteString("\n- ")
+		sb.WriteString(f)
+	}
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fileWritingLLMProvider asks for a write_file call on the first turn and
+// answers directly on the second.
+type fileWritingLLMProvider struct {
+	calls int
+}
+
+func (m *fileWritingLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{
+				{
+					ID:   "call_1",
+					Name: "write_file",
+					Arguments: map[string]any{
+						"path":    "reports/summary.md",
+						"content": "# Summary",
+					},
+				},
+			},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "Wrote the report"}, nil
+}
+
+func (m *fileWritingLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentManager_RunTask_CollectsOutputFiles(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "existing.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(workspace, "sessions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	msgBus := bus.NewMessageBus()
+	manager := NewSubagentManager(&fileWritingLLMProvider{}, "test-model", workspace, msgBus, nil)
+	registry := NewToolRegistry()
+	registry.Register(NewWriteFileTool(workspace, true))
+	manager.SetTools(registry)
+
+	task := &SubagentTask{ID: "subagent-1", Task: "write a report", Label: "report"}
+	manager.runTask(context.Background(), task, nil)
+
+	want := []string{"reports/summary.md"}
+	if !reflect.DeepEqual(task.OutputFiles, want) {
+		t.Fatalf("OutputFiles = %v, want %v", task.OutputFiles, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected announce message")
+	}
+	if !strings.Contains(msg.Content, "- reports/summary.md") {
+		t.Errorf("announce message does not list output file: %q", msg.Content)
+	}
+}
+
+// concurrentWriteLLMProvider writes a file through its own tool, as the main
+// agent would while the subagent runs, then behaves like fileWritingLLMProvider.
+type concurrentWriteLLMProvider struct {
+	fileWritingLLMProvider
+	other *WriteFileTool
+}
+
+func (m *concurrentWriteLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	if m.calls == 0 {
+		m.other.Execute(context.Background(), map[string]any{"path": "main.txt", "content": "main agent"})
+	}
+	return m.fileWritingLLMProvider.Chat(ctx, messages, tools, model, options)
+}
+
+func TestSubagentManager_RunTask_IgnoresWritesOfOthers(t *testing.T) {
+	workspace := t.TempDir()
+	provider := &concurrentWriteLLMProvider{other: NewWriteFileTool(workspace, true)}
+	manager := NewSubagentManager(provider, "test-model", workspace, nil, nil)
+	registry := NewToolRegistry()
+	registry.Register(NewWriteFileTool(workspace, true))
+	manager.SetTools(registry)
+
+	task := &SubagentTask{ID: "subagent-1", Task: "write a report"}
+	manager.runTask(context.Background(), task, nil)
+
+	want := []string{"reports/summary.md"}
+	if !reflect.DeepEqual(task.OutputFiles, want) {
+		t.Errorf("OutputFiles = %v, want only the subagent's own file %v", task.OutputFiles, want)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "main.txt")); err != nil {
+		t.Fatalf("concurrent write did not happen: %v", err)
+	}
+}
+
+func TestFileRecorder(t *testing.T) {
+	workspace := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "out.txt")
+	sandbox := &sandboxFs{workspace: workspace}
+
+	ctx, outer := withFileRecorder(context.Background())
+	innerCtx, inner := withFileRecorder(ctx)
+
+	recordFileWrites(ctx, sandbox, "a.txt")
+	recordFileWrites(innerCtx, sandbox, "dir/b.txt", filepath.Join(workspace, "a.txt"))
+	recordFileWrites(innerCtx, &hostFs{}, outside)
+	recordFileWrites(context.Background(), sandbox, "untracked.txt")
+
+	if got, want := inner.files(workspace), []string{outside, "a.txt", "dir/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("inner files = %v, want %v", got, want)
+	}
+	// Writes of a nested run count for the enclosing one too
+	if got, want := outer.files(workspace), []string{outside, "a.txt", "dir/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("outer files = %v, want %v", got, want)
+	}
+	if _, empty := withFileRecorder(context.Background()); empty.files(workspace) != nil {
+		t.Errorf("files of an unused recorder = %v, want none", empty.files(workspace))
+	}
+}
@@ -0,0 +1,139 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Finished task records are dropped once they are older than
+// subagentTaskRetention, and beyond the newest maxFinishedSubagentTasks, so
+// the task list and its file stay small. Running tasks are always kept.
+const (
+	subagentTaskRetention    = 7 * 24 * time.Hour
+	maxFinishedSubagentTasks = 200
+)
+
+// SetStoragePath enables persistence of task records to a JSON file at path.
+// Existing records are loaded so GetTask/ListTasks keep working across
+// restarts. Tasks that were still running when the process stopped are
+// marked "interrupted"; they can be re-run with RetryTask.
+func (sm *SubagentManager) SetStoragePath(path string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.storagePath = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read subagent tasks: %w", err)
+	}
+
+	var tasks []*SubagentTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return fmt.Errorf("failed to parse subagent tasks: %w", err)
+	}
+
+	interrupted := 0
+	for _, task := range tasks {
+		if task == nil || task.ID == "" {
+			continue
+		}
+		if task.Status == "running" {
+			task.Status = "interrupted"
+			task.Result = "Task interrupted by restart"
+			interrupted++
+		}
+		// Loaded tasks were either announced already or interrupted mid-run
+		task.announced = true
+		sm.tasks[task.ID] = task
+
+		if n, err := strconv.Atoi(strings.TrimPrefix(task.ID, "subagent-")); err == nil && n >= sm.nextID {
+			sm.nextID = n + 1
+		}
+	}
+
+	logger.InfoCF("subagent", "Loaded subagent tasks",
+		map[string]any{
+			"path":        path,
+			"tasks":       len(tasks),
+			"interrupted": interrupted,
+		})
+
+	if sm.pruneTasksLocked(time.Now()) > 0 || interrupted > 0 {
+		sm.persistLocked()
+	}
+	return nil
+}
+
+// pruneTasksLocked drops finished task records that are too old or too
+// many and returns how many it dropped. Caller must hold sm.mu.
+func (sm *SubagentManager) pruneTasksLocked(now time.Time) int {
+	var finished []*SubagentTask
+	for _, task := range sm.tasks {
+		if task.Status != "running" {
+			finished = append(finished, task)
+		}
+	}
+	// Newest first; interrupted tasks never completed and count from creation
+	finishedAt := func(task *SubagentTask) int64 {
+		return max(task.Completed, task.Created)
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finishedAt(finished[i]) > finishedAt(finished[j])
+	})
+
+	cutoff := now.Add(-subagentTaskRetention).UnixMilli()
+	pruned := 0
+	for i, task := range finished {
+		if i >= maxFinishedSubagentTasks || finishedAt(task) < cutoff {
+			delete(sm.tasks, task.ID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// persistLocked prunes old task records and writes the rest to the storage
+// file, if configured. Errors are logged rather than returned so task
+// execution is never blocked by a failing disk. Caller must hold sm.mu.
+func (sm *SubagentManager) persistLocked() {
+	sm.pruneTasksLocked(time.Now())
+	if sm.storagePath == "" {
+		return
+	}
+
+	tasks := make([]*SubagentTask, 0, len(sm.tasks))
+	for _, task := range sm.tasks {
+		tasks = append(tasks, task)
+	}
+
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomic(sm.storagePath, data, 0o644)
+	}
+	if err != nil {
+		logger.ErrorCF("subagent", "Failed to persist subagent tasks",
+			map[string]any{
+				"path":  sm.storagePath,
+				"error": err.Error(),
+			})
+	}
+}
@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSubagentManager_PersistsTasks(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "state", "subagent_tasks.json")
+
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	manager.SetTools(NewToolRegistry())
+	if err := manager.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath failed: %v", err)
+	}
+	if _, err := manager.Spawn(context.Background(), "write docs", "docs", "", "telegram", "42", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := manager.ListTasks()[0].ID
+	waitForTaskStatus(t, manager, taskID, "completed")
+
+	reloaded := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := reloaded.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath (reload) failed: %v", err)
+	}
+
+	task, ok := reloaded.GetTask(taskID)
+	if !ok {
+		t.Fatalf("task %s not found after reload", taskID)
+	}
+	if task.Status != "completed" || task.Task != "write docs" || task.Label != "docs" ||
+		task.OriginChannel != "telegram" || task.OriginChatID != "42" {
+		t.Errorf("reloaded task = %+v", task)
+	}
+	if task.Result != "Task completed: write docs" {
+		t.Errorf("Result = %q", task.Result)
+	}
+
+	// New tasks must not reuse persisted IDs
+	reloaded.SetTools(NewToolRegistry())
+	if _, err := reloaded.Spawn(context.Background(), "next", "", "", "cli", "direct", nil); err != nil {
+		t.Fatalf("Spawn after reload failed: %v", err)
+	}
+	tasks := reloaded.ListTasks()
+	if got := len(tasks); got != 2 {
+		t.Fatalf("ListTasks() returned %d tasks, want 2", got)
+	}
+	// Let the new task finish persisting before the temp dir is removed
+	for _, task := range tasks {
+		if task.ID != taskID {
+			waitForTaskStatus(t, reloaded, task.ID, "completed")
+		}
+	}
+}
+
+func TestSubagentManager_RunningTaskInterruptedOnReload(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "subagent_tasks.json")
+
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := manager.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath failed: %v", err)
+	}
+	manager.mu.Lock()
+	manager.tasks["subagent-7"] = &SubagentTask{
+		ID: "subagent-7", Task: "long job", Status: "running", Attempts: 1, Created: time.Now().UnixMilli(),
+	}
+	manager.persistLocked()
+	manager.mu.Unlock()
+
+	reloaded := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := reloaded.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath (reload) failed: %v", err)
+	}
+
+	task, ok := reloaded.GetTask("subagent-7")
+	if !ok {
+		t.Fatal("task not found after reload")
+	}
+	if task.Status != "interrupted" {
+		t.Errorf("Status = %q, want interrupted", task.Status)
+	}
+
+	// Interrupted tasks can be retried
+	reloaded.SetTools(NewToolRegistry())
+	if err := reloaded.RetryTask(context.Background(), "subagent-7"); err != nil {
+		t.Fatalf("RetryTask failed: %v", err)
+	}
+	waitForTaskStatus(t, reloaded, "subagent-7", "completed")
+}
+
+func TestSubagentManager_TaskCanceledBeforeStartIsPersisted(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "subagent_tasks.json")
+	msgBus := bus.NewMessageBus()
+
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), msgBus, nil)
+	if err := manager.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath failed: %v", err)
+	}
+	task := &SubagentTask{ID: "subagent-3", Task: "late job", Label: "late", OriginChannel: "telegram", OriginChatID: "42"}
+	manager.mu.Lock()
+	manager.tasks[task.ID] = task
+	manager.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var result *ToolResult
+	manager.runTask(ctx, task, func(_ context.Context, r *ToolResult) { result = r })
+	if result == nil || !result.IsError {
+		t.Errorf("callback result = %+v, want an error", result)
+	}
+
+	reloaded := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := reloaded.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath (reload) failed: %v", err)
+	}
+	if got, ok := reloaded.GetTask(task.ID); !ok || got.Status != "canceled" {
+		t.Errorf("reloaded task = %+v, want it canceled", got)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	msg, ok := msgBus.ConsumeInbound(waitCtx)
+	if !ok {
+		t.Fatal("cancellation was not announced")
+	}
+	if msg.Channel != "system" || msg.ChatID != "telegram:42" || !strings.Contains(msg.Content, "canceled") {
+		t.Errorf("announcement = %+v", msg)
+	}
+}
+
+func TestSubagentManager_PrunesFinishedTasks(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "subagent_tasks.json")
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := manager.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath failed: %v", err)
+	}
+
+	now := time.Now()
+	old := now.Add(-subagentTaskRetention - time.Hour).UnixMilli()
+	manager.mu.Lock()
+	manager.tasks["subagent-1"] = &SubagentTask{ID: "subagent-1", Status: "completed", Created: old, Completed: old}
+	manager.tasks["subagent-2"] = &SubagentTask{ID: "subagent-2", Status: "running", Created: old}
+	for i := 0; i < maxFinishedSubagentTasks+5; i++ {
+		id := fmt.Sprintf("subagent-%d", 10+i)
+		at := now.Add(time.Duration(i) * time.Second).UnixMilli()
+		manager.tasks[id] = &SubagentTask{ID: id, Status: "failed", Created: at, Completed: at}
+	}
+	manager.persistLocked()
+	manager.mu.Unlock()
+
+	reloaded := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	if err := reloaded.SetStoragePath(storePath); err != nil {
+		t.Fatalf("SetStoragePath (reload) failed: %v", err)
+	}
+
+	if _, ok := reloaded.GetTask("subagent-1"); ok {
+		t.Error("task finished before the retention period was kept")
+	}
+	// The running task was interrupted by the reload and is old, so it goes too
+	if _, ok := reloaded.GetTask("subagent-2"); ok {
+		t.Error("old interrupted task was kept")
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := reloaded.GetTask(fmt.Sprintf("subagent-%d", 10+i)); ok {
+			t.Errorf("subagent-%d beyond the newest %d finished tasks was kept", 10+i, maxFinishedSubagentTasks)
+		}
+	}
+	if got := len(reloaded.ListTasks()); got != maxFinishedSubagentTasks {
+		t.Errorf("kept %d tasks, want %d", got, maxFinishedSubagentTasks)
+	}
+}
+
+func TestSubagentManager_PruneKeepsRunningTasks(t *testing.T) {
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	old := time.Now().Add(-subagentTaskRetention - time.Hour).UnixMilli()
+
+	manager.mu.Lock()
+	manager.tasks["subagent-1"] = &SubagentTask{ID: "subagent-1", Status: "running", Created: old}
+	pruned := manager.pruneTasksLocked(time.Now())
+	manager.mu.Unlock()
+
+	if pruned != 0 {
+		t.Errorf("pruned %d tasks, want a running task kept", pruned)
+	}
+}
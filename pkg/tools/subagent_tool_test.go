@@ -2,8 +2,14 @@ package tools
 
 import (
 	"context"
+	"errors"
+	"regexp"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -12,6 +18,7 @@ import (
 // MockLLMProvider is a test implementation of LLMProvider
 type MockLLMProvider struct {
 	lastOptions map[string]any
+	lastModel   string
 }
 
 func (m *MockLLMProvider) Chat(
@@ -22,6 +29,7 @@ func (m *MockLLMProvider) Chat(
 	options map[string]any,
 ) (*providers.LLMResponse, error) {
 	m.lastOptions = options
+	m.lastModel = model
 	// Find the last user message to generate a response
 	for i := len(messages) - 1; i >= 0; i-- {
 		if messages[i].Role == "user" {
@@ -348,3 +356,444 @@ func TestSubagentTool_ForUserTruncation(t *testing.T) {
 		t.Error("ForLLM should contain reference to original task")
 	}
 }
+
+// TestSubagentTool_ForUserMarkdown verifies that truncating a result inside a
+// code block or a multi-byte character still yields renderable markdown.
+func TestSubagentTool_ForUserMarkdown(t *testing.T) {
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", "/tmp/test", bus.NewMessageBus(), nil)
+	tool := NewSubagentTool(manager)
+
+	task := "**Report** ~~draft **final~~ copy**\n```go\n" + strings.Repeat("x := \"é\" // **note\n", 60)
+	result := tool.Execute(context.Background(), map[string]any{"task": task})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+
+	user := result.ForUser
+	if !utf8.ValidString(user) {
+		t.Errorf("ForUser is not valid UTF-8: %q", user)
+	}
+	if strings.Count(user, "```")%2 != 0 {
+		t.Errorf("ForUser leaves a code block open:\n%s", user)
+	}
+	if !strings.HasPrefix(user, "Task completed: **Report** ~~draft final~~ copy\n") {
+		t.Errorf("overlapping emphasis was not repaired:\n%s", user)
+	}
+}
+
+func TestSubagentManager_AnnounceTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{
+			name: "default",
+			want: `^Task 'report' completed in \d+m?s\.\n\nResult:\nTask completed: write it$`,
+		},
+		{
+			name: "custom",
+			tmpl: "[{label}] finished in {iterations} step(s), {duration}: {result}",
+			want: `^\[report\] finished in 1 step\(s\), \d+m?s: Task completed: write it$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.NewMessageBus()
+			manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), msgBus, nil)
+			manager.SetAnnounceTemplate(tt.tmpl)
+			task := &SubagentTask{ID: "subagent-1", Task: "write it", Label: "report", OriginChannel: "cli", OriginChatID: "direct"}
+
+			manager.runTask(context.Background(), task, nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if !ok {
+				t.Fatal("expected an announcement")
+			}
+			if !regexp.MustCompile(tt.want).MatchString(msg.Content) {
+				t.Errorf("announcement = %q, want match for %s", msg.Content, tt.want)
+			}
+		})
+	}
+}
+
+// slowLLMProvider answers after a fixed delay.
+type slowLLMProvider struct {
+	MockLLMProvider
+	delay time.Duration
+}
+
+func (p *slowLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	time.Sleep(p.delay)
+	return p.MockLLMProvider.Chat(ctx, messages, tools, model, options)
+}
+
+func TestSubagentManager_TaskDuration(t *testing.T) {
+	manager := NewSubagentManager(&slowLLMProvider{delay: 20 * time.Millisecond}, "test-model", t.TempDir(), nil, nil)
+	if _, err := manager.Spawn(context.Background(), "measure me", "timed", "", "cli", "direct", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := manager.ListTasks()[0].ID
+	task := waitForTaskStatus(t, manager, taskID, "completed")
+	if task.Started < task.Created || task.Completed < task.Started {
+		t.Errorf("Created = %d, Started = %d, Completed = %d, want them in order", task.Created, task.Started, task.Completed)
+	}
+	if d := task.Duration(); d < 20*time.Millisecond || d > 10*time.Second {
+		t.Errorf("Duration() = %v, want at least the provider delay", d)
+	}
+
+	if d := (&SubagentTask{Created: time.Now().UnixMilli()}).Duration(); d != 0 {
+		t.Errorf("unfinished task Duration() = %v, want 0", d)
+	}
+	if d := (&SubagentTask{Created: 1000, Completed: 3000}).Duration(); d != 2*time.Second {
+		t.Errorf("task without Started Duration() = %v, want 2s from Created", d)
+	}
+}
+
+// TestSubagentManager_AnnouncesOnce verifies that finishing the same task twice
+// publishes a single completion announcement.
+func TestSubagentManager_AnnouncesOnce(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), msgBus, nil)
+	manager.SetTools(NewToolRegistry())
+	task := &SubagentTask{ID: "subagent-1", Task: "do it", Label: "once", OriginChannel: "cli", OriginChatID: "direct"}
+
+	manager.runTask(context.Background(), task, nil)
+	manager.runTask(context.Background(), task, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, ok := msgBus.ConsumeInbound(ctx); !ok {
+		t.Fatal("expected one announcement")
+	}
+	if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+		t.Fatalf("unexpected second announcement: %q", msg.Content)
+	}
+}
+
+// waitForTaskStatus polls until the task reaches want or the timeout expires.
+func waitForTaskStatus(t *testing.T, manager *SubagentManager, taskID, want string) *SubagentTask {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		manager.mu.RLock()
+		task := manager.tasks[taskID]
+		status := task.Status
+		manager.mu.RUnlock()
+		if status == want {
+			return task
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("task %s did not reach status %q", taskID, want)
+	return nil
+}
+
+func TestSubagentManager_RetryTask(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	provider := &flakyLLMProvider{failures: 1, err: errors.New("upstream unavailable")}
+	manager := NewSubagentManager(provider, "test-model", t.TempDir(), msgBus, nil)
+	manager.SetTools(NewToolRegistry())
+
+	if _, err := manager.Spawn(context.Background(), "summarize", "sum", "", "cli", "direct", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	taskID := manager.ListTasks()[0].ID
+	created := waitForTaskStatus(t, manager, taskID, "failed").Created
+
+	time.Sleep(5 * time.Millisecond)
+	if err := manager.RetryTask(context.Background(), taskID); err != nil {
+		t.Fatalf("RetryTask failed: %v", err)
+	}
+	task := waitForTaskStatus(t, manager, taskID, "completed")
+
+	if task.Result != "ok" {
+		t.Errorf("Result = %q, want ok", task.Result)
+	}
+	if task.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", task.Attempts)
+	}
+	// The retry keeps the creation time and records its own start
+	if task.Created != created {
+		t.Errorf("Created = %d after retry, want %d", task.Created, created)
+	}
+	if task.Started <= created {
+		t.Errorf("Started = %d, want after Created = %d", task.Started, created)
+	}
+
+	// Both the failure and the successful retry are announced
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, ok := msgBus.ConsumeInbound(ctx); !ok {
+			t.Fatalf("expected announcement %d", i+1)
+		}
+	}
+}
+
+func TestSubagentManager_RetryTask_Rejected(t *testing.T) {
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	manager.tasks["running-task"] = &SubagentTask{ID: "running-task", Status: "running"}
+	manager.tasks["done-task"] = &SubagentTask{ID: "done-task", Status: "completed"}
+
+	for _, id := range []string{"running-task", "done-task", "missing-task"} {
+		if err := manager.RetryTask(context.Background(), id); err == nil {
+			t.Errorf("RetryTask(%q) succeeded, want error", id)
+		}
+	}
+	if manager.tasks["running-task"].Status != "running" {
+		t.Error("rejected retry must not change task status")
+	}
+}
+
+// waitLLMProvider blocks every call until its context is cancelled.
+type waitLLMProvider struct{}
+
+func (p *waitLLMProvider) Chat(
+	ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition,
+	model string, opts map[string]any,
+) (*providers.LLMResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *waitLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentManager_CancelTasks(t *testing.T) {
+	manager := NewSubagentManager(&waitLLMProvider{}, "test-model", t.TempDir(), nil, nil)
+	manager.SetTools(NewToolRegistry())
+
+	// Tasks keep running after the spawning request ends
+	reqCtx, endRequest := context.WithCancel(context.Background())
+	if _, err := manager.Spawn(reqCtx, "wait", "a", "", "telegram", "42", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	endRequest()
+	if _, err := manager.Spawn(context.Background(), "wait", "b", "", "telegram", "7", nil); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, task := range manager.ListTasks() {
+		manager.mu.RLock()
+		status := task.Status
+		manager.mu.RUnlock()
+		if status != "running" {
+			t.Fatalf("task %s is %s before being cancelled", task.ID, status)
+		}
+	}
+
+	if n := manager.CancelTasks("telegram", "42"); n != 1 {
+		t.Fatalf("CancelTasks() = %d, want 1", n)
+	}
+	waitForTaskStatus(t, manager, "subagent-1", "canceled")
+	manager.mu.RLock()
+	other := manager.tasks["subagent-2"].Status
+	manager.mu.RUnlock()
+	if other != "running" {
+		t.Error("task of another chat was cancelled")
+	}
+
+	if n := manager.CancelTasks("", ""); n != 1 {
+		t.Errorf("CancelTasks(all) = %d, want 1", n)
+	}
+	waitForTaskStatus(t, manager, "subagent-2", "canceled")
+}
+
+func TestSubagentManager_DefaultSubagentModel(t *testing.T) {
+	provider := &MockLLMProvider{}
+	manager := NewSubagentManager(provider, "main-model", t.TempDir(), nil, nil)
+	manager.SetTools(NewToolRegistry())
+
+	task := &SubagentTask{ID: "subagent-1", Task: "summarize"}
+	manager.runTask(context.Background(), task, nil)
+	if provider.lastModel != "main-model" {
+		t.Errorf("model without subagent model = %q, want main-model", provider.lastModel)
+	}
+
+	manager.SetDefaultSubagentModel("cheap-model")
+
+	task = &SubagentTask{ID: "subagent-2", Task: "summarize"}
+	manager.runTask(context.Background(), task, nil)
+	if provider.lastModel != "cheap-model" {
+		t.Errorf("async subagent model = %q, want cheap-model", provider.lastModel)
+	}
+
+	tool := NewSubagentTool(manager)
+	tool.SetContext("cli", "direct", "")
+	tool.Execute(context.Background(), map[string]any{"task": "summarize"})
+	if provider.lastModel != "cheap-model" {
+		t.Errorf("sync subagent model = %q, want cheap-model", provider.lastModel)
+	}
+}
+
+func TestSubagentManager_StopSequencesOfSubagentModel(t *testing.T) {
+	provider := &MockLLMProvider{}
+	manager := NewSubagentManager(provider, "main-model", t.TempDir(), nil, nil)
+	manager.SetTools(NewToolRegistry())
+	manager.SetDefaultSubagentModel("cheap-model")
+	manager.SetStopSequences(func(model string) []string {
+		if model == "cheap-model" {
+			return []string{"\nUser:"}
+		}
+		return nil
+	})
+
+	task := &SubagentTask{ID: "subagent-1", Task: "summarize"}
+	manager.runTask(context.Background(), task, nil)
+	if stop, _ := provider.lastOptions["stop"].([]string); !slices.Equal(stop, []string{"\nUser:"}) {
+		t.Errorf("async subagent stop = %q, want the subagent model's", stop)
+	}
+
+	provider.lastOptions = nil
+	tool := NewSubagentTool(manager)
+	tool.SetContext("cli", "direct", "")
+	tool.Execute(context.Background(), map[string]any{"task": "summarize"})
+	if stop, _ := provider.lastOptions["stop"].([]string); !slices.Equal(stop, []string{"\nUser:"}) {
+		t.Errorf("sync subagent stop = %q, want the subagent model's", stop)
+	}
+}
+
+// toolThenAnswerLLMProvider calls a tool once, then answers.
+type toolThenAnswerLLMProvider struct {
+	calls int
+}
+
+func (p *toolThenAnswerLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		return &providers.LLMResponse{
+			Content:   "looking it up",
+			ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "lookup", Arguments: map[string]any{}}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "the answer"}, nil
+}
+
+func (p *toolThenAnswerLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentTool_ExecuteStream(t *testing.T) {
+	manager := NewSubagentManager(&toolThenAnswerLLMProvider{}, "test-model", "/tmp/test", nil, nil)
+	tool := NewSubagentTool(manager)
+	tool.SetContext("cli", "direct", "")
+
+	var progress []ToolLoopProgress
+	var result *ToolResult
+	for ev := range tool.ExecuteStream(context.Background(), map[string]any{"task": "find it", "label": "finder"}) {
+		if result != nil {
+			t.Fatalf("event after the result: %+v", ev)
+		}
+		switch {
+		case ev.Progress != nil:
+			progress = append(progress, *ev.Progress)
+		case ev.Result != nil:
+			result = ev.Result
+		default:
+			t.Fatal("empty event")
+		}
+	}
+
+	if result == nil {
+		t.Fatal("stream closed without a result")
+	}
+	if result.IsError || !strings.Contains(result.ForLLM, "the answer") || !strings.Contains(result.ForLLM, "finder") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("got %d progress events, want 2: %+v", len(progress), progress)
+	}
+	if progress[0].Iteration != 1 || len(progress[0].ToolCalls) != 1 || progress[0].ToolCalls[0] != "lookup" {
+		t.Errorf("first progress event = %+v", progress[0])
+	}
+	if progress[1].Iteration != 2 || progress[1].Content != "the answer" || len(progress[1].ToolCalls) != 0 {
+		t.Errorf("final progress event = %+v", progress[1])
+	}
+}
+
+// toolLoopLLMProvider calls a tool in every response.
+type toolLoopLLMProvider struct{}
+
+func (p *toolLoopLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content:   "still looking",
+		ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "lookup", Arguments: map[string]any{}}},
+	}, nil
+}
+
+func (p *toolLoopLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentTool_ExecuteStream_CancelWithoutReceiver(t *testing.T) {
+	tool := NewSubagentTool(NewSubagentManager(&toolLoopLLMProvider{}, "test-model", "/tmp/test", nil, nil))
+	tool.SetContext("cli", "direct", "")
+
+	// Nobody receives until the buffer is full and the run is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	events := tool.ExecuteStream(ctx, map[string]any{"task": "find it"})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(events) < cap(events) {
+		if time.Now().After(deadline) {
+			t.Fatalf("buffer holds %d events, want %d", len(events), cap(events))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	// The goroutine finishes without anybody receiving
+	buf := make([]byte, 1<<20)
+	for {
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		if !strings.Contains(stacks, "ExecuteStream.func") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ExecuteStream goroutine still running after cancel:\n%s", stacks)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	n := 0
+	for range events {
+		n++
+	}
+	if n != cap(events) {
+		t.Errorf("got %d events, want the %d buffered ones", n, cap(events))
+	}
+}
+
+func TestSubagentTool_ExecuteStream_Error(t *testing.T) {
+	tool := NewSubagentTool(NewSubagentManager(&MockLLMProvider{}, "test-model", "/tmp/test", nil, nil))
+
+	var events []SubagentEvent
+	for ev := range tool.ExecuteStream(context.Background(), map[string]any{}) {
+		events = append(events, ev)
+	}
+	if len(events) != 1 || events[0].Result == nil || !events[0].Result.IsError {
+		t.Fatalf("want a single error result, got %+v", events)
+	}
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// SessionSummaryStore is the part of the session manager the summarize tool
+// needs: reading the history and optionally saving the summary.
+type SessionSummaryStore interface {
+	GetHistory(key string) []providers.Message
+	GetSummary(key string) string
+	SetSummary(key string, summary string)
+}
+
+// SummarizeSessionTool asks the LLM for a summary of the current session on
+// demand. Unlike the automatic compaction it does not truncate the history;
+// it only reports, and saves the summary if asked to.
+type SummarizeSessionTool struct {
+	provider   providers.LLMProvider
+	model      string
+	sessions   SessionSummaryStore
+	sessionKey string
+	mu         sync.RWMutex
+}
+
+// NewSummarizeSessionTool creates a tool that summarizes sessions from
+// sessions using provider and model.
+func NewSummarizeSessionTool(
+	provider providers.LLMProvider, model string, sessions SessionSummaryStore,
+) *SummarizeSessionTool {
+	return &SummarizeSessionTool{
+		provider: provider,
+		model:    model,
+		sessions: sessions,
+	}
+}
+
+func (t *SummarizeSessionTool) Name() string {
+	return "summarize_session"
+}
+
+func (t *SummarizeSessionTool) Description() string {
+	return "Summarize the current conversation when the user asks for it (e.g. 'summarize our conversation' or /summary). " +
+		"Returns the summary without changing the history. Set 'save' to keep it as the session summary."
+}
+
+func (t *SummarizeSessionTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"focus": map[string]any{
+				"type":        "string",
+				"description": "Optional: what the summary should focus on (e.g. 'decisions made', 'open questions')",
+			},
+			"save": map[string]any{
+				"type":        "boolean",
+				"description": "Save the summary as the session summary used for future context (default: false)",
+			},
+		},
+	}
+}
+
+// SetSessionKey sets the session to summarize.
+func (t *SummarizeSessionTool) SetSessionKey(sessionKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionKey = sessionKey
+}
+
+func (t *SummarizeSessionTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	t.mu.RLock()
+	sessionKey := callSessionKey(ctx, t.sessionKey)
+	t.mu.RUnlock()
+
+	if t.sessions == nil || t.provider == nil {
+		return InternalError("session summaries are not available")
+	}
+	if sessionKey == "" {
+		return ErrorResult("No current session")
+	}
+
+	history := t.sessions.GetHistory(sessionKey)
+	var conversation strings.Builder
+	for _, m := range history {
+		// Tool calls and results are intermediate steps, not conversation
+		if (m.Role != "user" && m.Role != "assistant") || m.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&conversation, "%s: %s\n", m.Role, m.Content)
+	}
+	if conversation.Len() == 0 {
+		return UserResult("There is nothing to summarize yet.")
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Summarize the following conversation for the user. Be concise and cover the main topics, " +
+		"decisions and open questions.\n")
+	if focus, _ := args["focus"].(string); focus != "" {
+		fmt.Fprintf(&prompt, "Focus on: %s\n", focus)
+	}
+	if existing := t.sessions.GetSummary(sessionKey); existing != "" {
+		fmt.Fprintf(&prompt, "Summary of earlier parts of the conversation: %s\n", existing)
+	}
+	prompt.WriteString("\nCONVERSATION:\n")
+	prompt.WriteString(conversation.String())
+
+	response, err := t.provider.Chat(ctx,
+		[]providers.Message{{Role: "user", Content: prompt.String()}},
+		nil,
+		t.model,
+		map[string]any{
+			"max_tokens":  1024,
+			"temperature": 0.3,
+		},
+	)
+	if err != nil {
+		return ExternalError(fmt.Sprintf("failed to summarize session: %v", err)).WithError(err)
+	}
+	ReportUsage(ctx, response.Usage)
+	summary := strings.TrimSpace(response.Content)
+	if summary == "" {
+		return ExternalError("the model returned an empty summary")
+	}
+
+	if save, _ := args["save"].(bool); save {
+		t.sessions.SetSummary(sessionKey, summary)
+	}
+	return UserResult(summary)
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// cannedSummaryProvider returns a fixed summary and records the prompt.
+type cannedSummaryProvider struct {
+	summary string
+	prompt  string
+	model   string
+}
+
+func (p *cannedSummaryProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	p.prompt = messages[len(messages)-1].Content
+	p.model = model
+	return &providers.LLMResponse{Content: p.summary}, nil
+}
+
+func (p *cannedSummaryProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+// fakeSessionStore is an in-memory SessionSummaryStore.
+type fakeSessionStore struct {
+	history   map[string][]providers.Message
+	summaries map[string]string
+}
+
+func (s *fakeSessionStore) GetHistory(key string) []providers.Message {
+	return s.history[key]
+}
+
+func (s *fakeSessionStore) GetSummary(key string) string {
+	return s.summaries[key]
+}
+
+func (s *fakeSessionStore) SetSummary(key string, summary string) {
+	s.summaries[key] = summary
+}
+
+func TestSummarizeSessionTool(t *testing.T) {
+	store := &fakeSessionStore{
+		history: map[string][]providers.Message{
+			"telegram:42": {
+				{Role: "user", Content: "Let's plan the trip to Lisbon"},
+				{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "web_search"}}},
+				{Role: "tool", Content: "flight prices...", ToolCallID: "call_1"},
+				{Role: "assistant", Content: "Flights are cheapest in May"},
+			},
+		},
+		summaries: map[string]string{},
+	}
+	provider := &cannedSummaryProvider{summary: "You planned a May trip to Lisbon."}
+	tool := NewSummarizeSessionTool(provider, "summary-model", store)
+	tool.SetSessionKey("telegram:42")
+
+	result := tool.Execute(context.Background(), map[string]any{"focus": "dates"})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+	if result.ForUser != "You planned a May trip to Lisbon." {
+		t.Errorf("ForUser = %q, want the canned summary", result.ForUser)
+	}
+	if provider.model != "summary-model" {
+		t.Errorf("model = %q, want summary-model", provider.model)
+	}
+	for _, want := range []string{"user: Let's plan the trip to Lisbon", "assistant: Flights are cheapest in May", "Focus on: dates"} {
+		if !strings.Contains(provider.prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, provider.prompt)
+		}
+	}
+	if strings.Contains(provider.prompt, "flight prices") {
+		t.Errorf("prompt includes tool output:\n%s", provider.prompt)
+	}
+	if len(store.summaries) != 0 {
+		t.Errorf("summary saved without save=true: %v", store.summaries)
+	}
+	if len(store.history["telegram:42"]) != 4 {
+		t.Error("history was modified")
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"save": true})
+	if result.IsError {
+		t.Fatalf("Execute with save failed: %s", result.ForLLM)
+	}
+	if got := store.summaries["telegram:42"]; got != "You planned a May trip to Lisbon." {
+		t.Errorf("saved summary = %q", got)
+	}
+}
+
+func TestSummarizeSessionTool_EmptySession(t *testing.T) {
+	provider := &cannedSummaryProvider{summary: "unused"}
+	store := &fakeSessionStore{history: map[string][]providers.Message{}, summaries: map[string]string{}}
+	tool := NewSummarizeSessionTool(provider, "test-model", store)
+
+	if result := tool.Execute(context.Background(), nil); !result.IsError {
+		t.Error("expected error without a session key")
+	}
+
+	tool.SetSessionKey("cli:direct")
+	result := tool.Execute(context.Background(), nil)
+	if result.IsError || !strings.Contains(result.ForUser, "nothing to summarize") {
+		t.Errorf("result = %+v, want nothing-to-summarize message", result)
+	}
+	if provider.prompt != "" {
+		t.Error("provider called for an empty session")
+	}
+}
@@ -9,7 +9,9 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -23,16 +25,116 @@ type ToolLoopConfig struct {
 	Tools         *ToolRegistry
 	MaxIterations int
 	LLMOptions    map[string]any
+	// MaxTokens and Temperature, when set, override the matching LLMOptions
+	// keys for every call made by the loop.
+	MaxTokens   int
+	Temperature *float64
+	// StopSequences are passed to the provider as the "stop" option.
+	StopSequences []string
+	// TrimImpersonatedTurns cuts each response at the first line where the
+	// model starts writing the user's next turn.
+	TrimImpersonatedTurns bool
+	// ToolChoice is passed to the provider as the "tool_choice" option:
+	// ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired or the name of the
+	// tool to call. Empty leaves the provider default.
+	ToolChoice string
+	// MaxRetries is how many times a failed LLM call is retried when the error
+	// is transient (rate limit, overload, timeout). Zero disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry; it doubles on each
+	// subsequent attempt. Defaults to one second.
+	RetryBaseDelay time.Duration
+	// Audit, if set, records every tool execution under SessionKey.
+	Audit      *AuditLog
+	SessionKey string
+	// OnIteration, if set, is called after each iteration: once its tool
+	// calls have run, or with the final answer.
+	OnIteration func(ToolLoopProgress)
 }
 
+// ToolLoopProgress describes a finished iteration of the tool loop.
+type ToolLoopProgress struct {
+	Iteration int
+	// Content is the assistant text of the iteration, if any
+	Content string
+	// ToolCalls names the tools called, in order; empty for the final answer
+	ToolCalls []string
+}
+
+const (
+	defaultRetryBaseDelay = time.Second
+	maxRetryDelay         = 30 * time.Second
+)
+
+// Tool choices understood by the providers. Any other ToolChoice value names
+// the tool the model must call.
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ForIteration returns the config for the given call of a loop, counting
+// from 1. ToolChoiceNone holds for every call, but a forced tool call only
+// applies to the first one so the model can answer once the tool has run.
+func (c ToolLoopConfig) ForIteration(iteration int) ToolLoopConfig {
+	if iteration > 1 && c.ToolChoice != ToolChoiceNone {
+		c.ToolChoice = ""
+	}
+	return c
+}
+
+// CallOptions returns the provider options for a single LLM call: a copy of
+// LLMOptions with the MaxTokens, Temperature, StopSequences and ToolChoice
+// overrides applied.
+func (c ToolLoopConfig) CallOptions() map[string]any {
+	opts := make(map[string]any, len(c.LLMOptions)+2)
+	for k, v := range c.LLMOptions {
+		opts[k] = v
+	}
+	if c.MaxTokens > 0 {
+		opts["max_tokens"] = c.MaxTokens
+	}
+	if c.Temperature != nil {
+		opts["temperature"] = *c.Temperature
+	}
+	if len(c.StopSequences) > 0 {
+		opts["stop"] = c.StopSequences
+	}
+	if c.ToolChoice != "" {
+		opts["tool_choice"] = c.ToolChoice
+	}
+	return opts
+}
+
+// TerminationReason describes why the tool loop stopped.
+type TerminationReason string
+
+const (
+	// TerminationCompleted means the LLM returned a final answer without tool calls.
+	TerminationCompleted TerminationReason = "completed"
+	// TerminationMaxIterations means the loop ran out of iterations while the
+	// LLM was still requesting tool calls.
+	TerminationMaxIterations TerminationReason = "max_iterations"
+	// TerminationError means an LLM call failed.
+	TerminationError TerminationReason = "error"
+	// TerminationCanceled means the context was canceled before the loop finished.
+	TerminationCanceled TerminationReason = "canceled"
+)
+
 // ToolLoopResult contains the result of running the tool loop.
 type ToolLoopResult struct {
 	Content    string
 	Iterations int
+	// TerminationReason tells callers whether Content is a final answer or
+	// only partial progress (the last assistant text before the limit was hit).
+	TerminationReason TerminationReason
 }
 
 // RunToolLoop executes the LLM + tool call iteration loop.
 // This is the core agent logic that can be reused by both main agent and subagents.
+// A non-nil result is returned even when err is set, so callers can always
+// inspect TerminationReason and Iterations.
 func RunToolLoop(
 	ctx context.Context,
 	config ToolLoopConfig,
@@ -41,8 +143,18 @@ func RunToolLoop(
 ) (*ToolLoopResult, error) {
 	iteration := 0
 	var finalContent string
+	var lastContent string
+	reason := TerminationMaxIterations
 
 	for iteration < config.MaxIterations {
+		if err := ctx.Err(); err != nil {
+			return &ToolLoopResult{
+				Content:           lastContent,
+				Iterations:        iteration,
+				TerminationReason: TerminationCanceled,
+			}, err
+		}
+
 		iteration++
 
 		logger.DebugCF("toolloop", "LLM iteration",
@@ -57,30 +169,47 @@ func RunToolLoop(
 			providerToolDefs = config.Tools.ToProviderDefs()
 		}
 
-		// 2. Set default LLM options
-		llmOpts := config.LLMOptions
-		if llmOpts == nil {
-			llmOpts = map[string]any{}
-		}
+		// 2. Resolve LLM options for this call
+		llmOpts := config.ForIteration(iteration).CallOptions()
 		// 3. Call LLM
-		response, err := config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		response, err := chatWithRetry(ctx, config, iteration, func() (*providers.LLMResponse, error) {
+			return config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		})
 		if err != nil {
 			logger.ErrorCF("toolloop", "LLM call failed",
 				map[string]any{
 					"iteration": iteration,
 					"error":     err.Error(),
 				})
-			return nil, fmt.Errorf("LLM call failed: %w", err)
+			failReason := TerminationError
+			if ctx.Err() != nil {
+				failReason = TerminationCanceled
+			}
+			return &ToolLoopResult{
+				Content:           lastContent,
+				Iterations:        iteration,
+				TerminationReason: failReason,
+			}, fmt.Errorf("LLM call failed: %w", err)
+		}
+		ReportUsage(ctx, response.Usage)
+
+		// Drop any user turns the model made up before the content is reused
+		if config.TrimImpersonatedTurns {
+			response.Content = providers.TrimImpersonatedTurns(response.Content)
 		}
 
 		// 4. If no tool calls, we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
+			reason = TerminationCompleted
 			logger.InfoCF("toolloop", "LLM response without tool calls (direct answer)",
 				map[string]any{
 					"iteration":     iteration,
 					"content_chars": len(finalContent),
 				})
+			if config.OnIteration != nil {
+				config.OnIteration(ToolLoopProgress{Iteration: iteration, Content: finalContent})
+			}
 			break
 		}
 
@@ -101,6 +230,10 @@ func RunToolLoop(
 				"iteration": iteration,
 			})
 
+		if response.Content != "" {
+			lastContent = response.Content
+		}
+
 		// 6. Build assistant message with tool calls
 		assistantMsg := providers.Message{
 			Role:    "assistant",
@@ -133,17 +266,16 @@ func RunToolLoop(
 
 			// Execute tool (no async callback for subagents - they run independently)
 			var toolResult *ToolResult
+			start := time.Now()
 			if config.Tools != nil {
 				toolResult = config.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, threadID, nil)
 			} else {
 				toolResult = ErrorResult("No tools available")
 			}
+			config.Audit.Record(config.SessionKey, channel, chatID, tc.Name, tc.Arguments, toolResult, time.Since(start))
 
 			// Determine content for LLM
-			contentForLLM := toolResult.ForLLM
-			if contentForLLM == "" && toolResult.Err != nil {
-				contentForLLM = toolResult.Err.Error()
-			}
+			contentForLLM := toolResult.ContentForLLM(tc.Name)
 
 			// Add tool result message
 			toolResultMsg := providers.Message{
@@ -153,10 +285,86 @@ func RunToolLoop(
 			}
 			messages = append(messages, toolResultMsg)
 		}
+
+		if config.OnIteration != nil {
+			config.OnIteration(ToolLoopProgress{Iteration: iteration, Content: response.Content, ToolCalls: toolNames})
+		}
+	}
+
+	if reason == TerminationMaxIterations {
+		finalContent = lastContent
+		logger.WarnCF("toolloop", "Max iterations reached",
+			map[string]any{
+				"iterations": iteration,
+				"max":        config.MaxIterations,
+			})
 	}
 
 	return &ToolLoopResult{
-		Content:    finalContent,
-		Iterations: iteration,
+		Content:           finalContent,
+		Iterations:        iteration,
+		TerminationReason: reason,
 	}, nil
 }
+
+// chatWithRetry runs call, retrying transient failures with exponential backoff
+// as configured by config.MaxRetries and config.RetryBaseDelay.
+func chatWithRetry(
+	ctx context.Context,
+	config ToolLoopConfig,
+	iteration int,
+	call func() (*providers.LLMResponse, error),
+) (*providers.LLMResponse, error) {
+	delay := config.RetryBaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := call()
+		if err == nil {
+			return response, nil
+		}
+		if attempt >= config.MaxRetries || ctx.Err() != nil || !isRetryableLLMError(err, config.Model) {
+			return nil, err
+		}
+
+		logger.WarnCF("toolloop", "Transient LLM error, retrying",
+			map[string]any{
+				"iteration": iteration,
+				"attempt":   attempt + 1,
+				"max":       config.MaxRetries,
+				"delay_ms":  delay.Milliseconds(),
+				"error":     err.Error(),
+			})
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// isRetryableLLMError reports whether err is transient and worth retrying
+// against the same provider. Auth, billing and malformed-request errors are not.
+func isRetryableLLMError(err error, model string) bool {
+	var failErr *providers.FailoverError
+	if !errors.As(err, &failErr) {
+		failErr = providers.ClassifyError(err, "", model)
+	}
+	if failErr == nil {
+		return false
+	}
+	switch failErr.Reason {
+	case providers.FailoverRateLimit, providers.FailoverOverloaded, providers.FailoverTimeout:
+		return true
+	default:
+		return false
+	}
+}
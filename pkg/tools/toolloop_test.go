@@ -0,0 +1,430 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// loopingLLMProvider always requests another tool call.
+type loopingLLMProvider struct {
+	calls int
+}
+
+func (m *loopingLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	return &providers.LLMResponse{
+		Content: fmt.Sprintf("step %d", m.calls),
+		ToolCalls: []providers.ToolCall{
+			{ID: fmt.Sprintf("call_%d", m.calls), Name: "missing_tool", Arguments: map[string]any{}},
+		},
+		Usage: &providers.UsageInfo{TotalTokens: 10},
+	}, nil
+}
+
+func (m *loopingLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+// failingLLMProvider always returns an error.
+type failingLLMProvider struct{}
+
+func (m *failingLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	return nil, errors.New("upstream unavailable")
+}
+
+func (m *failingLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestRunToolLoop_Completed(t *testing.T) {
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      &MockLLMProvider{},
+		Model:         "test-model",
+		Tools:         NewToolRegistry(),
+		MaxIterations: 5,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if result.TerminationReason != TerminationCompleted {
+		t.Errorf("TerminationReason = %q, want %q", result.TerminationReason, TerminationCompleted)
+	}
+	if result.Content != "Task completed: hi" {
+		t.Errorf("Content = %q", result.Content)
+	}
+}
+
+func TestRunToolLoop_MaxIterations(t *testing.T) {
+	provider := &loopingLLMProvider{}
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      provider,
+		Model:         "test-model",
+		Tools:         NewToolRegistry(),
+		MaxIterations: 2,
+	}, []providers.Message{{Role: "user", Content: "loop"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if result.TerminationReason != TerminationMaxIterations {
+		t.Errorf("TerminationReason = %q, want %q", result.TerminationReason, TerminationMaxIterations)
+	}
+	if result.Iterations != 2 || provider.calls != 2 {
+		t.Errorf("Iterations = %d, calls = %d, want 2", result.Iterations, provider.calls)
+	}
+	if result.Content != "step 2" {
+		t.Errorf("Content = %q, want partial content %q", result.Content, "step 2")
+	}
+}
+
+func TestRunToolLoop_OnIteration(t *testing.T) {
+	var progress []ToolLoopProgress
+	_, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      &loopingLLMProvider{},
+		Model:         "test-model",
+		Tools:         NewToolRegistry(),
+		MaxIterations: 2,
+		OnIteration: func(p ToolLoopProgress) {
+			progress = append(progress, p)
+		},
+	}, []providers.Message{{Role: "user", Content: "loop"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if len(progress) != 2 {
+		t.Fatalf("got %d progress calls, want 2: %+v", len(progress), progress)
+	}
+	for i, p := range progress {
+		if p.Iteration != i+1 || p.Content != fmt.Sprintf("step %d", i+1) {
+			t.Errorf("progress[%d] = %+v", i, p)
+		}
+		if len(p.ToolCalls) != 1 || p.ToolCalls[0] != "missing_tool" {
+			t.Errorf("progress[%d].ToolCalls = %v, want [missing_tool]", i, p.ToolCalls)
+		}
+	}
+}
+
+func TestRunToolLoop_ReportsUsage(t *testing.T) {
+	total := 0
+	ctx := WithUsageReporter(context.Background(), func(usage *providers.UsageInfo) {
+		total += usage.TotalTokens
+	})
+	_, err := RunToolLoop(ctx, ToolLoopConfig{
+		Provider:      &loopingLLMProvider{},
+		Model:         "test-model",
+		Tools:         NewToolRegistry(),
+		MaxIterations: 2,
+	}, []providers.Message{{Role: "user", Content: "loop"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if total != 20 {
+		t.Errorf("reported %d tokens, want 20 from two calls", total)
+	}
+}
+
+func TestRunToolLoop_Error(t *testing.T) {
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      &failingLLMProvider{},
+		Model:         "test-model",
+		MaxIterations: 5,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if result == nil {
+		t.Fatal("expected result alongside error")
+	}
+	if result.TerminationReason != TerminationError {
+		t.Errorf("TerminationReason = %q, want %q", result.TerminationReason, TerminationError)
+	}
+}
+
+func TestRunToolLoop_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	provider := &loopingLLMProvider{}
+	result, err := RunToolLoop(ctx, ToolLoopConfig{
+		Provider:      provider,
+		Model:         "test-model",
+		MaxIterations: 5,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if result.TerminationReason != TerminationCanceled {
+		t.Errorf("TerminationReason = %q, want %q", result.TerminationReason, TerminationCanceled)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times after cancellation", provider.calls)
+	}
+}
+
+func TestSubagentManager_RunTask_Status(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   providers.LLMProvider
+		wantStatus string
+	}{
+		{name: "completed", provider: &MockLLMProvider{}, wantStatus: "completed"},
+		{name: "truncated", provider: &loopingLLMProvider{}, wantStatus: "truncated"},
+		{name: "failed", provider: &failingLLMProvider{}, wantStatus: "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewSubagentManager(tt.provider, "test-model", t.TempDir(), nil, nil)
+			manager.SetTools(NewToolRegistry())
+			task := &SubagentTask{ID: "subagent-1", Task: "do it", Label: tt.name}
+
+			manager.runTask(context.Background(), task, nil)
+
+			if task.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", task.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestToolLoopConfig_CallOptions(t *testing.T) {
+	temperature := 0.0
+	config := ToolLoopConfig{
+		LLMOptions:  map[string]any{"temperature": 0.7, "prompt_cache_key": "main"},
+		MaxTokens:   1024,
+		Temperature: &temperature,
+	}
+
+	opts := config.CallOptions()
+	if opts["temperature"] != 0.0 {
+		t.Errorf("temperature = %v, want 0.0", opts["temperature"])
+	}
+	if opts["max_tokens"] != 1024 {
+		t.Errorf("max_tokens = %v, want 1024", opts["max_tokens"])
+	}
+	if opts["prompt_cache_key"] != "main" {
+		t.Errorf("prompt_cache_key = %v, want main", opts["prompt_cache_key"])
+	}
+	if config.LLMOptions["temperature"] != 0.7 {
+		t.Error("CallOptions must not modify LLMOptions")
+	}
+}
+
+// flakyLLMProvider fails the first failures calls with err, then succeeds.
+type flakyLLMProvider struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (m *flakyLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return nil, m.err
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (m *flakyLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestRunToolLoop_RetriesTransientErrors(t *testing.T) {
+	provider := &flakyLLMProvider{failures: 1, err: errors.New("status 429: Too Many Requests")}
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:       provider,
+		Model:          "test-model",
+		MaxIterations:  3,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if result.Content != "ok" {
+		t.Errorf("Content = %q, want ok", result.Content)
+	}
+	if provider.calls != 2 {
+		t.Errorf("calls = %d, want 2", provider.calls)
+	}
+}
+
+func TestRunToolLoop_RetriesExhausted(t *testing.T) {
+	provider := &flakyLLMProvider{failures: 5, err: errors.New("status 503: service overloaded")}
+	_, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:       provider,
+		Model:          "test-model",
+		MaxIterations:  3,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err == nil {
+		t.Fatal("expected error after retries are exhausted")
+	}
+	if provider.calls != 3 {
+		t.Errorf("calls = %d, want 3 (1 + 2 retries)", provider.calls)
+	}
+}
+
+func TestRunToolLoop_NoRetryOnNonRetryableError(t *testing.T) {
+	provider := &flakyLLMProvider{failures: 1, err: errors.New("status 401: invalid api key")}
+	_, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:       provider,
+		Model:          "test-model",
+		MaxIterations:  3,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if provider.calls != 1 {
+		t.Errorf("calls = %d, want 1", provider.calls)
+	}
+}
+
+// impersonatingLLMProvider answers and then makes up the user's next turn,
+// or answers with content if set.
+type impersonatingLLMProvider struct {
+	content     string
+	lastOptions map[string]any
+}
+
+func (m *impersonatingLLMProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.lastOptions = options
+	if m.content != "" {
+		return &providers.LLMResponse{Content: m.content}, nil
+	}
+	return &providers.LLMResponse{Content: "All done.\nUser: great, now push it"}, nil
+}
+
+func (m *impersonatingLLMProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestRunToolLoop_TrimsImpersonatedTurns(t *testing.T) {
+	provider := &impersonatingLLMProvider{}
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:              provider,
+		Model:                 "test-model",
+		MaxIterations:         3,
+		StopSequences:         []string{"\nUser:"},
+		TrimImpersonatedTurns: true,
+	}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if result.Content != "All done." {
+		t.Errorf("Content = %q, want %q", result.Content, "All done.")
+	}
+	stop, ok := provider.lastOptions["stop"].([]string)
+	if !ok || len(stop) != 1 || stop[0] != "\nUser:" {
+		t.Errorf("stop option = %v, want [\"\\nUser:\"]", provider.lastOptions["stop"])
+	}
+}
+
+func TestRunToolLoop_KeepsUserLinesByDefault(t *testing.T) {
+	reply := "Add this to ~/.ssh/config:\n\nHost build\nUser: deploy\n\nThen run ssh build."
+	provider := &impersonatingLLMProvider{content: reply}
+	result, err := RunToolLoop(context.Background(), ToolLoopConfig{
+		Provider:      provider,
+		Model:         "test-model",
+		MaxIterations: 3,
+	}, []providers.Message{{Role: "user", Content: "how do I log in as deploy?"}}, "cli", "direct", "")
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if result.Content != reply {
+		t.Errorf("Content = %q, want the whole reply %q", result.Content, reply)
+	}
+}
+
+// optionsRecordingProvider calls a tool once, then answers, and records the
+// options of every call.
+type optionsRecordingProvider struct {
+	options []map[string]any
+}
+
+func (m *optionsRecordingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	m.options = append(m.options, options)
+	if len(m.options) == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{
+			{ID: "call_1", Name: "message", Arguments: map[string]any{}},
+		}}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (m *optionsRecordingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestRunToolLoop_ForwardsToolChoice(t *testing.T) {
+	tests := []struct {
+		choice string
+		want   []any // tool_choice of the first and second call
+	}{
+		{choice: "", want: []any{nil, nil}},
+		{choice: "message", want: []any{"message", nil}},
+		{choice: ToolChoiceRequired, want: []any{"required", nil}},
+		{choice: ToolChoiceNone, want: []any{"none", "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.choice, func(t *testing.T) {
+			provider := &optionsRecordingProvider{}
+			_, err := RunToolLoop(context.Background(), ToolLoopConfig{
+				Provider:      provider,
+				Model:         "test-model",
+				Tools:         NewToolRegistry(),
+				MaxIterations: 5,
+				ToolChoice:    tt.choice,
+			}, []providers.Message{{Role: "user", Content: "hi"}}, "cli", "direct", "")
+			if err != nil {
+				t.Fatalf("RunToolLoop failed: %v", err)
+			}
+			if len(provider.options) != 2 {
+				t.Fatalf("%d LLM calls, want 2", len(provider.options))
+			}
+			for i, want := range tt.want {
+				if got := provider.options[i]["tool_choice"]; got != want {
+					t.Errorf("call %d tool_choice = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
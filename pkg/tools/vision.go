@@ -57,6 +57,11 @@ func (t *ReadImageTool) Parameters() map[string]any {
 	}
 }
 
+// ReadOnly reports that the tool never changes state
+func (t *ReadImageTool) ReadOnly() bool {
+	return true
+}
+
 func (t *ReadImageTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	path, ok := args["path"].(string)
 	if !ok {
@@ -192,6 +197,7 @@ func (t *ReadImageTool) Execute(ctx context.Context, args map[string]any) *ToolR
 			Err:     err,
 		}
 	}
+	ReportUsage(ctx, resp.Usage)
 
 	logger.InfoCF("tool", "Image analysis completed",
 		map[string]any{
@@ -471,10 +471,20 @@ func (t *WebSearchTool) Parameters() map[string]any {
 	}
 }
 
+// Cacheable reports that repeated searches may be served from the cache
+func (t *WebSearchTool) Cacheable() bool {
+	return true
+}
+
+// ReadOnly reports that the tool never changes state
+func (t *WebSearchTool) ReadOnly() bool {
+	return true
+}
+
 func (t *WebSearchTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	query, ok := args["query"].(string)
 	if !ok {
-		return ErrorResult("query is required")
+		return ValidationError("query is required")
 	}
 
 	count := t.maxResults
@@ -486,7 +496,7 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]any) *ToolR
 
 	result, err := t.provider.Search(ctx, query, count)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+		return ExternalError(fmt.Sprintf("search failed: %v", err))
 	}
 
 	return &ToolResult{
@@ -545,23 +555,33 @@ func (t *WebFetchTool) Parameters() map[string]any {
 	}
 }
 
+// Cacheable reports that repeated fetches may be served from the cache
+func (t *WebFetchTool) Cacheable() bool {
+	return true
+}
+
+// ReadOnly reports that the tool never changes state
+func (t *WebFetchTool) ReadOnly() bool {
+	return true
+}
+
 func (t *WebFetchTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	urlStr, ok := args["url"].(string)
 	if !ok {
-		return ErrorResult("url is required")
+		return ValidationError("url is required")
 	}
 
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("invalid URL: %v", err))
+		return ValidationError(fmt.Sprintf("invalid URL: %v", err))
 	}
 
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return ErrorResult("only http/https URLs are allowed")
+		return ValidationError("only http/https URLs are allowed")
 	}
 
 	if parsedURL.Host == "" {
-		return ErrorResult("missing domain in URL")
+		return ValidationError("missing domain in URL")
 	}
 
 	maxChars := t.maxChars
@@ -593,13 +613,13 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("request failed: %v", err))
+		return ExternalError(fmt.Sprintf("request failed: %v", err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
+		return ExternalError(fmt.Sprintf("failed to read response: %v", err))
 	}
 
 	contentType := resp.Header.Get("Content-Type")
@@ -140,6 +140,9 @@ func (t *WebUISendFileTool) Execute(ctx context.Context, args map[string]any) *T
 
 	// Extract session from path: /workspace/webui/uploads/{session}/filename
 	session := t.currentSession
+	if channel, chatID, _ := callChat(ctx, "", "", ""); channel == "webui" {
+		session = chatID
+	}
 	if session == "" {
 		session = "current"
 		pathParts := strings.Split(resolvedPath, string(filepath.Separator))
@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteFilesTool writes several files as one change: either every file is
+// written or, if any write fails, none is.
+type WriteFilesTool struct {
+	fs        fileSystem
+	workspace string
+}
+
+// NewWriteFilesTool creates a new WriteFilesTool with optional directory restriction.
+func NewWriteFilesTool(workspace string, restrict bool) *WriteFilesTool {
+	var fs fileSystem
+	if restrict {
+		fs = &sandboxFs{workspace: workspace}
+	} else {
+		fs = &hostFs{}
+	}
+	return &WriteFilesTool{fs: fs, workspace: workspace}
+}
+
+func (t *WriteFilesTool) Name() string {
+	return "write_files"
+}
+
+func (t *WriteFilesTool) Description() string {
+	return "Write several related files at once. Either all files are written or, if any fails, none are."
+}
+
+func (t *WriteFilesTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"files": map[string]any{
+				"type":                 "object",
+				"description":          "Map of file path to the full content to write",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		},
+		"required": []string{"files"},
+	}
+}
+
+func (t *WriteFilesTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	raw, ok := args["files"].(map[string]any)
+	if !ok || len(raw) == 0 {
+		return ErrorResult("files is required")
+	}
+
+	files := make(map[string]string, len(raw))
+	for path, v := range raw {
+		content, ok := v.(string)
+		if !ok {
+			return ErrorResult(fmt.Sprintf("content of %s must be a string", path))
+		}
+		files[path] = content
+	}
+
+	paths, err := writeFilesAtomic(t.fs, t.workspace, files)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	recordFileWrites(ctx, t.fs, paths...)
+	return SilentResult(fmt.Sprintf("Wrote %d files: %s", len(paths), strings.Join(paths, ", ")))
+}
+
+// stagedFile is a file of a write_files call, written to a temporary path
+// next to its target until every file is staged.
+type stagedFile struct {
+	path   string
+	staged string
+	backup string // link to the replaced file, kept until every file is in place
+}
+
+// writeFilesAtomic writes files (path -> content) so that either all or
+// none of them change. Relative paths are resolved against workspace to
+// find two names for the same file. Every file is first written to a
+// temporary file next to its target; only when all are staged are they
+// renamed into place, each replaced file kept as a backup link. If a rename
+// fails, the backups are renamed back, so restored files keep their mode.
+// It returns the written paths, sorted.
+func writeFilesAtomic(sysFs fileSystem, workspace string, files map[string]string) ([]string, error) {
+	paths := make([]string, 0, len(files))
+	seen := make(map[string]string, len(files))
+	for path := range files {
+		abs := path
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(workspace, abs)
+		}
+		abs = filepath.Clean(abs)
+		if other, dup := seen[abs]; dup {
+			return nil, fmt.Errorf("%s and %s are the same file", other, path)
+		}
+		seen[abs] = path
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	suffix := fmt.Sprintf(".%d.stage", time.Now().UnixNano())
+	var staged []stagedFile
+	removeStaged := func(files []stagedFile) {
+		for _, f := range files {
+			sysFs.Remove(f.staged)
+		}
+	}
+
+	for _, path := range paths {
+		f := stagedFile{path: path, staged: path + suffix, backup: path + suffix + ".old"}
+		if err := sysFs.WriteFile(f.staged, []byte(files[path])); err != nil {
+			removeStaged(staged)
+			return nil, fmt.Errorf("%s: %w; no files were written", path, err)
+		}
+		staged = append(staged, f)
+	}
+
+	for i := range staged {
+		f := &staged[i]
+		err := backupFile(sysFs, f)
+		if err == nil {
+			err = sysFs.Rename(f.staged, f.path)
+		}
+		if err != nil {
+			rollbackFiles(sysFs, staged[:i+1])
+			removeStaged(staged[i:])
+			return nil, fmt.Errorf("%s: %w; no files were written", f.path, err)
+		}
+	}
+
+	for _, f := range staged {
+		if f.backup != "" {
+			sysFs.Remove(f.backup)
+		}
+	}
+	return paths, nil
+}
+
+// backupFile hard-links the file f replaces to f.backup, so the target
+// never goes missing and can be renamed back unchanged. A missing target
+// needs no backup.
+func backupFile(sysFs fileSystem, f *stagedFile) error {
+	err := sysFs.Link(f.path, f.backup)
+	if errors.Is(err, fs.ErrNotExist) {
+		f.backup = ""
+		return nil
+	}
+	return err
+}
+
+// rollbackFiles restores files already renamed into place: replaced files
+// get their backup back and new files are removed.
+func rollbackFiles(sysFs fileSystem, done []stagedFile) {
+	for _, f := range done {
+		if f.backup != "" {
+			sysFs.Rename(f.backup, f.path)
+		} else {
+			sysFs.Remove(f.path)
+		}
+	}
+}
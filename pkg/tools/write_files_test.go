@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFilesTool_Success(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "README.md"), []byte("old"), 0o644)
+	tool := NewWriteFilesTool(tmpDir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"files": map[string]any{
+			"README.md":   "# App",
+			"src/app.go":  "package app",
+			"src/util.go": "package app // util",
+		},
+	})
+	if result.IsError {
+		t.Fatalf("write failed: %s", result.ForLLM)
+	}
+
+	for path, want := range map[string]string{
+		"README.md":   "# App",
+		"src/app.go":  "package app",
+		"src/util.go": "package app // util",
+	} {
+		if got, _ := os.ReadFile(filepath.Join(tmpDir, path)); string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	assertNoStagedFiles(t, tmpDir)
+}
+
+// TestWriteFilesTool_InvalidPathWritesNothing verifies that one path outside
+// the workspace stops every file from being written.
+func TestWriteFilesTool_InvalidPathWritesNothing(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("original"), 0o644)
+	tool := NewWriteFilesTool(tmpDir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"files": map[string]any{
+			"a.txt":               "changed",
+			"b.txt":               "new",
+			"z/nested.txt":        "new",
+			"zz/../../escape.txt": "outside", // staged last, after the others
+
+		},
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "no files were written") {
+		t.Fatalf("result = %q, want an error saying nothing was written", result.ForLLM)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "a.txt")); string(got) != "original" {
+		t.Errorf("a.txt = %q, want it unchanged", got)
+	}
+	for _, path := range []string{"b.txt", "z/nested.txt", "../escape.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, path)); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist", path)
+		}
+	}
+	assertNoStagedFiles(t, tmpDir)
+}
+
+// failingRenameFs fails renames onto one path, to simulate an error after
+// some files are already in place.
+type failingRenameFs struct {
+	fileSystem
+	failOn string
+}
+
+func (f *failingRenameFs) Rename(oldpath, newpath string) error {
+	if newpath == f.failOn {
+		return errors.New("disk full")
+	}
+	return f.fileSystem.Rename(oldpath, newpath)
+}
+
+func TestWriteFilesTool_RollsBackOnRenameFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("original"), 0o600)
+	tool := &WriteFilesTool{fs: &failingRenameFs{fileSystem: &sandboxFs{workspace: tmpDir}, failOn: "c.txt"}}
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"files": map[string]any{"a.txt": "changed", "b.txt": "new", "c.txt": "new"},
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "disk full") {
+		t.Fatalf("result = %q, want the rename error", result.ForLLM)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "a.txt")); string(got) != "original" {
+		t.Errorf("a.txt = %q, want the original content restored", got)
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "a.txt")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("a.txt mode = %v (%v), want 0600 kept", info.Mode().Perm(), err)
+	}
+	for _, path := range []string{"b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, path)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed", path)
+		}
+	}
+	assertNoStagedFiles(t, tmpDir)
+}
+
+func TestWriteFilesTool_InvalidArgs(t *testing.T) {
+	tmpDir := t.TempDir()
+	tool := NewWriteFilesTool(tmpDir, true)
+	for _, args := range []map[string]any{
+		{},
+		{"files": map[string]any{}},
+		{"files": map[string]any{"a.txt": 42.0}},
+		{"files": map[string]any{"a.txt": "x", "./a.txt": "y"}},
+		{"files": map[string]any{"a.txt": "x", filepath.Join(tmpDir, "a.txt"): "y"}},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("args %v should fail, got %q", args, result.ForLLM)
+		}
+	}
+}
+
+func assertNoStagedFiles(t *testing.T, dir string) {
+	t.Helper()
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && (strings.HasSuffix(path, ".stage") || strings.HasSuffix(path, ".stage.old")) {
+			t.Errorf("staged file left behind: %s", path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"strings"
+)
+
+// codeFence opens and closes fenced code blocks.
+const codeFence = "```"
+
+// emphasisMarkers are the paired markers repaired by SanitizeMarkdown.
+var emphasisMarkers = []string{"**", "__", "~~"}
+
+// SanitizeMarkdown repairs model-generated markdown so renderers that expect
+// balanced markup, such as the Telegram HTML converter, don't corrupt it.
+// Invalid UTF-8 is dropped and an unclosed code fence is closed. Outside code,
+// an unpaired inline-code backtick is removed, as is any emphasis marker
+// (**, __, ~~) without a partner on its line or whose pair would overlap
+// another one.
+func SanitizeMarkdown(text string) string {
+	text = strings.ToValidUTF8(text, "")
+
+	var sb strings.Builder
+	inFence := false
+	for {
+		idx := strings.Index(text, codeFence)
+		if idx < 0 {
+			break
+		}
+		if inFence {
+			sb.WriteString(text[:idx])
+		} else {
+			sb.WriteString(sanitizeMarkdownText(text[:idx]))
+		}
+		sb.WriteString(codeFence)
+		text = text[idx+len(codeFence):]
+		inFence = !inFence
+	}
+
+	if !inFence {
+		sb.WriteString(sanitizeMarkdownText(text))
+		return sb.String()
+	}
+	sb.WriteString(text)
+	if !strings.HasSuffix(text, "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(codeFence)
+	return sb.String()
+}
+
+// sanitizeMarkdownText repairs text outside code fences line by line.
+func sanitizeMarkdownText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = sanitizeMarkdownLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownMarker is an emphasis marker found at pos in a line.
+type markdownMarker struct {
+	pos    int
+	marker string
+}
+
+func sanitizeMarkdownLine(line string) string {
+	// An odd backtick would open an inline code span that never ends
+	if strings.Count(line, "`")%2 == 1 {
+		idx := strings.LastIndex(line, "`")
+		line = line[:idx] + line[idx+1:]
+	}
+
+	// Collect emphasis markers outside inline code
+	var markers []markdownMarker
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		if line[i] == '`' {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range emphasisMarkers {
+			if strings.HasPrefix(line[i:], m) {
+				markers = append(markers, markdownMarker{pos: i, marker: m})
+				i += len(m) - 1
+				break
+			}
+		}
+	}
+	if len(markers) == 0 {
+		return line
+	}
+
+	// Pair markers like nested brackets. Closing a pair leaves markers opened
+	// inside it unpaired, so pairs never overlap.
+	drop := make(map[int]bool)
+	var open []int
+	for i, m := range markers {
+		j := len(open) - 1
+		for j >= 0 && markers[open[j]].marker != m.marker {
+			j--
+		}
+		if j < 0 {
+			open = append(open, i)
+			continue
+		}
+		for _, k := range open[j+1:] {
+			drop[k] = true
+		}
+		open = open[:j]
+	}
+	for _, k := range open {
+		drop[k] = true
+	}
+	if len(drop) == 0 {
+		return line
+	}
+
+	var sb strings.Builder
+	last := 0
+	for i, m := range markers {
+		if drop[i] {
+			sb.WriteString(line[last:m.pos])
+			last = m.pos + len(m.marker)
+		}
+	}
+	sb.WriteString(line[last:])
+	return sb.String()
+}
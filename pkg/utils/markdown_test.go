@@ -0,0 +1,60 @@
+package utils
+
+import "testing"
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "balanced markdown unchanged",
+			input: "**Done.** See `main.go` and ~~old~~ __new__ code:\n```go\nx := a**b\n```",
+			want:  "**Done.** See `main.go` and ~~old~~ __new__ code:\n```go\nx := a**b\n```",
+		},
+		{
+			name:  "unclosed code fence is closed",
+			input: "Result:\n```python\nprint('**hi**')",
+			want:  "Result:\n```python\nprint('**hi**')\n```",
+		},
+		{
+			name:  "unpaired bold removed",
+			input: "**Summary: three files changed",
+			want:  "Summary: three files changed",
+		},
+		{
+			name:  "overlapping markers",
+			input: "**bold ~~struck** text~~",
+			want:  "**bold struck** text",
+		},
+		{
+			name:  "odd backtick removed",
+			input: "run `go test ./... to check",
+			want:  "run go test ./... to check",
+		},
+		{
+			name:  "markers inside inline code ignored",
+			input: "call `__init__` or `a**b`",
+			want:  "call `__init__` or `a**b`",
+		},
+		{
+			name:  "pairs do not span lines",
+			input: "**first line\nsecond** line",
+			want:  "first line\nsecond line",
+		},
+		{
+			name:  "invalid utf-8 dropped",
+			input: "caf\xc3",
+			want:  "caf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeMarkdown(tt.input); got != tt.want {
+				t.Errorf("SanitizeMarkdown(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
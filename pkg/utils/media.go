@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -52,11 +57,46 @@ type DownloadOptions struct {
 	Timeout      time.Duration
 	ExtraHeaders map[string]string
 	LoggerPrefix string
+	// Progress, if set, is called as data is written with the bytes downloaded
+	// so far (including any resumed prefix) and the total size, or -1 if unknown.
+	Progress func(downloaded, total int64)
+	// Resume continues a download that breaks off partway with an HTTP Range
+	// request, up to resumeAttempts times, instead of failing it.
+	Resume bool
+	// ExpectedSize, if positive, rejects a download whose size differs from it.
+	ExpectedSize int64
+	// ComputeSHA256 fills DownloadResult.SHA256 with the file's checksum.
+	ComputeSHA256 bool
+}
+
+// DownloadResult describes a completed download.
+type DownloadResult struct {
+	Path   string
+	Size   int64
+	SHA256 string // hex-encoded; empty unless DownloadOptions.ComputeSHA256 is set
 }
 
 // DownloadFile downloads a file from URL to a local temp directory.
 // Returns the local file path or empty string on error.
 func DownloadFile(url, filename string, opts DownloadOptions) string {
+	result, err := DownloadFileWithResult(url, filename, opts)
+	if err != nil {
+		prefix := opts.LoggerPrefix
+		if prefix == "" {
+			prefix = "utils"
+		}
+		logger.ErrorCF(prefix, "Failed to download file", map[string]any{
+			"error": err.Error(),
+			"url":   url,
+		})
+		return ""
+	}
+	return result.Path
+}
+
+// DownloadFileWithResult downloads a file like DownloadFile and returns its
+// path, size and, if requested, SHA-256 checksum.
+func DownloadFileWithResult(url, filename string, opts DownloadOptions) (*DownloadResult, error) {
 	// Set defaults
 	if opts.Timeout == 0 {
 		opts.Timeout = 60 * time.Second
@@ -67,72 +107,211 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 
 	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
 	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
 	}
 
-	// Generate unique filename with UUID prefix to prevent conflicts
+	// Generate unique filename with UUID prefix to prevent conflicts. Data is
+	// written to a temp file of its own, so concurrent downloads of the same
+	// file never share one.
 	safeName := SanitizeFilename(filename)
 	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+safeName)
+	part, err := os.CreateTemp(mediaDir, safeName+"-*.part")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local file: %w", err)
+	}
+	partPath := part.Name()
+	part.Close()
+
+	client := &http.Client{Timeout: opts.Timeout}
+	err = downloadToPath(client, url, partPath, opts)
+	for attempt := 1; opts.Resume && attempt < resumeAttempts && resumable(err); attempt++ {
+		if errors.Is(err, errRangeNotSatisfiable) {
+			// The partial file does not match the remote file; start over
+			if err := os.Truncate(partPath, 0); err != nil {
+				os.Remove(partPath)
+				return nil, fmt.Errorf("failed to create local file: %w", err)
+			}
+		}
+		logger.DebugCF(opts.LoggerPrefix, "Retrying download", map[string]any{
+			"url":     url,
+			"attempt": attempt + 1,
+			"error":   err.Error(),
+		})
+		err = downloadToPath(client, url, partPath, opts)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return nil, err
+	}
+
+	info, err := os.Stat(partPath)
+	if err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to stat downloaded file: %w", err)
+	}
+	if opts.ExpectedSize > 0 && info.Size() != opts.ExpectedSize {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("downloaded file size %d does not match expected size %d", info.Size(), opts.ExpectedSize)
+	}
+
+	result := &DownloadResult{Path: localPath, Size: info.Size()}
+	if opts.ComputeSHA256 {
+		if result.SHA256, err = fileSHA256(partPath); err != nil {
+			os.Remove(partPath)
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("failed to create local file: %w", err)
+	}
+
+	logger.DebugCF(opts.LoggerPrefix, "File downloaded successfully", map[string]any{
+		"path":   localPath,
+		"size":   result.Size,
+		"sha256": result.SHA256,
+	})
+
+	return result, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open downloaded file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash downloaded file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resumeAttempts is how many times a resumable download is tried in total.
+const resumeAttempts = 3
+
+var (
+	errRangeNotSatisfiable = errors.New("requested range not satisfiable")
+	// errInterrupted marks a download that broke off and can be continued
+	errInterrupted = errors.New("download interrupted")
+)
+
+// resumable reports whether a download that failed with err can be retried.
+func resumable(err error) bool {
+	return errors.Is(err, errInterrupted) || errors.Is(err, errRangeNotSatisfiable)
+}
+
+// downloadToPath downloads url into path. With opts.Resume, data already in
+// path is continued with a Range request; a server that ignores the range
+// causes the file to be rewritten from the start.
+func downloadToPath(client *http.Client, url, path string, opts DownloadOptions) error {
+	var offset int64
+	if opts.Resume {
+		if info, err := os.Stat(path); err == nil {
+			offset = info.Size()
+		}
+	}
 
-	// Create HTTP request
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to create download request", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+		return fmt.Errorf("failed to create download request: %w", err)
 	}
 
 	// Add extra headers (e.g., Authorization for Slack)
 	for key, value := range opts.ExtraHeaders {
 		req.Header.Set(key, value)
 	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	client := &http.Client{Timeout: opts.Timeout}
 	resp, err := client.Do(req)
 	if err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to download file", map[string]any{
-			"error": err.Error(),
-			"url":   url,
-		})
-		return ""
+		return fmt.Errorf("%w: request failed: %w", errInterrupted, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		logger.ErrorCF(opts.LoggerPrefix, "File download returned non-200 status", map[string]any{
-			"status": resp.StatusCode,
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			return fmt.Errorf("%w: unexpected Content-Range %q", errRangeNotSatisfiable, resp.Header.Get("Content-Range"))
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		logger.DebugCF(opts.LoggerPrefix, "Resuming download", map[string]any{
 			"url":    url,
+			"offset": offset,
 		})
-		return ""
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		return errRangeNotSatisfiable
+	case resp.StatusCode == http.StatusOK:
+		// Full content, either requested or because the server ignored Range
+		offset = 0
+	default:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
 	}
 
-	out, err := os.Create(localPath)
+	out, err := os.OpenFile(path, flags, 0o600)
 	if err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to create local file", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+		return fmt.Errorf("failed to create local file: %w", err)
 	}
-	defer out.Close()
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		out.Close()
-		os.Remove(localPath)
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to write file", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
 	}
 
-	logger.DebugCF(opts.LoggerPrefix, "File downloaded successfully", map[string]any{
-		"path": localPath,
-	})
+	var dst io.Writer = out
+	if opts.Progress != nil {
+		opts.Progress(offset, total)
+		dst = &progressWriter{w: out, written: offset, total: total, fn: opts.Progress}
+	}
+
+	_, err = io.Copy(dst, resp.Body)
+	if closeErr := out.Close(); closeErr != nil {
+		return fmt.Errorf("failed to write file: %w", closeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInterrupted, err)
+	}
+	return nil
+}
+
+// contentRangeStart parses the first byte position of a "bytes start-end/size"
+// Content-Range header.
+func contentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	startStr, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(startStr), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// progressWriter reports cumulative bytes written to a progress callback.
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	total   int64
+	fn      func(downloaded, total int64)
+}
 
-	return localPath
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.fn(p.written, p.total)
+	return n, err
 }
 
 // DownloadFileSimple is a simplified version of DownloadFile without options
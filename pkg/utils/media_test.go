@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with Range support and records the Range headers it receives.
+// The first interrupt responses announce the full length but break off after 1000 bytes.
+type rangeServer struct {
+	content     []byte
+	ignoreRange bool
+	interrupt   int
+	mu          sync.Mutex
+	ranges      []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	cut := len(s.ranges) <= s.interrupt
+	s.mu.Unlock()
+
+	if cut {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(s.content[:1000])
+		return
+	}
+	if s.ignoreRange {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(s.content))
+}
+
+func (s *rangeServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ranges)
+}
+
+func testContent() []byte {
+	return []byte(strings.Repeat("0123456789abcdef", 4096))
+}
+
+// mediaDirEntries returns the names of the files left in the media directory.
+func mediaDirEntries(t *testing.T) []string {
+	t.Helper()
+	entries, _ := os.ReadDir(filepath.Join(os.TempDir(), "picoclaw_media"))
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestDownloadFile_ResumesInterruptedDownload(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+	srv := &rangeServer{content: content, interrupt: 1}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	var lastDownloaded, lastTotal int64
+	path := DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{
+		Resume: true,
+		Progress: func(downloaded, total int64) {
+			lastDownloaded, lastTotal = downloaded, total
+		},
+	})
+	if path == "" {
+		t.Fatal("DownloadFile() failed")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d matching bytes", len(got), len(content))
+	}
+	if ranges := srv.requests(); !slices.Equal(ranges, []string{"", "bytes=1000-"}) {
+		t.Errorf("Range headers = %q, want a full request then \"bytes=1000-\"", ranges)
+	}
+	if lastDownloaded != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Errorf("final progress = %d/%d, want %d/%d", lastDownloaded, lastTotal, len(content), len(content))
+	}
+	if entries := mediaDirEntries(t); len(entries) != 1 {
+		t.Errorf("media dir = %q, want only the downloaded file", entries)
+	}
+}
+
+func TestDownloadFile_ServerIgnoresRange(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+	server := httptest.NewServer(&rangeServer{content: content, ignoreRange: true, interrupt: 1})
+	defer server.Close()
+
+	path := DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{Resume: true})
+	if path == "" {
+		t.Fatal("DownloadFile() failed")
+	}
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want the full %d bytes without duplication", len(got), len(content))
+	}
+}
+
+func TestDownloadFile_RestartsOnUnsatisfiableRange(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+
+	// The file shrank after the first attempt broke off, so its range is gone
+	var ranges []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		n := len(ranges)
+		mu.Unlock()
+		switch n {
+		case 1:
+			w.Header().Set("Content-Length", "100000")
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes.Repeat([]byte("x"), 70000))
+		default:
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	path := DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{Resume: true})
+	if path == "" {
+		t.Fatal("DownloadFile() failed")
+	}
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+	if !slices.Equal(ranges, []string{"", "bytes=70000-", ""}) {
+		t.Errorf("Range headers = %q, want a full request, a ranged one, then a full one", ranges)
+	}
+}
+
+func TestDownloadFile_RemovesPartialFileAfterLastAttempt(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	srv := &rangeServer{content: testContent(), interrupt: resumeAttempts}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	if path := DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{Resume: true}); path != "" {
+		t.Fatalf("DownloadFile() = %q, want failure", path)
+	}
+	if got := len(srv.requests()); got != resumeAttempts {
+		t.Errorf("server got %d requests, want %d", got, resumeAttempts)
+	}
+	if entries := mediaDirEntries(t); len(entries) != 0 {
+		t.Errorf("media dir has leftover files %q, want none", entries)
+	}
+}
+
+func TestDownloadFile_NoResumeRemovesPartialFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	srv := &rangeServer{content: testContent(), interrupt: 1}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	if path := DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{}); path != "" {
+		t.Fatalf("DownloadFile() = %q, want failure", path)
+	}
+	if got := len(srv.requests()); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+	if entries := mediaDirEntries(t); len(entries) != 0 {
+		t.Errorf("media dir has leftover files %q, want none", entries)
+	}
+}
+
+func TestDownloadFile_ConcurrentDownloadsOfSameFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+	server := httptest.NewServer(&rangeServer{content: content, interrupt: 2})
+	defer server.Close()
+
+	paths := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paths[i] = DownloadFile(server.URL+"/file.bin", "file.bin", DownloadOptions{Resume: true})
+		}()
+	}
+	wg.Wait()
+
+	for i, path := range paths {
+		if path == "" {
+			t.Fatalf("download %d failed", i)
+		}
+		if got, _ := os.ReadFile(path); !bytes.Equal(got, content) {
+			t.Errorf("download %d has %d bytes, want %d matching bytes", i, len(got), len(content))
+		}
+	}
+	if entries := mediaDirEntries(t); len(entries) != len(paths) {
+		t.Errorf("media dir = %q, want the %d downloaded files only", entries, len(paths))
+	}
+}
+
+func TestDownloadFileWithResult_SHA256(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+	server := httptest.NewServer(&rangeServer{content: content})
+	defer server.Close()
+
+	result, err := DownloadFileWithResult(server.URL+"/file.bin", "file.bin", DownloadOptions{
+		ComputeSHA256: true,
+		ExpectedSize:  int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("DownloadFileWithResult() error = %v", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", result.SHA256, sum)
+	}
+	if result.Size != int64(len(content)) {
+		t.Errorf("Size = %d, want %d", result.Size, len(content))
+	}
+}
+
+func TestDownloadFileWithResult_SizeMismatch(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	content := testContent()
+	server := httptest.NewServer(&rangeServer{content: content})
+	defer server.Close()
+
+	result, err := DownloadFileWithResult(server.URL+"/file.bin", "file.bin", DownloadOptions{
+		ExpectedSize: int64(len(content)) + 1,
+	})
+	if err == nil {
+		t.Fatalf("DownloadFileWithResult() = %+v, want size mismatch error", result)
+	}
+	if !strings.Contains(err.Error(), "does not match expected size") {
+		t.Errorf("error = %v, want size mismatch", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(os.TempDir(), "picoclaw_media"))
+	if len(entries) != 0 {
+		t.Errorf("media dir has %d leftover files, want none", len(entries))
+	}
+}
@@ -16,6 +16,14 @@ import (
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
+// Transcriber converts an audio file to text.
+type Transcriber interface {
+	// Transcribe transcribes the audio file. language is an optional
+	// ISO-639-1 hint (e.g. "en"); empty means auto-detect.
+	Transcribe(ctx context.Context, audioFilePath, language string) (*TranscriptionResponse, error)
+	IsAvailable() bool
+}
+
 type GroqTranscriber struct {
 	apiKey     string
 	apiBase    string
@@ -41,8 +49,8 @@ func NewGroqTranscriber(apiKey string) *GroqTranscriber {
 	}
 }
 
-func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error) {
-	logger.InfoCF("voice", "Starting transcription", map[string]any{"audio_file": audioFilePath})
+func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath, language string) (*TranscriptionResponse, error) {
+	logger.InfoCF("voice", "Starting transcription", map[string]any{"audio_file": audioFilePath, "language": language})
 
 	audioFile, err := os.Open(audioFilePath)
 	if err != nil {
@@ -89,6 +97,13 @@ func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string)
 		return nil, fmt.Errorf("failed to write response_format field: %w", err)
 	}
 
+	if language != "" {
+		if err = writer.WriteField("language", language); err != nil {
+			logger.ErrorCF("voice", "Failed to write language field", map[string]any{"error": err})
+			return nil, fmt.Errorf("failed to write language field: %w", err)
+		}
+	}
+
 	if err = writer.Close(); err != nil {
 		logger.ErrorCF("voice", "Failed to close multipart writer", map[string]any{"error": err})
 		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
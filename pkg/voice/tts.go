@@ -0,0 +1,120 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Synthesizer converts text into a voice note. Synthesize returns the path of
+// a temporary ogg/opus file; the caller is responsible for removing it.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) (string, error)
+}
+
+// HTTPSynthesizer calls an OpenAI-compatible /audio/speech endpoint.
+type HTTPSynthesizer struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewHTTPSynthesizer(apiBase, apiKey, model, voice string) *HTTPSynthesizer {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "tts-1"
+	}
+	if voice == "" {
+		voice = "alloy"
+	}
+
+	logger.DebugCF("voice", "Creating HTTP synthesizer", map[string]any{
+		"api_base":    apiBase,
+		"model":       model,
+		"voice":       voice,
+		"has_api_key": apiKey != "",
+	})
+
+	return &HTTPSynthesizer{
+		apiKey:  apiKey,
+		apiBase: strings.TrimRight(apiBase, "/"),
+		model:   model,
+		voice:   voice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+func (s *HTTPSynthesizer) Synthesize(ctx context.Context, text string) (string, error) {
+	logger.InfoCF("voice", "Starting speech synthesis", map[string]any{"text_length": len(text)})
+
+	payload, err := json.Marshal(map[string]any{
+		"model":           s.model,
+		"input":           text,
+		"voice":           s.voice,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := s.apiBase + "/audio/speech"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		logger.ErrorCF("voice", "Failed to send synthesis request", map[string]any{"error": err})
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		logger.ErrorCF("voice", "TTS API error", map[string]any{
+			"status_code": resp.StatusCode,
+			"response":    string(body),
+		})
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	out, err := os.CreateTemp("", "picoclaw-tts-*.ogg")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	written, err := io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to write audio: %w", err)
+	}
+
+	logger.InfoCF("voice", "Speech synthesis completed", map[string]any{
+		"path":       out.Name(),
+		"size_bytes": written,
+	})
+
+	return out.Name(), nil
+}
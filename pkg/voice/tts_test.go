@@ -0,0 +1,77 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTTPSynthesizer_Synthesize(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "audio/ogg")
+		w.Write([]byte("OggS-audio"))
+	}))
+	defer server.Close()
+
+	s := NewHTTPSynthesizer(server.URL+"/v1/", "sk-test", "", "nova")
+	path, err := s.Synthesize(context.Background(), "Hello there")
+	if err != nil {
+		t.Fatalf("Synthesize() error = %v", err)
+	}
+	defer os.Remove(path)
+
+	if gotPath != "/v1/audio/speech" {
+		t.Errorf("request path = %q, want /v1/audio/speech", gotPath)
+	}
+	if gotAuth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want Bearer sk-test", gotAuth)
+	}
+	want := map[string]any{"model": "tts-1", "input": "Hello there", "voice": "nova", "response_format": "opus"}
+	for key, value := range want {
+		if gotBody[key] != value {
+			t.Errorf("request %s = %v, want %v", key, gotBody[key], value)
+		}
+	}
+
+	if !strings.HasSuffix(path, ".ogg") {
+		t.Errorf("audio path = %q, want an .ogg file", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "OggS-audio" {
+		t.Errorf("audio file = %q, want the response body", data)
+	}
+}
+
+func TestHTTPSynthesizer_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization sent without an API key: %q", r.Header.Get("Authorization"))
+		}
+		http.Error(w, `{"error":"bad voice"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := NewHTTPSynthesizer(server.URL, "", "", "")
+	path, err := s.Synthesize(context.Background(), "Hello")
+	if err == nil {
+		os.Remove(path)
+		t.Fatal("Synthesize() succeeded, want an API error")
+	}
+	if !strings.Contains(err.Error(), "status 400") || !strings.Contains(err.Error(), "bad voice") {
+		t.Errorf("error = %v, want the status and response body", err)
+	}
+}